@@ -8,6 +8,7 @@ import (
 	"github.com/filecoin-project/go-leb128"
 	cbor "github.com/ipfs/go-ipld-cbor"
 	"github.com/libp2p/go-libp2p-peer"
+	ma "github.com/multiformats/go-multiaddr"
 
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/proofs"
@@ -51,6 +52,20 @@ const (
 	PoStProofs
 	// Boolean is a bool
 	Boolean
+	// Multiaddrs is an array of multiaddrs
+	Multiaddrs
+	// Struct is a structure of named fields, described by a Schema. Its go
+	// type is map[string]interface{}.
+	Struct
+	// Array is an array of values of one type, described by a Schema. Its go
+	// type is []interface{}.
+	Array
+	// Map is a map from strings to values of one type, described by a
+	// Schema. Its go type is map[string]interface{}.
+	Map
+	// Optional is a value that may be missing, described by a Schema. Its go
+	// type is interface{}, nil when missing.
+	Optional
 )
 
 func (t Type) String() string {
@@ -85,15 +100,33 @@ func (t Type) String() string {
 		return "[]proofs.PoStProof"
 	case Boolean:
 		return "bool"
+	case Multiaddrs:
+		return "[]multiaddr.Multiaddr"
+	case Struct:
+		return "struct"
+	case Array:
+		return "array"
+	case Map:
+		return "map"
+	case Optional:
+		return "optional"
 	default:
 		return "<unknown type>"
 	}
 }
 
+// IsCompound returns whether values of the type are made of values of other
+// types, so that a Schema is needed to describe them.
+func (t Type) IsCompound() bool {
+	return t == Struct || t == Array || t == Map || t == Optional
+}
+
 // Value pairs a go value with its ABI type
 type Value struct {
 	Type Type
 	Val  interface{}
+	// Schema describes values of compound types and is nil otherwise.
+	Schema *Schema
 }
 
 func (av *Value) String() string {
@@ -128,6 +161,10 @@ func (av *Value) String() string {
 		return fmt.Sprint(av.Val.([]proofs.PoStProof))
 	case Boolean:
 		return fmt.Sprint(av.Val.(bool))
+	case Multiaddrs:
+		return fmt.Sprint(av.Val.([]ma.Multiaddr))
+	case Struct, Array, Map, Optional:
+		return fmt.Sprint(av.Val)
 	default:
 		return "<unknown type>"
 	}
@@ -246,12 +283,29 @@ func (av *Value) Serialize() ([]byte, error) {
 		}
 
 		return []byte{b}, nil
+	case Multiaddrs:
+		addrs, ok := av.Val.([]ma.Multiaddr)
+		if !ok {
+			return nil, &typeError{[]ma.Multiaddr{}, av.Val}
+		}
+
+		raw := make([][]byte, len(addrs))
+		for i, addr := range addrs {
+			raw[i] = addr.Bytes()
+		}
+		return cbor.DumpObject(raw)
+	case Struct, Array, Map, Optional:
+		if av.Schema == nil || av.Schema.Type != av.Type {
+			return nil, fmt.Errorf("missing schema for value of type %s", av.Type)
+		}
+		return av.Schema.encode(av.Val)
 	default:
 		return nil, fmt.Errorf("unrecognized Type: %d", av.Type)
 	}
 }
 
 // ToValues converts from a slice of go abi-compatible values to abi values.
+// Abi values, which values of compound types must be, are kept as they are.
 // empty slices are normalized to nil
 func ToValues(i []interface{}) ([]*Value, error) {
 	if len(i) == 0 {
@@ -261,6 +315,8 @@ func ToValues(i []interface{}) ([]*Value, error) {
 	out := make([]*Value, 0, len(i))
 	for _, v := range i {
 		switch v := v.(type) {
+		case *Value:
+			out = append(out, v)
 		case address.Address:
 			out = append(out, &Value{Type: Address, Val: v})
 		case *types.AttoFIL:
@@ -289,6 +345,8 @@ func ToValues(i []interface{}) ([]*Value, error) {
 			out = append(out, &Value{Type: PoStProofs, Val: v})
 		case bool:
 			out = append(out, &Value{Type: Boolean, Val: v})
+		case []ma.Multiaddr:
+			out = append(out, &Value{Type: Multiaddrs, Val: v})
 		default:
 			return nil, fmt.Errorf("unsupported type: %T", v)
 		}
@@ -410,6 +468,25 @@ func Deserialize(data []byte, t Type) (*Value, error) {
 			Type: t,
 			Val:  b,
 		}, nil
+	case Multiaddrs:
+		var raw [][]byte
+		if err := cbor.DecodeInto(data, &raw); err != nil {
+			return nil, err
+		}
+		var addrs []ma.Multiaddr
+		for _, b := range raw {
+			addr, err := ma.NewMultiaddrBytes(b)
+			if err != nil {
+				return nil, err
+			}
+			addrs = append(addrs, addr)
+		}
+		return &Value{
+			Type: t,
+			Val:  addrs,
+		}, nil
+	case Struct, Array, Map, Optional:
+		return nil, fmt.Errorf("missing schema for value of type %s", t)
 	case Invalid:
 		return nil, ErrInvalidType
 	default:
@@ -432,6 +509,11 @@ var typeTable = map[Type]reflect.Type{
 	CommitmentsMap: reflect.TypeOf(map[string]types.Commitments{}),
 	PoStProofs:     reflect.TypeOf([]proofs.PoStProof{}),
 	Boolean:        reflect.TypeOf(false),
+	Multiaddrs:     reflect.TypeOf([]ma.Multiaddr{}),
+	Struct:         reflect.TypeOf(map[string]interface{}{}),
+	Array:          reflect.TypeOf([]interface{}{}),
+	Map:            reflect.TypeOf(map[string]interface{}{}),
+	Optional:       reflect.TypeOf((*interface{})(nil)).Elem(),
 }
 
 // TypeMatches returns whether or not 'val' is the go type expected for the given ABI type
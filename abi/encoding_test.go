@@ -4,8 +4,10 @@ import (
 	"math/big"
 	"testing"
 
-	"github.com/filecoin-project/go-filecoin/address"
+	ma "github.com/multiformats/go-multiaddr"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/filecoin-project/go-filecoin/address"
 )
 
 // TODO: tests that check the exact serialization of different inputs.
@@ -25,6 +27,10 @@ func TestBasicEncodingRoundTrip(t *testing.T) {
 		"a string":   {"flugzeug"},
 		"mixed":      {big.NewInt(17), []byte("beep"), "mr rogers", addrGetter()},
 		"sector ids": {uint64(1234), uint64(0)},
+		"multiaddrs": {[]ma.Multiaddr{
+			ma.StringCast("/ip4/1.2.3.4/tcp/6000"),
+			ma.StringCast("/ip4/1.2.3.4/tcp/6000/p2p-circuit"),
+		}},
 	}
 
 	for tname, tcase := range cases {
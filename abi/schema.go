@@ -0,0 +1,465 @@
+package abi
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	cbor "github.com/ipfs/go-ipld-cbor"
+	"github.com/libp2p/go-libp2p-peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/pkg/errors"
+)
+
+// Schema describes the type of a value passed through the filecoin ABI.
+// Values of the basic types are described by their Type alone, values of
+// compound types by the schemas of the values they are made of, so that
+// schemas describe values without the go types of the actors taking or
+// returning them.
+//
+// A Struct is encoded as the array of the encodings of its fields, in order,
+// an Array as the array of the encodings of its elements, a Map as the map of
+// the encodings of its values and an Optional as an array of the encoding of
+// its value, empty when missing.
+type Schema struct {
+	Type Type
+	// Fields are the fields of a Struct, in order.
+	Fields []Field
+	// Elem describes the elements of an Array, the values of a Map and the
+	// value of an Optional.
+	Elem *Schema
+}
+
+// Field is a named field of a Struct.
+type Field struct {
+	Name   string  `json:"name"`
+	Schema *Schema `json:"schema"`
+}
+
+// Basic returns the schema of values of a basic type.
+func Basic(t Type) *Schema {
+	return &Schema{Type: t}
+}
+
+// Basics returns the schemas of values of the given basic types.
+func Basics(types []Type) []*Schema {
+	schemas := make([]*Schema, len(types))
+	for i, t := range types {
+		schemas[i] = Basic(t)
+	}
+	return schemas
+}
+
+// StructOf returns the schema of structures with the given fields.
+func StructOf(fields ...Field) *Schema {
+	return &Schema{Type: Struct, Fields: fields}
+}
+
+// ArrayOf returns the schema of arrays of the given elements.
+func ArrayOf(elem *Schema) *Schema {
+	return &Schema{Type: Array, Elem: elem}
+}
+
+// MapOf returns the schema of maps from strings to the given values.
+func MapOf(elem *Schema) *Schema {
+	return &Schema{Type: Map, Elem: elem}
+}
+
+// OptionalOf returns the schema of the given values, possibly missing.
+func OptionalOf(elem *Schema) *Schema {
+	return &Schema{Type: Optional, Elem: elem}
+}
+
+func (s *Schema) String() string {
+	switch s.Type {
+	case Struct:
+		fields := make([]string, len(s.Fields))
+		for i, f := range s.Fields {
+			fields[i] = fmt.Sprintf("%s %s", f.Name, f.Schema)
+		}
+		return fmt.Sprintf("struct{%s}", strings.Join(fields, "; "))
+	case Array:
+		return fmt.Sprintf("[]%s", s.Elem)
+	case Map:
+		return fmt.Sprintf("map[string]%s", s.Elem)
+	case Optional:
+		return fmt.Sprintf("optional[%s]", s.Elem)
+	default:
+		return s.Type.String()
+	}
+}
+
+// Validate checks the schema describes values of known types, compound
+// types having all their parts described.
+func (s *Schema) Validate() error {
+	if s == nil {
+		return fmt.Errorf("missing schema")
+	}
+	switch s.Type {
+	case Invalid:
+		return ErrInvalidType
+	case Struct:
+		names := make(map[string]bool)
+		for _, f := range s.Fields {
+			if f.Name == "" || names[f.Name] {
+				return fmt.Errorf("invalid field name %q", f.Name)
+			}
+			names[f.Name] = true
+			if err := f.Schema.Validate(); err != nil {
+				return errors.Wrapf(err, "invalid field %s", f.Name)
+			}
+		}
+		return nil
+	case Array, Map, Optional:
+		return s.Elem.Validate()
+	default:
+		if _, ok := typeTable[s.Type]; !ok {
+			return fmt.Errorf("unrecognized Type: %d", s.Type)
+		}
+		return nil
+	}
+}
+
+// NewValue pairs a go value with the schema describing it.
+func (s *Schema) NewValue(val interface{}) *Value {
+	if s.Type.IsCompound() {
+		return &Value{Type: s.Type, Val: val, Schema: s}
+	}
+	return &Value{Type: s.Type, Val: val}
+}
+
+// Deserialize converts the given bytes to a value of the schema.
+func (s *Schema) Deserialize(data []byte) (*Value, error) {
+	if !s.Type.IsCompound() {
+		return Deserialize(data, s.Type)
+	}
+	val, err := s.decode(data)
+	if err != nil {
+		return nil, err
+	}
+	return s.NewValue(val), nil
+}
+
+func (s *Schema) encode(val interface{}) ([]byte, error) {
+	switch s.Type {
+	case Struct:
+		m, ok := val.(map[string]interface{})
+		if !ok {
+			return nil, &typeError{map[string]interface{}{}, val}
+		}
+		if len(m) != len(s.Fields) {
+			return nil, fmt.Errorf("expected %d fields, but got %d", len(s.Fields), len(m))
+		}
+		arr := make([][]byte, len(s.Fields))
+		for i, f := range s.Fields {
+			fv, ok := m[f.Name]
+			if !ok {
+				return nil, fmt.Errorf("missing field %s", f.Name)
+			}
+			data, err := f.Schema.NewValue(fv).Serialize()
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid field %s", f.Name)
+			}
+			arr[i] = data
+		}
+		return cbor.DumpObject(arr)
+	case Array:
+		elems, ok := val.([]interface{})
+		if !ok {
+			return nil, &typeError{[]interface{}{}, val}
+		}
+		arr := make([][]byte, len(elems))
+		for i, ev := range elems {
+			data, err := s.Elem.NewValue(ev).Serialize()
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid element %d", i)
+			}
+			arr[i] = data
+		}
+		return cbor.DumpObject(arr)
+	case Map:
+		m, ok := val.(map[string]interface{})
+		if !ok {
+			return nil, &typeError{map[string]interface{}{}, val}
+		}
+		enc := make(map[string][]byte, len(m))
+		for k, ev := range m {
+			data, err := s.Elem.NewValue(ev).Serialize()
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid value %s", k)
+			}
+			enc[k] = data
+		}
+		return cbor.DumpObject(enc)
+	case Optional:
+		arr := [][]byte{}
+		if val != nil {
+			data, err := s.Elem.NewValue(val).Serialize()
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, data)
+		}
+		return cbor.DumpObject(arr)
+	default:
+		return s.NewValue(val).Serialize()
+	}
+}
+
+func (s *Schema) decode(data []byte) (interface{}, error) {
+	switch s.Type {
+	case Struct:
+		var arr [][]byte
+		if err := cbor.DecodeInto(data, &arr); err != nil {
+			return nil, err
+		}
+		if len(arr) != len(s.Fields) {
+			return nil, fmt.Errorf("expected %d fields, but got %d", len(s.Fields), len(arr))
+		}
+		m := make(map[string]interface{}, len(arr))
+		for i, f := range s.Fields {
+			v, err := f.Schema.decode(arr[i])
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid field %s", f.Name)
+			}
+			m[f.Name] = v
+		}
+		return m, nil
+	case Array:
+		var arr [][]byte
+		if err := cbor.DecodeInto(data, &arr); err != nil {
+			return nil, err
+		}
+		elems := make([]interface{}, len(arr))
+		for i, ed := range arr {
+			v, err := s.Elem.decode(ed)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid element %d", i)
+			}
+			elems[i] = v
+		}
+		return elems, nil
+	case Map:
+		var enc map[string][]byte
+		if err := cbor.DecodeInto(data, &enc); err != nil {
+			return nil, err
+		}
+		m := make(map[string]interface{}, len(enc))
+		for k, ed := range enc {
+			v, err := s.Elem.decode(ed)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid value %s", k)
+			}
+			m[k] = v
+		}
+		return m, nil
+	case Optional:
+		var arr [][]byte
+		if err := cbor.DecodeInto(data, &arr); err != nil {
+			return nil, err
+		}
+		switch len(arr) {
+		case 0:
+			return nil, nil
+		case 1:
+			return s.Elem.decode(arr[0])
+		default:
+			return nil, fmt.Errorf("expected at most 1 value, but got %d", len(arr))
+		}
+	default:
+		v, err := Deserialize(data, s.Type)
+		if err != nil {
+			return nil, err
+		}
+		return v.Val, nil
+	}
+}
+
+// ParseJSON converts a JSON value to a value of the schema. Structs and maps
+// are JSON objects, arrays are JSON arrays and missing optionals are null.
+// Values of the basic types are written as they are marshalled to JSON;
+// peer IDs and multiaddrs are written as strings.
+func (s *Schema) ParseJSON(raw json.RawMessage) (*Value, error) {
+	val, err := s.parseJSON(raw)
+	if err != nil {
+		return nil, err
+	}
+	return s.NewValue(val), nil
+}
+
+func (s *Schema) parseJSON(raw json.RawMessage) (interface{}, error) {
+	switch s.Type {
+	case Struct:
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return nil, err
+		}
+		if len(obj) != len(s.Fields) {
+			return nil, fmt.Errorf("expected %d fields, but got %d", len(s.Fields), len(obj))
+		}
+		m := make(map[string]interface{}, len(obj))
+		for _, f := range s.Fields {
+			fraw, ok := obj[f.Name]
+			if !ok {
+				return nil, fmt.Errorf("missing field %s", f.Name)
+			}
+			v, err := f.Schema.parseJSON(fraw)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid field %s", f.Name)
+			}
+			m[f.Name] = v
+		}
+		return m, nil
+	case Array:
+		var arr []json.RawMessage
+		if err := json.Unmarshal(raw, &arr); err != nil {
+			return nil, err
+		}
+		elems := make([]interface{}, len(arr))
+		for i, eraw := range arr {
+			v, err := s.Elem.parseJSON(eraw)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid element %d", i)
+			}
+			elems[i] = v
+		}
+		return elems, nil
+	case Map:
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return nil, err
+		}
+		m := make(map[string]interface{}, len(obj))
+		for k, eraw := range obj {
+			v, err := s.Elem.parseJSON(eraw)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid value %s", k)
+			}
+			m[k] = v
+		}
+		return m, nil
+	case Optional:
+		if string(raw) == "null" {
+			return nil, nil
+		}
+		return s.Elem.parseJSON(raw)
+	case PeerID:
+		var str string
+		if err := json.Unmarshal(raw, &str); err != nil {
+			return nil, err
+		}
+		return peer.IDB58Decode(str)
+	case Multiaddrs:
+		var strs []string
+		if err := json.Unmarshal(raw, &strs); err != nil {
+			return nil, err
+		}
+		addrs := make([]ma.Multiaddr, len(strs))
+		for i, str := range strs {
+			addr, err := ma.NewMultiaddr(str)
+			if err != nil {
+				return nil, err
+			}
+			addrs[i] = addr
+		}
+		return addrs, nil
+	default:
+		rt, ok := typeTable[s.Type]
+		if !ok {
+			return nil, fmt.Errorf("unrecognized Type: %d", s.Type)
+		}
+		ptr := reflect.New(rt)
+		if err := json.Unmarshal(raw, ptr.Interface()); err != nil {
+			return nil, err
+		}
+		return ptr.Elem().Interface(), nil
+	}
+}
+
+// schemaJSON is the JSON form of a Schema, naming its type.
+type schemaJSON struct {
+	Type   string  `json:"type"`
+	Fields []Field `json:"fields,omitempty"`
+	Elem   *Schema `json:"elem,omitempty"`
+}
+
+// MarshalJSON marshals the schema, naming its type so that it does not
+// depend on the numbering of types.
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	return json.Marshal(schemaJSON{Type: s.Type.String(), Fields: s.Fields, Elem: s.Elem})
+}
+
+// UnmarshalJSON unmarshals a schema marshalled by MarshalJSON.
+func (s *Schema) UnmarshalJSON(b []byte) error {
+	var sj schemaJSON
+	if err := json.Unmarshal(b, &sj); err != nil {
+		return err
+	}
+	t, err := ParseType(sj.Type)
+	if err != nil {
+		return err
+	}
+	*s = Schema{Type: t, Fields: sj.Fields, Elem: sj.Elem}
+	return nil
+}
+
+// ParseType returns the type of the given name, as returned by Type.String.
+func ParseType(name string) (Type, error) {
+	for t := Address; t <= Optional; t++ {
+		if t.String() == name {
+			return t, nil
+		}
+	}
+	return Invalid, fmt.Errorf("unrecognized type name: %s", name)
+}
+
+// MethodSchema describes the parameters and return values of a method.
+type MethodSchema struct {
+	Params []*Schema `json:"params"`
+	Return []*Schema `json:"return"`
+}
+
+// ExportsSchema describes the methods of an actor, by name. It is what
+// actors return to the exports query, JSON encoded.
+type ExportsSchema map[string]*MethodSchema
+
+// EncodeSchemaValues converts go values to the values of the given schemas
+// and encodes them to raw bytes.
+func EncodeSchemaValues(schemas []*Schema, vals []interface{}) ([]byte, error) {
+	if len(vals) != len(schemas) {
+		return nil, fmt.Errorf("expected %d values, but got %d", len(schemas), len(vals))
+	}
+	out := make([]*Value, len(vals))
+	for i, v := range vals {
+		out[i] = schemas[i].NewValue(v)
+	}
+	return EncodeValues(out)
+}
+
+// DecodeSchemaValues decodes an array of abi values from the given buffer,
+// using the provided schemas.
+func DecodeSchemaValues(data []byte, schemas []*Schema) ([]*Value, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var arr [][]byte
+	if err := cbor.DecodeInto(data, &arr); err != nil {
+		return nil, err
+	}
+
+	if len(arr) != len(schemas) {
+		return nil, fmt.Errorf("expected %d parameters, but got %d", len(schemas), len(arr))
+	}
+
+	out := make([]*Value, 0, len(schemas))
+	for i, s := range schemas {
+		v, err := s.Deserialize(arr[i])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
@@ -0,0 +1,125 @@
+package abi
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func testSchema() *Schema {
+	return StructOf(
+		Field{Name: "owner", Schema: Basic(Address)},
+		Field{Name: "amounts", Schema: ArrayOf(Basic(AttoFIL))},
+		Field{Name: "labels", Schema: MapOf(Basic(String))},
+		Field{Name: "limit", Schema: OptionalOf(Basic(Integer))},
+	)
+}
+
+func TestSchemaEncodingRoundTrip(t *testing.T) {
+	addrGetter := address.NewForTestGetter()
+
+	cases := map[string][]interface{}{
+		"basic": {addrGetter(), []byte("foo")},
+		"struct": {map[string]interface{}{
+			"owner":   addrGetter(),
+			"amounts": []interface{}{types.NewAttoFILFromFIL(1), types.NewAttoFILFromFIL(2)},
+			"labels":  map[string]interface{}{"a": "b"},
+			"limit":   big.NewInt(7),
+		}, []byte("foo")},
+		"empty parts": {map[string]interface{}{
+			"owner":   addrGetter(),
+			"amounts": []interface{}{},
+			"labels":  map[string]interface{}{},
+			"limit":   nil,
+		}, []byte("foo")},
+	}
+	schemas := map[string][]*Schema{
+		"basic":       {Basic(Address), Basic(Bytes)},
+		"struct":      {testSchema(), Basic(Bytes)},
+		"empty parts": {testSchema(), Basic(Bytes)},
+	}
+
+	for tname, tcase := range cases {
+		t.Run(tname, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			data, err := EncodeSchemaValues(schemas[tname], tcase)
+			require.NoError(err)
+
+			outVals, err := DecodeSchemaValues(data, schemas[tname])
+			require.NoError(err)
+			assert.Equal(tcase, FromValues(outVals))
+		})
+	}
+}
+
+func TestSchemaEncodingErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	schemas := []*Schema{testSchema()}
+
+	_, err := EncodeSchemaValues(schemas, []interface{}{map[string]interface{}{"owner": address.Undef}})
+	assert.Error(err)
+
+	_, err = EncodeSchemaValues(schemas, []interface{}{"not a struct"})
+	assert.Error(err)
+
+	_, err = EncodeSchemaValues(schemas, nil)
+	assert.Error(err)
+
+	_, err = ToEncodedValues(map[string]interface{}{})
+	assert.Error(err, "compound values need a schema")
+}
+
+func TestSchemaJSON(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	schema := testSchema()
+	require.NoError(schema.Validate())
+	assert.Equal("struct{owner address.Address; amounts []*types.AttoFIL; labels map[string]string; limit optional[*big.Int]}", schema.String())
+
+	data, err := json.Marshal(schema)
+	require.NoError(err)
+	assert.Contains(string(data), `"type":"address.Address"`)
+
+	var decoded Schema
+	require.NoError(json.Unmarshal(data, &decoded))
+	assert.Equal(schema, &decoded)
+
+	assert.Error(json.Unmarshal([]byte(`{"type":"nonsense"}`), &decoded))
+	assert.Error(ArrayOf(nil).Validate())
+	assert.Error(StructOf(Field{Name: "a", Schema: Basic(Bytes)}, Field{Name: "a", Schema: Basic(Bytes)}).Validate())
+}
+
+func TestSchemaParseJSON(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	owner := address.NewForTestGetter()()
+	raw := `{"owner": "` + owner.String() + `", "amounts": ["1", "2.5"], "labels": {"a": "b"}, "limit": null}`
+
+	val, err := testSchema().ParseJSON(json.RawMessage(raw))
+	require.NoError(err)
+	assert.Equal(Struct, val.Type)
+
+	m := val.Val.(map[string]interface{})
+	assert.Equal(owner, m["owner"])
+	amounts := m["amounts"].([]interface{})
+	assert.True(types.NewAttoFILFromFIL(1).Equal(amounts[0].(*types.AttoFIL)))
+	assert.Equal(map[string]interface{}{"a": "b"}, m["labels"])
+	assert.Nil(m["limit"])
+
+	_, err = val.Serialize()
+	assert.NoError(err)
+
+	_, err = testSchema().ParseJSON(json.RawMessage(`{"owner": "` + owner.String() + `"}`))
+	assert.Error(err)
+}
@@ -99,6 +99,14 @@ func (a *MockActor) Six(ctx exec.VMContext) (uint8, error) {
 	return 0, fmt.Errorf("NOT A REVERT OR FAULT -- PROGRAMMER ERROR")
 }
 
+func (a *MockActor) Seven(ctx exec.VMContext, s map[string]interface{}, o interface{}) ([]interface{}, uint8, error) {
+	names := []interface{}{s["name"]}
+	if o != nil {
+		names = append(names, o)
+	}
+	return names, 0, nil
+}
+
 func NewMockActor(list exec.Exports) *MockActor {
 	return &MockActor{
 		exports: list,
@@ -187,6 +195,44 @@ func TestMakeTypedExportSuccess(t *testing.T) {
 			_, _, _ = exportedFunc(makeCtx("six"))
 		})
 	})
+
+	t.Run("with compound params and return", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		sig := exec.NewFunctionSignature(
+			[]*abi.Schema{
+				abi.StructOf(abi.Field{Name: "name", Schema: abi.Basic(abi.String)}, abi.Field{Name: "amount", Schema: abi.Basic(abi.AttoFIL)}),
+				abi.OptionalOf(abi.Basic(abi.String)),
+			},
+			[]*abi.Schema{abi.ArrayOf(abi.Basic(abi.String))},
+		)
+		a := NewMockActor(map[string]*exec.FunctionSignature{"seven": sig})
+		exportedFunc := MakeTypedExport(a, "seven")
+
+		call := func(o interface{}) []interface{} {
+			params, err := abi.EncodeSchemaValues(sig.ParamSchemas, []interface{}{
+				map[string]interface{}{"name": "alice", "amount": types.NewAttoFILFromFIL(1)},
+				o,
+			})
+			require.NoError(err)
+			ctx := vm.NewVMContext(vm.NewContextParams{
+				Message:     types.NewMessage(address.TestAddress, address.TestAddress2, 0, nil, "seven", params),
+				GasTracker:  vm.NewGasTracker(),
+				BlockHeight: types.NewBlockHeight(0),
+			})
+
+			ret, exitCode, err := exportedFunc(ctx)
+			require.NoError(err)
+			assert.Equal(uint8(0), exitCode)
+			vv, err := abi.DecodeSchemaValues(ret, sig.ReturnSchemas)
+			require.NoError(err)
+			return vv[0].Val.([]interface{})
+		}
+
+		assert.Equal([]interface{}{"alice", "bob"}, call("bob"))
+		assert.Equal([]interface{}{"alice"}, call(nil))
+	})
 }
 
 func TestMakeTypedExportFail(t *testing.T) {
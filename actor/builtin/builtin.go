@@ -5,6 +5,7 @@ import (
 	cid "github.com/ipfs/go-cid"
 
 	"github.com/filecoin-project/go-filecoin/actor/builtin/account"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/initactor"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
@@ -13,7 +14,8 @@ import (
 )
 
 // Actors is list of all actors that ship with Filecoin.
-// They are indexed by their CID.
+// They are indexed by their CID. Every version of the code of an actor is
+// listed, so that the state of any height of the chain can be read.
 var Actors = map[cid.Cid]exec.ExecutableActor{}
 
 func init() {
@@ -21,6 +23,8 @@ func init() {
 	Actors[types.AccountActorCodeCid] = &account.Actor{}
 	Actors[types.StorageMarketActorCodeCid] = &storagemarket.Actor{}
 	Actors[types.PaymentBrokerActorCodeCid] = &paymentbroker.Actor{}
+	Actors[types.PaymentBrokerV1ActorCodeCid] = &paymentbroker.Actor{Version: 1}
 	Actors[types.MinerActorCodeCid] = &miner.Actor{}
 	Actors[types.BootstrapMinerActorCodeCid] = &miner.Actor{Bootstrap: true}
+	Actors[types.InitActorCodeCid] = &initactor.Actor{}
 }
@@ -0,0 +1,318 @@
+// Package initactor implements the init actor, which assigns the IDs of
+// actors.
+package initactor
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/filecoin-project/go-leb128"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-hamt-ipld"
+	cbor "github.com/ipfs/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/abi"
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm/errors"
+)
+
+const (
+	// ErrUnknownAddress indicates an address with no ID assigned.
+	ErrUnknownAddress = 33
+	// ErrUnknownID indicates an ID assigned to no actor.
+	ErrUnknownID = 34
+)
+
+// Errors map error codes to revert errors this actor may return.
+var Errors = map[uint8]error{
+	ErrUnknownAddress: errors.NewCodedRevertErrorf(ErrUnknownAddress, "no ID assigned to address"),
+	ErrUnknownID:      errors.NewCodedRevertErrorf(ErrUnknownID, "ID assigned to no actor"),
+}
+
+func init() {
+	cbor.RegisterCborType(State{})
+	cbor.RegisterCborType(ProtocolUpgrade{})
+}
+
+// Actor is the init actor. It assigns sequential IDs to actors as they are
+// created and keeps the mapping between their addresses and IDs, so that ID
+// addresses, shorter than any other, can be used in place of actor
+// addresses.
+type Actor struct{}
+
+// State is the init actor's storage.
+type State struct {
+	// NextID is the ID assigned to the next actor registered.
+	NextID uint64
+	// IDs maps the addresses of actors to their ID addresses, Addresses maps
+	// the IDs back to the actor addresses.
+	IDs       cid.Cid `refmt:",omitempty"`
+	Addresses cid.Cid `refmt:",omitempty"`
+	// ProtocolUpgrades are the heights at which the network upgrades to
+	// later protocol versions. They are set in the genesis state and never
+	// change.
+	ProtocolUpgrades []ProtocolUpgrade `refmt:",omitempty"`
+}
+
+// ProtocolUpgrade is the height at which the network upgrades to a protocol
+// version.
+type ProtocolUpgrade struct {
+	Version uint64
+	Height  uint64
+}
+
+// NewActor returns a new init actor.
+func NewActor() *actor.Actor {
+	return actor.NewActor(types.InitActorCodeCid, types.NewZeroAttoFIL())
+}
+
+// InitializeState stores the actor's initial data structure.
+func (ia *Actor) InitializeState(storage exec.Storage, _ interface{}) error {
+	stateBytes, err := cbor.DumpObject(&State{})
+	if err != nil {
+		return err
+	}
+
+	id, err := storage.Put(stateBytes)
+	if err != nil {
+		return err
+	}
+
+	return storage.Commit(id, cid.Undef)
+}
+
+var _ exec.ExecutableActor = (*Actor)(nil)
+
+var initExports = exec.Exports{
+	"getActorAddress": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Address},
+		Return: []abi.Type{abi.Address},
+	},
+	"getActorIDAddress": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Address},
+		Return: []abi.Type{abi.Address},
+	},
+	"deploy": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Bytes},
+		Return: []abi.Type{abi.Address},
+	},
+}
+
+// Exports returns the actors exports.
+func (ia *Actor) Exports() exec.Exports {
+	return initExports
+}
+
+// GetActorIDAddress returns the ID address assigned to an actor address.
+func (ia *Actor) GetActorIDAddress(vmctx exec.VMContext, addr address.Address) (address.Address, uint8, error) {
+	if err := vmctx.Charge(vmctx.GasPrices().MethodCall); err != nil {
+		return address.Undef, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	idAddr, err := LookupID(context.Background(), vmctx.Storage(), addr)
+	if err != nil {
+		return address.Undef, errors.CodeError(err), err
+	}
+	return idAddr, 0, nil
+}
+
+// GetActorAddress returns the actor address an ID address is assigned to.
+func (ia *Actor) GetActorAddress(vmctx exec.VMContext, idAddr address.Address) (address.Address, uint8, error) {
+	if err := vmctx.Charge(vmctx.GasPrices().MethodCall); err != nil {
+		return address.Undef, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	addr, err := LookupAddress(context.Background(), vmctx.Storage(), idAddr)
+	if err != nil {
+		return address.Undef, errors.CodeError(err), err
+	}
+	return addr, 0, nil
+}
+
+// Deploy creates an actor running the given WebAssembly code and returns its
+// address.
+func (ia *Actor) Deploy(vmctx exec.VMContext, code []byte) (address.Address, uint8, error) {
+	if err := vmctx.Charge(vmctx.GasPrices().MethodCall); err != nil {
+		return address.Undef, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	addr, err := vmctx.AddressForNewActor()
+	if err != nil {
+		return address.Undef, 1, errors.FaultErrorWrap(err, "could not get address for new actor")
+	}
+	if _, err := vmctx.DeployActor(addr, code); err != nil {
+		return address.Undef, errors.CodeError(err), err
+	}
+	return addr, 0, nil
+}
+
+// RegisterAddress assigns the next ID to an actor address and returns its ID
+// address, or returns the ID address already assigned to it. It is called by
+// the VM, not by messages, when an actor is created; storage is the storage
+// of the init actor.
+func RegisterAddress(ctx context.Context, storage exec.Storage, addr address.Address) (address.Address, error) {
+	if addr.Protocol() == address.ID {
+		return address.Undef, errors.NewRevertErrorf("cannot assign an ID to ID address %s", addr)
+	}
+
+	var state State
+	if err := actor.LoadState(storage, &state); err != nil {
+		return address.Undef, errors.FaultErrorWrap(err, "could not load init actor state")
+	}
+
+	ids, err := actor.LoadLookup(ctx, storage, state.IDs)
+	if err != nil {
+		return address.Undef, errors.FaultErrorWrap(err, "could not load ID lookup")
+	}
+	found, err := ids.Find(ctx, addr.String())
+	if err == nil {
+		return decodeAddress(found)
+	}
+	if err != hamt.ErrNotFound {
+		return address.Undef, errors.FaultErrorWrapf(err, "could not look up ID of %s", addr)
+	}
+
+	idAddr, err := address.NewIDAddress(state.NextID)
+	if err != nil {
+		return address.Undef, errors.FaultErrorWrap(err, "could not create ID address")
+	}
+	if err := ids.Set(ctx, addr.String(), idAddr.String()); err != nil {
+		return address.Undef, errors.FaultErrorWrap(err, "could not set ID")
+	}
+	if state.IDs, err = ids.Commit(ctx); err != nil {
+		return address.Undef, errors.FaultErrorWrap(err, "could not commit ID lookup")
+	}
+	state.Addresses, err = actor.SetKeyValue(ctx, storage, state.Addresses, idKey(state.NextID), addr.String())
+	if err != nil {
+		return address.Undef, errors.FaultErrorWrap(err, "could not set address of ID")
+	}
+	state.NextID++
+
+	stateCid, err := storage.Put(&state)
+	if err != nil {
+		return address.Undef, errors.FaultErrorWrap(err, "could not store init actor state")
+	}
+	if err := storage.Commit(stateCid, storage.Head()); err != nil {
+		return address.Undef, errors.FaultErrorWrap(err, "could not commit init actor state")
+	}
+	return idAddr, nil
+}
+
+// SetProtocolUpgrades records the protocol upgrades of the network. It is
+// called when creating the genesis state; storage is the storage of the init
+// actor.
+func SetProtocolUpgrades(storage exec.Storage, upgrades []ProtocolUpgrade) error {
+	var state State
+	if err := actor.LoadState(storage, &state); err != nil {
+		return errors.FaultErrorWrap(err, "could not load init actor state")
+	}
+	state.ProtocolUpgrades = upgrades
+
+	stateCid, err := storage.Put(&state)
+	if err != nil {
+		return errors.FaultErrorWrap(err, "could not store init actor state")
+	}
+	if err := storage.Commit(stateCid, storage.Head()); err != nil {
+		return errors.FaultErrorWrap(err, "could not commit init actor state")
+	}
+	return nil
+}
+
+// LoadProtocolUpgrades returns the protocol upgrades of the network.
+func LoadProtocolUpgrades(storage exec.Storage) ([]ProtocolUpgrade, error) {
+	var state State
+	if err := actor.LoadState(storage, &state); err != nil {
+		return nil, errors.FaultErrorWrap(err, "could not load init actor state")
+	}
+	return state.ProtocolUpgrades, nil
+}
+
+// LookupID returns the ID address assigned to an actor address. ID
+// addresses are returned as they are.
+func LookupID(ctx context.Context, storage exec.Storage, addr address.Address) (address.Address, error) {
+	if addr.Protocol() == address.ID {
+		return addr, nil
+	}
+
+	var state State
+	if err := actor.LoadState(storage, &state); err != nil {
+		return address.Undef, errors.FaultErrorWrap(err, "could not load init actor state")
+	}
+	if !state.IDs.Defined() {
+		return address.Undef, Errors[ErrUnknownAddress]
+	}
+
+	var found interface{}
+	err := actor.WithLookupForReading(ctx, storage, state.IDs, func(ids exec.Lookup) error {
+		var err error
+		found, err = ids.Find(ctx, addr.String())
+		return err
+	})
+	if err == hamt.ErrNotFound {
+		return address.Undef, Errors[ErrUnknownAddress]
+	} else if err != nil {
+		return address.Undef, errors.FaultErrorWrapf(err, "could not look up ID of %s", addr)
+	}
+	return decodeAddress(found)
+}
+
+// LookupAddress returns the actor address an ID address is assigned to.
+// Other addresses are returned as they are.
+func LookupAddress(ctx context.Context, storage exec.Storage, idAddr address.Address) (address.Address, error) {
+	if idAddr.Protocol() != address.ID {
+		return idAddr, nil
+	}
+	id, err := IDFromAddress(idAddr)
+	if err != nil {
+		return address.Undef, err
+	}
+
+	var state State
+	if err := actor.LoadState(storage, &state); err != nil {
+		return address.Undef, errors.FaultErrorWrap(err, "could not load init actor state")
+	}
+	if !state.Addresses.Defined() {
+		return address.Undef, Errors[ErrUnknownID]
+	}
+
+	var found interface{}
+	err = actor.WithLookupForReading(ctx, storage, state.Addresses, func(addrs exec.Lookup) error {
+		var err error
+		found, err = addrs.Find(ctx, idKey(id))
+		return err
+	})
+	if err == hamt.ErrNotFound {
+		return address.Undef, Errors[ErrUnknownID]
+	} else if err != nil {
+		return address.Undef, errors.FaultErrorWrapf(err, "could not look up address of %s", idAddr)
+	}
+	return decodeAddress(found)
+}
+
+// IDFromAddress returns the ID of an ID address.
+func IDFromAddress(idAddr address.Address) (uint64, error) {
+	if idAddr.Protocol() != address.ID {
+		return 0, errors.NewRevertErrorf("%s is not an ID address", idAddr)
+	}
+	return leb128.ToUInt64(idAddr.Payload()), nil
+}
+
+func idKey(id uint64) string {
+	return strconv.FormatUint(id, 10)
+}
+
+// decodeAddress decodes an address stored as a string in a lookup.
+func decodeAddress(v interface{}) (address.Address, error) {
+	s, ok := v.(string)
+	if !ok {
+		return address.Undef, errors.NewFaultErrorf("expected an address string in lookup, got %T", v)
+	}
+	addr, err := address.NewFromString(s)
+	if err != nil {
+		return address.Undef, errors.FaultErrorWrap(err, "invalid address in lookup")
+	}
+	return addr, nil
+}
@@ -0,0 +1,141 @@
+package initactor_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-hamt-ipld"
+	"github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-ipfs-exchange-offline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	. "github.com/filecoin-project/go-filecoin/actor/builtin/initactor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+)
+
+func TestRegisterAddress(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx := context.Background()
+	newAddress := address.NewForTestGetter()
+	bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+	initActor := NewActor()
+	storage := vm.NewStorage(bs, initActor)
+	require.NoError((&Actor{}).InitializeState(storage, nil))
+
+	addr1, addr2 := newAddress(), newAddress()
+	id1, err := RegisterAddress(ctx, storage, addr1)
+	require.NoError(err)
+	id2, err := RegisterAddress(ctx, storage, addr2)
+	require.NoError(err)
+	assert.Equal(address.ID, id1.Protocol())
+	assert.NotEqual(id1, id2)
+
+	// registering an address again returns the ID it was assigned
+	again, err := RegisterAddress(ctx, storage, addr1)
+	require.NoError(err)
+	assert.Equal(id1, again)
+
+	// IDs are assigned in order
+	id, err := IDFromAddress(id1)
+	require.NoError(err)
+	assert.Equal(uint64(0), id)
+	id, err = IDFromAddress(id2)
+	require.NoError(err)
+	assert.Equal(uint64(1), id)
+
+	found, err := LookupID(ctx, storage, addr2)
+	require.NoError(err)
+	assert.Equal(id2, found)
+	found, err = LookupAddress(ctx, storage, id2)
+	require.NoError(err)
+	assert.Equal(addr2, found)
+
+	_, err = LookupID(ctx, storage, newAddress())
+	assert.Equal(Errors[ErrUnknownAddress], err)
+	unassigned, err := address.NewIDAddress(2)
+	require.NoError(err)
+	_, err = LookupAddress(ctx, storage, unassigned)
+	assert.Equal(Errors[ErrUnknownID], err)
+
+	_, err = RegisterAddress(ctx, storage, id1)
+	assert.Error(err)
+}
+
+func TestProtocolUpgrades(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+	storage := vm.NewStorage(bs, NewActor())
+	require.NoError((&Actor{}).InitializeState(storage, nil))
+
+	upgrades, err := LoadProtocolUpgrades(storage)
+	require.NoError(err)
+	assert.Empty(upgrades)
+
+	set := []ProtocolUpgrade{{Version: 1, Height: 100}}
+	require.NoError(SetProtocolUpgrades(storage, set))
+	upgrades, err = LoadProtocolUpgrades(storage)
+	require.NoError(err)
+	assert.Equal(set, upgrades)
+}
+
+func TestGenesisActorIDs(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx := context.Background()
+	bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+	cst := &hamt.CborIpldStore{Blocks: blockservice.New(bs, offline.Exchange(bs))}
+	vms := vm.NewStorageMap(bs)
+
+	addr := address.NewForTestGetter()()
+	genesis, err := consensus.MakeGenesisFunc(consensus.ActorAccount(addr, types.NewAttoFILFromFIL(100)))(cst, bs)
+	require.NoError(err)
+	st, err := state.LoadStateTree(ctx, cst, genesis.StateRoot, builtin.Actors)
+	require.NoError(err)
+
+	ret, code, err := consensus.CallQueryMethod(ctx, st, vms, nil, address.InitAddress, "getActorIDAddress", actor.MustConvertParams(addr), address.Undef, nil)
+	require.NoError(err)
+	require.Equal(uint8(0), code)
+	idAddr, err := address.NewFromBytes(ret[0])
+	require.NoError(err)
+	assert.Equal(address.ID, idAddr.Protocol())
+
+	ret, code, err = consensus.CallQueryMethod(ctx, st, vms, nil, address.InitAddress, "getActorAddress", actor.MustConvertParams(idAddr), address.Undef, nil)
+	require.NoError(err)
+	require.Equal(uint8(0), code)
+	actorAddr, err := address.NewFromBytes(ret[0])
+	require.NoError(err)
+	assert.Equal(addr, actorAddr)
+
+	t.Run("state tree resolves ID addresses", func(t *testing.T) {
+		act, err := st.GetActor(ctx, idAddr)
+		require.NoError(err)
+		assert.Equal(types.NewAttoFILFromFIL(100), act.Balance)
+
+		unassigned, err := address.NewIDAddress(1000)
+		require.NoError(err)
+		_, err = st.GetActor(ctx, unassigned)
+		assert.True(state.IsActorNotFoundError(err))
+	})
+
+	t.Run("unknown ID fails", func(t *testing.T) {
+		unassigned, err := address.NewIDAddress(1000)
+		require.NoError(err)
+		_, code, err := consensus.CallQueryMethod(ctx, st, vms, nil, address.InitAddress, "getActorAddress", actor.MustConvertParams(unassigned), address.Undef, nil)
+		assert.Error(err)
+		assert.Equal(uint8(ErrUnknownID), code)
+	})
+}
@@ -1,13 +1,17 @@
 package miner
 
 import (
+	"context"
+	"fmt"
 	"math/big"
 	"os"
+	"sort"
 	"strconv"
 
 	"github.com/ipfs/go-cid"
 	cbor "github.com/ipfs/go-ipld-cbor"
 	"github.com/libp2p/go-libp2p-peer"
+	multiaddr "github.com/multiformats/go-multiaddr"
 	xerrors "github.com/pkg/errors"
 
 	"github.com/filecoin-project/go-filecoin/abi"
@@ -23,11 +27,32 @@ import (
 func init() {
 	cbor.RegisterCborType(State{})
 	cbor.RegisterCborType(Ask{})
+	cbor.RegisterCborType(SectorCommittedEvent{})
+}
+
+// Topics of the events emitted by the miner actor.
+const (
+	// EventAskAdded is emitted with the new ask when an ask is added.
+	EventAskAdded = "askAdded"
+	// EventSectorCommitted is emitted when a sector is committed.
+	EventSectorCommitted = "sectorCommitted"
+	// EventPoStSubmitted is emitted with the start of the next proving period
+	// when a PoSt is accepted.
+	EventPoStSubmitted = "postSubmitted"
+)
+
+// SectorCommittedEvent is the data of the event of a committed sector.
+type SectorCommittedEvent struct {
+	SectorID    uint64            `json:"sectorId"`
+	Commitments types.Commitments `json:"commitments"`
 }
 
 // MaximumPublicKeySize is a limit on how big a public key can be.
 const MaximumPublicKeySize = 100
 
+// MaximumMultiaddrs is a limit on how many multiaddrs a miner can announce.
+const MaximumMultiaddrs = 16
+
 // ProvingPeriodBlocks defines how long a proving period is for.
 // TODO: what is an actual workable value? currently set very high to avoid race conditions in test.
 // https://github.com/filecoin-project/go-filecoin/issues/966
@@ -58,6 +83,8 @@ const (
 	ErrAskNotFound = 40
 	// ErrInvalidSealProof signals that the passed in seal proof was invalid.
 	ErrInvalidSealProof = 41
+	// ErrTooManyMultiaddrs indicates too many multiaddrs were announced.
+	ErrTooManyMultiaddrs = 42
 )
 
 // Errors map error codes to revert errors this actor may return.
@@ -71,6 +98,7 @@ var Errors = map[uint8]error{
 	ErrInvalidPoSt:             errors.NewCodedRevertErrorf(ErrInvalidPoSt, "PoSt proof did not validate"),
 	ErrAskNotFound:             errors.NewCodedRevertErrorf(ErrAskNotFound, "no ask was found"),
 	ErrInvalidSealProof:        errors.NewCodedRevertErrorf(ErrInvalidSealProof, "seal proof was invalid"),
+	ErrTooManyMultiaddrs:       errors.NewCodedRevertErrorf(ErrTooManyMultiaddrs, "miner can announce at most %d multiaddrs", MaximumMultiaddrs),
 }
 
 // Actor is the miner actor.
@@ -101,6 +129,10 @@ type State struct {
 	// PeerID references the libp2p identity that the miner is operating.
 	PeerID peer.ID
 
+	// Multiaddrs are the binary multiaddrs the miner announces it can be
+	// dialed at, so that clients don't depend on the DHT to find it.
+	Multiaddrs [][]byte
+
 	// PublicKey is used to validate blocks generated by the miner this actor represents.
 	PublicKey []byte
 
@@ -214,6 +246,14 @@ var minerExports = exec.Exports{
 		Params: []abi.Type{abi.PeerID},
 		Return: []abi.Type{},
 	},
+	"getMultiaddrs": &exec.FunctionSignature{
+		Params: []abi.Type{},
+		Return: []abi.Type{abi.Multiaddrs},
+	},
+	"updateMultiaddrs": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Multiaddrs},
+		Return: []abi.Type{},
+	},
 	"getPledge": &exec.FunctionSignature{
 		Params: []abi.Type{},
 		Return: []abi.Type{abi.Integer},
@@ -245,10 +285,90 @@ func (ma *Actor) Exports() exec.Exports {
 	return minerExports
 }
 
+var _ exec.StateDiffer = (*Actor)(nil)
+
+// DiffState returns the changes of the fields, asks and sector commitments of
+// a miner's state.
+func (ma *Actor) DiffState(ctx context.Context, before, after exec.Storage) ([]exec.StateChange, error) {
+	var prev, next State
+	if err := actor.LoadState(before, &prev); err != nil {
+		return nil, errors.FaultErrorWrap(err, "could not load previous miner state")
+	}
+	if err := actor.LoadState(after, &next); err != nil {
+		return nil, errors.FaultErrorWrap(err, "could not load miner state")
+	}
+
+	var changes []exec.StateChange
+	changes = actor.AppendStateChange(changes, "owner", prev.Owner, next.Owner)
+	changes = actor.AppendStateChange(changes, "peerID", prev.PeerID, next.PeerID)
+	changes = actor.AppendStateChange(changes, "multiaddrs", multiaddrsString(prev.Multiaddrs), multiaddrsString(next.Multiaddrs))
+	changes = actor.AppendStateChange(changes, "pledgeSectors", prev.PledgeSectors, next.PledgeSectors)
+	changes = actor.AppendStateChange(changes, "collateral", prev.Collateral, next.Collateral)
+	changes = actor.AppendStateChange(changes, "lastUsedSectorID", prev.LastUsedSectorID, next.LastUsedSectorID)
+	changes = actor.AppendStateChange(changes, "provingPeriodStart", prev.ProvingPeriodStart, next.ProvingPeriodStart)
+	changes = actor.AppendStateChange(changes, "lastPoSt", prev.LastPoSt, next.LastPoSt)
+	changes = actor.AppendStateChange(changes, "power", prev.Power, next.Power)
+
+	prevAsks := make(map[string]*Ask)
+	for _, ask := range prev.Asks {
+		prevAsks[ask.ID.String()] = ask
+	}
+	for _, ask := range next.Asks {
+		id := ask.ID.String()
+		if prevAsk, ok := prevAsks[id]; ok {
+			changes = actor.AppendStateChange(changes, "asks/"+id, askString(prevAsk), askString(ask))
+			delete(prevAsks, id)
+		} else {
+			changes = actor.AppendStateChange(changes, "asks/"+id, nil, askString(ask))
+		}
+	}
+	for id, ask := range prevAsks {
+		changes = actor.AppendStateChange(changes, "asks/"+id, askString(ask), nil)
+	}
+
+	for id, comms := range next.SectorCommitments {
+		if prevComms, ok := prev.SectorCommitments[id]; ok {
+			changes = actor.AppendStateChange(changes, "sectorCommitments/"+id, commitmentsString(prevComms), commitmentsString(comms))
+		} else {
+			changes = actor.AppendStateChange(changes, "sectorCommitments/"+id, nil, commitmentsString(comms))
+		}
+	}
+	for id, comms := range prev.SectorCommitments {
+		if _, ok := next.SectorCommitments[id]; !ok {
+			changes = actor.AppendStateChange(changes, "sectorCommitments/"+id, commitmentsString(comms), nil)
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes, nil
+}
+
+func askString(ask *Ask) string {
+	return fmt.Sprintf("price=%s expiry=%s", ask.Price, ask.Expiry)
+}
+
+func multiaddrsString(addrs [][]byte) string {
+	var strs []string
+	for _, b := range addrs {
+		if addr, err := multiaddr.NewMultiaddrBytes(b); err == nil {
+			strs = append(strs, addr.String())
+		} else {
+			strs = append(strs, fmt.Sprintf("%x", b))
+		}
+	}
+	return fmt.Sprint(strs)
+}
+
+func commitmentsString(comms types.Commitments) string {
+	return fmt.Sprintf("commD=%x commR=%x commRStar=%x", comms.CommD, comms.CommR, comms.CommRStar)
+}
+
 // AddAsk adds an ask to this miners ask list
 func (ma *Actor) AddAsk(ctx exec.VMContext, price *types.AttoFIL, expiry *big.Int) (*big.Int, uint8,
 	error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := ctx.Charge(ctx.GasPrices().MethodCall); err != nil {
 		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -275,30 +395,35 @@ func (ma *Actor) AddAsk(ctx exec.VMContext, price *types.AttoFIL, expiry *big.In
 		}
 		expiryBH := types.NewBlockHeight(expiry.Uint64())
 
-		state.Asks = append(state.Asks, &Ask{
+		ask := &Ask{
 			Price:  price,
 			Expiry: ctx.BlockHeight().Add(expiryBH),
 			ID:     id,
-		})
+		}
+		state.Asks = append(state.Asks, ask)
 
-		return id, nil
+		return ask, nil
 	})
 	if err != nil {
 		return nil, errors.CodeError(err), err
 	}
 
-	askID, ok := out.(*big.Int)
+	ask, ok := out.(*Ask)
 	if !ok {
-		return nil, 1, errors.NewRevertErrorf("expected an Integer return value from call, but got %T instead", out)
+		return nil, 1, errors.NewRevertErrorf("expected an Ask return value from call, but got %T instead", out)
+	}
+
+	if err := ctx.Emit(EventAskAdded, ask); err != nil {
+		return nil, errors.CodeError(err), err
 	}
 
-	return askID, 0, nil
+	return ask.ID, 0, nil
 }
 
 // GetAsks returns all the asks for this miner. (TODO: this isnt a great function signature, it returns the asks in a
 // serialized array. Consider doing this some other way)
 func (ma *Actor) GetAsks(ctx exec.VMContext) ([]uint64, uint8, error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := ctx.Charge(ctx.GasPrices().MethodCall); err != nil {
 		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 	var state State
@@ -327,7 +452,7 @@ func (ma *Actor) GetAsks(ctx exec.VMContext) ([]uint64, uint8, error) {
 
 // GetAsk returns an ask by ID
 func (ma *Actor) GetAsk(ctx exec.VMContext, askid *big.Int) ([]byte, uint8, error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := ctx.Charge(ctx.GasPrices().MethodCall); err != nil {
 		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -366,7 +491,7 @@ func (ma *Actor) GetAsk(ctx exec.VMContext, askid *big.Int) ([]byte, uint8, erro
 
 // GetOwner returns the miners owner.
 func (ma *Actor) GetOwner(ctx exec.VMContext) (address.Address, uint8, error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := ctx.Charge(ctx.GasPrices().MethodCall); err != nil {
 		return address.Undef, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -388,7 +513,7 @@ func (ma *Actor) GetOwner(ctx exec.VMContext) (address.Address, uint8, error) {
 
 // GetLastUsedSectorID returns the last used sector id.
 func (ma *Actor) GetLastUsedSectorID(ctx exec.VMContext) (uint64, uint8, error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := ctx.Charge(ctx.GasPrices().MethodCall); err != nil {
 		return 0, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 	var state State
@@ -415,7 +540,7 @@ func (ma *Actor) IsBootstrapMiner(ctx exec.VMContext) (bool, uint8, error) {
 
 // GetSectorCommitments returns all sector commitments posted by this miner.
 func (ma *Actor) GetSectorCommitments(ctx exec.VMContext) (map[string]types.Commitments, uint8, error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := ctx.Charge(ctx.GasPrices().MethodCall); err != nil {
 		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -438,7 +563,7 @@ func (ma *Actor) GetSectorCommitments(ctx exec.VMContext) (map[string]types.Comm
 // CommitSector adds a commitment to the specified sector. The sector must not
 // already be committed.
 func (ma *Actor) CommitSector(ctx exec.VMContext, sectorID uint64, commD, commR, commRStar, proof []byte) (uint8, error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := ctx.Charge(ctx.GasPrices().MethodCall); err != nil {
 		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 	if len(commD) != int(proofs.CommitmentBytesLen) {
@@ -468,6 +593,10 @@ func (ma *Actor) CommitSector(ctx exec.VMContext, sectorID uint64, commD, commR,
 			sectorStoreType = proofs.Test
 		}
 
+		if err := ctx.Charge(ctx.GasPrices().VerifySeal); err != nil {
+			return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+		}
+
 		req := proofs.VerifySealRequest{}
 		copy(req.CommD[:], commD)
 		copy(req.CommR[:], commR)
@@ -491,7 +620,7 @@ func (ma *Actor) CommitSector(ctx exec.VMContext, sectorID uint64, commD, commR,
 	sectorIDstr := strconv.FormatUint(sectorID, 10)
 
 	var state State
-	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+	out, err := actor.WithState(ctx, &state, func() (interface{}, error) {
 		// verify that the caller is authorized to perform update
 		if ctx.Message().From != state.Owner {
 			return nil, Errors[ErrCallerUnauthorized]
@@ -524,18 +653,27 @@ func (ma *Actor) CommitSector(ctx exec.VMContext, sectorID uint64, commD, commR,
 		if ret != 0 {
 			return nil, Errors[ErrStoragemarketCallFailed]
 		}
-		return nil, nil
+		return comms, nil
 	})
 	if err != nil {
 		return errors.CodeError(err), err
 	}
 
+	comms, ok := out.(types.Commitments)
+	if !ok {
+		return 1, errors.NewRevertErrorf("expected Commitments return value from call, but got %T instead", out)
+	}
+
+	if err := ctx.Emit(EventSectorCommitted, &SectorCommittedEvent{SectorID: sectorID, Commitments: comms}); err != nil {
+		return errors.CodeError(err), err
+	}
+
 	return 0, nil
 }
 
 // GetKey returns the public key for this miner.
 func (ma *Actor) GetKey(ctx exec.VMContext) ([]byte, uint8, error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := ctx.Charge(ctx.GasPrices().MethodCall); err != nil {
 		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -557,7 +695,7 @@ func (ma *Actor) GetKey(ctx exec.VMContext) ([]byte, uint8, error) {
 
 // GetPeerID returns the libp2p peer ID that this miner can be reached at.
 func (ma *Actor) GetPeerID(ctx exec.VMContext) (peer.ID, uint8, error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := ctx.Charge(ctx.GasPrices().MethodCall); err != nil {
 		return peer.ID(""), exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -577,7 +715,7 @@ func (ma *Actor) GetPeerID(ctx exec.VMContext) (peer.ID, uint8, error) {
 
 // UpdatePeerID is used to update the peerID this miner is operating under.
 func (ma *Actor) UpdatePeerID(ctx exec.VMContext, pid peer.ID) (uint8, error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := ctx.Charge(ctx.GasPrices().MethodCall); err != nil {
 		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -599,9 +737,71 @@ func (ma *Actor) UpdatePeerID(ctx exec.VMContext, pid peer.ID) (uint8, error) {
 	return 0, nil
 }
 
+// GetMultiaddrs returns the multiaddrs this miner announces it can be dialed at.
+func (ma *Actor) GetMultiaddrs(ctx exec.VMContext) ([]multiaddr.Multiaddr, uint8, error) {
+	if err := ctx.Charge(ctx.GasPrices().MethodCall); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+
+	chunk, err := ctx.ReadStorage()
+	if err != nil {
+		return nil, errors.CodeError(err), err
+	}
+
+	if err := actor.UnmarshalStorage(chunk, &state); err != nil {
+		return nil, errors.CodeError(err), err
+	}
+
+	addrs := []multiaddr.Multiaddr{}
+	for _, b := range state.Multiaddrs {
+		addr, err := multiaddr.NewMultiaddrBytes(b)
+		if err != nil {
+			err = errors.FaultErrorWrap(err, "stored multiaddr is invalid")
+			return nil, errors.CodeError(err), err
+		}
+		addrs = append(addrs, addr)
+	}
+
+	return addrs, 0, nil
+}
+
+// UpdateMultiaddrs replaces the multiaddrs this miner announces it can be
+// dialed at.
+func (ma *Actor) UpdateMultiaddrs(ctx exec.VMContext, addrs []multiaddr.Multiaddr) (uint8, error) {
+	if err := ctx.Charge(ctx.GasPrices().MethodCall); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	if len(addrs) > MaximumMultiaddrs {
+		return ErrTooManyMultiaddrs, Errors[ErrTooManyMultiaddrs]
+	}
+
+	var storage State
+	_, err := actor.WithState(ctx, &storage, func() (interface{}, error) {
+		// verify that the caller is authorized to perform update
+		if ctx.Message().From != storage.Owner {
+			return nil, Errors[ErrCallerUnauthorized]
+		}
+
+		storage.Multiaddrs = make([][]byte, len(addrs))
+		for i, addr := range addrs {
+			storage.Multiaddrs[i] = addr.Bytes()
+		}
+
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
 // GetPledge returns the number of pledged sectors
 func (ma *Actor) GetPledge(ctx exec.VMContext) (*big.Int, uint8, error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := ctx.Charge(ctx.GasPrices().MethodCall); err != nil {
 		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -623,7 +823,7 @@ func (ma *Actor) GetPledge(ctx exec.VMContext) (*big.Int, uint8, error) {
 
 // GetPower returns the amount of proven sectors for this miner.
 func (ma *Actor) GetPower(ctx exec.VMContext) (*big.Int, uint8, error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := ctx.Charge(ctx.GasPrices().MethodCall); err != nil {
 		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -646,7 +846,7 @@ func (ma *Actor) GetPower(ctx exec.VMContext) (*big.Int, uint8, error) {
 // SubmitPoSt is used to submit a coalesced PoST to the chain to convince the chain
 // that you have been actually storing the files you claim to be.
 func (ma *Actor) SubmitPoSt(ctx exec.VMContext, postProofs []proofs.PoStProof) (uint8, error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := ctx.Charge(ctx.GasPrices().MethodCall); err != nil {
 		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -680,6 +880,10 @@ func (ma *Actor) SubmitPoSt(ctx exec.VMContext, postProofs []proofs.PoStProof) (
 				sectorStoreType = proofs.Test
 			}
 
+			if err := ctx.Charge(ctx.GasPrices().VerifyPoSt); err != nil {
+				return nil, errors.RevertErrorWrap(err, "Insufficient gas")
+			}
+
 			seed, err := currentProvingPeriodPoStChallengeSeed(ctx, state)
 			if err != nil {
 				return nil, errors.RevertErrorWrap(err, "failed to sample chain for challenge seed")
@@ -717,12 +921,16 @@ func (ma *Actor) SubmitPoSt(ctx exec.VMContext, postProofs []proofs.PoStProof) (
 		return errors.CodeError(err), err
 	}
 
+	if err := ctx.Emit(EventPoStSubmitted, state.ProvingPeriodStart); err != nil {
+		return errors.CodeError(err), err
+	}
+
 	return 0, nil
 }
 
 // GetProvingPeriodStart returns the current ProvingPeriodStart value.
 func (ma *Actor) GetProvingPeriodStart(ctx exec.VMContext) (*types.BlockHeight, uint8, error) {
-	if err := ctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := ctx.Charge(ctx.GasPrices().MethodCall); err != nil {
 		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
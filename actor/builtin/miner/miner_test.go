@@ -6,13 +6,16 @@ import (
 	"testing"
 
 	peer "github.com/libp2p/go-libp2p-peer"
+	multiaddr "github.com/multiformats/go-multiaddr"
 
+	"github.com/filecoin-project/go-filecoin/abi"
 	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/actor/builtin"
 	. "github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/core"
+	"github.com/filecoin-project/go-filecoin/exec"
 	"github.com/filecoin-project/go-filecoin/proofs"
 	"github.com/filecoin-project/go-filecoin/state"
 	th "github.com/filecoin-project/go-filecoin/testhelpers"
@@ -64,12 +67,20 @@ func TestAskFunctions(t *testing.T) {
 	pdata := actor.MustConvertParams(types.NewAttoFILFromFIL(5), big.NewInt(1500))
 	msg := types.NewMessage(address.TestAddress, minerAddr, 1, nil, "addAsk", pdata)
 
-	_, err := th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(1))
+	result, err := th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(1))
 	assert.NoError(err)
 
+	// the new ask is emitted
+	require.Len(result.Receipt.Events, 1)
+	assert.Equal(minerAddr, result.Receipt.Events[0].Emitter)
+	assert.Equal(EventAskAdded, result.Receipt.Events[0].Topic)
+	var emitted Ask
+	require.NoError(actor.UnmarshalStorage(result.Receipt.Events[0].Data, &emitted))
+	assert.Equal(types.NewBlockHeight(1501), emitted.Expiry)
+
 	pdata = actor.MustConvertParams(big.NewInt(0))
 	msg = types.NewMessage(address.TestAddress, minerAddr, 2, types.NewZeroAttoFIL(), "getAsk", pdata)
-	result, err := th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(2))
+	result, err = th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(2))
 	assert.NoError(err)
 
 	var ask Ask
@@ -208,6 +219,65 @@ func TestPeerIdGetterAndSetter(t *testing.T) {
 	})
 }
 
+func TestMultiaddrsGetterAndSetter(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	t.Run("successfully retrieves and updates multiaddrs", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		st, vms := core.CreateStorages(ctx, t)
+
+		minerAddr := createTestMiner(assert.New(t), st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID(require))
+
+		// a new miner announces no multiaddrs
+		result := callQueryMethodSuccess("getMultiaddrs", ctx, t, st, vms, address.TestAddress, minerAddr)
+		addrs, err := abi.Deserialize(result[0], abi.Multiaddrs)
+		require.NoError(err)
+		require.Empty(addrs.Val)
+
+		newAddrs := []multiaddr.Multiaddr{
+			multiaddr.StringCast("/ip4/1.2.3.4/tcp/6000"),
+			multiaddr.StringCast("/ip4/5.6.7.8/tcp/6000/ipfs/QmcgpsyWgH8Y8ajJz1Cu72KnS5uo2Aa2LpzU7kinSupNKC/p2p-circuit"),
+		}
+		msg := types.NewMessage(address.TestAddress, minerAddr, core.MustGetNonce(st, address.TestAddress), types.NewAttoFILFromFIL(0), "updateMultiaddrs", actor.MustConvertParams(newAddrs))
+		applyMsgResult, err := th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(0))
+		require.NoError(err)
+		require.NoError(applyMsgResult.ExecutionError)
+
+		result = callQueryMethodSuccess("getMultiaddrs", ctx, t, st, vms, address.TestAddress, minerAddr)
+		addrs, err = abi.Deserialize(result[0], abi.Multiaddrs)
+		require.NoError(err)
+		require.Equal(newAddrs, addrs.Val)
+	})
+
+	t.Run("fails to update multiaddrs", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		st, vms := core.CreateStorages(ctx, t)
+
+		minerAddr := createTestMiner(assert.New(t), st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID(require))
+		addr := multiaddr.StringCast("/ip4/1.2.3.4/tcp/6000")
+
+		// TestAddress2 doesn't own the miner
+		msg := types.NewMessage(address.TestAddress2, minerAddr, core.MustGetNonce(st, address.TestAddress2), types.NewAttoFILFromFIL(0), "updateMultiaddrs", actor.MustConvertParams([]multiaddr.Multiaddr{addr}))
+		applyMsgResult, err := th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(0))
+		require.NoError(err)
+		require.Equal(Errors[ErrCallerUnauthorized], applyMsgResult.ExecutionError)
+
+		tooMany := make([]multiaddr.Multiaddr, MaximumMultiaddrs+1)
+		for i := range tooMany {
+			tooMany[i] = addr
+		}
+		msg = types.NewMessage(address.TestAddress, minerAddr, core.MustGetNonce(st, address.TestAddress), types.NewAttoFILFromFIL(0), "updateMultiaddrs", actor.MustConvertParams(tooMany))
+		applyMsgResult, err = th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(0))
+		require.NoError(err)
+		require.Equal(Errors[ErrTooManyMultiaddrs], applyMsgResult.ExecutionError)
+	})
+}
+
 func TestMinerGetPledge(t *testing.T) {
 	t.Parallel()
 	require := require.New(t)
@@ -270,7 +340,7 @@ func callQueryMethodSuccess(method string,
 	vms vm.StorageMap,
 	fromAddr address.Address,
 	minerAddr address.Address) [][]byte {
-	res, code, err := consensus.CallQueryMethod(ctx, st, vms, minerAddr, method, []byte{}, fromAddr, nil)
+	res, code, err := consensus.CallQueryMethod(ctx, st, vms, nil, minerAddr, method, []byte{}, fromAddr, nil)
 	require.NoError(t, err)
 	require.Equal(t, uint8(0), code)
 	return res
@@ -348,3 +418,44 @@ func TestMinerSubmitPoSt(t *testing.T) {
 	require.NoError(err)
 	require.EqualError(res.ExecutionError, "submitted PoSt late, need to pay a fee")
 }
+
+func TestMinerDiffState(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx := context.Background()
+	vms := th.VMStorage()
+	addrGetter := address.NewForTestGetter()
+	owner := addrGetter()
+	minerActor := &Actor{}
+
+	newStorage := func(st *State) exec.Storage {
+		storage := vms.NewStorage(addrGetter(), NewActor())
+		require.NoError(minerActor.InitializeState(storage, st))
+		return storage
+	}
+
+	prev := NewState(owner, []byte{}, big.NewInt(10), th.RequireRandomPeerID(require), types.NewAttoFILFromFIL(1))
+	prev.Asks = []*Ask{{Price: types.NewAttoFILFromFIL(2), Expiry: types.NewBlockHeight(10), ID: big.NewInt(0)}}
+	next := NewState(owner, []byte{}, big.NewInt(10), prev.PeerID, types.NewAttoFILFromFIL(5))
+	next.Asks = []*Ask{{Price: types.NewAttoFILFromFIL(3), Expiry: types.NewBlockHeight(20), ID: big.NewInt(1)}}
+	next.SectorCommitments["1"] = types.Commitments{}
+
+	changes, err := minerActor.DiffState(ctx, newStorage(prev), newStorage(next))
+	require.NoError(err)
+	require.Len(changes, 4)
+	assert.Equal("asks/0", changes[0].Field)
+	assert.Empty(changes[0].After)
+	assert.Equal("asks/1", changes[1].Field)
+	assert.Empty(changes[1].Before)
+	assert.Equal(exec.StateChange{Field: "collateral", Before: "1", After: "5"}, changes[2])
+	assert.Equal("sectorCommitments/1", changes[3].Field)
+	assert.Empty(changes[3].Before)
+
+	t.Run("from no state", func(t *testing.T) {
+		changes, err := minerActor.DiffState(ctx, vms.NewStorage(addrGetter(), NewActor()), newStorage(next))
+		require.NoError(err)
+		assert.NotEmpty(changes)
+	})
+}
@@ -2,6 +2,8 @@ package paymentbroker
 
 import (
 	"context"
+	"fmt"
+	"sort"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-hamt-ipld"
@@ -55,8 +57,22 @@ var Errors = map[uint8]error{
 	ErrInvalidSignature:         errors.NewCodedRevertErrorf(ErrInvalidSignature, "signature failed to validate"),
 }
 
+// Topics of the events emitted by the payment broker.
+const (
+	// EventChannelCreated is emitted when a payment channel is created.
+	EventChannelCreated = "channelCreated"
+	// EventRedeemed is emitted when the target redeems a voucher.
+	EventRedeemed = "redeemed"
+	// EventClosed is emitted when the target closes a payment channel.
+	EventClosed = "closed"
+	// EventReclaimed is emitted when the payer reclaims the funds of an
+	// expired payment channel.
+	EventReclaimed = "reclaimed"
+)
+
 func init() {
 	cbor.RegisterCborType(PaymentChannel{})
+	cbor.RegisterCborType(ChannelEvent{})
 }
 
 // PaymentChannel records the intent to pay funds to a target account.
@@ -67,11 +83,24 @@ type PaymentChannel struct {
 	Eol            *types.BlockHeight `json:"eol"`
 }
 
+// ChannelEvent is the data of the events of a payment channel.
+type ChannelEvent struct {
+	Payer   address.Address  `json:"payer"`
+	Channel *types.ChannelID `json:"channel"`
+	// Amount is the deposit of a created channel and the total amount
+	// redeemed from a redeemed or closed one. It is nil for a reclaimed
+	// channel.
+	Amount *types.AttoFIL `json:"amount"`
+}
+
 // Actor provides a mechanism for off chain payments.
 // It allows the creation of payment channels that hold funds for a target account
 // and permits that account to withdraw funds only with a voucher signed by the
 // channel's creator.
-type Actor struct{}
+type Actor struct {
+	// Version is the version of the actor code. Version 1 adds getChannel.
+	Version uint64
+}
 
 // InitializeState stores the actor's initial data structure.
 func (pb *Actor) InitializeState(storage exec.Storage, initializerData interface{}) error {
@@ -81,10 +110,14 @@ func (pb *Actor) InitializeState(storage exec.Storage, initializerData interface
 
 // Exports returns the actor's exports.
 func (pb *Actor) Exports() exec.Exports {
+	if pb.Version >= 1 {
+		return paymentBrokerV1Exports
+	}
 	return paymentBrokerExports
 }
 
 var _ exec.ExecutableActor = (*Actor)(nil)
+var _ exec.StateDiffer = (*Actor)(nil)
 
 var paymentBrokerExports = exec.Exports{
 	"close": &exec.FunctionSignature{
@@ -117,11 +150,25 @@ var paymentBrokerExports = exec.Exports{
 	},
 }
 
+// paymentBrokerV1Exports are the exports of version 1 of the actor code.
+var paymentBrokerV1Exports = exec.Exports{
+	"getChannel": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Address, abi.ChannelID},
+		Return: []abi.Type{abi.Bytes},
+	},
+}
+
+func init() {
+	for method, signature := range paymentBrokerExports {
+		paymentBrokerV1Exports[method] = signature
+	}
+}
+
 // CreateChannel creates a new payment channel from the caller to the target.
 // The value attached to the invocation is used as the deposit, and the channel
 // will expire and return all of its money to the owner after the given block height.
 func (pb *Actor) CreateChannel(vmctx exec.VMContext, target address.Address, eol *types.BlockHeight) (*types.ChannelID, uint8, error) {
-	if err := vmctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := vmctx.Charge(vmctx.GasPrices().MethodCall); err != nil {
 		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -167,6 +214,10 @@ func (pb *Actor) CreateChannel(vmctx exec.VMContext, target address.Address, eol
 		return nil, errors.CodeError(err), err
 	}
 
+	if err := vmctx.Emit(EventChannelCreated, &ChannelEvent{Payer: payerAddress, Channel: channelID, Amount: vmctx.Message().Value}); err != nil {
+		return nil, errors.CodeError(err), err
+	}
+
 	return channelID, 0, nil
 }
 
@@ -183,10 +234,13 @@ func (pb *Actor) CreateChannel(vmctx exec.VMContext, target address.Address, eol
 // target Close(500)           -> Payer: 1500, Target: 500, Channel: 0
 //
 func (pb *Actor) Redeem(vmctx exec.VMContext, payer address.Address, chid *types.ChannelID, amt *types.AttoFIL, validAt *types.BlockHeight, sig []byte) (uint8, error) {
-	if err := vmctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := vmctx.Charge(vmctx.GasPrices().MethodCall); err != nil {
 		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
+	if err := vmctx.Charge(vmctx.GasPrices().VerifySignature); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
 	if !VerifyVoucherSignature(payer, chid, amt, validAt, sig) {
 		return errors.CodeError(Errors[ErrInvalidSignature]), Errors[ErrInvalidSignature]
 	}
@@ -227,16 +281,23 @@ func (pb *Actor) Redeem(vmctx exec.VMContext, payer address.Address, chid *types
 		return errors.CodeError(err), err
 	}
 
+	if err := vmctx.Emit(EventRedeemed, &ChannelEvent{Payer: payer, Channel: chid, Amount: amt}); err != nil {
+		return errors.CodeError(err), err
+	}
+
 	return 0, nil
 }
 
 // Close first executes the logic performed in the the Update method, then returns all
 // funds remaining in the channel to the payer account and deletes the channel.
 func (pb *Actor) Close(vmctx exec.VMContext, payer address.Address, chid *types.ChannelID, amt *types.AttoFIL, validAt *types.BlockHeight, sig []byte) (uint8, error) {
-	if err := vmctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := vmctx.Charge(vmctx.GasPrices().MethodCall); err != nil {
 		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
+	if err := vmctx.Charge(vmctx.GasPrices().VerifySignature); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
 	if !VerifyVoucherSignature(payer, chid, amt, validAt, sig) {
 		return errors.CodeError(Errors[ErrInvalidSignature]), Errors[ErrInvalidSignature]
 	}
@@ -281,13 +342,17 @@ func (pb *Actor) Close(vmctx exec.VMContext, payer address.Address, chid *types.
 		return errors.CodeError(err), err
 	}
 
+	if err := vmctx.Emit(EventClosed, &ChannelEvent{Payer: payer, Channel: chid, Amount: amt}); err != nil {
+		return errors.CodeError(err), err
+	}
+
 	return 0, nil
 }
 
 // Extend can be used by the owner of a channel to add more funds to it and
 // extend the Channel's lifespan.
 func (pb *Actor) Extend(vmctx exec.VMContext, chid *types.ChannelID, eol *types.BlockHeight) (uint8, error) {
-	if err := vmctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := vmctx.Charge(vmctx.GasPrices().MethodCall); err != nil {
 		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -337,7 +402,7 @@ func (pb *Actor) Extend(vmctx exec.VMContext, chid *types.ChannelID, eol *types.
 // Reclaim is used by the owner of a channel to reclaim unspent funds in timed
 // out payment Channels they own.
 func (pb *Actor) Reclaim(vmctx exec.VMContext, chid *types.ChannelID) (uint8, error) {
-	if err := vmctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := vmctx.Charge(vmctx.GasPrices().MethodCall); err != nil {
 		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -376,6 +441,10 @@ func (pb *Actor) Reclaim(vmctx exec.VMContext, chid *types.ChannelID) (uint8, er
 		return errors.CodeError(err), err
 	}
 
+	if err := vmctx.Emit(EventReclaimed, &ChannelEvent{Payer: payerAddress, Channel: chid}); err != nil {
+		return errors.CodeError(err), err
+	}
+
 	return 0, nil
 }
 
@@ -385,7 +454,7 @@ func (pb *Actor) Reclaim(vmctx exec.VMContext, chid *types.ChannelID) (uint8, er
 // Voucher errors if the channel doesn't exist or contains less than request
 // amount.
 func (pb *Actor) Voucher(vmctx exec.VMContext, chid *types.ChannelID, amount *types.AttoFIL, validAt *types.BlockHeight) ([]byte, uint8, error) {
-	if err := vmctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := vmctx.Charge(vmctx.GasPrices().MethodCall); err != nil {
 		return []byte{}, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -446,7 +515,7 @@ func (pb *Actor) Voucher(vmctx exec.VMContext, chid *types.ChannelID, amount *ty
 // Ls returns all payment channels for a given payer address.
 // The slice of channels will be returned as cbor encoded map from string channelId to PaymentChannel.
 func (pb *Actor) Ls(vmctx exec.VMContext, payer address.Address) ([]byte, uint8, error) {
-	if err := vmctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := vmctx.Charge(vmctx.GasPrices().MethodCall); err != nil {
 		return []byte{}, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -487,6 +556,50 @@ func (pb *Actor) Ls(vmctx exec.VMContext, payer address.Address) ([]byte, uint8,
 	return channelsBytes, 0, nil
 }
 
+// GetChannel returns the payment channel of a payer with the given ID, cbor
+// encoded. It is exported from version 1 of the actor code.
+func (pb *Actor) GetChannel(vmctx exec.VMContext, payer address.Address, chid *types.ChannelID) ([]byte, uint8, error) {
+	if err := vmctx.Charge(vmctx.GasPrices().MethodCall); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	ctx := context.Background()
+	storage := vmctx.Storage()
+	var channel *PaymentChannel
+
+	err := withPayerChannelsForReading(ctx, storage, payer, func(byChannelID exec.Lookup) error {
+		chInt, err := byChannelID.Find(ctx, chid.KeyString())
+		if err != nil {
+			if err == hamt.ErrNotFound {
+				return Errors[ErrUnknownChannel]
+			}
+			return errors.FaultErrorWrapf(err, "Could not retrieve payment channel with ID: %s", chid)
+		}
+
+		var ok bool
+		channel, ok = chInt.(*PaymentChannel)
+		if !ok {
+			return errors.NewFaultError("Expected PaymentChannel from channels lookup")
+		}
+		return nil
+	})
+
+	if err != nil {
+		// ensure error is properly wrapped
+		if !errors.IsFault(err) && !errors.ShouldRevert(err) {
+			return nil, 1, errors.FaultErrorWrap(err, "Error getting channel")
+		}
+		return nil, errors.CodeError(err), err
+	}
+
+	channelBytes, err := actor.MarshalStorage(channel)
+	if err != nil {
+		return nil, 1, errors.FaultErrorWrap(err, "Error marshalling channel")
+	}
+
+	return channelBytes, 0, nil
+}
+
 func updateChannel(ctx exec.VMContext, target address.Address, channel *PaymentChannel, amt *types.AttoFIL, validAt *types.BlockHeight) error {
 	if target != channel.Target {
 		return Errors[ErrWrongTarget]
@@ -601,6 +714,76 @@ func withPayerChannels(ctx context.Context, storage exec.Storage, payer address.
 	return storage.Commit(stateCid, storage.Head())
 }
 
+// DiffState returns the payment channels created, changed or closed, keyed
+// by payer and channel id.
+func (pb *Actor) DiffState(ctx context.Context, before, after exec.Storage) ([]exec.StateChange, error) {
+	prev, err := allChannels(ctx, before)
+	if err != nil {
+		return nil, errors.FaultErrorWrap(err, "could not load previous payment channels")
+	}
+	next, err := allChannels(ctx, after)
+	if err != nil {
+		return nil, errors.FaultErrorWrap(err, "could not load payment channels")
+	}
+
+	var changes []exec.StateChange
+	for key, channel := range next {
+		if prevChannel, ok := prev[key]; ok {
+			changes = actor.AppendStateChange(changes, "channels/"+key, channelString(prevChannel), channelString(channel))
+		} else {
+			changes = actor.AppendStateChange(changes, "channels/"+key, nil, channelString(channel))
+		}
+	}
+	for key, channel := range prev {
+		if _, ok := next[key]; !ok {
+			changes = actor.AppendStateChange(changes, "channels/"+key, channelString(channel), nil)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes, nil
+}
+
+// allChannels returns the payment channels of a payment broker's storage,
+// keyed by payer and channel id.
+func allChannels(ctx context.Context, storage exec.Storage) (map[string]*PaymentChannel, error) {
+	channels := make(map[string]*PaymentChannel)
+	if !storage.Head().Defined() {
+		return channels, nil
+	}
+	byPayer, err := actor.LoadLookup(ctx, storage, storage.Head())
+	if err != nil {
+		return nil, err
+	}
+	payers, err := byPayer.Values(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, payer := range payers {
+		byChannelCID, ok := payer.Value.(cid.Cid)
+		if !ok {
+			return nil, errors.NewFaultError("Paymentbroker payer is not a Cid")
+		}
+		byChannelID, err := actor.LoadTypedLookup(ctx, storage, byChannelCID, &PaymentChannel{})
+		if err != nil {
+			return nil, err
+		}
+		kvs, err := byChannelID.Values(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, kv := range kvs {
+			channels[payer.Key+"/"+kv.Key] = kv.Value.(*PaymentChannel)
+		}
+	}
+	return channels, nil
+}
+
+func channelString(channel *PaymentChannel) string {
+	return fmt.Sprintf("target=%s amount=%s redeemed=%s eol=%s", channel.Target, channel.Amount, channel.AmountRedeemed, channel.Eol)
+}
+
 func withPayerChannelsForReading(ctx context.Context, storage exec.Storage, payer address.Address, f func(exec.Lookup) error) error {
 	return actor.WithLookupForReading(ctx, storage, storage.Head(), func(byPayer exec.Lookup) error {
 		byChannelLookup, err := findByChannelLookup(ctx, storage, byPayer, payer)
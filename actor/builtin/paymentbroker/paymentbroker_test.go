@@ -72,6 +72,16 @@ func TestPaymentBrokerCreateChannel(t *testing.T) {
 	assert.Equal(types.NewAttoFILFromFIL(0), channel.AmountRedeemed)
 	assert.Equal(target, channel.Target)
 	assert.Equal(types.NewBlockHeight(10), channel.Eol)
+
+	require.Len(result.Receipt.Events, 1)
+	event := result.Receipt.Events[0]
+	assert.Equal(address.PaymentBrokerAddress, event.Emitter)
+	assert.Equal(EventChannelCreated, event.Topic)
+	var data ChannelEvent
+	require.NoError(cbor.DecodeInto(event.Data, &data))
+	assert.Equal(payer, data.Payer)
+	assert.Equal(channelID, data.Channel)
+	assert.Equal(types.NewAttoFILFromFIL(1000), data.Amount)
 }
 
 func TestPaymentBrokerUpdate(t *testing.T) {
@@ -97,6 +107,9 @@ func TestPaymentBrokerUpdate(t *testing.T) {
 	assert.Equal(types.NewAttoFILFromFIL(1000), channel.Amount)
 	assert.Equal(types.NewAttoFILFromFIL(100), channel.AmountRedeemed)
 	assert.Equal(sys.target, channel.Target)
+
+	require.Len(result.Receipt.Events, 1)
+	assert.Equal(EventRedeemed, result.Receipt.Events[0].Topic)
 }
 
 func TestPaymentBrokerUpdateErrorsWithIncorrectChannel(t *testing.T) {
@@ -433,7 +446,7 @@ func TestPaymentBrokerLs(t *testing.T) {
 		args, err := abi.ToEncodedValues(payer)
 		require.NoError(err)
 
-		returnValue, exitCode, err := consensus.CallQueryMethod(ctx, st, vms, address.PaymentBrokerAddress, "ls", args, payer, types.NewBlockHeight(9))
+		returnValue, exitCode, err := consensus.CallQueryMethod(ctx, st, vms, nil, address.PaymentBrokerAddress, "ls", args, payer, types.NewBlockHeight(9))
 		require.NoError(err)
 		assert.Equal(uint8(0), exitCode)
 
@@ -470,7 +483,7 @@ func TestPaymentBrokerLs(t *testing.T) {
 		args, err := abi.ToEncodedValues(payer)
 		require.NoError(err)
 
-		returnValue, exitCode, err := consensus.CallQueryMethod(ctx, st, vms, address.PaymentBrokerAddress, "ls", args, payer, types.NewBlockHeight(9))
+		returnValue, exitCode, err := consensus.CallQueryMethod(ctx, st, vms, nil, address.PaymentBrokerAddress, "ls", args, payer, types.NewBlockHeight(9))
 		require.NoError(err)
 		assert.Equal(uint8(0), exitCode)
 
@@ -482,6 +495,47 @@ func TestPaymentBrokerLs(t *testing.T) {
 	})
 }
 
+func TestPaymentBrokerGetChannel(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	payer := address.TestAddress
+	target := address.NewForTestGetter()()
+	_, st, vms := requireGenesis(ctx, t, target)
+	channelID := establishChannel(ctx, st, vms, payer, target, 0, types.NewAttoFILFromFIL(1000), types.NewBlockHeight(10))
+
+	args, err := abi.ToEncodedValues(payer, channelID)
+	require.NoError(err)
+
+	// version 0 of the actor code does not export getChannel
+	_, _, err = consensus.CallQueryMethod(ctx, st, vms, nil, address.PaymentBrokerAddress, "getChannel", args, payer, types.NewBlockHeight(9))
+	assert.Error(err)
+
+	pb := state.MustGetActor(st, address.PaymentBrokerAddress)
+	pb.Code = types.PaymentBrokerV1ActorCodeCid
+	require.NoError(st.SetActor(ctx, address.PaymentBrokerAddress, pb))
+	v1 := consensus.ProtocolVersions[1]
+
+	returnValue, exitCode, err := consensus.CallQueryMethod(ctx, st, vms, v1, address.PaymentBrokerAddress, "getChannel", args, payer, types.NewBlockHeight(9))
+	require.NoError(err)
+	assert.Equal(uint8(0), exitCode)
+
+	var channel PaymentChannel
+	require.NoError(cbor.DecodeInto(returnValue[0], &channel))
+	assert.Equal(target, channel.Target)
+	assert.Equal(types.NewAttoFILFromFIL(1000), channel.Amount)
+	assert.Equal(types.NewBlockHeight(10), channel.Eol)
+
+	unknownArgs, err := abi.ToEncodedValues(payer, types.NewChannelID(100))
+	require.NoError(err)
+	_, exitCode, err = consensus.CallQueryMethod(ctx, st, vms, v1, address.PaymentBrokerAddress, "getChannel", unknownArgs, payer, types.NewBlockHeight(9))
+	assert.Error(err)
+	assert.Equal(uint8(ErrUnknownChannel), exitCode)
+}
+
 func TestNewPaymentBrokerVoucher(t *testing.T) {
 	require := require.New(t)
 	assert := assert.New(t)
@@ -627,7 +681,7 @@ func (sys *system) CallQueryMethod(method string, height uint64, params ...inter
 
 	args := core.MustConvertParams(params...)
 
-	return consensus.CallQueryMethod(sys.ctx, sys.st, sys.vms, address.PaymentBrokerAddress, method, args, sys.payer, types.NewBlockHeight(height))
+	return consensus.CallQueryMethod(sys.ctx, sys.st, sys.vms, nil, address.PaymentBrokerAddress, method, args, sys.payer, types.NewBlockHeight(height))
 }
 
 func (sys *system) ApplyRedeemMessage(target address.Address, amtInt uint64, nonce uint64) (*consensus.ApplicationResult, error) {
@@ -666,7 +720,7 @@ func (sys *system) retrieveChannel(paymentBroker *actor.Actor) *PaymentChannel {
 	args, err := abi.ToEncodedValues(sys.payer)
 	require.NoError(err)
 
-	returnValue, exitCode, err := consensus.CallQueryMethod(sys.ctx, sys.st, sys.vms, address.PaymentBrokerAddress, "ls", args, sys.payer, types.NewBlockHeight(9))
+	returnValue, exitCode, err := consensus.CallQueryMethod(sys.ctx, sys.st, sys.vms, nil, address.PaymentBrokerAddress, "ls", args, sys.payer, types.NewBlockHeight(9))
 	require.NoError(err)
 	assert.Equal(uint8(0), exitCode)
 
@@ -703,7 +757,7 @@ func requireGetPaymentChannel(t *testing.T, ctx context.Context, st state.Tree,
 	var paymentMap map[string]*PaymentChannel
 
 	pdata := core.MustConvertParams(payer)
-	values, ec, err := consensus.CallQueryMethod(ctx, st, vms, address.PaymentBrokerAddress, "ls", pdata, payer, types.NewBlockHeight(0))
+	values, ec, err := consensus.CallQueryMethod(ctx, st, vms, nil, address.PaymentBrokerAddress, "ls", pdata, payer, types.NewBlockHeight(0))
 	require.Zero(ec)
 	require.NoError(err)
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"math/big"
+	"sort"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-hamt-ipld"
@@ -41,6 +42,10 @@ var Errors = map[uint8]error{
 	ErrInsufficientCollateral: errors.NewCodedRevertErrorf(ErrInsufficientCollateral, "collateral must be more than %s FIL per sector", MinimumCollateralPerSector),
 }
 
+// EventMinerCreated is the topic of the event emitted with the address of a
+// new miner when it is created.
+const EventMinerCreated = "minerCreated"
+
 func init() {
 	cbor.RegisterCborType(State{})
 	cbor.RegisterCborType(struct{}{})
@@ -89,6 +94,66 @@ func (sma *Actor) Exports() exec.Exports {
 	return storageMarketExports
 }
 
+var _ exec.StateDiffer = (*Actor)(nil)
+
+// DiffState returns the changes of the total committed storage and the
+// miners created.
+func (sma *Actor) DiffState(ctx context.Context, before, after exec.Storage) ([]exec.StateChange, error) {
+	var prev, next State
+	if err := actor.LoadState(before, &prev); err != nil {
+		return nil, errors.FaultErrorWrap(err, "could not load previous storage market state")
+	}
+	if err := actor.LoadState(after, &next); err != nil {
+		return nil, errors.FaultErrorWrap(err, "could not load storage market state")
+	}
+
+	var changes []exec.StateChange
+	changes = actor.AppendStateChange(changes, "totalCommittedStorage", prev.TotalCommittedStorage, next.TotalCommittedStorage)
+
+	prevMiners, err := minerSet(ctx, before, prev.Miners)
+	if err != nil {
+		return nil, err
+	}
+	nextMiners, err := minerSet(ctx, after, next.Miners)
+	if err != nil {
+		return nil, err
+	}
+	for addr := range nextMiners {
+		if !prevMiners[addr] {
+			changes = actor.AppendStateChange(changes, "miners/"+addr, nil, true)
+		}
+	}
+	for addr := range prevMiners {
+		if !nextMiners[addr] {
+			changes = actor.AppendStateChange(changes, "miners/"+addr, true, nil)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes, nil
+}
+
+// minerSet returns the addresses of the miners in the lookup at c.
+func minerSet(ctx context.Context, storage exec.Storage, c cid.Cid) (map[string]bool, error) {
+	miners := make(map[string]bool)
+	if !c.Defined() {
+		return miners, nil
+	}
+	lookup, err := actor.LoadLookup(ctx, storage, c)
+	if err != nil {
+		return nil, errors.FaultErrorWrapf(err, "could not load lookup for miner with CID: %s", c)
+	}
+	kvs, err := lookup.Values(ctx)
+	if err != nil {
+		return nil, errors.FaultErrorWrap(err, "could not load miners")
+	}
+	for _, kv := range kvs {
+		miners[kv.Key] = true
+	}
+	return miners, nil
+}
+
 var storageMarketExports = exec.Exports{
 	"createMiner": &exec.FunctionSignature{
 		Params: []abi.Type{abi.Integer, abi.Bytes, abi.PeerID},
@@ -107,7 +172,7 @@ var storageMarketExports = exec.Exports{
 // CreateMiner creates a new miner with the a pledge of the given amount of sectors. The
 // miners collateral is set by the value in the message.
 func (sma *Actor) CreateMiner(vmctx exec.VMContext, pledge *big.Int, publicKey []byte, pid peer.ID) (address.Address, uint8, error) {
-	if err := vmctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := vmctx.Charge(vmctx.GasPrices().MethodCall); err != nil {
 		return address.Undef, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -156,14 +221,19 @@ func (sma *Actor) CreateMiner(vmctx exec.VMContext, pledge *big.Int, publicKey [
 		return address.Undef, errors.CodeError(err), err
 	}
 
-	return ret.(address.Address), 0, nil
+	addr := ret.(address.Address)
+	if err := vmctx.Emit(EventMinerCreated, addr); err != nil {
+		return address.Undef, errors.CodeError(err), err
+	}
+
+	return addr, 0, nil
 }
 
 // UpdatePower is called to reflect a change in the overall power of the network.
 // This occurs either when a miner adds a new commitment, or when one is removed
 // (via slashing or willful removal). The delta is in number of sectors.
 func (sma *Actor) UpdatePower(vmctx exec.VMContext, delta *big.Int) (uint8, error) {
-	if err := vmctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := vmctx.Charge(vmctx.GasPrices().MethodCall); err != nil {
 		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
@@ -198,7 +268,7 @@ func (sma *Actor) UpdatePower(vmctx exec.VMContext, delta *big.Int) (uint8, erro
 
 // GetTotalStorage returns the total amount of proven storage in the system.
 func (sma *Actor) GetTotalStorage(vmctx exec.VMContext) (*big.Int, uint8, error) {
-	if err := vmctx.Charge(actor.DefaultGasCost); err != nil {
+	if err := vmctx.Charge(vmctx.GasPrices().MethodCall); err != nil {
 		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
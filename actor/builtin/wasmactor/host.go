@@ -0,0 +1,247 @@
+package wasmactor
+
+import (
+	"fmt"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm/errors"
+	"github.com/filecoin-project/go-filecoin/vm/wasm"
+)
+
+// hostModule is the module the host functions are imported from.
+const hostModule = "env"
+
+var (
+	i32 = wasm.I32
+	i64 = wasm.I64
+)
+
+// hostTypes are the types of the host functions, by name. The functions
+// returning bytes take the address and the size of a buffer and return the
+// size of the bytes, copying as many as fit into the buffer.
+var hostTypes = map[string]wasm.FuncType{
+	// params(ptr, max) -> size returns the params of the message.
+	"params": {Params: []wasm.ValueType{i32, i32}, Results: []wasm.ValueType{i32}},
+	// set_return(ptr, size) sets the return value of the method.
+	"set_return": {Params: []wasm.ValueType{i32, i32}},
+	// caller(ptr, max) -> size returns the address of the sender of the
+	// message.
+	"caller": {Params: []wasm.ValueType{i32, i32}, Results: []wasm.ValueType{i32}},
+	// value(ptr, max) -> size returns the value of the message in AttoFIL,
+	// leb128 encoded.
+	"value": {Params: []wasm.ValueType{i32, i32}, Results: []wasm.ValueType{i32}},
+	// storage_read(ptr, max) -> size returns the state of the actor.
+	"storage_read": {Params: []wasm.ValueType{i32, i32}, Results: []wasm.ValueType{i32}},
+	// storage_write(ptr, size) replaces the state of the actor.
+	"storage_write": {Params: []wasm.ValueType{i32, i32}},
+	// block_height() -> height returns the height of the block.
+	"block_height": {Results: []wasm.ValueType{i64}},
+	// randomness(height, ptr, max) -> size samples the randomness of the
+	// chain at a height.
+	"randomness": {Params: []wasm.ValueType{i64, i32, i32}, Results: []wasm.ValueType{i32}},
+	// send(to, to size, method, method size, value, value size, params,
+	// params size) -> exit code sends a message. The params are passed as
+	// a single bytes parameter, none if empty. A failed send aborts the
+	// code.
+	"send": {Params: []wasm.ValueType{i32, i32, i32, i32, i32, i32, i32, i32}, Results: []wasm.ValueType{i32}},
+	// send_return(ptr, max) -> size returns the first return value of the
+	// last message sent.
+	"send_return": {Params: []wasm.ValueType{i32, i32}, Results: []wasm.ValueType{i32}},
+	// abort(code) aborts the code with an exit code.
+	"abort": {Params: []wasm.ValueType{i32}},
+}
+
+// checkImports checks a module imports only host functions.
+func checkImports(module *wasm.Module) error {
+	for _, imp := range module.Imports {
+		ft, ok := hostTypes[imp.Name]
+		if imp.Module != hostModule || !ok {
+			return fmt.Errorf("unknown import %s.%s", imp.Module, imp.Name)
+		}
+		if !ft.Equal(module.Types[imp.Type]) {
+			return fmt.Errorf("import %s.%s has the wrong type", imp.Module, imp.Name)
+		}
+	}
+	return nil
+}
+
+// host runs the host functions of a call of a deployed actor and charges
+// its execution.
+type host struct {
+	vmctx  exec.VMContext
+	params []byte
+	ret    []byte
+	// sendRet is the return value of the last message sent.
+	sendRet []byte
+}
+
+var _ wasm.Meter = (*host)(nil)
+
+// ChargeInstructions charges the instructions run, by the thousand.
+func (h *host) ChargeInstructions(count uint64) error {
+	thousands := types.GasUnits((count + 999) / 1000)
+	return h.charge(h.vmctx.GasPrices().WasmInstructions * thousands)
+}
+
+// ChargePages charges the pages of memory added.
+func (h *host) ChargePages(count uint32) error {
+	return h.charge(h.vmctx.GasPrices().WasmMemoryPage * types.GasUnits(count))
+}
+
+// ChargeMemoryBytes charges the bytes copied or filled in memory.
+func (h *host) ChargeMemoryBytes(count uint32) error {
+	return h.charge(h.vmctx.GasPrices().WasmMemoryCost(int(count)))
+}
+
+func (h *host) charge(cost types.GasUnits) error {
+	if err := h.vmctx.Charge(cost); err != nil {
+		return errors.NewCodedRevertErrorf(exec.ErrInsufficientGas, "Insufficient gas: %s", err)
+	}
+	return nil
+}
+
+func (h *host) imports() wasm.Imports {
+	funcs := map[string]func(*wasm.Instance, []uint64) ([]uint64, error){
+		"params":        h.paramsFunc,
+		"set_return":    h.setReturn,
+		"caller":        h.caller,
+		"value":         h.value,
+		"storage_read":  h.storageRead,
+		"storage_write": h.storageWrite,
+		"block_height":  h.blockHeight,
+		"randomness":    h.randomness,
+		"send":          h.send,
+		"send_return":   h.sendReturn,
+		"abort":         h.abort,
+	}
+	imports := map[string]wasm.HostFunc{}
+	for name, call := range funcs {
+		imports[name] = wasm.HostFunc{Type: hostTypes[name], Call: call}
+	}
+	return wasm.Imports{hostModule: imports}
+}
+
+// copyOut copies as many bytes of data as fit into the buffer at args[0] of
+// size args[1] and returns the size of data.
+func copyOut(inst *wasm.Instance, args []uint64, data []byte) ([]uint64, error) {
+	size := uint64(len(data))
+	if max := uint64(uint32(args[1])); size > max {
+		data = data[:max]
+	}
+	if err := inst.Write(uint32(args[0]), data); err != nil {
+		return nil, err
+	}
+	return []uint64{size}, nil
+}
+
+func (h *host) paramsFunc(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	return copyOut(inst, args, h.params)
+}
+
+func (h *host) setReturn(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	ret, err := inst.Read(uint32(args[0]), uint32(args[1]))
+	if err != nil {
+		return nil, err
+	}
+	h.ret = ret
+	return nil, nil
+}
+
+func (h *host) caller(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	return copyOut(inst, args, h.vmctx.Message().From.Bytes())
+}
+
+func (h *host) value(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	value := h.vmctx.Message().Value
+	if value == nil {
+		value = types.ZeroAttoFIL
+	}
+	return copyOut(inst, args, value.Bytes())
+}
+
+func (h *host) storageRead(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	state, err := LoadState(h.vmctx.Storage())
+	if err != nil {
+		return nil, err
+	}
+	return copyOut(inst, args, state.Data)
+}
+
+func (h *host) storageWrite(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	data, err := inst.Read(uint32(args[0]), uint32(args[1]))
+	if err != nil {
+		return nil, err
+	}
+
+	storage := h.vmctx.Storage()
+	state, err := LoadState(storage)
+	if err != nil {
+		return nil, err
+	}
+	state.Data = data
+
+	stateCid, err := storage.Put(state)
+	if err != nil {
+		return nil, errors.RevertErrorWrap(err, "could not store state")
+	}
+	if err := storage.Commit(stateCid, storage.Head()); err != nil {
+		return nil, errors.RevertErrorWrap(err, "could not commit state")
+	}
+	return nil, nil
+}
+
+func (h *host) blockHeight(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	return []uint64{h.vmctx.BlockHeight().AsBigInt().Uint64()}, nil
+}
+
+func (h *host) randomness(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	randomness, err := h.vmctx.SampleChainRandomness(types.NewBlockHeight(args[0]))
+	if err != nil {
+		return nil, errors.RevertErrorWrap(err, "could not sample randomness")
+	}
+	return copyOut(inst, args[1:], randomness)
+}
+
+func (h *host) send(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	var parts [4][]byte
+	for i := range parts {
+		part, err := inst.Read(uint32(args[2*i]), uint32(args[2*i+1]))
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = part
+	}
+
+	to, err := address.NewFromBytes(parts[0])
+	if err != nil {
+		return nil, errors.NewRevertErrorf("invalid address: %s", err)
+	}
+	var params []interface{}
+	if len(parts[3]) > 0 {
+		params = []interface{}{parts[3]}
+	}
+
+	ret, code, err := h.vmctx.Send(to, string(parts[1]), types.NewAttoFILFromBytes(parts[2]), params)
+	if err != nil {
+		return nil, err
+	}
+	h.sendRet = nil
+	if len(ret) > 0 {
+		h.sendRet = ret[0]
+	}
+	return []uint64{uint64(code)}, nil
+}
+
+func (h *host) sendReturn(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	return copyOut(inst, args, h.sendRet)
+}
+
+func (h *host) abort(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	code := uint32(args[0])
+	if code == 0 || code > 255 {
+		return nil, errors.NewCodedRevertErrorf(ErrAborted, "aborted with invalid exit code %d", code)
+	}
+	return nil, errors.NewCodedRevertErrorf(uint8(code), "aborted with exit code %d", code)
+}
@@ -0,0 +1,51 @@
+package wasmactor
+
+import (
+	"github.com/filecoin-project/go-filecoin/vm/wasm"
+)
+
+// TestCode returns the code of a test actor. Its method increment
+// increments a counter of 8 bytes in storage and returns it, echo returns its
+// params, height returns the block height in 8 bytes, fail aborts with exit
+// code 42 and trap traps. Counters and heights are little endian.
+func TestCode() []byte {
+	var imports []wasm.TestImport
+	for _, name := range []string{"params", "set_return", "storage_read", "storage_write", "block_height", "abort"} {
+		imports = append(imports, wasm.TestImport{Module: hostModule, Name: name, Type: hostTypes[name]})
+	}
+	const (
+		params = iota
+		setReturn
+		storageRead
+		storageWrite
+		blockHeight
+		abort
+	)
+
+	method := func(name string, body ...byte) wasm.TestFunc {
+		return wasm.TestFunc{Type: wasm.FuncType{}, Body: append(body, 0x0b), Export: name}
+	}
+	return wasm.TestModule{
+		Imports: imports,
+		Funcs: []wasm.TestFunc{
+			method("increment",
+				0x41, 0, 0x41, 8, 0x10, storageRead, 0x1a,
+				0x41, 0, 0x41, 0, 0x29, 3, 0, 0x42, 1, 0x7c, 0x37, 3, 0,
+				0x41, 0, 0x41, 8, 0x10, storageWrite,
+				0x41, 0, 0x41, 8, 0x10, setReturn,
+			),
+			method("echo",
+				0x41, 0,
+				0x41, 0, 0x41, 0x80, 0x08, 0x10, params,
+				0x10, setReturn,
+			),
+			method("height",
+				0x41, 0, 0x10, blockHeight, 0x37, 3, 0,
+				0x41, 0, 0x41, 8, 0x10, setReturn,
+			),
+			method("fail", 0x41, 42, 0x10, abort),
+			method("trap", 0x00),
+		},
+		Pages: 1,
+	}.Assemble()
+}
@@ -0,0 +1,196 @@
+// Package wasmactor implements the actors deployed by users, which run
+// WebAssembly code with access to their storage and to the VM through host
+// functions.
+package wasmactor
+
+import (
+	"github.com/ipfs/go-cid"
+	cbor "github.com/ipfs/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/abi"
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm/errors"
+	"github.com/filecoin-project/go-filecoin/vm/wasm"
+)
+
+const (
+	// ErrInvalidCode indicates code that is not a WebAssembly module the VM
+	// can run.
+	ErrInvalidCode = 33
+	// ErrTrap indicates that the execution of the code failed.
+	ErrTrap = 34
+	// ErrAborted indicates that the code aborted with an invalid exit code.
+	ErrAborted = 35
+)
+
+// Errors map error codes to revert errors this actor may return.
+var Errors = map[uint8]error{
+	ErrInvalidCode: errors.NewCodedRevertErrorf(ErrInvalidCode, "invalid WebAssembly code"),
+	ErrTrap:        errors.NewCodedRevertErrorf(ErrTrap, "WebAssembly code trapped"),
+	ErrAborted:     errors.NewCodedRevertErrorf(ErrAborted, "WebAssembly code aborted"),
+}
+
+func init() {
+	cbor.RegisterCborType(State{})
+}
+
+// State is the storage of a deployed actor.
+type State struct {
+	// Code links the WebAssembly code of the actor, keeping it in the
+	// storage of the actor.
+	Code cid.Cid
+	// Data is the state of the code, read and written through host
+	// functions.
+	Data []byte
+}
+
+// Actor runs the WebAssembly code deployed to an actor. Each exported
+// function taking and returning nothing is a method of the actor, taking and
+// returning bytes through host functions.
+type Actor struct {
+	module  *wasm.Module
+	exports exec.Exports
+}
+
+var _ exec.ExecutableActor = (*Actor)(nil)
+var _ exec.Dispatcher = (*Actor)(nil)
+
+// CodeCid returns the CID of code, which is the code of the actors it is
+// deployed to.
+func CodeCid(code []byte) (cid.Cid, error) {
+	nd, err := cbor.WrapObject(code, types.DefaultHashFunction, -1)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return nd.Cid(), nil
+}
+
+// Decode decodes the WebAssembly code of an actor, checking the VM can run
+// it.
+func Decode(code []byte) (*Actor, error) {
+	module, err := wasm.Decode(code)
+	if err != nil {
+		return nil, errors.NewCodedRevertErrorf(ErrInvalidCode, "invalid WebAssembly code: %s", err)
+	}
+	if err := checkImports(module); err != nil {
+		return nil, errors.NewCodedRevertErrorf(ErrInvalidCode, "invalid WebAssembly code: %s", err)
+	}
+
+	exports := exec.Exports{}
+	for name, idx := range module.Exports {
+		ft, _ := module.FuncType(idx)
+		if len(ft.Params) != 0 || len(ft.Results) != 0 {
+			continue
+		}
+		exports[name] = &exec.FunctionSignature{
+			Params: []abi.Type{abi.Bytes},
+			Return: []abi.Type{abi.Bytes},
+		}
+	}
+	return &Actor{module: module, exports: exports}, nil
+}
+
+// Deploy stores the code of an actor in its storage and initializes its
+// state. It returns the CID of the code.
+func Deploy(storage exec.Storage, code []byte) (cid.Cid, error) {
+	if _, err := Decode(code); err != nil {
+		return cid.Undef, err
+	}
+
+	raw, err := cbor.DumpObject(code)
+	if err != nil {
+		return cid.Undef, errors.FaultErrorWrap(err, "could not encode code")
+	}
+	codeCid, err := storage.Put(raw)
+	if err != nil {
+		return cid.Undef, errors.RevertErrorWrap(err, "could not store code")
+	}
+
+	stateCid, err := storage.Put(&State{Code: codeCid})
+	if err != nil {
+		return cid.Undef, errors.RevertErrorWrap(err, "could not store state")
+	}
+	if err := storage.Commit(stateCid, cid.Undef); err != nil {
+		return cid.Undef, errors.RevertErrorWrap(err, "could not commit state")
+	}
+	return codeCid, nil
+}
+
+// Load loads the code of a deployed actor from its storage.
+func Load(storage exec.Storage, code cid.Cid) (*Actor, error) {
+	raw, err := storage.Get(code)
+	if err != nil {
+		return nil, err
+	}
+	var wasmCode []byte
+	if err := cbor.DecodeInto(raw, &wasmCode); err != nil {
+		return nil, errors.FaultErrorWrap(err, "could not decode code")
+	}
+	return Decode(wasmCode)
+}
+
+// Exports returns the actor's exports.
+func (a *Actor) Exports() exec.Exports {
+	return a.exports
+}
+
+// InitializeState is not supported, deployed actors are initialized by
+// Deploy.
+func (a *Actor) InitializeState(storage exec.Storage, _ interface{}) error {
+	return errors.NewRevertError("deployed actors are initialized by Deploy")
+}
+
+// Dispatch runs the exported function of the method, with the params of the
+// message readable by the code.
+func (a *Actor) Dispatch(vmctx exec.VMContext, method string, params []interface{}) ([]interface{}, uint8, error) {
+	if err := vmctx.Charge(vmctx.GasPrices().MethodCall); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	h := &host{vmctx: vmctx}
+	if len(params) > 0 {
+		h.params = params[0].([]byte)
+	}
+
+	inst, err := wasm.Instantiate(a.module, h.imports(), h)
+	if err == nil {
+		_, err = inst.Invoke(method)
+	}
+	if err != nil {
+		err = runError(err)
+		return nil, errors.CodeError(err), err
+	}
+
+	ret := h.ret
+	if ret == nil {
+		ret = []byte{}
+	}
+	return []interface{}{ret}, 0, nil
+}
+
+// runError turns the errors of running code into revert errors, the errors
+// of the VM being returned as they are and the failures of the interpreter
+// as faults.
+func runError(err error) error {
+	switch e := err.(type) {
+	case *wasm.Trap:
+		return errors.NewCodedRevertErrorf(ErrTrap, "%s", e)
+	case *wasm.InterpreterError:
+		return errors.FaultErrorWrap(e, "WebAssembly interpreter failed")
+	}
+	if errors.ShouldRevert(err) || errors.IsFault(err) {
+		return err
+	}
+	return errors.NewCodedRevertErrorf(ErrInvalidCode, "could not run code: %s", err)
+}
+
+// LoadState loads the state of a deployed actor.
+func LoadState(storage exec.Storage) (*State, error) {
+	var state State
+	if err := actor.LoadState(storage, &state); err != nil {
+		return nil, errors.FaultErrorWrap(err, "could not load state")
+	}
+	return &state, nil
+}
@@ -0,0 +1,103 @@
+package wasmactor_test
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/abi"
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	. "github.com/filecoin-project/go-filecoin/actor/builtin/wasmactor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/core"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/state"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+)
+
+func deploy(t *testing.T, st state.Tree, vms vm.StorageMap, code []byte) *types.MessageReceipt {
+	msg := types.NewMessage(address.TestAddress, address.InitAddress, 0, types.ZeroAttoFIL, "deploy", actor.MustConvertParams(code))
+	result, err := th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(0))
+	require.NoError(t, err)
+	return result.Receipt
+}
+
+func call(t *testing.T, st state.Tree, vms vm.StorageMap, to address.Address, method string, params []byte) *types.MessageReceipt {
+	msg := types.NewMessage(address.TestAddress, to, 0, types.ZeroAttoFIL, method, actor.MustConvertParams(params))
+	result, err := th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(7))
+	require.NoError(t, err)
+	return result.Receipt
+}
+
+func TestDeployedActor(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	st, vms := core.CreateStorages(ctx, t)
+	code := TestCode()
+
+	receipt := deploy(t, st, vms, code)
+	require.Equal(uint8(0), receipt.ExitCode)
+	addr, err := address.NewFromBytes(receipt.Return[0])
+	require.NoError(err)
+
+	deployed, err := st.GetActor(ctx, addr)
+	require.NoError(err)
+	codeCid, err := CodeCid(code)
+	require.NoError(err)
+	assert.Equal(codeCid, deployed.Code)
+
+	var deployedState State
+	builtin.RequireReadState(t, vms, addr, deployed, &deployedState)
+	assert.Equal(codeCid, deployedState.Code)
+
+	t.Run("methods keep state in storage", func(t *testing.T) {
+		for i := uint64(1); i <= 2; i++ {
+			receipt := call(t, st, vms, addr, "increment", nil)
+			require.Equal(uint8(0), receipt.ExitCode)
+			assert.Equal(i, binary.LittleEndian.Uint64(receipt.Return[0]))
+		}
+	})
+
+	t.Run("methods read their params and the VM", func(t *testing.T) {
+		receipt := call(t, st, vms, addr, "echo", []byte("hello"))
+		require.Equal(uint8(0), receipt.ExitCode)
+		assert.Equal([]byte("hello"), receipt.Return[0])
+
+		receipt = call(t, st, vms, addr, "height", nil)
+		require.Equal(uint8(0), receipt.ExitCode)
+		assert.Equal(uint64(7), binary.LittleEndian.Uint64(receipt.Return[0]))
+	})
+
+	t.Run("aborts and traps fail the message", func(t *testing.T) {
+		assert.Equal(uint8(42), call(t, st, vms, addr, "fail", nil).ExitCode)
+		assert.Equal(uint8(ErrTrap), call(t, st, vms, addr, "trap", nil).ExitCode)
+
+		// unexported functions are not methods
+		assert.NotEqual(uint8(0), call(t, st, vms, addr, "missing", nil).ExitCode)
+	})
+
+	t.Run("exports are published", func(t *testing.T) {
+		receipt := call(t, st, vms, addr, exec.ExportsMethod, nil)
+		require.Equal(uint8(0), receipt.ExitCode)
+
+		var exports abi.ExportsSchema
+		require.NoError(json.Unmarshal(receipt.Return[0], &exports))
+		assert.Equal(abi.Bytes, exports["echo"].Params[0].Type)
+		assert.Equal(abi.Bytes, exports["echo"].Return[0].Type)
+		assert.Contains(exports, "increment")
+	})
+
+	t.Run("invalid code is not deployed", func(t *testing.T) {
+		assert.Equal(uint8(ErrInvalidCode), deploy(t, st, vms, []byte("not wasm")).ExitCode)
+	})
+}
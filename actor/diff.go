@@ -0,0 +1,41 @@
+package actor
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/filecoin-project/go-filecoin/exec"
+)
+
+// AppendStateChange appends the change of a field of a state to changes if
+// before and after differ. A nil before or after means the field was added or
+// removed.
+func AppendStateChange(changes []exec.StateChange, field string, before, after interface{}) []exec.StateChange {
+	if reflect.DeepEqual(before, after) {
+		return changes
+	}
+	change := exec.StateChange{Field: field}
+	if before != nil {
+		change.Before = fmt.Sprint(before)
+	}
+	if after != nil {
+		change.After = fmt.Sprint(after)
+	}
+	if change.Before == change.After {
+		return changes
+	}
+	return append(changes, change)
+}
+
+// LoadState decodes the state at the head of storage into st. st is left
+// untouched if the head is undefined.
+func LoadState(storage exec.Storage, st interface{}) error {
+	if !storage.Head().Defined() {
+		return nil
+	}
+	chunk, err := storage.Get(storage.Head())
+	if err != nil {
+		return err
+	}
+	return UnmarshalStorage(chunk, st)
+}
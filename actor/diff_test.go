@@ -0,0 +1,28 @@
+package actor_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestAppendStateChange(t *testing.T) {
+	assert := assert.New(t)
+
+	var changes []exec.StateChange
+	changes = AppendStateChange(changes, "same", types.NewAttoFILFromFIL(1), types.NewAttoFILFromFIL(1))
+	assert.Empty(changes)
+
+	changes = AppendStateChange(changes, "changed", types.NewAttoFILFromFIL(1), types.NewAttoFILFromFIL(2))
+	changes = AppendStateChange(changes, "added", nil, "a")
+	changes = AppendStateChange(changes, "removed", "b", nil)
+	assert.Equal([]exec.StateChange{
+		{Field: "changed", Before: "1", After: "2"},
+		{Field: "added", After: "a"},
+		{Field: "removed", Before: "b"},
+	}, changes)
+}
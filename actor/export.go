@@ -21,6 +21,10 @@ import (
 // TODO: find a better name, naming is hard..
 // TODO: Ensure the method is not empty. We need to be paranoid we're not calling methods on transfer messages.
 func MakeTypedExport(actor exec.ExecutableActor, method string) exec.ExportedFunc {
+	if dispatcher, ok := actor.(exec.Dispatcher); ok {
+		return makeDispatchedExport(actor, dispatcher, method)
+	}
+
 	f, ok := reflect.TypeOf(actor).MethodByName(strings.Title(method))
 	if !ok {
 		panic(fmt.Sprintf("MakeTypedExport could not find passed in method in actor: %s", method))
@@ -35,13 +39,15 @@ func MakeTypedExport(actor exec.ExecutableActor, method string) exec.ExportedFun
 	val := f.Func
 	t := f.Type
 
+	schema := signature.Schema()
+
 	badImpl := func() {
 		params := []string{"exec.VMContext"}
-		for _, p := range signature.Params {
+		for _, p := range schema.Params {
 			params = append(params, p.String())
 		}
 		ret := []string{}
-		for _, r := range signature.Return {
+		for _, r := range schema.Return {
 			ret = append(ret, r.String())
 		}
 		ret = append(ret, "uint8", "error")
@@ -77,7 +83,7 @@ func MakeTypedExport(actor exec.ExecutableActor, method string) exec.ExportedFun
 	}
 
 	return func(ctx exec.VMContext) ([]byte, uint8, error) {
-		params, err := abi.DecodeValues(ctx.Message().Params, signature.Params)
+		params, err := abi.DecodeSchemaValues(ctx.Message().Params, schema.Params)
 		if err != nil {
 			return nil, 1, errors.RevertErrorWrap(err, "invalid params")
 		}
@@ -87,7 +93,12 @@ func MakeTypedExport(actor exec.ExecutableActor, method string) exec.ExportedFun
 			reflect.ValueOf(ctx),
 		}
 
-		for _, param := range params {
+		for i, param := range params {
+			if param.Val == nil {
+				// missing optionals
+				args = append(args, reflect.Zero(t.In(i+2)))
+				continue
+			}
 			args = append(args, reflect.ValueOf(param.Val))
 		}
 
@@ -112,7 +123,49 @@ func MakeTypedExport(actor exec.ExecutableActor, method string) exec.ExportedFun
 		for _, vv := range out[:len(out)-2] {
 			vals = append(vals, vv.Interface())
 		}
-		retVal, err := abi.ToEncodedValues(vals...)
+		retVal, err := abi.EncodeSchemaValues(schema.Return, vals)
+		if err != nil {
+			return nil, 1, errors.FaultErrorWrap(err, "failed to marshal output value")
+		}
+
+		return retVal, exitCode, nil
+	}
+}
+
+// makeDispatchedExport wraps the dispatch of a method of an actor whose
+// methods are not Go methods such that it takes care of serialization and
+// type checks.
+func makeDispatchedExport(actor exec.ExecutableActor, dispatcher exec.Dispatcher, method string) exec.ExportedFunc {
+	signature, ok := actor.Exports()[method]
+	if !ok {
+		panic(fmt.Sprintf("MakeTypedExport could not find passed in method in exports: %s", method))
+	}
+
+	schema := signature.Schema()
+
+	return func(ctx exec.VMContext) ([]byte, uint8, error) {
+		params, err := abi.DecodeSchemaValues(ctx.Message().Params, schema.Params)
+		if err != nil {
+			return nil, 1, errors.RevertErrorWrap(err, "invalid params")
+		}
+
+		args := make([]interface{}, 0, len(params))
+		for _, param := range params {
+			args = append(args, param.Val)
+		}
+
+		out, exitCode, err := dispatcher.Dispatch(ctx, method, args)
+		if err != nil {
+			if !(errors.ShouldRevert(err) || errors.IsFault(err)) {
+				return nil, 1, errors.FaultErrorWrapf(err, "dispatch of %s returned an error neither a revert error nor a fault", method)
+			}
+			return nil, exitCode, err
+		}
+		if len(out) != len(schema.Return) {
+			return nil, 1, errors.NewFaultErrorf("dispatch of %s returned %d values, expected %d", method, len(out), len(schema.Return))
+		}
+
+		retVal, err := abi.EncodeSchemaValues(schema.Return, out)
 		if err != nil {
 			return nil, 1, errors.FaultErrorWrap(err, "failed to marshal output value")
 		}
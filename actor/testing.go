@@ -42,6 +42,10 @@ var FakeActorExports = exec.Exports{
 		Params: nil,
 		Return: nil,
 	},
+	"changeState": &exec.FunctionSignature{
+		Params: nil,
+		Return: nil,
+	},
 	"nonZeroExitCode": &exec.FunctionSignature{
 		Params: nil,
 		Return: nil,
@@ -145,6 +149,20 @@ func (ma *FakeActor) GoodCall(ctx exec.VMContext) (uint8, error) {
 	return 0, nil
 }
 
+// ChangeState sets a bit inside fakeActor's storage, returning the errors of
+// reading and writing it.
+func (ma *FakeActor) ChangeState(ctx exec.VMContext) (uint8, error) {
+	fastore := &FakeActorStorage{}
+	_, err := WithState(ctx, fastore, func() (interface{}, error) {
+		fastore.Changed = true
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+	return 0, nil
+}
+
 // NonZeroExitCode returns a nonzero exit code but no error.
 func (ma *FakeActor) NonZeroExitCode(ctx exec.VMContext) (uint8, error) {
 	return 42, nil
@@ -1,42 +1,283 @@
 package chain
 
 import (
+	"container/list"
+	"encoding/json"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/repo"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
-// badTipSetCache keeps track of bad tipsets that the syncer should not try to
+// DefaultBadTipSetCacheSize is the number of bad tipsets the syncer remembers.
+const DefaultBadTipSetCacheSize = 2048
+
+// MaxPeerFaults is the number of bad chains a peer may send before the
+// SyncManager ignores the tipsets it announces.
+const MaxPeerFaults = 3
+
+// MaxBadDescendants is the number of tipsets descending from a bad tipset
+// the cache records, the most recent ones, so that a long bad chain does not
+// evict the other entries.
+const MaxBadDescendants = 64
+
+var badTipSetsKey = datastore.NewKey("/chain/badTipSets")
+
+// BadTipSet is a tipset the syncer rejected.
+type BadTipSet struct {
+	Key types.SortedCidSet
+	// Reason is the reason the tipset was rejected.
+	Reason string
+	// Root is the bad tipset this tipset descends from, empty if the tipset
+	// is itself bad. A peer sending a bad chain is at fault once.
+	Root types.SortedCidSet
+	// Peers are the peers which sent the tipset, or a chain containing it.
+	Peers []string
+	Time  time.Time
+}
+
+// BadTipSetCache keeps track of bad tipsets that the syncer should not try to
 // download. Readers and writers grab a lock. The purpose of this cache is to
 // prevent a node from having to repeatedly invalidate a block (and its children)
-// in the event that the tipset does not conform to the rules of consensus. Note
-// that the cache is only in-memory, so it is reset whenever the node is restarted.
-// TODO: this needs to be limited.
-type badTipSetCache struct {
-	mu  sync.Mutex
-	bad map[string]struct{}
+// in the event that the tipset does not conform to the rules of consensus.
+// The cache holds a bounded number of tipsets, evicting the least recently
+// seen, and is persisted to the chain datastore, one key per tipset, so it
+// survives restarts.
+// A tipset wrongly recorded as bad, e.g. because of a local fault, can be
+// removed.
+type BadTipSetCache struct {
+	mu sync.Mutex
+	// ds persists the cache. It is nil for a cache only kept in memory.
+	ds       repo.Datastore
+	capacity int
+	// order holds the entries, most recently seen first.
+	order *list.List
+	// entries maps tipset keys to their element in order.
+	entries map[string]*list.Element
+}
+
+// NewBadTipSetCache returns a cache holding up to capacity tipsets, loaded
+// from and persisted to ds. A nil ds keeps the cache in memory.
+func NewBadTipSetCache(ds repo.Datastore, capacity int) (*BadTipSetCache, error) {
+	cache := &BadTipSetCache{
+		ds:       ds,
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+	if ds == nil {
+		return cache, nil
+	}
+
+	results, err := ds.Query(query.Query{Prefix: badTipSetsKey.String()})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query bad tipsets")
+	}
+	var stored []*BadTipSet
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return nil, errors.Wrap(entry.Error, "failed to read bad tipsets")
+		}
+		var bad BadTipSet
+		if err := json.Unmarshal(entry.Value, &bad); err != nil {
+			return nil, errors.Wrap(err, "failed to decode bad tipsets")
+		}
+		stored = append(stored, &bad)
+	}
+
+	// The most recently added tipsets are kept first.
+	sort.Slice(stored, func(i, j int) bool {
+		return stored[i].Time.After(stored[j].Time)
+	})
+	for _, bad := range stored {
+		if cache.order.Len() == capacity {
+			cache.remove(bad.Key.String())
+			continue
+		}
+		cache.entries[bad.Key.String()] = cache.order.PushBack(bad)
+	}
+	return cache, nil
 }
 
-// AddChain adds the chain of tipsets to the badTipSetCache.  For now it just
-// does the simplest thing and adds all blocks of the chain to the cache.
-// TODO: might want to cache a random subset once cache size is limited.
-func (cache *badTipSetCache) AddChain(chain []types.TipSet) {
-	for _, ts := range chain {
-		cache.Add(ts.String())
+// AddChain adds a tipset to the cache with the reason it is bad, and the
+// tipsets descending from it, ordered by height, attributed to peer if not
+// empty. Only the last MaxBadDescendants descendants are recorded. The chain
+// counts as a single fault of the peer.
+func (cache *BadTipSetCache) AddChain(key types.SortedCidSet, reason string, descendants []types.TipSet, peer string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if len(descendants) > MaxBadDescendants {
+		descendants = descendants[len(descendants)-MaxBadDescendants:]
+	}
+	cache.add(key, reason, types.SortedCidSet{}, peer)
+	for _, ts := range descendants {
+		cache.add(ts.ToSortedCidSet(), "descends from bad tipset "+key.String(), key, peer)
 	}
 }
 
-// Add adds a single tipset key to the badTipSetCache.
-func (cache *badTipSetCache) Add(tsKey string) {
+// Add adds a single tipset to the cache with the reason it is bad,
+// attributed to peer if not empty.
+func (cache *BadTipSetCache) Add(key types.SortedCidSet, reason string, peer string) {
+	cache.AddChain(key, reason, nil, peer)
+}
+
+// AddPeer attributes a tipset of the cache to peer, which sent it again.
+func (cache *BadTipSetCache) AddPeer(tsKey string, peer string) {
 	cache.mu.Lock()
 	defer cache.mu.Unlock()
-	cache.bad[tsKey] = struct{}{}
+	elem, ok := cache.entries[tsKey]
+	if !ok || peer == "" {
+		return
+	}
+	bad := elem.Value.(*BadTipSet)
+	if !containsString(bad.Peers, peer) {
+		bad.Peers = append(bad.Peers, peer)
+		cache.persist(bad)
+	}
 }
 
-// Has checks for membership in the badTipSetCache.
-func (cache *badTipSetCache) Has(tsKey string) bool {
+// Has checks for membership in the cache.
+func (cache *BadTipSetCache) Has(tsKey string) bool {
 	cache.mu.Lock()
 	defer cache.mu.Unlock()
-	_, ok := cache.bad[tsKey]
+	elem, ok := cache.entries[tsKey]
+	if ok {
+		cache.order.MoveToFront(elem)
+	}
 	return ok
 }
+
+// List returns the tipsets of the cache, most recently seen first.
+func (cache *BadTipSetCache) List() []BadTipSet {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	var out []BadTipSet
+	for elem := cache.order.Front(); elem != nil; elem = elem.Next() {
+		bad := *elem.Value.(*BadTipSet)
+		bad.Peers = append([]string{}, bad.Peers...)
+		out = append(out, bad)
+	}
+	return out
+}
+
+// Remove removes a tipset from the cache and reports whether it was there.
+func (cache *BadTipSetCache) Remove(key types.SortedCidSet) bool {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	elem, ok := cache.entries[key.String()]
+	if !ok {
+		return false
+	}
+	cache.order.Remove(elem)
+	cache.remove(key.String())
+	return true
+}
+
+// Clear removes all the tipsets from the cache and returns their number.
+func (cache *BadTipSetCache) Clear() int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	n := cache.order.Len()
+	for tsKey := range cache.entries {
+		cache.remove(tsKey)
+	}
+	cache.order.Init()
+	return n
+}
+
+// PeerFaults returns the number of bad chains of the cache sent by peer.
+// Tipsets descending from the same bad tipset are one chain.
+func (cache *BadTipSetCache) PeerFaults(peer string) int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	roots := make(map[string]struct{})
+	for elem := cache.order.Front(); elem != nil; elem = elem.Next() {
+		bad := elem.Value.(*BadTipSet)
+		if !containsString(bad.Peers, peer) {
+			continue
+		}
+		root := bad.Root
+		if root.Empty() {
+			root = bad.Key
+		}
+		roots[root.String()] = struct{}{}
+	}
+	return len(roots)
+}
+
+// add adds or updates an entry, evicting the least recently seen one when
+// the cache is full.
+// Precondition: the caller holds cache.mu.
+func (cache *BadTipSetCache) add(key types.SortedCidSet, reason string, root types.SortedCidSet, peer string) {
+	if elem, ok := cache.entries[key.String()]; ok {
+		bad := elem.Value.(*BadTipSet)
+		if peer != "" && !containsString(bad.Peers, peer) {
+			bad.Peers = append(bad.Peers, peer)
+			cache.persist(bad)
+		}
+		cache.order.MoveToFront(elem)
+		return
+	}
+
+	if cache.order.Len() >= cache.capacity {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		cache.remove(oldest.Value.(*BadTipSet).Key.String())
+	}
+	bad := &BadTipSet{
+		Key:    key,
+		Reason: reason,
+		Root:   root,
+		Time:   time.Now(),
+	}
+	if peer != "" {
+		bad.Peers = []string{peer}
+	}
+	cache.entries[key.String()] = cache.order.PushFront(bad)
+	cache.persist(bad)
+}
+
+// remove deletes the entry of a tipset from the index and the datastore,
+// the caller removing it from order.
+// Precondition: the caller holds cache.mu.
+func (cache *BadTipSetCache) remove(tsKey string) {
+	delete(cache.entries, tsKey)
+	if cache.ds == nil {
+		return
+	}
+	if err := cache.ds.Delete(badTipSetsKey.ChildString(tsKey)); err != nil {
+		logSyncer.Errorf("failed to delete bad tipset %s: %s", tsKey, err)
+	}
+}
+
+// persist writes an entry to the datastore. A failure is logged, the cache
+// staying usable in memory.
+// Precondition: the caller holds cache.mu.
+func (cache *BadTipSetCache) persist(bad *BadTipSet) {
+	if cache.ds == nil {
+		return
+	}
+	bb, err := json.Marshal(bad)
+	if err == nil {
+		err = cache.ds.Put(badTipSetsKey.ChildString(bad.Key.String()), bb)
+	}
+	if err != nil {
+		logSyncer.Errorf("failed to persist bad tipset %s: %s", bad.Key.String(), err)
+	}
+}
+
+func containsString(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
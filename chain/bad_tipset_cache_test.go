@@ -0,0 +1,134 @@
+package chain_test
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-datastore/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/repo"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestBadTipSetCache(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	newCid := types.NewCidForTestGetter()
+	newTipSet := func() types.TipSet {
+		return th.RequireNewTipSet(require, &types.Block{StateRoot: newCid()})
+	}
+
+	t.Run("evicts the least recently seen tipset", func(t *testing.T) {
+		cache, err := chain.NewBadTipSetCache(nil, 2)
+		require.NoError(err)
+
+		k1, k2, k3 := newTipSet().ToSortedCidSet(), newTipSet().ToSortedCidSet(), newTipSet().ToSortedCidSet()
+		cache.Add(k1, "bad", "")
+		cache.Add(k2, "bad", "")
+		assert.True(cache.Has(k1.String()))
+		cache.Add(k3, "bad", "")
+
+		assert.True(cache.Has(k1.String()))
+		assert.False(cache.Has(k2.String()))
+		assert.True(cache.Has(k3.String()))
+	})
+
+	t.Run("records reasons and peers", func(t *testing.T) {
+		cache, err := chain.NewBadTipSetCache(nil, chain.DefaultBadTipSetCacheSize)
+		require.NoError(err)
+
+		ts1, ts2, ts3 := newTipSet(), newTipSet(), newTipSet()
+		cache.AddChain(ts1.ToSortedCidSet(), "invalid state root", []types.TipSet{ts2, ts3}, "peer1")
+		cache.AddPeer(ts1.String(), "peer2")
+
+		bad := cache.List()
+		require.Len(bad, 3)
+		assert.Equal(ts3.ToSortedCidSet(), bad[0].Key)
+		assert.Equal("descends from bad tipset "+ts1.String(), bad[0].Reason)
+		assert.Equal(ts1.ToSortedCidSet(), bad[0].Root)
+		assert.Equal([]string{"peer1"}, bad[0].Peers)
+		assert.Equal("invalid state root", bad[2].Reason)
+		assert.True(bad[2].Root.Empty())
+		assert.Equal([]string{"peer1", "peer2"}, bad[2].Peers)
+
+		// A bad chain is a single fault, however long.
+		assert.Equal(1, cache.PeerFaults("peer1"))
+		assert.Equal(1, cache.PeerFaults("peer2"))
+		assert.Equal(0, cache.PeerFaults("peer3"))
+
+		cache.Add(newTipSet().ToSortedCidSet(), "invalid ticket", "peer1")
+		assert.Equal(2, cache.PeerFaults("peer1"))
+	})
+
+	t.Run("persists to the datastore", func(t *testing.T) {
+		ds := repo.NewInMemoryRepo().ChainDatastore()
+		cache, err := chain.NewBadTipSetCache(ds, chain.DefaultBadTipSetCacheSize)
+		require.NoError(err)
+
+		k1, k2 := newTipSet().ToSortedCidSet(), newTipSet().ToSortedCidSet()
+		cache.Add(k1, "bad", "peer1")
+		cache.Add(k2, "bad", "")
+		assert.True(cache.Remove(k2))
+		assert.False(cache.Remove(k2))
+
+		reloaded, err := chain.NewBadTipSetCache(ds, chain.DefaultBadTipSetCacheSize)
+		require.NoError(err)
+		assert.True(reloaded.Has(k1.String()))
+		assert.False(reloaded.Has(k2.String()))
+		assert.Equal(cache.List()[0].Peers, reloaded.List()[0].Peers)
+
+		assert.Equal(1, reloaded.Clear())
+		reloaded, err = chain.NewBadTipSetCache(ds, chain.DefaultBadTipSetCacheSize)
+		require.NoError(err)
+		assert.Empty(reloaded.List())
+	})
+
+	t.Run("persists one entry per tipset", func(t *testing.T) {
+		ds := repo.NewInMemoryRepo().ChainDatastore()
+		cache, err := chain.NewBadTipSetCache(ds, 2)
+		require.NoError(err)
+
+		k1, k2, k3 := newTipSet().ToSortedCidSet(), newTipSet().ToSortedCidSet(), newTipSet().ToSortedCidSet()
+		cache.Add(k1, "bad", "")
+		cache.Add(k2, "bad", "")
+		cache.Add(k3, "bad", "")
+
+		results, err := ds.Query(query.Query{Prefix: "/chain/badTipSets", KeysOnly: true})
+		require.NoError(err)
+		entries, err := results.Rest()
+		require.NoError(err)
+		assert.Len(entries, 2)
+
+		reloaded, err := chain.NewBadTipSetCache(ds, 2)
+		require.NoError(err)
+		assert.False(reloaded.Has(k1.String()))
+		assert.True(reloaded.Has(k2.String()))
+		assert.True(reloaded.Has(k3.String()))
+	})
+
+	t.Run("records the last descendants of a long chain", func(t *testing.T) {
+		cache, err := chain.NewBadTipSetCache(nil, chain.DefaultBadTipSetCacheSize)
+		require.NoError(err)
+
+		other := newTipSet().ToSortedCidSet()
+		cache.Add(other, "bad", "")
+
+		root := newTipSet()
+		var descendants []types.TipSet
+		for i := 0; i < chain.MaxBadDescendants+10; i++ {
+			descendants = append(descendants, newTipSet())
+		}
+		cache.AddChain(root.ToSortedCidSet(), "bad", descendants, "peer1")
+
+		assert.Len(cache.List(), chain.MaxBadDescendants+2)
+		assert.True(cache.Has(other.String()))
+		assert.True(cache.Has(root.String()))
+		assert.False(cache.Has(descendants[0].String()))
+		assert.True(cache.Has(descendants[len(descendants)-1].String()))
+	})
+}
@@ -0,0 +1,96 @@
+package chain
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// ErrChainMissesCheckpoint is returned when a chain does not include a
+// checkpoint at its height.
+var ErrChainMissesCheckpoint = errors.New("chain does not include a checkpoint")
+
+// Checkpoint is a tipset trusted to be in the chain. The syncer rejects the
+// chains which do not include it.
+type Checkpoint struct {
+	Height uint64
+	Key    types.SortedCidSet
+}
+
+// Checkpoints is the set of checkpoints of a syncer. It is safe for
+// concurrent use.
+type Checkpoints struct {
+	mu sync.Mutex
+	// byHeight maps heights to the key of the checkpoint at that height.
+	byHeight map[uint64]types.SortedCidSet
+}
+
+func newCheckpoints() *Checkpoints {
+	return &Checkpoints{byHeight: make(map[uint64]types.SortedCidSet)}
+}
+
+// NewCheckpoints returns a set holding the given checkpoints.
+func NewCheckpoints(cps ...Checkpoint) (*Checkpoints, error) {
+	set := newCheckpoints()
+	for _, cp := range cps {
+		if err := set.Add(cp); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
+// Add adds a checkpoint. It errors if another checkpoint is at the same
+// height.
+func (set *Checkpoints) Add(cp Checkpoint) error {
+	if cp.Key.Empty() {
+		return errors.New("checkpoint has no blocks")
+	}
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	if key, ok := set.byHeight[cp.Height]; ok && !key.Equals(cp.Key) {
+		return fmt.Errorf("checkpoint %s already at height %d", key.String(), cp.Height)
+	}
+	set.byHeight[cp.Height] = cp.Key
+	return nil
+}
+
+// List returns the checkpoints, lowest first.
+func (set *Checkpoints) List() []Checkpoint {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	var cps []Checkpoint
+	for h, key := range set.byHeight {
+		cps = append(cps, Checkpoint{Height: h, Key: key})
+	}
+	sort.Slice(cps, func(i, j int) bool { return cps[i].Height < cps[j].Height })
+	return cps
+}
+
+// CheckTipSet errors if a checkpoint is at the height of the tipset with the
+// given key but has a different key.
+func (set *Checkpoints) CheckTipSet(key types.SortedCidSet, height uint64) error {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	if cpKey, ok := set.byHeight[height]; ok && !cpKey.Equals(key) {
+		return errors.Wrapf(ErrChainMissesCheckpoint, "tipset %s instead of %s at height %d", key.String(), cpKey.String(), height)
+	}
+	return nil
+}
+
+// CheckLink errors if a checkpoint is between a tipset at the given height
+// and its child at childHeight, i.e. in the null rounds between them.
+func (set *Checkpoints) CheckLink(height, childHeight uint64) error {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	for h, cpKey := range set.byHeight {
+		if h > height && h < childHeight {
+			return errors.Wrapf(ErrChainMissesCheckpoint, "null round instead of %s at height %d", cpKey.String(), h)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package chain_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestCheckpoints(t *testing.T) {
+	t.Parallel()
+
+	key1 := types.NewSortedCidSet(types.SomeCid())
+	key2 := types.NewSortedCidSet((&types.Block{Nonce: 2}).Cid())
+
+	t.Run("lists checkpoints lowest first", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		cps, err := chain.NewCheckpoints(chain.Checkpoint{Height: 10, Key: key2}, chain.Checkpoint{Height: 5, Key: key1})
+		require.NoError(err)
+		assert.Equal([]chain.Checkpoint{{Height: 5, Key: key1}, {Height: 10, Key: key2}}, cps.List())
+	})
+
+	t.Run("rejects conflicting and empty checkpoints", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		cps, err := chain.NewCheckpoints(chain.Checkpoint{Height: 5, Key: key1})
+		require.NoError(err)
+		assert.NoError(cps.Add(chain.Checkpoint{Height: 5, Key: key1}))
+		assert.Error(cps.Add(chain.Checkpoint{Height: 5, Key: key2}))
+		assert.Error(cps.Add(chain.Checkpoint{Height: 6}))
+		assert.Len(cps.List(), 1)
+	})
+
+	t.Run("checks tipsets and null rounds", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		cps, err := chain.NewCheckpoints(chain.Checkpoint{Height: 5, Key: key1})
+		require.NoError(err)
+
+		assert.NoError(cps.CheckTipSet(key1, 5))
+		assert.NoError(cps.CheckTipSet(key2, 4))
+		assert.Equal(chain.ErrChainMissesCheckpoint, errors.Cause(cps.CheckTipSet(key2, 5)))
+
+		assert.NoError(cps.CheckLink(4, 5))
+		assert.NoError(cps.CheckLink(5, 7))
+		assert.Equal(chain.ErrChainMissesCheckpoint, errors.Cause(cps.CheckLink(4, 6)))
+	})
+}
@@ -59,8 +59,16 @@ type DefaultStore struct {
 
 	// Tracks tipsets by height/parentset for use by expected consensus.
 	tipIndex *TipIndex
+
+	// finalityDepth is the number of rounds back from the head beyond which
+	// the store refuses reorgs. Zero allows reorgs of any depth.
+	finalityDepth uint64
 }
 
+// ErrReorgBeyondFinality is returned when setting a head which would revert
+// tipsets more than the finality depth back from the current head.
+var ErrReorgBeyondFinality = errors.New("reorg deeper than the finality depth")
+
 // Ensure DefaultStore satisfies the Store interface at compile time.
 var _ Store = (*DefaultStore)(nil)
 
@@ -297,7 +305,17 @@ func (store *DefaultStore) HeadEvents() *pubsub.PubSub {
 	return store.headEvents
 }
 
-// SetHead sets the passed in tipset as the new head of this chain.
+// SetFinalityDepth sets the number of rounds back from the head beyond which
+// SetHead refuses reorgs. Zero allows reorgs of any depth.
+func (store *DefaultStore) SetFinalityDepth(depth uint64) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.finalityDepth = depth
+}
+
+// SetHead sets the passed in tipset as the new head of this chain. It errors
+// with ErrReorgBeyondFinality if the most recent common ancestor of the
+// current head and the tipset is more than the finality depth back.
 func (store *DefaultStore) SetHead(ctx context.Context, ts types.TipSet) error {
 	logStore.Debugf("SetHead %s", ts.String())
 
@@ -307,6 +325,19 @@ func (store *DefaultStore) SetHead(ctx context.Context, ts types.TipSet) error {
 		logStore.Error(debug.Stack())
 	}
 
+	store.mu.RLock()
+	head, finality := store.head, store.finalityDepth
+	store.mu.RUnlock()
+	if finality > 0 && len(head) > 0 {
+		depth, err := store.reorgDepth(ctx, head, ts, finality)
+		if err != nil {
+			return err
+		}
+		if depth > finality {
+			return errors.Wrapf(ErrReorgBeyondFinality, "new head %s forks more than %d rounds back", ts.String(), finality)
+		}
+	}
+
 	if err := store.setHeadPersistent(ctx, ts); err != nil {
 		return err
 	}
@@ -317,6 +348,67 @@ func (store *DefaultStore) SetHead(ctx context.Context, ts types.TipSet) error {
 	return nil
 }
 
+// reorgDepth returns the number of rounds between the head and the most recent
+// common ancestor of the head and ts, or a number greater than limit if the
+// ancestor is more than limit rounds back.
+func (store *DefaultStore) reorgDepth(ctx context.Context, head, ts types.TipSet, limit uint64) (uint64, error) {
+	headHeight, err := head.Height()
+	if err != nil {
+		return 0, err
+	}
+	oldTs, newTs := head, ts
+	for !oldTs.Equals(newTs) {
+		oldHeight, err := oldTs.Height()
+		if err != nil {
+			return 0, err
+		}
+		newHeight, err := newTs.Height()
+		if err != nil {
+			return 0, err
+		}
+
+		// Step back the highest of the two, or both if at the same height.
+		if newHeight >= oldHeight {
+			if newTs, err = store.parentOf(ctx, newTs); err != nil {
+				return 0, err
+			}
+		}
+		if oldHeight >= newHeight {
+			if headHeight-oldHeight >= limit {
+				return limit + 1, nil
+			}
+			if oldTs, err = store.parentOf(ctx, oldTs); err != nil {
+				return 0, err
+			}
+		}
+		if oldTs == nil || newTs == nil {
+			// The chains share no tipset, not even the genesis.
+			return limit + 1, nil
+		}
+	}
+	ancestorHeight, err := oldTs.Height()
+	if err != nil {
+		return 0, err
+	}
+	return headHeight - ancestorHeight, nil
+}
+
+// parentOf returns the parent of a tipset, or nil for the genesis.
+func (store *DefaultStore) parentOf(ctx context.Context, ts types.TipSet) (types.TipSet, error) {
+	parents, err := ts.Parents()
+	if err != nil {
+		return nil, err
+	}
+	if parents.Empty() {
+		return nil, nil
+	}
+	tsas, err := store.GetTipSetAndState(ctx, parents.String())
+	if err != nil {
+		return nil, err
+	}
+	return tsas.TipSet, nil
+}
+
 func (store *DefaultStore) setHeadPersistent(ctx context.Context, ts types.TipSet) error {
 	store.mu.Lock()
 	defer store.mu.Unlock()
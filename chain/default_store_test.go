@@ -11,6 +11,7 @@ import (
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-hamt-ipld"
 	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/pkg/errors"
 
 	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/consensus"
@@ -294,6 +295,33 @@ func TestHead(t *testing.T) {
 	assert.Equal(genTS, chain.Head())
 }
 
+// SetHead refuses reorgs deeper than the finality depth.
+func TestSetHeadFinality(t *testing.T) {
+	ctx := context.Background()
+	initStoreTest(ctx, require.New(t))
+	require := require.New(t)
+	assert := assert.New(t)
+	chainStore := chain.NewDefaultStore(repo.NewInMemoryRepo().Datastore(), hamt.NewCborStore(), genCid)
+	requirePutTestChain(require, chainStore)
+	chainStore.SetFinalityDepth(2)
+
+	assertSetHead(assert, chainStore, genTS)
+	assertSetHead(assert, chainStore, link4)
+
+	// link2 is two rounds back from link4.
+	assertSetHead(assert, chainStore, link2)
+	assert.Equal(link2, chainStore.Head())
+
+	assertSetHead(assert, chainStore, link4)
+	err := chainStore.SetHead(ctx, link1)
+	assert.Equal(chain.ErrReorgBeyondFinality, errors.Cause(err))
+	assert.Equal(link4, chainStore.Head())
+
+	// Zero allows reorgs of any depth.
+	chainStore.SetFinalityDepth(0)
+	assertSetHead(assert, chainStore, genTS)
+}
+
 // LatestState correctly returns the state of the head.
 func TestLatestState(t *testing.T) {
 	ctx := context.Background()
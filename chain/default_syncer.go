@@ -27,14 +27,44 @@ var (
 	ErrNewChainTooLong = errors.New("input chain forked from best chain too far in the past")
 	// ErrUnexpectedStoreState indicates that the syncer's chain store is violating expected invariants.
 	ErrUnexpectedStoreState = errors.New("the chain store is in an unexpected state")
+	// ErrInvalidBlocks is returned when the blocks of a tipset are malformed or do not form a tipset.
+	ErrInvalidBlocks = errors.New("invalid tipset blocks")
+	// ErrBlocksUnavailable is returned when the blocks of a tipset could not be fetched from the network.
+	ErrBlocksUnavailable = errors.New("tipset blocks unavailable")
 )
 
+// IsPeerFault returns true if err was returned by HandleNewTipset for a
+// tipset whose chain is invalid or whose blocks could not be fetched, which
+// is the fault of the peer it came from. Other errors, like a cancelled sync
+// or store faults, say nothing of the peer.
+func IsPeerFault(err error) bool {
+	if consensus.IsInvalidTipSet(err) {
+		return true
+	}
+	switch errors.Cause(err) {
+	case ErrChainHasBadTipSet, ErrChainMissesCheckpoint, ErrInvalidBlocks, ErrBlocksUnavailable:
+		return true
+	}
+	return false
+}
+
 var logSyncer = logging.Logger("chain.syncer")
 
 type syncFetcher interface {
 	GetBlocks(context.Context, []cid.Cid) ([]*types.Block, error)
 }
 
+// tipSetFetcher is implemented by fetchers able to fetch a range of tipsets
+// in one request.  When its fetcher implements it, the syncer prefers it to
+// resolving the blocks of tipsets one at a time.
+type tipSetFetcher interface {
+	FetchTipSets(ctx context.Context, key types.SortedCidSet, count uint64) ([]types.TipSet, error)
+}
+
+// The maximum number of tipsets the syncer requests at once from a
+// tipSetFetcher.
+var tipSetBatchSize = uint64(100)
+
 // DefaultSyncer updates its chain.Store according to the methods of its
 // consensus.Protocol.  It uses a bad tipset cache and a limit on new
 // blocks to traverse during chain collection.  The DefaultSyncer can query the
@@ -49,9 +79,10 @@ type syncFetcher interface {
 // tipset in the incoming chain, and assumptions regarding the existence of
 // grandparent state in the store.
 type DefaultSyncer struct {
-	// This mutex ensures at most one call to HandleNewTipset executes at
-	// any time.  This is important because at least two sections of the
-	// code otherwise have races:
+	// This mutex ensures at most one call to HandleNewTipset validates a
+	// chain at any time, while fetching chains runs concurrently.  This is
+	// important because at least two sections of the code otherwise have
+	// races:
 	// 1. syncOne assumes that chainStore.Head() does not change when
 	// comparing tipset weights and updating the store
 	// 2. HandleNewTipset assumes that calls to widen and then syncOne
@@ -64,27 +95,59 @@ type DefaultSyncer struct {
 	// stateStore is the cborStore used for reading and writing state root
 	// to ipld object mappings.
 	stateStore *hamt.CborIpldStore
-	// badTipSetCache is used to filter out collections of invalid blocks.
-	badTipSets *badTipSetCache
+	// badTipSets is used to filter out collections of invalid blocks.
+	badTipSets *BadTipSetCache
 	consensus  consensus.Protocol
 	chainStore Store
+	// status records the progress of syncs for reporting.
+	status *syncTracker
+	// checkpoints are the tipsets the chains synced must include.
+	checkpoints *Checkpoints
+	// fetchLk protects fetches, the fetches of tipset blocks in progress by
+	// tipset key, which concurrent syncs share.
+	fetchLk sync.Mutex
+	fetches map[string]*inflightFetch
+}
+
+// inflightFetch is a fetch of the blocks of a tipset in progress.
+type inflightFetch struct {
+	done chan struct{}
+	blks []*types.Block
+	err  error
 }
 
 var _ Syncer = (*DefaultSyncer)(nil)
 
-// NewDefaultSyncer constructs a DefaultSyncer ready for use.
-func NewDefaultSyncer(cst *hamt.CborIpldStore, c consensus.Protocol, s Store, f syncFetcher) *DefaultSyncer {
+// NewDefaultSyncer constructs a DefaultSyncer ready for use, remembering
+// the tipsets it rejects in bad.
+func NewDefaultSyncer(cst *hamt.CborIpldStore, c consensus.Protocol, s Store, f syncFetcher, bad *BadTipSetCache) *DefaultSyncer {
 	return &DefaultSyncer{
-		fetcher:    f,
-		stateStore: cst,
-		badTipSets: &badTipSetCache{
-			bad: make(map[string]struct{}),
-		},
-		consensus:  c,
-		chainStore: s,
+		fetcher:     f,
+		stateStore:  cst,
+		badTipSets:  bad,
+		consensus:   c,
+		chainStore:  s,
+		status:      &syncTracker{},
+		checkpoints: newCheckpoints(),
+		fetches:     make(map[string]*inflightFetch),
 	}
 }
 
+// Checkpoints returns the checkpoints the chains synced must include.
+func (syncer *DefaultSyncer) Checkpoints() *Checkpoints {
+	return syncer.checkpoints
+}
+
+// Status returns the status of the syncs in progress and of recent failures.
+func (syncer *DefaultSyncer) Status() SyncStatus {
+	status := syncer.status.status()
+	// The head is validated, possibly before the syncer started.
+	if h, err := syncer.chainStore.Head().Height(); err == nil && h > status.ValidatedHeight {
+		status.ValidatedHeight = h
+	}
+	return status
+}
+
 // getBlksMaybeFromNet resolves cids of blocks.  It gets blocks through the
 // fetcher.  The fetcher wraps a bitswap session which wraps a bitswap exchange,
 // and the bitswap exchange wraps the node's shared blockstore.  So if blocks
@@ -93,10 +156,106 @@ func NewDefaultSyncer(cst *hamt.CborIpldStore, c consensus.Protocol, s Store, f
 // are unavailable.  This method is all or nothing, it will error if any of the
 // blocks cannot be resolved.
 func (syncer *DefaultSyncer) getBlksMaybeFromNet(ctx context.Context, blkCids []cid.Cid) ([]*types.Block, error) {
-	ctx, cancel := context.WithTimeout(ctx, blkWaitTime)
+	fetchCtx, cancel := context.WithTimeout(ctx, blkWaitTime)
 	defer cancel()
 
-	return syncer.fetcher.GetBlocks(ctx, blkCids)
+	blks, err := syncer.fetcher.GetBlocks(fetchCtx, blkCids)
+	if err != nil && ctx.Err() == nil {
+		// The sync is still running, so nobody could serve the blocks.
+		return nil, errors.Wrapf(ErrBlocksUnavailable, "%s", err)
+	}
+	return blks, err
+}
+
+// getLocalBlks resolves the blocks with the given cids from the local
+// blockstore only.  It returns false if any of them is missing.
+func (syncer *DefaultSyncer) getLocalBlks(ctx context.Context, blkCids []cid.Cid) ([]*types.Block, bool) {
+	var blks []*types.Block
+	for _, c := range blkCids {
+		var blk types.Block
+		if err := syncer.stateStore.Get(ctx, c, &blk); err != nil {
+			return nil, false
+		}
+		blks = append(blks, &blk)
+	}
+	return blks, true
+}
+
+// batchSize returns the number of tipsets to request when fetching a tipset
+// of the given height, the gap between it and the head, at most
+// tipSetBatchSize.  An unknown height of zero requests a single tipset.
+func (syncer *DefaultSyncer) batchSize(height uint64) uint64 {
+	headHeight, err := syncer.chainStore.Head().Height()
+	if err != nil || height <= headHeight {
+		return 1
+	}
+	if gap := height - headHeight; gap < tipSetBatchSize {
+		return gap
+	}
+	return tipSetBatchSize
+}
+
+// getTipSetBlks resolves the blocks of the tipset with the given cids, whose
+// height is at most height.  It first looks for them among the prefetched
+// blocks and in the local blockstore, then requests them along with a batch
+// of ancestors down to the head if the fetcher can fetch ranges of tipsets,
+// adding the batch to prefetched.  It falls back to resolving the blocks one
+// by one with getBlksMaybeFromNet.
+func (syncer *DefaultSyncer) getTipSetBlks(ctx context.Context, tipsetCids types.SortedCidSet, height uint64, prefetched map[string][]*types.Block) ([]*types.Block, error) {
+	tsKey := tipsetCids.String()
+	if blks, ok := prefetched[tsKey]; ok {
+		delete(prefetched, tsKey)
+		return blks, nil
+	}
+	if blks, ok := syncer.getLocalBlks(ctx, tipsetCids.ToSlice()); ok {
+		return blks, nil
+	}
+
+	if tsFetcher, ok := syncer.fetcher.(tipSetFetcher); ok {
+		fetchCtx, cancel := context.WithTimeout(ctx, blkWaitTime)
+		tipSets, err := tsFetcher.FetchTipSets(fetchCtx, tipsetCids, syncer.batchSize(height))
+		cancel()
+		if err == nil {
+			for _, ts := range tipSets {
+				prefetched[ts.String()] = ts.ToSlice()
+			}
+			if blks, ok := prefetched[tsKey]; ok {
+				delete(prefetched, tsKey)
+				return blks, nil
+			}
+		}
+		logSyncer.Infof("falling back to fetching blocks of tipset %s one by one: %v", tsKey, err)
+	}
+
+	return syncer.getBlksMaybeFromNet(ctx, tipsetCids.ToSlice())
+}
+
+// fetchTipSetBlks resolves the blocks of the tipset with the given cids with
+// getTipSetBlks, waiting for the result of a fetch of the same tipset by a
+// concurrent sync rather than starting another one.
+func (syncer *DefaultSyncer) fetchTipSetBlks(ctx context.Context, tipsetCids types.SortedCidSet, height uint64, prefetched map[string][]*types.Block) ([]*types.Block, error) {
+	tsKey := tipsetCids.String()
+	syncer.fetchLk.Lock()
+	if f, ok := syncer.fetches[tsKey]; ok {
+		syncer.fetchLk.Unlock()
+		select {
+		case <-f.done:
+			return f.blks, f.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	f := &inflightFetch{done: make(chan struct{})}
+	syncer.fetches[tsKey] = f
+	syncer.fetchLk.Unlock()
+
+	f.blks, f.err = syncer.getTipSetBlks(ctx, tipsetCids, height, prefetched)
+
+	syncer.fetchLk.Lock()
+	delete(syncer.fetches, tsKey)
+	syncer.fetchLk.Unlock()
+	close(f.done)
+	return f.blks, f.err
 }
 
 // collectChain resolves the cids of the head tipset and its ancestors to
@@ -108,8 +267,14 @@ func (syncer *DefaultSyncer) getBlksMaybeFromNet(ctx context.Context, blkCids []
 // blocks that do not form a tipset, or if any tipset has already been recorded
 // as the head of an invalid chain.  collectChain is the entrypoint to the code
 // that interacts with the network. It does NOT add tipsets to the chainStore..
-func (syncer *DefaultSyncer) collectChain(ctx context.Context, tipsetCids types.SortedCidSet) ([]types.TipSet, error) {
+func (syncer *DefaultSyncer) collectChain(ctx context.Context, tipsetCids types.SortedCidSet, target *SyncTarget) ([]types.TipSet, error) {
 	var chain []types.TipSet
+	// prefetched holds the blocks of tipsets fetched ahead of the traversal,
+	// keyed by tipset key.
+	prefetched := make(map[string][]*types.Block)
+	// next is the height the next tipset has at most, starting with the
+	// height claimed for the head, zero when unknown.
+	next := target.Height
 	defer logSyncer.Info("chain synced")
 	for {
 		var blks []*types.Block
@@ -118,34 +283,59 @@ func (syncer *DefaultSyncer) collectChain(ctx context.Context, tipsetCids types.
 
 		// Finish traversal if the tipset made is tracked in the store.
 		if syncer.chainStore.HasTipSetAndState(ctx, tsKey) {
+			if err := syncer.checkBase(ctx, tsKey, chain, target); err != nil {
+				return nil, err
+			}
 			return chain, nil
 		}
 
 		logSyncer.Debugf("CollectChain next link: %s", tsKey)
 
 		if syncer.badTipSets.Has(tsKey) {
+			syncer.badTipSets.AddPeer(tsKey, target.Peer)
 			return nil, ErrChainHasBadTipSet
 		}
 
-		blks, err := syncer.getBlksMaybeFromNet(ctx, tipsetCids.ToSlice())
+		blks, err := syncer.fetchTipSetBlks(ctx, tipsetCids, next, prefetched)
 		if err != nil {
 			return nil, err
 		}
 
 		ts, err := syncer.consensus.NewValidTipSet(ctx, blks)
 		if err != nil {
-			syncer.badTipSets.Add(tsKey)
-			syncer.badTipSets.AddChain(chain)
-			return nil, err
+			syncer.badTipSets.AddChain(tipsetCids, err.Error(), chain, target.Peer)
+			return nil, errors.Wrapf(ErrInvalidBlocks, "%s", err)
 		}
 
 		height, _ := ts.Height()
+		if err := syncer.checkpoints.CheckTipSet(tipsetCids, height); err != nil {
+			syncer.badTipSets.AddChain(tipsetCids, err.Error(), chain, target.Peer)
+			return nil, err
+		}
+		if len(chain) > 0 {
+			childHeight, _ := chain[0].Height()
+			if err := syncer.checkpoints.CheckLink(height, childHeight); err != nil {
+				syncer.badTipSets.AddChain(chain[0].ToSortedCidSet(), err.Error(), chain[1:], target.Peer)
+				return nil, err
+			}
+		}
+
+		syncer.status.update(ctx, target, func(t *SyncTarget) {
+			t.Fetched++
+			if t.Fetched == 1 {
+				t.Height = height
+			}
+		})
 		if len(chain)%500 == 0 {
 			logSyncer.Infof("syncing the chain, currently at block height %d", height)
 		}
 
 		// Update values to traverse next tipset
 		chain = append([]types.TipSet{ts}, chain...)
+		next = 0
+		if height > 0 {
+			next = height - 1
+		}
 		tipsetCids, err = ts.Parents()
 		if err != nil {
 			return nil, err
@@ -153,6 +343,31 @@ func (syncer *DefaultSyncer) collectChain(ctx context.Context, tipsetCids types.
 	}
 }
 
+// checkBase checks that no checkpoint is skipped between the tipset with the
+// given key, already in the store, and the chain collected on top of it.
+func (syncer *DefaultSyncer) checkBase(ctx context.Context, baseKey string, chain []types.TipSet, target *SyncTarget) error {
+	if len(chain) == 0 {
+		return nil
+	}
+	base, err := syncer.chainStore.GetTipSetAndState(ctx, baseKey)
+	if err != nil {
+		return err
+	}
+	baseHeight, err := base.TipSet.Height()
+	if err != nil {
+		return err
+	}
+	childHeight, err := chain[0].Height()
+	if err != nil {
+		return err
+	}
+	if err := syncer.checkpoints.CheckLink(baseHeight, childHeight); err != nil {
+		syncer.badTipSets.AddChain(chain[0].ToSortedCidSet(), err.Error(), chain[1:], target.Peer)
+		return err
+	}
+	return nil
+}
+
 // tipSetState returns the state resulting from applying the input tipset to
 // the chain.  Precondition: the tipset must be in the store
 func (syncer *DefaultSyncer) tipSetState(ctx context.Context, tsKey string) (state.Tree, error) {
@@ -178,7 +393,7 @@ func (syncer *DefaultSyncer) tipSetState(ctx context.Context, tsKey string) (sta
 //
 // Precondition: the caller of syncOne must hold the syncer's lock (syncer.mu) to
 // ensure head is not modified by another goroutine during run.
-func (syncer *DefaultSyncer) syncOne(ctx context.Context, parent, next types.TipSet) error {
+func (syncer *DefaultSyncer) syncOne(ctx context.Context, parent, next types.TipSet, target *SyncTarget) error {
 	head := syncer.chainStore.Head()
 
 	// if tipset is already head, we've been here before. do nothing.
@@ -206,10 +421,12 @@ func (syncer *DefaultSyncer) syncOne(ctx context.Context, parent, next types.Tip
 
 	// Run a state transition to validate the tipset and compute
 	// a new state to add to the store.
+	syncer.status.update(ctx, target, func(t *SyncTarget) { t.Stage = SyncStageValidating })
 	st, err = syncer.consensus.RunStateTransition(ctx, next, ancestors, st)
 	if err != nil {
 		return err
 	}
+	syncer.status.update(ctx, target, func(t *SyncTarget) { t.Stage = SyncStageApplying })
 	root, err := st.Flush(ctx)
 	if err != nil {
 		return err
@@ -222,6 +439,7 @@ func (syncer *DefaultSyncer) syncOne(ctx context.Context, parent, next types.Tip
 		return err
 	}
 	logSyncer.Debugf("Successfully updated store with %s", next.String())
+	syncer.status.validated(ctx, target, h)
 
 	// TipSet is validated and added to store, now check if it is the heaviest.
 	// If it is the heaviest update the chainStore.
@@ -319,14 +537,13 @@ func (syncer *DefaultSyncer) widen(ctx context.Context, ts types.TipSet) (types.
 // represent a valid extension. It limits the length of new chains it will
 // attempt to validate and caches invalid blocks it has encountered to
 // help prevent DOS.
-func (syncer *DefaultSyncer) HandleNewTipset(ctx context.Context, tipsetCids types.SortedCidSet) error {
+func (syncer *DefaultSyncer) HandleNewTipset(ctx context.Context, tipsetCids types.SortedCidSet) (err error) {
 	logSyncer.Debugf("trying to sync %v\n", tipsetCids)
 
-	// This lock could last a long time as we fetch all the blocks needed to block the chain.
-	// This is justified because the app is pretty useless until it is synced.
-	// It's better for multiple calls to wait here than to try to fetch the chain independently.
-	syncer.mu.Lock()
-	defer syncer.mu.Unlock()
+	target := syncer.status.start(ctx, tipsetCids)
+	defer func() {
+		syncer.status.finish(ctx, target, err)
+	}()
 
 	// If the store already has all these blocks the syncer is finished.
 	if syncer.chainStore.HasAllBlocks(ctx, tipsetCids.ToSlice()) {
@@ -335,11 +552,30 @@ func (syncer *DefaultSyncer) HandleNewTipset(ctx context.Context, tipsetCids typ
 
 	// Walk the chain given by the input blocks back to a known tipset in
 	// the store. This is the only code that may go to the network to
-	// resolve cids to blocks.
-	chain, err := syncer.collectChain(ctx, tipsetCids)
+	// resolve cids to blocks. It runs concurrently with other calls, sharing
+	// the fetches of common tipsets.
+	syncer.status.update(ctx, target, func(t *SyncTarget) { t.Stage = SyncStageFetching })
+	chain, err := syncer.collectChain(ctx, tipsetCids, target)
 	if err != nil {
 		return err
 	}
+
+	// This lock could last a long time as we validate the whole chain.
+	// Validating chains one at a time keeps the head consistent, see the
+	// comment on syncer.mu.
+	syncer.status.update(ctx, target, func(t *SyncTarget) { t.Stage = SyncStageQueued })
+	syncer.mu.Lock()
+	defer syncer.mu.Unlock()
+
+	// Another call may have synced the start of the chain while this one was
+	// fetching it.
+	for len(chain) > 0 && syncer.chainStore.HasTipSetAndState(ctx, chain[0].String()) {
+		chain = chain[1:]
+	}
+	if len(chain) == 0 {
+		return nil
+	}
+
 	parentCids, err := chain[0].Parents()
 	if err != nil {
 		return err
@@ -362,19 +598,19 @@ func (syncer *DefaultSyncer) HandleNewTipset(ctx context.Context, tipsetCids typ
 			}
 			if wts != nil {
 				logSyncer.Debug("attempt to sync after widen")
-				err = syncer.syncOne(ctx, parent, wts)
+				err = syncer.syncOne(ctx, parent, wts, target)
 				if err != nil {
 					return err
 				}
 			}
 		}
-		if err = syncer.syncOne(ctx, parent, ts); err != nil {
-			// While `syncOne` can indeed fail for reasons other than consensus,
-			// adding to the badTipSets at this point is the simplest, since we
-			// have access to the chain. If syncOne fails for non-consensus reasons,
-			// there is no assumption that the running node's data is valid at all,
-			// so we don't really lose anything with this simplification.
-			syncer.badTipSets.AddChain(chain[i:])
+		if err = syncer.syncOne(ctx, parent, ts, target); err != nil {
+			// Only tipsets breaking the rules of consensus are bad. Other
+			// failures, like store errors or a cancelled sync, are local
+			// and the tipset is tried again when announced.
+			if consensus.IsInvalidTipSet(err) {
+				syncer.badTipSets.AddChain(ts.ToSortedCidSet(), err.Error(), chain[i+1:], target.Peer)
+			}
 			return err
 		}
 		parent = ts
@@ -8,6 +8,7 @@ import (
 	"github.com/ipfs/go-hamt-ipld"
 	bstore "github.com/ipfs/go-ipfs-blockstore"
 	"github.com/libp2p/go-libp2p-peer"
+	"github.com/pkg/errors"
 
 	"github.com/filecoin-project/go-filecoin/actor/builtin"
 	"github.com/filecoin-project/go-filecoin/address"
@@ -192,7 +193,7 @@ func loadSyncerFromRepo(require *require.Assertions, r repo.Repo) (*chain.Defaul
 	chainStore := chain.NewDefaultStore(chainDS, cst, calcGenBlk.Cid())
 
 	blockSource := th.NewTestFetcher()
-	syncer := chain.NewDefaultSyncer(cst, con, chainStore, blockSource) // note we use same cst for on and offline for tests
+	syncer := chain.NewDefaultSyncer(cst, con, chainStore, blockSource, requireBadTipSetCache(require)) // note we use same cst for on and offline for tests
 
 	ctx := context.Background()
 	err = chainStore.Load(ctx)
@@ -229,6 +230,17 @@ func initSyncTestWithPowerTable(require *require.Assertions, powerTable consensu
 }
 
 func initSyncTest(require *require.Assertions, con consensus.Protocol, genFunc func(cst *hamt.CborIpldStore, bs bstore.Blockstore) (*types.Block, error), cst *hamt.CborIpldStore, bs bstore.Blockstore, r repo.Repo) (*chain.DefaultSyncer, chain.Store, repo.Repo, *th.TestFetcher) {
+	fetcher := th.NewTestFetcher()
+	syncer, chainStore := initSyncTestWithFetcher(require, con, genFunc, cst, bs, r, fetcher)
+	return syncer, chainStore, r, fetcher
+}
+
+// blockFetcher is the interface of the fetchers of the syncer.
+type blockFetcher interface {
+	GetBlocks(context.Context, []cid.Cid) ([]*types.Block, error)
+}
+
+func initSyncTestWithFetcher(require *require.Assertions, con consensus.Protocol, genFunc func(cst *hamt.CborIpldStore, bs bstore.Blockstore) (*types.Block, error), cst *hamt.CborIpldStore, bs bstore.Blockstore, r repo.Repo, fetcher blockFetcher) (*chain.DefaultSyncer, chain.Store) {
 	ctx := context.Background()
 
 	calcGenBlk, err := genFunc(cst, bs) // flushes state
@@ -237,8 +249,7 @@ func initSyncTest(require *require.Assertions, con consensus.Protocol, genFunc f
 	chainDS := r.ChainDatastore()
 	chainStore := chain.NewDefaultStore(chainDS, cst, calcGenBlk.Cid())
 
-	fetcher := th.NewTestFetcher()
-	syncer := chain.NewDefaultSyncer(cst, con, chainStore, fetcher) // note we use same cst for on and offline for tests
+	syncer := chain.NewDefaultSyncer(cst, con, chainStore, fetcher, requireBadTipSetCache(require)) // note we use same cst for on and offline for tests
 
 	// Initialize stores to contain genesis block and state
 	calcGenTS := th.RequireNewTipSet(require, calcGenBlk)
@@ -253,7 +264,13 @@ func initSyncTest(require *require.Assertions, con consensus.Protocol, genFunc f
 	requireHead(require, chainStore, calcGenTS)
 	requireTsAdded(require, chainStore, calcGenTS)
 
-	return syncer, chainStore, r, fetcher
+	return syncer, chainStore
+}
+
+func requireBadTipSetCache(require *require.Assertions) *chain.BadTipSetCache {
+	cache, err := chain.NewBadTipSetCache(nil, chain.DefaultBadTipSetCacheSize)
+	require.NoError(err)
+	return cache
 }
 
 func containsTipSet(tsasSlice []*chain.TipSetAndState, ts types.TipSet) bool {
@@ -446,6 +463,139 @@ func TestSyncChainHead(t *testing.T) {
 	assertHead(assert, chainStore, link4)
 }
 
+// batchFetcher records the sizes of the batches of tipsets requested from it
+// and fails them, so that the syncer resolves blocks one by one.
+type batchFetcher struct {
+	*th.TestFetcher
+	counts []uint64
+}
+
+func (f *batchFetcher) FetchTipSets(ctx context.Context, key types.SortedCidSet, count uint64) ([]types.TipSet, error) {
+	f.counts = append(f.counts, count)
+	return nil, errors.New("no batches")
+}
+
+// Syncer resolves blocks locally before fetching batches of tipsets down to
+// its head.
+func TestSyncFetchesTipSetBatches(t *testing.T) {
+	processor := th.NewTestProcessor()
+	powerTable := &th.TestView{}
+	verifier := proofs.NewFakeVerifier(true, nil)
+
+	setup := func(require *require.Assertions) (*chain.DefaultSyncer, chain.Store, *hamt.CborIpldStore, *batchFetcher) {
+		r := repo.NewInMemoryRepo()
+		bs := bstore.NewBlockstore(r.Datastore())
+		cst := hamt.NewCborStore()
+		con := consensus.NewExpected(cst, bs, processor, powerTable, genCid, verifier)
+		requireSetTestChain(require, con, false)
+		fetcher := &batchFetcher{TestFetcher: th.NewTestFetcher()}
+		syncer, chainStore := initSyncTestWithFetcher(require, con, initGenesis, cst, bs, r, fetcher)
+		return syncer, chainStore, cst, fetcher
+	}
+
+	t.Run("batches span the gap to the head", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		syncer, chainStore, _, fetcher := setup(require)
+
+		for _, ts := range []types.TipSet{link1, link2, link3} {
+			requirePutBlocks(require, fetcher.TestFetcher, ts.ToSlice()...)
+		}
+		cids4 := requirePutBlocks(require, fetcher.TestFetcher, link4.ToSlice()...)
+		h4, err := link4.Height()
+		require.NoError(err)
+
+		ctx := chain.WithSyncSource(context.Background(), "peer", h4, 0)
+		require.NoError(syncer.HandleNewTipset(ctx, cids4))
+		assertHead(assert, chainStore, link4)
+
+		require.Len(fetcher.counts, 4)
+		assert.Equal(h4, fetcher.counts[0])
+		for i := 1; i < len(fetcher.counts); i++ {
+			assert.True(fetcher.counts[i] < fetcher.counts[i-1])
+			assert.True(fetcher.counts[i] >= 1)
+		}
+	})
+
+	t.Run("local blocks are not fetched", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		syncer, chainStore, cst, fetcher := setup(require)
+
+		ctx := context.Background()
+		for _, blk := range link1.ToSlice() {
+			require.NoError(cst.Blocks.AddBlock(blk.ToNode()))
+		}
+		require.NoError(syncer.HandleNewTipset(ctx, link1.ToSortedCidSet()))
+		assertHead(assert, chainStore, link1)
+		assert.Empty(fetcher.counts)
+	})
+}
+
+// Syncer rejects chains which do not include its checkpoints.
+func TestSyncCheckpoints(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	syncer, chainStore, _, blockSource := initSyncTestDefault(require)
+	ctx := context.Background()
+
+	_ = requirePutBlocks(require, blockSource, link1.ToSlice()...)
+	cids2 := requirePutBlocks(require, blockSource, link2.ToSlice()...)
+	_ = requirePutBlocks(require, blockSource, link3.ToSlice()...)
+	cids4 := requirePutBlocks(require, blockSource, link4.ToSlice()...)
+
+	h2, err := link2.Height()
+	require.NoError(err)
+	other := types.NewSortedCidSet(types.SomeCid())
+	require.NoError(syncer.Checkpoints().Add(chain.Checkpoint{Height: h2, Key: other}))
+
+	err = syncer.HandleNewTipset(ctx, cids4)
+	assert.Equal(chain.ErrChainMissesCheckpoint, errors.Cause(err))
+	assertHead(assert, chainStore, genTS)
+
+	syncer, chainStore, _, blockSource = initSyncTestDefault(require)
+	_ = requirePutBlocks(require, blockSource, link1.ToSlice()...)
+	_ = requirePutBlocks(require, blockSource, link2.ToSlice()...)
+	_ = requirePutBlocks(require, blockSource, link3.ToSlice()...)
+	_ = requirePutBlocks(require, blockSource, link4.ToSlice()...)
+	require.NoError(syncer.Checkpoints().Add(chain.Checkpoint{Height: h2, Key: cids2}))
+	assert.NoError(syncer.HandleNewTipset(ctx, cids4))
+	assertHead(assert, chainStore, link4)
+}
+
+// Syncer reports the progress of syncs and their failures.
+func TestSyncStatus(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	syncer, _, _, blockSource := initSyncTestDefault(require)
+	ctx := context.Background()
+
+	_ = requirePutBlocks(require, blockSource, link1.ToSlice()...)
+	cids2 := requirePutBlocks(require, blockSource, link2.ToSlice()...)
+
+	err := syncer.HandleNewTipset(chain.WithSyncSource(ctx, "peer1", 2, 0), cids2)
+	require.NoError(err)
+
+	status := syncer.Status()
+	assert.False(status.Syncing())
+	h, err := link2.Height()
+	require.NoError(err)
+	assert.Equal(h, status.ValidatedHeight)
+	assert.Empty(status.Failures)
+
+	unknown := types.NewSortedCidSet(types.SomeCid())
+	err = syncer.HandleNewTipset(chain.WithSyncSource(ctx, "peer2", 9, 0), unknown)
+	require.Error(err)
+
+	status = syncer.Status()
+	assert.False(status.Syncing())
+	require.Len(status.Failures, 1)
+	assert.Equal("peer2", status.Failures[0].Peer)
+	assert.Equal(uint64(9), status.Failures[0].Height)
+	assert.Equal(chain.SyncStageFetching, status.Failures[0].Stage)
+	assert.Equal(err.Error(), status.Failures[0].Error)
+}
+
 // Syncer determines the heavier fork.
 func TestSyncIgnoreLightFork(t *testing.T) {
 	assert := assert.New(t)
@@ -571,9 +721,29 @@ func TestBlocksNotATipSet(t *testing.T) {
 	badCids := types.NewSortedCidSet(link1blk1.Cid(), link2blk1.Cid())
 	err := syncer.HandleNewTipset(ctx, badCids)
 	assert.Error(err)
+	assert.True(chain.IsPeerFault(err))
 	assertNoAdd(assert, chainStore, badCids)
 }
 
+// Syncs fail because of the peer for unavailable blocks, not for a cancelled
+// sync.
+func TestSyncPeerFaults(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	syncer, _, _, _ := initSyncTestDefault(require)
+
+	err := syncer.HandleNewTipset(context.Background(), link1.ToSortedCidSet())
+	require.Error(err)
+	assert.True(chain.IsPeerFault(err))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = syncer.HandleNewTipset(ctx, link2.ToSortedCidSet())
+	require.Error(err)
+	assert.False(chain.IsPeerFault(err))
+	assert.False(chain.IsPeerFault(chain.ErrUnexpectedStoreState))
+}
+
 /* particularly tricky edge cases relating to subtle Expected Consensus requirements */
 
 // Syncer is capable of recovering from a fork reorg after Load.
@@ -951,7 +1121,7 @@ func TestTipSetWeightDeep(t *testing.T) {
 	// Now sync the chainStore with consensus using a MarketView.
 	verifier = proofs.NewFakeVerifier(true, nil)
 	con = consensus.NewExpected(cst, bs, th.NewTestProcessor(), &consensus.MarketView{}, calcGenBlk.Cid(), verifier)
-	syncer := chain.NewDefaultSyncer(cst, con, chainStore, blockSource)
+	syncer := chain.NewDefaultSyncer(cst, con, chainStore, blockSource, requireBadTipSetCache(require))
 	baseTS := chainStore.Head() // this is the last block of the bootstrapping chain creating miners
 	require.Equal(1, len(baseTS))
 	bootstrapStateRoot := baseTS.ToSlice()[0].StateRoot
@@ -0,0 +1,562 @@
+package events
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+var log = logging.Logger("chain.events")
+
+// MessageLookbackRounds is the number of tipsets behind the current head that
+// are searched for a message when a message watch is registered. Messages
+// included deeper than this before registration are not reported.
+const MessageLookbackRounds = 20
+
+// ErrNoCommonAncestor is returned when two heads do not share an ancestor in
+// the block provider.
+var ErrNoCommonAncestor = errors.New("heads do not share a common ancestor")
+
+// ID identifies a registered watch so that it can be cancelled.
+type ID uint64
+
+// HeightHandler is called with the first tipset at or above the watched
+// height once the head is `confidence` rounds past it.
+type HeightHandler func(ctx context.Context, ts types.TipSet, curHeight uint64) error
+
+// MsgHandler is called with a watched message and the tipset including it
+// once the head is `confidence` rounds past that tipset.
+type MsgHandler func(ctx context.Context, msg *types.SignedMessage, ts types.TipSet, curHeight uint64) error
+
+// StateChangeHandler is called with the old and new state head of a watched
+// actor and the tipset that changed it once the head is `confidence` rounds
+// past that tipset. An absent actor has a head of cid.Undef.
+type StateChangeHandler func(ctx context.Context, oldHead, newHead cid.Cid, ts types.TipSet, curHeight uint64) error
+
+// EventHandler is called with a watched event, the message whose receipt
+// has it and the tipset including the message once the head is `confidence`
+// rounds past that tipset.
+type EventHandler func(ctx context.Context, event *types.Event, msg *types.SignedMessage, ts types.TipSet, curHeight uint64) error
+
+// RevertHandler is called with a tipset for which an apply handler was called
+// when that tipset is removed from the heaviest chain by a reorg.
+type RevertHandler func(ctx context.Context, ts types.TipSet) error
+
+// GetStateTree returns the state resulting from applying a tipset.
+type GetStateTree func(ctx context.Context, ts types.TipSet) (state.Tree, error)
+
+// GetReceipts returns the receipts of the messages of a tipset by message cid.
+type GetReceipts func(ctx context.Context, ts types.TipSet) (map[cid.Cid]*types.MessageReceipt, error)
+
+// matchFunc inspects a newly applied tipset and, if the watched condition
+// holds there, returns the call to make once the tipset is deep enough.
+type matchFunc func(ctx context.Context, ts types.TipSet) (apply func(ctx context.Context, curHeight uint64) error, ok bool, err error)
+
+// occurrence is a tipset at which a watched condition held.
+type occurrence struct {
+	ts     types.TipSet
+	height uint64
+	apply  func(ctx context.Context, curHeight uint64) error
+	fired  bool
+}
+
+// watch is a registered condition and its handlers.
+type watch struct {
+	confidence uint64
+	// once watches stop matching after their first occurrence.
+	once        bool
+	match       matchFunc
+	revert      RevertHandler
+	occurrences []*occurrence
+}
+
+// Events calls registered handlers as the heaviest chain advances and
+// reverts. Handlers for a tipset are called only after the chain has grown
+// `confidence` rounds past it, and the matching revert handler is called if
+// that tipset later leaves the heaviest chain. Whether a head change reverts
+// any tipsets is decided by chain.IsReorg. A head that widens the previous
+// head does not revert the occurrences of watches that fire once, like
+// ChainAt and Called, but the other watches are reverted and applied again
+// with the wider tipset, so that TipSets handlers see its new blocks.
+//
+// Events does not subscribe to head changes itself, its owner feeds it every
+// new head through OnNewHeadTipset.
+type Events struct {
+	store        chain.BlockProvider
+	getStateTree GetStateTree
+	getReceipts  GetReceipts
+
+	lk      sync.Mutex
+	head    types.TipSet
+	nextID  ID
+	watches map[ID]*watch
+}
+
+// New returns an Events tracking a chain starting at head.
+func New(store chain.BlockProvider, getStateTree GetStateTree, getReceipts GetReceipts, head types.TipSet) *Events {
+	return &Events{
+		store:        store,
+		getStateTree: getStateTree,
+		getReceipts:  getReceipts,
+		head:         head,
+		watches:      make(map[ID]*watch),
+	}
+}
+
+// ChainAt registers handlers called when the chain reaches height h. If the
+// chain skips h because of null rounds the first tipset above it is used.
+func (e *Events) ChainAt(ctx context.Context, hnd HeightHandler, rev RevertHandler, confidence uint64, h uint64) (ID, error) {
+	match := func(ctx context.Context, ts types.TipSet) (func(context.Context, uint64) error, bool, error) {
+		height, err := ts.Height()
+		if err != nil {
+			return nil, false, err
+		}
+		if height < h {
+			return nil, false, nil
+		}
+		return func(ctx context.Context, curHeight uint64) error {
+			return hnd(ctx, ts, curHeight)
+		}, true, nil
+	}
+
+	// Search back only as far as the first tipset at or above h.
+	stop := func(ts types.TipSet, _ int) (bool, error) {
+		height, err := ts.Height()
+		if err != nil {
+			return false, err
+		}
+		return height < h, nil
+	}
+	return e.register(ctx, &watch{confidence: confidence, once: true, match: match, revert: rev}, stop)
+}
+
+// Called registers handlers called when the message with cid msgCid is
+// included in the chain. Messages included up to MessageLookbackRounds before
+// the current head are found too.
+func (e *Events) Called(ctx context.Context, msgCid cid.Cid, hnd MsgHandler, rev RevertHandler, confidence uint64) (ID, error) {
+	match := func(ctx context.Context, ts types.TipSet) (func(context.Context, uint64) error, bool, error) {
+		for _, blk := range ts.ToSlice() {
+			for _, msg := range blk.Messages {
+				c, err := msg.Cid()
+				if err != nil {
+					return nil, false, err
+				}
+				if c.Equals(msgCid) {
+					found := msg
+					return func(ctx context.Context, curHeight uint64) error {
+						return hnd(ctx, found, ts, curHeight)
+					}, true, nil
+				}
+			}
+		}
+		return nil, false, nil
+	}
+
+	stop := func(_ types.TipSet, depth int) (bool, error) {
+		return depth > MessageLookbackRounds, nil
+	}
+	return e.register(ctx, &watch{confidence: confidence, once: true, match: match, revert: rev}, stop)
+}
+
+// StateChanged registers handlers called each time a tipset changes the
+// state head of the actor at addr. Only changes after registration are
+// reported.
+func (e *Events) StateChanged(ctx context.Context, addr address.Address, hnd StateChangeHandler, rev RevertHandler, confidence uint64) (ID, error) {
+	match := func(ctx context.Context, ts types.TipSet) (func(context.Context, uint64) error, bool, error) {
+		parent, err := chain.GetParentTipSet(ctx, e.store, ts)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(parent) == 0 {
+			return nil, false, nil
+		}
+		oldHead, err := e.actorHead(ctx, parent, addr)
+		if err != nil {
+			return nil, false, err
+		}
+		newHead, err := e.actorHead(ctx, ts, addr)
+		if err != nil {
+			return nil, false, err
+		}
+		if oldHead.Equals(newHead) {
+			return nil, false, nil
+		}
+		return func(ctx context.Context, curHeight uint64) error {
+			return hnd(ctx, oldHead, newHead, ts, curHeight)
+		}, true, nil
+	}
+	return e.register(ctx, &watch{confidence: confidence, match: match, revert: rev}, nil)
+}
+
+// EventEmitted registers handlers called for each event matching filter
+// in the receipts of the messages of a tipset, in the order of the messages
+// of the tipset. Only events of tipsets applied after registration are
+// reported.
+func (e *Events) EventEmitted(ctx context.Context, filter types.EventFilter, hnd EventHandler, rev RevertHandler, confidence uint64) (ID, error) {
+	match := func(ctx context.Context, ts types.TipSet) (func(context.Context, uint64) error, bool, error) {
+		found, err := e.matchEvents(ctx, ts, filter)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(found) == 0 {
+			return nil, false, nil
+		}
+		return func(ctx context.Context, curHeight uint64) error {
+			for _, f := range found {
+				if err := hnd(ctx, f.event, f.msg, ts, curHeight); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, true, nil
+	}
+	return e.register(ctx, &watch{confidence: confidence, match: match, revert: rev}, nil)
+}
+
+// TipSets registers handlers called for every tipset of the heaviest chain
+// at or above fromHeight, including those already in the chain.
+func (e *Events) TipSets(ctx context.Context, hnd HeightHandler, rev RevertHandler, confidence uint64, fromHeight uint64) (ID, error) {
+	match := func(ctx context.Context, ts types.TipSet) (func(context.Context, uint64) error, bool, error) {
+		height, err := ts.Height()
+		if err != nil {
+			return nil, false, err
+		}
+		if height < fromHeight {
+			return nil, false, nil
+		}
+		return func(ctx context.Context, curHeight uint64) error {
+			return hnd(ctx, ts, curHeight)
+		}, true, nil
+	}
+
+	stop := func(ts types.TipSet, _ int) (bool, error) {
+		height, err := ts.Height()
+		if err != nil {
+			return false, err
+		}
+		return height < fromHeight, nil
+	}
+	return e.register(ctx, &watch{confidence: confidence, match: match, revert: rev}, stop)
+}
+
+// Cancel removes a registered watch. No handler of the watch is called after
+// Cancel returns.
+func (e *Events) Cancel(id ID) {
+	e.lk.Lock()
+	defer e.lk.Unlock()
+	delete(e.watches, id)
+}
+
+// OnNewHeadTipset reverts and applies the tipsets between oldHead and newHead
+// and calls the handlers of every watch affected.
+func (e *Events) OnNewHeadTipset(ctx context.Context, oldHead, newHead types.TipSet) error {
+	reverted, applied, ancestor, err := e.diffChains(ctx, oldHead, newHead)
+	if err != nil {
+		return err
+	}
+	newHeight, err := newHead.Height()
+	if err != nil {
+		return err
+	}
+
+	// chain.IsReorg expects the new chain in increasing height order.
+	newChain := []types.TipSet{ancestor}
+	for i := len(applied) - 1; i >= 0; i-- {
+		newChain = append(newChain, applied[i])
+	}
+	reorg := chain.IsReorg(oldHead, newChain)
+
+	e.lk.Lock()
+	var calls []func() error
+	appliedAt := make(map[uint64]types.TipSet)
+	for _, ts := range applied {
+		h, err := ts.Height()
+		if err != nil {
+			e.lk.Unlock()
+			return err
+		}
+		appliedAt[h] = ts
+	}
+
+	for _, w := range e.watches {
+		var kept []*occurrence
+		for _, occ := range w.occurrences {
+			if !containsTipSet(reverted, occ.ts) {
+				kept = append(kept, occ)
+				continue
+			}
+			if wider, ok := appliedAt[occ.height]; ok && !reorg && w.once {
+				// The new head widens the reverted one. The condition of a
+				// once watch still holds in the wider tipset, so the
+				// occurrence moves to it without being reverted.
+				apply, matched, err := w.match(ctx, wider)
+				if err != nil {
+					e.lk.Unlock()
+					return err
+				}
+				if matched {
+					occ.ts, occ.apply = wider, apply
+					kept = append(kept, occ)
+					continue
+				}
+			}
+			// Other watches are reverted and matched again against the
+			// wider tipset, whose blocks and state differ.
+			if occ.fired && w.revert != nil {
+				rev, ts := w.revert, occ.ts
+				calls = append(calls, func() error { return rev(ctx, ts) })
+			}
+		}
+		w.occurrences = kept
+	}
+
+	for i := len(applied) - 1; i >= 0; i-- {
+		ts := applied[i]
+		h, _ := ts.Height()
+		for _, w := range e.watches {
+			if (w.once && len(w.occurrences) > 0) || w.hasOccurrenceAt(h) {
+				continue
+			}
+			apply, ok, err := w.match(ctx, ts)
+			if err != nil {
+				e.lk.Unlock()
+				return err
+			}
+			if ok {
+				w.occurrences = append(w.occurrences, &occurrence{ts: ts, height: h, apply: apply})
+			}
+		}
+	}
+
+	e.head = newHead
+	calls = append(calls, e.fireConfident(ctx, newHeight)...)
+	e.lk.Unlock()
+
+	runCalls(calls)
+	return nil
+}
+
+// register adds a watch and matches it against recent history. stop is
+// called with each tipset walking back from the head and its depth below the
+// head; the walk ends at the first tipset for which it returns true. A nil
+// stop does not search history.
+func (e *Events) register(ctx context.Context, w *watch, stop func(ts types.TipSet, depth int) (bool, error)) (ID, error) {
+	e.lk.Lock()
+	var history []types.TipSet
+	if stop != nil && len(e.head) > 0 {
+		it := chain.IterAncestors(ctx, e.store, e.head)
+		for depth := 0; !it.Complete(); depth++ {
+			done, err := stop(it.Value(), depth)
+			if err != nil {
+				e.lk.Unlock()
+				return 0, err
+			}
+			if done {
+				break
+			}
+			history = append(history, it.Value())
+			if err := it.Next(); err != nil {
+				e.lk.Unlock()
+				return 0, err
+			}
+		}
+	}
+
+	for i := len(history) - 1; i >= 0; i-- {
+		if w.once && len(w.occurrences) > 0 {
+			break
+		}
+		ts := history[i]
+		h, err := ts.Height()
+		if err != nil {
+			e.lk.Unlock()
+			return 0, err
+		}
+		apply, ok, err := w.match(ctx, ts)
+		if err != nil {
+			e.lk.Unlock()
+			return 0, err
+		}
+		if ok {
+			w.occurrences = append(w.occurrences, &occurrence{ts: ts, height: h, apply: apply})
+		}
+	}
+
+	id := e.nextID
+	e.nextID++
+	e.watches[id] = w
+
+	var calls []func() error
+	if len(e.head) > 0 {
+		headHeight, err := e.head.Height()
+		if err != nil {
+			e.lk.Unlock()
+			return 0, err
+		}
+		calls = w.fireConfident(ctx, headHeight)
+	}
+	e.lk.Unlock()
+
+	runCalls(calls)
+	return id, nil
+}
+
+// fireConfident collects the apply calls of all occurrences that have become
+// deep enough at curHeight. Precondition: the caller holds e.lk.
+func (e *Events) fireConfident(ctx context.Context, curHeight uint64) []func() error {
+	// Fire in registration order so handlers see a deterministic sequence.
+	ids := make([]ID, 0, len(e.watches))
+	for id := range e.watches {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var calls []func() error
+	for _, id := range ids {
+		calls = append(calls, e.watches[id].fireConfident(ctx, curHeight)...)
+	}
+	return calls
+}
+
+func (w *watch) fireConfident(ctx context.Context, curHeight uint64) []func() error {
+	var calls []func() error
+	for _, occ := range w.occurrences {
+		if occ.fired || curHeight < occ.height+w.confidence {
+			continue
+		}
+		occ.fired = true
+		apply := occ.apply
+		calls = append(calls, func() error { return apply(ctx, curHeight) })
+	}
+	return calls
+}
+
+func (w *watch) hasOccurrenceAt(h uint64) bool {
+	for _, occ := range w.occurrences {
+		if occ.height == h {
+			return true
+		}
+	}
+	return false
+}
+
+// diffChains walks back from oldHead and newHead to their common ancestor.
+// It returns the tipsets only on the old chain and only on the new chain,
+// both in decreasing height order, and the common ancestor.
+func (e *Events) diffChains(ctx context.Context, oldHead, newHead types.TipSet) (reverted, applied []types.TipSet, ancestor types.TipSet, err error) {
+	oldIt := chain.IterAncestors(ctx, e.store, oldHead)
+	newIt := chain.IterAncestors(ctx, e.store, newHead)
+	for !oldIt.Complete() && !newIt.Complete() && !oldIt.Value().Equals(newIt.Value()) {
+		oldHeight, err := oldIt.Value().Height()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		newHeight, err := newIt.Value().Height()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		if oldHeight >= newHeight {
+			reverted = append(reverted, oldIt.Value())
+			if err := oldIt.Next(); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		if newHeight >= oldHeight {
+			applied = append(applied, newIt.Value())
+			if err := newIt.Next(); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+	}
+	if oldIt.Complete() || newIt.Complete() {
+		return nil, nil, nil, ErrNoCommonAncestor
+	}
+	return reverted, applied, newIt.Value(), nil
+}
+
+func (e *Events) actorHead(ctx context.Context, ts types.TipSet, addr address.Address) (cid.Cid, error) {
+	st, err := e.getStateTree(ctx, ts)
+	if err != nil {
+		return cid.Undef, err
+	}
+	act, err := st.GetActor(ctx, addr)
+	if state.IsActorNotFoundError(err) {
+		return cid.Undef, nil
+	}
+	if err != nil {
+		return cid.Undef, err
+	}
+	return act.Head, nil
+}
+
+// emittedEvent is an event and the message whose receipt has it.
+type emittedEvent struct {
+	event *types.Event
+	msg   *types.SignedMessage
+}
+
+// matchEvents returns the events of the receipts of a tipset matching filter,
+// following the canonical message order of the tipset.
+func (e *Events) matchEvents(ctx context.Context, ts types.TipSet, filter types.EventFilter) ([]emittedEvent, error) {
+	receipts, err := e.getReceipts(ctx, ts)
+	if err != nil {
+		return nil, err
+	}
+
+	blks := ts.ToSlice()
+	types.SortBlocks(blks)
+	var found []emittedEvent
+	var seen types.SortedCidSet
+	for _, blk := range blks {
+		for _, msg := range blk.Messages {
+			c, err := msg.Cid()
+			if err != nil {
+				return nil, err
+			}
+			if seen.Has(c) {
+				continue
+			}
+			(&seen).Add(c)
+
+			rcpt, ok := receipts[c]
+			if !ok {
+				continue
+			}
+			for _, event := range rcpt.Events {
+				if filter.Matches(event) {
+					found = append(found, emittedEvent{event: event, msg: msg})
+				}
+			}
+		}
+	}
+	return found, nil
+}
+
+func containsTipSet(tipsets []types.TipSet, ts types.TipSet) bool {
+	for _, t := range tipsets {
+		if t.Equals(ts) {
+			return true
+		}
+	}
+	return false
+}
+
+// runCalls runs handler calls, logging rather than propagating their errors
+// so that one failing handler does not starve the others.
+func runCalls(calls []func() error) {
+	for _, call := range calls {
+		if err := call(); err != nil {
+			log.Errorf("chain event handler failed: %s", err)
+		}
+	}
+}
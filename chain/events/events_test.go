@@ -0,0 +1,327 @@
+package events_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-hamt-ipld"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain/events"
+	"github.com/filecoin-project/go-filecoin/state"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestChainAt(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	t.Run("fires once the target height is confident", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		blocks := th.NewFakeBlockProvider()
+		root := blocks.NewBlock(0)
+		b1 := blocks.NewBlock(1, root)
+		b2 := blocks.NewBlock(2, b1)
+		b3 := blocks.NewBlock(3, b2)
+
+		evs := events.New(blocks, nil, nil, th.MustNewTipSet(root))
+		var applied []uint64
+		_, err := evs.ChainAt(ctx, func(ctx context.Context, ts types.TipSet, curHeight uint64) error {
+			applied = append(applied, curHeight)
+			return nil
+		}, nil, 2, 1)
+		require.NoError(err)
+
+		require.NoError(evs.OnNewHeadTipset(ctx, th.MustNewTipSet(root), th.MustNewTipSet(b1)))
+		require.NoError(evs.OnNewHeadTipset(ctx, th.MustNewTipSet(b1), th.MustNewTipSet(b2)))
+		assert.Empty(applied)
+
+		require.NoError(evs.OnNewHeadTipset(ctx, th.MustNewTipSet(b2), th.MustNewTipSet(b3)))
+		assert.Equal([]uint64{3}, applied)
+	})
+
+	t.Run("reverts when the target tipset is reorged out", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		blocks := th.NewFakeBlockProvider()
+		root := blocks.NewBlock(0)
+		a1 := blocks.NewBlock(1, root)
+		b1 := blocks.NewBlock(2, root)
+		b2 := blocks.NewBlock(3, b1)
+
+		evs := events.New(blocks, nil, nil, th.MustNewTipSet(root))
+		var applied, reverted []types.TipSet
+		_, err := evs.ChainAt(ctx, func(ctx context.Context, ts types.TipSet, curHeight uint64) error {
+			applied = append(applied, ts)
+			return nil
+		}, func(ctx context.Context, ts types.TipSet) error {
+			reverted = append(reverted, ts)
+			return nil
+		}, 0, 1)
+		require.NoError(err)
+
+		require.NoError(evs.OnNewHeadTipset(ctx, th.MustNewTipSet(root), th.MustNewTipSet(a1)))
+		require.Len(applied, 1)
+		assert.True(applied[0].Equals(th.MustNewTipSet(a1)))
+
+		require.NoError(evs.OnNewHeadTipset(ctx, th.MustNewTipSet(a1), th.MustNewTipSet(b2)))
+		require.Len(reverted, 1)
+		assert.True(reverted[0].Equals(th.MustNewTipSet(a1)))
+		require.Len(applied, 2)
+		assert.True(applied[1].Equals(th.MustNewTipSet(b1)))
+	})
+
+	t.Run("widening the head does not revert", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		blocks := th.NewFakeBlockProvider()
+		root := blocks.NewBlock(0)
+		a1 := blocks.NewBlock(1, root)
+		b1 := blocks.NewBlock(2, root)
+
+		evs := events.New(blocks, nil, nil, th.MustNewTipSet(root))
+		var appliedCount, revertedCount int
+		_, err := evs.ChainAt(ctx, func(ctx context.Context, ts types.TipSet, curHeight uint64) error {
+			appliedCount++
+			return nil
+		}, func(ctx context.Context, ts types.TipSet) error {
+			revertedCount++
+			return nil
+		}, 0, 1)
+		require.NoError(err)
+
+		require.NoError(evs.OnNewHeadTipset(ctx, th.MustNewTipSet(root), th.MustNewTipSet(a1)))
+		require.NoError(evs.OnNewHeadTipset(ctx, th.MustNewTipSet(a1), th.MustNewTipSet(a1, b1)))
+		assert.Equal(1, appliedCount)
+		assert.Equal(0, revertedCount)
+	})
+
+	t.Run("fires for heights already in the chain", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		blocks := th.NewFakeBlockProvider()
+		root := blocks.NewBlock(0)
+		b1 := blocks.NewBlock(1, root)
+		b2 := blocks.NewBlock(2, b1)
+
+		evs := events.New(blocks, nil, nil, th.MustNewTipSet(b2))
+		var applied []types.TipSet
+		_, err := evs.ChainAt(ctx, func(ctx context.Context, ts types.TipSet, curHeight uint64) error {
+			applied = append(applied, ts)
+			return nil
+		}, nil, 1, 1)
+		require.NoError(err)
+		require.Len(applied, 1)
+		assert.True(applied[0].Equals(th.MustNewTipSet(b1)))
+	})
+}
+
+func TestCalled(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	keys := types.MustGenerateKeyInfo(1, types.GenerateKeyInfoSeed())
+	mm := types.NewMessageMaker(t, keys)
+	alice := mm.Addresses()[0]
+
+	t.Run("fires when the message is included and deep enough", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		msg := mm.NewSignedMessage(alice, 1)
+		msgCid, err := msg.Cid()
+		require.NoError(err)
+
+		blocks := th.NewFakeBlockProvider()
+		root := blocks.NewBlock(0)
+		b1 := blocks.NewBlockWithMessages(1, []*types.SignedMessage{msg}, root)
+		b2 := blocks.NewBlock(2, b1)
+
+		evs := events.New(blocks, nil, nil, th.MustNewTipSet(root))
+		var found *types.SignedMessage
+		_, err = evs.Called(ctx, msgCid, func(ctx context.Context, m *types.SignedMessage, ts types.TipSet, curHeight uint64) error {
+			found = m
+			return nil
+		}, nil, 1)
+		require.NoError(err)
+
+		require.NoError(evs.OnNewHeadTipset(ctx, th.MustNewTipSet(root), th.MustNewTipSet(b1)))
+		assert.Nil(found)
+		require.NoError(evs.OnNewHeadTipset(ctx, th.MustNewTipSet(b1), th.MustNewTipSet(b2)))
+		assert.True(msg.Equals(found))
+	})
+
+	t.Run("cancelled watches are not called", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		msg := mm.NewSignedMessage(alice, 2)
+		msgCid, err := msg.Cid()
+		require.NoError(err)
+
+		blocks := th.NewFakeBlockProvider()
+		root := blocks.NewBlock(0)
+		b1 := blocks.NewBlockWithMessages(1, []*types.SignedMessage{msg}, root)
+
+		evs := events.New(blocks, nil, nil, th.MustNewTipSet(root))
+		called := false
+		id, err := evs.Called(ctx, msgCid, func(ctx context.Context, m *types.SignedMessage, ts types.TipSet, curHeight uint64) error {
+			called = true
+			return nil
+		}, nil, 0)
+		require.NoError(err)
+		evs.Cancel(id)
+
+		require.NoError(evs.OnNewHeadTipset(ctx, th.MustNewTipSet(root), th.MustNewTipSet(b1)))
+		assert.False(called)
+	})
+}
+
+func TestTipSets(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	t.Run("widening the head reverts and applies the wider tipset", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		blocks := th.NewFakeBlockProvider()
+		root := blocks.NewBlock(0)
+		a1 := blocks.NewBlock(1, root)
+		b1 := blocks.NewBlock(2, root)
+
+		evs := events.New(blocks, nil, nil, th.MustNewTipSet(root))
+		var applied, reverted []types.TipSet
+		_, err := evs.TipSets(ctx, func(ctx context.Context, ts types.TipSet, curHeight uint64) error {
+			applied = append(applied, ts)
+			return nil
+		}, func(ctx context.Context, ts types.TipSet) error {
+			reverted = append(reverted, ts)
+			return nil
+		}, 0, 1)
+		require.NoError(err)
+
+		require.NoError(evs.OnNewHeadTipset(ctx, th.MustNewTipSet(root), th.MustNewTipSet(a1)))
+		require.NoError(evs.OnNewHeadTipset(ctx, th.MustNewTipSet(a1), th.MustNewTipSet(a1, b1)))
+
+		require.Len(reverted, 1)
+		assert.True(reverted[0].Equals(th.MustNewTipSet(a1)))
+		require.Len(applied, 2)
+		assert.True(applied[0].Equals(th.MustNewTipSet(a1)))
+		assert.True(applied[1].Equals(th.MustNewTipSet(a1, b1)))
+	})
+}
+
+func TestStateChanged(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	addr := address.NewForTestGetter()()
+	mkCid := types.NewCidForTestGetter()
+
+	blocks := th.NewFakeBlockProvider()
+	root := blocks.NewBlock(0)
+	b1 := blocks.NewBlock(1, root)
+	b2 := blocks.NewBlock(2, b1)
+
+	cst := hamt.NewCborStore()
+	treeWithHead := func(head cid.Cid) state.Tree {
+		st := state.NewEmptyStateTree(cst)
+		act := actor.NewActor(types.AccountActorCodeCid, types.NewZeroAttoFIL())
+		act.Head = head
+		state.MustSetActor(st, addr, act)
+		return st
+	}
+	head1 := mkCid()
+	trees := map[string]state.Tree{
+		th.MustNewTipSet(root).String(): state.NewEmptyStateTree(cst),
+		th.MustNewTipSet(b1).String():   treeWithHead(head1),
+		th.MustNewTipSet(b2).String():   treeWithHead(head1),
+	}
+	getStateTree := func(ctx context.Context, ts types.TipSet) (state.Tree, error) {
+		return trees[ts.String()], nil
+	}
+
+	evs := events.New(blocks, getStateTree, nil, th.MustNewTipSet(root))
+	var changes [][2]cid.Cid
+	_, err := evs.StateChanged(ctx, addr, func(ctx context.Context, oldHead, newHead cid.Cid, ts types.TipSet, curHeight uint64) error {
+		changes = append(changes, [2]cid.Cid{oldHead, newHead})
+		return nil
+	}, nil, 0)
+	require.NoError(err)
+
+	require.NoError(evs.OnNewHeadTipset(ctx, th.MustNewTipSet(root), th.MustNewTipSet(b1)))
+	require.NoError(evs.OnNewHeadTipset(ctx, th.MustNewTipSet(b1), th.MustNewTipSet(b2)))
+	require.Len(changes, 1)
+	assert.Equal(cid.Undef, changes[0][0])
+	assert.Equal(head1, changes[0][1])
+}
+
+func TestEventEmitted(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	keys := types.MustGenerateKeyInfo(1, types.GenerateKeyInfoSeed())
+	mm := types.NewMessageMaker(t, keys)
+	alice := mm.Addresses()[0]
+	emitter := address.NewForTestGetter()()
+
+	msg1 := mm.NewSignedMessage(alice, 1)
+	msg2 := mm.NewSignedMessage(alice, 2)
+	receipts := make(map[cid.Cid]*types.MessageReceipt)
+	for _, m := range []*types.SignedMessage{msg1, msg2} {
+		c, err := m.Cid()
+		require.NoError(err)
+		receipts[c] = &types.MessageReceipt{Events: []*types.Event{
+			{Emitter: emitter, Topic: "redeemed"},
+			{Emitter: emitter, Topic: "closed"},
+		}}
+	}
+	getReceipts := func(ctx context.Context, ts types.TipSet) (map[cid.Cid]*types.MessageReceipt, error) {
+		return receipts, nil
+	}
+
+	blocks := th.NewFakeBlockProvider()
+	root := blocks.NewBlock(0)
+	a1 := blocks.NewBlockWithMessages(1, []*types.SignedMessage{msg1, msg2}, root)
+	b1 := blocks.NewBlock(2, root)
+	b2 := blocks.NewBlock(3, b1)
+
+	evs := events.New(blocks, nil, getReceipts, th.MustNewTipSet(root))
+	var found []*types.SignedMessage
+	var reverted []types.TipSet
+	_, err := evs.EventEmitted(ctx, types.EventFilter{Emitter: emitter, Topic: "redeemed"}, func(ctx context.Context, event *types.Event, msg *types.SignedMessage, ts types.TipSet, curHeight uint64) error {
+		assert.Equal("redeemed", event.Topic)
+		found = append(found, msg)
+		return nil
+	}, func(ctx context.Context, ts types.TipSet) error {
+		reverted = append(reverted, ts)
+		return nil
+	}, 0)
+	require.NoError(err)
+
+	require.NoError(evs.OnNewHeadTipset(ctx, th.MustNewTipSet(root), th.MustNewTipSet(a1)))
+	require.Len(found, 2)
+	assert.True(msg1.Equals(found[0]))
+	assert.True(msg2.Equals(found[1]))
+
+	// Tipsets without matching events are not reported.
+	require.NoError(evs.OnNewHeadTipset(ctx, th.MustNewTipSet(a1), th.MustNewTipSet(b2)))
+	assert.Len(found, 2)
+	require.Len(reverted, 1)
+	assert.True(reverted[0].Equals(th.MustNewTipSet(a1)))
+}
@@ -0,0 +1,245 @@
+package chain
+
+import (
+	"context"
+	"sync"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// SyncWorkers is the number of tipsets a SyncManager syncs concurrently.
+const SyncWorkers = 4
+
+// MaxActiveSyncsPerPeer is the number of tipsets from a single peer a
+// SyncManager syncs concurrently, so that one peer can't take all workers.
+const MaxActiveSyncsPerPeer = 1
+
+// MaxPendingSyncsPerPeer is the number of tipsets from a single peer a
+// SyncManager keeps waiting to be synced. The lowest priority ones are dropped.
+const MaxPendingSyncsPerPeer = 8
+
+// syncRequest is a tipset waiting to be synced.
+type syncRequest struct {
+	head types.SortedCidSet
+	src  syncSource
+	// faults is the number of bad tipsets sent by the peer.
+	faults int
+}
+
+// before is true when r should be synced before other.
+func (r *syncRequest) before(other *syncRequest) bool {
+	if r.faults != other.faults {
+		return r.faults < other.faults
+	}
+	if r.src.weight != other.src.weight {
+		return r.src.weight > other.src.weight
+	}
+	return r.src.height > other.src.height
+}
+
+// SyncManager schedules the syncs of the tipsets announced by peers on a
+// DefaultSyncer. Its HandleNewTipset returns immediately and the tipsets are
+// synced by a pool of workers, heaviest claimed weight first. The workers
+// fetch chains concurrently and the syncer validates them one at a time.
+// Tipsets already scheduled are not scheduled again, and the work for each
+// peer is bounded so that a slow or hostile peer can't starve the others.
+// Tipsets from peers which sent bad tipsets are synced last, and ignored
+// once the peers sent MaxPeerFaults bad tipsets.
+type SyncManager struct {
+	syncer *DefaultSyncer
+
+	// SyncDone, if set, is called with the peer each tipset synced came from
+	// and the result of its sync. It must be set before the manager starts.
+	SyncDone func(peer string, err error)
+
+	// lk protects the fields below. cond is signaled when a request may have
+	// become runnable or the manager stopped.
+	lk      sync.Mutex
+	cond    *sync.Cond
+	pending []*syncRequest
+	// active holds the keys of the tipsets being synced.
+	active map[string]struct{}
+	// activePerPeer counts the tipsets being synced per peer.
+	activePerPeer map[string]int
+	stopped       bool
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+var _ Syncer = (*SyncManager)(nil)
+
+// NewSyncManager returns a SyncManager scheduling syncs on the syncer. It
+// syncs nothing until started.
+func NewSyncManager(syncer *DefaultSyncer) *SyncManager {
+	m := &SyncManager{
+		syncer:        syncer,
+		active:        make(map[string]struct{}),
+		activePerPeer: make(map[string]int),
+	}
+	m.cond = sync.NewCond(&m.lk)
+	return m
+}
+
+// Start starts the workers syncing the scheduled tipsets.
+func (m *SyncManager) Start(ctx context.Context) {
+	ctx, m.cancel = context.WithCancel(ctx)
+	for i := 0; i < SyncWorkers; i++ {
+		m.wg.Add(1)
+		go m.work(ctx)
+	}
+}
+
+// Stop stops the workers, abandoning the syncs in progress, and waits for
+// them to exit.
+func (m *SyncManager) Stop() {
+	m.lk.Lock()
+	m.stopped = true
+	m.cond.Broadcast()
+	m.lk.Unlock()
+
+	if m.cancel != nil {
+		m.cancel()
+	}
+	m.wg.Wait()
+}
+
+// HandleNewTipset schedules the tipset to be synced. The peer and claimed
+// weight and height recorded in ctx with WithSyncSource set its priority.
+// It returns without waiting for the sync, whose failure is reported in the
+// sync status.
+func (m *SyncManager) HandleNewTipset(ctx context.Context, tipsetCids types.SortedCidSet) error {
+	req := &syncRequest{head: tipsetCids}
+	if src, ok := ctx.Value(syncSourceKey{}).(syncSource); ok {
+		req.src = src
+	}
+	key := tipsetCids.String()
+
+	if req.src.peer != "" {
+		req.faults = m.syncer.badTipSets.PeerFaults(req.src.peer)
+		if req.faults >= MaxPeerFaults {
+			logSyncer.Infof("ignoring tipset %s from peer %s: it sent %d bad tipsets", key, req.src.peer, req.faults)
+			return nil
+		}
+	}
+
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	if _, ok := m.active[key]; ok {
+		return nil
+	}
+	var fromPeer []int
+	for i, p := range m.pending {
+		if p.head.Equals(tipsetCids) {
+			if req.before(p) {
+				m.pending[i] = req
+			}
+			return nil
+		}
+		if p.src.peer == req.src.peer {
+			fromPeer = append(fromPeer, i)
+		}
+	}
+
+	if len(fromPeer) >= MaxPendingSyncsPerPeer {
+		lowest := fromPeer[0]
+		for _, i := range fromPeer[1:] {
+			if m.pending[lowest].before(m.pending[i]) {
+				lowest = i
+			}
+		}
+		if !req.before(m.pending[lowest]) {
+			logSyncer.Infof("dropping tipset %s from peer %s: too many pending syncs", key, req.src.peer)
+			return nil
+		}
+		logSyncer.Infof("dropping tipset %s from peer %s: too many pending syncs", m.pending[lowest].head.String(), req.src.peer)
+		m.pending = append(m.pending[:lowest], m.pending[lowest+1:]...)
+	}
+
+	m.pending = append(m.pending, req)
+	m.cond.Signal()
+	return nil
+}
+
+// Status returns the status of the syncer, including the tipsets waiting to
+// be synced.
+func (m *SyncManager) Status() SyncStatus {
+	status := m.syncer.Status()
+
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	for _, req := range m.pending {
+		status.Targets = append(status.Targets, SyncTarget{
+			Peer:   req.src.peer,
+			Head:   req.head,
+			Height: req.src.height,
+			Stage:  SyncStageQueued,
+		})
+	}
+	return status
+}
+
+// work syncs scheduled tipsets until the manager stops.
+func (m *SyncManager) work(ctx context.Context) {
+	defer m.wg.Done()
+	for {
+		req := m.next()
+		if req == nil {
+			return
+		}
+
+		syncCtx := context.WithValue(ctx, syncSourceKey{}, req.src)
+		err := m.syncer.HandleNewTipset(syncCtx, req.head)
+		if err != nil {
+			logSyncer.Infof("failed to sync tipset %s from peer %s: %s", req.head.String(), req.src.peer, err)
+		}
+		if m.SyncDone != nil && req.src.peer != "" && ctx.Err() == nil {
+			m.SyncDone(req.src.peer, err)
+		}
+		m.done(req)
+	}
+}
+
+// next blocks until a request can be synced and returns it, or returns nil
+// when the manager stops.
+func (m *SyncManager) next() *syncRequest {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	for {
+		if m.stopped {
+			return nil
+		}
+
+		best := -1
+		for i, req := range m.pending {
+			if m.activePerPeer[req.src.peer] >= MaxActiveSyncsPerPeer {
+				continue
+			}
+			if best < 0 || req.before(m.pending[best]) {
+				best = i
+			}
+		}
+		if best >= 0 {
+			req := m.pending[best]
+			m.pending = append(m.pending[:best], m.pending[best+1:]...)
+			m.active[req.head.String()] = struct{}{}
+			m.activePerPeer[req.src.peer]++
+			return req
+		}
+		m.cond.Wait()
+	}
+}
+
+// done records the end of the sync of a request.
+func (m *SyncManager) done(req *syncRequest) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	delete(m.active, req.head.String())
+	m.activePerPeer[req.src.peer]--
+	if m.activePerPeer[req.src.peer] == 0 {
+		delete(m.activePerPeer, req.src.peer)
+	}
+	// A request from the same peer may have become runnable.
+	m.cond.Broadcast()
+}
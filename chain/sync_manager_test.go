@@ -0,0 +1,73 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestSyncManagerSchedules(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	syncer, _, _, _ := initSyncTestDefault(require)
+	ctx := context.Background()
+	newCid := types.NewCidForTestGetter()
+
+	// Not started, so everything stays pending.
+	m := chain.NewSyncManager(syncer)
+
+	light := types.NewSortedCidSet(newCid())
+	heavy := types.NewSortedCidSet(newCid())
+	require.NoError(m.HandleNewTipset(chain.WithSyncSource(ctx, "a", 1, 1), light))
+	require.NoError(m.HandleNewTipset(chain.WithSyncSource(ctx, "b", 1, 5), heavy))
+	require.NoError(m.HandleNewTipset(chain.WithSyncSource(ctx, "b", 1, 1), light))
+
+	status := m.Status()
+	require.Len(status.Targets, 2)
+	for _, target := range status.Targets {
+		assert.Equal(chain.SyncStageQueued, target.Stage)
+	}
+
+	// A single peer can't queue more than its share.
+	for i := 0; i < chain.MaxPendingSyncsPerPeer+2; i++ {
+		require.NoError(m.HandleNewTipset(chain.WithSyncSource(ctx, "c", 1, uint64(i)), types.NewSortedCidSet(newCid())))
+	}
+	fromC := 0
+	for _, target := range m.Status().Targets {
+		if target.Peer == "c" {
+			fromC++
+		}
+	}
+	assert.Equal(chain.MaxPendingSyncsPerPeer, fromC)
+}
+
+func TestSyncManagerSyncs(t *testing.T) {
+	require := require.New(t)
+	syncer, chainStore, _, blockSource := initSyncTestDefault(require)
+	ctx := context.Background()
+
+	m := chain.NewSyncManager(syncer)
+	m.Start(ctx)
+	defer m.Stop()
+
+	_ = requirePutBlocks(require, blockSource, link1.ToSlice()...)
+	cids2 := requirePutBlocks(require, blockSource, link2.ToSlice()...)
+	_ = requirePutBlocks(require, blockSource, link3.ToSlice()...)
+	cids4 := requirePutBlocks(require, blockSource, link4.ToSlice()...)
+
+	// The chains share their start, which only one of the syncs validates.
+	require.NoError(m.HandleNewTipset(chain.WithSyncSource(ctx, "a", 2, 0), cids2))
+	require.NoError(m.HandleNewTipset(chain.WithSyncSource(ctx, "b", 4, 0), cids4))
+
+	require.NoError(th.WaitForIt(100, 50*time.Millisecond, func() (bool, error) {
+		return chainStore.Head().Equals(link4) && !m.Status().Syncing(), nil
+	}))
+	require.Empty(m.Status().Failures)
+}
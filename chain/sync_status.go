@@ -0,0 +1,204 @@
+package chain
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-filecoin/metrics"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// MaxSyncFailures is the number of recent sync failures kept in the sync status.
+const MaxSyncFailures = 20
+
+var syncActiveGauge *metrics.Int64Gauge
+var syncTargetHeightGauge *metrics.Int64Gauge
+var syncValidatedHeightGauge *metrics.Int64Gauge
+var syncFailureCounter *metrics.Int64Counter
+
+func init() {
+	syncActiveGauge = metrics.NewInt64Gauge("chain/sync_active_targets", "Number of tipsets being synced")
+	syncTargetHeightGauge = metrics.NewInt64Gauge("chain/sync_target_height", "Height of the highest tipset being synced")
+	syncValidatedHeightGauge = metrics.NewInt64Gauge("chain/sync_validated_height", "Height of the highest tipset validated by the syncer")
+	syncFailureCounter = metrics.NewInt64Counter("chain/sync_failures", "Number of failed syncs")
+}
+
+// SyncStage is the stage a sync target is at.
+type SyncStage string
+
+const (
+	// SyncStageQueued means the sync waits for its turn, either to be picked
+	// by a worker of the SyncManager or for the syncer to finish validating
+	// other chains.
+	SyncStageQueued = SyncStage("queued")
+	// SyncStageFetching means the syncer fetches the headers of the tipsets
+	// from the target back to the chain it knows.
+	SyncStageFetching = SyncStage("fetching headers")
+	// SyncStageValidating means the syncer runs the state transitions of the
+	// fetched tipsets to validate them.
+	SyncStageValidating = SyncStage("validating")
+	// SyncStageApplying means the syncer stores validated tipsets and their
+	// state, and moves the head of the chain.
+	SyncStageApplying = SyncStage("applying state")
+)
+
+// SyncTarget is a tipset the syncer is syncing to.
+type SyncTarget struct {
+	// Peer is the peer the tipset came from, empty when unknown.
+	Peer string
+	Head types.SortedCidSet
+	// Height is the height of the tipset, zero until it is known.
+	Height uint64
+	Stage  SyncStage
+	// Fetched is the number of tipsets fetched so far.
+	Fetched int
+	// Validated is the number of tipsets validated so far.
+	Validated int
+	Started   time.Time
+}
+
+// SyncFailure is a sync which failed.
+type SyncFailure struct {
+	Peer   string
+	Head   types.SortedCidSet
+	Height uint64
+	Stage  SyncStage
+	Error  string
+	Time   time.Time
+}
+
+// SyncStatus is a snapshot of the state of a syncer.
+type SyncStatus struct {
+	// Targets are the tipsets being synced, oldest first.
+	Targets []SyncTarget
+	// ValidatedHeight is the height of the highest tipset validated since
+	// the syncer started.
+	ValidatedHeight uint64
+	// Failures are the most recent failed syncs, oldest first.
+	Failures []SyncFailure
+}
+
+// Syncing is true when the syncer has tipsets to sync.
+func (s *SyncStatus) Syncing() bool {
+	return len(s.Targets) > 0
+}
+
+type syncSourceKey struct{}
+
+type syncSource struct {
+	peer   string
+	height uint64
+	weight uint64
+}
+
+// WithSyncSource returns a context recording the peer a tipset to sync came
+// from and the height and weight it claims, zero when unknown. The sync status
+// reports them and the SyncManager schedules syncs by them.
+func WithSyncSource(ctx context.Context, peer string, height, weight uint64) context.Context {
+	return context.WithValue(ctx, syncSourceKey{}, syncSource{peer, height, weight})
+}
+
+// syncTracker records the progress of the syncs of a syncer.
+type syncTracker struct {
+	lk              sync.Mutex
+	targets         []*SyncTarget
+	validatedHeight uint64
+	failures        []SyncFailure
+}
+
+// start records a new sync target and returns it. The caller must report
+// its end with finish.
+func (t *syncTracker) start(ctx context.Context, head types.SortedCidSet) *SyncTarget {
+	target := &SyncTarget{
+		Head:    head,
+		Stage:   SyncStageQueued,
+		Started: time.Now(),
+	}
+	if src, ok := ctx.Value(syncSourceKey{}).(syncSource); ok {
+		target.Peer = src.peer
+		target.Height = src.height
+	}
+
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	t.targets = append(t.targets, target)
+	t.recordTargets(ctx)
+	return target
+}
+
+// update applies f to the target under the tracker lock.
+func (t *syncTracker) update(ctx context.Context, target *SyncTarget, f func(*SyncTarget)) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	f(target)
+	t.recordTargets(ctx)
+}
+
+// validated records that a tipset with the given height was validated by
+// the sync of the target.
+func (t *syncTracker) validated(ctx context.Context, target *SyncTarget, height uint64) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	target.Validated++
+	if height > t.validatedHeight {
+		t.validatedHeight = height
+		syncValidatedHeightGauge.Set(ctx, int64(height))
+	}
+}
+
+// finish removes the target, recording a failure if err is not nil.
+func (t *syncTracker) finish(ctx context.Context, target *SyncTarget, err error) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	for i, tg := range t.targets {
+		if tg == target {
+			t.targets = append(t.targets[:i], t.targets[i+1:]...)
+			break
+		}
+	}
+	t.recordTargets(ctx)
+
+	if err == nil {
+		return
+	}
+	t.failures = append(t.failures, SyncFailure{
+		Peer:   target.Peer,
+		Head:   target.Head,
+		Height: target.Height,
+		Stage:  target.Stage,
+		Error:  err.Error(),
+		Time:   time.Now(),
+	})
+	if len(t.failures) > MaxSyncFailures {
+		t.failures = t.failures[len(t.failures)-MaxSyncFailures:]
+	}
+	syncFailureCounter.Inc(ctx, 1)
+}
+
+// recordTargets exports the metrics about the targets.
+// Precondition: the caller holds t.lk.
+func (t *syncTracker) recordTargets(ctx context.Context) {
+	var height uint64
+	for _, tg := range t.targets {
+		if tg.Height > height {
+			height = tg.Height
+		}
+	}
+	syncActiveGauge.Set(ctx, int64(len(t.targets)))
+	syncTargetHeightGauge.Set(ctx, int64(height))
+}
+
+// status returns a copy of the recorded status.
+func (t *syncTracker) status() SyncStatus {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	status := SyncStatus{
+		ValidatedHeight: t.validatedHeight,
+		Failures:        append([]SyncFailure{}, t.failures...),
+	}
+	for _, tg := range t.targets {
+		status.Targets = append(status.Targets, *tg)
+	}
+	return status
+}
@@ -1,22 +1,31 @@
 package commands
 
 import (
+	"context"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"reflect"
 	"strings"
 
+	"github.com/filecoin-project/go-filecoin/abi"
 	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/account"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/initactor"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
+	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/exec"
 	"github.com/filecoin-project/go-filecoin/types"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-ipfs-cmdkit"
 	"github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs-files"
+	"github.com/pkg/errors"
 )
 
 // ActorView represents a generic way to represent details about any actor to the user.
@@ -46,7 +55,9 @@ var actorCmd = &cmds.Command{
 		Tagline: "Interact with actors. Actors are built-in smart contracts.",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"ls": actorLsCmd,
+		"ls":     actorLsCmd,
+		"deploy": actorDeployCmd,
+		"call":   actorCallCmd,
 	},
 }
 
@@ -69,16 +80,21 @@ var actorLsCmd = &cmds.Command{
 				output = makeActorView(result.Actor, result.Address, nil)
 			case result.Actor.Code.Equals(types.AccountActorCodeCid):
 				output = makeActorView(result.Actor, result.Address, &account.Actor{})
+			case result.Actor.Code.Equals(types.InitActorCodeCid):
+				output = makeActorView(result.Actor, result.Address, &initactor.Actor{})
 			case result.Actor.Code.Equals(types.StorageMarketActorCodeCid):
 				output = makeActorView(result.Actor, result.Address, &storagemarket.Actor{})
 			case result.Actor.Code.Equals(types.PaymentBrokerActorCodeCid):
 				output = makeActorView(result.Actor, result.Address, &paymentbroker.Actor{})
+			case result.Actor.Code.Equals(types.PaymentBrokerV1ActorCodeCid):
+				output = makeActorView(result.Actor, result.Address, &paymentbroker.Actor{Version: 1})
 			case result.Actor.Code.Equals(types.MinerActorCodeCid):
 				output = makeActorView(result.Actor, result.Address, &miner.Actor{})
 			case result.Actor.Code.Equals(types.BootstrapMinerActorCodeCid):
 				output = makeActorView(result.Actor, result.Address, &miner.Actor{})
 			default:
 				output = makeActorView(result.Actor, result.Address, nil)
+				output.Exports = queryExports(req.Context, env, result.Address)
 			}
 
 			if err := re.Emit(output); err != nil {
@@ -104,6 +120,127 @@ var actorLsCmd = &cmds.Command{
 	},
 }
 
+var actorDeployCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Deploy an actor running WebAssembly code",
+		ShortDescription: `Issues a message to the init actor deploying the code, then waits for the
+message to be mined as this is required to return the address of the new actor.
+The functions the code exports taking and returning nothing are the methods of
+the actor.`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.FileArg("code", true, false, "File containing the WebAssembly code of the actor").EnableStdin(),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("from", "Address to send from"),
+		priceOption,
+		limitOption,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		fromAddr, err := optionalAddr(req.Options["from"])
+		if err != nil {
+			return err
+		}
+
+		gasPrice, gasLimit, _, err := parseGasOptions(req)
+		if err != nil {
+			return err
+		}
+
+		iter := req.Files.Entries()
+		if !iter.Next() {
+			return fmt.Errorf("no file given: %s", iter.Err())
+		}
+		fi, ok := iter.Node().(files.File)
+		if !ok {
+			return fmt.Errorf("given file was not a files.File")
+		}
+		code, err := ioutil.ReadAll(fi)
+		if err != nil {
+			return errors.Wrap(err, "could not read code")
+		}
+
+		addr, err := GetPorcelainAPI(env).ActorDeploy(req.Context, fromAddr, gasPrice, gasLimit, code)
+		if err != nil {
+			return errors.Wrap(err, "could not deploy actor")
+		}
+		return re.Emit(addr)
+	},
+	Type: address.Undef,
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, addr address.Address) error {
+			return PrintString(w, addr)
+		}),
+	},
+}
+
+// ActorCallResult is the return value of a method of a deployed actor.
+type ActorCallResult struct {
+	Return []byte
+}
+
+var actorCallCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Call a method of a deployed actor",
+		ShortDescription: `Issues a message calling the method with the given params, hex encoded, then
+waits for the message to be mined and prints the return value of the method,
+hex encoded.`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("actor", true, false, "Address of the actor"),
+		cmdkit.StringArg("method", true, false, "Method to call"),
+		cmdkit.StringArg("params", false, false, "Params of the method, hex encoded"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("from", "Address to send from"),
+		cmdkit.StringOption("value", "Value to send with the message in FIL").WithDefault("0"),
+		priceOption,
+		limitOption,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		fromAddr, err := optionalAddr(req.Options["from"])
+		if err != nil {
+			return err
+		}
+
+		actorAddr, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid actor address")
+		}
+
+		var params []byte
+		if len(req.Arguments) > 2 {
+			params, err = hex.DecodeString(req.Arguments[2])
+			if err != nil {
+				return errors.Wrap(err, "invalid params")
+			}
+		}
+
+		value, ok := types.NewAttoFILFromFILString(req.Options["value"].(string))
+		if !ok {
+			return errors.New("invalid value")
+		}
+
+		gasPrice, gasLimit, _, err := parseGasOptions(req)
+		if err != nil {
+			return err
+		}
+
+		ret, err := GetPorcelainAPI(env).ActorCall(req.Context, fromAddr, actorAddr, value, gasPrice, gasLimit, req.Arguments[1], params)
+		if err != nil {
+			return err
+		}
+		return re.Emit(&ActorCallResult{Return: ret})
+	},
+	Type: &ActorCallResult{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, res *ActorCallResult) error {
+			_, err := fmt.Fprintln(w, hex.EncodeToString(res.Return))
+			return err
+		}),
+	},
+}
+
 func makeActorView(act *actor.Actor, addr string, actType exec.ExecutableActor) *ActorView {
 	var actorType string
 	var exports readableExports
@@ -125,28 +262,52 @@ func makeActorView(act *actor.Actor, addr string, actType exec.ExecutableActor)
 	}
 }
 
-func makeReadable(f *exec.FunctionSignature) *readableFunctionSignature {
+func makeReadable(schema *abi.MethodSchema) *readableFunctionSignature {
 	rfs := &readableFunctionSignature{
-		Params: make([]string, len(f.Params)),
-		Return: make([]string, len(f.Return)),
+		Params: make([]string, len(schema.Params)),
+		Return: make([]string, len(schema.Return)),
 	}
-	for i, p := range f.Params {
+	for i, p := range schema.Params {
 		rfs.Params[i] = p.String()
 	}
-	for i, r := range f.Return {
+	for i, r := range schema.Return {
 		rfs.Return[i] = r.String()
 	}
 	return rfs
 }
 
 func presentExports(e exec.Exports) readableExports {
+	return presentExportsSchema(e.Schema())
+}
+
+func presentExportsSchema(schema abi.ExportsSchema) readableExports {
 	rdx := make(readableExports)
-	for k, v := range e {
-		rdx[k] = makeReadable(v)
+	for k, v := range schema {
+		if v != nil {
+			rdx[k] = makeReadable(v)
+		}
 	}
 	return rdx
 }
 
+// queryExports returns the exports an actor that is not builtin answers to
+// the exports query, if any.
+func queryExports(ctx context.Context, env cmds.Environment, addr string) readableExports {
+	actorAddr, err := address.NewFromString(addr)
+	if err != nil {
+		return nil
+	}
+	ret, _, err := GetPorcelainAPI(env).MessageQuery(ctx, address.Undef, actorAddr, exec.ExportsMethod)
+	if err != nil || len(ret) == 0 {
+		return nil
+	}
+	var schema abi.ExportsSchema
+	if err := json.Unmarshal(ret[0], &schema); err != nil {
+		return nil
+	}
+	return presentExportsSchema(schema)
+}
+
 func getActorType(actType exec.ExecutableActor) string {
 	t := reflect.TypeOf(actType).Elem()
 	prefixes := strings.Split(t.PkgPath(), "/")
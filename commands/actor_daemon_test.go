@@ -3,9 +3,15 @@ package commands_test
 import (
 	"bytes"
 	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/filecoin-project/go-filecoin/actor/builtin/wasmactor"
 	"github.com/filecoin-project/go-filecoin/commands"
+	"github.com/filecoin-project/go-filecoin/fixtures"
 	th "github.com/filecoin-project/go-filecoin/testhelpers"
 
 	"github.com/stretchr/testify/assert"
@@ -40,7 +46,7 @@ func TestActorDaemon(t *testing.T) {
 		// The order of actors is consistent, but only within builds of genesis.car.
 		// We just want to make sure the views have something valid in them.
 		for _, av := range avs {
-			assert.Contains([]string{"StoragemarketActor", "AccountActor", "PaymentbrokerActor", "MinerActor", "BootstrapMinerActor"}, av.ActorType)
+			assert.Contains([]string{"InitactorActor", "StoragemarketActor", "AccountActor", "PaymentbrokerActor", "MinerActor", "BootstrapMinerActor"}, av.ActorType)
 			if av.ActorType == "AccountActor" {
 				assert.Zero(len(av.Exports))
 			} else {
@@ -49,3 +55,53 @@ func TestActorDaemon(t *testing.T) {
 		}
 	})
 }
+
+func TestActorDeployAndCall(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	d := makeTestDaemonWithMinerAndStart(t)
+	defer d.ShutdownSuccess()
+
+	codeFile, err := ioutil.TempFile("", "wasmactor")
+	require.NoError(err)
+	defer os.Remove(codeFile.Name()) // nolint: errcheck
+	_, err = codeFile.Write(wasmactor.TestCode())
+	require.NoError(err)
+	require.NoError(codeFile.Close())
+
+	var actorAddr string
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		actorAddr = d.RunSuccess("actor", "deploy", "--from", fixtures.TestAddresses[0], "--gas-price", "0", "--gas-limit", "1000", codeFile.Name()).ReadStdoutTrimNewlines()
+		wg.Done()
+	}()
+	d.MineAndPropagate(time.Second)
+	wg.Wait()
+	require.NotEmpty(actorAddr)
+
+	// deployed actors publish their exports
+	var deployed *commands.ActorView
+	ls := d.RunSuccess("actor", "ls", "--enc", "json").ReadStdoutTrimNewlines()
+	for _, line := range bytes.Split([]byte(ls), []byte{'\n'}) {
+		var av commands.ActorView
+		require.NoError(json.Unmarshal(line, &av))
+		if av.Address == actorAddr {
+			deployed = &av
+		}
+	}
+	require.NotNil(deployed)
+	assert.Contains(deployed.Exports, "echo")
+
+	var ret string
+	wg.Add(1)
+	go func() {
+		ret = d.RunSuccess("actor", "call", "--from", fixtures.TestAddresses[0], "--gas-price", "0", "--gas-limit", "1000", actorAddr, "echo", "cafe").ReadStdoutTrimNewlines()
+		wg.Done()
+	}()
+	d.MineAndPropagate(time.Second)
+	wg.Wait()
+	assert.Equal("cafe", ret)
+}
@@ -2,9 +2,12 @@ package commands
 
 import (
 	"encoding/base64"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
+	"strconv"
+	"text/tabwriter"
 
 	"github.com/ipfs/go-ipfs-cmdkit"
 	"github.com/ipfs/go-ipfs-cmds"
@@ -12,6 +15,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/plumbing/msg"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -35,6 +39,7 @@ var addrsCmd = &cmds.Command{
 		"new":     addrsNewCmd,
 		"lookup":  addrsLookupCmd,
 		"default": defaultAddressCmd,
+		"history": addrsHistoryCmd,
 	},
 }
 
@@ -89,7 +94,21 @@ var addrsLsCmd = &cmds.Command{
 	},
 }
 
+// AddressLookupResult is the result of running the address lookup command.
+type AddressLookupResult struct {
+	PeerID    string
+	Address   string
+	IDAddress string
+}
+
 var addrsLookupCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Find the peer ID of a miner and both forms of its address",
+		ShortDescription: `
+Prints the peer ID of a miner followed by its actor address and the ID
+address assigned to it. The miner may be given by either address.
+`,
+	},
 	Arguments: []cmdkit.Argument{
 		cmdkit.StringArg("address", true, false, "Miner address to find peerId for"),
 	},
@@ -103,12 +122,20 @@ var addrsLookupCmd = &cmds.Command{
 		if err != nil {
 			return errors.Wrapf(err, "failed to find miner with address %s", addr.String())
 		}
-		return re.Emit(v.Pretty())
+		actorAddr, idAddr, err := GetPorcelainAPI(env).ActorAddresses(req.Context, addr)
+		if err != nil {
+			return err
+		}
+		return re.Emit(&AddressLookupResult{
+			PeerID:    v.Pretty(),
+			Address:   actorAddr.String(),
+			IDAddress: idAddr.String(),
+		})
 	},
-	Type: string(""),
+	Type: &AddressLookupResult{},
 	Encoders: cmds.EncoderMap{
-		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, pid string) error {
-			_, err := fmt.Fprintln(w, pid)
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, res *AddressLookupResult) error {
+			_, err := fmt.Fprintf(w, "%s\naddress:    %s\nid address: %s\n", res.PeerID, res.Address, res.IDAddress)
 			return err
 		}),
 	},
@@ -132,6 +159,82 @@ var defaultAddressCmd = &cmds.Command{
 	},
 }
 
+var addrsHistoryCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show the balance history of an address",
+		ShortDescription: `
+Rebuilds the changes to the balance of an address from the heaviest chain:
+values sent and received, gas paid, block and gas rewards of the miners it
+owns, and transfers made by actors such as payment channel redeems. Each entry
+shows the balance after it was applied. Use --csv to export the ledger as CSV,
+or --enc=json to export it as JSON.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("address", true, false, "Address to show the balance history of"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption("csv", "Print the ledger as CSV"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		addr, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		entries, err := GetPorcelainAPI(env).AddressHistory(req.Context, addr)
+		if err != nil {
+			return err
+		}
+		return re.Emit(entries)
+	},
+	Type: []*msg.LedgerEntry{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, entries *[]*msg.LedgerEntry) error {
+			row := func(e *msg.LedgerEntry) []string {
+				var msgCid string
+				if e.Message.Defined() {
+					msgCid = e.Message.String()
+				}
+				sign := "+"
+				if e.Kind.Debit() {
+					sign = "-"
+				}
+				return []string{strconv.FormatUint(e.Height, 10), msgCid, string(e.Kind), sign + e.Amount.String(), e.Balance.String()}
+			}
+
+			if asCSV, _ := req.Options["csv"].(bool); asCSV {
+				cw := csv.NewWriter(w)
+				if err := cw.Write([]string{"height", "message", "kind", "amount", "balance"}); err != nil {
+					return err
+				}
+				for _, e := range *entries {
+					if err := cw.Write(row(e)); err != nil {
+						return err
+					}
+				}
+				cw.Flush()
+				return cw.Error()
+			}
+
+			tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+			sw := NewSilentWriter(tw)
+			sw.Println("HEIGHT\tMESSAGE\tKIND\tAMOUNT\tBALANCE")
+			for _, e := range *entries {
+				r := row(e)
+				if r[1] == "" {
+					r[1] = "-"
+				}
+				sw.Printf("%s\t%s\t%s\t%s\t%s\n", r[0], r[1], r[2], r[3], r[4])
+			}
+			if err := sw.Error(); err != nil {
+				return err
+			}
+			return tw.Flush()
+		}),
+	},
+}
+
 var balanceCmd = &cmds.Command{
 	Arguments: []cmdkit.Argument{
 		cmdkit.StringArg("address", true, false, "Address to get balance for"),
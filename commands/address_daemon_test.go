@@ -55,6 +55,38 @@ func TestWalletBalance(t *testing.T) {
 	assert.Equal("0", balance.ReadStdoutTrimNewlines())
 }
 
+func TestAddrsHistory(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	d := makeTestDaemonWithMinerAndStart(t)
+	defer d.ShutdownSuccess()
+
+	from, to := fixtures.TestAddresses[0], fixtures.TestAddresses[1]
+	msgCid := d.RunSuccess("message", "send",
+		"--from", from,
+		"--gas-price", "0", "--gas-limit", "300",
+		"--value=10",
+		to,
+	).ReadStdoutTrimNewlines()
+	d.RunSuccess("mining once")
+
+	for _, addr := range []string{from, to} {
+		lines := strings.Split(d.RunSuccess("address", "history", "--csv", addr).ReadStdoutTrimNewlines(), "\n")
+		require.True(len(lines) > 1)
+		assert.Equal("height,message,kind,amount,balance", lines[0])
+
+		last := strings.Split(lines[len(lines)-1], ",")
+		balance := d.RunSuccess("wallet", "balance", addr).ReadStdoutTrimNewlines()
+		assert.Equal(balance, last[4])
+	}
+
+	history := d.RunSuccess("address", "history", to).ReadStdout()
+	assert.Contains(history, msgCid)
+	assert.Contains(history, "receive")
+}
+
 func TestAddrLookupAndUpdate(t *testing.T) {
 	assert := assert.New(t)
 
@@ -79,6 +111,14 @@ func TestAddrLookupAndUpdate(t *testing.T) {
 	// Not a miner address, should fail.
 	d.RunFail("failed to find", "address", "lookup", addr)
 
+	// Both forms of the miner address are shown, and either finds the miner.
+	lookupLines := strings.Split(d.RunSuccess("address", "lookup", minerAddr).ReadStdoutTrimNewlines(), "\n")
+	require.Len(t, lookupLines, 3)
+	assert.Equal("address:    "+minerAddr, lookupLines[1])
+	require.True(t, strings.HasPrefix(lookupLines[2], "id address: "))
+	minerIDAddr := strings.TrimPrefix(lookupLines[2], "id address: ")
+	assert.Equal(lookupOutA, th.RunSuccessFirstLine(d, "address", "lookup", minerIDAddr))
+
 	// update the miner's peer ID
 	updateMsg := th.RunSuccessFirstLine(d,
 		"miner", "update-peerid",
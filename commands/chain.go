@@ -10,7 +10,9 @@ import (
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-ipfs-cmdkit"
 	"github.com/ipfs/go-ipfs-cmds"
+	"github.com/pkg/errors"
 
+	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -19,8 +21,10 @@ var chainCmd = &cmds.Command{
 		Tagline: "Inspect the filecoin blockchain",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"head": chainHeadCmd,
-		"ls":   chainLsCmd,
+		"bad":        chainBadCmd,
+		"checkpoint": chainCheckpointCmd,
+		"head":       chainHeadCmd,
+		"ls":         chainLsCmd,
 	},
 }
 
@@ -104,3 +108,136 @@ var chainLsCmd = &cmds.Command{
 		}),
 	},
 }
+
+var chainBadCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Inspect and clear the tipsets rejected by the syncer",
+		ShortDescription: `
+The syncer remembers the tipsets it rejected so it does not fetch and validate
+them again. A tipset rejected because of a local fault, e.g. a full disk, can
+be removed so that it is synced again.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"ls": chainBadLsCmd,
+		"rm": chainBadRmCmd,
+	},
+}
+
+var chainBadLsCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "List the tipsets rejected by the syncer, most recently seen first",
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		for _, bad := range GetPorcelainAPI(env).ChainBadTipSets() {
+			if err := re.Emit(bad); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type: chain.BadTipSet{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, bad *chain.BadTipSet) error {
+			_, err := fmt.Fprintf(w, "%s, peers: [%s], reason: %s\n", bad.Key.String(), strings.Join(bad.Peers, " "), bad.Reason)
+			return err
+		}),
+	},
+}
+
+// ChainBadRmResult is the number of tipsets removed by chain bad rm.
+type ChainBadRmResult struct {
+	Removed int
+}
+
+var chainBadRmCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Remove a tipset from the tipsets rejected by the syncer",
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("cids", false, true, "CIDs of the blocks of the tipset to remove"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption("all", "Remove all the tipsets"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		if all, _ := req.Options["all"].(bool); all {
+			return re.Emit(&ChainBadRmResult{GetPorcelainAPI(env).ChainBadTipSetClear()})
+		}
+		if len(req.Arguments) == 0 {
+			return errors.New("pass the cids of a tipset or --all")
+		}
+
+		var cids []cid.Cid
+		for _, arg := range req.Arguments {
+			c, err := cid.Decode(arg)
+			if err != nil {
+				return err
+			}
+			cids = append(cids, c)
+		}
+		if !GetPorcelainAPI(env).ChainBadTipSetRemove(types.NewSortedCidSet(cids...)) {
+			return errors.New("tipset is not among the bad tipsets")
+		}
+		return re.Emit(&ChainBadRmResult{1})
+	},
+	Type: ChainBadRmResult{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, res *ChainBadRmResult) error {
+			_, err := fmt.Fprintf(w, "Removed %d bad tipset(s)\n", res.Removed)
+			return err
+		}),
+	},
+}
+
+var chainCheckpointCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Pin a tipset the chain must include, or list the pinned tipsets",
+		ShortDescription: `
+The syncer rejects the chains which do not include the checkpoints. Checkpoints
+added with this command are saved in the config. Without arguments, the
+checkpoints are listed.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("cids", false, true, "CIDs of the blocks of the tipset to pin"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.Uint64Option("height", "Height of the tipset, required if it is not in the chain store"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		if len(req.Arguments) == 0 {
+			for _, cp := range GetPorcelainAPI(env).ChainCheckpoints() {
+				if err := re.Emit(cp); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		var cids []cid.Cid
+		for _, arg := range req.Arguments {
+			c, err := cid.Decode(arg)
+			if err != nil {
+				return err
+			}
+			cids = append(cids, c)
+		}
+		var height *uint64
+		if h, ok := req.Options["height"].(uint64); ok {
+			height = &h
+		}
+		cp, err := GetPorcelainAPI(env).ChainCheckpoint(req.Context, types.NewSortedCidSet(cids...), height)
+		if err != nil {
+			return err
+		}
+		return re.Emit(cp)
+	},
+	Type: chain.Checkpoint{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, cp *chain.Checkpoint) error {
+			_, err := fmt.Fprintf(w, "%d: %s\n", cp.Height, cp.Key.String())
+			return err
+		}),
+	},
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/ipfs/go-cid"
@@ -142,3 +143,42 @@ func TestChainDaemon(t *testing.T) {
 		assert.Contains(chainLsResult, `"nonce":"0"`)
 	})
 }
+
+func TestChainBad(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	d := th.NewDaemon(t).Start()
+	defer d.ShutdownSuccess()
+
+	assert.Empty(d.RunSuccess("chain", "bad", "ls").ReadStdoutTrimNewlines())
+
+	d.RunFail("not among the bad tipsets", "chain", "bad", "rm", types.SomeCid().String())
+	d.RunFail("pass the cids of a tipset or --all", "chain", "bad", "rm")
+
+	out := d.RunSuccess("chain", "bad", "rm", "--all").ReadStdoutTrimNewlines()
+	assert.Equal("Removed 0 bad tipset(s)", out)
+}
+
+func TestChainCheckpoint(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	d := th.NewDaemon(t).Start()
+	defer d.ShutdownSuccess()
+
+	assert.Empty(d.RunSuccess("chain", "checkpoint").ReadStdoutTrimNewlines())
+
+	head := d.RunSuccess("chain", "head", "--enc=text").ReadStdoutTrimNewlines()
+	out := d.RunSuccess("chain", "checkpoint", head).ReadStdoutTrimNewlines()
+	assert.Contains(out, "0: ")
+	assert.Contains(out, head)
+
+	d.RunFail("its height must be given", "chain", "checkpoint", types.SomeCid().String())
+	out = d.RunSuccess("chain", "checkpoint", types.SomeCid().String(), "--height=5").ReadStdoutTrimNewlines()
+	assert.Contains(out, "5: ")
+
+	out = d.RunSuccess("chain", "checkpoint").ReadStdoutTrimNewlines()
+	assert.Equal(2, len(strings.Split(out, "\n")))
+	assert.Contains(d.RunSuccess("config", "chain.checkpoints").ReadStdoutTrimNewlines(), head)
+}
@@ -0,0 +1,66 @@
+package commands
+
+import (
+	"io"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	"github.com/ipfs/go-ipfs-cmds"
+
+	"github.com/filecoin-project/go-filecoin/conformance"
+)
+
+var debugCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Debug the node and its state transitions",
+	},
+	Subcommands: map[string]*cmds.Command{
+		"extract-vector": debugExtractVectorCmd,
+	},
+}
+
+var debugExtractVectorCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Extract the conformance test vector of a tipset",
+		ShortDescription: `
+Extracts the test vector of the transition from the state of the parent of a
+tipset to the state of the tipset: the protocol upgrades of the network, the
+parent state, the tipset and its ancestors, and the resulting state root and
+receipts. The vector is printed as
+JSON, or as CBOR with --cbor. Vectors saved in conformance/testdata are run as
+tests. The tipset is given as the comma separated CIDs of its blocks.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("tipset", true, false, "Tipset whose transition to extract"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption("cbor", "Print the vector as CBOR"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		tsKey, err := parseTipSetKey(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		v, err := GetPorcelainAPI(env).ChainExtractVector(req.Context, tsKey)
+		if err != nil {
+			return err
+		}
+		return re.Emit(v)
+	},
+	Type: conformance.Vector{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, v *conformance.Vector) error {
+			encode := v.EncodeJSON
+			if asCBOR, _ := req.Options["cbor"].(bool); asCBOR {
+				encode = v.EncodeCBOR
+			}
+			data, err := encode()
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(data)
+			return err
+		}),
+	},
+}
@@ -0,0 +1,48 @@
+package commands_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/conformance"
+	"github.com/filecoin-project/go-filecoin/fixtures"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestDebugExtractVector(t *testing.T) {
+	t.Parallel()
+	d := makeTestDaemonWithMinerAndStart(t)
+	defer d.ShutdownSuccess()
+
+	assert := assert.New(t)
+	require := require.New(t)
+
+	d.RunSuccess(
+		"message", "send",
+		"--from", fixtures.TestAddresses[0],
+		"--gas-price", "0", "--gas-limit", "300",
+		"--value=10",
+		fixtures.TestAddresses[1],
+	)
+	d.RunSuccess("mining", "once")
+	head := d.RunSuccess("chain", "head", "--enc=text").ReadStdoutTrimNewlines()
+
+	out := d.RunSuccess("debug", "extract-vector", head).ReadStdout()
+	v, err := conformance.DecodeVector([]byte(out))
+	require.NoError(err)
+	assert.Len(v.Receipts, 1)
+	assert.NotEmpty(v.Ancestors)
+	assert.Empty(v.ProtocolUpgrades)
+	assert.NoError(conformance.Run(context.Background(), v))
+
+	out = d.RunSuccess("debug", "extract-vector", "--cbor", head).ReadStdout()
+	v, err = conformance.DecodeVector([]byte(out))
+	require.NoError(err)
+	assert.NoError(conformance.Run(context.Background(), v))
+
+	d.RunFail("invalid tipset", "debug", "extract-vector", "notacid")
+	d.RunFail("failed to get tipset", "debug", "extract-vector", types.SomeCid().String())
+}
@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"syscall"
 
 	"github.com/ipfs/go-ipfs-cmdkit"
@@ -18,6 +19,7 @@ import (
 	"github.com/multiformats/go-multiaddr-net"
 	"github.com/pkg/errors"
 
+	"github.com/filecoin-project/go-filecoin/plumbing/msg"
 	"github.com/filecoin-project/go-filecoin/repo"
 	"github.com/filecoin-project/go-filecoin/types"
 )
@@ -113,6 +115,7 @@ NETWORK COMMANDS
   go-filecoin id                     - Show info about the network peers
   go-filecoin ping <peer ID>...      - Send echo request packets to p2p network members
   go-filecoin swarm                  - Interact with the swarm
+  go-filecoin sync                   - Inspect the chain syncer
   go-filecoin stats                  - Monitor statistics on your network usage
 
 ACTOR COMMANDS
@@ -160,6 +163,7 @@ var rootSubcmdsDaemon = map[string]*cmds.Command{
 	"config":           configCmd,
 	"client":           clientCmd,
 	"dag":              dagCmd,
+	"debug":            debugCmd,
 	"dht":              dhtCmd,
 	"id":               idCmd,
 	"log":              logCmd,
@@ -172,8 +176,10 @@ var rootSubcmdsDaemon = map[string]*cmds.Command{
 	"ping":             pingCmd,
 	"retrieval-client": retrievalClientCmd,
 	"show":             showCmd,
+	"state":            stateCmd,
 	"stats":            statsCmd,
 	"swarm":            swarmCmd,
+	"sync":             syncCmd,
 	"wallet":           walletCmd,
 }
 
@@ -322,19 +328,26 @@ func isConnectionRefused(err error) bool {
 	return syscallErr.Err == syscall.ECONNREFUSED
 }
 
-var priceOption = cmdkit.StringOption("gas-price", "Price (FIL e.g. 0.00013) to pay for each GasUnits consumed mining this message")
-var limitOption = cmdkit.Uint64Option("gas-limit", "Maximum number of GasUnits this message is allowed to consume")
+var priceOption = cmdkit.StringOption("gas-price", "Price (FIL e.g. 0.00013) to pay for each GasUnits consumed mining this message, or auto to use the price of recently included messages")
+var limitOption = cmdkit.StringOption("gas-limit", "Maximum number of GasUnits this message is allowed to consume, or auto to estimate it from a preview of the message")
 var previewOption = cmdkit.BoolOption("preview", "Preview the Gas cost of this command without actually executing it")
 
+// autoGas is the value of the gas options asking for an estimate.
+const autoGas = "auto"
+
 func parseGasOptions(req *cmds.Request) (types.AttoFIL, types.GasUnits, bool, error) {
 	priceOption := req.Options["gas-price"]
 	if priceOption == nil {
 		return types.AttoFIL{}, types.NewGasUnits(0), false, errors.New("price option is required")
 	}
 
-	price, ok := types.NewAttoFILFromFILString(priceOption.(string))
-	if !ok {
-		return types.AttoFIL{}, types.NewGasUnits(0), false, errors.New("invalid gas price (specify FIL as a decimal number)")
+	price := msg.AutoGasPrice
+	if priceOption.(string) != autoGas {
+		p, ok := types.NewAttoFILFromFILString(priceOption.(string))
+		if !ok {
+			return types.AttoFIL{}, types.NewGasUnits(0), false, errors.New("invalid gas price (specify FIL as a decimal number or auto)")
+		}
+		price = *p
 	}
 
 	limitOption := req.Options["gas-limit"]
@@ -342,13 +355,16 @@ func parseGasOptions(req *cmds.Request) (types.AttoFIL, types.GasUnits, bool, er
 		return types.AttoFIL{}, types.NewGasUnits(0), false, errors.New("limit option is required")
 	}
 
-	gasLimitInt, ok := limitOption.(uint64)
-	if !ok {
-		msg := fmt.Sprintf("invalid gas limit: %s", limitOption)
-		return types.AttoFIL{}, types.NewGasUnits(0), false, errors.New(msg)
+	limit := msg.AutoGasLimit
+	if limitOption.(string) != autoGas {
+		gasLimitInt, err := strconv.ParseUint(limitOption.(string), 10, 64)
+		if err != nil {
+			return types.AttoFIL{}, types.NewGasUnits(0), false, fmt.Errorf("invalid gas limit: %s", limitOption)
+		}
+		limit = types.NewGasUnits(gasLimitInt)
 	}
 
 	preview, _ := req.Options["preview"].(bool)
 
-	return *price, types.NewGasUnits(gasLimitInt), preview, nil
+	return price, limit, preview, nil
 }
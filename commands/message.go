@@ -1,23 +1,26 @@
 package commands
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-ipfs-cmdkit"
 	"github.com/ipfs/go-ipfs-cmds"
 	"github.com/pkg/errors"
 
-	"github.com/filecoin-project/go-filecoin/abi"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/core"
 	"github.com/filecoin-project/go-filecoin/exec"
 	"github.com/filecoin-project/go-filecoin/plumbing/msg"
 	"github.com/filecoin-project/go-filecoin/plumbing/mthdsig"
 	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
 )
 
 var msgCmd = &cmds.Command{
@@ -25,9 +28,15 @@ var msgCmd = &cmds.Command{
 		Tagline: "Send and monitor messages",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"send":   msgSendCmd,
-		"status": msgStatusCmd,
-		"wait":   msgWaitCmd,
+		"estimate-gas": msgEstimateGasCmd,
+		"events":       msgEventsCmd,
+		"ls":           msgLsCmd,
+		"replay":       msgReplayCmd,
+		"send":         msgSendCmd,
+		"simulate":     msgSimulateCmd,
+		"status":       msgStatusCmd,
+		"trace":        msgTraceCmd,
+		"wait":         msgWaitCmd,
 	},
 }
 
@@ -49,10 +58,12 @@ var msgSendCmd = &cmds.Command{
 	Options: []cmdkit.Option{
 		cmdkit.IntOption("value", "Value to send with message in FIL"),
 		cmdkit.StringOption("from", "Address to send message from"),
+		cmdkit.StringOption("method", "The method to invoke on the target actor"),
+		cmdkit.StringOption("params", "The params of the method, a JSON array of values described by the signature of the method"),
 		priceOption,
 		limitOption,
 		previewOption,
-		// TODO: (per dignifiedquire) add an option to set the nonce and method explicitly
+		// TODO: (per dignifiedquire) add an option to set the nonce explicitly
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		target, err := address.NewFromString(req.Arguments[0])
@@ -81,8 +92,16 @@ var msgSendCmd = &cmds.Command{
 		}
 
 		method, ok := req.Options["method"].(string)
-		if !ok {
-			method = ""
+		if !ok && len(req.Arguments) > 1 {
+			method = req.Arguments[1]
+		}
+
+		var params []interface{}
+		if rawParams, ok := req.Options["params"].(string); ok {
+			params, err = parseParams(req.Context, env, target, method, rawParams)
+			if err != nil {
+				return err
+			}
 		}
 
 		if preview {
@@ -91,6 +110,7 @@ var msgSendCmd = &cmds.Command{
 				fromAddr,
 				target,
 				method,
+				params...,
 			)
 			if err != nil {
 				return err
@@ -110,6 +130,7 @@ var msgSendCmd = &cmds.Command{
 			gasPrice,
 			gasLimit,
 			method,
+			params...,
 		)
 		if err != nil {
 			return err
@@ -141,6 +162,38 @@ type WaitResult struct {
 	Signature *exec.FunctionSignature
 }
 
+// parseParams converts the JSON array of params of a method to the values
+// described by the signature of the method.
+func parseParams(ctx context.Context, env cmds.Environment, target address.Address, method string, rawParams string) ([]interface{}, error) {
+	if method == "" {
+		return nil, errors.New("params given without a method")
+	}
+
+	sig, err := GetPorcelainAPI(env).ActorGetSignature(ctx, target, method)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get the signature of the method")
+	}
+	schemas := sig.Schema().Params
+
+	var raws []json.RawMessage
+	if err := json.Unmarshal([]byte(rawParams), &raws); err != nil {
+		return nil, errors.Wrap(err, "params must be a JSON array")
+	}
+	if len(raws) != len(schemas) {
+		return nil, fmt.Errorf("expected %d params, but got %d", len(schemas), len(raws))
+	}
+
+	params := make([]interface{}, len(raws))
+	for i, raw := range raws {
+		val, err := schemas[i].ParseJSON(raw)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid param %d, expected %s", i, schemas[i])
+		}
+		params[i] = val
+	}
+	return params, nil
+}
+
 var msgWaitCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Wait for a message to appear in a mined block",
@@ -209,12 +262,12 @@ var msgWaitCmd = &cmds.Command{
 			}
 
 			if returnOpt && res.Receipt != nil && res.Signature != nil {
-				val, err := abi.Deserialize(res.Receipt.Return[0], res.Signature.Return[0])
+				val, err := res.Signature.Schema().Return[0].Deserialize(res.Receipt.Return[0])
 				if err != nil {
 					return errors.Wrap(err, "unable to deserialize return value")
 				}
 
-				marshaled = append(marshaled, []byte(val.Val.(fmt.Stringer).String())...)
+				marshaled = append(marshaled, []byte(val.String())...)
 			}
 
 			_, err = w.Write(marshaled)
@@ -223,6 +276,440 @@ var msgWaitCmd = &cmds.Command{
 	},
 }
 
+var msgEstimateGasCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Estimate the gas price and limit of a message",
+		ShortDescription: `
+Estimates the gas limit of a message by previewing it on the head state and
+adding a safety margin, and its gas price from the prices of the messages
+included in recent tipsets. These are the values used when sending a message
+with --gas-price=auto or --gas-limit=auto.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("target", true, false, "Address of the actor to send the message to"),
+		cmdkit.StringArg("method", false, false, "The method to invoke on the target actor"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.IntOption("value", "Value to send with message in FIL"),
+		cmdkit.StringOption("from", "Address to send message from"),
+		cmdkit.StringOption("method", "The method to invoke on the target actor"),
+		cmdkit.StringOption("params", "The params of the method, a JSON array of values described by the signature of the method"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		target, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		var value *types.AttoFIL
+		if val, ok := req.Options["value"].(int); ok {
+			value = types.NewAttoFILFromFIL(uint64(val))
+		}
+
+		var fromAddr address.Address
+		if o, ok := req.Options["from"].(string); ok {
+			fromAddr, err = address.NewFromString(o)
+			if err != nil {
+				return errors.Wrap(err, "invalid from address")
+			}
+		}
+
+		method, ok := req.Options["method"].(string)
+		if !ok && len(req.Arguments) > 1 {
+			method = req.Arguments[1]
+		}
+
+		var params []interface{}
+		if rawParams, ok := req.Options["params"].(string); ok {
+			params, err = parseParams(req.Context, env, target, method, rawParams)
+			if err != nil {
+				return err
+			}
+		}
+
+		estimate, err := GetPorcelainAPI(env).MessageEstimateGas(req.Context, fromAddr, target, value, method, params...)
+		if err != nil {
+			return err
+		}
+		return re.Emit(estimate)
+	},
+	Type: &msg.GasEstimate{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, e *msg.GasEstimate) error {
+			sw := NewSilentWriter(w)
+			sw.Printf("Gas price: %s\n", e.GasPrice.String())
+			sw.Printf("Gas limit: %d\n", e.GasLimit)
+			sw.Printf("Gas used:  %d\n", e.GasUsed)
+			return sw.Error()
+		}),
+	},
+}
+
+var msgLsCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "List messages on chain",
+		ShortDescription: `
+Lists the messages of the heaviest chain with their receipts, from the most to
+the least recent. Options narrow the listing by sender, recipient, method,
+inclusion height, receipt exit code and the events emitted by actors.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("from", "Only list messages sent from this address"),
+		cmdkit.StringOption("to", "Only list messages sent to this address"),
+		cmdkit.StringOption("method", "Only list calls of this actor method"),
+		cmdkit.Uint64Option("min-height", "Only list messages included at or above this height"),
+		cmdkit.Uint64Option("max-height", "Only list messages included at or below this height"),
+		cmdkit.IntOption("exit-code", "Only list messages whose receipt has this exit code"),
+		cmdkit.StringOption("event-topic", "Only list messages with an event of this topic"),
+		cmdkit.StringOption("event-emitter", "Only list messages with an event emitted by this actor"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		filter, err := parseMessageFilter(req)
+		if err != nil {
+			return err
+		}
+
+		res, err := GetPorcelainAPI(env).MessageLs(req.Context, filter)
+		if err != nil {
+			return err
+		}
+		return re.Emit(res)
+	},
+	Type: []*msg.IndexedMessage{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, res *[]*msg.IndexedMessage) error {
+			tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+			sw := NewSilentWriter(tw)
+			sw.Println("CID\tHEIGHT\tFROM\tTO\tMETHOD\tVALUE\tEXIT\tGAS PAID")
+			for _, m := range *res {
+				exit, gas := "-", "-"
+				if m.Receipt != nil {
+					exit = strconv.Itoa(int(m.Receipt.ExitCode))
+					if m.Receipt.GasAttoFIL != nil {
+						gas = m.Receipt.GasAttoFIL.String()
+					}
+				}
+				sw.Printf("%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n", m.Cid, m.Height, m.Message.From, m.Message.To, m.Message.Method, m.Message.Value, exit, gas)
+			}
+			if err := sw.Error(); err != nil {
+				return err
+			}
+			return tw.Flush()
+		}),
+	},
+}
+
+// parseMessageFilter returns the filter of the message listing options set.
+func parseMessageFilter(req *cmds.Request) (msg.MessageFilter, error) {
+	var filter msg.MessageFilter
+	var err error
+	if o, ok := req.Options["from"].(string); ok {
+		filter.From, err = address.NewFromString(o)
+		if err != nil {
+			return filter, errors.Wrap(err, "invalid from address")
+		}
+	}
+	if o, ok := req.Options["to"].(string); ok {
+		filter.To, err = address.NewFromString(o)
+		if err != nil {
+			return filter, errors.Wrap(err, "invalid to address")
+		}
+	}
+	filter.Method, _ = req.Options["method"].(string)
+	filter.MinHeight, _ = req.Options["min-height"].(uint64)
+	filter.MaxHeight, _ = req.Options["max-height"].(uint64)
+	if o, ok := req.Options["exit-code"].(int); ok {
+		if o < 0 || o > 255 {
+			return filter, fmt.Errorf("invalid exit code %d", o)
+		}
+		code := uint8(o)
+		filter.ExitCode = &code
+	}
+	filter.EventTopic, _ = req.Options["event-topic"].(string)
+	if o, ok := req.Options["event-emitter"].(string); ok {
+		filter.EventEmitter, err = address.NewFromString(o)
+		if err != nil {
+			return filter, errors.Wrap(err, "invalid event emitter address")
+		}
+	}
+	return filter, nil
+}
+
+// MessageEvent is an event emitted by an actor while processing an on-chain
+// message.
+type MessageEvent struct {
+	// Message is the cid of the message.
+	Message cid.Cid
+	Height  uint64
+	Event   *types.Event
+}
+
+var msgEventsCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "List events emitted by actors on chain",
+		ShortDescription: `
+Lists the events emitted by actors while processing the messages of the
+heaviest chain, from the most to the least recent. Options narrow the listing
+by message sender, recipient, method and inclusion height, and by event topic
+and emitter.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("from", "Only list events of messages sent from this address"),
+		cmdkit.StringOption("to", "Only list events of messages sent to this address"),
+		cmdkit.StringOption("method", "Only list events of calls of this actor method"),
+		cmdkit.Uint64Option("min-height", "Only list events of messages included at or above this height"),
+		cmdkit.Uint64Option("max-height", "Only list events of messages included at or below this height"),
+		cmdkit.StringOption("event-topic", "Only list events of this topic"),
+		cmdkit.StringOption("event-emitter", "Only list events emitted by this actor"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		filter, err := parseMessageFilter(req)
+		if err != nil {
+			return err
+		}
+
+		msgs, err := GetPorcelainAPI(env).MessageLs(req.Context, filter)
+		if err != nil {
+			return err
+		}
+
+		var res []*MessageEvent
+		for _, m := range msgs {
+			if m.Receipt == nil {
+				continue
+			}
+			for _, event := range m.Receipt.Events {
+				if filter.EventTopic != "" && event.Topic != filter.EventTopic {
+					continue
+				}
+				if !filter.EventEmitter.Empty() && event.Emitter != filter.EventEmitter {
+					continue
+				}
+				res = append(res, &MessageEvent{Message: m.Cid, Height: m.Height, Event: event})
+			}
+		}
+		return re.Emit(res)
+	},
+	Type: []*MessageEvent{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, res *[]*MessageEvent) error {
+			tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+			sw := NewSilentWriter(tw)
+			sw.Println("MESSAGE\tHEIGHT\tEMITTER\tTOPIC\tDATA")
+			for _, e := range *res {
+				sw.Printf("%s\t%d\t%s\t%s\t%x\n", e.Message, e.Height, e.Event.Emitter, e.Event.Topic, e.Event.Data)
+			}
+			if err := sw.Error(); err != nil {
+				return err
+			}
+			return tw.Flush()
+		}),
+	},
+}
+
+var msgTraceCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Replay a message and show its call tree",
+		ShortDescription: `
+Replays a message of the blockchain against the state it was applied to and
+prints the tree of the calls it made: the message itself and the messages sent
+by actors while handling it. Each call shows its sender, recipient, method,
+value, parameters, return value, exit code, the gas charged and the storage
+operations of its actor.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("cid", true, false, "CID of the message to trace"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		msgCid, err := cid.Parse(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid cid "+req.Arguments[0])
+		}
+
+		trace, err := GetPorcelainAPI(env).MessageTrace(req.Context, msgCid)
+		if err != nil {
+			return err
+		}
+		return re.Emit(trace)
+	},
+	Type: vm.TraceFrame{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, frame *vm.TraceFrame) error {
+			sw := NewSilentWriter(w)
+			printTraceFrame(sw, frame, "")
+			return sw.Error()
+		}),
+	},
+}
+
+// printTraceFrame prints a call and, indented below it, the calls it made.
+func printTraceFrame(sw *SilentWriter, frame *vm.TraceFrame, indent string) {
+	method := frame.Method
+	if method == "" {
+		method = "(transfer)"
+	}
+	sw.Printf("%s%s -> %s %s value=%s exit=%d gas=%d\n", indent, frame.From, frame.To, method, frame.Value, frame.ExitCode, frame.GasCharged)
+	if len(frame.Params) > 0 {
+		sw.Printf("%s  params: %x\n", indent, frame.Params)
+	}
+	for _, ret := range frame.Return {
+		sw.Printf("%s  return: %x\n", indent, ret)
+	}
+	if frame.Error != "" {
+		sw.Printf("%s  error: %s\n", indent, frame.Error)
+	}
+	for _, op := range frame.Storage {
+		if op.Prev != nil {
+			sw.Printf("%s  %s %s (was %s)\n", indent, op.Kind, op.Cid, op.Prev)
+		} else {
+			sw.Printf("%s  %s %s\n", indent, op.Kind, op.Cid)
+		}
+	}
+	for _, call := range frame.Calls {
+		printTraceFrame(sw, call, indent+"  ")
+	}
+}
+
+var msgReplayCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Apply a message of the blockchain to the state of a tipset",
+		ShortDescription: `
+Applies a message of the blockchain to the state of a tipset, by default the
+state it was originally applied to, and shows its receipt, its return values
+and the actors it changed. The signature and nonce of the message are not
+checked. No state is changed.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("cid", true, false, "CID of the message to replay"),
+	},
+	Options: []cmdkit.Option{
+		atOption,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		msgCid, err := cid.Parse(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid cid "+req.Arguments[0])
+		}
+		at, err := parseAtOption(req)
+		if err != nil {
+			return err
+		}
+
+		res, err := GetPorcelainAPI(env).MessageReplay(req.Context, msgCid, at)
+		if err != nil {
+			return err
+		}
+		return re.Emit(res)
+	},
+	Type: msg.ReplayResult{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(printReplayResult),
+	},
+}
+
+var msgSimulateCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Apply an unsigned message to the state of a tipset",
+		ShortDescription: `
+Applies a message given as JSON to the state of a tipset, by default the head,
+and shows its receipt, its return values and the actors it changed. The
+message needs no signature and its nonce is not checked. No state is changed.
+For example:
+
+  go-filecoin message simulate '{"from":"<address>","to":"<address>","value":"1"}'
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("message", true, false, "JSON of the message to simulate"),
+	},
+	Options: []cmdkit.Option{
+		atOption,
+		cmdkit.StringOption("gas-price", "Price (FIL e.g. 0.00013) to pay for each GasUnits consumed").WithDefault("0"),
+		cmdkit.Uint64Option("gas-limit", "Maximum number of GasUnits the message is allowed to consume, the block gas limit by default"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		var message types.Message
+		if err := json.Unmarshal([]byte(req.Arguments[0]), &message); err != nil {
+			return errors.Wrap(err, "invalid message")
+		}
+		if message.Value == nil {
+			message.Value = types.ZeroAttoFIL
+		}
+
+		gasPrice, ok := types.NewAttoFILFromFILString(req.Options["gas-price"].(string))
+		if !ok {
+			return errors.New("invalid gas price (specify FIL as a decimal number)")
+		}
+		gasLimit := types.BlockGasLimit
+		if limit, ok := req.Options["gas-limit"].(uint64); ok {
+			gasLimit = types.NewGasUnits(limit)
+		}
+		at, err := parseAtOption(req)
+		if err != nil {
+			return err
+		}
+
+		res, err := GetPorcelainAPI(env).MessageSimulate(req.Context, &message, *gasPrice, gasLimit, at)
+		if err != nil {
+			return err
+		}
+		return re.Emit(res)
+	},
+	Type: msg.ReplayResult{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(printReplayResult),
+	},
+}
+
+var atOption = cmdkit.StringOption("at", "Comma separated CIDs of the blocks of the tipset whose state to use")
+
+// parseAtOption returns the tipset of the at option, empty if it is not set.
+func parseAtOption(req *cmds.Request) (types.SortedCidSet, error) {
+	opt, _ := req.Options["at"].(string)
+	if opt == "" {
+		return types.SortedCidSet{}, nil
+	}
+	return parseTipSetKey(opt)
+}
+
+// parseTipSetKey parses the comma separated CIDs of the blocks of a tipset.
+func parseTipSetKey(s string) (types.SortedCidSet, error) {
+	var key types.SortedCidSet
+	for _, str := range strings.Split(s, ",") {
+		c, err := cid.Decode(strings.TrimSpace(str))
+		if err != nil {
+			return key, errors.Wrap(err, "invalid tipset")
+		}
+		key.Add(c)
+	}
+	return key, nil
+}
+
+func printReplayResult(req *cmds.Request, w io.Writer, res *msg.ReplayResult) error {
+	sw := NewSilentWriter(w)
+	sw.Printf("tipset: %s\n", res.TipSet.String())
+	sw.Printf("exit code: %d\n", res.Receipt.ExitCode)
+	sw.Printf("gas cost: %s\n", res.Receipt.GasAttoFIL)
+	for _, ret := range res.Return {
+		sw.Printf("return: %s\n", ret)
+	}
+	if res.Error != "" {
+		sw.Printf("error: %s\n", res.Error)
+	}
+	for _, event := range res.Receipt.Events {
+		sw.Printf("event: %s %s %x\n", event.Emitter, event.Topic, event.Data)
+	}
+	for _, change := range res.Changes {
+		printActorDiff(sw, change)
+	}
+	return sw.Error()
+}
+
 // MessageStatusResult is the status of a message on chain or in the message queue/pool
 type MessageStatusResult struct {
 	InPool    bool // Whether the message is found in the mpool
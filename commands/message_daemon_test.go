@@ -2,6 +2,7 @@ package commands_test
 
 import (
 	"encoding/json"
+	"fmt"
 	"strconv"
 	"strings"
 	"sync"
@@ -58,6 +59,24 @@ func TestMessageSend(t *testing.T) {
 		"--value=10",
 		fixtures.TestAddresses[3],
 	)
+
+	t.Log("[success] with auto gas")
+	d.RunSuccess("message", "send",
+		"--from", from,
+		"--gas-price", "auto",
+		"--gas-limit", "auto",
+		"--value=10",
+		fixtures.TestAddresses[3],
+	)
+
+	t.Log("[failure] invalid gas limit")
+	d.RunFail("invalid gas limit",
+		"message", "send",
+		"--from", from,
+		"--gas-price", "0",
+		"--gas-limit", "lots",
+		fixtures.TestAddresses[3],
+	)
 }
 
 func TestMessageWait(t *testing.T) {
@@ -178,3 +197,157 @@ func TestMessageStatus(t *testing.T) {
 		assert.NotContains(status, "On chain")
 	})
 }
+
+func TestMessageLs(t *testing.T) {
+	t.Parallel()
+	d := makeTestDaemonWithMinerAndStart(t)
+	defer d.ShutdownSuccess()
+
+	assert := assert.New(t)
+
+	msg := d.RunSuccess(
+		"message", "send",
+		"--from", fixtures.TestAddresses[0],
+		"--gas-price", "0", "--gas-limit", "300",
+		"--value=10",
+		fixtures.TestAddresses[1],
+	)
+	msgcid := strings.Trim(msg.ReadStdout(), "\n")
+
+	d.RunSuccess("mining once")
+
+	ls := d.RunSuccess("message", "ls", "--from", fixtures.TestAddresses[0]).ReadStdout()
+	assert.Contains(ls, msgcid)
+
+	ls = d.RunSuccess("message", "ls", "--to", fixtures.TestAddresses[1], "--exit-code", "0").ReadStdout()
+	assert.Contains(ls, msgcid)
+
+	ls = d.RunSuccess("message", "ls", "--from", fixtures.TestAddresses[1]).ReadStdout()
+	assert.NotContains(ls, msgcid)
+}
+
+func TestMessageEvents(t *testing.T) {
+	t.Parallel()
+	d := makeTestDaemonWithMinerAndStart(t)
+	defer d.ShutdownSuccess()
+
+	assert := assert.New(t)
+
+	create := d.RunSuccess(
+		"paych", "create",
+		"--from", fixtures.TestAddresses[0],
+		"--gas-price", "0", "--gas-limit", "300",
+		fixtures.TestAddresses[1], "10000", "20",
+	)
+	msgcid := strings.Trim(create.ReadStdout(), "\n")
+
+	d.RunSuccess("mining", "once")
+
+	events := d.RunSuccess("message", "events", "--event-topic", "channelCreated").ReadStdout()
+	assert.Contains(events, msgcid)
+	assert.Contains(events, address.PaymentBrokerAddress.String())
+
+	ls := d.RunSuccess("message", "ls", "--event-emitter", address.PaymentBrokerAddress.String()).ReadStdout()
+	assert.Contains(ls, msgcid)
+
+	ls = d.RunSuccess("message", "ls", "--event-topic", "redeemed").ReadStdout()
+	assert.NotContains(ls, msgcid)
+}
+
+func TestMessageEstimateGas(t *testing.T) {
+	t.Parallel()
+	d := makeTestDaemonWithMinerAndStart(t)
+	defer d.ShutdownSuccess()
+
+	assert := assert.New(t)
+
+	out := d.RunSuccess("message", "estimate-gas",
+		"--from", fixtures.TestAddresses[0],
+		fixtures.TestAddresses[1],
+	).ReadStdout()
+	assert.Contains(out, "Gas price: 0")
+	assert.Contains(out, "Gas limit:")
+
+	out = d.RunSuccess("message", "estimate-gas",
+		"--from", fixtures.TestAddresses[0],
+		"--value=10",
+		fixtures.TestAddresses[1],
+	).ReadStdout()
+	assert.Contains(out, "Gas limit:")
+
+	out = d.RunSuccess("message", "estimate-gas",
+		"--from", fixtures.TestAddresses[0],
+		"--method", "getActorIDAddress",
+		"--params", `["`+fixtures.TestAddresses[1]+`"]`,
+		address.InitAddress.String(),
+	).ReadStdout()
+	assert.Contains(out, "Gas limit:")
+}
+
+func TestMessageTrace(t *testing.T) {
+	t.Parallel()
+	d := makeTestDaemonWithMinerAndStart(t)
+	defer d.ShutdownSuccess()
+
+	assert := assert.New(t)
+
+	msg := d.RunSuccess(
+		"message", "send",
+		"--from", fixtures.TestAddresses[0],
+		"--gas-price", "0", "--gas-limit", "300",
+		"--value=10",
+		fixtures.TestAddresses[1],
+	)
+	msgcid := strings.Trim(msg.ReadStdout(), "\n")
+	d.RunSuccess("mining", "once")
+
+	out := d.RunSuccess("message", "trace", msgcid).ReadStdout()
+	assert.Contains(out, fixtures.TestAddresses[0]+" -> "+fixtures.TestAddresses[1]+" (transfer) value=10 exit=0")
+
+	d.RunFail("not found on chain", "message", "trace", "QmWbMozPyW6Ecagtxq7SXBXXLY5BNdP1GwHB2WoZCKMvcb")
+}
+
+func TestMessageReplay(t *testing.T) {
+	t.Parallel()
+	d := makeTestDaemonWithMinerAndStart(t)
+	defer d.ShutdownSuccess()
+
+	assert := assert.New(t)
+
+	msg := d.RunSuccess(
+		"message", "send",
+		"--from", fixtures.TestAddresses[0],
+		"--gas-price", "0", "--gas-limit", "300",
+		"--value=10",
+		fixtures.TestAddresses[1],
+	)
+	msgcid := strings.Trim(msg.ReadStdout(), "\n")
+	d.RunSuccess("mining", "once")
+
+	out := d.RunSuccess("message", "replay", msgcid).ReadStdout()
+	assert.Contains(out, "exit code: 0")
+	assert.Contains(out, fixtures.TestAddresses[1])
+
+	d.RunFail("not found on chain", "message", "replay", "QmWbMozPyW6Ecagtxq7SXBXXLY5BNdP1GwHB2WoZCKMvcb")
+}
+
+func TestMessageSimulate(t *testing.T) {
+	t.Parallel()
+	d := makeTestDaemonWithMinerAndStart(t)
+	defer d.ShutdownSuccess()
+
+	assert := assert.New(t)
+
+	message := fmt.Sprintf(`{"from":"%s","to":"%s","value":"10"}`, fixtures.TestAddresses[0], fixtures.TestAddresses[1])
+	before := d.RunSuccess("wallet", "balance", fixtures.TestAddresses[1]).ReadStdout()
+
+	out := d.RunSuccess("message", "simulate", message).ReadStdout()
+	assert.Contains(out, "exit code: 0")
+	assert.Contains(out, fixtures.TestAddresses[1])
+
+	// Nothing was sent.
+	after := d.RunSuccess("wallet", "balance", fixtures.TestAddresses[1]).ReadStdout()
+	assert.Equal(before, after)
+
+	d.RunFail("invalid message", "message", "simulate", "{")
+}
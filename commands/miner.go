@@ -10,6 +10,7 @@ import (
 	"github.com/ipfs/go-ipfs-cmdkit"
 	"github.com/ipfs/go-ipfs-cmds"
 	"github.com/libp2p/go-libp2p-peer"
+	ma "github.com/multiformats/go-multiaddr"
 	"github.com/pkg/errors"
 
 	"github.com/filecoin-project/go-filecoin/address"
@@ -27,6 +28,7 @@ var minerCmd = &cmds.Command{
 		"pledge":        minerPledgeCmd,
 		"power":         minerPowerCmd,
 		"set-price":     minerSetPriceCmd,
+		"update-addrs":  minerUpdateAddrsCmd,
 		"update-peerid": minerUpdatePeerIDCmd,
 	},
 }
@@ -378,6 +380,107 @@ var minerUpdatePeerIDCmd = &cmds.Command{
 	},
 }
 
+// MinerUpdateAddrsResult is the return type for miner update-addrs command
+type MinerUpdateAddrsResult struct {
+	Cid     cid.Cid
+	GasUsed types.GasUnits
+	Preview bool
+}
+
+var minerUpdateAddrsCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Change the multiaddrs a miner announces it can be dialed at",
+		ShortDescription: `Issues a new message to the network to replace the multiaddrs the miner announces.
+Clients dial the miner at these addresses before looking it up in the DHT, so
+miners behind a NAT should include their relay addresses.`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("address", true, false, "Miner address to update multiaddrs for"),
+		cmdkit.StringArg("addrs", true, true, "Multiaddrs the miner can be dialed at"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("from", "Address to send from"),
+		priceOption,
+		limitOption,
+		previewOption,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		minerAddr, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		fromAddr, err := optionalAddr(req.Options["from"])
+		if err != nil {
+			return err
+		}
+
+		var maddrs []ma.Multiaddr
+		for _, arg := range req.Arguments[1:] {
+			maddr, err := ma.NewMultiaddr(arg)
+			if err != nil {
+				return errors.Wrapf(err, "invalid multiaddr %s", arg)
+			}
+			maddrs = append(maddrs, maddr)
+		}
+
+		gasPrice, gasLimit, preview, err := parseGasOptions(req)
+		if err != nil {
+			return err
+		}
+
+		if preview {
+			usedGas, err := GetPorcelainAPI(env).MessagePreview(
+				req.Context,
+				fromAddr,
+				minerAddr,
+				"updateMultiaddrs",
+				maddrs,
+			)
+			if err != nil {
+				return err
+			}
+
+			return re.Emit(&MinerUpdateAddrsResult{
+				Cid:     cid.Cid{},
+				GasUsed: usedGas,
+				Preview: true,
+			})
+		}
+
+		c, err := GetPorcelainAPI(env).MessageSendWithDefaultAddress(
+			req.Context,
+			fromAddr,
+			minerAddr,
+			nil,
+			gasPrice,
+			gasLimit,
+			"updateMultiaddrs",
+			maddrs,
+		)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(&MinerUpdateAddrsResult{
+			Cid:     c,
+			GasUsed: types.NewGasUnits(0),
+			Preview: false,
+		})
+	},
+	Type: &MinerUpdateAddrsResult{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, res *MinerUpdateAddrsResult) error {
+			if res.Preview {
+				output := strconv.FormatUint(uint64(res.GasUsed), 10)
+				_, err := w.Write([]byte(output))
+				return err
+			}
+			return PrintString(w, res.Cid)
+		}),
+	},
+}
+
 var minerOwnerCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline:          "Show the actor address of <miner>",
@@ -39,6 +39,7 @@ func TestMinerHelp(t *testing.T) {
 			"miner pledge <miner>                    - View number of pledged sectors for <miner>",
 			"miner power <miner>                     - Get the power of a miner versus the total storage market power",
 			"miner set-price <storageprice> <expiry> - Set the minimum price for storage",
+			"miner update-addrs <address> <addrs>... - Change the multiaddrs a miner announces it can be dialed at",
 			"miner update-peerid <address> <peerid>  - Change the libp2p identity that a miner is operating",
 		}
 
@@ -60,6 +61,12 @@ func TestMinerHelp(t *testing.T) {
 		assert.Contains(result, "Issues a new message to the network to update the miner's libp2p identity.")
 	})
 
+	t.Run("update-addrs --help shows update-addrs help", func(t *testing.T) {
+		t.Parallel()
+		result := runHelpSuccess(t, "miner", "update-addrs", "--help")
+		assert.Contains(result, "Issues a new message to the network to replace the multiaddrs the miner announces.")
+	})
+
 	t.Run("owner --help shows owner help", func(t *testing.T) {
 		t.Parallel()
 		result := runHelpSuccess(t, "miner", "owner", "--help")
@@ -3,11 +3,14 @@ package commands
 import (
 	"io"
 
+	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-ipfs-cmdkit"
 	"github.com/ipfs/go-ipfs-cmds"
+	"github.com/pkg/errors"
 
 	"github.com/filecoin-project/go-filecoin/address"
-	"github.com/filecoin-project/go-filecoin/core"
+	"github.com/filecoin-project/go-filecoin/porcelain"
+	"github.com/filecoin-project/go-filecoin/types"
 )
 
 var outboxCmd = &cmds.Command{
@@ -15,20 +18,27 @@ var outboxCmd = &cmds.Command{
 		Tagline: "View and manipulate the outbound message queue",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"clear": outboxClearCmd,
-		"ls":    outboxLsCmd,
+		"clear":   outboxClearCmd,
+		"ls":      outboxLsCmd,
+		"replace": outboxReplaceCmd,
 	},
 }
 
 // OutboxLsResult is a listing of the outbox for a single address.
 type OutboxLsResult struct {
 	Address  address.Address
-	Messages []*core.QueuedMessage
+	Messages []*porcelain.OutboxMessage
 }
 
 var outboxLsCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "List the queue(s) of sent but un-mined messages",
+		ShortDescription: `
+Lists the messages sent by this node that are not yet included in a block, with
+the height at which they were sent, their age in rounds, the number of times
+they were broadcast, and whether their gas price makes their inclusion likely
+compared to the gas prices of recently included messages.
+`,
 	},
 	Arguments: []cmdkit.Argument{
 		cmdkit.StringArg("address", false, false, "Address of the queue to list (otherwise lists all)"),
@@ -40,8 +50,11 @@ var outboxLsCmd = &cmds.Command{
 		}
 
 		for _, addr := range addresses {
-			msgs := GetPorcelainAPI(env).OutboxQueueLs(addr)
-			err := re.Emit(OutboxLsResult{addr, msgs})
+			msgs, err := GetPorcelainAPI(env).OutboxLs(req.Context, addr)
+			if err != nil {
+				return err
+			}
+			err = re.Emit(OutboxLsResult{addr, msgs})
 			if err != nil {
 				return err
 			}
@@ -53,9 +66,9 @@ var outboxLsCmd = &cmds.Command{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, queue *OutboxLsResult) error {
 			sw := NewSilentWriter(w)
 			sw.Println("From:", queue.Address.String())
-			for _, qm := range queue.Messages {
-				msg := qm.Msg
-				sw.Printf("%s, height: %d\n", msg.String(), qm.Stamp)
+			for _, om := range queue.Messages {
+				msg := om.Msg
+				sw.Printf("%s, height: %d, age: %d, broadcasts: %d, inclusion: %s\n", msg.String(), om.Stamp, om.Age, om.Broadcasts, om.Inclusion)
 			}
 			return sw.Error()
 		}),
@@ -83,6 +96,57 @@ var outboxClearCmd = &cmds.Command{
 	Encoders: cmds.EncoderMap{},
 }
 
+// OutboxReplaceResult is the result of replacing an outbox message.
+type OutboxReplaceResult struct {
+	Cid cid.Cid
+}
+
+var outboxReplaceCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Replace a sent but un-mined message with a higher gas price",
+		ShortDescription: `
+Re-signs a message of the outbound queue with a higher gas price and the same
+nonce, and sends it in place of the original. This unsticks messages whose gas
+price is too low for miners to include them. Prints the cid of the new message.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("cid", true, false, "CID of the message to replace"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("gas-price", "New price (FIL e.g. 0.00013) to pay for each GasUnits consumed mining this message"),
+		cmdkit.Uint64Option("gas-limit", "New maximum number of GasUnits this message is allowed to consume (otherwise keeps the current limit)"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		msgCid, err := cid.Parse(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid message cid")
+		}
+
+		priceOption, ok := req.Options["gas-price"].(string)
+		if !ok {
+			return errors.New("price option is required")
+		}
+		gasPrice, ok := types.NewAttoFILFromFILString(priceOption)
+		if !ok {
+			return errors.New("invalid gas price (specify FIL as a decimal number)")
+		}
+		gasLimit, _ := req.Options["gas-limit"].(uint64)
+
+		c, err := GetPorcelainAPI(env).OutboxReplace(req.Context, msgCid, *gasPrice, types.NewGasUnits(gasLimit))
+		if err != nil {
+			return err
+		}
+		return re.Emit(&OutboxReplaceResult{c})
+	},
+	Type: &OutboxReplaceResult{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, res *OutboxReplaceResult) error {
+			return PrintString(w, res.Cid)
+		}),
+	},
+}
+
 // Reads an address from an argument, or lists addresses of all outbox queues if no arg is given.
 func queueAddressesFromArg(req *cmds.Request, env cmds.Environment, argIndex int) ([]address.Address, error) {
 	var addresses []address.Address
@@ -44,6 +44,24 @@ func TestOutbox(t *testing.T) {
 		assert.NotContains(out, c1)
 		assert.NotContains(out, c2)
 		assert.Contains(out, c3)
+		assert.Contains(out, "broadcasts: 1")
+		assert.Contains(out, "inclusion: likely")
+	})
+
+	t.Run("replace message", func(t *testing.T) {
+		t.Parallel()
+		d := th.NewDaemon(t, th.KeyFile(fixtures.KeyFilePaths()[0])).Start()
+		defer d.ShutdownSuccess()
+
+		c1 := sendMessage(d, fixtures.TestAddresses[0], fixtures.TestAddresses[2]).ReadStdoutTrimNewlines()
+
+		d.RunFail("must be greater", "outbox", "replace", c1, "--gas-price", "0")
+		c2 := d.RunSuccess("outbox", "replace", c1, "--gas-price", "0.001").ReadStdoutTrimNewlines()
+		assert.NotEqual(c1, c2)
+
+		out := d.RunSuccess("outbox", "ls").ReadStdout()
+		assert.NotContains(out, c1)
+		assert.Contains(out, c2)
 	})
 
 	t.Run("clear queue", func(t *testing.T) {
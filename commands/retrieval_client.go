@@ -41,7 +41,12 @@ var clientRetrievePieceCmd = &cmds.Command{
 			return err
 		}
 
-		readCloser, err := GetRetrievalAPI(env).RetrievePiece(req.Context, pieceCID, mpid, minerAddr)
+		maddrs, err := GetPorcelainAPI(env).MinerGetMultiaddrs(req.Context, minerAddr)
+		if err != nil {
+			return err
+		}
+
+		readCloser, err := GetRetrievalAPI(env).RetrievePiece(req.Context, pieceCID, mpid, maddrs, minerAddr)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,100 @@
+package commands
+
+import (
+	"io"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	"github.com/ipfs/go-ipfs-cmds"
+
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+var stateCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Inspect the state of the chain",
+	},
+	Subcommands: map[string]*cmds.Command{
+		"diff": stateDiffCmd,
+	},
+}
+
+var stateDiffCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show the actors changed between the states of two tipsets",
+		ShortDescription: `
+Shows the actors added, removed or modified from the state of the first tipset
+to the state of the second, with the changes of their balance, nonce, code and
+head. The changes of the states of the builtin actors, like the asks and
+sector commitments of miners or payment channels, are decoded. Tipsets are
+given as the comma separated CIDs of their blocks.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("from", true, false, "Tipset whose state to diff from"),
+		cmdkit.StringArg("to", true, false, "Tipset whose state to diff to"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		from, err := parseTipSetKey(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+		to, err := parseTipSetKey(req.Arguments[1])
+		if err != nil {
+			return err
+		}
+
+		diffs, err := GetPorcelainAPI(env).StateDiff(req.Context, from, to)
+		if err != nil {
+			return err
+		}
+		for _, diff := range diffs {
+			if err := re.Emit(diff); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type: state.ActorDiff{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, diff *state.ActorDiff) error {
+			sw := NewSilentWriter(w)
+			printActorDiff(sw, diff)
+			return sw.Error()
+		}),
+	},
+}
+
+// printActorDiff prints the change of an actor and of its state.
+func printActorDiff(sw *SilentWriter, diff *state.ActorDiff) {
+	switch {
+	case diff.Before == nil:
+		sw.Printf("+ %s %s balance=%s nonce=%d head=%s\n", diff.Address, types.ActorCodeTypeName(diff.After.Code), diff.After.Balance, diff.After.Nonce, diff.After.Head)
+	case diff.After == nil:
+		sw.Printf("- %s %s balance=%s nonce=%d head=%s\n", diff.Address, types.ActorCodeTypeName(diff.Before.Code), diff.Before.Balance, diff.Before.Nonce, diff.Before.Head)
+	default:
+		sw.Printf("~ %s %s\n", diff.Address, types.ActorCodeTypeName(diff.After.Code))
+		if !diff.Before.Balance.Equal(diff.After.Balance) {
+			sw.Printf("  balance: %s -> %s\n", diff.Before.Balance, diff.After.Balance)
+		}
+		if diff.Before.Nonce != diff.After.Nonce {
+			sw.Printf("  nonce: %d -> %d\n", diff.Before.Nonce, diff.After.Nonce)
+		}
+		if !diff.Before.Code.Equals(diff.After.Code) {
+			sw.Printf("  code: %s -> %s\n", diff.Before.Code, diff.After.Code)
+		}
+		if !diff.Before.Head.Equals(diff.After.Head) {
+			sw.Printf("  head: %s -> %s\n", diff.Before.Head, diff.After.Head)
+		}
+	}
+	for _, change := range diff.State {
+		switch {
+		case change.Before == "":
+			sw.Printf("  + %s: %s\n", change.Field, change.After)
+		case change.After == "":
+			sw.Printf("  - %s: %s\n", change.Field, change.Before)
+		default:
+			sw.Printf("  ~ %s: %s -> %s\n", change.Field, change.Before, change.After)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package commands_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/filecoin-project/go-filecoin/fixtures"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestStateDiff(t *testing.T) {
+	t.Parallel()
+	d := makeTestDaemonWithMinerAndStart(t)
+	defer d.ShutdownSuccess()
+
+	assert := assert.New(t)
+
+	before := d.RunSuccess("chain", "head", "--enc=text").ReadStdoutTrimNewlines()
+	d.RunSuccess(
+		"message", "send",
+		"--from", fixtures.TestAddresses[0],
+		"--gas-price", "0", "--gas-limit", "300",
+		"--value=10",
+		fixtures.TestAddresses[1],
+	)
+	d.RunSuccess("mining", "once")
+	after := d.RunSuccess("chain", "head", "--enc=text").ReadStdoutTrimNewlines()
+
+	out := d.RunSuccess("state", "diff", before, after).ReadStdout()
+	assert.Contains(out, fixtures.TestAddresses[0])
+	assert.Contains(out, fixtures.TestAddresses[1])
+	assert.Contains(out, "balance: ")
+
+	assert.Empty(d.RunSuccess("state", "diff", after, after).ReadStdoutTrimNewlines())
+
+	d.RunFail("invalid tipset", "state", "diff", "notacid", after)
+	d.RunFail("failed to get tipset", "state", "diff", types.SomeCid().String(), after)
+}
@@ -39,13 +39,15 @@ var swarmPeersCmd = &cmds.Command{
 		cmdkit.BoolOption("verbose", "v", "Display all extra information"),
 		cmdkit.BoolOption("streams", "Also list information about open streams for each peer"),
 		cmdkit.BoolOption("latency", "Also list information about latency to each peer"),
+		cmdkit.BoolOption("scores", "Also list the score of each peer"),
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		verbose, _ := req.Options["verbose"].(bool)
 		latency, _ := req.Options["latency"].(bool)
 		streams, _ := req.Options["streams"].(bool)
+		scores, _ := req.Options["scores"].(bool)
 
-		out, err := GetPorcelainAPI(env).NetworkPeers(req.Context, verbose, latency, streams)
+		out, err := GetPorcelainAPI(env).NetworkPeers(req.Context, verbose, latency, streams, scores)
 		if err != nil {
 			return err
 		}
@@ -65,6 +67,12 @@ var swarmPeersCmd = &cmds.Command{
 				if info.Latency != "" {
 					fmt.Fprintf(w, " %s", info.Latency) // nolint: errcheck
 				}
+				if info.Score != nil {
+					fmt.Fprintf(w, " score %d", info.Score.Score) // nolint: errcheck
+					if len(info.Score.Protected) > 0 {
+						fmt.Fprintf(w, " protected (%s)", strings.Join(info.Score.Protected, ", ")) // nolint: errcheck
+					}
+				}
 				fmt.Fprintln(w) // nolint: errcheck
 
 				for _, s := range info.Streams {
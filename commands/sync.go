@@ -0,0 +1,81 @@
+package commands
+
+import (
+	"io"
+	"time"
+
+	"github.com/ipfs/go-ipfs-cmdkit"
+	"github.com/ipfs/go-ipfs-cmds"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+)
+
+var syncCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Inspect the chain syncer",
+	},
+	Subcommands: map[string]*cmds.Command{
+		"status": syncStatusCmd,
+		"wait":   syncWaitCmd,
+	},
+}
+
+var syncStatusCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show the progress of the chain sync",
+		ShortDescription: `
+Shows the tipsets the node is syncing to, with the peer they came from, their
+height and the stage of their sync, the height of the highest validated tipset,
+and the most recent sync failures with their reasons.
+`,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		return re.Emit(GetPorcelainAPI(env).SyncStatus())
+	},
+	Type: chain.SyncStatus{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, status *chain.SyncStatus) error {
+			return printSyncStatus(NewSilentWriter(w), status)
+		}),
+	},
+}
+
+var syncWaitCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Wait until the node has no more tipsets to sync",
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		status, err := GetPorcelainAPI(env).SyncWait(req.Context)
+		if err != nil {
+			return err
+		}
+		return re.Emit(status)
+	},
+	Type: chain.SyncStatus{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, status *chain.SyncStatus) error {
+			return printSyncStatus(NewSilentWriter(w), status)
+		}),
+	},
+}
+
+func printSyncStatus(sw *SilentWriter, status *chain.SyncStatus) error {
+	sw.Printf("Validated height: %d\n", status.ValidatedHeight)
+	if len(status.Targets) == 0 {
+		sw.Println("Syncing: no")
+	} else {
+		sw.Println("Syncing:")
+	}
+	for _, t := range status.Targets {
+		sw.Printf("  %s, peer: %s, height: %d, stage: %s, fetched: %d, validated: %d, elapsed: %s\n",
+			t.Head.String(), t.Peer, t.Height, t.Stage, t.Fetched, t.Validated, time.Since(t.Started).Round(time.Second))
+	}
+	if len(status.Failures) > 0 {
+		sw.Println("Recent failures:")
+	}
+	for _, f := range status.Failures {
+		sw.Printf("  %s, peer: %s, height: %d, stage: %s, at: %s, error: %s\n",
+			f.Head.String(), f.Peer, f.Height, f.Stage, f.Time.Format(time.RFC3339), f.Error)
+	}
+	return sw.Error()
+}
@@ -0,0 +1,41 @@
+package commands_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+)
+
+func TestSyncStatus(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	d := th.NewDaemon(t).Start()
+	defer d.ShutdownSuccess()
+
+	out := d.RunSuccess("sync", "status").ReadStdout()
+	assert.Contains(out, "Validated height: 0")
+	assert.Contains(out, "Syncing: no")
+
+	var status chain.SyncStatus
+	require.NoError(json.Unmarshal([]byte(d.RunSuccess("sync", "status", "--enc=json").ReadStdout()), &status))
+	assert.False(status.Syncing())
+	assert.Empty(status.Failures)
+}
+
+func TestSyncWait(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	d := th.NewDaemon(t).Start()
+	defer d.ShutdownSuccess()
+
+	out := d.RunSuccess("sync", "wait").ReadStdout()
+	assert.Contains(out, "Syncing: no")
+}
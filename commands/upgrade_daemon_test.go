@@ -0,0 +1,140 @@
+package commands_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/commands"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	gengen "github.com/filecoin-project/go-filecoin/gengen/util"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestProtocolUpgradeDaemon(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// the network upgrades the payment broker at height 3
+	genesis := generateUpgradeGenesis(t, consensus.ProtocolUpgrade{Version: 1, Height: 3})
+	defer os.RemoveAll(genesis.dir) // nolint: errcheck
+
+	miner := th.NewDaemon(
+		t,
+		th.GenesisFile(genesis.file),
+		th.WithMiner(genesis.miner.String()),
+		th.KeyFile(genesis.keyFile),
+	).Start()
+	defer miner.ShutdownSuccess()
+	peer := th.NewDaemon(t, th.GenesisFile(genesis.file)).Start()
+	defer peer.ShutdownSuccess()
+	miner.ConnectSuccess(peer)
+
+	// a channel created before the upgrade
+	args := []string{"paych", "create"}
+	args = append(args, "--from", genesis.payer.String(), "--gas-price", "0", "--gas-limit", "300")
+	args = append(args, genesis.target.String(), "10000", "20")
+	messageCid, err := cid.Parse(miner.RunSuccess(args...).ReadStdoutTrimNewlines())
+	require.NoError(err)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		miner.WaitForMessageRequireSuccess(messageCid)
+		wg.Done()
+	}()
+	miner.MineAndPropagate(time.Second*5, peer)
+	wg.Wait()
+
+	pb := paymentBrokerView(t, miner)
+	assert.Equal(types.PaymentBrokerActorCodeCid, pb.Code)
+	assert.NotContains(pb.Exports, "getChannel")
+
+	for i := 0; i < 3; i++ {
+		miner.MineAndPropagate(time.Second*5, peer)
+	}
+
+	for _, d := range []*th.TestDaemon{miner, peer} {
+		pb := paymentBrokerView(t, d)
+		assert.Equal(types.PaymentBrokerV1ActorCodeCid, pb.Code)
+		assert.Contains(pb.Exports, "getChannel")
+
+		channels := listChannelsAsStrs(d, &genesis.payer)
+		require.Len(channels, 1)
+		assert.Contains(channels[0], "amt: 10000")
+	}
+}
+
+// upgradeGenesis is a genesis scheduling protocol upgrades, with a miner
+// owned by payer.
+type upgradeGenesis struct {
+	dir     string
+	file    string
+	keyFile string
+	miner   address.Address
+	payer   address.Address
+	target  address.Address
+}
+
+func generateUpgradeGenesis(t *testing.T, upgrades ...consensus.ProtocolUpgrade) *upgradeGenesis {
+	dir, err := ioutil.TempDir("", "upgradegenesis")
+	require.NoError(t, err)
+
+	cfg := &gengen.GenesisCfg{
+		Keys:     2,
+		PreAlloc: []string{"1000000", "1000000"},
+		Miners:   []gengen.Miner{{Owner: 0, Power: 1}},
+		Upgrades: upgrades,
+	}
+	genFile, err := os.Create(filepath.Join(dir, "genesis.car"))
+	require.NoError(t, err)
+	defer genFile.Close() // nolint: errcheck
+	info, err := gengen.GenGenesisCar(cfg, genFile, 0)
+	require.NoError(t, err)
+
+	keyFile, err := os.Create(filepath.Join(dir, "wallet.key"))
+	require.NoError(t, err)
+	defer keyFile.Close() // nolint: errcheck
+	var wsr commands.WalletSerializeResult
+	wsr.KeyInfo = append(wsr.KeyInfo, info.Keys[0])
+	require.NoError(t, json.NewEncoder(keyFile).Encode(wsr))
+
+	payer, err := info.Keys[0].Address()
+	require.NoError(t, err)
+	target, err := info.Keys[1].Address()
+	require.NoError(t, err)
+	return &upgradeGenesis{
+		dir:     dir,
+		file:    genFile.Name(),
+		keyFile: keyFile.Name(),
+		miner:   info.Miners[0].Address,
+		payer:   payer,
+		target:  target,
+	}
+}
+
+func paymentBrokerView(t *testing.T, d *th.TestDaemon) commands.ActorView {
+	out := d.RunSuccess("actor", "ls", "--enc", "json").ReadStdoutTrimNewlines()
+	for _, line := range bytes.Split([]byte(out), []byte{'\n'}) {
+		var av commands.ActorView
+		require.NoError(t, json.Unmarshal(line, &av))
+		if av.Address == address.PaymentBrokerAddress.String() {
+			return av
+		}
+	}
+	require.FailNow(t, "no payment broker in actor ls", strings.TrimSpace(out))
+	return commands.ActorView{}
+}
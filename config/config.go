@@ -26,6 +26,7 @@ type Config struct {
 	Heartbeat *HeartbeatConfig `json:"heartbeat"`
 	Net       string           `json:"net"`
 	Metrics   *MetricsConfig   `json:"metrics"`
+	Chain     *ChainConfig     `json:"chain"`
 }
 
 // APIConfig holds all configuration options related to the api.
@@ -76,11 +77,42 @@ func newDefaultDatastoreConfig() *DatastoreConfig {
 type SwarmConfig struct {
 	Address            string `json:"address"`
 	PublicRelayAddress string `json:"public_relay_address,omitempty"`
+	// LowWater and HighWater bound the number of connected peers. Above the
+	// high water mark, the connections to the least useful peers are closed
+	// down to the low water mark. A zero high water mark disables trimming.
+	LowWater  int `json:"lowWater"`
+	HighWater int `json:"highWater"`
+	// GracePeriod is how long new connections are kept before they can be
+	// trimmed.
+	GracePeriod string `json:"gracePeriod"`
+	// NATPortMap tries to open a port on the NAT with UPnP or NAT-PMP.
+	NATPortMap bool `json:"natPortMap"`
+	// AutoNATService lets other nodes check whether they are publicly
+	// dialable by having this node dial them back. Relay nodes always run it.
+	AutoNATService bool `json:"autoNATService"`
+	// RelayClient lets the node dial and be dialed through circuit relays.
+	// When the node finds it is not publicly dialable, it announces
+	// addresses through relays.
+	RelayClient bool `json:"relayClient"`
+	// RelayService relays the traffic of other nodes.
+	RelayService bool `json:"relayService"`
+	// AnnounceAddresses, if not empty, are the addresses announced to peers
+	// instead of the listen addresses.
+	AnnounceAddresses []string `json:"announceAddresses"`
+	// NoAnnounceAddresses are never announced, nor the addresses starting
+	// with them, e.g. /ip4/192.168.1.2 for all the ports of a private address.
+	NoAnnounceAddresses []string `json:"noAnnounceAddresses"`
 }
 
 func newDefaultSwarmConfig() *SwarmConfig {
 	return &SwarmConfig{
-		Address: "/ip4/0.0.0.0/tcp/6000",
+		Address:             "/ip4/0.0.0.0/tcp/6000",
+		LowWater:            50,
+		HighWater:           100,
+		GracePeriod:         "20s",
+		RelayClient:         true,
+		AnnounceAddresses:   []string{},
+		NoAnnounceAddresses: []string{},
 	}
 }
 
@@ -167,6 +199,29 @@ func newDefaultMetricsConfig() *MetricsConfig {
 	}
 }
 
+// ChainConfig holds all configuration options related to the chain.
+type ChainConfig struct {
+	// FinalityDepth is the number of rounds back from the head beyond which
+	// the node refuses reorgs. Zero allows reorgs of any depth.
+	FinalityDepth uint64 `json:"finalityDepth"`
+	// Checkpoints are tipsets trusted to be in the chain. The node rejects
+	// the chains which do not include them.
+	Checkpoints []Checkpoint `json:"checkpoints"`
+}
+
+// Checkpoint is a tipset trusted to be in the chain.
+type Checkpoint struct {
+	Height uint64             `json:"height"`
+	Tipset types.SortedCidSet `json:"tipset"`
+}
+
+func newDefaultChainConfig() *ChainConfig {
+	return &ChainConfig{
+		FinalityDepth: 900,
+		Checkpoints:   []Checkpoint{},
+	}
+}
+
 // NewDefaultConfig returns a config object with all the fields filled out to
 // their default values
 func NewDefaultConfig() *Config {
@@ -180,6 +235,7 @@ func NewDefaultConfig() *Config {
 		Heartbeat: newDefaultHeartbeatConfig(),
 		Net:       "",
 		Metrics:   newDefaultMetricsConfig(),
+		Chain:     newDefaultChainConfig(),
 	}
 }
 
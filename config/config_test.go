@@ -63,7 +63,16 @@ func TestWriteFile(t *testing.T) {
 		"path": "badger"
 	},
 	"swarm": {
-		"address": "/ip4/0.0.0.0/tcp/6000"
+		"address": "/ip4/0.0.0.0/tcp/6000",
+		"lowWater": 50,
+		"highWater": 100,
+		"gracePeriod": "20s",
+		"natPortMap": false,
+		"autoNATService": false,
+		"relayClient": true,
+		"relayService": false,
+		"announceAddresses": [],
+		"noAnnounceAddresses": []
 	},
 	"mining": {
 		"minerAddress": "empty",
@@ -84,6 +93,10 @@ func TestWriteFile(t *testing.T) {
 		"prometheusEnabled": false,
 		"reportInterval": "5s",
 		"prometheusEndpoint": "/ip4/0.0.0.0/tcp/9400"
+	},
+	"chain": {
+		"finalityDepth": 900,
+		"checkpoints": []
 	}
 }`,
 		string(content),
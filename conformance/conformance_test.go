@@ -0,0 +1,312 @@
+package conformance_test
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	bserv "github.com/ipfs/go-blockservice"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-hamt-ipld"
+	"github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-ipfs-exchange-offline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/conformance"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/core"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/state"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+)
+
+// requireMessageVector returns a vector of a message transferring funds
+// between two accounts, without its expected post-state and receipts.
+func requireMessageVector(require *require.Assertions) *conformance.Vector {
+	ctx := context.Background()
+
+	mockSigner, _ := types.NewMockSignersAndKeyInfo(2)
+	from, to := mockSigner.Addresses[0], mockSigner.Addresses[1]
+
+	bs := blockstore.NewBlockstore(ds.NewMapDatastore())
+	cst := &hamt.CborIpldStore{Blocks: bserv.New(bs, offline.Exchange(bs))}
+	root, _ := th.RequireMakeStateTree(require, cst, map[address.Address]*actor.Actor{
+		address.NetworkAddress: th.RequireNewAccountActor(require, types.NewAttoFILFromFIL(1000000)),
+		from:                   th.RequireNewAccountActor(require, types.NewAttoFILFromFIL(100)),
+		to:                     th.RequireNewAccountActor(require, types.NewAttoFILFromFIL(0)),
+	})
+	preState, err := conformance.ExportState(ctx, bs, root)
+	require.NoError(err)
+
+	minerOwner, err := address.NewActorAddress([]byte("mo"))
+	require.NoError(err)
+
+	msg := types.NewMessage(from, to, 0, types.NewAttoFILFromFIL(10), "", nil)
+	smsg, err := types.NewSignedMessage(*msg, &mockSigner, types.NewGasPrice(0), types.NewGasUnits(0))
+	require.NoError(err)
+
+	return &conformance.Vector{
+		Description: "transfer between accounts",
+		PreState:    preState,
+		Messages:    []*types.SignedMessage{smsg},
+		Height:      20,
+		MinerOwner:  minerOwner,
+	}
+}
+
+// requireTipSetVector returns the vector extracted from a chain whose head
+// is a tipset of two blocks by two miners, each holding a transfer from
+// another account.
+func requireTipSetVector(require *require.Assertions) *conformance.Vector {
+	ctx := context.Background()
+
+	mockSigner, _ := types.NewMockSignersAndKeyInfo(6)
+	senders := mockSigner.Addresses[0:2]
+	to, owner := mockSigner.Addresses[2], mockSigner.Addresses[3]
+	miners := mockSigner.Addresses[4:]
+
+	r := repo.NewInMemoryRepo()
+	bs := blockstore.NewBlockstore(r.Datastore())
+	cst := &hamt.CborIpldStore{Blocks: bserv.New(bs, offline.Exchange(bs))}
+	chainStore, err := chain.Init(ctx, r, bs, cst, consensus.MakeGenesisFunc(
+		consensus.ActorAccount(senders[0], types.NewAttoFILFromFIL(100)),
+		consensus.ActorAccount(senders[1], types.NewAttoFILFromFIL(100)),
+		consensus.ActorAccount(owner, types.NewAttoFILFromFIL(0)),
+		consensus.MinerActor(miners[0], owner, []byte{}, 1000, th.RequireRandomPeerID(require), types.ZeroAttoFIL),
+		consensus.MinerActor(miners[1], owner, []byte{}, 1000, th.RequireRandomPeerID(require), types.ZeroAttoFIL),
+	))
+	require.NoError(err)
+
+	genesis := chainStore.Head()
+	genesisRoot := genesis.ToSlice()[0].StateRoot
+	var blks []*types.Block
+	for i, minerAddr := range miners {
+		msg := types.NewMessage(senders[i], to, 0, types.NewAttoFILFromFIL(10), "", nil)
+		smsg, err := types.NewSignedMessage(*msg, &mockSigner, types.NewGasPrice(0), types.NewGasUnits(0))
+		require.NoError(err)
+
+		blk := th.RequireMkFakeChild(require, th.FakeChildParams{
+			MinerAddr:   minerAddr,
+			Nonce:       uint64(i),
+			Parent:      genesis,
+			GenesisCid:  chainStore.GenesisCid(),
+			StateRoot:   genesisRoot,
+			Signer:      mockSigner,
+			MinerPubKey: mockSigner.PubKeys[4+i],
+		})
+		blk.Messages = []*types.SignedMessage{smsg}
+		core.MustPut(cst, blk)
+		blks = append(blks, blk)
+	}
+	ts := th.RequireNewTipSet(require, blks...)
+
+	st, err := state.LoadStateTree(ctx, cst, genesisRoot, builtin.Actors)
+	require.NoError(err)
+	vms := vm.NewStorageMap(bs)
+	processor := consensus.NewScheduledProcessor(consensus.DefaultProtocolSchedule(), nil, consensus.NewDefaultBlockRewarder())
+	_, err = processor.ProcessTipSet(ctx, st, vms, ts, []types.TipSet{genesis})
+	require.NoError(err)
+	require.NoError(vms.Flush())
+	root, err := st.Flush(ctx)
+	require.NoError(err)
+
+	th.RequirePutTsas(ctx, require, chainStore, &chain.TipSetAndState{TipSet: ts, TipSetStateRoot: root})
+	require.NoError(chainStore.SetHead(ctx, ts))
+
+	v, err := conformance.NewExtractor(chainStore, bs, consensus.DefaultProtocolSchedule()).Extract(ctx, ts.ToSortedCidSet())
+	require.NoError(err)
+	return v
+}
+
+func TestExportState(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	bs := blockstore.NewBlockstore(ds.NewMapDatastore())
+	cst := &hamt.CborIpldStore{Blocks: bserv.New(bs, offline.Exchange(bs))}
+	root, _ := th.RequireMakeStateTree(require, cst, map[address.Address]*actor.Actor{
+		address.NetworkAddress: th.RequireNewAccountActor(require, types.NewAttoFILFromFIL(1000000)),
+	})
+	preState, err := conformance.ExportState(context.Background(), bs, root)
+	require.NoError(err)
+	assert.NotEmpty(preState)
+
+	// the code objects exported are not written to the blockstore
+	has, err := bs.Has(types.AccountActorCodeObj.Cid())
+	require.NoError(err)
+	assert.False(has)
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("vector of messages", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		v := requireMessageVector(require)
+		result, err := conformance.Apply(ctx, v)
+		require.NoError(err)
+		require.Len(result.Receipts, 1)
+		assert.Equal(uint8(0), result.Receipts[0].ExitCode)
+
+		v.PostStateRoot = result.PostStateRoot
+		v.Receipts = result.Receipts
+		assert.NoError(conformance.Run(ctx, v))
+	})
+
+	t.Run("encoded vectors run the same", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		v := requireMessageVector(require)
+		result, err := conformance.Apply(ctx, v)
+		require.NoError(err)
+		v.PostStateRoot = result.PostStateRoot
+		v.Receipts = result.Receipts
+
+		data, err := v.EncodeJSON()
+		require.NoError(err)
+		decoded, err := conformance.DecodeVector(data)
+		require.NoError(err)
+		assert.NoError(conformance.Run(ctx, decoded))
+
+		data, err = v.EncodeCBOR()
+		require.NoError(err)
+		decoded, err = conformance.DecodeVector(data)
+		require.NoError(err)
+		assert.NoError(conformance.Run(ctx, decoded))
+
+		_, err = conformance.DecodeVector([]byte("{nonsense"))
+		assert.Error(err)
+	})
+
+	t.Run("vector of a multi-block tipset", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		v := requireTipSetVector(require)
+		assert.Len(v.TipSet, 2)
+		require.Len(v.Receipts, 2)
+		for _, receipt := range v.Receipts {
+			assert.Equal(uint8(0), receipt.ExitCode)
+		}
+		assert.NoError(conformance.Run(ctx, v))
+	})
+
+	t.Run("mismatches fail", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		v := requireMessageVector(require)
+		result, err := conformance.Apply(ctx, v)
+		require.NoError(err)
+
+		v.PostStateRoot = types.SomeCid()
+		v.Receipts = result.Receipts
+		err = conformance.Run(ctx, v)
+		require.Error(err)
+		assert.Contains(err.Error(), "post-state root")
+
+		v.PostStateRoot = result.PostStateRoot
+		v.Receipts = []*types.MessageReceipt{{ExitCode: 1}}
+		err = conformance.Run(ctx, v)
+		require.Error(err)
+		assert.Contains(err.Error(), "receipt 0")
+
+		v.Receipts = nil
+		assert.Error(conformance.Run(ctx, v))
+
+		v.PreState = []byte("not a car")
+		assert.Error(conformance.Run(ctx, v))
+	})
+
+	t.Run("vectors run with their protocol upgrades", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		v := requireMessageVector(require)
+		v.ProtocolUpgrades = []consensus.ProtocolUpgrade{{Version: 1, Height: 10}}
+		schedule, err := v.Schedule()
+		require.NoError(err)
+		assert.Equal(uint64(1), schedule.VersionAt(uint64(v.Height)).Version)
+
+		result, err := conformance.Apply(ctx, v)
+		require.NoError(err)
+		v.PostStateRoot = result.PostStateRoot
+		v.Receipts = result.Receipts
+
+		data, err := v.EncodeCBOR()
+		require.NoError(err)
+		decoded, err := conformance.DecodeVector(data)
+		require.NoError(err)
+		assert.Equal(v.ProtocolUpgrades, decoded.ProtocolUpgrades)
+		assert.NoError(conformance.Run(ctx, decoded))
+
+		v.ProtocolUpgrades = []consensus.ProtocolUpgrade{{Version: 5, Height: 10}}
+		_, err = conformance.Apply(ctx, v)
+		assert.Error(err)
+	})
+}
+
+var writeVectors = flag.Bool("write-vectors", false, "Write the vectors built by the tests to testdata")
+
+// TestWriteVectors writes the vectors built by the tests to testdata, where
+// TestVectors runs them, when -write-vectors is given. The vectors written
+// are committed, so that TestVectors catches changes to the transitions.
+func TestWriteVectors(t *testing.T) {
+	if !*writeVectors {
+		t.SkipNow()
+	}
+	require := require.New(t)
+
+	transfer := requireMessageVector(require)
+	result, err := conformance.Apply(context.Background(), transfer)
+	require.NoError(err)
+	transfer.PostStateRoot = result.PostStateRoot
+	transfer.Receipts = result.Receipts
+
+	require.NoError(os.MkdirAll("testdata", 0755))
+	for name, v := range map[string]*conformance.Vector{
+		"transfer-between-accounts.json": transfer,
+		"multi-block-tipset.json":        requireTipSetVector(require),
+	} {
+		data, err := v.EncodeJSON()
+		require.NoError(err)
+		require.NoError(ioutil.WriteFile(filepath.Join("testdata", name), data, 0644))
+	}
+}
+
+// TestVectors runs the vectors in testdata, like those extracted from the
+// blockchain with `go-filecoin debug extract-vector`.
+func TestVectors(t *testing.T) {
+	ctx := context.Background()
+
+	files, err := filepath.Glob(filepath.Join("testdata", "*"))
+	require.NoError(t, err)
+	// Passing without vectors would hide regressions.
+	require.NotEmpty(t, files, "no vectors in testdata, write them with go test ./conformance -write-vectors")
+
+	for _, file := range files {
+		file := file
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			require := require.New(t)
+
+			data, err := ioutil.ReadFile(file)
+			require.NoError(err)
+			v, err := conformance.DecodeVector(data)
+			require.NoError(err)
+			require.NoError(conformance.Run(ctx, v))
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	bserv "github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-car"
+	"github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-ipfs-exchange-offline"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/sampling"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// Extractor extracts vectors from the tipsets of the blockchain.
+type Extractor struct {
+	// To find tipsets, their states and ancestors.
+	chainReader chain.ReadStore
+	// To export the states of tipsets.
+	bs bstore.Blockstore
+	// To compute the receipts of tipsets, and recorded in the vectors.
+	schedule *consensus.ProtocolSchedule
+}
+
+// NewExtractor returns a new Extractor.
+func NewExtractor(chainReader chain.ReadStore, bs bstore.Blockstore, schedule *consensus.ProtocolSchedule) *Extractor {
+	return &Extractor{chainReader: chainReader, bs: bs, schedule: schedule}
+}
+
+// Extract returns the vector of the transition from the state of the parent
+// of a tipset to the state of the tipset. The chain keeps the receipts of
+// blocks, not of tipsets, so the receipts are computed by processing the
+// tipset, which must result in the state the chain has for it.
+func (e *Extractor) Extract(ctx context.Context, tsKey types.SortedCidSet) (*Vector, error) {
+	tsas, err := e.chainReader.GetTipSetAndState(ctx, tsKey.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get tipset %s", tsKey.String())
+	}
+	parentKey, err := tsas.TipSet.Parents()
+	if err != nil {
+		return nil, err
+	}
+	if parentKey.Empty() {
+		return nil, fmt.Errorf("tipset %s has no parent", tsKey.String())
+	}
+	parent, err := e.chainReader.GetTipSetAndState(ctx, parentKey.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get parent tipset %s", parentKey.String())
+	}
+
+	h, err := tsas.TipSet.Height()
+	if err != nil {
+		return nil, err
+	}
+	ancestors, err := chain.GetRecentAncestors(ctx, parent.TipSet, e.chainReader, types.NewBlockHeight(h), consensus.AncestorRoundsNeeded, sampling.LookbackParameter)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get ancestors")
+	}
+
+	preState, err := ExportState(ctx, e.bs, parent.TipSetStateRoot)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to export pre-state")
+	}
+
+	v := &Vector{
+		Description:      fmt.Sprintf("tipset %s at height %d", tsKey.String(), h),
+		ProtocolUpgrades: e.schedule.Upgrades(),
+		PreState:         preState,
+		TipSet:           tsas.TipSet.ToSlice(),
+		PostStateRoot:    tsas.TipSetStateRoot,
+	}
+	for _, ancestor := range ancestors {
+		v.Ancestors = append(v.Ancestors, ancestor.ToSlice())
+	}
+
+	result, err := Apply(ctx, v)
+	if err != nil {
+		return nil, err
+	}
+	if !result.PostStateRoot.Equals(v.PostStateRoot) {
+		return nil, fmt.Errorf("processing tipset %s results in state %s, but the chain has %s", tsKey.String(), result.PostStateRoot, v.PostStateRoot)
+	}
+	v.Receipts = result.Receipts
+
+	return v, nil
+}
+
+// builtinCode holds the code objects of the builtin actors, which the
+// actors of a state link to.
+var builtinCode = []ipld.Node{
+	types.AccountActorCodeObj,
+	types.StorageMarketActorCodeObj,
+	types.PaymentBrokerActorCodeObj,
+	types.PaymentBrokerV1ActorCodeObj,
+	types.MinerActorCodeObj,
+	types.BootstrapMinerActorCodeObj,
+	types.InitActorCodeObj,
+}
+
+// ExportState returns a CAR file of the state tree of the given root and of
+// the storage of its actors, as held by a vector. The code objects of the
+// builtin actors are exported with it, without being added to the
+// blockstore.
+func ExportState(ctx context.Context, bs bstore.Blockstore, root cid.Cid) ([]byte, error) {
+	scratch := state.NewScratchStore(bs)
+	for _, code := range builtinCode {
+		if err := scratch.Put(code); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	dserv := dag.NewDAGService(bserv.New(scratch, offline.Exchange(scratch)))
+	if err := car.WriteCar(ctx, dserv, []cid.Cid{root}, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,129 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	bserv "github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-car"
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-hamt-ipld"
+	"github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-ipfs-exchange-offline"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+)
+
+// Result is the outcome of the transition of a vector.
+type Result struct {
+	PostStateRoot cid.Cid
+	Receipts      []*types.MessageReceipt
+}
+
+// Apply applies the transition of a vector to its pre-state with the
+// processor of its protocol schedule. Tipsets are processed by
+// ProcessTipSet, messages by ApplyMessagesAndPayRewards.
+func Apply(ctx context.Context, v *Vector) (*Result, error) {
+	schedule, err := v.Schedule()
+	if err != nil {
+		return nil, err
+	}
+
+	bs := blockstore.NewBlockstore(ds.NewMapDatastore())
+	header, err := car.LoadCar(bs, bytes.NewReader(v.PreState))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load pre-state")
+	}
+	if len(header.Roots) != 1 {
+		return nil, fmt.Errorf("expected pre-state with a single root, got %d", len(header.Roots))
+	}
+
+	cst := &hamt.CborIpldStore{Blocks: bserv.New(bs, offline.Exchange(bs))}
+	st, err := state.LoadStateTree(ctx, cst, header.Roots[0], builtin.Actors)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load pre-state tree")
+	}
+	vms := vm.NewStorageMap(bs)
+
+	var ancestors []types.TipSet
+	for i, blks := range v.Ancestors {
+		ts, err := types.NewTipSet(blks...)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid ancestor %d", i)
+		}
+		ancestors = append(ancestors, ts)
+	}
+
+	processor := consensus.NewScheduledProcessor(schedule, nil, consensus.NewDefaultBlockRewarder())
+	var results []*consensus.ApplicationResult
+	if len(v.TipSet) > 0 {
+		ts, err := types.NewTipSet(v.TipSet...)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid tipset")
+		}
+		res, err := processor.ProcessTipSet(ctx, st, vms, ts, ancestors)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to process tipset")
+		}
+		results = res.Results
+	} else {
+		res, err := processor.ApplyMessagesAndPayRewards(ctx, st, vms, v.Messages, v.MinerOwner, types.NewBlockHeight(uint64(v.Height)), ancestors)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to apply messages")
+		}
+		results = res.Results
+	}
+
+	if err := vms.Flush(); err != nil {
+		return nil, errors.Wrap(err, "failed to flush actor storage")
+	}
+	root, err := st.Flush(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to flush state tree")
+	}
+
+	result := &Result{PostStateRoot: root}
+	for _, r := range results {
+		result.Receipts = append(result.Receipts, r.Receipt)
+	}
+	return result, nil
+}
+
+// Run applies the transition of a vector and checks it results in the
+// expected post-state and receipts.
+func Run(ctx context.Context, v *Vector) error {
+	result, err := Apply(ctx, v)
+	if err != nil {
+		return err
+	}
+
+	if len(result.Receipts) != len(v.Receipts) {
+		return fmt.Errorf("got %d receipts, expected %d", len(result.Receipts), len(v.Receipts))
+	}
+	for i, r := range result.Receipts {
+		got, err := cbor.DumpObject(r)
+		if err != nil {
+			return err
+		}
+		expected, err := cbor.DumpObject(v.Receipts[i])
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(got, expected) {
+			return fmt.Errorf("receipt %d is %+v, expected %+v", i, r, v.Receipts[i])
+		}
+	}
+
+	if !result.PostStateRoot.Equals(v.PostStateRoot) {
+		return fmt.Errorf("post-state root is %s, expected %s", result.PostStateRoot, v.PostStateRoot)
+	}
+	return nil
+}
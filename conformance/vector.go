@@ -0,0 +1,97 @@
+// Package conformance implements test vectors for the state transitions of
+// the Filecoin VM: a state, the messages or tipset applied to it and the
+// resulting state and receipts. Vectors are run against the processor of the
+// protocol schedule they record to check an implementation reproduces the
+// transitions.
+// Vectors extracted from the blockchain go in testdata, where they are run
+// as tests.
+package conformance
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/ipfs/go-cid"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func init() {
+	cbor.RegisterCborType(Vector{})
+	cbor.RegisterCborType(consensus.ProtocolUpgrade{})
+}
+
+// Vector is a test vector for a state transition. A transition applies
+// either a tipset or, when there is none, messages in a block of a height
+// whose reward goes to a miner owner.
+type Vector struct {
+	// Description tells where the vector comes from or what it tests.
+	Description string `json:"description"`
+
+	// ProtocolUpgrades holds the upgrades of the protocol schedule of the
+	// network the vector comes from, which the transition is applied with.
+	ProtocolUpgrades []consensus.ProtocolUpgrade `json:"protocolUpgrades,omitempty" refmt:",omitempty"`
+
+	// PreState is a CAR file of the state tree the transition applies to
+	// and of the storage of its actors, rooted at the root of the tree.
+	PreState []byte `json:"preState"`
+
+	// TipSet holds the blocks of the tipset applied.
+	TipSet []*types.Block `json:"tipSet,omitempty" refmt:",omitempty"`
+	// Ancestors holds the tipsets preceding the tipset, or the block of the
+	// messages, the most recent first. They are sampled for randomness.
+	Ancestors [][]*types.Block `json:"ancestors,omitempty" refmt:",omitempty"`
+
+	// Messages holds the messages applied when there is no tipset.
+	Messages []*types.SignedMessage `json:"messages,omitempty" refmt:",omitempty"`
+	// Height is the height of the block of the messages.
+	Height types.Uint64 `json:"height,omitempty" refmt:",omitempty"`
+	// MinerOwner is the owner of the miner of the block of the messages.
+	MinerOwner address.Address `json:"minerOwner"`
+
+	// PostStateRoot is the root of the state tree after the transition.
+	PostStateRoot cid.Cid `json:"postStateRoot"`
+	// Receipts holds the receipts of the messages successfully applied, in
+	// order of application.
+	Receipts []*types.MessageReceipt `json:"receipts"`
+}
+
+// Schedule returns the protocol schedule the transition is applied with: the
+// protocol versions of the implementation, upgraded to at the heights of
+// the upgrades of the vector.
+func (v *Vector) Schedule() (*consensus.ProtocolSchedule, error) {
+	schedule, err := consensus.NewProtocolSchedule(consensus.ProtocolVersions, v.ProtocolUpgrades)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid protocol upgrades")
+	}
+	return schedule, nil
+}
+
+// EncodeJSON encodes the vector to JSON.
+func (v *Vector) EncodeJSON() ([]byte, error) {
+	return json.MarshalIndent(v, "", "  ")
+}
+
+// EncodeCBOR encodes the vector to CBOR.
+func (v *Vector) EncodeCBOR() ([]byte, error) {
+	return cbor.DumpObject(v)
+}
+
+// DecodeVector decodes a vector from JSON or CBOR.
+func DecodeVector(data []byte) (*Vector, error) {
+	var v Vector
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, &v); err != nil {
+			return nil, errors.Wrap(err, "invalid JSON vector")
+		}
+		return &v, nil
+	}
+	if err := cbor.DecodeInto(data, &v); err != nil {
+		return nil, errors.Wrap(err, "invalid CBOR vector")
+	}
+	return &v, nil
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/filecoin-project/go-filecoin/vm"
+	vmerrors "github.com/filecoin-project/go-filecoin/vm/errors"
 )
 
 var (
@@ -49,6 +50,25 @@ var (
 	ErrUnorderedTipSets = errors.New("trying to order two identical tipsets")
 )
 
+// invalidTipSetError is returned by RunStateTransition for a tipset breaking
+// the rules of consensus, as opposed to one that could not be validated
+// because of a local error.
+type invalidTipSetError struct {
+	err error
+}
+
+func (e *invalidTipSetError) Error() string {
+	return e.err.Error()
+}
+
+// IsInvalidTipSet returns true if err was returned by RunStateTransition for
+// a tipset breaking the rules of consensus. Other errors of the state
+// transition, like store faults, say nothing of the tipset.
+func IsInvalidTipSet(err error) bool {
+	_, ok := errors.Cause(err).(*invalidTipSetError)
+	return ok
+}
+
 // TicketSigner is an interface for a test signer that can create tickets.
 type TicketSigner interface {
 	GetAddressForPubKey(pk []byte) (address.Address, error)
@@ -121,7 +141,7 @@ func NewExpected(cs *hamt.CborIpldStore, bs blockstore.Blockstore, processor Pro
 // and parent sets.
 func (c *Expected) NewValidTipSet(ctx context.Context, blks []*types.Block) (types.TipSet, error) {
 	for _, blk := range blks {
-		if err := c.validateBlockStructure(ctx, blk); err != nil {
+		if err := ValidateBlockStructure(ctx, blk); err != nil {
 			return nil, err
 		}
 	}
@@ -133,9 +153,9 @@ func (c *Expected) NewValidTipSet(ctx context.Context, blks []*types.Block) (typ
 // properly filled out and its signatures are correct. Checking the validity of
 // state changes must be done separately and only once the state of the
 // previous block has been validated. TODO: not yet signature checking
-func (c *Expected) validateBlockStructure(ctx context.Context, b *types.Block) error {
+func ValidateBlockStructure(ctx context.Context, b *types.Block) error {
 	// TODO: validate signature on block
-	ctx = log.Start(ctx, "Expected.validateBlockStructure")
+	ctx = log.Start(ctx, "ValidateBlockStructure")
 	log.LogKV(ctx, "ValidateBlockStructure", b.Cid().String())
 	if !b.StateRoot.Defined() {
 		return fmt.Errorf("block has nil StateRoot")
@@ -291,7 +311,7 @@ func (c *Expected) validateMining(ctx context.Context, st state.Tree, ts types.T
 		}
 
 		if !result {
-			return errors.New("not a winning ticket")
+			return &invalidTipSetError{errors.New("not a winning ticket")}
 		}
 	}
 	return nil
@@ -372,11 +392,16 @@ func (c *Expected) runMessages(ctx context.Context, st state.Tree, vms vm.Storag
 
 		receipts, err := c.processor.ProcessBlock(ctx, cpySt, vms, blk, ancestors)
 		if err != nil {
+			// Messages that can't be applied make the block invalid,
+			// faults don't.
+			if !vmerrors.IsFault(err) {
+				err = &invalidTipSetError{err}
+			}
 			return nil, errors.Wrap(err, "error validating block state")
 		}
 		// TODO: check that receipts actually match
 		if len(receipts) != len(blk.MessageReceipts) {
-			return nil, fmt.Errorf("found invalid message receipts: %v %v", receipts, blk.MessageReceipts)
+			return nil, &invalidTipSetError{fmt.Errorf("found invalid message receipts: %v %v", receipts, blk.MessageReceipts)}
 		}
 
 		outCid, err := cpySt.Flush(ctx)
@@ -384,7 +409,7 @@ func (c *Expected) runMessages(ctx context.Context, st state.Tree, vms vm.Storag
 			return nil, errors.Wrap(err, "error validating block state")
 		}
 		if !outCid.Equals(blk.StateRoot) {
-			return nil, ErrStateRootMismatch
+			return nil, &invalidTipSetError{ErrStateRootMismatch}
 		}
 	}
 	if len(ts) == 1 { // block validation state == aggregate parent state
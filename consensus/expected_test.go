@@ -36,7 +36,7 @@ func TestNewExpected(t *testing.T) {
 	})
 }
 
-// TestExpected_NewValidTipSet also tests validateBlockStructure.
+// TestExpected_NewValidTipSet also tests ValidateBlockStructure.
 func TestExpected_NewValidTipSet(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -186,6 +186,28 @@ func TestExpected_RunStateTransition_validateMining(t *testing.T) {
 
 		_, err = exp.RunStateTransition(ctx, tipSet, []types.TipSet{pTipSet}, stateTree)
 		assert.EqualError(err, "can't check for winning ticket: Couldn't get minerPower: something went wrong with the miner power")
+		assert.False(consensus.IsInvalidTipSet(err))
+	})
+
+	t.Run("returns an invalid tipset error when the ticket does not win", func(t *testing.T) {
+		ptv := testhelpers.NewTestPowerTableView(0, 5)
+		exp := consensus.NewExpected(cistore, bstore, testhelpers.NewTestProcessor(), ptv, genesisBlock.Cid(), verifier)
+
+		pTipSet, err := exp.NewValidTipSet(ctx, []*types.Block{genesisBlock})
+		require.NoError(err)
+
+		stateTree, err := state.LoadStateTree(ctx, cistore, genesisBlock.StateRoot, builtin.Actors)
+		require.NoError(err)
+		vms := vm.NewStorageMap(bstore)
+
+		blocks := requireMakeBlocks(ctx, require, pTipSet, stateTree, vms)
+
+		tipSet, err := exp.NewValidTipSet(ctx, blocks)
+		require.NoError(err)
+
+		_, err = exp.RunStateTransition(ctx, tipSet, []types.TipSet{pTipSet}, stateTree)
+		assert.EqualError(err, "not a winning ticket")
+		assert.True(consensus.IsInvalidTipSet(err))
 	})
 }
 
@@ -3,6 +3,7 @@ package consensus
 import (
 	"context"
 	"math/big"
+	"sort"
 
 	"github.com/ipfs/go-hamt-ipld"
 	"github.com/ipfs/go-ipfs-blockstore"
@@ -11,6 +12,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/actor/builtin"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/account"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/initactor"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
@@ -41,6 +43,7 @@ type Config struct {
 	nonces   map[address.Address]uint64
 	actors   map[address.Address]*actor.Actor
 	miners   map[address.Address]*miner.State
+	upgrades []ProtocolUpgrade
 }
 
 // GenOption is a configuration option for the GenesisInitFunction.
@@ -80,6 +83,15 @@ func AddActor(addr address.Address, actor *actor.Actor) GenOption {
 	}
 }
 
+// Upgrades returns a config option that schedules the upgrades of the network
+// to later protocol versions.
+func Upgrades(upgrades ...ProtocolUpgrade) GenOption {
+	return func(gc *Config) error {
+		gc.upgrades = append(gc.upgrades, upgrades...)
+		return nil
+	}
+}
+
 // NewEmptyConfig inits and returns an empty config
 func NewEmptyConfig() *Config {
 	return &Config{
@@ -151,6 +163,12 @@ func MakeGenesisFunc(opts ...GenOption) GenesisInitFunc {
 				return nil, err
 			}
 		}
+		if err := RegisterGenesisActorIDs(ctx, st, storageMap); err != nil {
+			return nil, err
+		}
+		if err := SetupProtocolUpgrades(ctx, st, storageMap, genCfg.upgrades); err != nil {
+			return nil, err
+		}
 
 		c, err := st.Flush(ctx)
 		if err != nil {
@@ -193,6 +211,15 @@ func SetupDefaultActors(ctx context.Context, st state.Tree, storageMap vm.Storag
 		}
 	}
 
+	initAct := initactor.NewActor()
+	err := (&initactor.Actor{}).InitializeState(storageMap.NewStorage(address.InitAddress, initAct), nil)
+	if err != nil {
+		return err
+	}
+	if err := st.SetActor(ctx, address.InitAddress, initAct); err != nil {
+		return err
+	}
+
 	stAct, err := storagemarket.NewActor()
 	if err != nil {
 		return err
@@ -215,3 +242,57 @@ func SetupDefaultActors(ctx context.Context, st state.Tree, storageMap vm.Storag
 
 	return st.SetActor(ctx, address.PaymentBrokerAddress, pbAct)
 }
+
+// SetupProtocolUpgrades records in the genesis state the heights at which the
+// network upgrades to later protocol versions. Without upgrades the state is
+// left as it is.
+func SetupProtocolUpgrades(ctx context.Context, st state.Tree, storageMap vm.StorageMap, upgrades []ProtocolUpgrade) error {
+	if len(upgrades) == 0 {
+		return nil
+	}
+	if _, err := NewProtocolSchedule(ProtocolVersions, upgrades); err != nil {
+		return err
+	}
+
+	initAct, err := st.GetActor(ctx, address.InitAddress)
+	if err != nil {
+		return err
+	}
+	var recorded []initactor.ProtocolUpgrade
+	for _, upgrade := range upgrades {
+		recorded = append(recorded, initactor.ProtocolUpgrade{Version: upgrade.Version, Height: upgrade.Height})
+	}
+	if err := initactor.SetProtocolUpgrades(storageMap.NewStorage(address.InitAddress, initAct), recorded); err != nil {
+		return err
+	}
+	return st.SetActor(ctx, address.InitAddress, initAct)
+}
+
+// RegisterGenesisActorIDs assigns IDs to all actors in the genesis state
+// that have none yet. Actors are registered in the order of their addresses
+// so that the IDs are the same for every node.
+func RegisterGenesisActorIDs(ctx context.Context, st state.Tree, storageMap vm.StorageMap) error {
+	var addrs []address.Address
+	err := st.ForEachActor(ctx, func(addr address.Address, _ *actor.Actor) error {
+		addrs = append(addrs, addr)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return addrs[i].String() < addrs[j].String()
+	})
+
+	initAct, err := st.GetActor(ctx, address.InitAddress)
+	if err != nil {
+		return err
+	}
+	storage := storageMap.NewStorage(address.InitAddress, initAct)
+	for _, addr := range addrs {
+		if _, err := initactor.RegisterAddress(ctx, storage, addr); err != nil {
+			return err
+		}
+	}
+	return st.SetActor(ctx, address.InitAddress, initAct)
+}
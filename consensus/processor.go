@@ -51,6 +51,9 @@ type ProcessTipSetResponse struct {
 
 // DefaultProcessor handles all block processing.
 type DefaultProcessor struct {
+	schedule *ProtocolSchedule
+	// signedMessageValidator, if set, replaces the validators of the
+	// protocol versions.
 	signedMessageValidator SignedMessageValidator
 	blockRewarder          BlockRewarder
 }
@@ -59,20 +62,44 @@ var _ Processor = (*DefaultProcessor)(nil)
 
 // NewDefaultProcessor creates a default processor from the given state tree and vms.
 func NewDefaultProcessor() *DefaultProcessor {
-	return &DefaultProcessor{
-		signedMessageValidator: NewDefaultMessageValidator(),
-		blockRewarder:          NewDefaultBlockRewarder(),
-	}
+	return NewScheduledProcessor(DefaultProtocolSchedule(), nil, NewDefaultBlockRewarder())
 }
 
 // NewConfiguredProcessor creates a default processor with custom validation and rewards.
 func NewConfiguredProcessor(validator SignedMessageValidator, rewarder BlockRewarder) *DefaultProcessor {
+	return NewScheduledProcessor(DefaultProtocolSchedule(), validator, rewarder)
+}
+
+// NewScheduledProcessor creates a processor running the protocol versions of
+// the given schedule. A nil validator validates messages with the validator
+// of the protocol version in effect.
+func NewScheduledProcessor(schedule *ProtocolSchedule, validator SignedMessageValidator, rewarder BlockRewarder) *DefaultProcessor {
 	return &DefaultProcessor{
+		schedule:               schedule,
 		signedMessageValidator: validator,
 		blockRewarder:          rewarder,
 	}
 }
 
+// Migrate runs the state migrations of the protocol upgrades taking effect
+// with a tipset at height bh, whose ancestors are given. The processing
+// methods run them before applying messages; it is exposed for callers
+// applying messages one at a time.
+func (p *DefaultProcessor) Migrate(ctx context.Context, st state.Tree, vms vm.StorageMap, bh *types.BlockHeight, ancestors []types.TipSet) error {
+	if err := p.schedule.Migrate(ctx, st, vms, bh.AsBigInt().Uint64(), ancestors); err != nil {
+		return errors.FaultErrorWrap(err, "could not upgrade state")
+	}
+	return nil
+}
+
+// versionAt returns the protocol version in effect at a block height.
+func (p *DefaultProcessor) versionAt(bh *types.BlockHeight) *ProtocolVersion {
+	if bh == nil {
+		return p.schedule.VersionAt(0)
+	}
+	return p.schedule.VersionAt(bh.AsBigInt().Uint64())
+}
+
 // ProcessBlock is the entrypoint for validating the state transitions
 // of the messages in a block. When we receive a new block from the
 // network ProcessBlock applies the block's messages to the beginning
@@ -109,14 +136,18 @@ func (p *DefaultProcessor) ProcessBlock(ctx context.Context, st state.Tree, vms
 		log.Infof("[TIMER] DefaultProcessor.ProcessBlock BlkCID: %s - elapsed time: %s", blk.Cid(), dur)
 	}()
 
+	bh := types.NewBlockHeight(uint64(blk.Height))
+	if err := p.Migrate(ctx, st, vms, bh, ancestors); err != nil {
+		return emptyResults, err
+	}
+
 	// find miner's owner address
-	minerOwnerAddr, err := minerOwnerAddress(ctx, st, vms, blk.Miner)
+	minerOwnerAddr, err := MinerOwnerAddress(ctx, st, vms, blk.Miner)
 	if err != nil {
 		return nil, err
 	}
 
-	bh := types.NewBlockHeight(uint64(blk.Height))
-	res, faultErr := p.ApplyMessagesAndPayRewards(ctx, st, vms, blk.Messages, minerOwnerAddr, bh, ancestors)
+	res, faultErr := p.applyMessagesAndPayRewards(ctx, st, vms, blk.Messages, minerOwnerAddr, bh, ancestors)
 	if faultErr != nil {
 		return emptyResults, faultErr
 	}
@@ -146,6 +177,9 @@ func (p *DefaultProcessor) ProcessTipSet(ctx context.Context, st state.Tree, vms
 		return &emptyRes, errors.FaultErrorWrap(err, "processing empty tipset")
 	}
 	bh := types.NewBlockHeight(h)
+	if err := p.Migrate(ctx, st, vms, bh, ancestors); err != nil {
+		return &emptyRes, err
+	}
 	msgFilter := make(map[string]struct{})
 
 	tips := ts.ToSlice()
@@ -156,7 +190,7 @@ func (p *DefaultProcessor) ProcessTipSet(ctx context.Context, st state.Tree, vms
 	// consensus functions).
 	for _, blk := range tips {
 		// find miner's owner address
-		minerOwnerAddr, err := minerOwnerAddress(ctx, st, vms, blk.Miner)
+		minerOwnerAddr, err := MinerOwnerAddress(ctx, st, vms, blk.Miner)
 		if err != nil {
 			return &emptyRes, err
 		}
@@ -176,7 +210,7 @@ func (p *DefaultProcessor) ProcessTipSet(ctx context.Context, st state.Tree, vms
 			// TODO is there ever a reason to try a duplicate failed message again within the same tipset?
 			msgFilter[mCid.String()] = struct{}{}
 		}
-		amRes, err := p.ApplyMessagesAndPayRewards(ctx, st, vms, msgs, minerOwnerAddr, bh, ancestors)
+		amRes, err := p.applyMessagesAndPayRewards(ctx, st, vms, msgs, minerOwnerAddr, bh, ancestors)
 		if err != nil {
 			return &emptyRes, err
 		}
@@ -268,6 +302,8 @@ func (p *DefaultProcessor) ProcessTipSet(ctx context.Context, st state.Tree, vms
 //       revert errors.
 //   - everything else: successfully applied (include, keep changes)
 //
+// If ctx holds a tracer set with vm.WithTracer, the calls of the message are
+// recorded in it.
 func (p *DefaultProcessor) ApplyMessage(ctx context.Context, st state.Tree, vms vm.StorageMap, msg *types.SignedMessage, minerOwnerAddr address.Address, bh *types.BlockHeight, gasTracker *vm.GasTracker, ancestors []types.TipSet) (*ApplicationResult, error) {
 
 	// used for log timer call below
@@ -282,9 +318,13 @@ func (p *DefaultProcessor) ApplyMessage(ctx context.Context, st state.Tree, vms
 		log.Infof("[TIMER] DefaultProcessor.ApplyMessage CID: %s - elapsed time: %s", msgCid.String(), dur)
 	}()
 
-	cachedStateTree := state.NewCachedStateTree(st)
+	version := p.versionAt(bh)
+	cachedStateTree := state.NewCachedStateTreeWithActors(st, version.Actors)
 
-	r, err := p.attemptApplyMessage(ctx, cachedStateTree, vms, msg, bh, gasTracker, ancestors)
+	r, err := p.attemptApplyMessage(ctx, cachedStateTree, vms, msg, bh, version, gasTracker, ancestors)
+	if tracer := vm.TracerFromContext(ctx); tracer != nil {
+		tracer.Finish(msgCid)
+	}
 	if err == nil {
 		err = cachedStateTree.Commit(ctx)
 		if err != nil {
@@ -351,15 +391,23 @@ var (
 
 // CallQueryMethod calls a method on an actor in the given state tree. It does
 // not make any changes to the state/blockchain and is useful for interrogating
-// actor state. Block height bh is optional; some methods will ignore it.
-func CallQueryMethod(ctx context.Context, st state.Tree, vms vm.StorageMap, to address.Address, method string, params []byte, from address.Address, optBh *types.BlockHeight) ([][]byte, uint8, error) {
+// actor state. The method runs with the actor code and gas prices of the
+// protocol version optVersion. Without it, it runs with the actor code of st
+// and the gas prices of the genesis version, which is enough for the getters
+// no upgrade changes. Block height bh is optional; some methods will ignore
+// it.
+func CallQueryMethod(ctx context.Context, st state.Tree, vms vm.StorageMap, optVersion *ProtocolVersion, to address.Address, method string, params []byte, from address.Address, optBh *types.BlockHeight) ([][]byte, uint8, error) {
 	toActor, err := st.GetActor(ctx, to)
 	if err != nil {
 		return nil, 1, errors.ApplyErrorPermanentWrapf(err, "failed to get To actor")
 	}
 
 	// not committing or flushing storage structures guarantees changes won't make it to stored state tree or datastore
-	cachedSt := state.NewCachedStateTree(st)
+	cachedSt, gasPrices := queryState(st, optVersion)
+	to, err = vm.ResolveAddress(ctx, cachedSt, vms, to)
+	if err != nil {
+		return nil, 1, errors.ApplyErrorPermanentWrapf(err, "failed to resolve To address")
+	}
 
 	msg := &types.Message{
 		From:   from,
@@ -380,6 +428,7 @@ func CallQueryMethod(ctx context.Context, st state.Tree, vms vm.StorageMap, to a
 		State:       cachedSt,
 		StorageMap:  vms,
 		GasTracker:  gasTracker,
+		GasPrices:   gasPrices,
 		BlockHeight: optBh,
 	}
 
@@ -389,21 +438,35 @@ func CallQueryMethod(ctx context.Context, st state.Tree, vms vm.StorageMap, to a
 }
 
 // PreviewQueryMethod estimates the amount of gas that will be used by a method
-// call. It accepts all the same arguments as CallQueryMethod.
-func PreviewQueryMethod(ctx context.Context, st state.Tree, vms vm.StorageMap, to address.Address, method string, params []byte, from address.Address, optBh *types.BlockHeight) (types.GasUnits, error) {
+// call. It accepts all the same arguments as CallQueryMethod, and the value
+// sent with the call, which a nil value omits.
+func PreviewQueryMethod(ctx context.Context, st state.Tree, vms vm.StorageMap, optVersion *ProtocolVersion, to address.Address, method string, params []byte, from address.Address, value *types.AttoFIL, optBh *types.BlockHeight) (types.GasUnits, error) {
 	toActor, err := st.GetActor(ctx, to)
 	if err != nil {
 		return types.NewGasUnits(0), errors.ApplyErrorPermanentWrapf(err, "failed to get To actor")
 	}
 
 	// not committing or flushing storage structures guarantees changes won't make it to stored state tree or datastore
-	cachedSt := state.NewCachedStateTree(st)
+	cachedSt, gasPrices := queryState(st, optVersion)
+	to, err = vm.ResolveAddress(ctx, cachedSt, vms, to)
+	if err != nil {
+		return types.NewGasUnits(0), errors.ApplyErrorPermanentWrapf(err, "failed to resolve To address")
+	}
+
+	// The value is transferred from the From actor, so it must exist.
+	var fromActor *actor.Actor
+	if value != nil {
+		fromActor, err = cachedSt.GetActor(ctx, from)
+		if err != nil {
+			return types.NewGasUnits(0), errors.ApplyErrorPermanentWrapf(err, "failed to get From actor")
+		}
+	}
 
 	msg := &types.Message{
 		From:   from,
 		To:     to,
 		Nonce:  0,
-		Value:  nil,
+		Value:  value,
 		Method: method,
 		Params: params,
 	}
@@ -413,11 +476,13 @@ func PreviewQueryMethod(ctx context.Context, st state.Tree, vms vm.StorageMap, t
 	gasTracker.MsgGasLimit = types.BlockGasLimit
 
 	vmCtxParams := vm.NewContextParams{
+		From:        fromActor,
 		To:          toActor,
 		Message:     msg,
 		State:       cachedSt,
 		StorageMap:  vms,
 		GasTracker:  gasTracker,
+		GasPrices:   gasPrices,
 		BlockHeight: optBh,
 	}
 	vmCtx := vm.NewVMContext(vmCtxParams)
@@ -431,7 +496,7 @@ func PreviewQueryMethod(ctx context.Context, st state.Tree, vms vm.StorageMap, t
 // should deal with trying to apply the message to the state tree whereas
 // ApplyMessage should deal with any side effects and how it should be presented
 // to the caller. attemptApplyMessage should only be called from ApplyMessage.
-func (p *DefaultProcessor) attemptApplyMessage(ctx context.Context, st *state.CachedTree, store vm.StorageMap, msg *types.SignedMessage, bh *types.BlockHeight, gasTracker *vm.GasTracker, ancestors []types.TipSet) (*types.MessageReceipt, error) {
+func (p *DefaultProcessor) attemptApplyMessage(ctx context.Context, st *state.CachedTree, store vm.StorageMap, msg *types.SignedMessage, bh *types.BlockHeight, version *ProtocolVersion, gasTracker *vm.GasTracker, ancestors []types.TipSet) (*types.MessageReceipt, error) {
 	gasTracker.ResetForNewMessage(msg.MeteredMessage)
 	if err := blockGasLimitError(gasTracker); err != nil {
 		return &types.MessageReceipt{
@@ -450,7 +515,11 @@ func (p *DefaultProcessor) attemptApplyMessage(ctx context.Context, st *state.Ca
 		return nil, errors.FaultErrorWrapf(err, "failed to get From actor %s", msg.From)
 	}
 
-	err = p.signedMessageValidator.Validate(ctx, msg, fromActor)
+	validator := p.signedMessageValidator
+	if validator == nil {
+		validator = version.Validator
+	}
+	err = validator.Validate(ctx, msg, fromActor)
 	if err != nil {
 		return &types.MessageReceipt{
 			ExitCode:   errors.CodeError(err),
@@ -466,25 +535,54 @@ func (p *DefaultProcessor) attemptApplyMessage(ctx context.Context, st *state.Ca
 		}
 	}
 
-	toActor, err := st.GetOrCreateActor(ctx, msg.To, func() (*actor.Actor, error) {
+	// Messages may be sent to the ID address of an actor. The VM runs them
+	// against the actor's own address, which keys its storage.
+	to, err := vm.ResolveAddress(ctx, st, store, msg.To)
+	if errors.IsFault(err) {
+		return nil, err
+	} else if err != nil {
+		return &types.MessageReceipt{
+			ExitCode:   errors.CodeError(err),
+			GasAttoFIL: types.ZeroAttoFIL,
+		}, err
+	}
+	if to == msg.From {
+		return &types.MessageReceipt{
+			ExitCode:   errors.CodeError(errSelfSend),
+			GasAttoFIL: types.ZeroAttoFIL,
+		}, errSelfSend
+	}
+	vmMsg := msg.Message
+	vmMsg.To = to
+
+	created := false
+	toActor, err := st.GetOrCreateActor(ctx, to, func() (*actor.Actor, error) {
 		// Addresses are deterministic so sending a message to a non-existent address must not install an actor,
 		// else actors could be installed ahead of address activation. So here we create the empty, upgradable
 		// actor to collect any balance that may be transferred.
+		created = true
 		return &actor.Actor{}, nil
 	})
 	if err != nil {
 		return nil, errors.FaultErrorWrap(err, "failed to get To actor")
 	}
+	if created {
+		if err := vm.RegisterActorID(ctx, st, store, to); err != nil {
+			return nil, errors.FaultErrorWrap(err, "failed to assign ID to To actor")
+		}
+	}
 
 	vmCtxParams := vm.NewContextParams{
 		From:        fromActor,
 		To:          toActor,
-		Message:     &msg.Message,
+		Message:     &vmMsg,
 		State:       st,
 		StorageMap:  store,
 		GasTracker:  gasTracker,
+		GasPrices:   version.GasPrices,
 		BlockHeight: bh,
 		Ancestors:   ancestors,
+		Tracer:      vm.TracerFromContext(ctx),
 	}
 	vmCtx := vm.NewVMContext(vmCtxParams)
 
@@ -502,6 +600,9 @@ func (p *DefaultProcessor) attemptApplyMessage(ctx context.Context, st *state.Ca
 	}
 
 	receipt.Return = append(receipt.Return, ret...)
+	if vmErr == nil && exitCode == 0 {
+		receipt.Events = vmCtx.Events()
+	}
 
 	return receipt, vmErr
 }
@@ -524,8 +625,16 @@ type ApplyMessagesResponse struct {
 // groupings of messages with permanent failures, temporary failures, and
 // successes, and the permanent and temporary errors raised during application.
 // ApplyMessages will return an error iff a fault message occurs.
+// The state migrations of protocol upgrades at bh are run first.
 // Precondition: signatures of messages are checked by the caller.
 func (p *DefaultProcessor) ApplyMessagesAndPayRewards(ctx context.Context, st state.Tree, vms vm.StorageMap, messages []*types.SignedMessage, minerOwnerAddr address.Address, bh *types.BlockHeight, ancestors []types.TipSet) (ApplyMessagesResponse, error) {
+	if err := p.Migrate(ctx, st, vms, bh, ancestors); err != nil {
+		return ApplyMessagesResponse{}, err
+	}
+	return p.applyMessagesAndPayRewards(ctx, st, vms, messages, minerOwnerAddr, bh, ancestors)
+}
+
+func (p *DefaultProcessor) applyMessagesAndPayRewards(ctx context.Context, st state.Tree, vms vm.StorageMap, messages []*types.SignedMessage, minerOwnerAddr address.Address, bh *types.BlockHeight, ancestors []types.TipSet) (ApplyMessagesResponse, error) {
 	var emptyRet ApplyMessagesResponse
 	var ret ApplyMessagesResponse
 
@@ -637,9 +746,18 @@ func isPermanentError(err error) bool {
 		err == errGasAboveBlockLimit
 }
 
-// minerOwnerAddress finds the address of the owner of the given miner
-func minerOwnerAddress(ctx context.Context, st state.Tree, vms vm.StorageMap, minerAddr address.Address) (address.Address, error) {
-	ret, code, err := CallQueryMethod(ctx, st, vms, minerAddr, "getOwner", []byte{}, address.Undef, types.NewBlockHeight(0))
+// queryState returns the state tree a query runs against and the gas prices
+// it is charged.
+func queryState(st state.Tree, optVersion *ProtocolVersion) (*state.CachedTree, *types.PriceList) {
+	if optVersion == nil {
+		return state.NewCachedStateTree(st), ProtocolVersions[0].GasPrices
+	}
+	return state.NewCachedStateTreeWithActors(st, optVersion.Actors), optVersion.GasPrices
+}
+
+// MinerOwnerAddress finds the address of the owner of the given miner
+func MinerOwnerAddress(ctx context.Context, st state.Tree, vms vm.StorageMap, minerAddr address.Address) (address.Address, error) {
+	ret, code, err := CallQueryMethod(ctx, st, vms, nil, minerAddr, "getOwner", []byte{}, address.Undef, types.NewBlockHeight(0))
 	if err != nil {
 		return address.Undef, errors.FaultErrorWrap(err, "could not get miner owner")
 	}
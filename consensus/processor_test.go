@@ -15,6 +15,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/actor/builtin"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/account"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/initactor"
 	"github.com/filecoin-project/go-filecoin/address"
 	. "github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/state"
@@ -352,7 +353,7 @@ func TestProcessBlockVMErrors(t *testing.T) {
 	stCid, miner := mustCreateMiner(ctx, require, st, vms, minerAddr, minerOwnerAddr)
 
 	msg := types.NewMessage(fromAddr, toAddr, 0, nil, "returnRevertError", nil)
-	smsg, err := types.NewSignedMessage(*msg, &mockSigner, types.NewGasPrice(0), types.NewGasUnits(0))
+	smsg, err := types.NewSignedMessage(*msg, &mockSigner, types.NewGasPrice(0), types.NewGasUnits(100))
 	require.NoError(err)
 	blk := &types.Block{
 		Height:    20,
@@ -671,6 +672,61 @@ func TestNestedSendBalance(t *testing.T) {
 	assert.True(expStCid.Equals(gotStCid))
 }
 
+func TestApplyMessageTrace(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	newAddress := address.NewForTestGetter()
+	ctx := context.Background()
+	cst := hamt.NewCborStore()
+	vms := th.VMStorage()
+	mockSigner, _ := types.NewMockSignersAndKeyInfo(1)
+
+	fakeActorCodeCid := types.NewCidForTestGetter()()
+	builtin.Actors[fakeActorCodeCid] = &actor.FakeActor{}
+	defer func() {
+		delete(builtin.Actors, fakeActorCodeCid)
+	}()
+
+	addr0, addr1, addr2 := mockSigner.Addresses[0], newAddress(), newAddress()
+	act0 := th.RequireNewAccountActor(require, types.NewAttoFILFromFIL(101))
+	act1 := th.RequireNewFakeActorWithTokens(require, vms, addr1, fakeActorCodeCid, types.NewAttoFILFromFIL(102))
+	act2 := th.RequireNewFakeActorWithTokens(require, vms, addr2, fakeActorCodeCid, types.NewAttoFILFromFIL(0))
+	_, st := th.RequireMakeStateTree(require, cst, map[address.Address]*actor.Actor{
+		addr0: act0,
+		addr1: act1,
+		addr2: act2,
+	})
+
+	params, err := abi.ToEncodedValues(addr2)
+	require.NoError(err)
+	msg := types.NewMessage(addr0, addr1, 0, types.NewAttoFILFromFIL(1), "nestedBalance", params)
+	smsg, err := types.NewSignedMessage(*msg, mockSigner, types.NewGasPrice(0), types.NewGasUnits(100))
+	require.NoError(err)
+	msgCid, err := smsg.Cid()
+	require.NoError(err)
+
+	tracer := vm.NewTracer()
+	_, err = th.NewTestProcessor().ApplyMessage(vm.WithTracer(ctx, tracer), st, vms, smsg, addr0, types.NewBlockHeight(0), vm.NewGasTracker(), nil)
+	require.NoError(err)
+
+	frame, ok := tracer.Trace(msgCid)
+	require.True(ok)
+	assert.Equal(addr0, frame.From)
+	assert.Equal(addr1, frame.To)
+	assert.Equal("nestedBalance", frame.Method)
+	assert.Equal(types.NewAttoFILFromFIL(1), frame.Value)
+	assert.Equal(params, frame.Params)
+	assert.Equal(uint8(0), frame.ExitCode)
+
+	require.Len(frame.Calls, 1)
+	call := frame.Calls[0]
+	assert.Equal(addr1, call.From)
+	assert.Equal(addr2, call.To)
+	assert.Equal("", call.Method)
+	assert.Equal(types.NewAttoFILFromFIL(100), call.Value)
+	assert.Empty(call.Calls)
+}
+
 func TestReentrantTransferDoesntAllowMultiSpending(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -759,6 +815,54 @@ func TestSendToNonexistentAddressThenSpendFromIt(t *testing.T) {
 	assert.True(act3.Empty())
 }
 
+func TestSendToIDAddress(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx := context.Background()
+	cst := hamt.NewCborStore()
+	vms := th.VMStorage()
+
+	mockSigner, _ := types.NewMockSignersAndKeyInfo(2)
+
+	addr1, addr2 := mockSigner.Addresses[0], mockSigner.Addresses[1]
+	minerAddr := address.NewForTestGetter()()
+	act1 := th.RequireNewAccountActor(require, types.NewAttoFILFromFIL(1000))
+	initAct := initactor.NewActor()
+	require.NoError((&initactor.Actor{}).InitializeState(vms.NewStorage(address.InitAddress, initAct), nil))
+	_, st := requireMakeStateTree(require, cst, map[address.Address]*actor.Actor{
+		addr1:               act1,
+		address.InitAddress: initAct,
+	})
+
+	applyMessage := func(to address.Address, nonce uint64) *ApplicationResult {
+		msg := types.NewMessage(addr1, to, nonce, types.NewAttoFILFromFIL(100), "", []byte{})
+		smsg, err := types.NewSignedMessage(*msg, mockSigner, types.NewGasPrice(0), types.NewGasUnits(0))
+		require.NoError(err)
+		res, err := NewDefaultProcessor().ApplyMessage(ctx, st, vms, smsg, minerAddr, types.NewBlockHeight(0), vm.NewGasTracker(), nil)
+		require.NoError(err)
+		return res
+	}
+
+	// the first message creates addr2, which is assigned ID 0
+	res := applyMessage(addr2, 0)
+	require.NoError(res.ExecutionError)
+	idAddr, err := address.NewIDAddress(0)
+	require.NoError(err)
+
+	res = applyMessage(idAddr, 1)
+	require.NoError(res.ExecutionError)
+	assert.Equal(types.NewAttoFILFromFIL(200), state.MustGetActor(st, addr2).Balance)
+
+	// a message to an unassigned ID fails
+	unassigned, err := address.NewIDAddress(5)
+	require.NoError(err)
+	res = applyMessage(unassigned, 2)
+	assert.Error(res.ExecutionError)
+	assert.NotEqual(uint8(0), res.Receipt.ExitCode)
+	assert.Equal(types.NewAttoFILFromFIL(800), state.MustGetActor(st, addr1).Balance)
+}
+
 func TestApplyQueryMessageWillNotAlterState(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -793,7 +897,7 @@ func TestApplyQueryMessageWillNotAlterState(t *testing.T) {
 	args1, err := abi.ToEncodedValues(addr2)
 	assert.NoError(err)
 
-	_, exitCode, err := CallQueryMethod(ctx, st, vms, addr1, "nestedBalance", args1, addr0, types.NewBlockHeight(0))
+	_, exitCode, err := CallQueryMethod(ctx, st, vms, nil, addr1, "nestedBalance", args1, addr0, types.NewBlockHeight(0))
 	require.Equal(uint8(0), exitCode)
 	require.NoError(err)
 
@@ -894,6 +998,31 @@ func TestApplyMessageChargesGas(t *testing.T) {
 		assert.Equal(types.NewAttoFILFromFIL(850), accountActor.Balance)
 	})
 
+	t.Run("ApplyMessage reverts a message running out of gas in storage access", func(t *testing.T) {
+		addresses, st, mockSigner := setupActorsForGasTest(t, vms, fakeActorCodeCid, 1000)
+		addr0 := addresses[0]
+		addr1 := addresses[1]
+		minerAddr := addresses[2]
+		msg := types.NewMessage(addr0, addr1, 0, types.ZeroAttoFIL, "changeState", nil)
+
+		// Reading the state of the actor costs more than the limit.
+		gasPrice := types.NewAttoFILFromFIL(uint64(3))
+		gasLimit := types.NewGasUnits(1)
+
+		appResult, err := th.ApplyTestMessageWithGas(st, th.VMStorage(), msg, types.NewBlockHeight(0), mockSigner,
+			*gasPrice, gasLimit, minerAddr)
+		require.NoError(err)
+		assert.True(errors.IsOutOfGas(appResult.ExecutionError))
+		assert.False(errors.IsFault(appResult.ExecutionError))
+		require.NotNil(appResult.Receipt)
+		assert.NotEqual(uint8(0), appResult.Receipt.ExitCode)
+
+		// The sender is charged the gas limit.
+		accountActor, err := st.GetActor(ctx, addr0)
+		require.NoError(err)
+		assert.Equal(types.NewAttoFILFromFIL(997), accountActor.Balance)
+	})
+
 	t.Run("ApplyMessage when sending another message, with sufficient gas gets charged all the gas", func(t *testing.T) {
 		addresses, st, mockSigner := setupActorsForGasTest(t, vms, fakeActorCodeCid, 2000)
 		addr0 := addresses[0]
@@ -916,13 +1045,15 @@ func TestApplyMessageChargesGas(t *testing.T) {
 		minerActor, err := st.GetActor(ctx, minerAddr)
 		require.NoError(err)
 
-		// miner receives (3 FIL/gas * 100 gas * 2 messages)
-		assert.Equal(types.NewAttoFILFromFIL(1600), minerActor.Balance)
+		// miner receives (3 FIL/gas * (100 gas * 2 messages + the price of the inner send))
+		sendGas := types.GenesisGasPrices().Send
+		gasCharged := types.NewAttoFILFromFIL(uint64(3 * (200 + sendGas)))
+		assert.Equal(types.NewAttoFILFromFIL(1000).Add(gasCharged), minerActor.Balance)
 
 		accountActor, err := st.GetActor(ctx, addr0)
 		require.NoError(err)
 		// sender's resulting balance of FIL
-		assert.Equal(types.NewAttoFILFromFIL(1400), accountActor.Balance)
+		assert.Equal(types.NewAttoFILFromFIL(2000).Sub(gasCharged), accountActor.Balance)
 	})
 
 	t.Run("ApplyMessage when it sends another message with insufficient gas fails with correct message", func(t *testing.T) {
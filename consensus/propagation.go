@@ -0,0 +1,140 @@
+package consensus
+
+import (
+	"context"
+
+	"github.com/ipfs/go-ipfs-blockstore"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+)
+
+// MaxMessageNonceGap is how far ahead of its sender's nonce the nonce of a
+// message received from the network may be. Messages further ahead can't be
+// mined any time soon and are not relayed.
+const MaxMessageNonceGap = 100
+
+var (
+	// ErrInvalidTicket is returned when the ticket of a block is not signed
+	// by the key of its miner.
+	ErrInvalidTicket = errors.New("ticket not signed by the miner key")
+	// ErrInvalidForLatestState is returned when a message fails the checks
+	// against the latest state of the node. The latest state depends on how
+	// far the node synced, so the message is not known to be invalid.
+	ErrInvalidForLatestState = errors.New("invalid for the latest state")
+)
+
+type latestStateGetter interface {
+	LatestState(ctx context.Context) (state.Tree, error)
+}
+
+// GetStateFromKey returns the state resulting from applying the tipset with
+// the given key.
+type GetStateFromKey func(ctx context.Context, tsKey string) (state.Tree, error)
+
+// BlockPropagationValidator checks the blocks received from the network
+// before they are handled and relayed to other peers. Its checks are cheap
+// and only need the state of the parents of a block, the full validation of
+// a block happening when syncing it.
+type BlockPropagationValidator struct {
+	getState GetStateFromKey
+	bstore   blockstore.Blockstore
+}
+
+// NewBlockPropagationValidator returns a validator checking blocks against
+// the state of their parents.
+func NewBlockPropagationValidator(getState GetStateFromKey, bs blockstore.Blockstore) *BlockPropagationValidator {
+	return &BlockPropagationValidator{getState: getState, bstore: bs}
+}
+
+// Validate errors if the block is malformed, its miner does not exist in the
+// state of its parents, or its ticket is not signed by the key of its miner.
+// Blocks whose parent state is not known locally, as is the case of blocks
+// ahead of the chain of the node, are only checked to be well formed so that
+// they reach the syncer and are relayed.
+func (v *BlockPropagationValidator) Validate(ctx context.Context, blk *types.Block) error {
+	if err := ValidateBlockStructure(ctx, blk); err != nil {
+		return err
+	}
+
+	st, err := v.getState(ctx, blk.Parents.String())
+	if err != nil {
+		log.Debugf("accepting block %s of unknown parent state %s: %s", blk.Cid().String(), blk.Parents.String(), err)
+		return nil
+	}
+	minerActor, err := st.GetActor(ctx, blk.Miner)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get miner %s", blk.Miner)
+	}
+	if !minerActor.Code.Equals(types.MinerActorCodeCid) {
+		return errors.Errorf("%s is not a miner", blk.Miner)
+	}
+
+	rets, ec, err := CallQueryMethod(ctx, st, vm.NewStorageMap(v.bstore), nil, blk.Miner, "getKey", []byte{}, address.Undef, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get key of miner %s", blk.Miner)
+	}
+	if ec != 0 {
+		return errors.Errorf("non-zero return code from query message: %d", ec)
+	}
+	signer, err := address.NewSecp256k1Address(rets[0])
+	if err != nil {
+		return errors.Wrapf(err, "invalid key of miner %s", blk.Miner)
+	}
+	// The ticket is the signature of the proof and signer, see CreateTicket.
+	buf := append(blk.Proof[:], signer.Bytes()...)
+	if !types.IsValidSignature(buf, signer, blk.Ticket) {
+		return ErrInvalidTicket
+	}
+	return nil
+}
+
+// MessagePropagationValidator checks the messages received from the network
+// before they are added to the message pool and relayed to other peers.
+type MessagePropagationValidator struct {
+	chain     latestStateGetter
+	validator SignedMessageValidator
+}
+
+// NewMessagePropagationValidator returns a validator checking messages
+// against the latest state of the chain. As messages are relayed before the
+// ones preceding them are mined, nonces ahead of their sender's are allowed,
+// up to MaxMessageNonceGap.
+func NewMessagePropagationValidator(chain latestStateGetter) *MessagePropagationValidator {
+	return &MessagePropagationValidator{
+		chain:     chain,
+		validator: NewOutboundMessageValidator(),
+	}
+}
+
+// Validate errors if the message is not signed by its sender or is
+// malformed, or with ErrInvalidForLatestState if its nonce is too far from
+// its sender's or it is otherwise invalid for the latest state.
+func (v *MessagePropagationValidator) Validate(ctx context.Context, msg *types.SignedMessage) error {
+	if !msg.VerifySignature() {
+		return errInvalidSignature
+	}
+	if err := validateMessageStructure(msg); err != nil {
+		return err
+	}
+
+	st, err := v.chain.LatestState(ctx)
+	if err != nil {
+		return errors.Wrapf(ErrInvalidForLatestState, "failed to get latest state: %s", err)
+	}
+	fromActor, err := st.GetActor(ctx, msg.From)
+	if err != nil {
+		return errors.Wrapf(ErrInvalidForLatestState, "failed to get sender %s: %s", msg.From, err)
+	}
+
+	if msg.Nonce > fromActor.Nonce+MaxMessageNonceGap {
+		return errors.Wrapf(ErrInvalidForLatestState, "nonce %d more than %d ahead of %d", msg.Nonce, MaxMessageNonceGap, fromActor.Nonce)
+	}
+	if err := v.validator.Validate(ctx, msg, fromActor); err != nil {
+		return errors.Wrapf(ErrInvalidForLatestState, "%s", err)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package consensus_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-hamt-ipld"
+	"github.com/ipfs/go-ipfs-blockstore"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/proofs"
+	"github.com/filecoin-project/go-filecoin/state"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+)
+
+type fakeLatestState struct {
+	st state.Tree
+}
+
+func (f *fakeLatestState) LatestState(ctx context.Context) (state.Tree, error) {
+	return f.st, nil
+}
+
+func TestBlockPropagationValidator(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	newAddress := address.NewForTestGetter()
+	minerAddr := newAddress()
+	minerKey := signer.PubKeys[0]
+	bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+	vms := vm.NewStorageMap(bs)
+	minerActor := th.RequireNewMinerActor(require, vms, minerAddr, addresses[0], minerKey, 10, th.RequireRandomPeerID(require), types.ZeroAttoFIL)
+	_, st := th.RequireMakeStateTree(require, hamt.NewCborStore(), map[address.Address]*actor.Actor{
+		minerAddr:    minerActor,
+		addresses[1]: th.RequireNewAccountActor(require, types.ZeroAttoFIL),
+	})
+	parents := types.NewSortedCidSet(types.SomeCid())
+	getState := func(ctx context.Context, tsKey string) (state.Tree, error) {
+		if tsKey != parents.String() {
+			return nil, errors.New("not found")
+		}
+		return st, nil
+	}
+	validator := consensus.NewBlockPropagationValidator(getState, bs)
+
+	newBlock := func(miner address.Address, signerKey []byte) *types.Block {
+		var proof proofs.PoStProof
+		copy(proof[:], []byte("proof"))
+		ticket, err := consensus.CreateTicket(proof, signerKey, signer)
+		require.NoError(err)
+		return &types.Block{
+			Miner:     miner,
+			Ticket:    ticket,
+			Proof:     proof,
+			Parents:   parents,
+			StateRoot: types.SomeCid(),
+		}
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		assert.NoError(validator.Validate(ctx, newBlock(minerAddr, minerKey)))
+	})
+
+	t.Run("malformed block fails", func(t *testing.T) {
+		blk := newBlock(minerAddr, minerKey)
+		blk.StateRoot = cid.Undef
+		assert.Error(validator.Validate(ctx, blk))
+	})
+
+	t.Run("unknown miner fails", func(t *testing.T) {
+		assert.Error(validator.Validate(ctx, newBlock(newAddress(), minerKey)))
+	})
+
+	t.Run("unknown parent state is accepted when well formed", func(t *testing.T) {
+		blk := newBlock(newAddress(), minerKey)
+		blk.Parents = types.NewSortedCidSet(types.NewCidForTestGetter()())
+		assert.NoError(validator.Validate(ctx, blk))
+
+		blk.StateRoot = cid.Undef
+		assert.Error(validator.Validate(ctx, blk))
+	})
+
+	t.Run("non-miner actor fails", func(t *testing.T) {
+		assert.Error(validator.Validate(ctx, newBlock(addresses[1], minerKey)))
+	})
+
+	t.Run("ticket not signed by the miner fails", func(t *testing.T) {
+		err := validator.Validate(ctx, newBlock(minerAddr, signer.PubKeys[1]))
+		assert.Equal(consensus.ErrInvalidTicket, errors.Cause(err))
+	})
+}
+
+func TestMessagePropagationValidator(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	alice := addresses[0]
+	bob := addresses[1]
+	_, st := th.RequireMakeStateTree(require, hamt.NewCborStore(), map[address.Address]*actor.Actor{
+		alice: newActor(t, 1000, 10),
+	})
+	validator := consensus.NewMessagePropagationValidator(&fakeLatestState{st})
+
+	t.Run("valid", func(t *testing.T) {
+		assert.NoError(validator.Validate(ctx, newMessage(t, alice, bob, 10, 5, 0, 0)))
+	})
+
+	t.Run("allows nonces a little ahead", func(t *testing.T) {
+		assert.NoError(validator.Validate(ctx, newMessage(t, alice, bob, 10+consensus.MaxMessageNonceGap, 5, 0, 0)))
+	})
+
+	t.Run("nonce too far ahead fails for the latest state", func(t *testing.T) {
+		err := validator.Validate(ctx, newMessage(t, alice, bob, 11+consensus.MaxMessageNonceGap, 5, 0, 0))
+		assert.Equal(consensus.ErrInvalidForLatestState, errors.Cause(err))
+	})
+
+	t.Run("low nonce fails for the latest state", func(t *testing.T) {
+		err := validator.Validate(ctx, newMessage(t, alice, bob, 9, 5, 0, 0))
+		assert.Equal(consensus.ErrInvalidForLatestState, errors.Cause(err))
+	})
+
+	t.Run("unknown sender fails for the latest state", func(t *testing.T) {
+		err := validator.Validate(ctx, newMessage(t, bob, alice, 0, 5, 0, 0))
+		assert.Equal(consensus.ErrInvalidForLatestState, errors.Cause(err))
+	})
+
+	t.Run("invalid signature fails", func(t *testing.T) {
+		msg := newMessage(t, alice, bob, 10, 5, 0, 0)
+		msg.Signature = []byte{}
+		err := validator.Validate(ctx, msg)
+		require.Error(err)
+		assert.NotEqual(consensus.ErrInvalidForLatestState, errors.Cause(err))
+	})
+
+	t.Run("self send fails", func(t *testing.T) {
+		err := validator.Validate(ctx, newMessage(t, alice, alice, 10, 5, 0, 0))
+		require.Error(err)
+		assert.NotEqual(consensus.ErrInvalidForLatestState, errors.Cause(err))
+	})
+}
@@ -0,0 +1,220 @@
+package consensus
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/initactor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+)
+
+// ProtocolVersion is a set of rules of the network. The network runs the
+// genesis version, version 0, until it upgrades to later versions at the
+// heights of its ProtocolSchedule. Changing the rules of the network is
+// adding a version, so that the chain before the upgrade is still processed
+// by the rules it was made with.
+type ProtocolVersion struct {
+	// Version numbers the protocol versions, in the order the network
+	// upgrades to them.
+	Version uint64
+	// Actors is the actor code run by the messages of the version.
+	Actors map[cid.Cid]exec.ExecutableActor
+	// GasPrices are the gas prices charged to the messages of the version.
+	GasPrices *types.PriceList
+	// Validator checks the messages of the version before they are applied.
+	Validator SignedMessageValidator
+	// Migrate, if set, changes the state as the network upgrades to the
+	// version, before any message of the version is applied.
+	Migrate Migration
+}
+
+// Migration changes the state of the chain at a protocol upgrade.
+type Migration func(ctx context.Context, st state.Tree, vms vm.StorageMap) error
+
+// ProtocolVersions are the protocol versions the node can run. The versions
+// after the first only run at the heights the network schedules them for.
+var ProtocolVersions = []*ProtocolVersion{
+	{
+		Version:   0,
+		Actors:    builtinActorsExcept(types.PaymentBrokerV1ActorCodeCid),
+		GasPrices: types.GenesisGasPrices(),
+		Validator: NewDefaultMessageValidator(),
+	},
+	{
+		// Version 1 upgrades the payment broker to version 1 of its code.
+		Version:   1,
+		Actors:    builtinActorsExcept(types.PaymentBrokerActorCodeCid),
+		GasPrices: types.GenesisGasPrices(),
+		Validator: NewDefaultMessageValidator(),
+		Migrate:   replaceActorCode(address.PaymentBrokerAddress, types.PaymentBrokerV1ActorCodeCid),
+	},
+}
+
+// builtinActorsExcept returns the builtin actors but those with the given
+// code.
+func builtinActorsExcept(codes ...cid.Cid) map[cid.Cid]exec.ExecutableActor {
+	actors := make(map[cid.Cid]exec.ExecutableActor)
+	for code, act := range builtin.Actors {
+		actors[code] = act
+	}
+	for _, code := range codes {
+		delete(actors, code)
+	}
+	return actors
+}
+
+// replaceActorCode returns a migration running the actor at addr with the
+// given code. Its storage is kept as it is.
+func replaceActorCode(addr address.Address, code cid.Cid) Migration {
+	return func(ctx context.Context, st state.Tree, vms vm.StorageMap) error {
+		act, err := st.GetActor(ctx, addr)
+		if err != nil {
+			return err
+		}
+		act.Code = code
+		return st.SetActor(ctx, addr, act)
+	}
+}
+
+// ProtocolUpgrade schedules the upgrade of the network to a protocol version
+// at a height.
+type ProtocolUpgrade struct {
+	Version uint64
+	Height  uint64
+}
+
+// ProtocolSchedule selects the protocol version in effect at each height of
+// the chain.
+type ProtocolSchedule struct {
+	// upgrades are ordered by height, the first one being the upgrade to the
+	// genesis version at height 0.
+	upgrades []scheduledUpgrade
+}
+
+type scheduledUpgrade struct {
+	height  uint64
+	version *ProtocolVersion
+}
+
+// NewProtocolSchedule returns a schedule running the first of versions from
+// genesis, and upgrading to the others at the heights of the upgrades.
+// Versions must be upgraded to one after the other, each at a height above
+// the one before.
+func NewProtocolSchedule(versions []*ProtocolVersion, upgrades []ProtocolUpgrade) (*ProtocolSchedule, error) {
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("no protocol versions")
+	}
+	byVersion := make(map[uint64]*ProtocolVersion)
+	for _, version := range versions {
+		byVersion[version.Version] = version
+	}
+
+	sorted := append([]ProtocolUpgrade{}, upgrades...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Height < sorted[j].Height
+	})
+
+	schedule := &ProtocolSchedule{
+		upgrades: []scheduledUpgrade{{height: 0, version: versions[0]}},
+	}
+	for _, upgrade := range sorted {
+		last := schedule.upgrades[len(schedule.upgrades)-1]
+		version, ok := byVersion[upgrade.Version]
+		if !ok {
+			return nil, fmt.Errorf("unknown protocol version %d", upgrade.Version)
+		}
+		if upgrade.Height <= last.height {
+			return nil, fmt.Errorf("upgrade to protocol version %d at height %d is not above the height of the previous upgrade", upgrade.Version, upgrade.Height)
+		}
+		if version.Version != last.version.Version+1 {
+			return nil, fmt.Errorf("upgrade to protocol version %d at height %d does not follow version %d", upgrade.Version, upgrade.Height, last.version.Version)
+		}
+		schedule.upgrades = append(schedule.upgrades, scheduledUpgrade{height: upgrade.Height, version: version})
+	}
+	return schedule, nil
+}
+
+// DefaultProtocolSchedule returns the schedule of a network which never
+// upgrades from the genesis version.
+func DefaultProtocolSchedule() *ProtocolSchedule {
+	schedule, err := NewProtocolSchedule(ProtocolVersions, nil)
+	if err != nil {
+		panic(err)
+	}
+	return schedule
+}
+
+// NetworkProtocolSchedule returns the schedule of the network whose genesis
+// state is st, running the upgrades recorded in it.
+func NetworkProtocolSchedule(ctx context.Context, st state.Tree, storageMap vm.StorageMap) (*ProtocolSchedule, error) {
+	initAct, err := st.GetActor(ctx, address.InitAddress)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get init actor")
+	}
+	recorded, err := initactor.LoadProtocolUpgrades(storageMap.NewStorage(address.InitAddress, initAct))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load protocol upgrades")
+	}
+
+	var upgrades []ProtocolUpgrade
+	for _, upgrade := range recorded {
+		upgrades = append(upgrades, ProtocolUpgrade{Version: upgrade.Version, Height: upgrade.Height})
+	}
+	return NewProtocolSchedule(ProtocolVersions, upgrades)
+}
+
+// Upgrades returns the upgrades of the schedule after genesis, ordered by
+// height.
+func (s *ProtocolSchedule) Upgrades() []ProtocolUpgrade {
+	var upgrades []ProtocolUpgrade
+	for _, upgrade := range s.upgrades[1:] {
+		upgrades = append(upgrades, ProtocolUpgrade{Version: upgrade.version.Version, Height: upgrade.height})
+	}
+	return upgrades
+}
+
+// VersionAt returns the protocol version in effect at a height.
+func (s *ProtocolSchedule) VersionAt(height uint64) *ProtocolVersion {
+	version := s.upgrades[0].version
+	for _, upgrade := range s.upgrades {
+		if height < upgrade.height {
+			break
+		}
+		version = upgrade.version
+	}
+	return version
+}
+
+// Migrate runs the migrations of the upgrades scheduled after the height of
+// the parent of a tipset, up to the height of the tipset, in order. Null
+// blocks between them do not skip the upgrades at their heights. Without the
+// parent, only the upgrades at the height of the tipset are run.
+func (s *ProtocolSchedule) Migrate(ctx context.Context, st state.Tree, vms vm.StorageMap, height uint64, ancestors []types.TipSet) error {
+	after := height
+	if len(ancestors) > 0 {
+		parentHeight, err := ancestors[0].Height()
+		if err != nil {
+			return err
+		}
+		after = parentHeight + 1
+	}
+
+	for _, upgrade := range s.upgrades[1:] {
+		if upgrade.height < after || upgrade.height > height || upgrade.version.Migrate == nil {
+			continue
+		}
+		if err := upgrade.version.Migrate(ctx, st, vms); err != nil {
+			return errors.Wrapf(err, "migration to protocol version %d failed", upgrade.version.Version)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package consensus_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-hamt-ipld"
+	"github.com/ipfs/go-ipfs-blockstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/abi"
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
+	"github.com/filecoin-project/go-filecoin/address"
+	. "github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/state"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+)
+
+func TestNewProtocolSchedule(t *testing.T) {
+	t.Run("versions are in effect from their heights", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		schedule, err := NewProtocolSchedule(ProtocolVersions, []ProtocolUpgrade{{Version: 1, Height: 10}})
+		require.NoError(err)
+		assert.Equal(uint64(0), schedule.VersionAt(0).Version)
+		assert.Equal(uint64(0), schedule.VersionAt(9).Version)
+		assert.Equal(uint64(1), schedule.VersionAt(10).Version)
+		assert.Equal(uint64(1), schedule.VersionAt(1000).Version)
+
+		assert.Equal(uint64(0), DefaultProtocolSchedule().VersionAt(1000).Version)
+	})
+
+	t.Run("upgrades are returned ordered by height", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		versions := append(ProtocolVersions, &ProtocolVersion{Version: 2})
+		upgrades := []ProtocolUpgrade{{Version: 2, Height: 20}, {Version: 1, Height: 10}}
+		schedule, err := NewProtocolSchedule(versions, upgrades)
+		require.NoError(err)
+		assert.Equal([]ProtocolUpgrade{{Version: 1, Height: 10}, {Version: 2, Height: 20}}, schedule.Upgrades())
+
+		assert.Empty(DefaultProtocolSchedule().Upgrades())
+	})
+
+	t.Run("invalid upgrades fail", func(t *testing.T) {
+		assert := assert.New(t)
+
+		versions := append(ProtocolVersions, &ProtocolVersion{Version: 2})
+		_, err := NewProtocolSchedule(versions, []ProtocolUpgrade{{Version: 5, Height: 10}})
+		assert.Error(err)
+		_, err = NewProtocolSchedule(versions, []ProtocolUpgrade{{Version: 1, Height: 0}})
+		assert.Error(err)
+		_, err = NewProtocolSchedule(versions, []ProtocolUpgrade{{Version: 1, Height: 10}, {Version: 2, Height: 10}})
+		assert.Error(err)
+		_, err = NewProtocolSchedule(versions, []ProtocolUpgrade{{Version: 2, Height: 10}})
+		assert.Error(err)
+		_, err = NewProtocolSchedule(versions, []ProtocolUpgrade{{Version: 2, Height: 20}, {Version: 1, Height: 10}})
+		assert.NoError(err)
+	})
+}
+
+func TestNetworkProtocolSchedule(t *testing.T) {
+	ctx := context.Background()
+
+	schedule := func(require *require.Assertions, opts ...GenOption) *ProtocolSchedule {
+		cst := hamt.NewCborStore()
+		bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+		genesis, err := MakeGenesisFunc(opts...)(cst, bs)
+		require.NoError(err)
+		st, err := state.LoadStateTree(ctx, cst, genesis.StateRoot, builtin.Actors)
+		require.NoError(err)
+		schedule, err := NetworkProtocolSchedule(ctx, st, vm.NewStorageMap(bs))
+		require.NoError(err)
+		return schedule
+	}
+
+	t.Run("runs the upgrades of the genesis state", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		s := schedule(require, Upgrades(ProtocolUpgrade{Version: 1, Height: 10}))
+		assert.Equal(uint64(0), s.VersionAt(9).Version)
+		assert.Equal(uint64(1), s.VersionAt(10).Version)
+	})
+
+	t.Run("never upgrades without upgrades in the genesis state", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		s := schedule(require)
+		assert.Equal(uint64(0), s.VersionAt(1000).Version)
+	})
+
+	t.Run("invalid upgrades fail genesis", func(t *testing.T) {
+		assert := assert.New(t)
+
+		_, err := MakeGenesisFunc(Upgrades(ProtocolUpgrade{Version: 5, Height: 10}))(hamt.NewCborStore(), blockstore.NewBlockstore(datastore.NewMapDatastore()))
+		assert.Error(err)
+	})
+}
+
+func TestProtocolScheduleMigrate(t *testing.T) {
+	ctx := context.Background()
+
+	migrated := func(t *testing.T, height uint64, ancestors []types.TipSet) bool {
+		require := require.New(t)
+
+		var runs []uint64
+		versions := []*ProtocolVersion{{Version: 0}}
+		for _, v := range []uint64{1, 2} {
+			version := v
+			versions = append(versions, &ProtocolVersion{
+				Version: version,
+				Migrate: func(ctx context.Context, st state.Tree, vms vm.StorageMap) error {
+					runs = append(runs, version)
+					return nil
+				},
+			})
+		}
+		schedule, err := NewProtocolSchedule(versions, []ProtocolUpgrade{{Version: 1, Height: 5}, {Version: 2, Height: 6}})
+		require.NoError(err)
+
+		require.NoError(schedule.Migrate(ctx, nil, nil, height, ancestors))
+		return len(runs) > 0
+	}
+	parentAt := func(require *require.Assertions, height uint64) []types.TipSet {
+		return []types.TipSet{types.RequireNewTipSet(require, &types.Block{Height: types.Uint64(height)})}
+	}
+
+	t.Run("runs the upgrades at the height of the tipset", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		assert.True(migrated(t, 5, parentAt(require, 4)))
+		assert.True(migrated(t, 5, nil))
+		assert.False(migrated(t, 4, parentAt(require, 3)))
+		assert.False(migrated(t, 7, parentAt(require, 6)))
+	})
+
+	t.Run("runs the upgrades of null blocks", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		assert.True(migrated(t, 7, parentAt(require, 4)))
+		assert.True(migrated(t, 6, parentAt(require, 4)))
+		assert.False(migrated(t, 4, parentAt(require, 1)))
+	})
+}
+
+func TestProcessorUpgradesPaymentBroker(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx := context.Background()
+	cst := hamt.NewCborStore()
+	vms := th.VMStorage()
+	mockSigner, _ := types.NewMockSignersAndKeyInfo(1)
+
+	fromAddr := mockSigner.Addresses[0]
+	minerOwnerAddr := address.NewForTestGetter()()
+	pbActor := actor.NewActor(types.PaymentBrokerActorCodeCid, types.ZeroAttoFIL)
+	_, st := th.RequireMakeStateTree(require, cst, map[address.Address]*actor.Actor{
+		address.NetworkAddress:       th.RequireNewAccountActor(require, types.NewAttoFILFromFIL(10000000)),
+		address.PaymentBrokerAddress: pbActor,
+		minerOwnerAddr:               th.RequireNewAccountActor(require, types.ZeroAttoFIL),
+		fromAddr:                     th.RequireNewAccountActor(require, types.NewAttoFILFromFIL(1000)),
+	})
+
+	schedule, err := NewProtocolSchedule(ProtocolVersions, []ProtocolUpgrade{{Version: 1, Height: 5}})
+	require.NoError(err)
+	processor := NewScheduledProcessor(schedule, nil, NewDefaultBlockRewarder())
+
+	params, err := abi.ToEncodedValues(fromAddr, types.NewChannelID(0))
+	require.NoError(err)
+	getChannel := func(nonce, height uint64) *types.MessageReceipt {
+		msg := types.NewMessage(fromAddr, address.PaymentBrokerAddress, nonce, types.ZeroAttoFIL, "getChannel", params)
+		smsg, err := types.NewSignedMessage(*msg, &mockSigner, types.NewGasPrice(0), types.NewGasUnits(1000))
+		require.NoError(err)
+		res, err := processor.ApplyMessagesAndPayRewards(ctx, st, vms, []*types.SignedMessage{smsg}, minerOwnerAddr, types.NewBlockHeight(height), nil)
+		require.NoError(err)
+		require.Len(res.Results, 1)
+		return res.Results[0].Receipt
+	}
+
+	// before the upgrade the payment broker does not export getChannel
+	receipt := getChannel(0, 4)
+	assert.NotEqual(uint8(0), receipt.ExitCode)
+	assert.NotEqual(uint8(paymentbroker.ErrUnknownChannel), receipt.ExitCode)
+	assert.Equal(types.PaymentBrokerActorCodeCid, state.MustGetActor(st, address.PaymentBrokerAddress).Code)
+
+	// the upgrade replaces the code of the payment broker, keeping its storage
+	receipt = getChannel(1, 5)
+	assert.Equal(uint8(paymentbroker.ErrUnknownChannel), receipt.ExitCode)
+	upgraded := state.MustGetActor(st, address.PaymentBrokerAddress)
+	assert.Equal(types.PaymentBrokerV1ActorCodeCid, upgraded.Code)
+	assert.Equal(pbActor.Head, upgraded.Head)
+}
@@ -18,6 +18,8 @@ type SignedMessageValidator interface {
 
 type defaultMessageValidator struct {
 	allowHighNonce bool
+	// simulation skips the checks of the signature and nonce.
+	simulation bool
 }
 
 // NewDefaultMessageValidator creates a new default validator.
@@ -27,6 +29,25 @@ func NewDefaultMessageValidator() SignedMessageValidator {
 	return &defaultMessageValidator{}
 }
 
+// validateMessageStructure errors if a message is invalid whatever the state
+// it is applied to.
+func validateMessageStructure(msg *types.SignedMessage) error {
+	if msg.From == msg.To {
+		return errSelfSend
+	}
+
+	if msg.Value.IsNegative() {
+		log.Info("Cannot transfer negative value", msg.Value)
+		return errNegativeValue
+	}
+
+	if msg.GasLimit > types.BlockGasLimit {
+		log.Info("Message gas limit above block limit", msg, types.BlockGasLimit)
+		return errGasAboveBlockLimit
+	}
+	return nil
+}
+
 // NewOutboundMessageValidator creates a new default validator for outbound messages. This
 // validator matches the default behaviour but allows nonces higher than the actor's current nonce
 // (allowing multiple messages to enter the mpool at once).
@@ -34,15 +55,23 @@ func NewOutboundMessageValidator() SignedMessageValidator {
 	return &defaultMessageValidator{allowHighNonce: true}
 }
 
+// NewSimulationMessageValidator creates a new default validator for messages applied off chain
+// to see their effects. This validator matches the default behaviour but doesn't check the
+// signature or the nonce, allowing unsigned messages and messages applied to other states than
+// the one they were sent for.
+func NewSimulationMessageValidator() SignedMessageValidator {
+	return &defaultMessageValidator{simulation: true}
+}
+
 var _ SignedMessageValidator = (*defaultMessageValidator)(nil)
 
 func (v *defaultMessageValidator) Validate(ctx context.Context, msg *types.SignedMessage, fromActor *actor.Actor) error {
-	if !msg.VerifySignature() {
+	if !v.simulation && !msg.VerifySignature() {
 		return errInvalidSignature
 	}
 
-	if msg.From == msg.To {
-		return errSelfSend
+	if err := validateMessageStructure(msg); err != nil {
+		return err
 	}
 
 	// Sender must be an account actor, or an empty actor which will be upgraded to an account actor
@@ -51,22 +80,16 @@ func (v *defaultMessageValidator) Validate(ctx context.Context, msg *types.Signe
 		return errNonAccountActor
 	}
 
-	if msg.Value.IsNegative() {
-		log.Info("Cannot transfer negative value", fromActor, msg.Value)
-		return errNegativeValue
-	}
-
-	if msg.GasLimit > types.BlockGasLimit {
-		log.Info("Message gas limit above block limit", fromActor, msg, types.BlockGasLimit)
-		return errGasAboveBlockLimit
-	}
-
 	// Avoid processing messages for actors that cannot pay.
 	if !canCoverGasLimit(msg, fromActor) {
 		log.Info("Insufficient funds to cover gas limit: ", fromActor, msg)
 		return errInsufficientGas
 	}
 
+	if v.simulation {
+		return nil
+	}
+
 	if msg.Nonce < fromActor.Nonce {
 		log.Info("Nonce too low: ", msg.Nonce, fromActor.Nonce, fromActor, msg)
 		return errNonceTooLow
@@ -109,6 +109,36 @@ func TestOutboundMessageValidator(t *testing.T) {
 	})
 }
 
+func TestSimulationMessageValidator(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	alice := addresses[0]
+	bob := addresses[1]
+	actor := newActor(t, 1000, 100)
+
+	validator := consensus.NewSimulationMessageValidator()
+	ctx := context.Background()
+
+	t.Run("allows any nonce", func(t *testing.T) {
+		msg := newMessage(t, alice, bob, 5, 5, 0, 0)
+		assert.NoError(validator.Validate(ctx, msg, actor))
+		msg = newMessage(t, alice, bob, 101, 5, 0, 0)
+		assert.NoError(validator.Validate(ctx, msg, actor))
+	})
+
+	t.Run("allows unsigned messages", func(t *testing.T) {
+		msg := newMessage(t, alice, bob, 100, 5, 0, 0)
+		msg.Signature = nil
+		assert.NoError(validator.Validate(ctx, msg, actor))
+	})
+
+	t.Run("still checks the value", func(t *testing.T) {
+		msg := newMessage(t, alice, bob, 100, 5000, 0, 0)
+		assert.Error(validator.Validate(ctx, msg, actor))
+	})
+}
+
 func newActor(t *testing.T, balanceAF int, nonce uint64) *actor.Actor {
 	actor, err := account.NewActor(attoFil(balanceAF))
 	require.NoError(t, err)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"sync"
 
+	"github.com/ipfs/go-cid"
 	"github.com/pkg/errors"
 
 	"github.com/filecoin-project/go-filecoin/address"
@@ -33,6 +34,10 @@ type MessageQueue struct {
 type QueuedMessage struct {
 	Msg   *types.SignedMessage
 	Stamp uint64
+	// Republished counts the times the message was published again after
+	// being enqueued, the last time at stamp RepublishedAt.
+	Republished   uint64
+	RepublishedAt uint64
 }
 
 // NewMessageQueue constructs a new, empty queue.
@@ -60,10 +65,42 @@ func (mq *MessageQueue) Enqueue(msg *types.SignedMessage, stamp uint64) error {
 			return errors.Errorf("Invalid nonce %d, expected %d", msg.Nonce, nextNonce)
 		}
 	}
-	mq.queues[msg.From] = append(q, &QueuedMessage{msg, stamp})
+	mq.queues[msg.From] = append(q, &QueuedMessage{Msg: msg, Stamp: stamp})
 	return nil
 }
 
+// Replace replaces the queued message with the same sender and nonce as msg by msg, keeping
+// its position in the queue. The replacement is stamped as if newly enqueued.
+// Returns the replaced message, or an error if no message with that nonce is queued.
+func (mq *MessageQueue) Replace(msg *types.SignedMessage, stamp uint64) (*types.SignedMessage, error) {
+	mq.lk.Lock()
+	defer mq.lk.Unlock()
+
+	for i, qm := range mq.queues[msg.From] {
+		if qm.Msg.Nonce == msg.Nonce {
+			mq.queues[msg.From][i] = &QueuedMessage{Msg: msg, Stamp: stamp}
+			return qm.Msg, nil
+		}
+	}
+	return nil, errors.Errorf("no message from %s with nonce %d in queue", msg.From, msg.Nonce)
+}
+
+// MarkRepublished records that the queued message from sender with the given nonce was
+// published again at stamp. Returns false if no such message is queued.
+func (mq *MessageQueue) MarkRepublished(sender address.Address, nonce uint64, stamp uint64) bool {
+	mq.lk.Lock()
+	defer mq.lk.Unlock()
+
+	for _, qm := range mq.queues[sender] {
+		if uint64(qm.Msg.Nonce) == nonce {
+			qm.Republished++
+			qm.RepublishedAt = stamp
+			return true
+		}
+	}
+	return false
+}
+
 // RemoveNext removes and returns a single message from the queue, if it bears the expected nonce value, with found = true.
 // Returns found = false if the queue is empty or the expected nonce is less than any in the queue for that address
 // (indicating the message had already been removed).
@@ -174,6 +211,26 @@ func (mq *MessageQueue) Size() int64 {
 	return l
 }
 
+// Get returns a copy of the queued message with the given cid, if any.
+func (mq *MessageQueue) Get(c cid.Cid) (*QueuedMessage, bool, error) {
+	mq.lk.RLock()
+	defer mq.lk.RUnlock()
+
+	for _, q := range mq.queues {
+		for _, qm := range q {
+			mc, err := qm.Msg.Cid()
+			if err != nil {
+				return nil, false, err
+			}
+			if mc.Equals(c) {
+				out := *qm
+				return &out, true, nil
+			}
+		}
+	}
+	return nil, false, nil
+}
+
 // List returns a copy of the list of messages queued for an address.
 func (mq *MessageQueue) List(sender address.Address) []*QueuedMessage {
 	mq.lk.RLock()
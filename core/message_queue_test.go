@@ -284,4 +284,39 @@ func TestMessageQueue(t *testing.T) {
 		assert.Empty(q.List(bob))
 		assertNoNonce(q, bob)
 	})
+
+	t.Run("replace and get", func(t *testing.T) {
+		q := core.NewMessageQueue()
+		msgs := []*types.SignedMessage{
+			mm.NewSignedMessage(alice, 0),
+			mm.NewSignedMessage(alice, 1),
+		}
+		requireEnqueue(q, msgs[0], 100)
+		requireEnqueue(q, msgs[1], 101)
+		assert.True(q.MarkRepublished(alice, 1, 104))
+
+		replacement := mm.NewSignedMessage(alice, 1)
+		replaced, err := q.Replace(replacement, 105)
+		require.NoError(err)
+		assert.Equal(msgs[1], replaced)
+		assert.Equal(&core.QueuedMessage{Msg: replacement, Stamp: 105}, q.List(alice)[1])
+		assertLargestNonce(q, alice, 1)
+
+		c, err := replacement.Cid()
+		require.NoError(err)
+		got, found, err := q.Get(c)
+		require.NoError(err)
+		assert.True(found)
+		assert.Equal(replacement, got.Msg)
+
+		c, err = msgs[1].Cid()
+		require.NoError(err)
+		_, found, err = q.Get(c)
+		require.NoError(err)
+		assert.False(found)
+
+		_, err = q.Replace(mm.NewSignedMessage(alice, 2), 105)
+		assert.Error(err)
+		assert.False(q.MarkRepublished(bob, 0, 105))
+	})
 }
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"context"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// OutboxRepublishRounds is the number of rounds a message may stay in the outbound message queue
+// without being included in a block before it is published again.
+// It is shorter than OutboxMaxAgeRounds so that messages are republished a few times before expiring.
+const OutboxRepublishRounds = 3
+
+// The outbound queue object on which the republisher acts.
+type republishTarget interface {
+	Queues() []address.Address
+	List(sender address.Address) []*QueuedMessage
+	MarkRepublished(sender address.Address, nonce uint64, stamp uint64) bool
+}
+
+// MessageRepublisher publishes outbound messages again when they have not been included
+// in a block for a number of rounds, in case the network or the miners dropped them.
+type MessageRepublisher struct {
+	// The queue on which this republisher acts
+	queue republishTarget
+	// Invoked to publish a message again
+	publish func(ctx context.Context, msg *types.SignedMessage) error
+	// Rounds to wait after a message was last published before publishing it again
+	intervalRounds uint64
+}
+
+// NewMessageRepublisher returns a new republisher which publishes the messages of the queue
+// again every `intervalRounds` rounds until they are removed from the queue.
+func NewMessageRepublisher(queue *MessageQueue, publish func(ctx context.Context, msg *types.SignedMessage) error, intervalRounds uint64) *MessageRepublisher {
+	return &MessageRepublisher{queue, publish, intervalRounds}
+}
+
+// OnNewHeadTipset republishes the queued messages last published at least `intervalRounds`
+// rounds before the new head.
+// It should be called after the queue policy has removed the messages included in the new head.
+func (r *MessageRepublisher) OnNewHeadTipset(ctx context.Context, oldHead, newHead types.TipSet) error {
+	height, err := newHead.Height()
+	if err != nil {
+		return err
+	}
+
+	for _, sender := range r.queue.Queues() {
+		for _, qm := range r.queue.List(sender) {
+			last := qm.Stamp
+			if qm.RepublishedAt > last {
+				last = qm.RepublishedAt
+			}
+			if height < last+r.intervalRounds {
+				continue
+			}
+
+			// A failure to publish one message shouldn't prevent the others from being published.
+			if err := r.publish(ctx, qm.Msg); err != nil {
+				log.Errorf("Failed to republish outbound message %v: %s", qm.Msg, err)
+				continue
+			}
+			r.queue.MarkRepublished(sender, uint64(qm.Msg.Nonce), height)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/core"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestMessageRepublisher(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	keys := types.MustGenerateKeyInfo(2, types.GenerateKeyInfoSeed())
+	mm := types.NewMessageMaker(t, keys)
+	alice := mm.Addresses()[0]
+	bob := mm.Addresses()[1]
+
+	head := func(height uint64) types.TipSet {
+		return requireTipset(t, &types.Block{Height: types.Uint64(height)})
+	}
+
+	t.Run("republishes messages not published for the interval", func(t *testing.T) {
+		q := core.NewMessageQueue()
+		fromAlice := mm.NewSignedMessage(alice, 1)
+		fromBob := mm.NewSignedMessage(bob, 1)
+		require.NoError(q.Enqueue(fromAlice, 100))
+		require.NoError(q.Enqueue(fromBob, 102))
+
+		var published []*types.SignedMessage
+		publish := func(ctx context.Context, msg *types.SignedMessage) error {
+			published = append(published, msg)
+			return nil
+		}
+		r := core.NewMessageRepublisher(q, publish, 3)
+
+		require.NoError(r.OnNewHeadTipset(ctx, head(101), head(102)))
+		assert.Empty(published)
+
+		require.NoError(r.OnNewHeadTipset(ctx, head(102), head(103)))
+		assert.Equal([]*types.SignedMessage{fromAlice}, published)
+		assert.Equal(uint64(1), q.List(alice)[0].Republished)
+		assert.Equal(uint64(103), q.List(alice)[0].RepublishedAt)
+
+		// Alice's message waits for the interval again.
+		published = nil
+		require.NoError(r.OnNewHeadTipset(ctx, head(103), head(105)))
+		assert.Equal([]*types.SignedMessage{fromBob}, published)
+
+		published = nil
+		require.NoError(r.OnNewHeadTipset(ctx, head(105), head(106)))
+		assert.Equal([]*types.SignedMessage{fromAlice}, published)
+		assert.Equal(uint64(2), q.List(alice)[0].Republished)
+	})
+
+	t.Run("publish failure does not mark message", func(t *testing.T) {
+		q := core.NewMessageQueue()
+		require.NoError(q.Enqueue(mm.NewSignedMessage(alice, 1), 100))
+
+		r := core.NewMessageRepublisher(q, func(context.Context, *types.SignedMessage) error {
+			return errors.New("no peers")
+		}, 3)
+
+		require.NoError(r.OnNewHeadTipset(ctx, head(102), head(103)))
+		assert.Equal(uint64(0), q.List(alice)[0].Republished)
+	})
+}
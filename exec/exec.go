@@ -26,13 +26,17 @@ const (
 	ErrStaleHead = 35
 	// ErrInsufficientGas indicates that an actor did not have sufficient gas to run a message
 	ErrInsufficientGas = 36
+	// ErrSendDepthExceeded indicates that an actor sent a message nested in
+	// too many other sends
+	ErrSendDepthExceeded = 37
 )
 
 // Errors map error codes to revert errors this actor may return
 var Errors = map[uint8]error{
-	ErrDecode:          errors.NewCodedRevertError(ErrDecode, "State could not be decoded"),
-	ErrDanglingPointer: errors.NewCodedRevertError(ErrDanglingPointer, "State contains pointer to non-existent chunk"),
-	ErrStaleHead:       errors.NewCodedRevertError(ErrStaleHead, "Expected head is stale"),
+	ErrDecode:            errors.NewCodedRevertError(ErrDecode, "State could not be decoded"),
+	ErrDanglingPointer:   errors.NewCodedRevertError(ErrDanglingPointer, "State contains pointer to non-existent chunk"),
+	ErrStaleHead:         errors.NewCodedRevertError(ErrStaleHead, "Expected head is stale"),
+	ErrSendDepthExceeded: errors.NewCodedRevertError(ErrSendDepthExceeded, "Send depth exceeded"),
 }
 
 // Exports describe the public methods of an actor.
@@ -53,16 +57,82 @@ type ExecutableActor interface {
 	InitializeState(storage Storage, initializerData interface{}) error
 }
 
+// Dispatcher is implemented by the actors whose exported methods are not Go
+// methods, like the actors deployed by users. Dispatch is called in place of
+// the Go method with the params decoded after the signature of the method and
+// returns its return values.
+type Dispatcher interface {
+	Dispatch(ctx VMContext, method string, params []interface{}) ([]interface{}, uint8, error)
+}
+
+// Schema returns the schemas of the methods the actor exports.
+func (e Exports) Schema() abi.ExportsSchema {
+	schema := make(abi.ExportsSchema, len(e))
+	for method, sig := range e {
+		schema[method] = sig.Schema()
+	}
+	return schema
+}
+
+// ExportsMethod is the method every actor answers with its exports,
+// described by an abi.ExportsSchema encoded to JSON, unless it exports a
+// method of that name itself.
+const ExportsMethod = "exports"
+
+// ExportsSignature is the signature of the ExportsMethod.
+var ExportsSignature = &FunctionSignature{
+	Params: nil,
+	Return: []abi.Type{abi.Bytes},
+}
+
 // ExportedFunc is the signature an exported method of an actor is expected to have.
 type ExportedFunc func(ctx VMContext) ([]byte, uint8, error)
 
 // FunctionSignature describes the signature of a single function.
-// TODO: convert signatures into non go types, but rather low level agreed up types
 type FunctionSignature struct {
 	// Params is a list of the types of the parameters the function expects.
 	Params []abi.Type
 	// Return is the type of the return value of the function.
 	Return []abi.Type
+	// ParamSchemas and ReturnSchemas describe the parameters and return
+	// values when any is of a compound type, and are nil otherwise.
+	ParamSchemas  []*abi.Schema `json:",omitempty"`
+	ReturnSchemas []*abi.Schema `json:",omitempty"`
+}
+
+// NewFunctionSignature returns the signature of a function taking and
+// returning values of the given schemas.
+func NewFunctionSignature(params, ret []*abi.Schema) *FunctionSignature {
+	sig := &FunctionSignature{}
+	for _, p := range params {
+		sig.Params = append(sig.Params, p.Type)
+	}
+	for _, r := range ret {
+		sig.Return = append(sig.Return, r.Type)
+	}
+	if hasCompound(params) || hasCompound(ret) {
+		sig.ParamSchemas = params
+		sig.ReturnSchemas = ret
+	}
+	return sig
+}
+
+func hasCompound(schemas []*abi.Schema) bool {
+	for _, s := range schemas {
+		if s.Type.IsCompound() {
+			return true
+		}
+	}
+	return false
+}
+
+// Schema returns the schemas of the parameters and return values of the
+// function.
+func (sig *FunctionSignature) Schema() *abi.MethodSchema {
+	if sig.ParamSchemas != nil || sig.ReturnSchemas != nil {
+		return &abi.MethodSchema{Params: sig.ParamSchemas, Return: sig.ReturnSchemas}
+	}
+	return &abi.MethodSchema{Params: abi.Basics(sig.Params), Return: abi.Basics(sig.Return)}
 }
 
 // VMContext defines the ABI interface exposed to actors.
@@ -74,9 +144,17 @@ type VMContext interface {
 	BlockHeight() *types.BlockHeight
 	IsFromAccountActor() bool
 	Charge(cost types.GasUnits) error
+	GasPrices() *types.PriceList
 	SampleChainRandomness(sampleHeight *types.BlockHeight) ([]byte, error)
+	// Emit records an event of the actor with data, cbor encoded, into the
+	// receipt of the message. The events of a call that fails are dropped.
+	Emit(topic string, data interface{}) error
 
 	CreateNewActor(addr address.Address, code cid.Cid, initalizationParams interface{}) error
+	// DeployActor creates an actor at the given address running the given
+	// WebAssembly code and returns the CID of the code, which becomes the
+	// code of the actor.
+	DeployActor(addr address.Address, code []byte) (cid.Cid, error)
 
 	// TODO: Remove these when Storage above is completely implemented
 	ReadStorage() ([]byte, error)
@@ -101,3 +179,21 @@ type Lookup interface {
 	IsEmpty() bool
 	Values(ctx context.Context) ([]*hamt.KV, error)
 }
+
+// StateDiffer is implemented by the actors able to decode their state to
+// show how it changed.
+type StateDiffer interface {
+	// DiffState returns the changes from the state in before to the state in
+	// after. The head of a storage is undefined if the actor has no state.
+	DiffState(ctx context.Context, before, after Storage) ([]StateChange, error)
+}
+
+// StateChange is a change of a part of the state of an actor.
+type StateChange struct {
+	// Field names the part changed, e.g. "asks/2".
+	Field string
+	// Before is the part before the change, empty if it was added.
+	Before string `json:",omitempty"`
+	// After is the part after the change, empty if it was removed.
+	After string `json:",omitempty"`
+}
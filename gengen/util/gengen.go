@@ -59,6 +59,10 @@ type GenesisCfg struct {
 
 	// Miners is a list of miners that should be set up at the start of the network
 	Miners []Miner
+
+	// Upgrades are the heights at which the network upgrades to later
+	// protocol versions. All the nodes of the network run them.
+	Upgrades []consensus.ProtocolUpgrade
 }
 
 // RenderedGenInfo contains information about a genesis block creation
@@ -113,6 +117,17 @@ func GenGen(ctx context.Context, cfg *GenesisCfg, cst *hamt.CborIpldStore, bs bl
 		return nil, err
 	}
 
+	if err := consensus.RegisterGenesisActorIDs(ctx, st, storageMap); err != nil {
+		return nil, err
+	}
+
+	if err := consensus.SetupProtocolUpgrades(ctx, st, storageMap, cfg.Upgrades); err != nil {
+		return nil, err
+	}
+
+	if err := cst.Blocks.AddBlock(types.InitActorCodeObj); err != nil {
+		return nil, err
+	}
 	if err := cst.Blocks.AddBlock(types.StorageMarketActorCodeObj); err != nil {
 		return nil, err
 	}
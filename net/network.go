@@ -25,6 +25,7 @@ type SwarmConnInfo struct {
 	Latency string
 	Muxer   string
 	Streams []SwarmStreamInfo
+	Score   *PeerScore `json:",omitempty"`
 }
 
 // SwarmStreamInfo represents details about a single swarm stream.
@@ -69,6 +70,7 @@ type Network struct {
 	metrics.Reporter
 	*Router
 	*ping.PingService
+	peerManager *PeerManager
 }
 
 // New returns a new Network
@@ -79,10 +81,12 @@ func New(
 	router *Router,
 	reporter metrics.Reporter,
 	pinger *ping.PingService,
+	peerManager *PeerManager,
 ) *Network {
 	return &Network{
 		host:        host,
 		PingService: pinger,
+		peerManager: peerManager,
 		Publisher:   publisher,
 		Reporter:    reporter,
 		Router:      router,
@@ -150,7 +154,7 @@ func (network *Network) Connect(ctx context.Context, addrs []string) (<-chan Con
 }
 
 // Peers lists peers currently available on the network
-func (network *Network) Peers(ctx context.Context, verbose, latency, streams bool) (*SwarmConnInfos, error) {
+func (network *Network) Peers(ctx context.Context, verbose, latency, streams, scores bool) (*SwarmConnInfos, error) {
 	if network.host == nil {
 		return nil, errors.New("node must be online")
 	}
@@ -182,6 +186,10 @@ func (network *Network) Peers(ctx context.Context, verbose, latency, streams boo
 				ci.Streams = append(ci.Streams, SwarmStreamInfo{Protocol: string(s.Protocol())})
 			}
 		}
+		if (verbose || scores) && network.peerManager != nil {
+			score := network.peerManager.Score(pid)
+			ci.Score = &score
+		}
 		sort.Sort(&ci)
 		out.Peers = append(out.Peers, ci)
 	}
@@ -189,3 +197,19 @@ func (network *Network) Peers(ctx context.Context, verbose, latency, streams boo
 	sort.Sort(&out)
 	return &out, nil
 }
+
+// ProtectPeer protects the connections to p from trimming with the given tag.
+func (network *Network) ProtectPeer(p peer.ID, tag string) {
+	if network.peerManager != nil {
+		network.peerManager.Protect(p, tag)
+	}
+}
+
+// UnprotectPeer removes a tag protecting the connections to p and reports
+// whether p is still protected.
+func (network *Network) UnprotectPeer(p peer.ID, tag string) bool {
+	if network.peerManager == nil {
+		return false
+	}
+	return network.peerManager.Unprotect(p, tag)
+}
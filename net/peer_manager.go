@@ -0,0 +1,360 @@
+package net
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log"
+	host "github.com/libp2p/go-libp2p-host"
+	inet "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var logPeerManager = logging.Logger("net.peermanager")
+
+// ProtectStorageDeal is the tag protecting the miners the node has storage
+// deals with.
+const ProtectStorageDeal = "storage-deal"
+
+// The weights of the behaviours of a peer in its score.
+const (
+	// validHelloScore is added once the peer sent a valid hello.
+	validHelloScore = 10
+	// invalidHelloPenalty is subtracted for each invalid hello, e.g. on
+	// another chain.
+	invalidHelloPenalty = 50
+	// usefulSyncScore is added for each tipset from the peer synced, up to
+	// maxSyncScore.
+	usefulSyncScore = 2
+	maxSyncScore    = 50
+	// failedSyncPenalty is subtracted for each tipset from the peer which
+	// could not be synced.
+	failedSyncPenalty = 2
+	// invalidPenalty is subtracted for each invalid block, tipset or
+	// message the peer sent.
+	invalidPenalty = 20
+	// latencyPenaltyUnit is the latency costing a point, up to
+	// maxLatencyPenalty.
+	latencyPenaltyUnit = 50 * time.Millisecond
+	maxLatencyPenalty  = 20
+)
+
+// recordRetention is how long the record of a disconnected peer is kept, in
+// case it reconnects.
+var recordRetention = time.Hour
+
+// FaultCounter returns the number of invalid blocks, tipsets or messages a
+// peer sent.
+type FaultCounter func(p peer.ID) int
+
+// PeerScore is the score of a peer and the behaviours it is computed from.
+type PeerScore struct {
+	Peer string
+	// Score is higher for more useful peers. Connections to the peers with
+	// the lowest scores are closed first.
+	Score         int
+	ValidHellos   int
+	InvalidHellos int
+	UsefulSyncs   int
+	FailedSyncs   int
+	// Invalid is the number of invalid blocks, tipsets or messages sent.
+	Invalid int
+	Latency time.Duration
+	// Protected are the tags protecting the peer, empty if not protected.
+	Protected []string
+}
+
+type peerRecord struct {
+	validHellos   int
+	invalidHellos int
+	usefulSyncs   int
+	failedSyncs   int
+}
+
+// PeerManager tracks the behaviour of the peers and keeps the number of
+// connections between water marks. When the number of connected peers goes
+// above the high water mark, the connections to the peers with the lowest
+// scores are closed until the low water mark is reached. Protected peers and
+// peers connected for less than the grace period are kept.
+type PeerManager struct {
+	h           host.Host
+	lowWater    int
+	highWater   int
+	gracePeriod time.Duration
+	invalid     FaultCounter
+
+	// lk protects the fields below.
+	lk      sync.Mutex
+	records map[peer.ID]*peerRecord
+	// protected maps peers to the tags protecting them.
+	protected map[peer.ID]map[string]struct{}
+	// connected maps connected peers to the time they connected.
+	connected map[peer.ID]time.Time
+	// disconnected maps the peers with a record which are disconnected to
+	// the time they disconnected.
+	disconnected map[peer.ID]time.Time
+
+	// trim is signaled when the connections may need trimming.
+	trim   chan struct{}
+	cancel context.CancelFunc
+}
+
+// NewPeerManager returns a PeerManager for the connections of h. A zero high
+// water mark disables trimming. invalid counts the invalid data sent by peers.
+func NewPeerManager(h host.Host, lowWater, highWater int, gracePeriod time.Duration, invalid FaultCounter) *PeerManager {
+	pm := &PeerManager{
+		h:            h,
+		lowWater:     lowWater,
+		highWater:    highWater,
+		gracePeriod:  gracePeriod,
+		invalid:      invalid,
+		records:      make(map[peer.ID]*peerRecord),
+		protected:    make(map[peer.ID]map[string]struct{}),
+		connected:    make(map[peer.ID]time.Time),
+		disconnected: make(map[peer.ID]time.Time),
+		trim:         make(chan struct{}, 1),
+	}
+	for _, p := range h.Network().Peers() {
+		pm.connected[p] = time.Now()
+	}
+	h.Network().Notify((*peerManagerNotify)(pm))
+	return pm
+}
+
+// Start starts trimming the connections when they go above the high water
+// mark, and every period, when the records of the peers disconnected for
+// long are also dropped. Cancel ctx or call Stop to stop it.
+func (pm *PeerManager) Start(ctx context.Context, period time.Duration) {
+	ctx, pm.cancel = context.WithCancel(ctx)
+	go func() {
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				pm.pruneRecords(time.Now())
+			case <-pm.trim:
+			}
+			pm.TrimConnections()
+		}
+	}()
+}
+
+// Stop stops the trimming of the connections.
+func (pm *PeerManager) Stop() {
+	if pm.cancel != nil {
+		pm.cancel()
+	}
+}
+
+// RecordHello records a hello from p, valid if it is on the same chain and
+// compatible.
+func (pm *PeerManager) RecordHello(p peer.ID, valid bool) {
+	pm.lk.Lock()
+	defer pm.lk.Unlock()
+	if valid {
+		pm.record(p).validHellos++
+	} else {
+		pm.record(p).invalidHellos++
+	}
+}
+
+// RecordSync records the sync of a tipset announced by p, useful if it
+// succeeded. Only the syncs failing because of p should be recorded.
+func (pm *PeerManager) RecordSync(p peer.ID, useful bool) {
+	pm.lk.Lock()
+	defer pm.lk.Unlock()
+	if useful {
+		pm.record(p).usefulSyncs++
+	} else {
+		pm.record(p).failedSyncs++
+	}
+}
+
+// Protect protects p from trimming with the given tag, until all its tags
+// are removed with Unprotect.
+func (pm *PeerManager) Protect(p peer.ID, tag string) {
+	pm.lk.Lock()
+	defer pm.lk.Unlock()
+	tags, ok := pm.protected[p]
+	if !ok {
+		tags = make(map[string]struct{})
+		pm.protected[p] = tags
+	}
+	tags[tag] = struct{}{}
+}
+
+// Unprotect removes a tag protecting p and reports whether p is still
+// protected.
+func (pm *PeerManager) Unprotect(p peer.ID, tag string) bool {
+	pm.lk.Lock()
+	defer pm.lk.Unlock()
+	tags := pm.protected[p]
+	delete(tags, tag)
+	if len(tags) == 0 {
+		delete(pm.protected, p)
+		return false
+	}
+	return true
+}
+
+// Score returns the score of p.
+func (pm *PeerManager) Score(p peer.ID) PeerScore {
+	pm.lk.Lock()
+	defer pm.lk.Unlock()
+	return pm.score(p)
+}
+
+// TrimConnections closes the connections to the peers with the lowest scores
+// if the number of connected peers is above the high water mark, until it is
+// down to the low water mark.
+func (pm *PeerManager) TrimConnections() {
+	peers := pm.h.Network().Peers()
+	if pm.highWater <= 0 || len(peers) <= pm.highWater {
+		return
+	}
+
+	type candidate struct {
+		id    peer.ID
+		score int
+	}
+	pm.lk.Lock()
+	var candidates []candidate
+	for _, p := range peers {
+		if _, ok := pm.protected[p]; ok {
+			continue
+		}
+		if since, ok := pm.connected[p]; ok && time.Since(since) < pm.gracePeriod {
+			continue
+		}
+		candidates = append(candidates, candidate{p, pm.score(p).Score})
+	}
+	pm.lk.Unlock()
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].score < candidates[j].score })
+	toClose := len(peers) - pm.lowWater
+	for _, c := range candidates {
+		if toClose <= 0 {
+			break
+		}
+		logPeerManager.Infof("closing connection to peer %s with score %d", c.id.Pretty(), c.score)
+		if err := pm.h.Network().ClosePeer(c.id); err != nil {
+			logPeerManager.Warningf("failed to close connection to peer %s: %s", c.id.Pretty(), err)
+			continue
+		}
+		toClose--
+	}
+}
+
+// pruneRecords drops the records of the peers disconnected for longer than
+// recordRetention at now.
+func (pm *PeerManager) pruneRecords(now time.Time) {
+	pm.lk.Lock()
+	defer pm.lk.Unlock()
+	for p, since := range pm.disconnected {
+		if now.Sub(since) >= recordRetention {
+			delete(pm.records, p)
+			delete(pm.disconnected, p)
+		}
+	}
+}
+
+// record returns the record of p, creating it if needed.
+// Precondition: the caller holds pm.lk.
+func (pm *PeerManager) record(p peer.ID) *peerRecord {
+	r, ok := pm.records[p]
+	if !ok {
+		r = &peerRecord{}
+		pm.records[p] = r
+		if _, ok := pm.connected[p]; !ok {
+			pm.disconnected[p] = time.Now()
+		}
+	}
+	return r
+}
+
+// score computes the score of p.
+// Precondition: the caller holds pm.lk.
+func (pm *PeerManager) score(p peer.ID) PeerScore {
+	s := PeerScore{Peer: p.Pretty()}
+	if r, ok := pm.records[p]; ok {
+		s.ValidHellos = r.validHellos
+		s.InvalidHellos = r.invalidHellos
+		s.UsefulSyncs = r.usefulSyncs
+		s.FailedSyncs = r.failedSyncs
+	}
+	if pm.invalid != nil {
+		s.Invalid = pm.invalid(p)
+	}
+	s.Latency = pm.h.Peerstore().LatencyEWMA(p)
+	for tag := range pm.protected[p] {
+		s.Protected = append(s.Protected, tag)
+	}
+	sort.Strings(s.Protected)
+
+	if s.ValidHellos > 0 {
+		s.Score += validHelloScore
+	}
+	s.Score -= s.InvalidHellos * invalidHelloPenalty
+	syncScore := s.UsefulSyncs * usefulSyncScore
+	if syncScore > maxSyncScore {
+		syncScore = maxSyncScore
+	}
+	s.Score += syncScore
+	s.Score -= s.FailedSyncs * failedSyncPenalty
+	s.Score -= s.Invalid * invalidPenalty
+	latencyPenalty := int(s.Latency / latencyPenaltyUnit)
+	if latencyPenalty > maxLatencyPenalty {
+		latencyPenalty = maxLatencyPenalty
+	}
+	s.Score -= latencyPenalty
+	return s
+}
+
+// Connection notifications
+
+type peerManagerNotify PeerManager
+
+func (pn *peerManagerNotify) manager() *PeerManager {
+	return (*PeerManager)(pn)
+}
+
+func (pn *peerManagerNotify) Connected(n inet.Network, c inet.Conn) {
+	pm := pn.manager()
+	pm.lk.Lock()
+	if _, ok := pm.connected[c.RemotePeer()]; !ok {
+		pm.connected[c.RemotePeer()] = time.Now()
+	}
+	delete(pm.disconnected, c.RemotePeer())
+	pm.lk.Unlock()
+
+	if pm.highWater > 0 && len(n.Peers()) > pm.highWater {
+		select {
+		case pm.trim <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (pn *peerManagerNotify) Disconnected(n inet.Network, c inet.Conn) {
+	pm := pn.manager()
+	if len(n.ConnsToPeer(c.RemotePeer())) > 0 {
+		return
+	}
+	pm.lk.Lock()
+	defer pm.lk.Unlock()
+	delete(pm.connected, c.RemotePeer())
+	if _, ok := pm.records[c.RemotePeer()]; ok {
+		pm.disconnected[c.RemotePeer()] = time.Now()
+	}
+}
+
+func (pn *peerManagerNotify) Listen(n inet.Network, a ma.Multiaddr)      {}
+func (pn *peerManagerNotify) ListenClose(n inet.Network, a ma.Multiaddr) {}
+func (pn *peerManagerNotify) OpenedStream(n inet.Network, s inet.Stream) {}
+func (pn *peerManagerNotify) ClosedStream(n inet.Network, s inet.Stream) {}
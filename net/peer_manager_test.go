@@ -0,0 +1,163 @@
+package net
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-peer"
+	"github.com/libp2p/go-libp2p/p2p/net/mock"
+	ast "github.com/stretchr/testify/assert"
+	req "github.com/stretchr/testify/require"
+)
+
+func TestPeerManagerScore(t *testing.T) {
+	t.Parallel()
+	assert := ast.New(t)
+	require := req.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mn, err := mocknet.WithNPeers(ctx, 2)
+	require.NoError(err)
+	self, other := mn.Hosts()[0], mn.Hosts()[1].ID()
+
+	invalid := 0
+	pm := NewPeerManager(self, 0, 0, 0, func(p peer.ID) int { return invalid })
+
+	assert.Equal(0, pm.Score(other).Score)
+
+	pm.RecordHello(other, true)
+	pm.RecordHello(other, true)
+	assert.Equal(validHelloScore, pm.Score(other).Score)
+
+	pm.RecordSync(other, true)
+	pm.RecordSync(other, false)
+	assert.Equal(validHelloScore+usefulSyncScore-failedSyncPenalty, pm.Score(other).Score)
+
+	for i := 0; i < 100; i++ {
+		pm.RecordSync(other, true)
+	}
+	assert.Equal(validHelloScore+maxSyncScore-failedSyncPenalty, pm.Score(other).Score)
+
+	invalid = 1
+	pm.RecordHello(other, false)
+	score := pm.Score(other)
+	assert.Equal(validHelloScore+maxSyncScore-failedSyncPenalty-invalidPenalty-invalidHelloPenalty, score.Score)
+	assert.Equal(2, score.ValidHellos)
+	assert.Equal(1, score.InvalidHellos)
+	assert.Equal(101, score.UsefulSyncs)
+	assert.Equal(1, score.FailedSyncs)
+	assert.Equal(1, score.Invalid)
+}
+
+func TestPeerManagerPruneRecords(t *testing.T) {
+	t.Parallel()
+	assert := ast.New(t)
+	require := req.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mn, err := mocknet.WithNPeers(ctx, 3)
+	require.NoError(err)
+	require.NoError(mn.LinkAll())
+	self, connected, gone := mn.Hosts()[0], mn.Hosts()[1].ID(), mn.Hosts()[2].ID()
+
+	_, err = mn.ConnectPeers(self.ID(), connected)
+	require.NoError(err)
+	pm := NewPeerManager(self, 0, 0, 0, nil)
+	pm.RecordHello(connected, true)
+	pm.RecordHello(gone, true)
+
+	pm.pruneRecords(time.Now())
+	assert.Equal(1, pm.Score(gone).ValidHellos)
+
+	// The records of disconnected peers are dropped after a while.
+	pm.pruneRecords(time.Now().Add(recordRetention))
+	assert.Equal(0, pm.Score(gone).ValidHellos)
+	assert.Equal(1, pm.Score(connected).ValidHellos)
+}
+
+func TestPeerManagerProtect(t *testing.T) {
+	t.Parallel()
+	assert := ast.New(t)
+	require := req.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mn, err := mocknet.WithNPeers(ctx, 2)
+	require.NoError(err)
+	self, other := mn.Hosts()[0], mn.Hosts()[1].ID()
+
+	pm := NewPeerManager(self, 0, 0, 0, nil)
+	pm.Protect(other, ProtectStorageDeal)
+	pm.Protect(other, "other")
+	assert.Equal([]string{"other", ProtectStorageDeal}, pm.Score(other).Protected)
+
+	assert.True(pm.Unprotect(other, "other"))
+	assert.False(pm.Unprotect(other, ProtectStorageDeal))
+	assert.Empty(pm.Score(other).Protected)
+}
+
+func TestPeerManagerTrimConnections(t *testing.T) {
+	t.Parallel()
+	assert := ast.New(t)
+	require := req.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mn, err := mocknet.WithNPeers(ctx, 6)
+	require.NoError(err)
+	require.NoError(mn.LinkAll())
+	self := mn.Hosts()[0]
+	var others []peer.ID
+	for _, h := range mn.Hosts()[1:] {
+		others = append(others, h.ID())
+	}
+
+	pm := NewPeerManager(self, 2, 4, 0, nil)
+	for _, p := range others {
+		_, err := mn.ConnectPeers(self.ID(), p)
+		require.NoError(err)
+	}
+	require.Len(self.Network().Peers(), 5)
+
+	// The two best peers are kept, except for a protected one.
+	pm.RecordHello(others[0], true)
+	pm.RecordHello(others[1], true)
+	pm.RecordHello(others[1], false)
+	pm.RecordSync(others[2], true)
+	pm.Protect(others[4], ProtectStorageDeal)
+
+	pm.TrimConnections()
+
+	connected := self.Network().Peers()
+	assert.Len(connected, 2)
+	assert.Contains(connected, others[0])
+	assert.Contains(connected, others[4])
+
+	// Nothing is trimmed below the high water mark.
+	_, err = mn.ConnectPeers(self.ID(), others[1])
+	require.NoError(err)
+	pm.TrimConnections()
+	assert.Len(self.Network().Peers(), 3)
+}
+
+func TestPeerManagerGracePeriod(t *testing.T) {
+	t.Parallel()
+	assert := ast.New(t)
+	require := req.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mn, err := mocknet.WithNPeers(ctx, 4)
+	require.NoError(err)
+	require.NoError(mn.LinkAll())
+	self := mn.Hosts()[0]
+
+	pm := NewPeerManager(self, 1, 2, time.Hour, nil)
+	require.NoError(mn.ConnectAllButSelf())
+
+	pm.TrimConnections()
+	assert.Len(self.Network().Peers(), 3)
+}
@@ -0,0 +1,92 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+
+	logging "github.com/ipfs/go-log"
+	"github.com/libp2p/go-libp2p-peer"
+	libp2p "github.com/libp2p/go-libp2p-pubsub"
+
+	"github.com/filecoin-project/go-filecoin/metrics"
+)
+
+var log = logging.Logger("net.pubsub")
+
+var rejectedCounter *metrics.Int64Counter
+
+func init() {
+	rejectedCounter = metrics.NewInt64Counter("pubsub/rejected_messages", "Number of pubsub messages rejected by topic validators")
+}
+
+// Validator checks the data of a pubsub message, returning an error if it is
+// invalid.
+type Validator func(ctx context.Context, data []byte) error
+
+// ignoredError wraps the error of a message which can't be validated
+// locally, but which is not known to be invalid either.
+type ignoredError struct {
+	err error
+}
+
+func (e *ignoredError) Error() string {
+	return e.err.Error()
+}
+
+// Ignore wraps the error of a validator which can't tell whether a message
+// is valid, like one referring to data the node does not have yet. The
+// message is neither delivered nor relayed, but is not counted against the
+// peer which sent it.
+func Ignore(err error) error {
+	return &ignoredError{err: err}
+}
+
+// PeerRejections counts the pubsub messages rejected by topic validators per
+// peer which sent them. It is safe for concurrent use.
+type PeerRejections struct {
+	lk     sync.Mutex
+	byPeer map[peer.ID]int
+}
+
+// NewPeerRejections returns an empty PeerRejections.
+func NewPeerRejections() *PeerRejections {
+	return &PeerRejections{byPeer: make(map[peer.ID]int)}
+}
+
+// Count returns the number of messages sent by p which were rejected.
+func (r *PeerRejections) Count(p peer.ID) int {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	return r.byPeer[p]
+}
+
+func (r *PeerRejections) add(p peer.ID) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.byPeer[p]++
+}
+
+// NewTopicValidator returns a libp2p pubsub validator of the messages of a
+// topic running validate on their data. The messages which fail validation
+// are neither delivered to subscribers nor relayed to other peers, and are
+// counted in rejections against the peer which sent them, unless it is self
+// or the error of validate is wrapped with Ignore.
+func NewTopicValidator(topic string, self peer.ID, validate Validator, rejections *PeerRejections) libp2p.Validator {
+	return func(ctx context.Context, from peer.ID, msg *libp2p.Message) bool {
+		err := validate(ctx, msg.GetData())
+		if err == nil {
+			return true
+		}
+		if _, ok := err.(*ignoredError); ok {
+			log.Debugf("ignoring message on topic %s from peer %s: %s", topic, from.Pretty(), err)
+			return false
+		}
+
+		log.Infof("rejecting message on topic %s from peer %s: %s", topic, from.Pretty(), err)
+		rejectedCounter.Inc(ctx, 1)
+		if from != self {
+			rejections.add(from)
+		}
+		return false
+	}
+}
@@ -0,0 +1,55 @@
+package pubsub_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	libp2p "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/net/pubsub"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+)
+
+func TestTopicValidator(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	self := th.RequireRandomPeerID(require)
+	other := th.RequireRandomPeerID(require)
+	rejections := pubsub.NewPeerRejections()
+	validate := func(ctx context.Context, data []byte) error {
+		switch string(data) {
+		case "valid":
+			return nil
+		case "unknown":
+			return pubsub.Ignore(errors.New("unknown"))
+		default:
+			return errors.New("invalid")
+		}
+	}
+	validator := pubsub.NewTopicValidator("topic", self, validate, rejections)
+	newMessage := func(data string) *libp2p.Message {
+		return &libp2p.Message{Message: &pb.Message{Data: []byte(data)}}
+	}
+
+	assert.True(validator(ctx, other, newMessage("valid")))
+	assert.Equal(0, rejections.Count(other))
+
+	assert.False(validator(ctx, other, newMessage("invalid")))
+	assert.False(validator(ctx, other, newMessage("invalid")))
+	assert.Equal(2, rejections.Count(other))
+
+	// Ignored messages are dropped without being counted.
+	assert.False(validator(ctx, other, newMessage("unknown")))
+	assert.Equal(2, rejections.Count(other))
+
+	// Messages published by self are not counted.
+	assert.False(validator(ctx, self, newMessage("invalid")))
+	assert.Equal(0, rejections.Count(self))
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/net/pubsub"
 	"github.com/filecoin-project/go-filecoin/types"
 )
@@ -46,7 +47,14 @@ func (node *Node) processBlock(ctx context.Context, pubSubMsg pubsub.Message) (e
 	log.Infof("Received new block from network cid: %s", blk.Cid().String())
 	log.Debugf("Received new block from network: %s", blk)
 
-	err = node.Syncer.HandleNewTipset(ctx, types.NewSortedCidSet(blk.Cid()))
+	// Keep the block so that the sync resolves it locally rather than
+	// fetching it again.
+	if err := node.Blockstore.Put(blk.ToNode()); err != nil {
+		return errors.Wrap(err, "failed to store block from network")
+	}
+
+	ctx = chain.WithSyncSource(ctx, pubSubMsg.GetFrom().Pretty(), uint64(blk.Height), uint64(blk.ParentWeight))
+	err = node.SyncManager.HandleNewTipset(ctx, types.NewSortedCidSet(blk.Cid()))
 	if err != nil {
 		return errors.Wrap(err, "processing block from network")
 	}
@@ -1,6 +1,7 @@
 package node
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -38,9 +39,12 @@ import (
 
 	"github.com/filecoin-project/go-filecoin/abi"
 	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	minerActor "github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/chain/events"
 	"github.com/filecoin-project/go-filecoin/config"
+	"github.com/filecoin-project/go-filecoin/conformance"
 	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/core"
 	"github.com/filecoin-project/go-filecoin/flags"
@@ -53,11 +57,13 @@ import (
 	"github.com/filecoin-project/go-filecoin/plumbing/dag"
 	"github.com/filecoin-project/go-filecoin/plumbing/msg"
 	"github.com/filecoin-project/go-filecoin/plumbing/mthdsig"
+	"github.com/filecoin-project/go-filecoin/plumbing/statediff"
 	"github.com/filecoin-project/go-filecoin/plumbing/strgdls"
 	"github.com/filecoin-project/go-filecoin/porcelain"
 	"github.com/filecoin-project/go-filecoin/proofs"
 	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
 	"github.com/filecoin-project/go-filecoin/protocol/block"
+	"github.com/filecoin-project/go-filecoin/protocol/chainexchange"
 	"github.com/filecoin-project/go-filecoin/protocol/hello"
 	"github.com/filecoin-project/go-filecoin/protocol/retrieval"
 	"github.com/filecoin-project/go-filecoin/protocol/storage"
@@ -65,11 +71,16 @@ import (
 	"github.com/filecoin-project/go-filecoin/sampling"
 	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
 	"github.com/filecoin-project/go-filecoin/wallet"
 )
 
 const (
 	filecoinDHTProtocol dhtprotocol.ID = "/fil/kad/1.0.0"
+
+	// peerTrimPeriod is the interval at which the peer manager checks the
+	// number of connections.
+	peerTrimPeriod = time.Minute
 )
 
 var log = logging.Logger("node") // nolint: deadcode
@@ -89,7 +100,15 @@ type Node struct {
 	Consensus   consensus.Protocol
 	ChainReader chain.ReadStore
 	Syncer      chain.Syncer
+	// ProtocolSchedule selects the protocol version of each height of the
+	// chain.
+	ProtocolSchedule *consensus.ProtocolSchedule
+	// SyncManager schedules the syncs of the tipsets announced by peers.
+	SyncManager *chain.SyncManager
 	PowerTable  consensus.PowerTableView
+	// ChainEvents calls registered handlers as the heaviest chain advances
+	// and reorgs. It is set up when the node starts.
+	ChainEvents *events.Events
 
 	BlockMiningAPI *block.MiningAPI
 	PorcelainAPI   *porcelain.API
@@ -108,6 +127,10 @@ type Node struct {
 	MsgPool *core.MessagePool
 	// Messages sent and not yet mined.
 	Outbox *core.MessageQueue
+	// Index of the messages in the heaviest chain.
+	MsgIndex *msg.Index
+	// Finds the messages of the chain and computes their receipts.
+	MsgWaiter *msg.Waiter
 
 	Wallet *wallet.Wallet
 
@@ -134,10 +157,16 @@ type Node struct {
 	RetrievalMiner *retrieval.Miner
 
 	// Network Fields
-	BlockSub     pubsub.Subscription
-	MessageSub   pubsub.Subscription
-	HelloSvc     *hello.Handler
-	Bootstrapper *net.Bootstrapper
+	BlockSub   pubsub.Subscription
+	MessageSub pubsub.Subscription
+	// PeerManager scores peers and trims connections.
+	PeerManager *net.PeerManager
+	// PeerRejections counts the invalid blocks and messages sent by peers.
+	PeerRejections *pubsub.PeerRejections
+	HelloSvc       *hello.Handler
+	// ChainExchange serves and fetches ranges of tipsets.
+	ChainExchange *chainexchange.Exchange
+	Bootstrapper  *net.Bootstrapper
 
 	// Data Storage Fields
 
@@ -163,12 +192,18 @@ type Node struct {
 	// CborStore is a temporary interface for interacting with IPLD objects.
 	cborStore *hamt.CborIpldStore
 
+	// fsub is the libp2p pubsub the block and message topics are on.
+	fsub *libp2pps.PubSub
+
 	// cancelSubscriptionsCtx is a handle to cancel the block and message subscriptions.
 	cancelSubscriptionsCtx context.CancelFunc
 
 	// OfflineMode, when true, disables libp2p
 	OfflineMode bool
 
+	// isRelay is true when the node relays connections for other nodes.
+	isRelay bool
+
 	// Router is a router from IPFS
 	Router routing.IpfsRouting
 }
@@ -272,55 +307,128 @@ func readGenesisCid(ds datastore.Datastore) (cid.Cid, error) {
 	return c, nil
 }
 
-// buildHost determines if we are publically dialable.  If so use public
-// Address, if not configure node to announce relay address.
+// readProtocolSchedule returns the protocol schedule recorded in the genesis
+// state of the network.
+func readProtocolSchedule(ctx context.Context, cst *hamt.CborIpldStore, bs bstore.Blockstore, genCid cid.Cid) (*consensus.ProtocolSchedule, error) {
+	var genesis types.Block
+	if err := cst.Get(ctx, genCid, &genesis); err != nil {
+		return nil, errors.Wrap(err, "failed to load genesis block")
+	}
+	st, err := state.LoadStateTree(ctx, cst, genesis.StateRoot, builtin.Actors)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load genesis state")
+	}
+	schedule, err := consensus.NetworkProtocolSchedule(ctx, st, vm.NewStorageMap(bs))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid protocol upgrades in genesis state")
+	}
+	return schedule, nil
+}
+
+// buildHost builds the libp2p host from the swarm config. Nodes with a relay
+// client use relays when they are not publicly dialable, announcing their
+// addresses through the relays. Relay nodes relay the traffic of other nodes.
 func (nc *Config) buildHost(ctx context.Context, makeDHT func(host host.Host) (routing.IpfsRouting, error)) (host.Host, error) {
-	// Node must build a host acting as a libp2p relay.  Additionally it
-	// runs the autoNAT service which allows other nodes to check for their
-	// own dialability by having this node attempt to dial them.
 	makeDHTRightType := func(h host.Host) (routing.PeerRouting, error) {
 		return makeDHT(h)
 	}
 
-	if nc.IsRelay {
-		cfg := nc.Repo.Config()
-		publicAddr, err := ma.NewMultiaddr(cfg.Swarm.PublicRelayAddress)
+	swarmCfg := nc.Repo.Config().Swarm
+	isRelay := nc.IsRelay || swarmCfg.RelayService
+	addrsFactory, err := makeAddrsFactory(swarmCfg, isRelay)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []libp2p.Option{
+		libp2p.Routing(makeDHTRightType),
+		libp2p.AddrsFactory(addrsFactory),
+	}
+	if swarmCfg.NATPortMap {
+		opts = append(opts, libp2p.NATPortMap())
+	}
+	switch {
+	case isRelay:
+		opts = append(opts, libp2p.EnableRelay(circuit.OptHop), libp2p.EnableAutoRelay())
+	case swarmCfg.RelayClient:
+		opts = append(opts, libp2p.EnableAutoRelay())
+	default:
+		opts = append(opts, libp2p.DisableRelay())
+	}
+	peerHost, err := libp2p.New(ctx, append(opts, libp2p.ChainOptions(nc.Libp2pOpts...))...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Relay nodes run the autoNAT service, which allows other nodes to check
+	// for their own dialability by having this node attempt to dial them.
+	if isRelay || swarmCfg.AutoNATService {
+		_, err = autonatsvc.NewAutoNATService(ctx, peerHost)
 		if err != nil {
 			return nil, err
 		}
-		publicAddrFactory := func(lc *libp2p.Config) error {
-			lc.AddrsFactory = func(addrs []ma.Multiaddr) []ma.Multiaddr {
-				if cfg.Swarm.PublicRelayAddress == "" {
-					return addrs
-				}
-				return append(addrs, publicAddr)
+	}
+	return peerHost, nil
+}
+
+// makeAddrsFactory returns the function choosing the addresses the host
+// announces from its listen addresses, following the announce and
+// no-announce filters of the config. Relay nodes also announce their public
+// relay address.
+func makeAddrsFactory(cfg *config.SwarmConfig, isRelay bool) (func([]ma.Multiaddr) []ma.Multiaddr, error) {
+	parse := func(strs []string) ([]ma.Multiaddr, error) {
+		var addrs []ma.Multiaddr
+		for _, s := range strs {
+			addr, err := ma.NewMultiaddr(s)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid swarm address %s", s)
 			}
-			return nil
+			addrs = append(addrs, addr)
 		}
-		relayHost, err := libp2p.New(
-			ctx,
-			libp2p.EnableRelay(circuit.OptHop),
-			libp2p.EnableAutoRelay(),
-			libp2p.Routing(makeDHTRightType),
-			publicAddrFactory,
-			libp2p.ChainOptions(nc.Libp2pOpts...),
-		)
+		return addrs, nil
+	}
+	announce, err := parse(cfg.AnnounceAddresses)
+	if err != nil {
+		return nil, err
+	}
+	noAnnounce, err := parse(cfg.NoAnnounceAddresses)
+	if err != nil {
+		return nil, err
+	}
+	if isRelay && cfg.PublicRelayAddress != "" {
+		publicAddr, err := ma.NewMultiaddr(cfg.PublicRelayAddress)
 		if err != nil {
-			return nil, err
+			return nil, errors.Wrapf(err, "invalid public relay address %s", cfg.PublicRelayAddress)
 		}
-		// Set up autoNATService as a streamhandler on the host.
-		_, err = autonatsvc.NewAutoNATService(ctx, relayHost)
-		if err != nil {
-			return nil, err
+		announce = append(announce, publicAddr)
+	}
+
+	return func(listenAddrs []ma.Multiaddr) []ma.Multiaddr {
+		var addrs []ma.Multiaddr
+		if len(cfg.AnnounceAddresses) == 0 {
+			addrs = append(addrs, listenAddrs...)
+		}
+		addrs = append(addrs, announce...)
+
+		var out []ma.Multiaddr
+		for _, addr := range addrs {
+			if !hasAddrPrefix(addr, noAnnounce) {
+				out = append(out, addr)
+			}
+		}
+		return out
+	}, nil
+}
+
+// hasAddrPrefix is true when addr starts with one of the prefixes, e.g.
+// /ip4/10.0.0.1/tcp/6000 starts with /ip4/10.0.0.1.
+func hasAddrPrefix(addr ma.Multiaddr, prefixes []ma.Multiaddr) bool {
+	for _, prefix := range prefixes {
+		if bytes.HasPrefix(addr.Bytes(), prefix.Bytes()) {
+			return true
 		}
-		return relayHost, nil
 	}
-	return libp2p.New(
-		ctx,
-		libp2p.EnableAutoRelay(),
-		libp2p.Routing(makeDHTRightType),
-		libp2p.ChainOptions(nc.Libp2pOpts...),
-	)
+	return false
 }
 
 // Build instantiates a filecoin Node from the settings specified in the config.
@@ -383,15 +491,24 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 
 	// set up chainstore
 	chainStore := chain.NewDefaultStore(nc.Repo.ChainDatastore(), &cstOffline, genCid)
+	chainCfg := nc.Repo.Config().Chain
+	if chainCfg != nil {
+		chainStore.SetFinalityDepth(chainCfg.FinalityDepth)
+	}
 	powerTable := &consensus.MarketView{}
 
+	// set up the protocol upgrades of the network
+	protocolSchedule, err := readProtocolSchedule(ctx, &cstOffline, bs, genCid)
+	if err != nil {
+		return nil, err
+	}
+
 	// set up processor
-	var processor consensus.Processor
-	if nc.Rewarder == nil {
-		processor = consensus.NewDefaultProcessor()
-	} else {
-		processor = consensus.NewConfiguredProcessor(consensus.NewDefaultMessageValidator(), nc.Rewarder)
+	rewarder := nc.Rewarder
+	if rewarder == nil {
+		rewarder = consensus.NewDefaultBlockRewarder()
 	}
+	processor := consensus.NewScheduledProcessor(protocolSchedule, nil, rewarder)
 
 	// set up consensus
 	var nodeConsensus consensus.Protocol
@@ -401,11 +518,49 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 		nodeConsensus = consensus.NewExpected(&cstOffline, bs, processor, powerTable, genCid, nc.Verifier)
 	}
 
+	// set up chain exchange, serving tipsets from the chain store
+	chainExchange := chainexchange.New(peerHost, chainStore)
+
 	// only the syncer gets the storage which is online connected
-	chainSyncer := chain.NewDefaultSyncer(&cstOffline, nodeConsensus, chainStore, fetcher)
+	badTipSets, err := chain.NewBadTipSetCache(nc.Repo.ChainDatastore(), chain.DefaultBadTipSetCacheSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load bad tipsets")
+	}
+	chainSyncer := chain.NewDefaultSyncer(&cstOffline, nodeConsensus, chainStore, chainexchange.NewFetcher(chainExchange, fetcher), badTipSets)
+	if chainCfg != nil {
+		for _, cp := range chainCfg.Checkpoints {
+			if err := chainSyncer.Checkpoints().Add(chain.Checkpoint{Height: cp.Height, Key: cp.Tipset}); err != nil {
+				return nil, errors.Wrap(err, "invalid checkpoint in config")
+			}
+		}
+	}
+	syncManager := chain.NewSyncManager(chainSyncer)
 	msgPool := core.NewMessagePool(chainStore)
 	outbox := core.NewMessageQueue()
 
+	// set up the peer manager, scoring peers and trimming connections
+	peerRejections := pubsub.NewPeerRejections()
+	swarmCfg := nc.Repo.Config().Swarm
+	var gracePeriod time.Duration
+	if swarmCfg.GracePeriod != "" {
+		gracePeriod, err = time.ParseDuration(swarmCfg.GracePeriod)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't parse swarm grace period %s", swarmCfg.GracePeriod)
+		}
+	}
+	peerManager := net.NewPeerManager(peerHost, swarmCfg.LowWater, swarmCfg.HighWater, gracePeriod, func(p libp2ppeer.ID) int {
+		return peerRejections.Count(p) + badTipSets.PeerFaults(p.Pretty())
+	})
+	syncManager.SyncDone = func(peer string, err error) {
+		// Syncs failing for local reasons are not held against the peer.
+		if err != nil && !chain.IsPeerFault(err) {
+			return
+		}
+		if p, decodeErr := libp2ppeer.IDB58Decode(peer); decodeErr == nil {
+			peerManager.RecordSync(p, err == nil)
+		}
+	}
+
 	// Set up libp2p pubsub
 	fsub, err := libp2pps.NewFloodSub(ctx, peerHost)
 	if err != nil {
@@ -417,43 +572,68 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 	}
 	fcWallet := wallet.New(backend)
 
+	msgWaiter := msg.NewWaiter(chainStore, bs, &cstOffline, protocolSchedule)
+	msgIndex, err := msg.NewIndex(msgWaiter, nc.Repo.ChainDatastore())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load message index")
+	}
+	msgPreviewer := msg.NewPreviewer(fcWallet, chainStore, &cstOffline, bs, protocolSchedule)
+
 	PorcelainAPI := porcelain.New(plumbing.New(&plumbing.APIDeps{
+		BadTipSets:   badTipSets,
 		Bitswap:      bswap,
 		Chain:        chainStore,
+		Checkpoints:  chainSyncer.Checkpoints(),
 		Config:       cfg.NewConfig(nc.Repo),
 		DAG:          dag.NewDAG(merkledag.NewDAGService(bservice)),
 		Deals:        strgdls.New(nc.Repo.DealsDatastore()),
+		GasEstimator: msg.NewGasEstimator(chainStore, msgPreviewer),
+		MsgIndex:     msgIndex,
+		MsgLedger:    msg.NewLedger(chainStore, &cstOffline, bs, msgWaiter),
 		MsgPool:      msgPool,
-		MsgPreviewer: msg.NewPreviewer(fcWallet, chainStore, &cstOffline, bs),
-		MsgQueryer:   msg.NewQueryer(nc.Repo, fcWallet, chainStore, &cstOffline, bs),
+		MsgPreviewer: msgPreviewer,
+		MsgQueryer:   msg.NewQueryer(nc.Repo, fcWallet, chainStore, &cstOffline, bs, protocolSchedule),
+		MsgReplayer:  msg.NewReplayer(chainStore, bs, protocolSchedule),
 		MsgSender:    msg.NewSender(fcWallet, chainStore, chainStore, outbox, msgPool, consensus.NewOutboundMessageValidator(), fsub.Publish),
-		MsgWaiter:    msg.NewWaiter(chainStore, bs, &cstOffline),
-		Network:      net.New(peerHost, pubsub.NewPublisher(fsub), pubsub.NewSubscriber(fsub), net.NewRouter(router), bandwidthTracker, pinger),
+		MsgWaiter:    msgWaiter,
+		Network:      net.New(peerHost, pubsub.NewPublisher(fsub), pubsub.NewSubscriber(fsub), net.NewRouter(router), bandwidthTracker, pinger, peerManager),
 		Outbox:       outbox,
 		SigGetter:    mthdsig.NewGetter(chainStore),
+		StateDiffer:  statediff.NewDiffer(chainStore, &cstOffline),
+		SyncManager:  syncManager,
+		Vectors:      conformance.NewExtractor(chainStore, bs, protocolSchedule),
 		Wallet:       fcWallet,
 	}))
 
 	nd := &Node{
-		blockservice: bservice,
-		Blockstore:   bs,
-		cborStore:    &cstOffline,
-		Consensus:    nodeConsensus,
-		ChainReader:  chainStore,
-		Syncer:       chainSyncer,
-		PowerTable:   powerTable,
-		PorcelainAPI: PorcelainAPI,
-		Fetcher:      fetcher,
-		Exchange:     bswap,
-		host:         peerHost,
-		MsgPool:      msgPool,
-		Outbox:       outbox,
-		OfflineMode:  nc.OfflineMode,
-		PeerHost:     peerHost,
-		Repo:         nc.Repo,
-		Wallet:       fcWallet,
-		blockTime:    nc.BlockTime,
-		Router:       router,
+		blockservice:     bservice,
+		Blockstore:       bs,
+		ChainExchange:    chainExchange,
+		cborStore:        &cstOffline,
+		fsub:             fsub,
+		Consensus:        nodeConsensus,
+		ChainReader:      chainStore,
+		Syncer:           chainSyncer,
+		ProtocolSchedule: protocolSchedule,
+		SyncManager:      syncManager,
+		PowerTable:       powerTable,
+		PorcelainAPI:     PorcelainAPI,
+		Fetcher:          fetcher,
+		Exchange:         bswap,
+		host:             peerHost,
+		MsgIndex:         msgIndex,
+		MsgWaiter:        msgWaiter,
+		MsgPool:          msgPool,
+		PeerManager:      peerManager,
+		PeerRejections:   peerRejections,
+		Outbox:           outbox,
+		OfflineMode:      nc.OfflineMode,
+		isRelay:          nc.IsRelay || nc.Repo.Config().Swarm.RelayService,
+		PeerHost:         peerHost,
+		Repo:             nc.Repo,
+		Wallet:           fcWallet,
+		blockTime:        nc.BlockTime,
+		Router:           router,
 	}
 
 	// set up mining worker funcs
@@ -490,6 +670,20 @@ func (node *Node) Start(ctx context.Context) error {
 	if err = node.ChainReader.Load(ctx); err != nil {
 		return err
 	}
+	node.ChainEvents = events.New(node.ChainReader, node.getStateTree, node.MsgWaiter.ReceiptsFromTipSet, node.ChainReader.Head())
+
+	// Index the messages of the tipsets added to the chain since the node
+	// last ran and keep the index current.
+	indexFrom, err := node.MsgIndex.Resume(ctx, node.ChainReader, node.ChainReader.Head())
+	if err != nil {
+		return errors.Wrap(err, "failed to resume message index")
+	}
+	_, err = node.ChainEvents.TipSets(ctx, func(ctx context.Context, ts types.TipSet, _ uint64) error {
+		return node.MsgIndex.Apply(ctx, ts)
+	}, node.MsgIndex.Revert, 0, indexFrom)
+	if err != nil {
+		return errors.Wrap(err, "failed to index chain messages")
+	}
 
 	// Only set these up if there is a miner configured.
 	if _, err := node.miningAddress(); err == nil {
@@ -499,15 +693,22 @@ func (node *Node) Start(ctx context.Context) error {
 		}
 	}
 
+	// Start syncing the tipsets announced by peers
+	node.SyncManager.Start(context.Background())
+
 	// Start up 'hello' handshake service
-	syncCallBack := func(pid libp2ppeer.ID, cids []cid.Cid, height uint64) {
+	syncCallBack := func(pid libp2ppeer.ID, cids []cid.Cid, height uint64, weight uint64) {
+		node.PeerManager.RecordHello(pid, true)
 		cidSet := types.NewSortedCidSet(cids...)
-		err := node.Syncer.HandleNewTipset(context.Background(), cidSet)
+		err := node.SyncManager.HandleNewTipset(chain.WithSyncSource(context.Background(), pid.Pretty(), height, weight), cidSet)
 		if err != nil {
 			log.Infof("error handling blocks: %s", cidSet.String())
 		}
 	}
-	node.HelloSvc = hello.New(node.Host(), node.ChainReader.GenesisCid(), syncCallBack, node.ChainReader.Head, node.Repo.Config().Net, flags.Commit)
+	invalidHelloCallBack := func(pid libp2ppeer.ID, err error) {
+		node.PeerManager.RecordHello(pid, false)
+	}
+	node.HelloSvc = hello.New(node.Host(), node.ChainReader.GenesisCid(), syncCallBack, invalidHelloCallBack, node.ChainReader.Head, node.getWeight, node.helloCapabilities, node.Repo.Config().Net, flags.Commit)
 
 	err = node.setupProtocols()
 	if err != nil {
@@ -515,6 +716,11 @@ func (node *Node) Start(ctx context.Context) error {
 	}
 	node.RetrievalMiner = retrieval.NewMiner(node)
 
+	// validate blocks and messages before they are handled and relayed
+	if err := node.registerTopicValidators(); err != nil {
+		return errors.Wrap(err, "failed to register pubsub validators")
+	}
+
 	// subscribe to block notifications
 	blkSub, err := node.PorcelainAPI.PubSubSubscribe(BlockTopic)
 	if err != nil {
@@ -536,13 +742,15 @@ func (node *Node) Start(ctx context.Context) error {
 	go node.handleSubscription(cctx, node.processMessage, "processMessage", node.MessageSub, "MessageSub")
 
 	outboxPolicy := core.NewMessageQueuePolicy(node.Outbox, node.ChainReadStore(), core.OutboxMaxAgeRounds)
+	outboxRepublisher := core.NewMessageRepublisher(node.Outbox, node.republishMessage, core.OutboxRepublishRounds)
 
 	node.HeaviestTipSetHandled = func() {}
 	node.HeaviestTipSetCh = node.ChainReader.HeadEvents().Sub(chain.NewHeadTopic)
-	go node.handleNewHeaviestTipSet(cctx, node.ChainReader.Head(), outboxPolicy)
+	go node.handleNewHeaviestTipSet(cctx, node.ChainReader.Head(), outboxPolicy, outboxRepublisher)
 
 	if !node.OfflineMode {
 		node.Bootstrapper.Start(context.Background())
+		node.PeerManager.Start(context.Background(), peerTrimPeriod)
 	}
 
 	if err := node.setupHeartbeatServices(ctx); err != nil {
@@ -636,7 +844,7 @@ func (node *Node) handleNewMiningOutput(miningOutCh <-chan mining.Output) {
 
 }
 
-func (node *Node) handleNewHeaviestTipSet(ctx context.Context, head types.TipSet, outboxPolicy *core.MessageQueuePolicy) {
+func (node *Node) handleNewHeaviestTipSet(ctx context.Context, head types.TipSet, outboxPolicy *core.MessageQueuePolicy, outboxRepublisher *core.MessageRepublisher) {
 	for {
 		select {
 		case ts, ok := <-node.HeaviestTipSetCh:
@@ -653,12 +861,18 @@ func (node *Node) handleNewHeaviestTipSet(ctx context.Context, head types.TipSet
 				continue
 			}
 
+			if err := node.ChainEvents.OnNewHeadTipset(ctx, head, newHead); err != nil {
+				log.Error("updating chain events for new tipset", err)
+			}
 			if err := outboxPolicy.OnNewHeadTipset(ctx, head, newHead); err != nil {
 				log.Error("updating outbound message queue for new tipset", err)
 			}
 			if err := node.MsgPool.UpdateMessagePool(ctx, node.ChainReadStore(), head, newHead); err != nil {
 				log.Error("updating message pool for new tipset", err)
 			}
+			if err := outboxRepublisher.OnNewHeadTipset(ctx, head, newHead); err != nil {
+				log.Error("republishing outbound messages for new tipset", err)
+			}
 			head = newHead
 
 			if node.StorageMiner != nil {
@@ -671,6 +885,19 @@ func (node *Node) handleNewHeaviestTipSet(ctx context.Context, head types.TipSet
 	}
 }
 
+// republishMessage adds an outbound message back to the message pool, from which it may
+// have timed out, and publishes it to the network again.
+func (node *Node) republishMessage(ctx context.Context, smsg *types.SignedMessage) error {
+	if _, err := node.MsgPool.Add(smsg); err != nil {
+		return errors.Wrap(err, "failed to add message to message pool")
+	}
+	data, err := smsg.Marshal()
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal message")
+	}
+	return node.PorcelainAPI.PubSubPublish(msg.Topic, data)
+}
+
 func (node *Node) cancelSubscriptions() {
 	if node.BlockSub != nil || node.MessageSub != nil {
 		node.cancelSubscriptionsCtx()
@@ -693,6 +920,7 @@ func (node *Node) Stop(ctx context.Context) {
 	node.StopMining(ctx)
 
 	node.cancelSubscriptions()
+	node.SyncManager.Stop()
 	node.ChainReader.Stop()
 
 	if node.SectorBuilder() != nil {
@@ -711,6 +939,7 @@ func (node *Node) Stop(ctx context.Context) {
 	}
 
 	node.Bootstrapper.Stop()
+	node.PeerManager.Stop()
 
 	fmt.Println("stopping filecoin :(")
 }
@@ -817,9 +1046,11 @@ func (node *Node) StartMining(ctx context.Context) error {
 					log.Errorf("failed to seal sector with id %d: %s", result.SectorID, result.SealingErr.Error())
 				} else if result.SealingResult != nil {
 
-					// TODO: determine these algorithmically by simulating call and querying historical prices
+					// TODO: determine the price by querying historical prices. The
+					// gas of a commitment grows with the sectors of the miner, so its
+					// limit is estimated from the current state.
 					gasPrice := types.NewGasPrice(0)
-					gasUnits := types.NewGasUnits(300)
+					gasUnits := msg.AutoGasLimit
 
 					val := result.SealingResult
 					// This call can fail due to, e.g. nonce collisions. Our miners existence depends on this.
@@ -851,6 +1082,9 @@ func (node *Node) StartMining(ctx context.Context) error {
 		}
 	}()
 
+	// publishes the addresses the miner can be dialed at as they change
+	go node.publishMinerAddrsLoop(minerOwnerAddr, minerAddr)
+
 	// schedules sealing of staged piece-data
 	if node.Repo.Config().Mining.AutoSealIntervalSeconds > 0 {
 		go func() {
@@ -965,6 +1199,75 @@ func (node *Node) StopMining(ctx context.Context) {
 	// TODO: stop node.StorageMiner
 }
 
+// minerAddrsPublishInterval is how often a mining node checks whether the
+// addresses it announces changed.
+var minerAddrsPublishInterval = time.Minute
+
+// publishMinerAddrsLoop publishes the addresses the node announces in its
+// miner actor until mining stops, so that clients dialing the miner by its
+// peer id can reach it, through its relays if it isn't publicly dialable.
+func (node *Node) publishMinerAddrsLoop(ownerAddr, minerAddr address.Address) {
+	published, err := node.PorcelainAPI.MinerGetMultiaddrs(node.miningCtx, minerAddr)
+	if err != nil {
+		log.Warningf("failed to get multiaddrs of miner %s: %s", minerAddr, err)
+	}
+	for {
+		if published, err = node.publishMinerAddrs(node.miningCtx, ownerAddr, minerAddr, published); err != nil {
+			log.Warningf("failed to publish multiaddrs of miner %s: %s", minerAddr, err)
+		}
+		select {
+		case <-node.miningCtx.Done():
+			return
+		case <-time.After(minerAddrsPublishInterval):
+		}
+	}
+}
+
+// publishMinerAddrs sends an updateMultiaddrs message to the miner actor when
+// the addresses the node announces, relay addresses included, differ from
+// the published ones. It returns the addresses published.
+func (node *Node) publishMinerAddrs(ctx context.Context, ownerAddr, minerAddr address.Address, published []ma.Multiaddr) ([]ma.Multiaddr, error) {
+	addrs := node.Host().Addrs()
+	if len(addrs) > minerActor.MaximumMultiaddrs {
+		addrs = addrs[:minerActor.MaximumMultiaddrs]
+	}
+	if len(addrs) == 0 || sameMultiaddrs(addrs, published) {
+		return published, nil
+	}
+
+	_, err := node.PorcelainAPI.MessageSend(
+		ctx,
+		ownerAddr,
+		minerAddr,
+		nil,
+		types.NewGasPrice(0),
+		msg.AutoGasLimit,
+		"updateMultiaddrs",
+		addrs,
+	)
+	if err != nil {
+		return published, errors.Wrap(err, "failed to send updateMultiaddrs message")
+	}
+	return addrs, nil
+}
+
+// sameMultiaddrs is true when a and b hold the same addresses, in any order.
+func sameMultiaddrs(a, b []ma.Multiaddr) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[string]struct{}, len(a))
+	for _, addr := range a {
+		set[string(addr.Bytes())] = struct{}{}
+	}
+	for _, addr := range b {
+		if _, ok := set[string(addr.Bytes())]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
 // NewAddress creates a new account address on the default wallet backend.
 func (node *Node) NewAddress() (address.Address, error) {
 	return wallet.NewAddress(node.Wallet)
@@ -1009,6 +1312,39 @@ func (node *Node) handleSubscription(ctx context.Context, f pubSubProcessorFunc,
 	}
 }
 
+// registerTopicValidators registers the validators of the block and message
+// topics, so that invalid blocks and messages are neither handled nor relayed.
+func (node *Node) registerTopicValidators() error {
+	blkValidator := consensus.NewBlockPropagationValidator(node.getStateFromKey, node.Blockstore)
+	validateBlock := func(ctx context.Context, data []byte) error {
+		blk, err := types.DecodeBlock(data)
+		if err != nil {
+			return errors.Wrap(err, "bad block data")
+		}
+		return blkValidator.Validate(ctx, blk)
+	}
+	err := node.fsub.RegisterTopicValidator(BlockTopic, pubsub.NewTopicValidator(BlockTopic, node.Host().ID(), validateBlock, node.PeerRejections))
+	if err != nil {
+		return err
+	}
+
+	msgValidator := consensus.NewMessagePropagationValidator(node.ChainReader)
+	validateMessage := func(ctx context.Context, data []byte) error {
+		smsg := &types.SignedMessage{}
+		if err := smsg.Unmarshal(data); err != nil {
+			return errors.Wrap(err, "bad message data")
+		}
+		err := msgValidator.Validate(ctx, smsg)
+		if errors.Cause(err) == consensus.ErrInvalidForLatestState {
+			// The latest state of a node syncing may be behind the
+			// message, whose sender is not penalized.
+			return pubsub.Ignore(err)
+		}
+		return err
+	}
+	return node.fsub.RegisterTopicValidator(msg.Topic, pubsub.NewTopicValidator(msg.Topic, node.Host().ID(), validateMessage, node.PeerRejections))
+}
+
 // setupProtocols creates protocol clients and miners, then sets the node's APIs
 // for each
 func (node *Node) setupProtocols() error {
@@ -1024,7 +1360,7 @@ func (node *Node) setupProtocols() error {
 	node.BlockMiningAPI = &blockMiningAPI
 
 	// set up retrieval client and api
-	retapi := retrieval.NewAPI(retrieval.NewClient(node.host, node.blockTime))
+	retapi := retrieval.NewAPI(retrieval.NewClient(node.host, node.Router, node.blockTime))
 	node.RetrievalAPI = &retapi
 
 	// set up storage client and api
@@ -1037,7 +1373,7 @@ func (node *Node) setupProtocols() error {
 // CreateMiningWorker creates a mining.Worker for the node using the configured
 // getStateTree, getWeight, and getAncestors functions for the node
 func (node *Node) CreateMiningWorker(ctx context.Context) (mining.Worker, error) {
-	processor := consensus.NewDefaultProcessor()
+	processor := consensus.NewScheduledProcessor(node.ProtocolSchedule, nil, consensus.NewDefaultBlockRewarder())
 
 	minerAddr, err := node.miningAddress()
 	if err != nil {
@@ -1091,6 +1427,19 @@ func (node *Node) getWeight(ctx context.Context, ts types.TipSet) (uint64, error
 	return node.Consensus.Weight(ctx, ts, pSt)
 }
 
+// helloCapabilities returns the role and sub-protocols the node reports to
+// its peers in its hello messages.
+func (node *Node) helloCapabilities() (hello.Role, []string) {
+	protocols := []string{hello.ProtocolChainExchange, hello.ProtocolRetrieval}
+	if node.IsMining() {
+		return hello.RoleMiner, append(protocols, hello.ProtocolStorage)
+	}
+	if node.isRelay {
+		return hello.RoleRelay, protocols
+	}
+	return hello.RoleClient, protocols
+}
+
 // getAncestors is the default GetAncestors function for the mining worker.
 func (node *Node) getAncestors(ctx context.Context, ts types.TipSet, newBlockHeight *types.BlockHeight) ([]types.TipSet, error) {
 	return chain.GetRecentAncestors(ctx, ts, node.ChainReader, newBlockHeight, consensus.AncestorRoundsNeeded, sampling.LookbackParameter)
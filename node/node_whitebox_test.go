@@ -3,7 +3,13 @@ package node
 import (
 	"testing"
 
+	ma "github.com/multiformats/go-multiaddr"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/config"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/protocol/hello"
 )
 
 func TestMakePrivateKey(t *testing.T) {
@@ -25,3 +31,96 @@ func TestMakePrivateKey(t *testing.T) {
 	assert.NoError(err)
 	assert.NotNil(goodKey)
 }
+
+func TestMakeAddrsFactory(t *testing.T) {
+	t.Parallel()
+
+	listenAddrs := []ma.Multiaddr{
+		requireMultiaddr(t, "/ip4/127.0.0.1/tcp/6000"),
+		requireMultiaddr(t, "/ip4/192.168.1.2/tcp/6000"),
+		requireMultiaddr(t, "/ip4/192.168.1.2/tcp/6001"),
+		requireMultiaddr(t, "/ip4/1.2.3.4/tcp/6000"),
+	}
+
+	t.Run("filters no-announce addresses", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		cfg := config.NewDefaultConfig().Swarm
+		cfg.NoAnnounceAddresses = []string{"/ip4/127.0.0.1", "/ip4/192.168.1.2"}
+		factory, err := makeAddrsFactory(cfg, false)
+		require.NoError(err)
+		assert.Equal(listenAddrs[3:], factory(listenAddrs))
+	})
+
+	t.Run("announces only announce addresses", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		cfg := config.NewDefaultConfig().Swarm
+		cfg.AnnounceAddresses = []string{"/ip4/5.6.7.8/tcp/7000"}
+		factory, err := makeAddrsFactory(cfg, false)
+		require.NoError(err)
+		assert.Equal([]ma.Multiaddr{requireMultiaddr(t, "/ip4/5.6.7.8/tcp/7000")}, factory(listenAddrs))
+	})
+
+	t.Run("relays announce their public relay address", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		cfg := config.NewDefaultConfig().Swarm
+		cfg.PublicRelayAddress = "/ip4/5.6.7.8/tcp/7000"
+		factory, err := makeAddrsFactory(cfg, false)
+		require.NoError(err)
+		assert.Equal(listenAddrs, factory(listenAddrs))
+
+		factory, err = makeAddrsFactory(cfg, true)
+		require.NoError(err)
+		assert.Equal(append(listenAddrs, requireMultiaddr(t, "/ip4/5.6.7.8/tcp/7000")), factory(listenAddrs))
+	})
+
+	t.Run("rejects invalid addresses", func(t *testing.T) {
+		cfg := config.NewDefaultConfig().Swarm
+		cfg.NoAnnounceAddresses = []string{"not an address"}
+		_, err := makeAddrsFactory(cfg, false)
+		assert.Error(t, err)
+	})
+}
+
+func requireMultiaddr(t *testing.T, s string) ma.Multiaddr {
+	addr, err := ma.NewMultiaddr(s)
+	require.NoError(t, err)
+	return addr
+}
+
+func TestHelloCapabilitiesRole(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	nd := GenNode(t, &TestNodeOptions{
+		OfflineMode: true,
+		ConfigOpts:  append(DefaultTestingConfig(), IsRelay()),
+		GenesisFunc: consensus.DefaultGenesis,
+	})
+	role, protocols := nd.helloCapabilities()
+	assert.Equal(hello.RoleRelay, role)
+	assert.NotContains(protocols, hello.ProtocolStorage)
+
+	nd = MakeOfflineNode(t)
+	role, _ = nd.helloCapabilities()
+	assert.Equal(hello.RoleClient, role)
+}
+
+func TestSameMultiaddrs(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	a := requireMultiaddr(t, "/ip4/1.2.3.4/tcp/6000")
+	b := requireMultiaddr(t, "/ip4/1.2.3.4/tcp/6000/p2p-circuit")
+	c := requireMultiaddr(t, "/ip4/5.6.7.8/tcp/6000")
+
+	assert.True(sameMultiaddrs(nil, nil))
+	assert.True(sameMultiaddrs([]ma.Multiaddr{a, b}, []ma.Multiaddr{b, a}))
+	assert.False(sameMultiaddrs([]ma.Multiaddr{a, b}, []ma.Multiaddr{a}))
+	assert.False(sameMultiaddrs([]ma.Multiaddr{a, b}, []ma.Multiaddr{a, c}))
+}
@@ -15,10 +15,12 @@ import (
 	"github.com/libp2p/go-libp2p-peer"
 	pstore "github.com/libp2p/go-libp2p-peerstore"
 	ma "github.com/multiformats/go-multiaddr"
+	"github.com/pkg/errors"
 
 	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/conformance"
 	"github.com/filecoin-project/go-filecoin/core"
 	"github.com/filecoin-project/go-filecoin/exec"
 	"github.com/filecoin-project/go-filecoin/net"
@@ -27,10 +29,12 @@ import (
 	"github.com/filecoin-project/go-filecoin/plumbing/dag"
 	"github.com/filecoin-project/go-filecoin/plumbing/msg"
 	"github.com/filecoin-project/go-filecoin/plumbing/mthdsig"
+	"github.com/filecoin-project/go-filecoin/plumbing/statediff"
 	"github.com/filecoin-project/go-filecoin/plumbing/strgdls"
 	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
 	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
 	"github.com/filecoin-project/go-filecoin/wallet"
 )
 
@@ -42,37 +46,55 @@ import (
 type API struct {
 	logger logging.EventLogger
 
+	badTipSets   *chain.BadTipSetCache
 	bitswap      exchange.Interface
 	chain        chain.ReadStore
+	checkpoints  *chain.Checkpoints
 	config       *cfg.Config
 	dag          *dag.DAG
+	gasEstimator *msg.GasEstimator
+	msgIndex     *msg.Index
+	msgLedger    *msg.Ledger
 	msgPool      *core.MessagePool
 	msgPreviewer *msg.Previewer
 	msgQueryer   *msg.Queryer
+	msgReplayer  *msg.Replayer
 	outbox       *core.MessageQueue
 	msgSender    *msg.Sender
 	msgWaiter    *msg.Waiter
 	network      *net.Network
 	sigGetter    *mthdsig.Getter
+	stateDiffer  *statediff.Differ
 	storagedeals *strgdls.Store
+	syncManager  *chain.SyncManager
+	vectors      *conformance.Extractor
 	wallet       *wallet.Wallet
 }
 
 // APIDeps contains all the API's dependencies
 type APIDeps struct {
+	BadTipSets   *chain.BadTipSetCache
 	Bitswap      exchange.Interface
 	Chain        chain.ReadStore
+	Checkpoints  *chain.Checkpoints
 	Config       *cfg.Config
 	DAG          *dag.DAG
 	Deals        *strgdls.Store
+	GasEstimator *msg.GasEstimator
+	MsgIndex     *msg.Index
+	MsgLedger    *msg.Ledger
 	MsgPool      *core.MessagePool
 	MsgPreviewer *msg.Previewer
 	MsgQueryer   *msg.Queryer
+	MsgReplayer  *msg.Replayer
 	MsgSender    *msg.Sender
 	MsgWaiter    *msg.Waiter
 	Network      *net.Network
 	Outbox       *core.MessageQueue
 	SigGetter    *mthdsig.Getter
+	StateDiffer  *statediff.Differ
+	SyncManager  *chain.SyncManager
+	Vectors      *conformance.Extractor
 	Wallet       *wallet.Wallet
 }
 
@@ -81,28 +103,47 @@ func New(deps *APIDeps) *API {
 	return &API{
 		logger: logging.Logger("porcelain"),
 
+		badTipSets:   deps.BadTipSets,
 		bitswap:      deps.Bitswap,
 		chain:        deps.Chain,
+		checkpoints:  deps.Checkpoints,
 		config:       deps.Config,
 		dag:          deps.DAG,
+		gasEstimator: deps.GasEstimator,
+		msgIndex:     deps.MsgIndex,
+		msgLedger:    deps.MsgLedger,
 		msgPool:      deps.MsgPool,
 		msgPreviewer: deps.MsgPreviewer,
 		msgQueryer:   deps.MsgQueryer,
+		msgReplayer:  deps.MsgReplayer,
 		msgSender:    deps.MsgSender,
 		msgWaiter:    deps.MsgWaiter,
 		network:      deps.Network,
 		outbox:       deps.Outbox,
 		sigGetter:    deps.SigGetter,
+		stateDiffer:  deps.StateDiffer,
 		storagedeals: deps.Deals,
+		syncManager:  deps.SyncManager,
+		vectors:      deps.Vectors,
 		wallet:       deps.Wallet,
 	}
 }
 
 // ActorGetSignature returns the signature of the given actor's given method.
 // The function signature is typically used to enable a caller to decode the
-// output of an actor method call (message).
+// output of an actor method call (message). The signatures of the methods of
+// actors that are not builtin are found by querying their exports.
 func (api *API) ActorGetSignature(ctx context.Context, actorAddr address.Address, method string) (_ *exec.FunctionSignature, err error) {
-	return api.sigGetter.Get(ctx, actorAddr, method)
+	sig, err := api.sigGetter.Get(ctx, actorAddr, method)
+	if err != mthdsig.ErrNoBuiltinImpl {
+		return sig, err
+	}
+
+	exports, _, err := api.MessageQuery(ctx, address.Undef, actorAddr, exec.ExportsMethod)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query exports")
+	}
+	return mthdsig.FromExports(exports, method)
 }
 
 // ConfigSet sets the given parameters at the given path in the local config.
@@ -126,12 +167,57 @@ func (api *API) ChainHead(ctx context.Context) types.TipSet {
 	return api.chain.Head()
 }
 
+// ChainBadTipSets lists the tipsets the syncer rejected, most recently seen
+// first.
+func (api *API) ChainBadTipSets() []chain.BadTipSet {
+	return api.badTipSets.List()
+}
+
+// ChainBadTipSetRemove removes a tipset from the tipsets the syncer rejected,
+// so that it is synced again, and reports whether it was there.
+func (api *API) ChainBadTipSetRemove(key types.SortedCidSet) bool {
+	return api.badTipSets.Remove(key)
+}
+
+// ChainBadTipSetClear removes all the tipsets the syncer rejected and returns
+// their number.
+func (api *API) ChainBadTipSetClear() int {
+	return api.badTipSets.Clear()
+}
+
+// ChainGetTipSet returns the tipset with the given key from the chain store.
+func (api *API) ChainGetTipSet(ctx context.Context, key types.SortedCidSet) (types.TipSet, error) {
+	tsas, err := api.chain.GetTipSetAndState(ctx, key.String())
+	if err != nil {
+		return nil, err
+	}
+	return tsas.TipSet, nil
+}
+
+// ChainCheckpoints lists the checkpoints the chains synced must include,
+// lowest first.
+func (api *API) ChainCheckpoints() []chain.Checkpoint {
+	return api.checkpoints.List()
+}
+
+// ChainAddCheckpoint adds a checkpoint the chains synced must include. It
+// lasts until the node stops.
+func (api *API) ChainAddCheckpoint(cp chain.Checkpoint) error {
+	return api.checkpoints.Add(cp)
+}
+
 // GetRecentAncestorsOfHeaviestChain returns the recent ancestors of the
 // `TipSet` with height `descendantBlockHeight` in the heaviest chain.
 func (api *API) GetRecentAncestorsOfHeaviestChain(ctx context.Context, descendantBlockHeight *types.BlockHeight) ([]types.TipSet, error) {
 	return chain.GetRecentAncestorsOfHeaviestChain(ctx, api.chain, descendantBlockHeight)
 }
 
+// ChainExtractVector returns the conformance test vector of the transition
+// from the state of the parent of a tipset to the state of the tipset.
+func (api *API) ChainExtractVector(ctx context.Context, tsKey types.SortedCidSet) (*conformance.Vector, error) {
+	return api.vectors.Extract(ctx, tsKey)
+}
+
 // ChainLs returns a channel of tipsets from head to genesis
 func (api *API) ChainLs(ctx context.Context) <-chan interface{} {
 	return api.chain.BlockHistory(ctx, api.chain.Head())
@@ -155,6 +241,12 @@ func (api *API) ActorLs(ctx context.Context) (<-chan state.GetAllActorsResult, e
 	return state.GetAllActors(ctx, st), nil
 }
 
+// AddressHistory returns the changes to the balance of an address from
+// genesis to the head of the chain, each with the running balance.
+func (api *API) AddressHistory(ctx context.Context, addr address.Address) ([]*msg.LedgerEntry, error) {
+	return api.msgLedger.History(ctx, addr)
+}
+
 // BlockGet gets a block by CID
 func (api *API) BlockGet(ctx context.Context, id cid.Cid) (*types.Block, error) {
 	return api.chain.GetBlock(ctx, id)
@@ -180,6 +272,13 @@ func (api *API) OutboxQueueLs(sender address.Address) []*core.QueuedMessage {
 	return api.outbox.List(sender)
 }
 
+// OutboxReplace re-signs a message of the outbox with a higher gas price and
+// the same nonce, and sends it in place of the original. A zero gas limit
+// keeps the limit of the original message.
+func (api *API) OutboxReplace(ctx context.Context, msgCid cid.Cid, gasPrice types.AttoFIL, gasLimit types.GasUnits) (cid.Cid, error) {
+	return api.msgSender.Replace(ctx, msgCid, gasPrice, gasLimit)
+}
+
 // OutboxQueueClear clears messages in the queue for an address/
 func (api *API) OutboxQueueClear(sender address.Address) {
 	api.outbox.Clear(sender)
@@ -213,20 +312,65 @@ func (api *API) MessageQuery(ctx context.Context, optFrom, to address.Address, m
 	return api.msgQueryer.Query(ctx, optFrom, to, method, params...)
 }
 
+// MessageReplay applies a message of the blockchain to the state of a tipset,
+// by default the state it was originally applied to, and returns its
+// receipt and the actors it changed. No state is changed.
+func (api *API) MessageReplay(ctx context.Context, msgCid cid.Cid, optAt types.SortedCidSet) (*msg.ReplayResult, error) {
+	return api.msgReplayer.Replay(ctx, msgCid, optAt)
+}
+
+// MessageSimulate applies an unsigned message to the state of a tipset, by
+// default the head, and returns its receipt and the actors it changed. No
+// state is changed.
+func (api *API) MessageSimulate(ctx context.Context, message *types.Message, gasPrice types.AttoFIL, gasLimit types.GasUnits, optAt types.SortedCidSet) (*msg.ReplayResult, error) {
+	return api.msgReplayer.Simulate(ctx, message, gasPrice, gasLimit, optAt)
+}
+
 // MessageSend sends a message. It uses the default from address if none is given and signs the
 // message using the wallet. This call "sends" in the sense that it enqueues the
 // message in the msg pool and broadcasts it to the network; it does not wait for the
 // message to go on chain. Note that no default from address is provided. If you need
-// a default address, use MessageSendWithDefaultAddress instead.
+// a default address, use MessageSendWithDefaultAddress instead. Passing
+// msg.AutoGasPrice or msg.AutoGasLimit estimates the gas price or limit.
 func (api *API) MessageSend(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error) {
+	gasPrice, gasLimit, err := api.gasEstimator.Resolve(ctx, from, to, value, gasPrice, gasLimit, method, params...)
+	if err != nil {
+		return cid.Undef, err
+	}
 	return api.msgSender.Send(ctx, from, to, value, gasPrice, gasLimit, method, params...)
 }
 
+// MessageEstimateGas estimates the gas limit of a message sending value, which
+// may be nil, from its preview on the head state, and its gas price from the
+// prices of the messages included in recent tipsets.
+func (api *API) MessageEstimateGas(ctx context.Context, from, to address.Address, value *types.AttoFIL, method string, params ...interface{}) (*msg.GasEstimate, error) {
+	return api.gasEstimator.Estimate(ctx, from, to, value, method, params...)
+}
+
+// MessageEstimateGasPrice returns the given percentile of the gas prices of
+// the messages included in recent tipsets.
+func (api *API) MessageEstimateGasPrice(ctx context.Context, percentile int) (types.AttoFIL, error) {
+	return api.gasEstimator.EstimateGasPrice(ctx, percentile)
+}
+
 // MessageFind returns a message and receipt from the blockchain, if it exists.
 func (api *API) MessageFind(ctx context.Context, msgCid cid.Cid) (*msg.ChainMessage, bool, error) {
 	return api.msgWaiter.Find(ctx, msgCid)
 }
 
+// MessageLs returns the messages of the heaviest chain matching the filter,
+// with their receipts, from the most to the least recent. It is served from
+// an index of the chain rather than a traversal.
+func (api *API) MessageLs(ctx context.Context, filter msg.MessageFilter) ([]*msg.IndexedMessage, error) {
+	return api.msgIndex.Query(ctx, filter)
+}
+
+// MessageTrace replays a message of the blockchain against the state it was
+// applied to and returns the tree of the calls it made.
+func (api *API) MessageTrace(ctx context.Context, msgCid cid.Cid) (*vm.TraceFrame, error) {
+	return api.msgWaiter.Trace(ctx, msgCid)
+}
+
 // MessageWait invokes the callback when a message with the given cid appears on chain.
 // It will find the message in both the case that it is already on chain and
 // the case that it appears in a newly mined block. An error is returned if one is
@@ -287,8 +431,33 @@ func (api *API) NetworkConnect(ctx context.Context, addrs []string) (<-chan net.
 }
 
 // NetworkPeers lists peers currently available on the network
-func (api *API) NetworkPeers(ctx context.Context, verbose, latency, streams bool) (*net.SwarmConnInfos, error) {
-	return api.network.Peers(ctx, verbose, latency, streams)
+func (api *API) NetworkPeers(ctx context.Context, verbose, latency, streams, scores bool) (*net.SwarmConnInfos, error) {
+	return api.network.Peers(ctx, verbose, latency, streams, scores)
+}
+
+// NetworkProtectPeer protects the connections to a peer from being closed
+// when the node has too many connections, with a tag saying why.
+func (api *API) NetworkProtectPeer(pid peer.ID, tag string) {
+	api.network.ProtectPeer(pid, tag)
+}
+
+// NetworkUnprotectPeer removes a tag protecting the connections to a peer and
+// reports whether the peer is still protected by other tags.
+func (api *API) NetworkUnprotectPeer(pid peer.ID, tag string) bool {
+	return api.network.UnprotectPeer(pid, tag)
+}
+
+// StateDiff returns the actors added, removed or modified from the state of
+// tipset a to the state of tipset b, with the changes of the states of the
+// builtin actors.
+func (api *API) StateDiff(ctx context.Context, a, b types.SortedCidSet) ([]*state.ActorDiff, error) {
+	return api.stateDiffer.Diff(ctx, a, b)
+}
+
+// SyncStatus returns the status of the chain syncer, including the tipsets
+// waiting to be synced.
+func (api *API) SyncStatus() chain.SyncStatus {
+	return api.syncManager.Status()
 }
 
 // SignBytes uses private key information associated with the given address to sign the given bytes.
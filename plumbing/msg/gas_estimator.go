@@ -0,0 +1,143 @@
+package msg
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// AutoGasLimit asks MessageSend to estimate the gas limit of a message.
+var AutoGasLimit = types.NewGasUnits(math.MaxUint64)
+
+// AutoGasPrice asks MessageSend to estimate the gas price of a message. It is
+// negative so that it can't be mistaken for a real price.
+var AutoGasPrice = *types.NewAttoFIL(big.NewInt(-1))
+
+// GasLimitMarginPercent is the margin added to the gas used by the preview of
+// a message when estimating its gas limit, since the state it is applied to
+// may differ from the state it was previewed on.
+const GasLimitMarginPercent = 20
+
+// GasPriceLookback is the number of recent tipsets whose messages are used to
+// estimate the gas price.
+const GasPriceLookback = 10
+
+// DefaultGasPricePercentile is the percentile of the gas prices of recently
+// included messages used as the estimated gas price.
+const DefaultGasPricePercentile = 50
+
+// GasEstimate is an estimate of the gas of a message.
+type GasEstimate struct {
+	GasPrice types.AttoFIL
+	GasLimit types.GasUnits
+	// GasUsed is the gas used by the message when previewed on the head state.
+	GasUsed types.GasUnits
+}
+
+// GasEstimator estimates the gas limit and price of messages.
+type GasEstimator struct {
+	chainReader chain.ReadStore
+	previewer   *Previewer
+}
+
+// NewGasEstimator returns a new GasEstimator.
+func NewGasEstimator(chainReader chain.ReadStore, previewer *Previewer) *GasEstimator {
+	return &GasEstimator{chainReader: chainReader, previewer: previewer}
+}
+
+// Estimate estimates the gas limit and the price of a message sending value,
+// which may be nil.
+func (ge *GasEstimator) Estimate(ctx context.Context, from, to address.Address, value *types.AttoFIL, method string, params ...interface{}) (*GasEstimate, error) {
+	used, err := ge.previewer.PreviewWithValue(ctx, from, to, value, method, params...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to preview message")
+	}
+	price, err := ge.EstimateGasPrice(ctx, DefaultGasPricePercentile)
+	if err != nil {
+		return nil, err
+	}
+	return &GasEstimate{
+		GasPrice: price,
+		GasLimit: gasLimitWithMargin(used),
+		GasUsed:  used,
+	}, nil
+}
+
+// EstimateGasPrice returns the given percentile of the gas prices of the
+// messages included in the last GasPriceLookback tipsets, or zero if they
+// include no message.
+func (ge *GasEstimator) EstimateGasPrice(ctx context.Context, percentile int) (types.AttoFIL, error) {
+	if percentile < 0 || percentile > 100 {
+		return types.AttoFIL{}, fmt.Errorf("invalid percentile %d", percentile)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var prices []types.AttoFIL
+	seen := 0
+	for raw := range ge.chainReader.BlockHistory(ctx, ge.chainReader.Head()) {
+		switch raw := raw.(type) {
+		case error:
+			return types.AttoFIL{}, errors.Wrap(raw, "failed to walk chain")
+		case types.TipSet:
+			for _, blk := range raw {
+				for _, msg := range blk.Messages {
+					prices = append(prices, msg.GasPrice)
+				}
+			}
+		default:
+			return types.AttoFIL{}, fmt.Errorf("unexpected type in channel: %T", raw)
+		}
+		seen++
+		if seen == GasPriceLookback {
+			break
+		}
+	}
+	return pricePercentile(prices, percentile), nil
+}
+
+// Resolve replaces AutoGasPrice and AutoGasLimit by their estimates for the
+// message. Other values are returned unchanged.
+func (ge *GasEstimator) Resolve(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (types.AttoFIL, types.GasUnits, error) {
+	if gasPrice.Equal(&AutoGasPrice) {
+		price, err := ge.EstimateGasPrice(ctx, DefaultGasPricePercentile)
+		if err != nil {
+			return types.AttoFIL{}, 0, errors.Wrap(err, "failed to estimate gas price")
+		}
+		gasPrice = price
+	}
+	if gasLimit == AutoGasLimit {
+		used, err := ge.previewer.PreviewWithValue(ctx, from, to, value, method, params...)
+		if err != nil {
+			return types.AttoFIL{}, 0, errors.Wrap(err, "failed to estimate gas limit")
+		}
+		gasLimit = gasLimitWithMargin(used)
+	}
+	return gasPrice, gasLimit, nil
+}
+
+func gasLimitWithMargin(used types.GasUnits) types.GasUnits {
+	limit := used + used*GasLimitMarginPercent/100
+	if limit > types.BlockGasLimit {
+		limit = types.BlockGasLimit
+	}
+	return limit
+}
+
+func pricePercentile(prices []types.AttoFIL, percentile int) types.AttoFIL {
+	if len(prices) == 0 {
+		return *types.NewZeroAttoFIL()
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i].LessThan(&prices[j]) })
+	i := (len(prices) - 1) * percentile / 100
+	return prices[i]
+}
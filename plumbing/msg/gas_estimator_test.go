@@ -0,0 +1,149 @@
+package msg
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/core"
+	"github.com/filecoin-project/go-filecoin/proofs"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/state"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+	vmerrors "github.com/filecoin-project/go-filecoin/vm/errors"
+)
+
+func TestEstimateGasPrice(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	cst, chainStore, _ := setupTest(require)
+	estimator := NewGasEstimator(chainStore, nil)
+
+	price, err := estimator.EstimateGasPrice(ctx, DefaultGasPricePercentile)
+	require.NoError(err)
+	assert.True(price.IsZero())
+
+	var msgs smsgs
+	for i, p := range []int64{4, 1, 3, 2, 5} {
+		msg := types.NewMessage(mockSigner.Addresses[0], mockSigner.Addresses[1], uint64(i), types.NewAttoFILFromFIL(0), "", nil)
+		smsg, err := types.NewSignedMessage(*msg, &mockSigner, types.NewGasPrice(p), types.NewGasUnits(0))
+		require.NoError(err)
+		msgs = append(msgs, smsg)
+	}
+	chainWithMsgs := core.NewChainWithMessages(cst, chainStore.Head(), smsgsSet{msgs[:2]}, smsgsSet{msgs[2:]})
+	for _, ts := range chainWithMsgs[1:] {
+		th.RequirePutTsas(ctx, require, chainStore, &chain.TipSetAndState{
+			TipSet:          ts,
+			TipSetStateRoot: ts.ToSlice()[0].StateRoot,
+		})
+	}
+	require.NoError(chainStore.SetHead(ctx, chainWithMsgs[len(chainWithMsgs)-1]))
+
+	price, err = estimator.EstimateGasPrice(ctx, DefaultGasPricePercentile)
+	require.NoError(err)
+	assert.Equal(types.NewGasPrice(3), price)
+
+	price, err = estimator.EstimateGasPrice(ctx, 100)
+	require.NoError(err)
+	assert.Equal(types.NewGasPrice(5), price)
+
+	_, err = estimator.EstimateGasPrice(ctx, 101)
+	assert.Error(err)
+}
+
+func TestGasLimitWithMargin(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	assert.Equal(types.NewGasUnits(120), gasLimitWithMargin(types.NewGasUnits(100)))
+	assert.Equal(types.BlockGasLimit, gasLimitWithMargin(types.BlockGasLimit))
+}
+
+func TestResolveKeepsExplicitGas(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// Explicit values need neither the chain nor a preview.
+	estimator := NewGasEstimator(nil, nil)
+	price, limit, err := estimator.Resolve(context.Background(), mockSigner.Addresses[0], mockSigner.Addresses[1], types.NewGasPrice(7), types.NewGasUnits(300), "")
+	require.NoError(err)
+	assert.Equal(types.NewGasPrice(7), price)
+	assert.Equal(types.NewGasUnits(300), limit)
+}
+
+func TestEstimateGasLimitOfPoStAfterManySectors(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	r := repo.NewInMemoryRepo()
+	bs := bstore.NewBlockstore(r.Datastore())
+	owner := address.NewForTestGetter()()
+	deps := requireCommonDepsWithGifAndBlockstore(require, consensus.MakeGenesisFunc(
+		consensus.ActorAccount(owner, types.NewAttoFILFromFIL(1000)),
+	), r, bs)
+
+	genesis := deps.chainStore.Head()
+	tsas, err := deps.chainStore.GetTipSetAndState(ctx, genesis.String())
+	require.NoError(err)
+	st, err := state.LoadStateTree(ctx, deps.cst, tsas.TipSetStateRoot, builtin.Actors)
+	require.NoError(err)
+	vms := vm.NewStorageMap(bs)
+
+	// Miners created at height 0 don't verify their proofs.
+	params := actor.MustConvertParams(big.NewInt(100), []byte("key"), th.RequireRandomPeerID(require))
+	res, err := th.ApplyTestMessage(st, vms, types.NewMessage(owner, address.StorageMarketAddress, 0, types.NewAttoFILFromFIL(100), "createMiner", params), types.NewBlockHeight(0))
+	require.NoError(err)
+	require.NoError(res.ExecutionError)
+	minerAddr, err := address.NewFromBytes(res.Receipt.Return[0])
+	require.NoError(err)
+
+	// The state of the miner grows with every sector it commits.
+	for id := uint64(1); id <= 1000; id++ {
+		params := actor.MustConvertParams(id, th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)))
+		res, err := th.ApplyTestMessageWithGasLimit(st, vms, types.NewMessage(owner, minerAddr, 0, types.ZeroAttoFIL, "commitSector", params), types.NewBlockHeight(0), types.BlockGasLimit)
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+	}
+	root, err := st.Flush(ctx)
+	require.NoError(err)
+	require.NoError(vms.Flush())
+
+	head := th.RequireNewTipSet(require, &types.Block{Parents: genesis.ToSortedCidSet(), Height: 1, StateRoot: root})
+	th.RequirePutTsas(ctx, require, deps.chainStore, &chain.TipSetAndState{TipSet: head, TipSetStateRoot: root})
+	require.NoError(deps.chainStore.SetHead(ctx, head))
+
+	previewer := NewPreviewer(deps.wallet, deps.chainStore, deps.cst, bs, requireScheduleWithActors(require, builtin.Actors))
+	estimator := NewGasEstimator(deps.chainStore, previewer)
+	postParams := []interface{}{[]proofs.PoStProof{th.MakeRandomPoSTProofForTest()}}
+	_, limit, err := estimator.Resolve(ctx, owner, minerAddr, types.ZeroAttoFIL, types.NewGasPrice(0), AutoGasLimit, "submitPoSt", postParams...)
+	require.NoError(err)
+
+	post := types.NewMessage(owner, minerAddr, 0, types.ZeroAttoFIL, "submitPoSt", actor.MustConvertParams(postParams...))
+
+	// A fixed limit, fit for a miner with few sectors, runs out.
+	res, err = th.ApplyTestMessageWithGasLimit(st, vms, post, types.NewBlockHeight(2), types.NewGasUnits(300))
+	require.NoError(err)
+	assert.True(vmerrors.IsOutOfGas(res.ExecutionError))
+
+	res, err = th.ApplyTestMessageWithGasLimit(st, vms, post, types.NewBlockHeight(2), limit)
+	require.NoError(err)
+	require.NoError(res.ExecutionError)
+	assert.Equal(uint8(0), res.Receipt.ExitCode)
+}
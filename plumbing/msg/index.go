@@ -0,0 +1,349 @@
+package msg
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// IndexedMessage is an on-chain message found through the message index.
+type IndexedMessage struct {
+	Cid     cid.Cid
+	Message *types.SignedMessage
+	// Block is the cid of the first block of the tipset including the message.
+	Block  cid.Cid
+	Height uint64
+	// Receipt is nil for messages that failed to apply because they
+	// conflicted with another message of their tipset.
+	Receipt *types.MessageReceipt
+}
+
+// MessageFilter selects messages from the index. Zero values match any
+// message.
+type MessageFilter struct {
+	From   address.Address
+	To     address.Address
+	Method string
+	// MinHeight and MaxHeight bound the inclusion height, inclusively. A
+	// MaxHeight of zero does not bound it.
+	MinHeight uint64
+	MaxHeight uint64
+	// ExitCode, if set, matches only messages with this receipt exit code.
+	ExitCode *uint8
+	// EventTopic and EventEmitter, if set, match only messages whose receipt
+	// has an event of this topic and from this actor.
+	EventTopic   string
+	EventEmitter address.Address
+}
+
+type indexEntry struct {
+	cid     cid.Cid
+	msg     *types.SignedMessage
+	receipt *types.MessageReceipt
+	block   cid.Cid
+	height  uint64
+	tsKey   string
+}
+
+type indexedTipSet struct {
+	height  uint64
+	entries []*indexEntry
+}
+
+func init() {
+	cbor.RegisterCborType(indexRecord{})
+	cbor.RegisterCborType(indexRecordMessage{})
+}
+
+// indexRecord is an indexed tipset as persisted in the datastore.
+type indexRecord struct {
+	Key      types.SortedCidSet
+	Height   types.Uint64
+	Block    cid.Cid
+	Messages []indexRecordMessage
+}
+
+type indexRecordMessage struct {
+	Message *types.SignedMessage
+	Receipt *types.MessageReceipt `refmt:",omitempty"`
+}
+
+var msgIndexKey = datastore.NewKey("/chain/msgIndex")
+
+// Index indexes the messages of the heaviest chain and their receipts by
+// sender and recipient so that they can be listed without traversing the
+// chain. Its owner keeps it current by calling Apply and Revert as tipsets
+// enter and leave the heaviest chain. The index is persisted, so that after a
+// restart only the tipsets added to the chain since are indexed, see Resume.
+type Index struct {
+	waiter *Waiter
+	// ds persists the index. It is nil for an index only kept in memory.
+	ds repo.Datastore
+
+	lk      sync.RWMutex
+	tipsets map[string]*indexedTipSet
+	byAddr  map[address.Address][]*indexEntry
+}
+
+// NewIndex returns an Index loaded from and persisted to ds. A nil ds keeps
+// the index in memory. The waiter computes the receipts of indexed messages.
+func NewIndex(waiter *Waiter, ds repo.Datastore) (*Index, error) {
+	idx := &Index{
+		waiter:  waiter,
+		ds:      ds,
+		tipsets: make(map[string]*indexedTipSet),
+		byAddr:  make(map[address.Address][]*indexEntry),
+	}
+	if ds == nil {
+		return idx, nil
+	}
+
+	results, err := ds.Query(query.Query{Prefix: msgIndexKey.String()})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query message index")
+	}
+	for entry := range results.Next() {
+		if entry.Error != nil {
+			return nil, errors.Wrap(entry.Error, "failed to read message index")
+		}
+		var rec indexRecord
+		if err := cbor.DecodeInto(entry.Value, &rec); err != nil {
+			return nil, errors.Wrap(err, "failed to decode message index")
+		}
+		if err := idx.add(&rec); err != nil {
+			return nil, err
+		}
+	}
+	return idx, nil
+}
+
+// Resume prepares the index to follow the chain ending at head after a
+// restart. It removes the indexed tipsets that left the chain while the node
+// was stopped and returns the height from which the tipsets of the chain
+// remain to be applied, above the highest one already indexed.
+func (idx *Index) Resume(ctx context.Context, store chain.BlockProvider, head types.TipSet) (uint64, error) {
+	idx.lk.Lock()
+	defer idx.lk.Unlock()
+
+	var from uint64
+	for it := chain.IterAncestors(ctx, store, head); !it.Complete(); {
+		if its, ok := idx.tipsets[it.Value().String()]; ok {
+			from = its.height + 1
+			break
+		}
+		if err := it.Next(); err != nil {
+			return 0, err
+		}
+	}
+
+	// The tipsets of the chain above the one found are not indexed, so
+	// indexed tipsets at these heights are on another chain.
+	for tsKey, its := range idx.tipsets {
+		if its.height >= from {
+			if err := idx.remove(tsKey); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return from, nil
+}
+
+// Apply indexes the messages of a tipset added to the heaviest chain.
+func (idx *Index) Apply(ctx context.Context, ts types.TipSet) error {
+	height, err := ts.Height()
+	if err != nil {
+		return err
+	}
+
+	idx.lk.RLock()
+	_, indexed := idx.tipsets[ts.String()]
+	idx.lk.RUnlock()
+	if indexed {
+		return nil
+	}
+
+	receipts, err := idx.waiter.ReceiptsFromTipSet(ctx, ts)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get receipts of tipset %s", ts.String())
+	}
+
+	blks := ts.ToSlice()
+	types.SortBlocks(blks)
+	rec := &indexRecord{Key: ts.ToSortedCidSet(), Height: types.Uint64(height), Block: blks[0].Cid()}
+	var seen types.SortedCidSet
+	for _, blk := range blks {
+		for _, msg := range blk.Messages {
+			c, err := msg.Cid()
+			if err != nil {
+				return err
+			}
+			if seen.Has(c) {
+				continue
+			}
+			(&seen).Add(c)
+			rec.Messages = append(rec.Messages, indexRecordMessage{Message: msg, Receipt: receipts[c]})
+		}
+	}
+
+	idx.lk.Lock()
+	defer idx.lk.Unlock()
+	if _, ok := idx.tipsets[ts.String()]; ok {
+		return nil
+	}
+	if idx.ds != nil {
+		data, err := cbor.DumpObject(rec)
+		if err != nil {
+			return err
+		}
+		if err := idx.ds.Put(msgIndexKey.ChildString(ts.String()), data); err != nil {
+			return errors.Wrap(err, "failed to persist message index")
+		}
+	}
+	return idx.add(rec)
+}
+
+// Revert removes the messages of a tipset that left the heaviest chain.
+func (idx *Index) Revert(ctx context.Context, ts types.TipSet) error {
+	idx.lk.Lock()
+	defer idx.lk.Unlock()
+	return idx.remove(ts.String())
+}
+
+// add adds an indexed tipset to the in-memory index. Precondition: the
+// caller holds idx.lk or has not shared the index yet.
+func (idx *Index) add(rec *indexRecord) error {
+	tsKey := rec.Key.String()
+	its := &indexedTipSet{height: uint64(rec.Height)}
+	for _, m := range rec.Messages {
+		c, err := m.Message.Cid()
+		if err != nil {
+			return err
+		}
+		entry := &indexEntry{cid: c, msg: m.Message, receipt: m.Receipt, block: rec.Block, height: its.height, tsKey: tsKey}
+		its.entries = append(its.entries, entry)
+		idx.byAddr[m.Message.From] = append(idx.byAddr[m.Message.From], entry)
+		if m.Message.To != m.Message.From {
+			idx.byAddr[m.Message.To] = append(idx.byAddr[m.Message.To], entry)
+		}
+	}
+	idx.tipsets[tsKey] = its
+	return nil
+}
+
+// remove removes an indexed tipset from the index and the datastore.
+// Precondition: the caller holds idx.lk.
+func (idx *Index) remove(tsKey string) error {
+	its, ok := idx.tipsets[tsKey]
+	if !ok {
+		return nil
+	}
+	if idx.ds != nil {
+		if err := idx.ds.Delete(msgIndexKey.ChildString(tsKey)); err != nil {
+			return errors.Wrap(err, "failed to remove tipset from message index")
+		}
+	}
+	delete(idx.tipsets, tsKey)
+
+	for _, entry := range its.entries {
+		for _, addr := range []address.Address{entry.msg.From, entry.msg.To} {
+			var kept []*indexEntry
+			for _, e := range idx.byAddr[addr] {
+				if e.tsKey != tsKey {
+					kept = append(kept, e)
+				}
+			}
+			if len(kept) == 0 {
+				delete(idx.byAddr, addr)
+			} else {
+				idx.byAddr[addr] = kept
+			}
+		}
+	}
+	return nil
+}
+
+// Query returns the indexed messages matching the filter, ordered from the
+// highest to the lowest inclusion height.
+func (idx *Index) Query(ctx context.Context, filter MessageFilter) ([]*IndexedMessage, error) {
+	idx.lk.RLock()
+	defer idx.lk.RUnlock()
+
+	var candidates []*indexEntry
+	switch {
+	case !filter.From.Empty():
+		candidates = idx.byAddr[filter.From]
+	case !filter.To.Empty():
+		candidates = idx.byAddr[filter.To]
+	default:
+		for _, its := range idx.tipsets {
+			candidates = append(candidates, its.entries...)
+		}
+	}
+
+	var out []*IndexedMessage
+	for _, e := range candidates {
+		if !filter.matches(e) {
+			continue
+		}
+		out = append(out, &IndexedMessage{
+			Cid:     e.cid,
+			Message: e.msg,
+			Block:   e.block,
+			Height:  e.height,
+			Receipt: e.receipt,
+		})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Height > out[j].Height })
+	return out, nil
+}
+
+func (f MessageFilter) matches(e *indexEntry) bool {
+	if !f.From.Empty() && e.msg.From != f.From {
+		return false
+	}
+	if !f.To.Empty() && e.msg.To != f.To {
+		return false
+	}
+	if f.Method != "" && e.msg.Method != f.Method {
+		return false
+	}
+	if e.height < f.MinHeight {
+		return false
+	}
+	if f.MaxHeight != 0 && e.height > f.MaxHeight {
+		return false
+	}
+	if f.ExitCode != nil && (e.receipt == nil || e.receipt.ExitCode != *f.ExitCode) {
+		return false
+	}
+	return f.matchesEvents(e.receipt)
+}
+
+// matchesEvents returns true if the receipt has an event matching the event
+// fields of the filter, or if they are not set.
+func (f MessageFilter) matchesEvents(rcpt *types.MessageReceipt) bool {
+	if f.EventTopic == "" && f.EventEmitter.Empty() {
+		return true
+	}
+	if rcpt == nil {
+		return false
+	}
+	eventFilter := types.EventFilter{Emitter: f.EventEmitter, Topic: f.EventTopic}
+	for _, event := range rcpt.Events {
+		if eventFilter.Matches(event) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package msg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/repo"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestIndex(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	m1, m2, m3 := newSignedMessage(), newSignedMessage(), newSignedMessage()
+	mkTipSet := func(height uint64, msgs []*types.SignedMessage, rcpts []*types.MessageReceipt) types.TipSet {
+		return th.MustNewTipSet(&types.Block{
+			Height:          types.Uint64(height),
+			Messages:        msgs,
+			MessageReceipts: rcpts,
+		})
+	}
+	ok := &types.MessageReceipt{ExitCode: 0}
+	failed := &types.MessageReceipt{ExitCode: 1}
+	emitter := address.NewForTestGetter()()
+	withEvent := &types.MessageReceipt{ExitCode: 0, Events: []*types.Event{{Emitter: emitter, Topic: "redeemed"}}}
+	ts1 := mkTipSet(1, smsgs{m1, m2}, []*types.MessageReceipt{ok, failed})
+	ts2 := mkTipSet(2, smsgs{m3}, []*types.MessageReceipt{withEvent})
+
+	newIndex := func(require *require.Assertions) *Index {
+		// Receipts of single block tipsets come from the block, so the
+		// waiter needs no chain.
+		idx, err := NewIndex(NewWaiter(nil, nil, nil, nil), nil)
+		require.NoError(err)
+		require.NoError(idx.Apply(ctx, ts1))
+		require.NoError(idx.Apply(ctx, ts2))
+		return idx
+	}
+
+	t.Run("lists all messages from highest to lowest", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		res, err := newIndex(require).Query(ctx, MessageFilter{})
+		require.NoError(err)
+		require.Len(res, 3)
+		assert.Equal(uint64(2), res[0].Height)
+		assert.True(m3.Equals(res[0].Message))
+		assert.Equal(withEvent, res[0].Receipt)
+	})
+
+	t.Run("filters by address, method and height", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		idx := newIndex(require)
+
+		res, err := idx.Query(ctx, MessageFilter{To: m2.To})
+		require.NoError(err)
+		require.Len(res, 1)
+		assert.True(m2.Equals(res[0].Message))
+
+		res, err = idx.Query(ctx, MessageFilter{From: m1.From, Method: m1.Method})
+		require.NoError(err)
+		require.Len(res, 1)
+		assert.True(m1.Equals(res[0].Message))
+
+		res, err = idx.Query(ctx, MessageFilter{MinHeight: 1, MaxHeight: 1})
+		require.NoError(err)
+		assert.Len(res, 2)
+	})
+
+	t.Run("filters by exit code", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		code := uint8(1)
+		res, err := newIndex(require).Query(ctx, MessageFilter{ExitCode: &code})
+		require.NoError(err)
+		require.Len(res, 1)
+		assert.True(m2.Equals(res[0].Message))
+	})
+
+	t.Run("filters by event", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		idx := newIndex(require)
+
+		res, err := idx.Query(ctx, MessageFilter{EventTopic: "redeemed"})
+		require.NoError(err)
+		require.Len(res, 1)
+		assert.True(m3.Equals(res[0].Message))
+
+		res, err = idx.Query(ctx, MessageFilter{EventTopic: "redeemed", EventEmitter: emitter})
+		require.NoError(err)
+		assert.Len(res, 1)
+
+		res, err = idx.Query(ctx, MessageFilter{EventTopic: "closed"})
+		require.NoError(err)
+		assert.Empty(res)
+
+		res, err = idx.Query(ctx, MessageFilter{EventEmitter: m3.From})
+		require.NoError(err)
+		assert.Empty(res)
+	})
+
+	t.Run("reverted tipsets are removed", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		idx := newIndex(require)
+
+		require.NoError(idx.Revert(ctx, ts2))
+		res, err := idx.Query(ctx, MessageFilter{From: m3.From})
+		require.NoError(err)
+		assert.Len(res, 2)
+		for _, r := range res {
+			assert.False(m3.Equals(r.Message))
+		}
+	})
+	t.Run("persists and resumes on the current chain", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		blocks := th.NewFakeBlockProvider()
+		root := blocks.NewBlock(0)
+		a1 := blocks.NewBlockWithMessages(1, smsgs{m1}, root)
+		a2 := blocks.NewBlockWithMessages(2, smsgs{m2}, a1)
+		b2 := blocks.NewBlockWithMessages(3, smsgs{m3}, a1)
+		b3 := blocks.NewBlock(4, b2)
+
+		waiter := NewWaiter(nil, nil, nil, nil)
+		ds := repo.NewInMemoryRepo().ChainDatastore()
+		idx, err := NewIndex(waiter, ds)
+		require.NoError(err)
+		for _, blk := range []*types.Block{root, a1, a2} {
+			require.NoError(idx.Apply(ctx, th.MustNewTipSet(blk)))
+		}
+
+		reloaded, err := NewIndex(waiter, ds)
+		require.NoError(err)
+		res, err := reloaded.Query(ctx, MessageFilter{})
+		require.NoError(err)
+		assert.Len(res, 2)
+
+		// The chain switched to b2 while the node was stopped, so a2 is
+		// dropped and indexing resumes at its height.
+		from, err := reloaded.Resume(ctx, blocks, th.MustNewTipSet(b3))
+		require.NoError(err)
+		assert.Equal(uint64(2), from)
+		res, err = reloaded.Query(ctx, MessageFilter{})
+		require.NoError(err)
+		require.Len(res, 1)
+		assert.True(m1.Equals(res[0].Message))
+
+		reloaded, err = NewIndex(waiter, ds)
+		require.NoError(err)
+		res, err = reloaded.Query(ctx, MessageFilter{})
+		require.NoError(err)
+		assert.Len(res, 1)
+	})
+}
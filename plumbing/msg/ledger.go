@@ -0,0 +1,263 @@
+package msg
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-hamt-ipld"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+)
+
+// LedgerEntryKind describes the cause of a balance change.
+type LedgerEntryKind string
+
+const (
+	// LedgerGenesis is the balance allocated to the address in the genesis block.
+	LedgerGenesis = LedgerEntryKind("genesis")
+	// LedgerSend is the value of a message sent by the address.
+	LedgerSend = LedgerEntryKind("send")
+	// LedgerReceive is the value of a message sent to the address.
+	LedgerReceive = LedgerEntryKind("receive")
+	// LedgerGas is the gas paid for a message sent by the address.
+	LedgerGas = LedgerEntryKind("gas")
+	// LedgerBlockReward is the reward for a block mined by a miner the address owns.
+	LedgerBlockReward = LedgerEntryKind("block-reward")
+	// LedgerGasReward is the gas paid by a message in a block mined by a miner
+	// the address owns.
+	LedgerGasReward = LedgerEntryKind("gas-reward")
+	// LedgerTransferIn and LedgerTransferOut are balance changes not caused
+	// directly by a message value, gas or reward, such as payment channel
+	// redeems, collateral returns and other transfers made by actors.
+	LedgerTransferIn  = LedgerEntryKind("transfer-in")
+	LedgerTransferOut = LedgerEntryKind("transfer-out")
+)
+
+// Debit returns true if entries of this kind decrease the balance.
+func (k LedgerEntryKind) Debit() bool {
+	return k == LedgerSend || k == LedgerGas || k == LedgerTransferOut
+}
+
+// LedgerEntry is one change to the balance of an address.
+type LedgerEntry struct {
+	Height uint64
+	// Message is the cid of the message causing the change. It is undefined
+	// for rewards and transfers.
+	Message cid.Cid
+	Kind    LedgerEntryKind
+	// Amount is the magnitude of the change, its direction is given by Kind.
+	Amount *types.AttoFIL
+	// Balance is the balance of the address after the change.
+	Balance *types.AttoFIL
+}
+
+// Ledger rebuilds the history of the balance of an address from the
+// heaviest chain.
+type Ledger struct {
+	chainReader chain.ReadStore
+	cst         *hamt.CborIpldStore
+	bs          bstore.Blockstore
+	waiter      *Waiter
+
+	// minerOwner is overridden in tests.
+	minerOwner func(ctx context.Context, st state.Tree, minerAddr address.Address) (address.Address, error)
+}
+
+// NewLedger returns a new Ledger. The waiter computes message receipts.
+func NewLedger(chainReader chain.ReadStore, cst *hamt.CborIpldStore, bs bstore.Blockstore, waiter *Waiter) *Ledger {
+	l := &Ledger{
+		chainReader: chainReader,
+		cst:         cst,
+		bs:          bs,
+		waiter:      waiter,
+	}
+	l.minerOwner = func(ctx context.Context, st state.Tree, minerAddr address.Address) (address.Address, error) {
+		return consensus.MinerOwnerAddress(ctx, st, vm.NewStorageMap(l.bs), minerAddr)
+	}
+	return l
+}
+
+// History returns the changes to the balance of addr from genesis to the
+// head, in chain order. Changes are attributed to messages and rewards using
+// the receipts of each tipset; whatever remains of the difference between
+// the balances before and after a tipset is recorded as a transfer, so that
+// the running balance after the last entry of a height always equals the
+// balance of addr in the state of that height.
+func (l *Ledger) History(ctx context.Context, addr address.Address) ([]*LedgerEntry, error) {
+	var tipsets []types.TipSet
+	for raw := range l.chainReader.BlockHistory(ctx, l.chainReader.Head()) {
+		switch raw := raw.(type) {
+		case error:
+			return nil, errors.Wrap(raw, "failed to walk chain")
+		case types.TipSet:
+			tipsets = append(tipsets, raw)
+		default:
+			return nil, fmt.Errorf("unexpected type in channel: %T", raw)
+		}
+	}
+
+	var entries []*LedgerEntry
+	var parentState state.Tree
+	balance := types.NewZeroAttoFIL()
+	for i := len(tipsets) - 1; i >= 0; i-- {
+		ts := tipsets[i]
+		h, err := ts.Height()
+		if err != nil {
+			return nil, err
+		}
+		st, err := l.stateOf(ctx, ts)
+		if err != nil {
+			return nil, err
+		}
+		after, err := balanceOf(ctx, st, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		var changes []*LedgerEntry
+		if parentState == nil {
+			if after.IsPositive() {
+				changes = []*LedgerEntry{{Height: h, Kind: LedgerGenesis, Amount: after}}
+			}
+		} else {
+			changes, err = l.tipSetEntries(ctx, addr, ts, parentState)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to attribute balance changes at height %d", h)
+			}
+			changes = reconcile(h, changes, balance, after)
+		}
+
+		for _, e := range changes {
+			if e.Kind.Debit() {
+				balance = balance.Sub(e.Amount)
+			} else {
+				balance = balance.Add(e.Amount)
+			}
+			e.Balance = balance
+		}
+		entries = append(entries, changes...)
+		parentState = st
+	}
+	return entries, nil
+}
+
+// tipSetEntries returns the balance changes of addr caused by the messages
+// and rewards of a tipset, applied on top of parentState.
+func (l *Ledger) tipSetEntries(ctx context.Context, addr address.Address, ts types.TipSet, parentState state.Tree) ([]*LedgerEntry, error) {
+	h, err := ts.Height()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*LedgerEntry
+	add := func(c cid.Cid, kind LedgerEntryKind, amount *types.AttoFIL) {
+		if amount == nil || amount.IsZero() {
+			return
+		}
+		entries = append(entries, &LedgerEntry{Height: h, Message: c, Kind: kind, Amount: amount})
+	}
+
+	// The receipts of the tipset are computed once, when a message of addr
+	// needs one.
+	var receipts map[cid.Cid]*types.MessageReceipt
+	blks := ts.ToSlice()
+	types.SortBlocks(blks)
+	var seen types.SortedCidSet
+	for _, blk := range blks {
+		owner, err := l.minerOwner(ctx, parentState, blk.Miner)
+		if err != nil {
+			return nil, err
+		}
+		if owner == addr {
+			add(cid.Undef, LedgerBlockReward, consensus.NewDefaultBlockRewarder().BlockRewardAmount())
+		}
+
+		for _, msg := range blk.Messages {
+			c, err := msg.Cid()
+			if err != nil {
+				return nil, err
+			}
+			if seen.Has(c) {
+				continue
+			}
+			(&seen).Add(c)
+			if msg.From != addr && msg.To != addr && owner != addr {
+				continue
+			}
+
+			if receipts == nil {
+				receipts, err = l.waiter.ReceiptsFromTipSet(ctx, ts)
+				if err != nil {
+					return nil, err
+				}
+			}
+			rcpt := receipts[c]
+			if rcpt == nil {
+				// The message conflicted with another and was not applied.
+				continue
+			}
+			if msg.From == addr {
+				if rcpt.ExitCode == 0 {
+					add(c, LedgerSend, msg.Value)
+				}
+				add(c, LedgerGas, rcpt.GasAttoFIL)
+			}
+			if msg.To == addr && rcpt.ExitCode == 0 {
+				add(c, LedgerReceive, msg.Value)
+			}
+			if owner == addr {
+				add(c, LedgerGasReward, rcpt.GasAttoFIL)
+			}
+		}
+	}
+	return entries, nil
+}
+
+// reconcile appends a transfer entry to entries for the part of the change
+// from before to after they do not account for.
+func reconcile(h uint64, entries []*LedgerEntry, before, after *types.AttoFIL) []*LedgerEntry {
+	expected := before
+	for _, e := range entries {
+		if e.Kind.Debit() {
+			expected = expected.Sub(e.Amount)
+		} else {
+			expected = expected.Add(e.Amount)
+		}
+	}
+
+	switch {
+	case after.GreaterThan(expected):
+		entries = append(entries, &LedgerEntry{Height: h, Kind: LedgerTransferIn, Amount: after.Sub(expected)})
+	case after.LessThan(expected):
+		entries = append(entries, &LedgerEntry{Height: h, Kind: LedgerTransferOut, Amount: expected.Sub(after)})
+	}
+	return entries
+}
+
+func (l *Ledger) stateOf(ctx context.Context, ts types.TipSet) (state.Tree, error) {
+	tsas, err := l.chainReader.GetTipSetAndState(ctx, ts.String())
+	if err != nil {
+		return nil, err
+	}
+	return state.LoadStateTree(ctx, l.cst, tsas.TipSetStateRoot, builtin.Actors)
+}
+
+func balanceOf(ctx context.Context, st state.Tree, addr address.Address) (*types.AttoFIL, error) {
+	act, err := st.GetActor(ctx, addr)
+	if err != nil {
+		if state.IsActorNotFoundError(err) {
+			return types.NewZeroAttoFIL(), nil
+		}
+		return nil, err
+	}
+	return act.Balance, nil
+}
@@ -0,0 +1,102 @@
+package msg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/state"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestLedgerTipSetEntries(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	me, other := mockSigner.Addresses[0], mockSigner.Addresses[1]
+	miner := address.NewForTestGetter()()
+
+	mkMsg := func(from, to address.Address, value uint64) *types.SignedMessage {
+		msg := types.NewMessage(from, to, 0, types.NewAttoFILFromFIL(value), "", nil)
+		smsg, err := types.NewSignedMessage(*msg, &mockSigner, types.NewGasPrice(1), types.NewGasUnits(10))
+		require.NoError(t, err)
+		return smsg
+	}
+	sent, received, failed := mkMsg(me, other, 5), mkMsg(other, me, 7), mkMsg(me, other, 3)
+	gas := types.NewAttoFILFromFIL(1)
+	ts := th.MustNewTipSet(&types.Block{
+		Miner:    miner,
+		Height:   types.Uint64(3),
+		Messages: []*types.SignedMessage{sent, received, failed},
+		MessageReceipts: []*types.MessageReceipt{
+			{ExitCode: 0, GasAttoFIL: gas},
+			{ExitCode: 0, GasAttoFIL: gas},
+			{ExitCode: 1, GasAttoFIL: gas},
+		},
+	})
+
+	newLedger := func(owner address.Address) *Ledger {
+		l := NewLedger(nil, nil, nil, NewWaiter(nil, nil, nil, nil))
+		l.minerOwner = func(context.Context, state.Tree, address.Address) (address.Address, error) {
+			return owner, nil
+		}
+		return l
+	}
+	kinds := func(entries []*LedgerEntry) []LedgerEntryKind {
+		var ks []LedgerEntryKind
+		for _, e := range entries {
+			ks = append(ks, e.Kind)
+		}
+		return ks
+	}
+
+	t.Run("sends, receives and gas", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		entries, err := newLedger(other).tipSetEntries(ctx, me, ts, nil)
+		require.NoError(err)
+		assert.Equal([]LedgerEntryKind{LedgerSend, LedgerGas, LedgerReceive, LedgerGas}, kinds(entries))
+		sentCid, err := sent.Cid()
+		require.NoError(err)
+		assert.Equal(sentCid, entries[0].Message)
+		assert.Equal(types.NewAttoFILFromFIL(5), entries[0].Amount)
+		assert.Equal(uint64(3), entries[0].Height)
+	})
+
+	t.Run("block and gas rewards", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		entries, err := newLedger(other).tipSetEntries(ctx, other, ts, nil)
+		require.NoError(err)
+		assert.Equal([]LedgerEntryKind{
+			LedgerBlockReward,
+			LedgerReceive, LedgerGasReward,
+			LedgerSend, LedgerGas, LedgerGasReward,
+			LedgerGasReward,
+		}, kinds(entries))
+		assert.Equal(consensus.NewDefaultBlockRewarder().BlockRewardAmount(), entries[0].Amount)
+	})
+
+	t.Run("unattributed changes are transfers", func(t *testing.T) {
+		assert := assert.New(t)
+
+		entries := []*LedgerEntry{{Kind: LedgerSend, Amount: types.NewAttoFILFromFIL(5)}}
+		res := reconcile(3, entries, types.NewAttoFILFromFIL(10), types.NewAttoFILFromFIL(8))
+		assert.Equal([]LedgerEntryKind{LedgerSend, LedgerTransferIn}, kinds(res))
+		assert.Equal(types.NewAttoFILFromFIL(3), res[1].Amount)
+
+		res = reconcile(3, entries, types.NewAttoFILFromFIL(10), types.NewAttoFILFromFIL(4))
+		assert.Equal([]LedgerEntryKind{LedgerSend, LedgerTransferOut}, kinds(res))
+		assert.Equal(types.NewAttoFILFromFIL(1), res[1].Amount)
+
+		res = reconcile(3, entries, types.NewAttoFILFromFIL(10), types.NewAttoFILFromFIL(5))
+		assert.Equal([]LedgerEntryKind{LedgerSend}, kinds(res))
+	})
+}
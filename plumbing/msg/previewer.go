@@ -27,15 +27,23 @@ type Previewer struct {
 	cst *hamt.CborIpldStore
 	// For vm storage.
 	bs bstore.Blockstore
+	// To run previews with the protocol version of the head.
+	schedule *consensus.ProtocolSchedule
 }
 
 // NewPreviewer constructs a Previewer.
-func NewPreviewer(wallet *wallet.Wallet, chainReader chain.ReadStore, cst *hamt.CborIpldStore, bs bstore.Blockstore) *Previewer {
-	return &Previewer{wallet, chainReader, cst, bs}
+func NewPreviewer(wallet *wallet.Wallet, chainReader chain.ReadStore, cst *hamt.CborIpldStore, bs bstore.Blockstore, schedule *consensus.ProtocolSchedule) *Previewer {
+	return &Previewer{wallet, chainReader, cst, bs, schedule}
 }
 
 // Preview sends a read-only message to an actor.
 func (p *Previewer) Preview(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) (types.GasUnits, error) {
+	return p.PreviewWithValue(ctx, optFrom, to, nil, method, params...)
+}
+
+// PreviewWithValue is like Preview for a message also sending value, which
+// is transferred from optFrom.
+func (p *Previewer) PreviewWithValue(ctx context.Context, optFrom, to address.Address, value *types.AttoFIL, method string, params ...interface{}) (types.GasUnits, error) {
 	encodedParams, err := abi.ToEncodedValues(params...)
 	if err != nil {
 		return types.NewGasUnits(0), errors.Wrap(err, "couldnt encode message params")
@@ -56,7 +64,7 @@ func (p *Previewer) Preview(ctx context.Context, optFrom, to address.Address, me
 	}
 
 	vms := vm.NewStorageMap(p.bs)
-	usedGas, err := consensus.PreviewQueryMethod(ctx, st, vms, to, method, encodedParams, optFrom, types.NewBlockHeight(h))
+	usedGas, err := consensus.PreviewQueryMethod(ctx, st, vms, p.schedule.VersionAt(h), to, method, encodedParams, optFrom, value, types.NewBlockHeight(h))
 	if err != nil {
 		return types.NewGasUnits(0), errors.Wrap(err, "query method returned an error")
 	}
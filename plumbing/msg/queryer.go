@@ -32,11 +32,13 @@ type Queryer struct {
 	cst *hamt.CborIpldStore
 	// For vm storage.
 	bs bstore.Blockstore
+	// To run queries with the protocol version of the head.
+	schedule *consensus.ProtocolSchedule
 }
 
 // NewQueryer constructs a Queryer.
-func NewQueryer(repo repo.Repo, wallet *wallet.Wallet, chainReader chain.ReadStore, cst *hamt.CborIpldStore, bs bstore.Blockstore) *Queryer {
-	return &Queryer{repo, wallet, chainReader, cst, bs}
+func NewQueryer(repo repo.Repo, wallet *wallet.Wallet, chainReader chain.ReadStore, cst *hamt.CborIpldStore, bs bstore.Blockstore, schedule *consensus.ProtocolSchedule) *Queryer {
+	return &Queryer{repo, wallet, chainReader, cst, bs, schedule}
 }
 
 // Query sends a read-only message to an actor.
@@ -51,6 +53,13 @@ func (q *Queryer) Query(ctx context.Context, optFrom, to address.Address, method
 	// golang types.
 	sigGetter := mthdsig.NewGetter(q.chainReader)
 	sig, err := sigGetter.Get(ctx, to, method)
+	if err == mthdsig.ErrNoBuiltinImpl {
+		var exports [][]byte
+		exports, _, err = q.Query(ctx, optFrom, to, exec.ExportsMethod)
+		if err == nil {
+			sig, err = mthdsig.FromExports(exports, method)
+		}
+	}
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "unable to determine return type")
 	}
@@ -70,7 +79,7 @@ func (q *Queryer) Query(ctx context.Context, optFrom, to address.Address, method
 	}
 
 	vms := vm.NewStorageMap(q.bs)
-	r, ec, err := consensus.CallQueryMethod(ctx, st, vms, to, method, encodedParams, optFrom, types.NewBlockHeight(h))
+	r, ec, err := consensus.CallQueryMethod(ctx, st, vms, q.schedule.VersionAt(h), to, method, encodedParams, optFrom, types.NewBlockHeight(h))
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "querymethod returned an error")
 	} else if ec != 0 {
@@ -50,7 +50,7 @@ func TestQuery(t *testing.T) {
 		)
 		deps := requireCommonDepsWithGifAndBlockstore(require, testGen, r, bs)
 
-		queryer := NewQueryer(deps.repo, deps.wallet, deps.chainStore, deps.cst, deps.blockstore)
+		queryer := NewQueryer(deps.repo, deps.wallet, deps.chainStore, deps.cst, deps.blockstore, requireScheduleWithActors(require, builtin.Actors))
 		returnValue, funcSig, err := queryer.Query(ctx, fromAddr, fakeActorAddr, "hasReturnValue")
 		require.NoError(err)
 		require.NotNil(returnValue)
@@ -89,9 +89,37 @@ func TestQuery(t *testing.T) {
 		)
 		deps := requireCommonDepsWithGifAndBlockstore(require, testGen, r, bs)
 
-		queryer := NewQueryer(deps.repo, deps.wallet, deps.chainStore, deps.cst, deps.blockstore)
+		queryer := NewQueryer(deps.repo, deps.wallet, deps.chainStore, deps.cst, deps.blockstore, requireScheduleWithActors(require, builtin.Actors))
 		_, _, err := queryer.Query(ctx, fromAddr, fakeActorAddr, "nonZeroExitCode")
 		require.Error(err)
 		assert.Contains(err.Error(), "42")
 	})
+
+	t.Run("runs the actor code of the protocol version of the head", func(t *testing.T) {
+		require := require.New(t)
+		newAddr := address.NewForTestGetter()
+		ctx := context.Background()
+		r := repo.NewInMemoryRepo()
+		bs := bstore.NewBlockstore(r.Datastore())
+
+		fakeActorCodeCid := types.NewCidForTestGetter()()
+		fakeActorAddr := newAddr()
+		fromAddr := newAddr()
+		vms := vm.NewStorageMap(bs)
+		fakeActor := th.RequireNewFakeActor(require, vms, fakeActorAddr, fakeActorCodeCid)
+		builtin.Actors[fakeActorCodeCid] = &actor.FakeActor{}
+		defer func() {
+			delete(builtin.Actors, fakeActorCodeCid)
+		}()
+		testGen := consensus.MakeGenesisFunc(
+			consensus.AddActor(fakeActorAddr, fakeActor),
+			consensus.ActorAccount(fromAddr, types.NewAttoFILFromFIL(0)),
+		)
+		deps := requireCommonDepsWithGifAndBlockstore(require, testGen, r, bs)
+
+		// The fake actor code is not part of the default protocol versions.
+		queryer := NewQueryer(deps.repo, deps.wallet, deps.chainStore, deps.cst, deps.blockstore, consensus.DefaultProtocolSchedule())
+		_, _, err := queryer.Query(ctx, fromAddr, fakeActorAddr, "hasReturnValue")
+		require.Error(err)
+	})
 }
@@ -0,0 +1,320 @@
+package msg
+
+import (
+	"context"
+	"fmt"
+
+	bserv "github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-hamt-ipld"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-ipfs-exchange-offline"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/sampling"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+)
+
+// Replayer applies messages to the state of a tipset to show their effects,
+// without changing any state.
+type Replayer struct {
+	// To find messages and the states of tipsets.
+	chainReader chain.ReadStore
+	// To load the state trees and for vm storage, read through scratch
+	// stores.
+	bs bstore.Blockstore
+	// To apply messages by the protocol version of the tipset.
+	schedule *consensus.ProtocolSchedule
+}
+
+// ReplayResult is the outcome of a message applied by a Replayer.
+type ReplayResult struct {
+	Message *types.SignedMessage
+	// TipSet is the tipset whose state the message was applied to. When the
+	// message is replayed in place, the messages preceding it in the tipset
+	// including it were applied to that state first.
+	TipSet  types.SortedCidSet
+	Receipt *types.MessageReceipt
+	// Return holds the return values of the receipt decoded through the
+	// signature of the method called, empty if it has no known signature.
+	Return []string
+	// Error is the error of the message, empty if it succeeded.
+	Error string `json:",omitempty"`
+	// Changes holds the actors changed by the message, with the changes of
+	// their decoded states.
+	Changes []*state.ActorDiff
+}
+
+// NewReplayer returns a new Replayer.
+func NewReplayer(chainReader chain.ReadStore, bs bstore.Blockstore, schedule *consensus.ProtocolSchedule) *Replayer {
+	return &Replayer{chainReader: chainReader, bs: bs, schedule: schedule}
+}
+
+// Replay applies a message of the blockchain to the state of a tipset. If
+// no tipset is given, the message is replayed in place: the messages of the
+// tipset including it are applied to the state of its parent, as when the
+// tipset was processed, up to the message, so that the message is applied to
+// the state it was originally applied to.
+func (r *Replayer) Replay(ctx context.Context, msgCid cid.Cid, optAt types.SortedCidSet) (*ReplayResult, error) {
+	ts, msg, err := r.findMessage(ctx, msgCid)
+	if err != nil {
+		return nil, err
+	}
+
+	if !optAt.Empty() {
+		processor := consensus.NewScheduledProcessor(r.schedule, consensus.NewSimulationMessageValidator(), consensus.NewDefaultBlockRewarder())
+		return r.apply(ctx, processor, msg, optAt)
+	}
+	return r.replayInPlace(ctx, ts, msgCid, msg)
+}
+
+// Simulate applies an unsigned message to the state of a tipset, the head if
+// none is given.
+func (r *Replayer) Simulate(ctx context.Context, msg *types.Message, gasPrice types.AttoFIL, gasLimit types.GasUnits, optAt types.SortedCidSet) (*ReplayResult, error) {
+	at := optAt
+	if at.Empty() {
+		at = r.chainReader.Head().ToSortedCidSet()
+	}
+	smsg := &types.SignedMessage{
+		MeteredMessage: types.MeteredMessage{
+			Message:  *msg,
+			GasPrice: gasPrice,
+			GasLimit: gasLimit,
+		},
+	}
+	processor := consensus.NewScheduledProcessor(r.schedule, consensus.NewSimulationMessageValidator(), consensus.NewDefaultBlockRewarder())
+	return r.apply(ctx, processor, smsg, at)
+}
+
+// apply applies a message to the state of the tipset at, as it would be in a
+// child of that tipset. The gas paid by the message goes to the network
+// actor.
+func (r *Replayer) apply(ctx context.Context, processor *consensus.DefaultProcessor, msg *types.SignedMessage, at types.SortedCidSet) (*ReplayResult, error) {
+	tsas, err := r.chainReader.GetTipSetAndState(ctx, at.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get tipset %s", at.String())
+	}
+	h, err := tsas.TipSet.Height()
+	if err != nil {
+		return nil, err
+	}
+	bh := types.NewBlockHeight(h + 1)
+	ancestors, err := chain.GetRecentAncestors(ctx, tsas.TipSet, r.chainReader, bh, consensus.AncestorRoundsNeeded, sampling.LookbackParameter)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get ancestors")
+	}
+
+	sc, err := r.newScratch(ctx, tsas.TipSetStateRoot)
+	if err != nil {
+		return nil, err
+	}
+	// Upgrades taking effect in the child are not changes of the message.
+	if err := processor.Migrate(ctx, sc.st, sc.vms, bh, ancestors); err != nil {
+		return nil, errors.Wrap(err, "failed to upgrade state")
+	}
+	return sc.run(ctx, processor, msg, at, address.NetworkAddress, bh, ancestors)
+}
+
+// replayInPlace applies the message msgCid of the tipset ts to the state of
+// the parent of ts, after the rewards of the blocks of ts and the messages
+// preceding it in the canonical order of ts.
+func (r *Replayer) replayInPlace(ctx context.Context, ts types.TipSet, msgCid cid.Cid, msg *types.SignedMessage) (*ReplayResult, error) {
+	parents, err := ts.Parents()
+	if err != nil {
+		return nil, err
+	}
+	tsas, err := r.chainReader.GetTipSetAndState(ctx, parents.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get tipset %s", parents.String())
+	}
+	h, err := ts.Height()
+	if err != nil {
+		return nil, err
+	}
+	bh := types.NewBlockHeight(h)
+	ancestors, err := chain.GetRecentAncestors(ctx, tsas.TipSet, r.chainReader, bh, consensus.AncestorRoundsNeeded, sampling.LookbackParameter)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get ancestors")
+	}
+
+	preceding, miner, err := precedingBlocks(ts, msgCid)
+	if err != nil {
+		return nil, err
+	}
+	sc, err := r.newScratch(ctx, tsas.TipSetStateRoot)
+	if err != nil {
+		return nil, err
+	}
+	processor := consensus.NewScheduledProcessor(r.schedule, nil, consensus.NewDefaultBlockRewarder())
+	if _, err := processor.ProcessTipSet(ctx, sc.st, sc.vms, preceding, ancestors); err != nil {
+		return nil, errors.Wrap(err, "failed to apply preceding messages")
+	}
+	minerOwner, err := consensus.MinerOwnerAddress(ctx, sc.st, sc.vms, miner)
+	if err != nil {
+		return nil, err
+	}
+	return sc.run(ctx, processor, msg, parents, minerOwner, bh, ancestors)
+}
+
+// precedingBlocks returns the blocks of ts up to the first one including the
+// message msgCid in canonical order, that block holding only the messages
+// preceding it, and the miner of that block.
+func precedingBlocks(ts types.TipSet, msgCid cid.Cid) (types.TipSet, address.Address, error) {
+	blks := ts.ToSlice()
+	types.SortBlocks(blks)
+	var preceding []*types.Block
+	for _, blk := range blks {
+		for i, msg := range blk.Messages {
+			c, err := msg.Cid()
+			if err != nil {
+				return nil, address.Undef, err
+			}
+			if c.Equals(msgCid) {
+				preceding = append(preceding, &types.Block{
+					Miner:        blk.Miner,
+					Ticket:       blk.Ticket,
+					Parents:      blk.Parents,
+					ParentWeight: blk.ParentWeight,
+					Height:       blk.Height,
+					Nonce:        blk.Nonce,
+					Messages:     blk.Messages[:i],
+					Proof:        blk.Proof,
+				})
+				tips, err := types.NewTipSet(preceding...)
+				return tips, blk.Miner, err
+			}
+		}
+		preceding = append(preceding, blk)
+	}
+	return nil, address.Undef, fmt.Errorf("message %s not in tipset %s", msgCid.String(), ts.String())
+}
+
+// scratch holds a state tree and vm storage built in a scratch store, so
+// that the changes of the replayed messages are dropped with it.
+type scratch struct {
+	cst *hamt.CborIpldStore
+	st  state.Tree
+	vms vm.StorageMap
+}
+
+func (r *Replayer) newScratch(ctx context.Context, root cid.Cid) (*scratch, error) {
+	bs := state.NewScratchStore(r.bs)
+	cst := &hamt.CborIpldStore{Blocks: bserv.New(bs, offline.Exchange(bs))}
+	st, err := state.LoadStateTree(ctx, cst, root, builtin.Actors)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load state tree")
+	}
+	return &scratch{cst: cst, st: st, vms: vm.NewStorageMap(bs)}, nil
+}
+
+// flush writes the state and actor storage to the scratch store and returns
+// the root of the state.
+func (sc *scratch) flush(ctx context.Context) (cid.Cid, error) {
+	if err := sc.vms.Flush(); err != nil {
+		return cid.Undef, err
+	}
+	return sc.st.Flush(ctx)
+}
+
+// run applies a message to the scratch state and diffs the state before and
+// after it. Neither its signature nor its nonce is checked when the
+// processor uses the simulation validator.
+func (sc *scratch) run(ctx context.Context, processor *consensus.DefaultProcessor, msg *types.SignedMessage, at types.SortedCidSet, minerOwner address.Address, bh *types.BlockHeight, ancestors []types.TipSet) (*ReplayResult, error) {
+	beforeRoot, err := sc.flush(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to flush state")
+	}
+	res, err := processor.ApplyMessage(ctx, sc.st, sc.vms, msg, minerOwner, bh, vm.NewGasTracker(), ancestors)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to apply message")
+	}
+	afterRoot, err := sc.flush(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to flush state")
+	}
+
+	result := &ReplayResult{
+		Message: msg,
+		TipSet:  at,
+		Receipt: res.Receipt,
+	}
+	if res.ExecutionError != nil {
+		result.Error = res.ExecutionError.Error()
+	}
+	before, err := state.LoadStateTree(ctx, sc.cst, beforeRoot, builtin.Actors)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load state tree")
+	}
+	if result.Return, err = decodeReturn(ctx, before, msg, res.Receipt); err != nil {
+		return nil, err
+	}
+	if result.Changes, err = state.Diff(ctx, sc.cst, beforeRoot, afterRoot, builtin.Actors); err != nil {
+		return nil, errors.Wrap(err, "failed to diff state")
+	}
+	return result, nil
+}
+
+// findMessage searches the blockchain history for a message and the tipset
+// including it.
+func (r *Replayer) findMessage(ctx context.Context, msgCid cid.Cid) (types.TipSet, *types.SignedMessage, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for raw := range r.chainReader.BlockHistory(ctx, r.chainReader.Head()) {
+		switch raw := raw.(type) {
+		case error:
+			return nil, nil, raw
+		case types.TipSet:
+			for _, blk := range raw {
+				for _, msg := range blk.Messages {
+					c, err := msg.Cid()
+					if err != nil {
+						return nil, nil, err
+					}
+					if c.Equals(msgCid) {
+						return raw, msg, nil
+					}
+				}
+			}
+		default:
+			return nil, nil, fmt.Errorf("unexpected type in channel: %T", raw)
+		}
+	}
+	return nil, nil, fmt.Errorf("message %s not found on chain", msgCid.String())
+}
+
+// decodeReturn decodes the return values of a receipt through the signature
+// of the method called, looked up in the state the message was applied to.
+func decodeReturn(ctx context.Context, st state.Tree, msg *types.SignedMessage, receipt *types.MessageReceipt) ([]string, error) {
+	if msg.Method == "" || receipt == nil || len(receipt.Return) == 0 {
+		return nil, nil
+	}
+	to, err := st.GetActor(ctx, msg.To)
+	if err != nil || to.Empty() {
+		return nil, nil
+	}
+	executable, err := st.GetBuiltinActorCode(to.Code)
+	if err != nil {
+		return nil, nil
+	}
+	sig, ok := executable.Exports()[msg.Method]
+	if !ok || len(sig.Return) != len(receipt.Return) {
+		return nil, nil
+	}
+
+	var values []string
+	for i, ret := range receipt.Return {
+		val, err := sig.Schema().Return[i].Deserialize(ret)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode return value")
+		}
+		values = append(values, val.String())
+	}
+	return values, nil
+}
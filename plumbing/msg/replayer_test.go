@@ -0,0 +1,181 @@
+package msg
+
+import (
+	"context"
+	"testing"
+
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/core"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/state"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+)
+
+func TestSimulate(t *testing.T) {
+	// Don't add t.Parallel here; these tests muck with globals.
+
+	newAddr := address.NewForTestGetter()
+	ctx := context.Background()
+	r := repo.NewInMemoryRepo()
+	bs := bstore.NewBlockstore(r.Datastore())
+
+	fakeActorCodeCid := types.NewCidForTestGetter()()
+	fakeActorAddr := newAddr()
+	fromAddr := newAddr()
+	toAddr := newAddr()
+	vms := vm.NewStorageMap(bs)
+	fakeActor := th.RequireNewFakeActor(require.New(t), vms, fakeActorAddr, fakeActorCodeCid)
+	builtin.Actors[fakeActorCodeCid] = &actor.FakeActor{}
+	defer delete(builtin.Actors, fakeActorCodeCid)
+	testGen := consensus.MakeGenesisFunc(
+		consensus.AddActor(fakeActorAddr, fakeActor),
+		consensus.ActorAccount(fromAddr, types.NewAttoFILFromFIL(100)),
+	)
+	deps := requireCommonDepsWithGifAndBlockstore(require.New(t), testGen, r, bs)
+	replayer := NewReplayer(deps.chainStore, deps.blockstore, consensus.DefaultProtocolSchedule())
+
+	t.Run("reports the changes of a transfer without applying them", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		message := types.NewMessage(fromAddr, toAddr, 0, types.NewAttoFILFromFIL(10), "", nil)
+		res, err := replayer.Simulate(ctx, message, types.NewGasPrice(0), types.NewGasUnits(1000), types.SortedCidSet{})
+		require.NoError(err)
+
+		assert.Equal(deps.chainStore.Head().ToSortedCidSet(), res.TipSet)
+		assert.Equal(uint8(0), res.Receipt.ExitCode)
+		assert.Empty(res.Error)
+		changes := make(map[address.Address]*state.ActorDiff)
+		for _, change := range res.Changes {
+			changes[change.Address] = change
+		}
+		// The recipient is created and assigned an ID by the init actor.
+		require.Len(res.Changes, 3)
+		assert.NotNil(changes[address.InitAddress])
+
+		from := changes[fromAddr]
+		require.NotNil(from.Before)
+		assert.Equal(types.NewAttoFILFromFIL(100), from.Before.Balance)
+		assert.Equal(types.NewAttoFILFromFIL(90), from.After.Balance)
+		assert.Equal(from.Before.Nonce+1, from.After.Nonce)
+
+		to := changes[toAddr]
+		require.NotNil(to)
+		assert.Nil(to.Before)
+		assert.Equal(types.NewAttoFILFromFIL(10), to.After.Balance)
+
+		st, err := deps.chainStore.LatestState(ctx)
+		require.NoError(err)
+		fromActor, err := st.GetActor(ctx, fromAddr)
+		require.NoError(err)
+		assert.Equal(types.NewAttoFILFromFIL(100), fromActor.Balance)
+	})
+
+	t.Run("decodes the return values", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		message := types.NewMessage(fromAddr, fakeActorAddr, 0, types.ZeroAttoFIL, "hasReturnValue", nil)
+		res, err := replayer.Simulate(ctx, message, types.NewGasPrice(0), types.NewGasUnits(1000), types.SortedCidSet{})
+		require.NoError(err)
+
+		assert.Equal(uint8(0), res.Receipt.ExitCode)
+		require.Len(res.Return, 1)
+		ret, err := address.NewFromBytes(res.Receipt.Return[0])
+		require.NoError(err)
+		assert.Equal(ret.String(), res.Return[0])
+	})
+
+	t.Run("fails for an unknown tipset", func(t *testing.T) {
+		message := types.NewMessage(fromAddr, toAddr, 0, types.NewAttoFILFromFIL(10), "", nil)
+		_, err := replayer.Simulate(ctx, message, types.NewGasPrice(0), types.NewGasUnits(1000), types.NewSortedCidSet(types.SomeCid()))
+		assert.Error(t, err)
+	})
+}
+
+func TestReplayInPlace(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	from, to, owner := mockSigner.Addresses[0], mockSigner.Addresses[1], mockSigner.Addresses[2]
+	minerAddr := mockSigner.Addresses[3]
+	testGen := consensus.MakeGenesisFunc(
+		consensus.ActorAccount(from, types.NewAttoFILFromFIL(100)),
+		consensus.ActorAccount(owner, types.NewAttoFILFromFIL(0)),
+		consensus.MinerActor(minerAddr, owner, []byte{}, 1000, th.RequireRandomPeerID(require), types.ZeroAttoFIL),
+	)
+	deps := requiredCommonDeps(require, testGen)
+	replayer := NewReplayer(deps.chainStore, deps.blockstore, consensus.DefaultProtocolSchedule())
+
+	var msgs []*types.SignedMessage
+	for nonce, value := range []uint64{10, 20} {
+		msg := types.NewMessage(from, to, uint64(nonce), types.NewAttoFILFromFIL(value), "", nil)
+		smsg, err := types.NewSignedMessage(*msg, &mockSigner, types.NewGasPrice(0), types.NewGasUnits(0))
+		require.NoError(err)
+		msgs = append(msgs, smsg)
+	}
+
+	genesis := deps.chainStore.Head()
+	genesisBlock := genesis.ToSlice()[0]
+	blk := th.RequireMkFakeChild(require, th.FakeChildParams{
+		MinerAddr:   minerAddr,
+		Parent:      genesis,
+		GenesisCid:  deps.chainStore.GenesisCid(),
+		StateRoot:   genesisBlock.StateRoot,
+		Signer:      mockSigner,
+		MinerPubKey: mockSigner.PubKeys[0],
+	})
+	blk.Messages = msgs
+	core.MustPut(deps.cst, blk)
+	ts := th.RequireNewTipSet(require, blk)
+	th.RequirePutTsas(ctx, require, deps.chainStore, &chain.TipSetAndState{
+		TipSet:          ts,
+		TipSetStateRoot: genesisBlock.StateRoot,
+	})
+	require.NoError(deps.chainStore.SetHead(ctx, ts))
+
+	// The second message is applied after the first one, as on chain.
+	second, err := msgs[1].Cid()
+	require.NoError(err)
+	res, err := replayer.Replay(ctx, second, types.SortedCidSet{})
+	require.NoError(err)
+	assert.Equal(genesis.ToSortedCidSet(), res.TipSet)
+	assert.Equal(uint8(0), res.Receipt.ExitCode)
+	assert.Empty(res.Error)
+
+	require.Len(res.Changes, 2)
+	changes := make(map[address.Address]*state.ActorDiff)
+	for _, change := range res.Changes {
+		changes[change.Address] = change
+	}
+	require.NotNil(changes[from])
+	assert.Equal(types.NewAttoFILFromFIL(90), changes[from].Before.Balance)
+	assert.Equal(types.NewAttoFILFromFIL(70), changes[from].After.Balance)
+	require.NotNil(changes[to])
+	assert.Equal(types.NewAttoFILFromFIL(10), changes[to].Before.Balance)
+	assert.Equal(types.NewAttoFILFromFIL(30), changes[to].After.Balance)
+}
+
+func TestReplayMessageNotFound(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	deps := requiredCommonDeps(require, consensus.DefaultGenesis)
+	replayer := NewReplayer(deps.chainStore, deps.blockstore, consensus.DefaultProtocolSchedule())
+
+	_, err := replayer.Replay(context.Background(), types.SomeCid(), types.SortedCidSet{})
+	require.Error(err)
+	require.Contains(err.Error(), "not found on chain")
+}
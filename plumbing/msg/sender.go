@@ -137,6 +137,75 @@ func (s *Sender) Send(ctx context.Context, from, to address.Address, value *type
 	return smsg.Cid()
 }
 
+// Replace re-signs a message of the outbox with a higher gas price, keeping its nonce, and
+// sends it in place of the original. A zero gas limit keeps the limit of the original.
+// This is how a message stuck because of a low gas price is unstuck.
+func (s *Sender) Replace(ctx context.Context, msgCid cid.Cid, gasPrice types.AttoFIL, gasLimit types.GasUnits) (out cid.Cid, err error) {
+	defer func() {
+		if err != nil {
+			msgSendErrCt.Inc(ctx, 1)
+		}
+	}()
+
+	// Lock to avoid racing with a send of the next nonce.
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	queued, found, err := s.outbox.Get(msgCid)
+	if err != nil {
+		return cid.Undef, errors.Wrap(err, "failed to search outbound queue")
+	}
+	if !found {
+		return cid.Undef, errors.Errorf("message %s is not in the outbound queue", msgCid)
+	}
+	old := queued.Msg
+	if !gasPrice.GreaterThan(&old.GasPrice) {
+		return cid.Undef, errors.Errorf("gas price must be greater than the current price %s", old.GasPrice.String())
+	}
+	if gasLimit == 0 {
+		gasLimit = old.GasLimit
+	}
+
+	st, err := s.chainState.LatestState(ctx)
+	if err != nil {
+		return cid.Undef, errors.Wrap(err, "failed to load state from chain")
+	}
+	fromActor, err := st.GetActor(ctx, old.From)
+	if err != nil {
+		return cid.Undef, errors.Wrapf(err, "no actor at address %s", old.From)
+	}
+
+	smsg, err := types.NewSignedMessage(old.Message, s.signer, gasPrice, gasLimit)
+	if err != nil {
+		return cid.Undef, errors.Wrap(err, "failed to sign message")
+	}
+	if err := s.validator.Validate(ctx, smsg, fromActor); err != nil {
+		return cid.Undef, errors.Wrap(err, "invalid message")
+	}
+	smsgdata, err := smsg.Marshal()
+	if err != nil {
+		return cid.Undef, errors.Wrap(err, "failed to marshal message")
+	}
+	height, err := s.blockTimer.BlockHeight()
+	if err != nil {
+		return cid.Undef, errors.Wrap(err, "failed to get block height")
+	}
+
+	if _, err := s.outbox.Replace(smsg, height); err != nil {
+		return cid.Undef, errors.Wrap(err, "failed to replace message in outbound queue")
+	}
+	s.inbox.Remove(msgCid)
+	if _, err := s.inbox.Add(smsg); err != nil {
+		return cid.Undef, errors.Wrap(err, "failed to add message to message pool")
+	}
+	if err = s.publish(Topic, smsgdata); err != nil {
+		return cid.Undef, errors.Wrap(err, "failed to publish message to network")
+	}
+
+	log.Debugf("Replaced message %s with message: %s", msgCid, smsg)
+	return smsg.Cid()
+}
+
 // nextNonce returns the next expected nonce value for an account actor. This is the larger
 // of the actor's nonce value, or one greater than the largest nonce from the actor found in the message pool.
 func nextNonce(act *actor.Actor, outbox *core.MessageQueue, address address.Address) (uint64, error) {
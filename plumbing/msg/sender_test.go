@@ -112,6 +112,51 @@ func TestSend(t *testing.T) {
 	})
 }
 
+func TestReplace(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	w, chainStore := setupSendTest(require)
+	addr := w.Addresses()[0]
+	timer := testhelpers.NewTestBlockTimer(1000)
+	queue := core.NewMessageQueue()
+	pool := core.NewMessagePool(timer)
+	published := 0
+	publish := func(string, []byte) error {
+		published++
+		return nil
+	}
+	s := NewSender(w, chainStore, timer, queue, pool, nullValidator{}, publish)
+
+	c1, err := s.Send(ctx, addr, addr, types.NewAttoFILFromFIL(2), types.NewGasPrice(1), types.NewGasUnits(300), "")
+	require.NoError(err)
+
+	_, err = s.Replace(ctx, c1, types.NewGasPrice(1), types.NewGasUnits(0))
+	assert.Error(err)
+	assert.Contains(err.Error(), "must be greater")
+
+	c2, err := s.Replace(ctx, c1, types.NewGasPrice(2), types.NewGasUnits(0))
+	require.NoError(err)
+	assert.NotEqual(c1, c2)
+	assert.Equal(2, published)
+
+	queued := queue.List(addr)
+	require.Len(queued, 1)
+	assert.Equal(types.NewGasPrice(2), queued[0].Msg.GasPrice)
+	assert.Equal(types.NewGasUnits(300), queued[0].Msg.GasLimit)
+	assert.Equal(types.Uint64(0), queued[0].Msg.Nonce)
+
+	_, inPool := pool.Get(c1)
+	assert.False(inPool)
+	_, inPool = pool.Get(c2)
+	assert.True(inPool)
+
+	_, err = s.Replace(ctx, c1, types.NewGasPrice(3), types.NewGasUnits(0))
+	assert.Error(err)
+}
+
 func TestNextNonce(t *testing.T) {
 	t.Parallel()
 
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	bserv "github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-cid"
 	hamt "github.com/ipfs/go-hamt-ipld"
 	bstore "github.com/ipfs/go-ipfs-blockstore"
 	offline "github.com/ipfs/go-ipfs-exchange-offline"
@@ -11,7 +12,9 @@ import (
 
 	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/exec"
 	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/filecoin-project/go-filecoin/wallet"
 )
 
@@ -48,3 +51,17 @@ func requireCommonDepsWithGifAndBlockstore(require *require.Assertions, gif cons
 		cst:        cst,
 	}
 }
+
+// requireScheduleWithActors returns a schedule never upgrading from a
+// protocol version running the given actor code, such as builtin.Actors once
+// test actors are added to it.
+func requireScheduleWithActors(require *require.Assertions, actors map[cid.Cid]exec.ExecutableActor) *consensus.ProtocolSchedule {
+	version := &consensus.ProtocolVersion{
+		Actors:    actors,
+		GasPrices: types.GenesisGasPrices(),
+		Validator: consensus.NewDefaultMessageValidator(),
+	}
+	schedule, err := consensus.NewProtocolSchedule([]*consensus.ProtocolVersion{version}, nil)
+	require.NoError(err)
+	return schedule
+}
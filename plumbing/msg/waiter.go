@@ -26,6 +26,8 @@ type Waiter struct {
 	chainReader chain.ReadStore
 	cst         *hamt.CborIpldStore
 	bs          bstore.Blockstore
+	// To process tipsets by the protocol versions they were made with.
+	schedule *consensus.ProtocolSchedule
 }
 
 // ChainMessage is an on-chain message with its block and receipt.
@@ -36,11 +38,12 @@ type ChainMessage struct {
 }
 
 // NewWaiter returns a new Waiter.
-func NewWaiter(chainStore chain.ReadStore, bs bstore.Blockstore, cst *hamt.CborIpldStore) *Waiter {
+func NewWaiter(chainStore chain.ReadStore, bs bstore.Blockstore, cst *hamt.CborIpldStore, schedule *consensus.ProtocolSchedule) *Waiter {
 	return &Waiter{
 		chainReader: chainStore,
 		cst:         cst,
 		bs:          bs,
+		schedule:    schedule,
 	}
 }
 
@@ -167,48 +170,166 @@ func (w *Waiter) receiptFromTipSet(ctx context.Context, msgCid cid.Cid, ts types
 	}
 
 	// Apply all the tipset's messages to determine the correct receipts.
-	ids, err := ts.Parents()
+	st, ancestors, err := w.parentState(ctx, ts)
 	if err != nil {
 		return nil, err
 	}
-	tsas, err := w.chainReader.GetTipSetAndState(ctx, ids.String())
+
+	res, err := w.processor().ProcessTipSet(ctx, st, vm.NewStorageMap(w.bs), ts, ancestors)
 	if err != nil {
 		return nil, err
 	}
-	st, err := state.LoadStateTree(ctx, w.cst, tsas.TipSetStateRoot, builtin.Actors)
-	if err != nil {
-		return nil, err
+
+	// If this is a failing conflict message there is no application receipt.
+	if res.Failures.Has(msgCid) {
+		return nil, nil
 	}
 
-	tsHeight, err := ts.Height()
+	j, err := msgIndexOfTipSet(msgCid, ts, res.Failures)
 	if err != nil {
 		return nil, err
 	}
-	tsBlockHeight := types.NewBlockHeight(tsHeight)
-	ancestors, err := chain.GetRecentAncestors(ctx, tsas.TipSet, w.chainReader, tsBlockHeight, consensus.AncestorRoundsNeeded, sampling.LookbackParameter)
+	// TODO: out of bounds receipt index should return an error.
+	if j < len(res.Results) {
+		rcpt = res.Results[j].Receipt
+	}
+	return rcpt, nil
+}
+
+// ReceiptsFromTipSet returns the receipts of all the messages of a tipset by
+// message cid. A tipset of several blocks is processed once for all of them.
+// Messages failing because they conflict with another message of the tipset
+// have no receipt.
+func (w *Waiter) ReceiptsFromTipSet(ctx context.Context, ts types.TipSet) (map[cid.Cid]*types.MessageReceipt, error) {
+	var receipts []*types.MessageReceipt
+	var fails types.SortedCidSet
+	blks := ts.ToSlice()
+	if len(blks) == 1 {
+		// Receipts always match block if tipset has only 1 member.
+		receipts = blks[0].MessageReceipts
+	} else {
+		// Apply all the tipset's messages to determine the correct receipts.
+		st, ancestors, err := w.parentState(ctx, ts)
+		if err != nil {
+			return nil, err
+		}
+		res, err := w.processor().ProcessTipSet(ctx, st, vm.NewStorageMap(w.bs), ts, ancestors)
+		if err != nil {
+			return nil, err
+		}
+		fails = res.Failures
+		for _, r := range res.Results {
+			receipts = append(receipts, r.Receipt)
+		}
+	}
+
+	// Receipts follow the canonical message ordering of the tipset.
+	types.SortBlocks(blks)
+	out := make(map[cid.Cid]*types.MessageReceipt)
+	var seen types.SortedCidSet
+	for _, b := range blks {
+		for _, msg := range b.Messages {
+			c, err := msg.Cid()
+			if err != nil {
+				return nil, err
+			}
+			if fails.Has(c) || seen.Has(c) {
+				continue
+			}
+			// TODO: a missing receipt should be an error, see receiptFromTipSet.
+			if j := seen.Len(); j < len(receipts) {
+				out[c] = receipts[j]
+			}
+			(&seen).Add(c)
+		}
+	}
+	return out, nil
+}
+
+// Trace replays a message of the blockchain and returns its call tree. The
+// messages of its tipset are applied to the state of the parent tipset, as
+// when the tipset was processed, so that the message is applied to the state
+// it was originally applied to.
+func (w *Waiter) Trace(ctx context.Context, msgCid cid.Cid) (*vm.TraceFrame, error) {
+	ts, found, err := w.findTipSet(ctx, msgCid)
 	if err != nil {
 		return nil, err
 	}
+	if !found {
+		return nil, fmt.Errorf("message %s not found on chain", msgCid.String())
+	}
 
-	res, err := consensus.NewDefaultProcessor().ProcessTipSet(ctx, st, vm.NewStorageMap(w.bs), ts, ancestors)
+	st, ancestors, err := w.parentState(ctx, ts)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "failed to load parent state")
+	}
+	tracer := vm.NewTracer()
+	if _, err := w.processor().ProcessTipSet(vm.WithTracer(ctx, tracer), st, vm.NewStorageMap(w.bs), ts, ancestors); err != nil {
+		return nil, errors.Wrap(err, "failed to replay tipset")
 	}
 
-	// If this is a failing conflict message there is no application receipt.
-	if res.Failures.Has(msgCid) {
-		return nil, nil
+	frame, ok := tracer.Trace(msgCid)
+	if !ok {
+		return nil, fmt.Errorf("message %s was not executed by the vm", msgCid.String())
 	}
+	return frame, nil
+}
 
-	j, err := msgIndexOfTipSet(msgCid, ts, res.Failures)
+// findTipSet searches the blockchain history for the tipset including a
+// message.
+func (w *Waiter) findTipSet(ctx context.Context, msgCid cid.Cid) (types.TipSet, bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for raw := range w.chainReader.BlockHistory(ctx, w.chainReader.Head()) {
+		switch raw := raw.(type) {
+		case error:
+			return nil, false, raw
+		case types.TipSet:
+			for _, blk := range raw {
+				for _, msg := range blk.Messages {
+					c, err := msg.Cid()
+					if err != nil {
+						return nil, false, err
+					}
+					if c.Equals(msgCid) {
+						return raw, true, nil
+					}
+				}
+			}
+		default:
+			return nil, false, fmt.Errorf("unexpected type in channel: %T", raw)
+		}
+	}
+	return nil, false, ctx.Err()
+}
+
+// parentState returns the state of the parent of a tipset and the ancestors
+// needed to process the tipset.
+func (w *Waiter) parentState(ctx context.Context, ts types.TipSet) (state.Tree, []types.TipSet, error) {
+	ids, err := ts.Parents()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	// TODO: out of bounds receipt index should return an error.
-	if j < len(res.Results) {
-		rcpt = res.Results[j].Receipt
+	tsas, err := w.chainReader.GetTipSetAndState(ctx, ids.String())
+	if err != nil {
+		return nil, nil, err
 	}
-	return rcpt, nil
+	st, err := state.LoadStateTree(ctx, w.cst, tsas.TipSetStateRoot, builtin.Actors)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tsHeight, err := ts.Height()
+	if err != nil {
+		return nil, nil, err
+	}
+	tsBlockHeight := types.NewBlockHeight(tsHeight)
+	ancestors, err := chain.GetRecentAncestors(ctx, tsas.TipSet, w.chainReader, tsBlockHeight, consensus.AncestorRoundsNeeded, sampling.LookbackParameter)
+	if err != nil {
+		return nil, nil, err
+	}
+	return st, ancestors, nil
 }
 
 // msgIndexOfTipSet returns the order in which msgCid appears in the canonical
@@ -242,3 +363,8 @@ func msgIndexOfTipSet(msgCid cid.Cid, ts types.TipSet, fails types.SortedCidSet)
 
 	return -1, fmt.Errorf("message cid %s not in tipset", msgCid.String())
 }
+
+// processor returns a processor running the protocol versions of the chain.
+func (w *Waiter) processor() *consensus.DefaultProcessor {
+	return consensus.NewScheduledProcessor(w.schedule, nil, consensus.NewDefaultBlockRewarder())
+}
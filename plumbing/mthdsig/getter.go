@@ -2,10 +2,12 @@ package mthdsig
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 
 	"github.com/pkg/errors"
 
+	"github.com/filecoin-project/go-filecoin/abi"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/exec"
 	"github.com/filecoin-project/go-filecoin/state"
@@ -19,6 +21,10 @@ var (
 	// but hasn't yet been upgraded to an account actor. (The actor implementation might
 	// also genuinely be missing, which is not expected.)
 	ErrNoActorImpl = errors.New("no actor implementation")
+	// ErrNoBuiltinImpl is returned by Get when the actor implementation is not
+	// a builtin actor, eg the actor was deployed by a user. The signature may
+	// then be found in the answer of the actor to the exports query.
+	ErrNoBuiltinImpl = errors.New("no builtin actor implementation")
 )
 
 // ChainReadStore is the subset of chain.ReadStore that Getter needs.
@@ -50,19 +56,55 @@ func (sg *Getter) Get(ctx context.Context, actorAddr address.Address, method str
 		return nil, ErrNoActorImpl
 	}
 
-	executable, err := st.GetBuiltinActorCode(actor.Code)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to load actor code")
-	}
-
 	if method == "" {
 		return nil, ErrNoMethod
 	}
 
+	executable, err := st.GetBuiltinActorCode(actor.Code)
+	if err != nil {
+		if method == exec.ExportsMethod {
+			return exec.ExportsSignature, nil
+		}
+		return nil, ErrNoBuiltinImpl
+	}
+
 	export, ok := executable.Exports()[method]
 	if !ok {
+		if method == exec.ExportsMethod {
+			return exec.ExportsSignature, nil
+		}
 		return nil, fmt.Errorf("missing export: %s", method)
 	}
 
 	return export, nil
 }
+
+// FromExports returns the signature for the given method from the answer of
+// an actor to the exports query.
+func FromExports(exportsRet [][]byte, method string) (*exec.FunctionSignature, error) {
+	if len(exportsRet) == 0 {
+		return nil, errors.New("missing exports")
+	}
+
+	var exports abi.ExportsSchema
+	if err := json.Unmarshal(exportsRet[0], &exports); err != nil {
+		return nil, errors.Wrap(err, "invalid exports")
+	}
+
+	schema, ok := exports[method]
+	if !ok || schema == nil {
+		return nil, fmt.Errorf("missing export: %s", method)
+	}
+	for _, s := range schema.Params {
+		if err := s.Validate(); err != nil {
+			return nil, errors.Wrap(err, "invalid param schema")
+		}
+	}
+	for _, s := range schema.Return {
+		if err := s.Validate(); err != nil {
+			return nil, errors.Wrap(err, "invalid return schema")
+		}
+	}
+
+	return exec.NewFunctionSignature(schema.Params, schema.Return), nil
+}
@@ -79,6 +79,37 @@ func TestGet(t *testing.T) {
 		require.Error(err)
 	})
 
+	t.Run("returns the exports signature for any actor", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		ctx := context.Background()
+		cst := hamt.NewCborStore()
+		addrGetter := address.NewForTestGetter()
+		acctAddr := addrGetter()
+		deployedAddr := addrGetter()
+
+		acctActor := th.RequireNewAccountActor(require, types.NewAttoFILFromFIL(10000))
+		deployedActor := actor.NewActor(types.SomeCid(), types.NewAttoFILFromFIL(0))
+		_, st := th.RequireMakeStateTree(require, cst, map[address.Address]*actor.Actor{
+			acctAddr:     acctActor,
+			deployedAddr: deployedActor,
+		})
+
+		getter := mthdsig.NewGetter(&fakeChainReadStore{st})
+
+		sig, err := getter.Get(ctx, acctAddr, exec.ExportsMethod)
+		require.NoError(err)
+		assert.Equal(exec.ExportsSignature, sig)
+
+		sig, err = getter.Get(ctx, deployedAddr, exec.ExportsMethod)
+		require.NoError(err)
+		assert.Equal(exec.ExportsSignature, sig)
+
+		_, err = getter.Get(ctx, deployedAddr, "increment")
+		assert.Equal(mthdsig.ErrNoBuiltinImpl, err)
+	})
+
 	t.Run("errors with ErrNoMethod if no method", func(t *testing.T) {
 		assert := assert.New(t)
 		require := require.New(t)
@@ -0,0 +1,46 @@
+package statediff
+
+import (
+	"context"
+
+	"github.com/ipfs/go-hamt-ipld"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// ChainReadStore is the subset of chain.ReadStore that Differ needs.
+type ChainReadStore interface {
+	GetTipSetAndState(ctx context.Context, tsKey string) (*chain.TipSetAndState, error)
+}
+
+// Differ diffs the states of tipsets.
+type Differ struct {
+	// To get the state roots of tipsets.
+	chainReader ChainReadStore
+	// To load the state trees and the states of actors.
+	cst *hamt.CborIpldStore
+}
+
+// NewDiffer returns a new Differ.
+func NewDiffer(chainReader ChainReadStore, cst *hamt.CborIpldStore) *Differ {
+	return &Differ{chainReader: chainReader, cst: cst}
+}
+
+// Diff returns the actors added, removed or modified from the state of
+// tipset a to the state of tipset b, with the changes of the states of the
+// builtin actors.
+func (d *Differ) Diff(ctx context.Context, a, b types.SortedCidSet) ([]*state.ActorDiff, error) {
+	tsasA, err := d.chainReader.GetTipSetAndState(ctx, a.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get tipset %s", a.String())
+	}
+	tsasB, err := d.chainReader.GetTipSetAndState(ctx, b.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get tipset %s", b.String())
+	}
+	return state.Diff(ctx, d.cst, tsasA.TipSetStateRoot, tsasB.TipSetStateRoot, builtin.Actors)
+}
@@ -0,0 +1,65 @@
+package statediff
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-hamt-ipld"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin/account"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+type fakeChainReadStore struct {
+	states map[string]*chain.TipSetAndState
+}
+
+func (f *fakeChainReadStore) GetTipSetAndState(ctx context.Context, tsKey string) (*chain.TipSetAndState, error) {
+	tsas, ok := f.states[tsKey]
+	if !ok {
+		return nil, chain.ErrNotFound
+	}
+	return tsas, nil
+}
+
+func TestDiff(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx := context.Background()
+	cst := hamt.NewCborStore()
+	st := state.NewEmptyStateTree(cst)
+	addr := address.NewForTestGetter()()
+
+	rootA, err := st.Flush(ctx)
+	require.NoError(err)
+	act, err := account.NewActor(types.NewAttoFILFromFIL(10))
+	require.NoError(err)
+	require.NoError(st.SetActor(ctx, addr, act))
+	rootB, err := st.Flush(ctx)
+	require.NoError(err)
+
+	cidGetter := types.NewCidForTestGetter()
+	keyA := types.NewSortedCidSet(cidGetter())
+	keyB := types.NewSortedCidSet(cidGetter())
+	reader := &fakeChainReadStore{states: map[string]*chain.TipSetAndState{
+		keyA.String(): {TipSetStateRoot: rootA},
+		keyB.String(): {TipSetStateRoot: rootB},
+	}}
+	differ := NewDiffer(reader, cst)
+
+	diffs, err := differ.Diff(ctx, keyA, keyB)
+	require.NoError(err)
+	require.Len(diffs, 1)
+	assert.Equal(addr, diffs[0].Address)
+	assert.Nil(diffs[0].Before)
+	assert.Equal(types.NewAttoFILFromFIL(10), diffs[0].After.Balance)
+
+	_, err = differ.Diff(ctx, keyA, types.NewSortedCidSet(types.SomeCid()))
+	assert.Error(err)
+}
@@ -0,0 +1,101 @@
+package porcelain
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin/wasmactor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+	vmErrors "github.com/filecoin-project/go-filecoin/vm/errors"
+)
+
+// acAPI is the subset of the plumbing.API that ActorDeploy and ActorCall use.
+type acAPI interface {
+	MessageSendWithDefaultAddress(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error)
+	MessageWait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block, *types.SignedMessage, *types.MessageReceipt) error) error
+}
+
+// ActorDeploy deploys an actor running the given WebAssembly code through
+// the init actor. It waits for the actor to appear on-chain and returns its
+// address.
+func ActorDeploy(
+	ctx context.Context,
+	plumbing acAPI,
+	from address.Address,
+	gasPrice types.AttoFIL,
+	gasLimit types.GasUnits,
+	code []byte,
+) (address.Address, error) {
+	smsgCid, err := plumbing.MessageSendWithDefaultAddress(
+		ctx,
+		from,
+		address.InitAddress,
+		types.ZeroAttoFIL,
+		gasPrice,
+		gasLimit,
+		"deploy",
+		code,
+	)
+	if err != nil {
+		return address.Undef, err
+	}
+
+	var actorAddr address.Address
+	err = plumbing.MessageWait(ctx, smsgCid, func(blk *types.Block, smsg *types.SignedMessage, receipt *types.MessageReceipt) (err error) {
+		if receipt.ExitCode != uint8(0) {
+			return vmErrors.VMExitCodeToError(receipt.ExitCode, wasmactor.Errors)
+		}
+		actorAddr, err = address.NewFromBytes(receipt.Return[0])
+		return err
+	})
+	if err != nil {
+		return address.Undef, err
+	}
+	return actorAddr, nil
+}
+
+// ActorCall calls a method of a deployed actor with the given params and
+// value. It waits for the message to appear on-chain and returns the return
+// value of the method.
+func ActorCall(
+	ctx context.Context,
+	plumbing acAPI,
+	from,
+	to address.Address,
+	value *types.AttoFIL,
+	gasPrice types.AttoFIL,
+	gasLimit types.GasUnits,
+	method string,
+	params []byte,
+) ([]byte, error) {
+	smsgCid, err := plumbing.MessageSendWithDefaultAddress(
+		ctx,
+		from,
+		to,
+		value,
+		gasPrice,
+		gasLimit,
+		method,
+		params,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []byte
+	err = plumbing.MessageWait(ctx, smsgCid, func(blk *types.Block, smsg *types.SignedMessage, receipt *types.MessageReceipt) error {
+		if receipt.ExitCode != uint8(0) {
+			return vmErrors.VMExitCodeToError(receipt.ExitCode, wasmactor.Errors)
+		}
+		if len(receipt.Return) > 0 {
+			ret = receipt.Return[0]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,39 @@
+package porcelain
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/exec"
+)
+
+// aaAPI is the subset of the plumbing.API that ActorAddresses uses.
+type aaAPI interface {
+	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error)
+}
+
+// ActorAddresses returns both forms of the address of an actor: its actor
+// address and the ID address assigned to it by the init actor. Either form
+// may be given.
+func ActorAddresses(ctx context.Context, plumbing aaAPI, addr address.Address) (address.Address, address.Address, error) {
+	res, _, err := plumbing.MessageQuery(ctx, address.Undef, address.InitAddress, "getActorAddress", addr)
+	if err != nil {
+		return address.Undef, address.Undef, errors.Wrapf(err, "failed to look up actor address of %s", addr)
+	}
+	actorAddr, err := address.NewFromBytes(res[0])
+	if err != nil {
+		return address.Undef, address.Undef, errors.Wrap(err, "could not decode actor address")
+	}
+
+	res, _, err = plumbing.MessageQuery(ctx, address.Undef, address.InitAddress, "getActorIDAddress", actorAddr)
+	if err != nil {
+		return address.Undef, address.Undef, errors.Wrapf(err, "failed to look up ID address of %s", actorAddr)
+	}
+	idAddr, err := address.NewFromBytes(res[0])
+	if err != nil {
+		return address.Undef, address.Undef, errors.Wrap(err, "could not decode ID address")
+	}
+	return actorAddr, idAddr, nil
+}
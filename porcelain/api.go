@@ -6,10 +6,12 @@ import (
 
 	"github.com/ipfs/go-cid"
 	"github.com/libp2p/go-libp2p-peer"
+	ma "github.com/multiformats/go-multiaddr"
 
 	minerActor "github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/plumbing"
 	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
 	"github.com/filecoin-project/go-filecoin/types"
@@ -43,11 +45,33 @@ func New(plumbing *plumbing.API) *API {
 	return &API{plumbing}
 }
 
+// ActorAddresses returns the actor address and the ID address of an actor
+func (a *API) ActorAddresses(ctx context.Context, addr address.Address) (address.Address, address.Address, error) {
+	return ActorAddresses(ctx, a, addr)
+}
+
+// ActorDeploy deploys an actor running WebAssembly code and returns its
+// address
+func (a *API) ActorDeploy(ctx context.Context, from address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, code []byte) (address.Address, error) {
+	return ActorDeploy(ctx, a, from, gasPrice, gasLimit, code)
+}
+
+// ActorCall calls a method of a deployed actor and returns its return value
+func (a *API) ActorCall(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params []byte) ([]byte, error) {
+	return ActorCall(ctx, a, from, to, value, gasPrice, gasLimit, method, params)
+}
+
 // ChainBlockHeight determines the current block height
 func (a *API) ChainBlockHeight(ctx context.Context) (*types.BlockHeight, error) {
 	return ChainBlockHeight(ctx, a)
 }
 
+// ChainCheckpoint pins a tipset as a checkpoint the chains synced must
+// include, and saves it in the config
+func (a *API) ChainCheckpoint(ctx context.Context, key types.SortedCidSet, height *uint64) (chain.Checkpoint, error) {
+	return ChainCheckpoint(ctx, a, key, height)
+}
+
 // CreatePayments establishes a payment channel and create multiple payments against it
 func (a *API) CreatePayments(ctx context.Context, config CreatePaymentsParams) (*CreatePaymentsReturn, error) {
 	return CreatePayments(ctx, a, config)
@@ -71,6 +95,17 @@ func (a *API) MessagePoolWait(ctx context.Context, messageCount uint) ([]*types.
 	return MessagePoolWait(ctx, a, messageCount)
 }
 
+// OutboxLs lists the messages in the outbox for an address with their age,
+// broadcast count and estimated chances of inclusion.
+func (a *API) OutboxLs(ctx context.Context, sender address.Address) ([]*OutboxMessage, error) {
+	return OutboxLs(ctx, a, sender)
+}
+
+// SyncWait waits until the syncer has no more tipsets to sync.
+func (a *API) SyncWait(ctx context.Context) (chain.SyncStatus, error) {
+	return SyncWait(ctx, a)
+}
+
 // MessageSendWithDefaultAddress calls MessageSend but with a default from
 // address if none is provided
 func (a *API) MessageSendWithDefaultAddress(
@@ -140,6 +175,11 @@ func (a *API) MinerGetPeerID(ctx context.Context, minerAddr address.Address) (pe
 	return MinerGetPeerID(ctx, a, minerAddr)
 }
 
+// MinerGetMultiaddrs queries for the multiaddrs the given miner announces
+func (a *API) MinerGetMultiaddrs(ctx context.Context, minerAddr address.Address) ([]ma.Multiaddr, error) {
+	return MinerGetMultiaddrs(ctx, a, minerAddr)
+}
+
 // MinerSetPrice configures the price of storage. See implementation for details.
 func (a *API) MinerSetPrice(ctx context.Context, from address.Address, miner address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, price *types.AttoFIL, expiry *big.Int) (MinerSetPriceResponse, error) {
 	return MinerSetPrice(ctx, a, from, miner, gasPrice, gasLimit, price, expiry)
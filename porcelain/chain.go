@@ -2,9 +2,12 @@ package porcelain
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/pkg/errors"
 
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/config"
 	"github.com/filecoin-project/go-filecoin/sampling"
 	"github.com/filecoin-project/go-filecoin/types"
 )
@@ -13,6 +16,13 @@ type chBlockHeightPlumbing interface {
 	ChainLs(ctx context.Context) <-chan interface{}
 }
 
+type chCheckpointPlumbing interface {
+	ChainAddCheckpoint(cp chain.Checkpoint) error
+	ChainGetTipSet(ctx context.Context, key types.SortedCidSet) (types.TipSet, error)
+	ConfigGet(dottedPath string) (interface{}, error)
+	ConfigSet(dottedPath string, paramJSON string) error
+}
+
 type chSampleRandomnessPlumbing interface {
 	GetRecentAncestorsOfHeaviestChain(ctx context.Context, descendantBlockHeight *types.BlockHeight) ([]types.TipSet, error)
 }
@@ -44,3 +54,51 @@ func SampleChainRandomness(ctx context.Context, plumbing chSampleRandomnessPlumb
 
 	return sampling.SampleChainRandomness(sampleHeight, tipSetBuffer)
 }
+
+// ChainCheckpoint pins the tipset with the given key as a checkpoint the
+// chains synced must include, and saves it in the config so that it is kept
+// across restarts. The height of the tipset is read from the chain store, or
+// is height if the tipset is not there. It returns the checkpoint added.
+func ChainCheckpoint(ctx context.Context, plumbing chCheckpointPlumbing, key types.SortedCidSet, height *uint64) (chain.Checkpoint, error) {
+	cp := chain.Checkpoint{Key: key}
+	ts, err := plumbing.ChainGetTipSet(ctx, key)
+	switch {
+	case err == nil:
+		tsHeight, err := ts.Height()
+		if err != nil {
+			return chain.Checkpoint{}, err
+		}
+		if height != nil && *height != tsHeight {
+			return chain.Checkpoint{}, errors.Errorf("tipset %s is at height %d, not %d", key.String(), tsHeight, *height)
+		}
+		cp.Height = tsHeight
+	case height != nil:
+		cp.Height = *height
+	default:
+		return chain.Checkpoint{}, errors.Wrapf(err, "tipset %s not in the chain store, its height must be given", key.String())
+	}
+
+	if err := plumbing.ChainAddCheckpoint(cp); err != nil {
+		return chain.Checkpoint{}, err
+	}
+
+	stored, err := plumbing.ConfigGet("chain.checkpoints")
+	if err != nil {
+		return chain.Checkpoint{}, err
+	}
+	cps, _ := stored.([]config.Checkpoint)
+	for _, c := range cps {
+		if c.Height == cp.Height && c.Tipset.Equals(cp.Key) {
+			return cp, nil
+		}
+	}
+	cps = append(cps, config.Checkpoint{Height: cp.Height, Tipset: cp.Key})
+	cpsJSON, err := json.Marshal(cps)
+	if err != nil {
+		return chain.Checkpoint{}, err
+	}
+	if err := plumbing.ConfigSet("chain.checkpoints", string(cpsJSON)); err != nil {
+		return chain.Checkpoint{}, errors.Wrap(err, "failed to save checkpoint in config")
+	}
+	return cp, nil
+}
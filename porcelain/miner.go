@@ -9,8 +9,10 @@ import (
 	"github.com/ipfs/go-cid"
 	cbor "github.com/ipfs/go-ipld-cbor"
 	"github.com/libp2p/go-libp2p-peer"
+	ma "github.com/multiformats/go-multiaddr"
 	"github.com/pkg/errors"
 
+	"github.com/filecoin-project/go-filecoin/abi"
 	minerActor "github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
 	"github.com/filecoin-project/go-filecoin/address"
@@ -344,3 +346,23 @@ func MinerGetPeerID(ctx context.Context, plumbing mgpidAPI, minerAddr address.Ad
 	}
 	return pid, nil
 }
+
+// mgmaAPI is the subset of the plumbing.API that MinerGetMultiaddrs uses.
+type mgmaAPI interface {
+	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error)
+}
+
+// MinerGetMultiaddrs queries for the multiaddrs the given miner announces it
+// can be dialed at
+func MinerGetMultiaddrs(ctx context.Context, plumbing mgmaAPI, minerAddr address.Address) ([]ma.Multiaddr, error) {
+	res, _, err := plumbing.MessageQuery(ctx, address.Undef, minerAddr, "getMultiaddrs")
+	if err != nil {
+		return nil, err
+	}
+
+	val, err := abi.Deserialize(res[0], abi.Multiaddrs)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not decode to multiaddrs from message-bytes")
+	}
+	return val.Val.([]ma.Multiaddr), nil
+}
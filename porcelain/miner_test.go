@@ -9,7 +9,9 @@ import (
 	"github.com/ipfs/go-cid"
 	cbor "github.com/ipfs/go-ipld-cbor"
 	"github.com/libp2p/go-libp2p-peer"
+	ma "github.com/multiformats/go-multiaddr"
 
+	"github.com/filecoin-project/go-filecoin/abi"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/exec"
@@ -487,6 +489,28 @@ func TestMinerGetPeerID(t *testing.T) {
 	assert.Equal(expected, id)
 }
 
+type minerGetMultiaddrsPlumbing struct {
+	addrs []ma.Multiaddr
+}
+
+func (mgmp *minerGetMultiaddrsPlumbing) MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error) {
+	out, err := (&abi.Value{Type: abi.Multiaddrs, Val: mgmp.addrs}).Serialize()
+	if err != nil {
+		return nil, nil, err
+	}
+	return [][]byte{out}, nil, nil
+}
+
+func TestMinerGetMultiaddrs(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	expected := []ma.Multiaddr{ma.StringCast("/ip4/1.2.3.4/tcp/6000")}
+	addrs, err := MinerGetMultiaddrs(context.Background(), &minerGetMultiaddrsPlumbing{expected}, address.TestAddress2)
+	require.NoError(err)
+	assert.Equal(expected, addrs)
+}
+
 type minerGetAskPlumbing struct{}
 
 func (mgop *minerGetAskPlumbing) MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error) {
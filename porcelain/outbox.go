@@ -0,0 +1,89 @@
+package porcelain
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/core"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// InclusionEstimate is a rough estimate of the chances of an outbox message
+// being included in a block, based on its gas price.
+type InclusionEstimate string
+
+const (
+	// InclusionLikely means the gas price of the message is at least the
+	// median gas price of recently included messages.
+	InclusionLikely = InclusionEstimate("likely")
+	// InclusionPossible means the gas price of the message is among the
+	// lower gas prices of recently included messages.
+	InclusionPossible = InclusionEstimate("possible")
+	// InclusionUnlikely means the gas price of the message is below almost
+	// all the gas prices of recently included messages. Replacing the message
+	// with a higher gas price may unstick it.
+	InclusionUnlikely = InclusionEstimate("unlikely")
+)
+
+// Percentiles of the gas prices of recently included messages separating
+// inclusion estimates.
+const (
+	inclusionLikelyPercentile   = 50
+	inclusionPossiblePercentile = 10
+)
+
+// OutboxMessage is a message of the outbox with its status.
+type OutboxMessage struct {
+	core.QueuedMessage
+	// Age is the number of rounds since the message was enqueued.
+	Age uint64
+	// Broadcasts is the number of times the message was published.
+	Broadcasts uint64
+	Inclusion  InclusionEstimate
+}
+
+type olPlumbing interface {
+	ChainHead(ctx context.Context) types.TipSet
+	MessageEstimateGasPrice(ctx context.Context, percentile int) (types.AttoFIL, error)
+	OutboxQueueLs(sender address.Address) []*core.QueuedMessage
+}
+
+// OutboxLs lists the messages in the outbox for an address, with their age,
+// the number of times they were published and an estimate of their chances
+// of being included.
+func OutboxLs(ctx context.Context, plumbing olPlumbing, sender address.Address) ([]*OutboxMessage, error) {
+	height, err := plumbing.ChainHead(ctx).Height()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get chain height")
+	}
+	likelyPrice, err := plumbing.MessageEstimateGasPrice(ctx, inclusionLikelyPercentile)
+	if err != nil {
+		return nil, err
+	}
+	possiblePrice, err := plumbing.MessageEstimateGasPrice(ctx, inclusionPossiblePercentile)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*OutboxMessage
+	for _, qm := range plumbing.OutboxQueueLs(sender) {
+		om := &OutboxMessage{
+			QueuedMessage: *qm,
+			Broadcasts:    1 + qm.Republished,
+			Inclusion:     InclusionUnlikely,
+		}
+		if height > qm.Stamp {
+			om.Age = height - qm.Stamp
+		}
+		switch {
+		case qm.Msg.GasPrice.GreaterEqual(&likelyPrice):
+			om.Inclusion = InclusionLikely
+		case qm.Msg.GasPrice.GreaterEqual(&possiblePrice):
+			om.Inclusion = InclusionPossible
+		}
+		out = append(out, om)
+	}
+	return out, nil
+}
@@ -0,0 +1,75 @@
+package porcelain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/core"
+	"github.com/filecoin-project/go-filecoin/porcelain"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+type fakeOutboxLsPlumbing struct {
+	head   types.TipSet
+	prices map[int]types.AttoFIL
+	queue  []*core.QueuedMessage
+}
+
+func (p *fakeOutboxLsPlumbing) ChainHead(ctx context.Context) types.TipSet {
+	return p.head
+}
+
+func (p *fakeOutboxLsPlumbing) MessageEstimateGasPrice(ctx context.Context, percentile int) (types.AttoFIL, error) {
+	return p.prices[percentile], nil
+}
+
+func (p *fakeOutboxLsPlumbing) OutboxQueueLs(sender address.Address) []*core.QueuedMessage {
+	return p.queue
+}
+
+func TestOutboxLs(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	keys := types.MustGenerateKeyInfo(1, types.GenerateKeyInfoSeed())
+	mm := types.NewMessageMaker(t, keys)
+	sender := mm.Addresses()[0]
+
+	withPrice := func(nonce uint64, price int64) *types.SignedMessage {
+		mm.DefaultGasPrice = types.NewGasPrice(price)
+		return mm.NewSignedMessage(sender, nonce)
+	}
+	plumbing := &fakeOutboxLsPlumbing{
+		head: th.MustNewTipSet(&types.Block{Height: types.Uint64(110)}),
+		prices: map[int]types.AttoFIL{
+			50: types.NewGasPrice(10),
+			10: types.NewGasPrice(5),
+		},
+		queue: []*core.QueuedMessage{
+			{Msg: withPrice(0, 10), Stamp: 100},
+			{Msg: withPrice(1, 7), Stamp: 105, Republished: 2, RepublishedAt: 108},
+			{Msg: withPrice(2, 1), Stamp: 110},
+		},
+	}
+
+	msgs, err := porcelain.OutboxLs(context.Background(), plumbing, sender)
+	require.NoError(err)
+	require.Len(msgs, 3)
+
+	assert.Equal(uint64(10), msgs[0].Age)
+	assert.Equal(uint64(1), msgs[0].Broadcasts)
+	assert.Equal(porcelain.InclusionLikely, msgs[0].Inclusion)
+
+	assert.Equal(uint64(5), msgs[1].Age)
+	assert.Equal(uint64(3), msgs[1].Broadcasts)
+	assert.Equal(porcelain.InclusionPossible, msgs[1].Inclusion)
+
+	assert.Equal(uint64(0), msgs[2].Age)
+	assert.Equal(porcelain.InclusionUnlikely, msgs[2].Inclusion)
+}
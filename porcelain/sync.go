@@ -0,0 +1,32 @@
+package porcelain
+
+import (
+	"context"
+	"time"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+)
+
+// syncWaitPollPeriod is the period at which SyncWait checks the sync status.
+var syncWaitPollPeriod = time.Second
+
+type swPlumbing interface {
+	SyncStatus() chain.SyncStatus
+}
+
+// SyncWait waits until the syncer has no more tipsets to sync and returns
+// its status.
+func SyncWait(ctx context.Context, plumbing swPlumbing) (chain.SyncStatus, error) {
+	for {
+		status := plumbing.SyncStatus()
+		if !status.Syncing() {
+			return status, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return status, ctx.Err()
+		case <-time.After(syncWaitPollPeriod):
+		}
+	}
+}
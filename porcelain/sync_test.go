@@ -0,0 +1,48 @@
+package porcelain_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/porcelain"
+)
+
+type fakeSyncWaitPlumbing struct {
+	statuses []chain.SyncStatus
+}
+
+func (p *fakeSyncWaitPlumbing) SyncStatus() chain.SyncStatus {
+	status := p.statuses[0]
+	if len(p.statuses) > 1 {
+		p.statuses = p.statuses[1:]
+	}
+	return status
+}
+
+func TestSyncWait(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	syncing := chain.SyncStatus{Targets: []chain.SyncTarget{{Height: 10}}, ValidatedHeight: 5}
+
+	t.Run("returns once synced", func(t *testing.T) {
+		plumbing := &fakeSyncWaitPlumbing{[]chain.SyncStatus{syncing, {ValidatedHeight: 10}}}
+		status, err := porcelain.SyncWait(context.Background(), plumbing)
+		require.NoError(err)
+		assert.Equal(uint64(10), status.ValidatedHeight)
+	})
+
+	t.Run("stops when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		status, err := porcelain.SyncWait(ctx, &fakeSyncWaitPlumbing{[]chain.SyncStatus{syncing}})
+		assert.Error(err)
+		assert.True(status.Syncing())
+	})
+}
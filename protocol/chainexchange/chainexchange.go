@@ -0,0 +1,266 @@
+package chainexchange
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	logging "github.com/ipfs/go-log"
+	host "github.com/libp2p/go-libp2p-host"
+	net "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"github.com/pkg/errors"
+
+	cbu "github.com/filecoin-project/go-filecoin/cborutil"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func init() {
+	cbor.RegisterCborType(Request{})
+	cbor.RegisterCborType(Response{})
+}
+
+// protocol is the libp2p protocol identifier for the chain exchange protocol.
+const protocol = "/fil/chainexchange/1.0.0"
+
+// MaxRequestLength is the maximum number of tipsets served for a single request.
+const MaxRequestLength = 200
+
+// requestTimeout bounds the time spent on a single request to a peer.
+const requestTimeout = 30 * time.Second
+
+var log = logging.Logger("/fil/chainexchange")
+
+// Status is the status of a chain exchange response.
+type Status uint64
+
+const (
+	// StatusOK means the response holds the requested tipsets, or as many as
+	// the responder has or is willing to send.
+	StatusOK = Status(iota)
+	// StatusNotFound means the responder does not have the start tipset.
+	StatusNotFound
+	// StatusBadRequest means the request could not be parsed or is invalid.
+	StatusBadRequest
+	// StatusInternalError means the responder failed to read its chain.
+	StatusInternalError
+)
+
+// Request asks for a range of tipsets, starting at the tipset with the given
+// block cids and going back through its ancestors.
+type Request struct {
+	Start  []cid.Cid
+	Length uint64
+	// IncludeMessages is false to only get block headers. Blocks without
+	// their messages do not match their cids, so such responses cannot be
+	// verified and are only useful as hints.
+	IncludeMessages bool
+}
+
+// Response holds the blocks of the requested tipsets, from the start tipset
+// back to its oldest ancestor sent.
+type Response struct {
+	Status  Status
+	Message string
+	TipSets [][]*types.Block
+}
+
+type blockGetter interface {
+	GetBlock(ctx context.Context, c cid.Cid) (*types.Block, error)
+}
+
+// Exchange implements the chain exchange protocol, which lets a node fetch a
+// range of tipsets from a peer in a single round trip rather than resolving
+// them one at a time over bitswap. It both serves requests from its chain
+// and sends requests to the connected peers.
+type Exchange struct {
+	host  host.Host
+	chain blockGetter
+
+	// lk protects next.
+	lk sync.Mutex
+	// next is the index of the peer to try first for the next request, so
+	// that requests are spread across peers.
+	next int
+}
+
+// New creates a new instance of the chain exchange protocol and registers it
+// to the given host, serving tipsets from the given chain.
+func New(h host.Host, chain blockGetter) *Exchange {
+	x := &Exchange{
+		host:  h,
+		chain: chain,
+	}
+	h.SetStreamHandler(protocol, x.handleNewStream)
+	return x
+}
+
+func (x *Exchange) handleNewStream(s net.Stream) {
+	defer s.Close() // nolint: errcheck
+
+	from := s.Conn().RemotePeer()
+
+	var req Request
+	if err := cbu.NewMsgReader(s).ReadMsg(&req); err != nil {
+		log.Warningf("bad chain exchange request from peer %s: %s", from, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	resp := x.processRequest(ctx, &req)
+	if err := cbu.NewMsgWriter(s).WriteMsg(resp); err != nil {
+		log.Warningf("failed to send chain exchange response to peer %s: %s", from, err)
+	}
+}
+
+func (x *Exchange) processRequest(ctx context.Context, req *Request) *Response {
+	if len(req.Start) == 0 || req.Length == 0 {
+		return &Response{Status: StatusBadRequest, Message: "empty start tipset or length"}
+	}
+	length := req.Length
+	if length > MaxRequestLength {
+		length = MaxRequestLength
+	}
+
+	var tipSets [][]*types.Block
+	next := types.NewSortedCidSet(req.Start...)
+	for uint64(len(tipSets)) < length && !next.Empty() {
+		var blks []*types.Block
+		for it := next.Iter(); !it.Complete(); it.Next() {
+			blk, err := x.chain.GetBlock(ctx, it.Value())
+			if err != nil {
+				if len(tipSets) == 0 {
+					return &Response{Status: StatusNotFound, Message: err.Error()}
+				}
+				// Send what we have rather than nothing.
+				return &Response{Status: StatusOK, TipSets: tipSets}
+			}
+			if !req.IncludeMessages {
+				header := *blk
+				header.Messages = nil
+				header.MessageReceipts = nil
+				blk = &header
+			}
+			blks = append(blks, blk)
+		}
+		tipSets = append(tipSets, blks)
+		next = blks[0].Parents
+	}
+	return &Response{Status: StatusOK, TipSets: tipSets}
+}
+
+// GetTipSets requests up to count tipsets from the given peer, starting at
+// the tipset with the given key. Unless the request excludes messages, the
+// response is checked to form a chain from the key.
+func (x *Exchange) GetTipSets(ctx context.Context, p peer.ID, key types.SortedCidSet, count uint64, includeMessages bool) ([]types.TipSet, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	s, err := x.host.NewStream(ctx, p, protocol)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close() // nolint: errcheck
+
+	req := &Request{
+		Start:           key.ToSlice(),
+		Length:          count,
+		IncludeMessages: includeMessages,
+	}
+	if err := cbu.NewMsgWriter(s).WriteMsg(req); err != nil {
+		return nil, errors.Wrap(err, "failed to send request")
+	}
+
+	var resp Response
+	if err := cbu.NewMsgReader(s).ReadMsg(&resp); err != nil {
+		return nil, errors.Wrap(err, "failed to read response")
+	}
+	if resp.Status != StatusOK {
+		return nil, fmt.Errorf("peer %s failed request with status %d: %s", p, resp.Status, resp.Message)
+	}
+
+	return toTipSets(key, resp.TipSets, includeMessages)
+}
+
+// FetchTipSets requests up to count tipsets, starting at the tipset with the
+// given key, from the connected peers in turn until one of them serves it.
+func (x *Exchange) FetchTipSets(ctx context.Context, key types.SortedCidSet, count uint64) ([]types.TipSet, error) {
+	peers := x.host.Network().Peers()
+	if len(peers) == 0 {
+		return nil, errors.New("no peers to fetch tipsets from")
+	}
+
+	x.lk.Lock()
+	start := x.next
+	x.next++
+	x.lk.Unlock()
+
+	var lastErr error
+	for i := range peers {
+		p := peers[(start+i)%len(peers)]
+		tipSets, err := x.GetTipSets(ctx, p, key, count, true)
+		if err == nil {
+			return tipSets, nil
+		}
+		log.Debugf("failed to fetch tipset %s from peer %s: %s", key.String(), p, err)
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Wrapf(lastErr, "failed to fetch tipset %s from %d peers", key.String(), len(peers))
+}
+
+// toTipSets builds tipsets from the blocks of a response and, when the blocks
+// hold their messages, checks that they form a chain starting at key.
+func toTipSets(key types.SortedCidSet, blocks [][]*types.Block, verify bool) ([]types.TipSet, error) {
+	var tipSets []types.TipSet
+	expected := key
+	for _, blks := range blocks {
+		ts, err := types.NewTipSet(blks...)
+		if err != nil {
+			return nil, errors.Wrap(err, "response holds an invalid tipset")
+		}
+		if verify && !ts.ToSortedCidSet().Equals(expected) {
+			return nil, fmt.Errorf("response holds tipset %s, expected %s", ts.String(), expected.String())
+		}
+		tipSets = append(tipSets, ts)
+
+		if expected, err = ts.Parents(); err != nil {
+			return nil, err
+		}
+	}
+	if len(tipSets) == 0 {
+		return nil, errors.New("response holds no tipsets")
+	}
+	return tipSets, nil
+}
+
+// Fetcher fetches ranges of tipsets over the chain exchange protocol and
+// single tipsets from a block fetcher, such as a bitswap session.
+type Fetcher struct {
+	*Exchange
+	blocks blockFetcher
+}
+
+type blockFetcher interface {
+	GetBlocks(context.Context, []cid.Cid) ([]*types.Block, error)
+}
+
+// NewFetcher returns a Fetcher using the given exchange and block fetcher.
+func NewFetcher(x *Exchange, blocks blockFetcher) *Fetcher {
+	return &Fetcher{
+		Exchange: x,
+		blocks:   blocks,
+	}
+}
+
+// GetBlocks fetches the blocks with the given cids from the block fetcher.
+func (f *Fetcher) GetBlocks(ctx context.Context, cids []cid.Cid) ([]*types.Block, error) {
+	return f.blocks.GetBlocks(ctx, cids)
+}
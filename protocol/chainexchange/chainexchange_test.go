@@ -0,0 +1,122 @@
+package chainexchange
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+type fakeChain map[cid.Cid]*types.Block
+
+func (fc fakeChain) GetBlock(ctx context.Context, c cid.Cid) (*types.Block, error) {
+	blk, ok := fc[c]
+	if !ok {
+		return nil, fmt.Errorf("no block %s", c)
+	}
+	return blk, nil
+}
+
+// makeChain returns a chain of single block tipsets of the given length, from
+// the genesis to the head.
+func makeChain(length int) (fakeChain, []types.TipSet) {
+	fc := make(fakeChain)
+	var tipSets []types.TipSet
+	var parents types.SortedCidSet
+	for i := 0; i < length; i++ {
+		blk := &types.Block{
+			Height:  types.Uint64(i),
+			Nonce:   types.Uint64(i),
+			Parents: parents,
+		}
+		fc[blk.Cid()] = blk
+		tipSets = append(tipSets, th.MustNewTipSet(blk))
+		parents = types.NewSortedCidSet(blk.Cid())
+	}
+	return fc, tipSets
+}
+
+func TestChainExchange(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn, err := mocknet.WithNPeers(ctx, 2)
+	require.NoError(err)
+	require.NoError(mn.LinkAll())
+	require.NoError(mn.ConnectAllButSelf())
+
+	fc, tipSets := makeChain(5)
+	head := tipSets[4]
+	New(mn.Hosts()[0], fc)
+	x := New(mn.Hosts()[1], make(fakeChain))
+
+	t.Run("fetches a range of tipsets", func(t *testing.T) {
+		got, err := x.FetchTipSets(ctx, head.ToSortedCidSet(), 3)
+		require.NoError(err)
+		assert.Equal([]types.TipSet{tipSets[4], tipSets[3], tipSets[2]}, got)
+	})
+
+	t.Run("stops at the genesis", func(t *testing.T) {
+		got, err := x.FetchTipSets(ctx, head.ToSortedCidSet(), 10)
+		require.NoError(err)
+		assert.Len(got, 5)
+	})
+
+	t.Run("fails on unknown tipset", func(t *testing.T) {
+		unknown := types.NewSortedCidSet((&types.Block{Nonce: 42}).Cid())
+		_, err := x.FetchTipSets(ctx, unknown, 3)
+		assert.Error(err)
+	})
+}
+
+func TestProcessRequestHeadersOnly(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	fc, tipSets := makeChain(2)
+	mockSigner, _ := types.NewMockSignersAndKeyInfo(1)
+	msg := types.NewSignedMessageForTestGetter(mockSigner)()
+	blk := &types.Block{
+		Height:   2,
+		Parents:  tipSets[1].ToSortedCidSet(),
+		Messages: []*types.SignedMessage{msg},
+	}
+	fc[blk.Cid()] = blk
+
+	x := &Exchange{chain: fc}
+	resp := x.processRequest(context.Background(), &Request{Start: []cid.Cid{blk.Cid()}, Length: 3})
+	assert.Equal(StatusOK, resp.Status)
+	assert.Len(resp.TipSets, 3)
+	assert.Empty(resp.TipSets[0][0].Messages)
+	// The served chain is left untouched.
+	assert.Len(blk.Messages, 1)
+}
+
+func TestToTipSetsChecksChain(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	_, tipSets := makeChain(3)
+	blocks := [][]*types.Block{tipSets[2].ToSlice(), tipSets[0].ToSlice()}
+
+	_, err := toTipSets(tipSets[2].ToSortedCidSet(), blocks, true)
+	assert.Error(err)
+
+	_, err = toTipSets(tipSets[1].ToSortedCidSet(), blocks[:1], true)
+	assert.Error(err)
+
+	got, err := toTipSets(tipSets[2].ToSortedCidSet(), blocks[:1], true)
+	assert.NoError(err)
+	assert.Equal([]types.TipSet{tipSets[2]}, got)
+}
@@ -11,6 +11,8 @@ import (
 	host "github.com/libp2p/go-libp2p-host"
 	net "github.com/libp2p/go-libp2p-net"
 	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	protocol "github.com/libp2p/go-libp2p-protocol"
 	ma "github.com/multiformats/go-multiaddr"
 
 	cbu "github.com/filecoin-project/go-filecoin/cborutil"
@@ -19,29 +21,146 @@ import (
 
 func init() {
 	cbor.RegisterCborType(Message{})
+	cbor.RegisterCborType(legacyMessage{})
 }
 
-// Protocol is the libp2p protocol identifier for the hello protocol.
-const protocol = "/fil/hello/1.0.0"
+// protocolV1 is the libp2p protocol identifier of the legacy hello protocol,
+// whose messages are legacyMessages. Legacy peers fail to decode fields they
+// don't know, so they are only ever sent legacyMessages.
+const protocolV1 = "/fil/hello/1.0.0"
+
+// protocolV2 is the libp2p protocol identifier of the hello protocol from
+// version 2 on, whose messages are Messages.
+const protocolV2 = "/fil/hello/2.0.0"
+
+// ProtocolVersion is the version of the hello protocol this node speaks.
+const ProtocolVersion = uint64(2)
+
+// MinProtocolVersion is the oldest version of the hello protocol this node is
+// compatible with. Peers at older versions are disconnected.
+const MinProtocolVersion = uint64(1)
+
+// legacyProtocolVersion is the version of the peers speaking protocolV1,
+// whose messages have no ProtocolVersion.
+const legacyProtocolVersion = uint64(1)
+
+// The sub-protocols a node may report it supports.
+const (
+	ProtocolChainExchange = "chainexchange"
+	ProtocolStorage       = "storage"
+	ProtocolRetrieval     = "retrieval"
+)
+
+// Role is the role of a node in the network.
+type Role string
+
+const (
+	// RoleClient is the role of nodes storing and retrieving data.
+	RoleClient = Role("client")
+	// RoleMiner is the role of nodes mining blocks and storing data.
+	RoleMiner = Role("miner")
+	// RoleRelay is the role of nodes relaying connections for other nodes.
+	RoleRelay = Role("relay")
+)
+
+// CapabilitiesKey is the peerstore key of the capabilities peers report in
+// their hello messages.
+const CapabilitiesKey = "fil/hello/capabilities"
 
 var log = logging.Logger("/fil/hello")
 
 // Message is the data structure of a single message in the hello protocol.
 type Message struct {
+	ProtocolVersion      uint64
+	HeaviestTipSetCids   []cid.Cid
+	HeaviestTipSetHeight uint64
+	HeaviestTipSetWeight uint64
+	GenesisHash          cid.Cid
+	// Protocols are the sub-protocols the node supports.
+	Protocols []string
+	Role      Role
+	// CommitSha is the version of the code the node runs, for diagnostics.
+	CommitSha string
+}
+
+// legacyMessage is the message of the legacy hello protocol, the fields of
+// Message known to legacy peers.
+type legacyMessage struct {
 	HeaviestTipSetCids   []cid.Cid
 	HeaviestTipSetHeight uint64
 	GenesisHash          cid.Cid
 	CommitSha            string
 }
 
-type syncCallback func(from peer.ID, cids []cid.Cid, height uint64)
+// toLegacy returns the legacyMessage holding the fields of msg legacy peers
+// know.
+func (msg *Message) toLegacy() *legacyMessage {
+	return &legacyMessage{
+		HeaviestTipSetCids:   msg.HeaviestTipSetCids,
+		HeaviestTipSetHeight: msg.HeaviestTipSetHeight,
+		GenesisHash:          msg.GenesisHash,
+		CommitSha:            msg.CommitSha,
+	}
+}
+
+// toMessage returns the Message of a legacy peer, with no ProtocolVersion.
+func (msg *legacyMessage) toMessage() *Message {
+	return &Message{
+		HeaviestTipSetCids:   msg.HeaviestTipSetCids,
+		HeaviestTipSetHeight: msg.HeaviestTipSetHeight,
+		GenesisHash:          msg.GenesisHash,
+		CommitSha:            msg.CommitSha,
+	}
+}
+
+// Capabilities are what a peer reported about itself in its last hello
+// message.
+type Capabilities struct {
+	ProtocolVersion uint64
+	Protocols       []string
+	Role            Role
+	CommitSha       string
+}
+
+// Supports is true when the peer reported it supports the sub-protocol.
+func (c *Capabilities) Supports(protocol string) bool {
+	for _, p := range c.Protocols {
+		if p == protocol {
+			return true
+		}
+	}
+	return false
+}
+
+// PeerCapabilities returns the capabilities p reported in its last hello
+// message, or pstore.ErrNotFound if p did not send one.
+func PeerCapabilities(ps pstore.Peerstore, p peer.ID) (*Capabilities, error) {
+	v, err := ps.Get(p, CapabilitiesKey)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := v.(*Capabilities)
+	if !ok {
+		return nil, fmt.Errorf("unexpected capabilities type %T", v)
+	}
+	return c, nil
+}
+
+type syncCallback func(from peer.ID, cids []cid.Cid, height uint64, weight uint64)
+
+type invalidCallback func(from peer.ID, err error)
 
 type getTipSetFunc func() types.TipSet
 
+type getWeightFunc func(ctx context.Context, ts types.TipSet) (uint64, error)
+
+type getCapabilitiesFunc func() (Role, []string)
+
 // Handler implements the 'Hello' protocol handler. Upon connecting to a new
 // node, we send them a message containing some information about the state of
-// our chain, and receive the same information from them. This is used to
-// initiate a chainsync and detect connections to forks.
+// our chain and our capabilities, and receive the same information from them.
+// This is used to initiate a chainsync, detect connections to forks and
+// incompatible peers, and tell other subsystems what peers can do.
 type Handler struct {
 	host host.Host
 
@@ -50,26 +169,45 @@ type Handler struct {
 	// chainSyncCB is called when new peers tell us about their chain
 	chainSyncCB syncCallback
 
+	// invalidCB, if not nil, is called when peers send invalid hellos
+	invalidCB invalidCallback
+
 	// getHeaviestTipSet is used to retrieve the current heaviest tipset
 	// for filling out our hello messages.
 	getHeaviestTipSet getTipSetFunc
 
+	// getWeight, if not nil, computes the weight of the heaviest tipset.
+	getWeight getWeightFunc
+
+	// getCapabilities, if not nil, returns the role of the node and the
+	// sub-protocols it supports.
+	getCapabilities getCapabilitiesFunc
+
+	// version is the protocol version we speak, ProtocolVersion except in
+	// tests simulating legacy peers.
+	version   uint64
 	net       string
 	commitSha string
 }
 
 // New creates a new instance of the hello protocol and registers it to
-// the given host, with the provided callbacks.
-func New(h host.Host, gen cid.Cid, syncCallback syncCallback, getHeaviestTipSet getTipSetFunc, net string, commitSha string) *Handler {
+// the given host, with the provided callbacks. invalidCallback, getWeight and
+// getCapabilities may be nil.
+func New(h host.Host, gen cid.Cid, syncCallback syncCallback, invalidCallback invalidCallback, getHeaviestTipSet getTipSetFunc, getWeight getWeightFunc, getCapabilities getCapabilitiesFunc, net string, commitSha string) *Handler {
 	hello := &Handler{
 		host:              h,
 		genesis:           gen,
 		chainSyncCB:       syncCallback,
+		invalidCB:         invalidCallback,
 		getHeaviestTipSet: getHeaviestTipSet,
+		getWeight:         getWeight,
+		getCapabilities:   getCapabilities,
+		version:           ProtocolVersion,
 		net:               net,
 		commitSha:         commitSha,
 	}
-	h.SetStreamHandler(protocol, hello.handleNewStream)
+	h.SetStreamHandler(protocolV1, hello.handleNewStream)
+	h.SetStreamHandler(protocolV2, hello.handleNewStream)
 
 	// register for connection notifications
 	h.Network().Notify((*helloNotify)(hello))
@@ -82,19 +220,24 @@ func (h *Handler) handleNewStream(s net.Stream) {
 
 	from := s.Conn().RemotePeer()
 
-	var hello Message
-	if err := cbu.NewMsgReader(s).ReadMsg(&hello); err != nil {
+	hello, err := readHelloMessage(s)
+	if err != nil {
 		log.Warningf("bad hello message from peer %s: %s", from, err)
+		h.reportInvalid(from, err)
 		return
 	}
 
-	switch err := h.processHelloMessage(from, &hello); err {
+	err = h.processHelloMessage(from, hello)
+	if err == ErrBadGenesis || err == ErrWrongVersion {
+		h.reportInvalid(from, err)
+	}
+	switch err {
 	case ErrBadGenesis:
 		log.Warningf("genesis cid: %s does not match: %s, disconnecting from peer: %s", &hello.GenesisHash, h.genesis, from)
 		s.Conn().Close() // nolint: errcheck
 		return
 	case ErrWrongVersion:
-		log.Errorf("code not at same version: peer has version %s, daemon has version %s, disconnecting from peer: %s", hello.CommitSha, h.commitSha, from)
+		log.Errorf("incompatible hello protocol: peer has version %d (commit %s), daemon has version %d (commit %s), disconnecting from peer: %s", hello.ProtocolVersion, hello.CommitSha, h.version, h.commitSha, from)
 		s.Conn().Close() // nolint: errcheck
 		return
 	case nil: // ok, noop
@@ -103,49 +246,113 @@ func (h *Handler) handleNewStream(s net.Stream) {
 	}
 }
 
+// readHelloMessage reads the message of the version of the protocol
+// negotiated on s.
+func readHelloMessage(s net.Stream) (*Message, error) {
+	if s.Protocol() == protocolV1 {
+		var legacy legacyMessage
+		if err := cbu.NewMsgReader(s).ReadMsg(&legacy); err != nil {
+			return nil, err
+		}
+		return legacy.toMessage(), nil
+	}
+	var msg Message
+	if err := cbu.NewMsgReader(s).ReadMsg(&msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+func (h *Handler) reportInvalid(from peer.ID, err error) {
+	if h.invalidCB != nil {
+		h.invalidCB(from, err)
+	}
+}
+
 // ErrBadGenesis is the error returned when a mismatch in genesis blocks happens.
 var ErrBadGenesis = fmt.Errorf("bad genesis block")
 
-// ErrWrongVersion is the error returned when a mismatch in the code version happens.
-var ErrWrongVersion = fmt.Errorf("code version mismatch")
+// ErrWrongVersion is the error returned when a peer speaks an incompatible
+// version of the hello protocol, or runs another version of the code on a
+// devnet without speaking a version of the protocol.
+var ErrWrongVersion = fmt.Errorf("hello protocol version mismatch")
 
 func (h *Handler) processHelloMessage(from peer.ID, msg *Message) error {
 	if !msg.GenesisHash.Equals(h.genesis) {
 		return ErrBadGenesis
 	}
-	if (h.net == "devnet-test" || h.net == "devnet-user") && msg.CommitSha != h.commitSha {
+	version := msg.ProtocolVersion
+	if version == 0 {
+		version = legacyProtocolVersion
+		// Legacy peers can't be told apart by protocol version, so devnets,
+		// whose nodes all run the latest code, keep requiring them to run
+		// the same code as this node.
+		if (h.net == "devnet-test" || h.net == "devnet-user") && msg.CommitSha != h.commitSha {
+			return ErrWrongVersion
+		}
+	}
+	if version < MinProtocolVersion {
 		return ErrWrongVersion
 	}
 
-	h.chainSyncCB(from, msg.HeaviestTipSetCids, msg.HeaviestTipSetHeight)
+	err := h.host.Peerstore().Put(from, CapabilitiesKey, &Capabilities{
+		ProtocolVersion: version,
+		Protocols:       msg.Protocols,
+		Role:            msg.Role,
+		CommitSha:       msg.CommitSha,
+	})
+	if err != nil {
+		log.Warningf("failed to store capabilities of peer %s: %s", from, err)
+	}
+
+	h.chainSyncCB(from, msg.HeaviestTipSetCids, msg.HeaviestTipSetHeight, msg.HeaviestTipSetWeight)
 	return nil
 }
 
-func (h *Handler) getOurHelloMessage() *Message {
+func (h *Handler) getOurHelloMessage(ctx context.Context) *Message {
 	heaviest := h.getHeaviestTipSet()
 	height, err := heaviest.Height()
 	if err != nil {
 		panic("somehow heaviest tipset is empty")
 	}
 
-	return &Message{
+	msg := &Message{
+		ProtocolVersion:      h.version,
 		GenesisHash:          h.genesis,
 		HeaviestTipSetCids:   heaviest.ToSortedCidSet().ToSlice(),
 		HeaviestTipSetHeight: height,
 		CommitSha:            h.commitSha,
 	}
+	if h.getWeight != nil {
+		// A peer can still sync our chain without its weight.
+		if msg.HeaviestTipSetWeight, err = h.getWeight(ctx, heaviest); err != nil {
+			log.Warningf("failed to compute weight of heaviest tipset: %s", err)
+		}
+	}
+	if h.getCapabilities != nil {
+		msg.Role, msg.Protocols = h.getCapabilities()
+	}
+	return msg
 }
 
 func (h *Handler) sayHello(ctx context.Context, p peer.ID) error {
-	s, err := h.host.NewStream(ctx, p, protocol)
+	protocols := []protocol.ID{protocolV2, protocolV1}
+	if h.version < ProtocolVersion {
+		protocols = protocols[1:]
+	}
+	// Peers speaking both versions negotiate protocolV2, legacy peers
+	// protocolV1.
+	s, err := h.host.NewStream(ctx, p, protocols...)
 	if err != nil {
 		return err
 	}
 	defer s.Close() // nolint: errcheck
 
-	msg := h.getOurHelloMessage()
-
-	return cbu.NewMsgWriter(s).WriteMsg(&msg)
+	msg := h.getOurHelloMessage(ctx)
+	if s.Protocol() == protocolV1 {
+		return cbu.NewMsgWriter(s).WriteMsg(msg.toLegacy())
+	}
+	return cbu.NewMsgWriter(s).WriteMsg(msg)
 }
 
 // New peer connection notifications
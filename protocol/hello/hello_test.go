@@ -21,8 +21,8 @@ type mockSyncCallback struct {
 	mock.Mock
 }
 
-func (msb *mockSyncCallback) SyncCallback(p peer.ID, cids []cid.Cid, h uint64) {
-	msb.Called(p, cids, h)
+func (msb *mockSyncCallback) SyncCallback(p peer.ID, cids []cid.Cid, h uint64, w uint64) {
+	msb.Called(p, cids, h, w)
 }
 
 type mockHeaviestGetter struct {
@@ -33,6 +33,12 @@ func (mhg *mockHeaviestGetter) getHeaviestTipSet() types.TipSet {
 	return mhg.heaviest
 }
 
+// tenTimesHeight is a getWeightFunc weighing tipsets ten times their height.
+func tenTimesHeight(ctx context.Context, ts types.TipSet) (uint64, error) {
+	h, err := ts.Height()
+	return 10 * h, err
+}
+
 func TestHelloHandshake(t *testing.T) {
 	t.Parallel()
 	require := require.New(t)
@@ -54,11 +60,11 @@ func TestHelloHandshake(t *testing.T) {
 	msc1, msc2 := new(mockSyncCallback), new(mockSyncCallback)
 	hg1, hg2 := &mockHeaviestGetter{heavy1}, &mockHeaviestGetter{heavy2}
 
-	New(a, genesisA.Cid(), msc1.SyncCallback, hg1.getHeaviestTipSet, "", "")
-	New(b, genesisA.Cid(), msc2.SyncCallback, hg2.getHeaviestTipSet, "", "")
+	New(a, genesisA.Cid(), msc1.SyncCallback, nil, hg1.getHeaviestTipSet, tenTimesHeight, nil, "", "")
+	New(b, genesisA.Cid(), msc2.SyncCallback, nil, hg2.getHeaviestTipSet, tenTimesHeight, nil, "", "")
 
-	msc1.On("SyncCallback", b.ID(), heavy2.ToSortedCidSet().ToSlice(), uint64(3)).Return()
-	msc2.On("SyncCallback", a.ID(), heavy1.ToSortedCidSet().ToSlice(), uint64(2)).Return()
+	msc1.On("SyncCallback", b.ID(), heavy2.ToSortedCidSet().ToSlice(), uint64(3), uint64(30)).Return()
+	msc2.On("SyncCallback", a.ID(), heavy1.ToSortedCidSet().ToSlice(), uint64(2), uint64(20)).Return()
 
 	require.NoError(mn.LinkAll())
 	require.NoError(mn.ConnectAllButSelf())
@@ -109,11 +115,11 @@ func TestHelloBadGenesis(t *testing.T) {
 	msc1, msc2 := new(mockSyncCallback), new(mockSyncCallback)
 	hg1, hg2 := &mockHeaviestGetter{heavy1}, &mockHeaviestGetter{heavy2}
 
-	New(a, genesisA.Cid(), msc1.SyncCallback, hg1.getHeaviestTipSet, "", "")
-	New(b, genesisB.Cid(), msc2.SyncCallback, hg2.getHeaviestTipSet, "", "")
+	New(a, genesisA.Cid(), msc1.SyncCallback, nil, hg1.getHeaviestTipSet, nil, nil, "", "")
+	New(b, genesisB.Cid(), msc2.SyncCallback, nil, hg2.getHeaviestTipSet, nil, nil, "", "")
 
-	msc1.On("SyncCallback", mock.Anything, mock.Anything, mock.Anything).Return()
-	msc2.On("SyncCallback", mock.Anything, mock.Anything, mock.Anything).Return()
+	msc1.On("SyncCallback", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	msc2.On("SyncCallback", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
 
 	require.NoError(mn.LinkAll())
 	require.NoError(mn.ConnectAllButSelf())
@@ -124,7 +130,62 @@ func TestHelloBadGenesis(t *testing.T) {
 	msc2.AssertNumberOfCalls(t, "SyncCallback", 0)
 }
 
-func TestHelloWrongVersion(t *testing.T) {
+func TestHelloLegacyPeer(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		net        string
+		compatible bool
+	}{
+		{net: "", compatible: true},
+		// Legacy peers must run the same code as the node on devnets.
+		{net: "devnet-user", compatible: false},
+	} {
+		tc := tc
+		t.Run(tc.net, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			require := require.New(t)
+
+			mn, err := mocknet.WithNPeers(ctx, 2)
+			require.NoError(err)
+
+			a, b := mn.Hosts()[0], mn.Hosts()[1]
+
+			genesisA := &types.Block{Nonce: 451}
+
+			heavy := th.RequireNewTipSet(require, &types.Block{Nonce: 1000, Height: 2})
+
+			msc1, msc2 := new(mockSyncCallback), new(mockSyncCallback)
+			hg := &mockHeaviestGetter{heavy}
+
+			New(a, genesisA.Cid(), msc1.SyncCallback, nil, hg.getHeaviestTipSet, nil, nil, tc.net, "sha1")
+			msc1.On("SyncCallback", b.ID(), mock.Anything, mock.Anything, mock.Anything).Return()
+
+			// Legacy peers only speak the legacy protocol.
+			legacy := New(b, genesisA.Cid(), msc2.SyncCallback, nil, hg.getHeaviestTipSet, nil, nil, tc.net, "sha2")
+			legacy.version = legacyProtocolVersion
+			b.RemoveStreamHandler(protocolV2)
+			msc2.On("SyncCallback", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+
+			require.NoError(mn.LinkAll())
+			require.NoError(mn.ConnectAllButSelf())
+
+			time.Sleep(time.Millisecond * 50)
+
+			if tc.compatible {
+				msc1.AssertNumberOfCalls(t, "SyncCallback", 1)
+				capabilities, err := PeerCapabilities(a.Peerstore(), b.ID())
+				require.NoError(err)
+				assert.Equal(t, legacyProtocolVersion, capabilities.ProtocolVersion)
+			} else {
+				msc1.AssertNumberOfCalls(t, "SyncCallback", 0)
+			}
+		})
+	}
+}
+
+func TestHelloDifferentCommitSha(t *testing.T) {
 	t.Parallel()
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -143,30 +204,33 @@ func TestHelloWrongVersion(t *testing.T) {
 	msc1, msc2 := new(mockSyncCallback), new(mockSyncCallback)
 	hg := &mockHeaviestGetter{heavy}
 
-	New(a, genesisA.Cid(), msc1.SyncCallback, hg.getHeaviestTipSet, "devnet-user", "sha1")
-	msc1.On("SyncCallback", mock.Anything, mock.Anything, mock.Anything).Return()
+	// Peers at the same protocol version are compatible, whatever code they
+	// run, even on devnets.
+	New(a, genesisA.Cid(), msc1.SyncCallback, nil, hg.getHeaviestTipSet, nil, nil, "devnet-user", "sha1")
+	msc1.On("SyncCallback", b.ID(), mock.Anything, mock.Anything, mock.Anything).Return()
 
-	New(b, genesisA.Cid(), msc2.SyncCallback, hg.getHeaviestTipSet, "devnet-user", "sha2")
-	msc2.On("SyncCallback", mock.Anything, mock.Anything, mock.Anything).Return()
+	New(b, genesisA.Cid(), msc2.SyncCallback, nil, hg.getHeaviestTipSet, nil, nil, "devnet-user", "sha2")
+	msc2.On("SyncCallback", a.ID(), mock.Anything, mock.Anything, mock.Anything).Return()
 
 	require.NoError(mn.LinkAll())
 	require.NoError(mn.ConnectAllButSelf())
 
 	time.Sleep(time.Millisecond * 50)
 
-	msc1.AssertNumberOfCalls(t, "SyncCallback", 0)
-	msc2.AssertNumberOfCalls(t, "SyncCallback", 0)
+	msc1.AssertExpectations(t)
+	msc2.AssertExpectations(t)
 }
 
-func TestHelloWrongVersionTestDevnet(t *testing.T) {
+func TestHelloCapabilities(t *testing.T) {
 	t.Parallel()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	assert := assert.New(t)
 	require := require.New(t)
 
 	mn, err := mocknet.WithNPeers(ctx, 2)
-	assert.NoError(t, err)
+	require.NoError(err)
 
 	a, b := mn.Hosts()[0], mn.Hosts()[1]
 
@@ -176,20 +240,32 @@ func TestHelloWrongVersionTestDevnet(t *testing.T) {
 
 	msc1, msc2 := new(mockSyncCallback), new(mockSyncCallback)
 	hg := &mockHeaviestGetter{heavy}
+	minerCapabilities := func() (Role, []string) {
+		return RoleMiner, []string{ProtocolChainExchange, ProtocolStorage}
+	}
 
-	New(a, genesisA.Cid(), msc1.SyncCallback, hg.getHeaviestTipSet, "devnet-test", "sha1")
-	msc1.On("SyncCallback", mock.Anything, mock.Anything, mock.Anything).Return()
+	New(a, genesisA.Cid(), msc1.SyncCallback, nil, hg.getHeaviestTipSet, nil, nil, "", "sha1")
+	msc1.On("SyncCallback", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
 
-	New(b, genesisA.Cid(), msc2.SyncCallback, hg.getHeaviestTipSet, "devnet-test", "sha2")
-	msc2.On("SyncCallback", mock.Anything, mock.Anything, mock.Anything).Return()
+	New(b, genesisA.Cid(), msc2.SyncCallback, nil, hg.getHeaviestTipSet, nil, minerCapabilities, "", "sha2")
+	msc2.On("SyncCallback", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+
+	_, err = PeerCapabilities(a.Peerstore(), b.ID())
+	assert.Error(err)
 
 	require.NoError(mn.LinkAll())
 	require.NoError(mn.ConnectAllButSelf())
 
-	time.Sleep(time.Millisecond * 50)
-
-	msc1.AssertNumberOfCalls(t, "SyncCallback", 0)
-	msc2.AssertNumberOfCalls(t, "SyncCallback", 0)
+	var capabilities *Capabilities
+	require.NoError(th.WaitForIt(10, 50*time.Millisecond, func() (bool, error) {
+		capabilities, err = PeerCapabilities(a.Peerstore(), b.ID())
+		return err == nil, nil
+	}))
+	assert.Equal(ProtocolVersion, capabilities.ProtocolVersion)
+	assert.Equal(RoleMiner, capabilities.Role)
+	assert.Equal("sha2", capabilities.CommitSha)
+	assert.True(capabilities.Supports(ProtocolStorage))
+	assert.False(capabilities.Supports(ProtocolRetrieval))
 }
 
 func TestHelloMultiBlock(t *testing.T) {
@@ -221,11 +297,11 @@ func TestHelloMultiBlock(t *testing.T) {
 	msc1, msc2 := new(mockSyncCallback), new(mockSyncCallback)
 	hg1, hg2 := &mockHeaviestGetter{heavy1}, &mockHeaviestGetter{heavy2}
 
-	New(a, genesisA.Cid(), msc1.SyncCallback, hg1.getHeaviestTipSet, "", "")
-	New(b, genesisA.Cid(), msc2.SyncCallback, hg2.getHeaviestTipSet, "", "")
+	New(a, genesisA.Cid(), msc1.SyncCallback, nil, hg1.getHeaviestTipSet, nil, nil, "", "")
+	New(b, genesisA.Cid(), msc2.SyncCallback, nil, hg2.getHeaviestTipSet, nil, nil, "", "")
 
-	msc1.On("SyncCallback", b.ID(), heavy2.ToSortedCidSet().ToSlice(), uint64(3)).Return()
-	msc2.On("SyncCallback", a.ID(), heavy1.ToSortedCidSet().ToSlice(), uint64(2)).Return()
+	msc1.On("SyncCallback", b.ID(), heavy2.ToSortedCidSet().ToSlice(), uint64(3), uint64(0)).Return()
+	msc2.On("SyncCallback", a.ID(), heavy1.ToSortedCidSet().ToSlice(), uint64(2), uint64(0)).Return()
 
 	assert.NoError(t, mn.LinkAll())
 	assert.NoError(t, mn.ConnectAllButSelf())
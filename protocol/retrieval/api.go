@@ -6,6 +6,7 @@ import (
 
 	"github.com/ipfs/go-cid"
 	"github.com/libp2p/go-libp2p-peer"
+	ma "github.com/multiformats/go-multiaddr"
 
 	"github.com/filecoin-project/go-filecoin/address"
 )
@@ -20,7 +21,8 @@ func NewAPI(rc *Client) API {
 	return API{rc: rc}
 }
 
-// RetrievePiece retrieves bytes referenced by CID pieceCID
-func (a *API) RetrievePiece(ctx context.Context, pieceCID cid.Cid, mpid peer.ID, minerAddr address.Address) (io.ReadCloser, error) {
-	return a.rc.RetrievePiece(ctx, mpid, pieceCID)
+// RetrievePiece retrieves bytes referenced by CID pieceCID from the miner,
+// dialing it at the multiaddrs it announces if any
+func (a *API) RetrievePiece(ctx context.Context, pieceCID cid.Cid, mpid peer.ID, maddrs []ma.Multiaddr, minerAddr address.Address) (io.ReadCloser, error) {
+	return a.rc.RetrievePiece(ctx, mpid, maddrs, pieceCID)
 }
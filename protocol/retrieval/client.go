@@ -12,6 +12,8 @@ import (
 	host "github.com/libp2p/go-libp2p-host"
 	inet "github.com/libp2p/go-libp2p-net"
 	"github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	ma "github.com/multiformats/go-multiaddr"
 	"github.com/pkg/errors"
 
 	cbu "github.com/filecoin-project/go-filecoin/cborutil"
@@ -22,22 +24,34 @@ import (
 // succeed.
 const RetrievePieceChunkSize = 256 << 8
 
+// peerFinder finds the addresses of peers, e.g. in the DHT.
+type peerFinder interface {
+	FindPeer(ctx context.Context, peerID peer.ID) (pstore.PeerInfo, error)
+}
+
 // Client is a client interface to the retrieval market protocols.
 type Client struct {
-	host host.Host
-	log  logging.EventLogger
+	host   host.Host
+	finder peerFinder
+	log    logging.EventLogger
 }
 
 // NewClient produces a new Client.
-func NewClient(host host.Host, blockTime time.Duration) *Client {
+func NewClient(host host.Host, finder peerFinder, blockTime time.Duration) *Client {
 	return &Client{
-		host: host,
-		log:  logging.Logger("retrieval/client"),
+		host:   host,
+		finder: finder,
+		log:    logging.Logger("retrieval/client"),
 	}
 }
 
-// RetrievePiece connects to a miner and transfers a piece of content.
-func (sc *Client) RetrievePiece(ctx context.Context, minerPeerID peer.ID, pieceCID cid.Cid) (io.ReadCloser, error) {
+// RetrievePiece connects to a miner, at the multiaddrs it announces if any,
+// and transfers a piece of content.
+func (sc *Client) RetrievePiece(ctx context.Context, minerPeerID peer.ID, minerAddrs []ma.Multiaddr, pieceCID cid.Cid) (io.ReadCloser, error) {
+	if err := sc.connect(ctx, minerPeerID, minerAddrs); err != nil {
+		return nil, errors.Wrap(err, "failed to connect to retrieval miner")
+	}
+
 	s, err := sc.host.NewStream(ctx, minerPeerID, retrievalFreeProtocol)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create stream to retrieval miner")
@@ -83,6 +97,26 @@ func (sc *Client) RetrievePiece(ctx context.Context, minerPeerID peer.ID, pieceC
 	return buffered, nil
 }
 
+// connect connects to the miner at the given multiaddrs, falling back to the
+// addresses found by the finder. Without multiaddrs, the host looks the miner
+// up itself when opening a stream.
+func (sc *Client) connect(ctx context.Context, minerPeerID peer.ID, minerAddrs []ma.Multiaddr) error {
+	if len(minerAddrs) == 0 {
+		return nil
+	}
+	err := sc.host.Connect(ctx, pstore.PeerInfo{ID: minerPeerID, Addrs: minerAddrs})
+	if err == nil {
+		return nil
+	}
+	sc.log.Warningf("failed to connect to miner %s at its announced addresses: %s", minerPeerID, err)
+
+	pi, findErr := sc.finder.FindPeer(ctx, minerPeerID)
+	if findErr != nil {
+		return err
+	}
+	return sc.host.Connect(ctx, pi)
+}
+
 func (sc *Client) safeCloseStream(stream inet.Stream) {
 	if err := stream.Close(); err != nil {
 		log.Errorf("error closing stream: %s", err)
@@ -39,7 +39,7 @@ func TestRetrievalProtocolPieceNotFound(t *testing.T) {
 }
 
 func retrievePieceBytes(ctx context.Context, retrievalAPI *retrieval.API, data cid.Cid, minerPID peer.ID, addr address.Address) ([]byte, error) {
-	r, err := retrievalAPI.RetrievePiece(ctx, data, minerPID, addr)
+	r, err := retrievalAPI.RetrievePiece(ctx, data, minerPID, nil, addr)
 	if err != nil {
 		return nil, err
 	}
@@ -4,13 +4,16 @@ import (
 	"context"
 	"fmt"
 	"math/big"
+	"sync"
 	"time"
 
 	"github.com/ipfs/go-cid"
 	logging "github.com/ipfs/go-log"
 	"github.com/libp2p/go-libp2p-host"
 	"github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
 	"github.com/libp2p/go-libp2p-protocol"
+	ma "github.com/multiformats/go-multiaddr"
 	"github.com/multiformats/go-multistream"
 	"github.com/pkg/errors"
 
@@ -18,6 +21,8 @@ import (
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/address"
 	cbu "github.com/filecoin-project/go-filecoin/cborutil"
+	"github.com/filecoin-project/go-filecoin/net"
+	"github.com/filecoin-project/go-filecoin/plumbing/msg"
 	"github.com/filecoin-project/go-filecoin/porcelain"
 	"github.com/filecoin-project/go-filecoin/protocol/storage/storagedeal"
 	"github.com/filecoin-project/go-filecoin/types"
@@ -44,9 +49,6 @@ const (
 
 	// CreateChannelGasPrice is the gas price of the message used to create the payment channel
 	CreateChannelGasPrice = 0
-
-	// CreateChannelGasLimit is the gas limit of the message used to create the payment channel
-	CreateChannelGasLimit = 300
 )
 
 type clientPorcelainAPI interface {
@@ -58,9 +60,12 @@ type clientPorcelainAPI interface {
 	DealsLs() ([]*storagedeal.Deal, error)
 	MinerGetAsk(ctx context.Context, minerAddr address.Address, askID uint64) (miner.Ask, error)
 	MinerGetOwnerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error)
+	MinerGetMultiaddrs(ctx context.Context, minerAddr address.Address) ([]ma.Multiaddr, error)
 	MinerGetPeerID(ctx context.Context, minerAddr address.Address) (peer.ID, error)
 	types.Signer
 	NetworkPing(ctx context.Context, p peer.ID) (<-chan time.Duration, error)
+	NetworkProtectPeer(pid peer.ID, tag string)
+	NetworkUnprotectPeer(pid peer.ID, tag string) bool
 	WalletDefaultAddress() (address.Address, error)
 }
 
@@ -71,6 +76,12 @@ type Client struct {
 	host                host.Host
 	log                 logging.EventLogger
 	ProtocolRequestFunc func(ctx context.Context, protocol protocol.ID, peer peer.ID, host host.Host, request interface{}, response interface{}) error
+
+	// dealsLk protects dealsByPeer, the proposals of the deals in progress
+	// with each miner peer, whose connections are protected as long as there
+	// are any.
+	dealsLk     sync.Mutex
+	dealsByPeer map[peer.ID]map[cid.Cid]struct{}
 }
 
 // NewClient creates a new storage client.
@@ -81,6 +92,7 @@ func NewClient(blockTime time.Duration, host host.Host, api clientPorcelainAPI)
 		host:                host,
 		log:                 logging.Logger("storage/client"),
 		ProtocolRequestFunc: MakeProtocolRequest,
+		dealsByPeer:         make(map[peer.ID]map[cid.Cid]struct{}),
 	}
 	return smc
 }
@@ -95,6 +107,7 @@ func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data
 	if err != nil {
 		return nil, err
 	}
+	smc.addMinerAddrs(ctxSetup, miner, pid)
 
 	minerAlive := make(chan error, 1)
 	go func() {
@@ -161,7 +174,7 @@ func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data
 		PaymentInterval: VoucherInterval,
 		ChannelExpiry:   *chainHeight.Add(types.NewBlockHeight(duration + ChannelExpiryInterval)),
 		GasPrice:        *types.NewAttoFIL(big.NewInt(CreateChannelGasPrice)),
-		GasLimit:        types.NewGasUnits(CreateChannelGasLimit),
+		GasLimit:        msg.AutoGasLimit,
 	})
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating payment")
@@ -177,12 +190,30 @@ func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data
 	if err != nil {
 		return nil, err
 	}
+	proposalCid, err := convert.ToCid(proposal)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get cid of proposal")
+	}
+
+	// Keep the connection to the miner, which the deal depends on, until the
+	// deal ends.
+	smc.protectDeal(pid, proposalCid)
+
+	response, err := smc.sendProposal(ctx, pid, signedProposal, miner, proposal)
+	if err != nil {
+		smc.unprotectDeal(pid, proposalCid)
+		return nil, err
+	}
+	smc.log.Debugf("proposed deal for: %s, %v\n", miner.String(), proposal)
+
+	return response, nil
+}
 
-	// send proposal
+func (smc *Client) sendProposal(ctx context.Context, pid peer.ID, signedProposal *storagedeal.SignedDealProposal, miner address.Address, proposal *storagedeal.Proposal) (*storagedeal.Response, error) {
 	var response storagedeal.Response
 	// We reset the context to not timeout to allow large file transfers
 	// to complete.
-	err = smc.ProtocolRequestFunc(ctx, makeDealProtocol, pid, smc.host, signedProposal, &response)
+	err := smc.ProtocolRequestFunc(ctx, makeDealProtocol, pid, smc.host, signedProposal, &response)
 	if err != nil {
 		return nil, errors.Wrap(err, "error sending proposal")
 	}
@@ -196,11 +227,64 @@ func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data
 	if err := smc.recordResponse(&response, miner, proposal); err != nil {
 		return nil, errors.Wrap(err, "failed to track response")
 	}
-	smc.log.Debugf("proposed deal for: %s, %v\n", miner.String(), proposal)
-
 	return &response, nil
 }
 
+// protectDeal protects the connections to the miner peer of a deal in
+// progress.
+func (smc *Client) protectDeal(pid peer.ID, proposalCid cid.Cid) {
+	smc.dealsLk.Lock()
+	defer smc.dealsLk.Unlock()
+	deals, ok := smc.dealsByPeer[pid]
+	if !ok {
+		deals = make(map[cid.Cid]struct{})
+		smc.dealsByPeer[pid] = deals
+	}
+	deals[proposalCid] = struct{}{}
+	smc.api.NetworkProtectPeer(pid, net.ProtectStorageDeal)
+}
+
+// unprotectDeal stops protecting the connections to the miner peer of a deal
+// which ended, unless the client has other deals in progress with it.
+func (smc *Client) unprotectDeal(pid peer.ID, proposalCid cid.Cid) {
+	smc.dealsLk.Lock()
+	defer smc.dealsLk.Unlock()
+	deals, ok := smc.dealsByPeer[pid]
+	if !ok {
+		return
+	}
+	delete(deals, proposalCid)
+	if len(deals) == 0 {
+		delete(smc.dealsByPeer, pid)
+		smc.api.NetworkUnprotectPeer(pid, net.ProtectStorageDeal)
+	}
+}
+
+// dealEnded reports whether a deal in the given state no longer needs the
+// connection to its miner.
+func dealEnded(state storagedeal.State) bool {
+	switch state {
+	case storagedeal.Rejected, storagedeal.Failed, storagedeal.Posted, storagedeal.Complete:
+		return true
+	default:
+		return false
+	}
+}
+
+// addMinerAddrs adds the multiaddrs the miner announces on chain to the
+// peerstore, so that they are dialed directly instead of looking the miner up
+// in the DHT.
+func (smc *Client) addMinerAddrs(ctx context.Context, miner address.Address, pid peer.ID) {
+	addrs, err := smc.api.MinerGetMultiaddrs(ctx, miner)
+	if err != nil {
+		smc.log.Warningf("failed to get multiaddrs of miner %s: %s", miner, err)
+		return
+	}
+	if len(addrs) > 0 {
+		smc.host.Peerstore().AddAddrs(pid, addrs, pstore.TempAddrTTL)
+	}
+}
+
 func (smc *Client) pingMiner(ctx context.Context, pid peer.ID, timeout time.Duration) error {
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
@@ -279,6 +363,7 @@ func (smc *Client) QueryDeal(ctx context.Context, proposalCid cid.Cid) (*storage
 	if err != nil {
 		return nil, err
 	}
+	smc.addMinerAddrs(ctx, mineraddr, minerpid)
 
 	q := storagedeal.QueryRequest{Cid: proposalCid}
 	var resp storagedeal.Response
@@ -286,6 +371,9 @@ func (smc *Client) QueryDeal(ctx context.Context, proposalCid cid.Cid) (*storage
 	if err != nil {
 		return nil, errors.Wrap(err, "error querying deal")
 	}
+	if dealEnded(resp.State) {
+		smc.unprotectDeal(minerpid, proposalCid)
+	}
 
 	return &resp, nil
 }
@@ -10,6 +10,8 @@ import (
 	"github.com/libp2p/go-libp2p-host"
 	"github.com/libp2p/go-libp2p-peer"
 	"github.com/libp2p/go-libp2p-protocol"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -112,6 +114,65 @@ func TestProposeDeal(t *testing.T) {
 	})
 }
 
+func TestDealProtectsMiner(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.Background()
+	addressCreator := address.NewForTestGetter()
+	cidGetter := types.NewCidForTestGetter()
+
+	dealStates := make(map[cid.Cid]storagedeal.State)
+	proposalState := storagedeal.Accepted
+	testNode := newTestClientNode(func(request interface{}) (interface{}, error) {
+		switch r := request.(type) {
+		case *storagedeal.SignedDealProposal:
+			pcid, err := convert.ToCid(r.Proposal)
+			require.NoError(err)
+			return &storagedeal.Response{State: proposalState, ProposalCid: pcid}, nil
+		case storagedeal.QueryRequest:
+			return &storagedeal.Response{State: dealStates[r.Cid], ProposalCid: r.Cid}, nil
+		default:
+			return nil, errors.New("unexpected request")
+		}
+	})
+
+	testAPI := newTestClientAPI(require)
+	client := NewClient(testNode.GetBlockTime(), th.NewFakeHost(), testAPI)
+	client.ProtocolRequestFunc = testNode.MakeTestProtocolRequest
+	minerAddr := addressCreator()
+	pid, err := testAPI.MinerGetPeerID(ctx, minerAddr)
+	require.NoError(err)
+
+	first, err := client.ProposeDeal(ctx, minerAddr, cidGetter(), 1, 10000, false)
+	require.NoError(err)
+	assert.True(testAPI.protected[pid])
+	second, err := client.ProposeDeal(ctx, minerAddr, cidGetter(), 1, 10000, false)
+	require.NoError(err)
+
+	// The miner stays protected while a deal is in progress.
+	dealStates[first.ProposalCid] = storagedeal.Staged
+	_, err = client.QueryDeal(ctx, first.ProposalCid)
+	require.NoError(err)
+	assert.True(testAPI.protected[pid])
+
+	dealStates[first.ProposalCid] = storagedeal.Posted
+	_, err = client.QueryDeal(ctx, first.ProposalCid)
+	require.NoError(err)
+	assert.True(testAPI.protected[pid])
+
+	dealStates[second.ProposalCid] = storagedeal.Failed
+	_, err = client.QueryDeal(ctx, second.ProposalCid)
+	require.NoError(err)
+	assert.False(testAPI.protected[pid])
+
+	// Rejected proposals don't leave the miner protected.
+	proposalState = storagedeal.Rejected
+	_, err = client.ProposeDeal(ctx, minerAddr, cidGetter(), 1, 20000, false)
+	require.Error(err)
+	assert.Contains(err.Error(), "deal rejected")
+	assert.False(testAPI.protected[pid])
+}
+
 type clientTestAPI struct {
 	blockHeight *types.BlockHeight
 	channelID   *types.ChannelID
@@ -121,6 +182,7 @@ type clientTestAPI struct {
 	perPayment  *types.AttoFIL
 	require     *require.Assertions
 	deals       map[cid.Cid]*storagedeal.Deal
+	protected   map[peer.ID]bool
 }
 
 func newTestClientAPI(require *require.Assertions) *clientTestAPI {
@@ -136,6 +198,7 @@ func newTestClientAPI(require *require.Assertions) *clientTestAPI {
 		perPayment:  types.NewAttoFILFromFIL(10),
 		require:     require,
 		deals:       make(map[cid.Cid]*storagedeal.Deal),
+		protected:   make(map[peer.ID]bool),
 	}
 }
 
@@ -180,6 +243,10 @@ func (ctp *clientTestAPI) MinerGetOwnerAddress(ctx context.Context, minerAddr ad
 	return address.TestAddress, nil
 }
 
+func (ctp *clientTestAPI) MinerGetMultiaddrs(ctx context.Context, minerAddr address.Address) ([]ma.Multiaddr, error) {
+	return nil, nil
+}
+
 func (ctp *clientTestAPI) MinerGetPeerID(ctx context.Context, minerAddr address.Address) (peer.ID, error) {
 	id, err := peer.IDB58Decode("QmWbMozPyW6Ecagtxq7SXBXXLY5BNdP1GwHB2WoZCKMvcb")
 	ctp.require.NoError(err, "Could not create peer id")
@@ -194,6 +261,15 @@ func (ctp *clientTestAPI) NetworkPing(ctx context.Context, p peer.ID) (<-chan ti
 	return out, nil
 }
 
+func (ctp *clientTestAPI) NetworkProtectPeer(pid peer.ID, tag string) {
+	ctp.protected[pid] = true
+}
+
+func (ctp *clientTestAPI) NetworkUnprotectPeer(pid peer.ID, tag string) bool {
+	delete(ctp.protected, pid)
+	return false
+}
+
 func (ctp *clientTestAPI) SignBytes(data []byte, addr address.Address) (types.Signature, error) {
 	return testSignature, nil
 }
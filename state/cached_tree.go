@@ -2,6 +2,8 @@ package state
 
 import (
 	"context"
+	"fmt"
+
 	"github.com/ipfs/go-cid"
 
 	"github.com/filecoin-project/go-filecoin/actor"
@@ -14,6 +16,8 @@ import (
 type CachedTree struct {
 	st    Tree
 	cache map[address.Address]*actor.Actor
+	// builtinActors, if set, replaces the actor code of the underlying tree.
+	builtinActors map[cid.Cid]exec.ExecutableActor
 }
 
 // NewCachedStateTree returns a initialized empty CachedTree
@@ -24,9 +28,28 @@ func NewCachedStateTree(st Tree) *CachedTree {
 	}
 }
 
-// GetBuiltinActorCode simply delegates to the underlying tree
+// NewCachedStateTreeWithActors returns a initialized empty CachedTree which
+// runs the given actor code rather than that of st.
+func NewCachedStateTreeWithActors(st Tree, builtinActors map[cid.Cid]exec.ExecutableActor) *CachedTree {
+	t := NewCachedStateTree(st)
+	t.builtinActors = builtinActors
+	return t
+}
+
+// GetBuiltinActorCode delegates to the underlying tree, unless the cache was
+// given its own actor code.
 func (t *CachedTree) GetBuiltinActorCode(codePointer cid.Cid) (exec.ExecutableActor, error) {
-	return t.st.GetBuiltinActorCode(codePointer)
+	if t.builtinActors == nil {
+		return t.st.GetBuiltinActorCode(codePointer)
+	}
+	if !codePointer.Defined() {
+		return nil, fmt.Errorf("missing code")
+	}
+	actor, ok := t.builtinActors[codePointer]
+	if !ok {
+		return nil, fmt.Errorf("unknown code: %s", codePointer.String())
+	}
+	return actor, nil
 }
 
 // GetActor retrieves an actor from the cache. If it's not found it will get it from the
@@ -9,6 +9,7 @@ import (
 
 	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/exec"
 	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -117,3 +118,22 @@ func requireCid(t *testing.T, data string) cid.Cid {
 	require.NoError(t, err)
 	return id
 }
+
+func TestCachedStateWithActors(t *testing.T) {
+	assert := assert.New(t)
+
+	oldCode, newCode := types.AccountActorCodeCid, types.MinerActorCodeCid
+	underlying := NewEmptyStateTreeWithActors(hamt.NewCborStore(), map[cid.Cid]exec.ExecutableActor{
+		oldCode: &actor.FakeActor{},
+	})
+	tree := NewCachedStateTreeWithActors(underlying, map[cid.Cid]exec.ExecutableActor{
+		newCode: &actor.FakeActor{},
+	})
+
+	_, err := underlying.GetBuiltinActorCode(oldCode)
+	assert.NoError(err)
+	_, err = tree.GetBuiltinActorCode(oldCode)
+	assert.Error(err)
+	_, err = tree.GetBuiltinActorCode(newCode)
+	assert.NoError(err)
+}
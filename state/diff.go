@@ -0,0 +1,251 @@
+package state
+
+import (
+	"context"
+	"sort"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-hamt-ipld"
+	"github.com/pkg/errors"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/exec"
+)
+
+// ActorDiff is the change of an actor between two state trees.
+type ActorDiff struct {
+	Address address.Address
+	// Before is the actor in the first tree, nil if it was added.
+	Before *actor.Actor
+	// After is the actor in the second tree, nil if it was removed.
+	After *actor.Actor
+	// State holds the changes of the state of the actor, decoded when its
+	// code is a builtin actor implementing exec.StateDiffer.
+	State []exec.StateChange `json:",omitempty"`
+}
+
+// Diff returns the actors added, removed or modified from the state tree at
+// rootA to the state tree at rootB, ordered by address. Subtrees shared by
+// both trees are skipped. The states of the actors whose code is in
+// builtinActors and implements exec.StateDiffer are decoded and diffed.
+func Diff(ctx context.Context, store *hamt.CborIpldStore, rootA, rootB cid.Cid, builtinActors map[cid.Cid]exec.ExecutableActor) ([]*ActorDiff, error) {
+	if rootA.Equals(rootB) {
+		return nil, nil
+	}
+	a, err := hamt.LoadNode(ctx, store, rootA)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load first state tree")
+	}
+	b, err := hamt.LoadNode(ctx, store, rootB)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load second state tree")
+	}
+
+	d := &differ{
+		ctx:    ctx,
+		store:  store,
+		before: make(map[string]*actor.Actor),
+		after:  make(map[string]*actor.Actor),
+	}
+	if err := d.diffNodes(a, b); err != nil {
+		return nil, err
+	}
+
+	var diffs []*ActorDiff
+	for key, after := range d.after {
+		before := d.before[key]
+		if before != nil && actorsEqual(before, after) {
+			continue
+		}
+		diff, err := d.newActorDiff(key, before, after, builtinActors)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, diff)
+	}
+	for key, before := range d.before {
+		if _, ok := d.after[key]; ok {
+			continue
+		}
+		diff, err := d.newActorDiff(key, before, nil, builtinActors)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, diff)
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Address.String() < diffs[j].Address.String()
+	})
+	return diffs, nil
+}
+
+// differ collects the actors of the parts of two trees that differ.
+type differ struct {
+	ctx   context.Context
+	store *hamt.CborIpldStore
+	// before and after hold the actors of the differing parts of the first
+	// and second tree, keyed by address.
+	before map[string]*actor.Actor
+	after  map[string]*actor.Actor
+}
+
+// diffNodes pairs the pointers of two nodes at the same position and
+// collects the actors of the pairs which differ.
+func (d *differ) diffNodes(a, b *hamt.Node) error {
+	pointersA, pointersB := pointersByPosition(a), pointersByPosition(b)
+	for pos, p := range pointersA {
+		q, ok := pointersB[pos]
+		if !ok {
+			if err := d.collect(p, d.before); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.diffPointers(p, q); err != nil {
+			return err
+		}
+	}
+	for pos, q := range pointersB {
+		if _, ok := pointersA[pos]; !ok {
+			if err := d.collect(q, d.after); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *differ) diffPointers(p, q *hamt.Pointer) error {
+	if p.Link.Defined() && q.Link.Defined() {
+		// A subtree with the same cid holds the same actors.
+		if p.Link.Equals(q.Link) {
+			return nil
+		}
+		a, err := hamt.LoadNode(d.ctx, d.store, p.Link)
+		if err != nil {
+			return err
+		}
+		b, err := hamt.LoadNode(d.ctx, d.store, q.Link)
+		if err != nil {
+			return err
+		}
+		return d.diffNodes(a, b)
+	}
+	if err := d.collect(p, d.before); err != nil {
+		return err
+	}
+	return d.collect(q, d.after)
+}
+
+// collect adds the actors of a pointer and its subtree to actors.
+func (d *differ) collect(p *hamt.Pointer, actors map[string]*actor.Actor) error {
+	for _, kv := range p.KVs {
+		var a actor.Actor
+		if err := hackTransferObject(kv.Value, &a); err != nil {
+			return err
+		}
+		actors[kv.Key] = &a
+	}
+	if !p.Link.Defined() {
+		return nil
+	}
+	n, err := hamt.LoadNode(d.ctx, d.store, p.Link)
+	if err != nil {
+		return err
+	}
+	for _, child := range n.Pointers {
+		if err := d.collect(child, actors); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *differ) newActorDiff(key string, before, after *actor.Actor, builtinActors map[cid.Cid]exec.ExecutableActor) (*ActorDiff, error) {
+	addr, err := address.NewFromString(key)
+	if err != nil {
+		return nil, err
+	}
+	diff := &ActorDiff{Address: addr, Before: before, After: after}
+
+	// The states of actors of different codes can't be compared, and there
+	// is nothing to diff if the state didn't change.
+	if before != nil && after != nil && (!before.Code.Equals(after.Code) || before.Head.Equals(after.Head)) {
+		return diff, nil
+	}
+	act := before
+	if after != nil {
+		act = after
+	}
+	stateDiffer, ok := builtinActors[act.Code].(exec.StateDiffer)
+	if !ok {
+		return diff, nil
+	}
+
+	diff.State, err = stateDiffer.DiffState(d.ctx, d.storage(before), d.storage(after))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to diff state of actor %s", key)
+	}
+	return diff, nil
+}
+
+// storage returns a read-only storage of the state of an actor.
+func (d *differ) storage(a *actor.Actor) exec.Storage {
+	head := cid.Undef
+	if a != nil {
+		head = a.Head
+	}
+	return &readOnlyStorage{ctx: d.ctx, store: d.store, head: head}
+}
+
+// pointersByPosition returns the pointers of a node keyed by their position
+// in the node, the index of their bit in its bitfield.
+func pointersByPosition(n *hamt.Node) map[int]*hamt.Pointer {
+	pointers := make(map[int]*hamt.Pointer)
+	if n.Bitfield == nil {
+		return pointers
+	}
+	i := 0
+	for pos := 0; pos < n.Bitfield.BitLen() && i < len(n.Pointers); pos++ {
+		if n.Bitfield.Bit(pos) == 1 {
+			pointers[pos] = n.Pointers[i]
+			i++
+		}
+	}
+	return pointers
+}
+
+func actorsEqual(a, b *actor.Actor) bool {
+	return a.Code.Equals(b.Code) && a.Head.Equals(b.Head) && a.Nonce == b.Nonce && a.Balance.Equal(b.Balance)
+}
+
+// readOnlyStorage is an exec.Storage reading the state of an actor from a
+// store.
+type readOnlyStorage struct {
+	ctx   context.Context
+	store *hamt.CborIpldStore
+	head  cid.Cid
+}
+
+var _ exec.Storage = (*readOnlyStorage)(nil)
+
+func (s *readOnlyStorage) Put(interface{}) (cid.Cid, error) {
+	return cid.Undef, errors.New("storage is read-only")
+}
+
+func (s *readOnlyStorage) Get(c cid.Cid) ([]byte, error) {
+	blk, err := s.store.Blocks.GetBlock(s.ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return blk.RawData(), nil
+}
+
+func (s *readOnlyStorage) Commit(cid.Cid, cid.Cid) error {
+	return errors.New("storage is read-only")
+}
+
+func (s *readOnlyStorage) Head() cid.Cid {
+	return s.head
+}
@@ -0,0 +1,117 @@
+package state
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-hamt-ipld"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// headDiffer is an actor whose state diff is the change of its head.
+type headDiffer struct{}
+
+func (headDiffer) Exports() exec.Exports { return nil }
+
+func (headDiffer) InitializeState(storage exec.Storage, initializerData interface{}) error {
+	return nil
+}
+
+func (headDiffer) DiffState(ctx context.Context, before, after exec.Storage) ([]exec.StateChange, error) {
+	return []exec.StateChange{{Field: "head", Before: before.Head().String(), After: after.Head().String()}}, nil
+}
+
+func TestDiff(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx := context.Background()
+	cst := hamt.NewCborStore()
+	st := NewEmptyStateTree(cst)
+	addrGetter := address.NewForTestGetter()
+	cidGetter := types.NewCidForTestGetter()
+	differCode := cidGetter()
+	builtinActors := map[cid.Cid]exec.ExecutableActor{differCode: headDiffer{}}
+
+	// Enough actors for the tree to have subtrees.
+	var addrs []address.Address
+	for i := 0; i < 500; i++ {
+		addr := addrGetter()
+		addrs = append(addrs, addr)
+		require.NoError(st.SetActor(ctx, addr, actor.NewActor(types.AccountActorCodeCid, types.NewAttoFILFromFIL(uint64(i)))))
+	}
+	oldHead := cidGetter()
+	withState := actor.NewActor(differCode, types.ZeroAttoFIL)
+	withState.Head = oldHead
+	require.NoError(st.SetActor(ctx, addrs[1], withState))
+	rootA, err := st.Flush(ctx)
+	require.NoError(err)
+
+	modified := actor.NewActor(types.AccountActorCodeCid, types.NewAttoFILFromFIL(1000))
+	modified.IncNonce()
+	require.NoError(st.SetActor(ctx, addrs[0], modified))
+	newHead := cidGetter()
+	withNewState := actor.NewActor(differCode, types.ZeroAttoFIL)
+	withNewState.Head = newHead
+	require.NoError(st.SetActor(ctx, addrs[1], withNewState))
+	require.NoError(st.(*tree).root.Delete(ctx, addrs[2].String()))
+	added := addrGetter()
+	require.NoError(st.SetActor(ctx, added, actor.NewActor(types.AccountActorCodeCid, types.NewAttoFILFromFIL(1))))
+	rootB, err := st.Flush(ctx)
+	require.NoError(err)
+
+	t.Run("reports added, removed and modified actors", func(t *testing.T) {
+		diffs, err := Diff(ctx, cst, rootA, rootB, builtinActors)
+		require.NoError(err)
+		require.Len(diffs, 4)
+
+		byAddr := make(map[address.Address]*ActorDiff)
+		for _, diff := range diffs {
+			byAddr[diff.Address] = diff
+		}
+
+		require.Contains(byAddr, addrs[0])
+		assert.Equal(types.NewAttoFILFromFIL(0), byAddr[addrs[0]].Before.Balance)
+		assert.Equal(types.NewAttoFILFromFIL(1000), byAddr[addrs[0]].After.Balance)
+		assert.Equal(types.Uint64(1), byAddr[addrs[0]].After.Nonce)
+		assert.Empty(byAddr[addrs[0]].State)
+
+		require.Contains(byAddr, addrs[1])
+		assert.Equal([]exec.StateChange{{Field: "head", Before: oldHead.String(), After: newHead.String()}}, byAddr[addrs[1]].State)
+
+		require.Contains(byAddr, addrs[2])
+		assert.NotNil(byAddr[addrs[2]].Before)
+		assert.Nil(byAddr[addrs[2]].After)
+
+		require.Contains(byAddr, added)
+		assert.Nil(byAddr[added].Before)
+		assert.NotNil(byAddr[added].After)
+	})
+
+	t.Run("is empty for the same tree", func(t *testing.T) {
+		diffs, err := Diff(ctx, cst, rootA, rootA, builtinActors)
+		require.NoError(err)
+		assert.Empty(diffs)
+	})
+
+	t.Run("reverses", func(t *testing.T) {
+		diffs, err := Diff(ctx, cst, rootB, rootA, builtinActors)
+		require.NoError(err)
+		require.Len(diffs, 4)
+		for _, diff := range diffs {
+			if diff.Address == added {
+				assert.Nil(diff.After)
+			}
+			if diff.Address == addrs[2] {
+				assert.Nil(diff.Before)
+			}
+		}
+	})
+}
@@ -0,0 +1,49 @@
+package state
+
+import (
+	"github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	"github.com/ipfs/go-ipfs-blockstore"
+)
+
+// NewScratchStore returns a blockstore reading the blocks of base and
+// writing new blocks to memory, for the states built on base which must
+// never be persisted, like those of simulated messages.
+func NewScratchStore(base blockstore.Blockstore) blockstore.Blockstore {
+	return &scratchStore{
+		Blockstore: blockstore.NewBlockstore(dss.MutexWrap(datastore.NewMapDatastore())),
+		base:       base,
+	}
+}
+
+// scratchStore is a blockstore whose writes go to the embedded in-memory
+// blockstore, and whose reads fall back to base.
+type scratchStore struct {
+	blockstore.Blockstore
+	base blockstore.Blockstore
+}
+
+func (s *scratchStore) Has(c cid.Cid) (bool, error) {
+	if has, err := s.Blockstore.Has(c); err != nil || has {
+		return has, err
+	}
+	return s.base.Has(c)
+}
+
+func (s *scratchStore) Get(c cid.Cid) (blocks.Block, error) {
+	blk, err := s.Blockstore.Get(c)
+	if err == blockstore.ErrNotFound {
+		return s.base.Get(c)
+	}
+	return blk, err
+}
+
+func (s *scratchStore) GetSize(c cid.Cid) (int, error) {
+	size, err := s.Blockstore.GetSize(c)
+	if err == blockstore.ErrNotFound {
+		return s.base.GetSize(c)
+	}
+	return size, err
+}
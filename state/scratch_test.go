@@ -0,0 +1,45 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-ipfs-blockstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScratchStore(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	base := blockstore.NewBlockstore(datastore.NewMapDatastore())
+	old := blocks.NewBlock([]byte("old"))
+	require.NoError(base.Put(old))
+
+	scratch := NewScratchStore(base)
+	added := blocks.NewBlock([]byte("added"))
+	require.NoError(scratch.Put(added))
+
+	// Blocks of base and new blocks are both read.
+	for _, blk := range []blocks.Block{old, added} {
+		has, err := scratch.Has(blk.Cid())
+		require.NoError(err)
+		assert.True(has)
+		got, err := scratch.Get(blk.Cid())
+		require.NoError(err)
+		assert.Equal(blk.RawData(), got.RawData())
+		size, err := scratch.GetSize(blk.Cid())
+		require.NoError(err)
+		assert.Equal(len(blk.RawData()), size)
+	}
+
+	// New blocks never reach base.
+	has, err := base.Has(added.Cid())
+	require.NoError(err)
+	assert.False(has)
+
+	_, err = scratch.Get(blocks.NewBlock([]byte("missing")).Cid())
+	assert.Equal(blockstore.ErrNotFound, err)
+}
@@ -12,8 +12,10 @@ import (
 	"github.com/polydawn/refmt/shared"
 
 	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/initactor"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/exec"
+	vmerrors "github.com/filecoin-project/go-filecoin/vm/errors"
 )
 
 // tree is a state tree that maps addresses to actors.
@@ -128,7 +130,14 @@ func (t *tree) GetBuiltinActorCode(codePointer cid.Cid) (exec.ExecutableActor, e
 // GetActor retrieves an actor by their address. If no actor
 // exists at the given address then an error will be returned
 // for which IsActorNotFoundError(err) is true.
+// An ID address is resolved to the address of the actor it is assigned to
+// by the init actor.
 func (t *tree) GetActor(ctx context.Context, a address.Address) (*actor.Actor, error) {
+	a, err := t.resolve(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+
 	data, err := t.root.Find(ctx, a.String())
 	if err == hamt.ErrNotFound {
 		return nil, &actorNotFoundError{}
@@ -174,12 +183,40 @@ func (t *tree) GetOrCreateActor(ctx context.Context, address address.Address, cr
 // SetActor sets the memory slot at address 'a' to the given actor.
 // This operation can overwrite existing actors at that address.
 func (t *tree) SetActor(ctx context.Context, a address.Address, act *actor.Actor) error {
+	a, err := t.resolve(ctx, a)
+	if err != nil {
+		return errors.Wrap(err, "setting actor in state tree failed")
+	}
+
 	if err := t.root.Set(ctx, a.String(), act); err != nil {
 		return errors.Wrap(err, "setting actor in state tree failed")
 	}
 	return nil
 }
 
+// resolve returns the address of the actor an ID address is assigned to,
+// found in the state of the init actor. Other addresses are returned as they
+// are. The error of an unassigned ID satisfies IsActorNotFoundError.
+func (t *tree) resolve(ctx context.Context, a address.Address) (address.Address, error) {
+	if a.Protocol() != address.ID {
+		return a, nil
+	}
+
+	initActor, err := t.GetActor(ctx, address.InitAddress)
+	if err != nil {
+		return address.Undef, err
+	}
+	storage := &readOnlyStorage{ctx: ctx, store: t.store, head: initActor.Head}
+	resolved, err := initactor.LookupAddress(ctx, storage, a)
+	if err != nil {
+		if vmerrors.ShouldRevert(err) {
+			return address.Undef, &actorNotFoundError{}
+		}
+		return address.Undef, err
+	}
+	return resolved, nil
+}
+
 // ForEachActor calls walkFn for each actor in the state tree
 func (t *tree) ForEachActor(ctx context.Context, walkFn ActorWalkFn) error {
 	return forEachActor(ctx, t.store, t.root, walkFn)
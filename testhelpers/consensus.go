@@ -151,6 +151,16 @@ func ApplyTestMessage(st state.Tree, store vm.StorageMap, msg *types.Message, bh
 	return applyTestMessageWithAncestors(st, store, msg, bh, nil)
 }
 
+// ApplyTestMessageWithGasLimit is like ApplyTestMessage, with the given gas
+// limit.
+func ApplyTestMessageWithGasLimit(st state.Tree, store vm.StorageMap, msg *types.Message, bh *types.BlockHeight, gasLimit types.GasUnits) (*consensus.ApplicationResult, error) {
+	smsg, err := types.NewSignedMessage(*msg, testSigner{}, types.NewGasPrice(0), gasLimit)
+	if err != nil {
+		panic(err)
+	}
+	return newMessageApplier(smsg, newTestApplier(), st, store, bh, address.Undef, nil)
+}
+
 // ApplyTestMessageWithGas uses the TestBlockRewarder but the default SignedMessageValidator
 func ApplyTestMessageWithGas(st state.Tree, store vm.StorageMap, msg *types.Message, bh *types.BlockHeight, signer *types.MockSigner,
 	gasPrice types.AttoFIL, gasLimit types.GasUnits, minerOwner address.Address) (*consensus.ApplicationResult, error) {
@@ -41,9 +41,9 @@ func (f *Filecoin) AddressLs(ctx context.Context) ([]address.Address, error) {
 
 // AddressLookup runs the address lookup command against the filecoin process.
 func (f *Filecoin) AddressLookup(ctx context.Context, addr address.Address) (peer.ID, error) {
-	var ownerPeer peer.ID
-	if err := f.RunCmdJSONWithStdin(ctx, nil, &ownerPeer, "go-filecoin", "address", "lookup", addr.String()); err != nil {
+	var res commands.AddressLookupResult
+	if err := f.RunCmdJSONWithStdin(ctx, nil, &res, "go-filecoin", "address", "lookup", addr.String()); err != nil {
 		return "", err
 	}
-	return ownerPeer, nil
+	return peer.IDB58Decode(res.PeerID)
 }
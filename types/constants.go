@@ -28,6 +28,13 @@ var PaymentBrokerActorCodeObj ipld.Node
 // PaymentBrokerActorCodeCid is the cid of the above object
 var PaymentBrokerActorCodeCid cid.Cid
 
+// PaymentBrokerV1ActorCodeObj is the code representation of version 1 of the
+// builtin payment broker actor.
+var PaymentBrokerV1ActorCodeObj ipld.Node
+
+// PaymentBrokerV1ActorCodeCid is the cid of the above object
+var PaymentBrokerV1ActorCodeCid cid.Cid
+
 // MinerActorCodeObj is the code representation of the builtin miner actor.
 var MinerActorCodeObj ipld.Node
 
@@ -40,6 +47,12 @@ var BootstrapMinerActorCodeObj ipld.Node
 // BootstrapMinerActorCodeCid is the cid of the above object
 var BootstrapMinerActorCodeCid cid.Cid
 
+// InitActorCodeObj is the code representation of the builtin init actor.
+var InitActorCodeObj ipld.Node
+
+// InitActorCodeCid is the cid of the above object
+var InitActorCodeCid cid.Cid
+
 // ActorCodeCidTypeNames maps Actor codeCid's to the name of the associated Actor type.
 var ActorCodeCidTypeNames = make(map[cid.Cid]string)
 
@@ -50,10 +63,14 @@ func init() {
 	StorageMarketActorCodeCid = StorageMarketActorCodeObj.Cid()
 	PaymentBrokerActorCodeObj = dag.NewRawNode([]byte("paymentbroker"))
 	PaymentBrokerActorCodeCid = PaymentBrokerActorCodeObj.Cid()
+	PaymentBrokerV1ActorCodeObj = dag.NewRawNode([]byte("paymentbroker/v1"))
+	PaymentBrokerV1ActorCodeCid = PaymentBrokerV1ActorCodeObj.Cid()
 	MinerActorCodeObj = dag.NewRawNode([]byte("mineractor"))
 	MinerActorCodeCid = MinerActorCodeObj.Cid()
 	BootstrapMinerActorCodeObj = dag.NewRawNode([]byte("bootstrapmineractor"))
 	BootstrapMinerActorCodeCid = BootstrapMinerActorCodeObj.Cid()
+	InitActorCodeObj = dag.NewRawNode([]byte("initactor"))
+	InitActorCodeCid = InitActorCodeObj.Cid()
 
 	// New Actors need to be added here.
 	// TODO: Make this work with reflection -- but note that nasty import cycles lie on that path.
@@ -61,8 +78,10 @@ func init() {
 	ActorCodeCidTypeNames[AccountActorCodeCid] = "AccountActor"
 	ActorCodeCidTypeNames[StorageMarketActorCodeCid] = "StorageMarketActor"
 	ActorCodeCidTypeNames[PaymentBrokerActorCodeCid] = "PaymentBrokerActor"
+	ActorCodeCidTypeNames[PaymentBrokerV1ActorCodeCid] = "PaymentBrokerActor"
 	ActorCodeCidTypeNames[MinerActorCodeCid] = "MinerActor"
 	ActorCodeCidTypeNames[BootstrapMinerActorCodeCid] = "MinerActor"
+	ActorCodeCidTypeNames[InitActorCodeCid] = "InitActor"
 }
 
 // ActorCodeTypeName returns the (string) name of the Go type of the actor with cid, code.
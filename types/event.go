@@ -0,0 +1,38 @@
+package types
+
+import (
+	cbor "github.com/ipfs/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/address"
+)
+
+func init() {
+	cbor.RegisterCborType(Event{})
+}
+
+// Event is a notice emitted by an actor while processing a message, e.g. a
+// payment channel redeemed or a sector committed. The events of a message
+// are collected into its receipt.
+type Event struct {
+	// Emitter is the address of the actor emitting the event.
+	Emitter address.Address `json:"emitter"`
+	// Topic names the kind of event, e.g. "redeemed".
+	Topic string `json:"topic"`
+	// Data is the cbor encoding of the event details, if any.
+	Data []byte `json:"data,omitempty"`
+}
+
+// EventFilter selects events by emitter and topic. Unset fields match any
+// event.
+type EventFilter struct {
+	Emitter address.Address
+	Topic   string
+}
+
+// Matches returns true if the event has the emitter and topic of the filter.
+func (f EventFilter) Matches(event *Event) bool {
+	if !f.Emitter.Empty() && event.Emitter != f.Emitter {
+		return false
+	}
+	return f.Topic == "" || event.Topic == f.Topic
+}
@@ -0,0 +1,26 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/filecoin-project/go-filecoin/address"
+)
+
+func TestEventFilterMatches(t *testing.T) {
+	assert := assert.New(t)
+
+	addrGetter := address.NewForTestGetter()
+	emitter, other := addrGetter(), addrGetter()
+	event := &Event{Emitter: emitter, Topic: "redeemed"}
+
+	assert.True(EventFilter{}.Matches(event))
+	assert.True(EventFilter{Emitter: emitter}.Matches(event))
+	assert.True(EventFilter{Topic: "redeemed"}.Matches(event))
+	assert.True(EventFilter{Emitter: emitter, Topic: "redeemed"}.Matches(event))
+
+	assert.False(EventFilter{Emitter: other}.Matches(event))
+	assert.False(EventFilter{Topic: "closed"}.Matches(event))
+	assert.False(EventFilter{Emitter: emitter, Topic: "closed"}.Matches(event))
+}
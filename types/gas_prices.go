@@ -0,0 +1,89 @@
+package types
+
+// PriceList holds the gas charged for the operations of the VM and the
+// heavy steps of the builtin actors.
+type PriceList struct {
+	// MethodCall is charged by the builtin actors for each call of their
+	// methods.
+	MethodCall GasUnits
+	// Send is charged for each message sent by an actor.
+	Send GasUnits
+	// CreateActor is charged for each actor created.
+	CreateActor GasUnits
+	// StorageGetBase is charged for each chunk read from actor storage, and
+	// StorageGetPerKiB for each KiB of the chunk, rounded up.
+	StorageGetBase   GasUnits
+	StorageGetPerKiB GasUnits
+	// StoragePutBase is charged for each chunk written to actor storage, and
+	// StoragePutPerKiB for each KiB of the chunk, rounded up.
+	StoragePutBase   GasUnits
+	StoragePutPerKiB GasUnits
+	// EmitEventBase is charged for each event emitted by an actor, and
+	// EmitEventPerByte for each byte of its topic and data.
+	EmitEventBase    GasUnits
+	EmitEventPerByte GasUnits
+	// VerifySignature is charged for each signature verified by an actor.
+	VerifySignature GasUnits
+	// VerifySeal is charged for each seal proof verified by an actor.
+	VerifySeal GasUnits
+	// VerifyPoSt is charged for each proof of spacetime verified by an actor.
+	VerifyPoSt GasUnits
+	// WasmInstructions is charged for each thousand instructions run by the
+	// actors deployed by users, WasmMemoryPage for each 64KiB page of memory
+	// they use and WasmMemoryPerKiB for each KiB copied or filled by their
+	// bulk memory instructions, rounded up.
+	WasmInstructions GasUnits
+	WasmMemoryPage   GasUnits
+	WasmMemoryPerKiB GasUnits
+}
+
+// StorageGetCost returns the gas charged to read a chunk of size bytes.
+func (pl *PriceList) StorageGetCost(size int) GasUnits {
+	return pl.StorageGetBase + pl.StorageGetPerKiB*kibs(size)
+}
+
+// StoragePutCost returns the gas charged to write a chunk of size bytes.
+func (pl *PriceList) StoragePutCost(size int) GasUnits {
+	return pl.StoragePutBase + pl.StoragePutPerKiB*kibs(size)
+}
+
+// WasmMemoryCost returns the gas charged to copy or fill size bytes of the
+// memory of a deployed actor.
+func (pl *PriceList) WasmMemoryCost(size int) GasUnits {
+	return pl.WasmMemoryPerKiB * kibs(size)
+}
+
+// EmitEventCost returns the gas charged to emit an event whose topic and
+// data are size bytes.
+func (pl *PriceList) EmitEventCost(size int) GasUnits {
+	return pl.EmitEventBase + pl.EmitEventPerByte*GasUnits(size)
+}
+
+func kibs(size int) GasUnits {
+	return GasUnits((size + 1023) / 1024)
+}
+
+// GenesisGasPrices returns the gas prices of the protocol version the
+// network starts with. Protocol upgrades may change them.
+func GenesisGasPrices() *PriceList {
+	return &PriceList{
+		MethodCall:       100,
+		Send:             5,
+		CreateActor:      10,
+		StorageGetBase:   1,
+		StorageGetPerKiB: 1,
+		StoragePutBase:   1,
+		StoragePutPerKiB: 2,
+		EmitEventBase:    2,
+		EmitEventPerByte: 1,
+		VerifySignature:  5,
+		VerifySeal:       20,
+		VerifyPoSt:       20,
+		// a method call of a builtin actor costs about as much as running
+		// ten thousand instructions
+		WasmInstructions: 10,
+		// memory costs 1 per KiB, half the price of writing it to storage
+		WasmMemoryPage:   64,
+		WasmMemoryPerKiB: 1,
+	}
+}
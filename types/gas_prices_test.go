@@ -0,0 +1,41 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriceListStorageCosts(t *testing.T) {
+	assert := assert.New(t)
+
+	pl := &PriceList{
+		StorageGetBase:   1,
+		StorageGetPerKiB: 2,
+		StoragePutBase:   3,
+		StoragePutPerKiB: 4,
+	}
+	assert.Equal(NewGasUnits(1), pl.StorageGetCost(0))
+	assert.Equal(NewGasUnits(3), pl.StorageGetCost(1))
+	assert.Equal(NewGasUnits(3), pl.StorageGetCost(1024))
+	assert.Equal(NewGasUnits(5), pl.StorageGetCost(1025))
+	assert.Equal(NewGasUnits(3), pl.StoragePutCost(0))
+	assert.Equal(NewGasUnits(11), pl.StoragePutCost(2048))
+}
+
+func TestPriceListWasmMemoryCost(t *testing.T) {
+	assert := assert.New(t)
+
+	pl := &PriceList{WasmMemoryPerKiB: 2}
+	assert.Equal(NewGasUnits(0), pl.WasmMemoryCost(0))
+	assert.Equal(NewGasUnits(2), pl.WasmMemoryCost(1024))
+	assert.Equal(NewGasUnits(4), pl.WasmMemoryCost(1025))
+}
+
+func TestGenesisGasPrices(t *testing.T) {
+	assert := assert.New(t)
+
+	// The prices returned are a copy.
+	GenesisGasPrices().Send = 0
+	assert.NotEqual(NewGasUnits(0), GenesisGasPrices().Send)
+}
@@ -20,4 +20,8 @@ type MessageReceipt struct {
 
 	// GasAttoFIL Charge is the actual amount of FIL transferred from the sender to the miner for processing the message
 	GasAttoFIL *AttoFIL `json:"gasAttoFIL"`
+
+	// Events holds the events emitted by the actors processing the message.
+	// Only the events of a successful message are kept.
+	Events []*Event `json:"events,omitempty" refmt:",omitempty"`
 }
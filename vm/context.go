@@ -5,10 +5,12 @@ import (
 	"context"
 	"encoding/binary"
 	"github.com/ipfs/go-cid"
+	cbor "github.com/ipfs/go-ipld-cbor"
 
 	"github.com/filecoin-project/go-filecoin/abi"
 	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/account"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/wasmactor"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/exec"
 	"github.com/filecoin-project/go-filecoin/sampling"
@@ -17,6 +19,11 @@ import (
 	"github.com/filecoin-project/go-filecoin/vm/errors"
 )
 
+// MaxSendDepth bounds the count of sends a message sent by an actor may be
+// nested in, so that actors sending messages to each other cannot recurse
+// without end.
+const MaxSendDepth = 64
+
 // Context is the only thing exposed to an actor while executing.
 // All methods on the Context are ABI methods exposed to actors.
 type Context struct {
@@ -26,8 +33,16 @@ type Context struct {
 	state       *state.CachedTree
 	storageMap  StorageMap
 	gasTracker  *GasTracker
+	gasPrices   *types.PriceList
 	blockHeight *types.BlockHeight
 	ancestors   []types.TipSet
+	tracer      *Tracer
+	// events is shared by the contexts of a message and the messages it
+	// sends.
+	events *eventLog
+	// depth is the count of sends the message is nested in, zero for the
+	// messages of blocks.
+	depth int
 
 	deps *deps // Inject external dependencies so we can unit test robustly.
 }
@@ -44,6 +59,11 @@ type NewContextParams struct {
 	GasTracker  *GasTracker
 	BlockHeight *types.BlockHeight
 	Ancestors   []types.TipSet
+	// GasPrices are the prices of the operations of the VM charged to the
+	// gas tracker. The VM charges nothing if they are nil.
+	GasPrices *types.PriceList
+	// Tracer, if set, records the calls of the message and its storage operations.
+	Tracer *Tracer
 }
 
 // NewVMContext returns an initialized context.
@@ -55,8 +75,11 @@ func NewVMContext(params NewContextParams) *Context {
 		state:       params.State,
 		storageMap:  params.StorageMap,
 		gasTracker:  params.GasTracker,
+		gasPrices:   params.GasPrices,
 		blockHeight: params.BlockHeight,
 		ancestors:   params.Ancestors,
+		tracer:      params.Tracer,
+		events:      &eventLog{},
 		deps:        makeDeps(params.State),
 	}
 }
@@ -65,7 +88,16 @@ var _ exec.VMContext = (*Context)(nil)
 
 // Storage returns an implementation of the storage module for this context.
 func (ctx *Context) Storage() exec.Storage {
-	return ctx.storageMap.NewStorage(ctx.message.To, ctx.to)
+	return ctx.traceStorage(ctx.storageMap.NewStorage(ctx.message.To, ctx.to).withGas(ctx.gasTracker, ctx.gasPrices))
+}
+
+// traceStorage wraps a storage to record its operations if the context is
+// traced.
+func (ctx *Context) traceStorage(s exec.Storage) exec.Storage {
+	if ctx.tracer == nil {
+		return s
+	}
+	return &tracedStorage{Storage: s, tracer: ctx.tracer}
 }
 
 // Message retrieves the message associated with this context.
@@ -96,6 +128,15 @@ func (ctx *Context) Charge(cost types.GasUnits) error {
 	return ctx.gasTracker.Charge(cost)
 }
 
+// GasPrices returns the gas prices in effect for the message. All prices are
+// zero if the context charges nothing.
+func (ctx *Context) GasPrices() *types.PriceList {
+	if ctx.gasPrices == nil {
+		return &types.PriceList{}
+	}
+	return ctx.gasPrices
+}
+
 // GasUnits retrieves the gas cost so far
 func (ctx *Context) GasUnits() types.GasUnits {
 	return ctx.gasTracker.gasConsumedByMessage
@@ -133,6 +174,14 @@ func (ctx *Context) IsFromAccountActor() bool {
 func (ctx *Context) Send(to address.Address, method string, value *types.AttoFIL, params []interface{}) ([][]byte, uint8, error) {
 	deps := ctx.deps
 
+	if ctx.depth >= MaxSendDepth {
+		return nil, exec.ErrSendDepthExceeded, exec.Errors[exec.ErrSendDepthExceeded]
+	}
+
+	if err := ctx.Charge(ctx.GasPrices().Send); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
 	// the message sender is the `to` actor, so this is what we set as `from` in the new message
 	from := ctx.Message().To
 	fromActor := ctx.to
@@ -147,13 +196,24 @@ func (ctx *Context) Send(to address.Address, method string, value *types.AttoFIL
 		return nil, 1, errors.RevertErrorWrap(err, "encoding params failed")
 	}
 
+	if ctx.state != nil {
+		resolved, err := ResolveAddress(context.TODO(), ctx.state, ctx.storageMap, to)
+		if err != nil {
+			return nil, errors.CodeError(err), err
+		}
+		to = resolved
+	}
+
 	msg := types.NewMessage(from, to, 0, value, method, paramData)
 	if msg.From == msg.To {
-		// TODO: handle this
-		return nil, 1, errors.NewFaultErrorf("unhandled: sending to self (%s)", msg.From)
+		// TODO: handle this. Deployed code may send to itself, so this must
+		// not be a fault.
+		return nil, 1, errors.NewRevertErrorf("unhandled: sending to self (%s)", msg.From)
 	}
 
+	created := false
 	toActor, err := deps.GetOrCreateActor(context.TODO(), msg.To, func() (*actor.Actor, error) {
+		created = true
 		return &actor.Actor{}, nil
 	})
 	if err != nil {
@@ -167,16 +227,32 @@ func (ctx *Context) Send(to address.Address, method string, value *types.AttoFIL
 		State:       ctx.state,
 		StorageMap:  ctx.storageMap,
 		GasTracker:  ctx.gasTracker,
+		GasPrices:   ctx.gasPrices,
 		BlockHeight: ctx.blockHeight,
 		Ancestors:   ctx.ancestors,
+		Tracer:      ctx.tracer,
 	}
 	innerCtx := NewVMContext(innerParams)
+	innerCtx.events = ctx.events
+	innerCtx.depth = ctx.depth + 1
 
+	// The events of the inner call are dropped if it fails, as its state
+	// changes are.
+	mark := len(ctx.events.events)
 	out, ret, err := deps.Send(context.Background(), innerCtx)
+	if err != nil || ret != 0 {
+		ctx.events.events = ctx.events.events[:mark]
+	}
 	if err != nil {
 		return nil, ret, err
 	}
 
+	if created && ctx.state != nil {
+		if err := RegisterActorID(context.TODO(), ctx.state, ctx.storageMap, msg.To); err != nil {
+			return nil, errors.CodeError(err), err
+		}
+	}
+
 	return out, ret, nil
 }
 
@@ -205,6 +281,10 @@ func computeActorAddress(creator address.Address, nonce uint64) (address.Address
 // CreateNewActor creates and initializes an actor at the given address.
 // If the address is occupied by a non-empty actor, this method will fail.
 func (ctx *Context) CreateNewActor(addr address.Address, code cid.Cid, initializerData interface{}) error {
+	if err := ctx.Charge(ctx.GasPrices().CreateActor); err != nil {
+		return errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
 	// Check existing address. If nothing there, create empty actor.
 	newActor, err := ctx.state.GetOrCreateActor(context.TODO(), addr, func() (*actor.Actor, error) {
 		return &actor.Actor{}, nil
@@ -221,13 +301,17 @@ func (ctx *Context) CreateNewActor(addr address.Address, code cid.Cid, initializ
 	// make this the right 'type' of actor
 	newActor.Code = code
 
-	childStorage := ctx.storageMap.NewStorage(addr, newActor)
+	if err := RegisterActorID(context.TODO(), ctx.state, ctx.storageMap, addr); err != nil {
+		return err
+	}
+
+	childStorage := ctx.storageMap.NewStorage(addr, newActor).withGas(ctx.gasTracker, ctx.gasPrices)
 	execActor, err := ctx.state.GetBuiltinActorCode(code)
 	if err != nil {
 		return errors.NewRevertErrorf("attempt to create executable actor from non-existent code %s", code.String())
 	}
 
-	err = execActor.InitializeState(childStorage, initializerData)
+	err = execActor.InitializeState(ctx.traceStorage(childStorage), initializerData)
 	if err != nil {
 		if !errors.ShouldRevert(err) && !errors.IsFault(err) {
 			return errors.RevertErrorWrap(err, "Could not initialize actor state")
@@ -238,6 +322,72 @@ func (ctx *Context) CreateNewActor(addr address.Address, code cid.Cid, initializ
 	return nil
 }
 
+// DeployActor creates an actor at the given address running the given
+// WebAssembly code. The code is stored in the storage of the actor and its
+// CID, returned, is the code of the actor. If the address is occupied by a
+// non-empty actor, this method will fail.
+func (ctx *Context) DeployActor(addr address.Address, code []byte) (cid.Cid, error) {
+	if err := ctx.Charge(ctx.GasPrices().CreateActor); err != nil {
+		return cid.Undef, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	newActor, err := ctx.state.GetOrCreateActor(context.TODO(), addr, func() (*actor.Actor, error) {
+		return &actor.Actor{}, nil
+	})
+	if err != nil {
+		return cid.Undef, errors.FaultErrorWrap(err, "Error retrieving or creating actor")
+	}
+	if !newActor.Empty() {
+		return cid.Undef, errors.NewRevertErrorf("attempt to deploy actor at address %s but a non-empty actor is already installed", addr.String())
+	}
+
+	childStorage := ctx.storageMap.NewStorage(addr, newActor).withGas(ctx.gasTracker, ctx.gasPrices)
+	codeCid, err := wasmactor.Deploy(ctx.traceStorage(childStorage), code)
+	if err != nil {
+		return cid.Undef, err
+	}
+	newActor.Code = codeCid
+
+	if err := RegisterActorID(context.TODO(), ctx.state, ctx.storageMap, addr); err != nil {
+		return cid.Undef, err
+	}
+	return codeCid, nil
+}
+
+// Emit records an event of the actor receiving the message. The gas charged
+// grows with the size of the topic and the encoded data.
+func (ctx *Context) Emit(topic string, data interface{}) error {
+	var raw []byte
+	if data != nil {
+		var err error
+		raw, err = cbor.DumpObject(data)
+		if err != nil {
+			return errors.FaultErrorWrap(err, "failed to encode event data")
+		}
+	}
+	if err := ctx.Charge(ctx.GasPrices().EmitEventCost(len(topic) + len(raw))); err != nil {
+		return errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	ctx.events.events = append(ctx.events.events, &types.Event{
+		Emitter: ctx.message.To,
+		Topic:   topic,
+		Data:    raw,
+	})
+	return nil
+}
+
+// Events returns the events emitted while processing the message, including
+// the messages it sent.
+func (ctx *Context) Events() []*types.Event {
+	return ctx.events.events
+}
+
+// eventLog collects the events emitted by actors.
+type eventLog struct {
+	events []*types.Event
+}
+
 // SampleChainRandomness samples randomness from a block's ancestors at the
 // given height.
 func (ctx *Context) SampleChainRandomness(sampleHeight *types.BlockHeight) ([]byte, error) {
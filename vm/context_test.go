@@ -250,13 +250,17 @@ func TestVMContextSendFailures(t *testing.T) {
 		require := require.New(t)
 
 		ctx := context.Background()
-		vmctx := NewVMContext(vmCtxParams)
+		// The actor is registered with the init actor, looked up in a real
+		// state tree.
+		tree := state.NewCachedStateTree(state.NewEmptyStateTreeWithActors(hamt.NewCborStore(), mockStateTree.BuiltinActors))
+		params := vmCtxParams
+		params.State = tree
+		vmctx := NewVMContext(params)
 		addr, err := vmctx.AddressForNewActor()
 
 		require.NoError(err)
 
-		params := &actor.FakeActorStorage{}
-		err = vmctx.CreateNewActor(addr, fakeActorCid, params)
+		err = vmctx.CreateNewActor(addr, fakeActorCid, &actor.FakeActorStorage{})
 		require.NoError(err)
 
 		act, err := tree.GetActor(ctx, addr)
@@ -272,6 +276,175 @@ func TestVMContextSendFailures(t *testing.T) {
 
 }
 
+func TestVMContextChargesGas(t *testing.T) {
+	newMsg := types.NewMessageForTestGetter()
+	newAddress := address.NewForTestGetter()
+	sendDeps := func() *deps {
+		return &deps{
+			EncodeValues: func(_ []*abi.Value) ([]byte, error) { return nil, nil },
+			GetOrCreateActor: func(_ context.Context, _ address.Address, f func() (*actor.Actor, error)) (*actor.Actor, error) {
+				return f()
+			},
+			Send:     func(ctx context.Context, vmCtx *Context) ([][]byte, uint8, error) { return nil, 0, nil },
+			ToValues: func(_ []interface{}) ([]*abi.Value, error) { return nil, nil },
+		}
+	}
+
+	t.Run("charges the price of sends", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		gasTracker := NewGasTracker()
+		gasTracker.MsgGasLimit = types.NewGasUnits(10)
+		ctx := NewVMContext(NewContextParams{
+			Message:    newMsg(),
+			GasTracker: gasTracker,
+			GasPrices:  &types.PriceList{Send: 7},
+		})
+		ctx.deps = sendDeps()
+
+		_, code, err := ctx.Send(newAddress(), "foo", nil, []interface{}{})
+		require.NoError(err)
+		assert.Equal(0, int(code))
+		assert.Equal(types.NewGasUnits(7), ctx.GasUnits())
+
+		_, code, err = ctx.Send(newAddress(), "foo", nil, []interface{}{})
+		assert.Error(err)
+		assert.Equal(exec.ErrInsufficientGas, int(code))
+	})
+
+	t.Run("charges nothing without prices", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		ctx := NewVMContext(NewContextParams{
+			Message:    newMsg(),
+			GasTracker: NewGasTracker(),
+		})
+		ctx.deps = sendDeps()
+
+		_, _, err := ctx.Send(newAddress(), "foo", nil, []interface{}{})
+		require.NoError(err)
+		assert.Equal(types.NewGasUnits(0), ctx.GasUnits())
+		assert.Equal(&types.PriceList{}, ctx.GasPrices())
+	})
+}
+
+func TestVMContextEmit(t *testing.T) {
+	newMsg := types.NewMessageForTestGetter()
+	newAddress := address.NewForTestGetter()
+
+	t.Run("records events of the receiving actor", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		gasTracker := NewGasTracker()
+		gasTracker.MsgGasLimit = types.NewGasUnits(1000)
+		msg := newMsg()
+		ctx := NewVMContext(NewContextParams{
+			Message:    msg,
+			GasTracker: gasTracker,
+			GasPrices:  &types.PriceList{EmitEventBase: 3, EmitEventPerByte: 2},
+		})
+
+		require.NoError(ctx.Emit("created", nil))
+		require.NoError(ctx.Emit("redeemed", types.NewAttoFILFromFIL(5)))
+
+		events := ctx.Events()
+		require.Len(events, 2)
+		size := len("created") + len("redeemed") + len(events[1].Data)
+		assert.Equal(types.NewGasUnits(uint64(2*3+2*size)), ctx.GasUnits())
+		assert.Equal(msg.To, events[0].Emitter)
+		assert.Equal("created", events[0].Topic)
+		assert.Empty(events[0].Data)
+		assert.Equal("redeemed", events[1].Topic)
+		var amount types.AttoFIL
+		require.NoError(cbor.DecodeInto(events[1].Data, &amount))
+		assert.Equal(types.NewAttoFILFromFIL(5), &amount)
+	})
+
+	t.Run("reverts when the gas does not cover the size of the event", func(t *testing.T) {
+		assert := assert.New(t)
+
+		gasTracker := NewGasTracker()
+		gasTracker.MsgGasLimit = types.NewGasUnits(10)
+		ctx := NewVMContext(NewContextParams{
+			Message:    newMsg(),
+			GasTracker: gasTracker,
+			GasPrices:  &types.PriceList{EmitEventBase: 3, EmitEventPerByte: 1},
+		})
+
+		err := ctx.Emit("redeemed", nil)
+		assert.Error(err)
+		assert.True(errors.ShouldRevert(err))
+		assert.Empty(ctx.Events())
+	})
+
+	t.Run("drops events of failed sends", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		ctx := NewVMContext(NewContextParams{
+			Message:    newMsg(),
+			GasTracker: NewGasTracker(),
+		})
+		ctx.deps = &deps{
+			EncodeValues: func(_ []*abi.Value) ([]byte, error) { return nil, nil },
+			GetOrCreateActor: func(_ context.Context, _ address.Address, f func() (*actor.Actor, error)) (*actor.Actor, error) {
+				return f()
+			},
+			Send: func(_ context.Context, vmCtx *Context) ([][]byte, uint8, error) {
+				if err := vmCtx.Emit(vmCtx.Message().Method, nil); err != nil {
+					return nil, 1, err
+				}
+				if vmCtx.Message().Method == "fail" {
+					return nil, 1, errors.NewRevertError("failed")
+				}
+				return nil, 0, nil
+			},
+			ToValues: func(_ []interface{}) ([]*abi.Value, error) { return nil, nil },
+		}
+
+		_, _, err := ctx.Send(newAddress(), "succeed", nil, []interface{}{})
+		require.NoError(err)
+		_, _, err = ctx.Send(newAddress(), "fail", nil, []interface{}{})
+		require.Error(err)
+
+		events := ctx.Events()
+		require.Len(events, 1)
+		assert.Equal("succeed", events[0].Topic)
+	})
+}
+
+func TestVMContextSendDepth(t *testing.T) {
+	assert := assert.New(t)
+
+	newAddress := address.NewForTestGetter()
+	ctx := NewVMContext(NewContextParams{
+		Message:    types.NewMessageForTestGetter()(),
+		GasTracker: NewGasTracker(),
+	})
+	depth := 0
+	ctx.deps = &deps{
+		EncodeValues: func(_ []*abi.Value) ([]byte, error) { return nil, nil },
+		GetOrCreateActor: func(_ context.Context, _ address.Address, f func() (*actor.Actor, error)) (*actor.Actor, error) {
+			return f()
+		},
+		// Each message sends another one, without end.
+		Send: func(_ context.Context, vmCtx *Context) ([][]byte, uint8, error) {
+			depth++
+			vmCtx.deps = ctx.deps
+			return vmCtx.Send(newAddress(), "recurse", nil, []interface{}{})
+		},
+		ToValues: func(_ []interface{}) ([]*abi.Value, error) { return nil, nil },
+	}
+
+	_, code, err := ctx.Send(newAddress(), "recurse", nil, []interface{}{})
+	assert.Equal(exec.Errors[exec.ErrSendDepthExceeded], err)
+	assert.Equal(uint8(exec.ErrSendDepthExceeded), code)
+	assert.Equal(MaxSendDepth, depth)
+}
+
 func TestVMContextIsAccountActor(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -18,9 +18,10 @@ import (
 // have a constructor that checked for this or do more elaborate
 // wrapping (basically duplicating what's in errors.Wrap).
 type RevertError struct {
-	err  error
-	msg  string
-	code uint8
+	err      error
+	msg      string
+	code     uint8
+	outOfGas bool
 }
 
 func (re RevertError) Error() string {
@@ -71,6 +72,21 @@ func (re RevertError) Code() uint8 {
 	return re.code
 }
 
+// NewOutOfGasError creates the RevertError of a message exceeding its gas
+// limit. Unlike other errors, FaultErrorWrap and FaultErrorWrapf return it
+// unchanged: running out of gas while an actor reads or writes its storage
+// is the fault of the message, not of the system.
+func NewOutOfGasError(msg string) error {
+	return &RevertError{err: nil, msg: msg, code: 1, outOfGas: true}
+}
+
+// IsOutOfGas indicates the message ran out of gas. It looks at the root
+// Cause() to make that judgement.
+func IsOutOfGas(err error) bool {
+	re, ok := errors.Cause(err).(*RevertError)
+	return ok && re.outOfGas
+}
+
 type reverterror interface {
 	ShouldRevert() bool
 }
@@ -121,14 +137,22 @@ func NewFaultErrorf(format string, args ...interface{}) error {
 	return NewFaultError(fmt.Sprintf(format, args...))
 }
 
-// FaultErrorWrap wraps a given error in a FaultError.
+// FaultErrorWrap wraps a given error in a FaultError, unless it is an out of
+// gas error, which it returns unchanged.
 func FaultErrorWrap(err error, msg string) error {
+	if IsOutOfGas(err) {
+		return err
+	}
 	return &FaultError{err: err, msg: msg}
 }
 
 // FaultErrorWrapf wraps a given error in a FaultError and adds a message
-// using Sprintf formatting.
+// using Sprintf formatting, unless it is an out of gas error, which it
+// returns unchanged.
 func FaultErrorWrapf(err error, format string, args ...interface{}) error {
+	if IsOutOfGas(err) {
+		return err
+	}
 	return &FaultError{err: err, msg: fmt.Sprintf(format, args...)}
 }
 
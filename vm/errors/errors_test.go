@@ -49,6 +49,22 @@ func TestRevertError(t *testing.T) {
 	assert.Equal(re, errors.Cause(wrapped2))
 }
 
+func TestOutOfGasError(t *testing.T) {
+	assert := assert.New(t)
+
+	oog := NewOutOfGasError("out of gas")
+	assert.True(IsOutOfGas(oog))
+	assert.True(ShouldRevert(oog))
+	assert.False(IsOutOfGas(NewRevertError("boom")))
+	assert.False(IsOutOfGas(errors.New("boom")))
+
+	// Fault wrappers pass out of gas errors through.
+	assert.Equal(oog, FaultErrorWrap(oog, "msg"))
+	assert.Equal(oog, errors.Cause(FaultErrorWrapf(errors.Wrap(oog, "wrapped"), "%d", 42)))
+	assert.False(IsFault(FaultErrorWrap(errors.Wrap(oog, "wrapped"), "msg")))
+	assert.True(ShouldRevert(FaultErrorWrap(errors.Wrap(oog, "wrapped"), "msg")))
+}
+
 func TestApplyErrorPermanent(t *testing.T) {
 	t.Run("random errors dont satisfy", func(t *testing.T) {
 		assert := assert.New(t)
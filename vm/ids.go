@@ -0,0 +1,41 @@
+package vm
+
+import (
+	"context"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin/initactor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/vm/errors"
+)
+
+// ResolveAddress returns the address of the actor an ID address is assigned
+// to. Other addresses are returned as they are. The state of the init actor
+// is read through the storage map, so IDs assigned by the messages of the
+// block being processed are resolved too.
+func ResolveAddress(ctx context.Context, st *state.CachedTree, store StorageMap, addr address.Address) (address.Address, error) {
+	if addr.Protocol() != address.ID {
+		return addr, nil
+	}
+
+	initActor, err := st.GetActor(ctx, address.InitAddress)
+	if state.IsActorNotFoundError(err) {
+		return address.Undef, errors.NewRevertErrorf("no actor assigned ID address %s", addr)
+	} else if err != nil {
+		return address.Undef, errors.FaultErrorWrap(err, "failed to get init actor")
+	}
+	return initactor.LookupAddress(ctx, store.NewStorage(address.InitAddress, initActor), addr)
+}
+
+// RegisterActorID assigns the next ID to a newly created actor. Nothing is
+// assigned in a state without an init actor.
+func RegisterActorID(ctx context.Context, st *state.CachedTree, store StorageMap, addr address.Address) error {
+	initActor, err := st.GetActor(ctx, address.InitAddress)
+	if state.IsActorNotFoundError(err) {
+		return nil
+	} else if err != nil {
+		return errors.FaultErrorWrap(err, "failed to get init actor")
+	}
+	_, err = initactor.RegisterAddress(ctx, store.NewStorage(address.InitAddress, initActor), addr)
+	return err
+}
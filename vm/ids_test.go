@@ -0,0 +1,90 @@
+package vm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-hamt-ipld"
+	"github.com/ipfs/go-ipfs-blockstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/initactor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm/errors"
+)
+
+func TestActorIDs(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx := context.Background()
+	newAddress := address.NewForTestGetter()
+	fakeActorCid := types.NewCidForTestGetter()()
+	builtinActors := map[cid.Cid]exec.ExecutableActor{
+		types.InitActorCodeCid: &initactor.Actor{},
+		fakeActorCid:           &actor.FakeActor{},
+	}
+	vms := NewStorageMap(blockstore.NewBlockstore(datastore.NewMapDatastore()))
+	st := state.NewEmptyStateTreeWithActors(hamt.NewCborStore(), builtinActors)
+	initActor := initactor.NewActor()
+	require.NoError((&initactor.Actor{}).InitializeState(vms.NewStorage(address.InitAddress, initActor), nil))
+	require.NoError(st.SetActor(ctx, address.InitAddress, initActor))
+	tree := state.NewCachedStateTree(st)
+
+	msg := types.NewMessage(newAddress(), newAddress(), 0, nil, "", nil)
+	gasTracker := NewGasTracker()
+	gasTracker.MsgGasLimit = types.BlockGasLimit
+	vmctx := NewVMContext(NewContextParams{
+		From:        actor.NewActor(types.AccountActorCodeCid, types.NewAttoFILFromFIL(100)),
+		To:          actor.NewActor(types.AccountActorCodeCid, types.NewAttoFILFromFIL(100)),
+		Message:     msg,
+		State:       tree,
+		StorageMap:  vms,
+		GasTracker:  gasTracker,
+		BlockHeight: types.NewBlockHeight(0),
+	})
+	id0, err := address.NewIDAddress(0)
+	require.NoError(err)
+	id1, err := address.NewIDAddress(1)
+	require.NoError(err)
+
+	// IDs are assigned in order to created actors.
+	created, err := vmctx.AddressForNewActor()
+	require.NoError(err)
+	require.NoError(vmctx.CreateNewActor(created, fakeActorCid, &actor.FakeActorStorage{}))
+	funded := newAddress()
+	_, code, err := vmctx.Send(funded, "", types.NewAttoFILFromFIL(10), nil)
+	require.NoError(err)
+	require.Equal(uint8(0), code)
+
+	resolved, err := ResolveAddress(ctx, tree, vms, id0)
+	require.NoError(err)
+	assert.Equal(created, resolved)
+	resolved, err = ResolveAddress(ctx, tree, vms, id1)
+	require.NoError(err)
+	assert.Equal(funded, resolved)
+
+	// Sends to an ID address reach the actor it is assigned to.
+	_, code, err = vmctx.Send(id1, "", types.NewAttoFILFromFIL(5), nil)
+	require.NoError(err)
+	require.Equal(uint8(0), code)
+	fundedActor, err := tree.GetActor(ctx, funded)
+	require.NoError(err)
+	assert.Equal(types.NewAttoFILFromFIL(15), fundedActor.Balance)
+
+	// Other addresses resolve to themselves and unassigned IDs fail.
+	resolved, err = ResolveAddress(ctx, tree, vms, funded)
+	require.NoError(err)
+	assert.Equal(funded, resolved)
+	unassigned, err := address.NewIDAddress(100)
+	require.NoError(err)
+	_, err = ResolveAddress(ctx, tree, vms, unassigned)
+	assert.True(errors.ShouldRevert(err))
+}
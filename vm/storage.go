@@ -89,6 +89,9 @@ type Storage struct {
 	actor      *actor.Actor
 	chunks     map[cid.Cid]ipld.Node
 	blockstore blockstore.Blockstore
+	// gasTracker, if set, is charged the prices of the reads and writes.
+	gasTracker *GasTracker
+	prices     *types.PriceList
 }
 
 var _ exec.Storage = (*Storage)(nil)
@@ -102,6 +105,19 @@ func NewStorage(bs blockstore.Blockstore, act *actor.Actor) Storage {
 	}
 }
 
+// withGas returns a copy of the storage charging the reads and writes to the
+// gas tracker at the given prices. A nil tracker or prices charges nothing.
+func (s Storage) withGas(gasTracker *GasTracker, prices *types.PriceList) Storage {
+	s.gasTracker = gasTracker
+	s.prices = prices
+	return s
+}
+
+// metered is true when the storage charges its reads and writes.
+func (s Storage) metered() bool {
+	return s.gasTracker != nil && s.prices != nil
+}
+
 // Put adds a node to temporary storage by id.
 func (s Storage) Put(v interface{}) (cid.Cid, error) {
 	var nd format.Node
@@ -117,6 +133,11 @@ func (s Storage) Put(v interface{}) (cid.Cid, error) {
 	if err != nil {
 		return cid.Undef, exec.Errors[exec.ErrDecode]
 	}
+	if s.metered() {
+		if err := s.gasTracker.Charge(s.prices.StoragePutCost(len(nd.RawData()))); err != nil {
+			return cid.Undef, err
+		}
+	}
 
 	c := nd.Cid()
 	s.chunks[c] = nd
@@ -127,20 +148,26 @@ func (s Storage) Put(v interface{}) (cid.Cid, error) {
 // Get retrieves a chunk from either temporary storage or its backing store.
 // If the chunk is not found in storage, a vm.ErrNotFound error is returned.
 func (s Storage) Get(cid cid.Cid) ([]byte, error) {
-	n, ok := s.chunks[cid]
-	if ok {
-		return n.RawData(), nil
+	var data []byte
+	if n, ok := s.chunks[cid]; ok {
+		data = n.RawData()
+	} else {
+		blk, err := s.blockstore.Get(cid)
+		if err != nil {
+			if err == blockstore.ErrNotFound {
+				return []byte{}, ErrNotFound
+			}
+			return []byte{}, err
+		}
+		data = blk.RawData()
 	}
 
-	blk, err := s.blockstore.Get(cid)
-	if err != nil {
-		if err == blockstore.ErrNotFound {
-			return []byte{}, ErrNotFound
+	if s.metered() {
+		if err := s.gasTracker.Charge(s.prices.StorageGetCost(len(data))); err != nil {
+			return []byte{}, err
 		}
-		return []byte{}, err
 	}
-
-	return blk.RawData(), nil
+	return data, nil
 }
 
 // Commit updates the head of the current actor to the given cid.
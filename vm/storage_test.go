@@ -97,6 +97,48 @@ func TestGetAndPutWithEmptyStorage(t *testing.T) {
 	})
 }
 
+func TestStorageChargesGas(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+	vms := NewStorageMap(bs)
+	testActor := actor.NewActor(types.AccountActorCodeCid, types.NewZeroAttoFIL())
+	prices := &types.PriceList{
+		StorageGetBase:   1,
+		StorageGetPerKiB: 10,
+		StoragePutBase:   2,
+		StoragePutPerKiB: 20,
+	}
+
+	data, err := cbor.DumpObject("some data an actor might store")
+	require.NoError(err)
+
+	gasTracker := NewGasTracker()
+	gasTracker.MsgGasLimit = types.NewGasUnits(1000)
+	as := vms.NewStorage(address.TestAddress, testActor).withGas(gasTracker, prices)
+
+	id, err := as.Put(data)
+	require.NoError(err)
+	assert.Equal(types.NewGasUnits(22), gasTracker.gasConsumedByMessage)
+
+	_, err = as.Get(id)
+	require.NoError(err)
+	assert.Equal(types.NewGasUnits(33), gasTracker.gasConsumedByMessage)
+
+	// The storage of the map is not metered.
+	_, err = vms.NewStorage(address.TestAddress, testActor).Get(id)
+	require.NoError(err)
+	assert.Equal(types.NewGasUnits(33), gasTracker.gasConsumedByMessage)
+
+	// Operations fail when they exceed the gas limit.
+	gasTracker.MsgGasLimit = types.NewGasUnits(40)
+	_, err = as.Put(data)
+	assert.EqualError(err, "gas cost exceeds gas limit")
+	_, err = as.Get(id)
+	assert.EqualError(err, "gas cost exceeds gas limit")
+}
+
 func TestGetAndPutWithDataInStorage(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
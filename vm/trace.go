@@ -0,0 +1,170 @@
+package vm
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// The kinds of the storage operations of a trace.
+const (
+	StoragePut    = "put"
+	StorageCommit = "commit"
+)
+
+// StorageOp is an operation on the storage of an actor during a call.
+type StorageOp struct {
+	// Kind is StoragePut or StorageCommit.
+	Kind string
+	// Cid is the cid of the chunk put, or the new head committed.
+	Cid cid.Cid
+	// Prev is the head replaced by a commit, nil for a put.
+	Prev *cid.Cid `json:",omitempty"`
+}
+
+// TraceFrame is a call in the call tree of a message: the message itself or
+// a message sent by an actor while handling it.
+type TraceFrame struct {
+	From     address.Address
+	To       address.Address
+	Method   string
+	Value    *types.AttoFIL
+	Params   []byte
+	Return   [][]byte
+	ExitCode uint8
+	// GasCharged is the gas charged during the call, including its calls.
+	GasCharged types.GasUnits
+	// Error is the error of the call, empty if it succeeded.
+	Error   string `json:",omitempty"`
+	Storage []StorageOp
+	Calls   []*TraceFrame
+}
+
+// Tracer records the call trees of the messages applied with it. Set it in
+// the NewContextParams of a message, or in the context of a processor with
+// WithTracer. A Tracer is not safe for concurrent use.
+type Tracer struct {
+	// stack holds the calls being executed, innermost last.
+	stack []*TraceFrame
+	// last is the root of the last call tree completed.
+	last *TraceFrame
+	// traces maps message cids to their call trees.
+	traces map[string]*TraceFrame
+}
+
+// NewTracer returns a Tracer with no traces.
+func NewTracer() *Tracer {
+	return &Tracer{traces: make(map[string]*TraceFrame)}
+}
+
+// Finish records the calls traced since the last call to Finish as the trace
+// of the message with the given cid. No trace is recorded if no call was
+// made, e.g. when the message was rejected before reaching the VM.
+func (t *Tracer) Finish(msgCid cid.Cid) {
+	if t.last != nil {
+		t.traces[msgCid.String()] = t.last
+	}
+	t.last = nil
+	t.stack = nil
+}
+
+// Trace returns the call tree of the message with the given cid.
+func (t *Tracer) Trace(msgCid cid.Cid) (*TraceFrame, bool) {
+	frame, ok := t.traces[msgCid.String()]
+	return frame, ok
+}
+
+// enter records the start of the call of a context and returns its frame.
+func (t *Tracer) enter(vmCtx *Context) *TraceFrame {
+	msg := vmCtx.message
+	frame := &TraceFrame{
+		From:       msg.From,
+		To:         msg.To,
+		Method:     msg.Method,
+		Value:      msg.Value,
+		Params:     msg.Params,
+		GasCharged: vmCtx.GasUnits(),
+	}
+	if len(t.stack) > 0 {
+		parent := t.stack[len(t.stack)-1]
+		parent.Calls = append(parent.Calls, frame)
+	}
+	t.stack = append(t.stack, frame)
+	return frame
+}
+
+// exit records the end of the call of a frame. gasUnits is the gas charged
+// for the message so far.
+func (t *Tracer) exit(frame *TraceFrame, ret [][]byte, exitCode uint8, err error, gasUnits types.GasUnits) {
+	frame.Return = ret
+	frame.ExitCode = exitCode
+	frame.GasCharged = gasUnits - frame.GasCharged
+	if err != nil {
+		frame.Error = err.Error()
+	}
+	t.stack = t.stack[:len(t.stack)-1]
+	if len(t.stack) == 0 {
+		t.last = frame
+	}
+}
+
+// recordStorage records a storage operation in the current call.
+func (t *Tracer) recordStorage(op StorageOp) {
+	if len(t.stack) == 0 {
+		return
+	}
+	frame := t.stack[len(t.stack)-1]
+	frame.Storage = append(frame.Storage, op)
+}
+
+// tracedStorage records the puts and commits of a storage in a tracer.
+type tracedStorage struct {
+	exec.Storage
+	tracer *Tracer
+}
+
+func (s *tracedStorage) Put(v interface{}) (cid.Cid, error) {
+	c, err := s.Storage.Put(v)
+	if err == nil {
+		s.tracer.recordStorage(StorageOp{Kind: StoragePut, Cid: c})
+	}
+	return c, err
+}
+
+func (s *tracedStorage) Commit(newCid cid.Cid, oldCid cid.Cid) error {
+	err := s.Storage.Commit(newCid, oldCid)
+	if err == nil {
+		s.tracer.recordStorage(StorageOp{Kind: StorageCommit, Cid: newCid, Prev: &oldCid})
+	}
+	return err
+}
+
+// tracedSend sends a message with send, recording the call in the tracer of
+// the context if it has one.
+func tracedSend(ctx context.Context, deps sendDeps, vmCtx *Context) ([][]byte, uint8, error) {
+	if vmCtx.tracer == nil {
+		return send(ctx, deps, vmCtx)
+	}
+	frame := vmCtx.tracer.enter(vmCtx)
+	ret, exitCode, err := send(ctx, deps, vmCtx)
+	vmCtx.tracer.exit(frame, ret, exitCode, err, vmCtx.GasUnits())
+	return ret, exitCode, err
+}
+
+type tracerKey struct{}
+
+// WithTracer returns a context in which the messages applied by a processor
+// are traced by t.
+func WithTracer(ctx context.Context, t *Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, t)
+}
+
+// TracerFromContext returns the tracer set in ctx with WithTracer, or nil.
+func TracerFromContext(ctx context.Context) *Tracer {
+	t, _ := ctx.Value(tracerKey{}).(*Tracer)
+	return t
+}
@@ -0,0 +1,192 @@
+package vm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-hamt-ipld"
+	"github.com/ipfs/go-ipfs-blockstore"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	xerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/account"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestTracerSend(t *testing.T) {
+	newMsg := types.NewMessageForTestGetter()
+	bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+	vms := NewStorageMap(bs)
+	tree := state.NewCachedStateTree(&state.MockStateTree{NoMocks: true})
+
+	newTracedContext := func(msg *types.Message, tracer *Tracer) *Context {
+		return NewVMContext(NewContextParams{
+			From:        actor.NewActor(types.SomeCid(), types.NewAttoFILFromFIL(100)),
+			To:          actor.NewActor(types.SomeCid(), types.NewAttoFILFromFIL(50)),
+			Message:     msg,
+			State:       tree,
+			StorageMap:  vms,
+			GasTracker:  NewGasTracker(),
+			BlockHeight: types.NewBlockHeight(0),
+			Tracer:      tracer,
+		})
+	}
+
+	t.Run("records a transfer", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		msg := newMsg()
+		msg.Value = types.NewAttoFILFromFIL(10)
+		msg.Method = ""
+		msgCid, err := msg.Cid()
+		require.NoError(err)
+
+		tracer := NewTracer()
+		_, code, err := tracedSend(context.Background(), sendDeps{transfer: Transfer}, newTracedContext(msg, tracer))
+		require.NoError(err)
+		assert.Equal(uint8(0), code)
+
+		_, ok := tracer.Trace(msgCid)
+		assert.False(ok)
+		tracer.Finish(msgCid)
+		frame, ok := tracer.Trace(msgCid)
+		require.True(ok)
+		assert.Equal(msg.From, frame.From)
+		assert.Equal(msg.To, frame.To)
+		assert.Equal(msg.Value, frame.Value)
+		assert.Equal(uint8(0), frame.ExitCode)
+		assert.Empty(frame.Error)
+		assert.Empty(frame.Calls)
+	})
+
+	t.Run("records a failure", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		msg := newMsg()
+		msg.Value = types.NewAttoFILFromFIL(1)
+		msgCid, err := msg.Cid()
+		require.NoError(err)
+
+		deps := sendDeps{
+			transfer: func(_ *actor.Actor, _ *actor.Actor, _ *types.AttoFIL) error {
+				return xerrors.New("error")
+			},
+		}
+		tracer := NewTracer()
+		_, code, err := tracedSend(context.Background(), deps, newTracedContext(msg, tracer))
+		assert.Error(err)
+		tracer.Finish(msgCid)
+
+		frame, ok := tracer.Trace(msgCid)
+		require.True(ok)
+		assert.Equal(code, frame.ExitCode)
+		assert.Equal("error", frame.Error)
+	})
+
+	t.Run("does not record untraced messages", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		msg := newMsg()
+		msgCid, err := msg.Cid()
+		require.NoError(err)
+
+		tracer := NewTracer()
+		tracer.Finish(msgCid)
+		_, ok := tracer.Trace(msgCid)
+		assert.False(ok)
+	})
+}
+
+func TestTracerCallTree(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	newMsg := types.NewMessageForTestGetter()
+	gasTracker := NewGasTracker()
+	gasTracker.MsgGasLimit = types.NewGasUnits(1000)
+	tracer := NewTracer()
+	newContext := func(msg *types.Message) *Context {
+		return NewVMContext(NewContextParams{Message: msg, GasTracker: gasTracker, Tracer: tracer})
+	}
+
+	outer, inner := newMsg(), newMsg()
+	outerCtx, innerCtx := newContext(outer), newContext(inner)
+
+	outerFrame := tracer.enter(outerCtx)
+	require.NoError(outerCtx.Charge(types.NewGasUnits(10)))
+	innerFrame := tracer.enter(innerCtx)
+	require.NoError(innerCtx.Charge(types.NewGasUnits(5)))
+	tracer.exit(innerFrame, [][]byte{{1}}, 0, nil, innerCtx.GasUnits())
+	require.NoError(outerCtx.Charge(types.NewGasUnits(1)))
+	tracer.exit(outerFrame, nil, 2, xerrors.New("failed"), outerCtx.GasUnits())
+
+	outerCid, err := outer.Cid()
+	require.NoError(err)
+	tracer.Finish(outerCid)
+
+	frame, ok := tracer.Trace(outerCid)
+	require.True(ok)
+	assert.Equal(types.NewGasUnits(16), frame.GasCharged)
+	assert.Equal(uint8(2), frame.ExitCode)
+	assert.Equal("failed", frame.Error)
+	require.Len(frame.Calls, 1)
+	assert.Equal(inner.To, frame.Calls[0].To)
+	assert.Equal(types.NewGasUnits(5), frame.Calls[0].GasCharged)
+	assert.Equal([][]byte{{1}}, frame.Calls[0].Return)
+}
+
+func TestTracerStorage(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx := context.Background()
+	cst := hamt.NewCborStore()
+	st := state.NewEmptyStateTree(cst)
+	cstate := state.NewCachedStateTree(st)
+	vms := NewStorageMap(blockstore.NewBlockstore(datastore.NewMapDatastore()))
+	addrGetter := address.NewForTestGetter()
+
+	toActor, err := account.NewActor(nil)
+	require.NoError(err)
+	toAddr := addrGetter()
+	require.NoError(st.SetActor(ctx, toAddr, toActor))
+	to, err := cstate.GetActor(ctx, toAddr)
+	require.NoError(err)
+
+	tracer := NewTracer()
+	msg := types.NewMessage(addrGetter(), toAddr, 0, nil, "hello", nil)
+	vmCtx := NewVMContext(NewContextParams{
+		To:          to,
+		Message:     msg,
+		State:       cstate,
+		StorageMap:  vms,
+		GasTracker:  NewGasTracker(),
+		BlockHeight: types.NewBlockHeight(0),
+		Tracer:      tracer,
+	})
+	oldHead := vmCtx.Storage().Head()
+
+	frame := tracer.enter(vmCtx)
+	node, err := cbor.WrapObject([]byte("hello"), types.DefaultHashFunction, -1)
+	require.NoError(err)
+	require.NoError(vmCtx.WriteStorage(node.RawData()))
+	tracer.exit(frame, nil, 0, nil, vmCtx.GasUnits())
+
+	require.Len(frame.Storage, 2)
+	assert.Equal(StoragePut, frame.Storage[0].Kind)
+	assert.Equal(node.Cid(), frame.Storage[0].Cid)
+	assert.Nil(frame.Storage[0].Prev)
+	assert.Equal(StorageCommit, frame.Storage[1].Kind)
+	assert.Equal(node.Cid(), frame.Storage[1].Cid)
+	require.NotNil(frame.Storage[1].Prev)
+	assert.Equal(oldHead, *frame.Storage[1].Prev)
+}
@@ -5,20 +5,25 @@ package vm
 
 import (
 	"context"
+	"encoding/json"
+
 	cbor "github.com/ipfs/go-ipld-cbor"
 
 	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/wasmactor"
+	"github.com/filecoin-project/go-filecoin/exec"
 	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/filecoin-project/go-filecoin/vm/errors"
 )
 
 // Send executes a message pass inside the VM. If error is set it
-// will always satisfy either ShouldRevert() or IsFault().
+// will always satisfy either ShouldRevert() or IsFault(). The call is recorded
+// in the tracer of the context, if any.
 func Send(ctx context.Context, vmCtx *Context) ([][]byte, uint8, error) {
 	deps := sendDeps{
 		transfer: Transfer,
 	}
-	return send(ctx, deps, vmCtx)
+	return tracedSend(ctx, deps, vmCtx)
 }
 
 type sendDeps struct {
@@ -42,11 +47,18 @@ func send(ctx context.Context, deps sendDeps, vmCtx *Context) ([][]byte, uint8,
 		return nil, 0, nil
 	}
 
-	toExecutable, err := vmCtx.state.GetBuiltinActorCode(vmCtx.to.Code)
+	toExecutable, err := actorCode(vmCtx)
 	if err != nil {
+		if errors.ShouldRevert(err) || errors.IsFault(err) {
+			return nil, errors.CodeError(err), err
+		}
 		return nil, errors.ErrNoActorCode, errors.Errors[errors.ErrNoActorCode]
 	}
 
+	if vmCtx.message.Method == exec.ExportsMethod && !toExecutable.Exports().Has(exec.ExportsMethod) {
+		return exportsReturn(toExecutable.Exports())
+	}
+
 	if !toExecutable.Exports().Has(vmCtx.message.Method) {
 		return nil, 1, errors.Errors[errors.ErrMissingExport]
 	}
@@ -63,6 +75,27 @@ func send(ctx context.Context, deps sendDeps, vmCtx *Context) ([][]byte, uint8,
 	return nil, code, err
 }
 
+// actorCode returns the code of the actor receiving the message: a builtin
+// actor, or the WebAssembly code deployed to it, loaded from its storage.
+func actorCode(vmCtx *Context) (exec.ExecutableActor, error) {
+	code := vmCtx.to.Code
+	builtin, err := vmCtx.state.GetBuiltinActorCode(code)
+	if err == nil || !code.Defined() || !vmCtx.to.Head.Defined() {
+		return builtin, err
+	}
+	return wasmactor.Load(vmCtx.Storage(), code)
+}
+
+// exportsReturn returns the answer of an actor to the exports query: the
+// schema of its exports, JSON encoded.
+func exportsReturn(exports exec.Exports) ([][]byte, uint8, error) {
+	schema, err := json.Marshal(exports.Schema())
+	if err != nil {
+		return nil, 1, errors.FaultErrorWrap(err, "failed to marshal exports")
+	}
+	return [][]byte{schema}, 0, nil
+}
+
 // Transfer transfers the given value between two actors.
 func Transfer(fromActor, toActor *actor.Actor, value *types.AttoFIL) error {
 	if value.IsNegative() {
@@ -0,0 +1,376 @@
+package wasm
+
+import (
+	"fmt"
+)
+
+// The opcodes of the supported instructions.
+const (
+	opUnreachable  = 0x00
+	opNop          = 0x01
+	opBlock        = 0x02
+	opLoop         = 0x03
+	opIf           = 0x04
+	opElse         = 0x05
+	opEnd          = 0x0b
+	opBr           = 0x0c
+	opBrIf         = 0x0d
+	opBrTable      = 0x0e
+	opReturn       = 0x0f
+	opCall         = 0x10
+	opCallIndirect = 0x11
+	opDrop         = 0x1a
+	opSelect       = 0x1b
+	opSelectTyped  = 0x1c
+	opLocalGet     = 0x20
+	opLocalSet     = 0x21
+	opLocalTee     = 0x22
+	opGlobalGet    = 0x23
+	opGlobalSet    = 0x24
+
+	opI32Load    = 0x28
+	opI64Load    = 0x29
+	opI32Load8S  = 0x2c
+	opI32Load8U  = 0x2d
+	opI32Load16S = 0x2e
+	opI32Load16U = 0x2f
+	opI64Load8S  = 0x30
+	opI64Load8U  = 0x31
+	opI64Load16S = 0x32
+	opI64Load16U = 0x33
+	opI64Load32S = 0x34
+	opI64Load32U = 0x35
+	opI32Store   = 0x36
+	opI64Store   = 0x37
+	opI32Store8  = 0x3a
+	opI32Store16 = 0x3b
+	opI64Store8  = 0x3c
+	opI64Store16 = 0x3d
+	opI64Store32 = 0x3e
+	opMemorySize = 0x3f
+	opMemoryGrow = 0x40
+
+	opI32Const = 0x41
+	opI64Const = 0x42
+
+	opI32Eqz = 0x45
+	opI32Eq  = 0x46
+	opI32Ne  = 0x47
+	opI32LtS = 0x48
+	opI32LtU = 0x49
+	opI32GtS = 0x4a
+	opI32GtU = 0x4b
+	opI32LeS = 0x4c
+	opI32LeU = 0x4d
+	opI32GeS = 0x4e
+	opI32GeU = 0x4f
+	opI64Eqz = 0x50
+	opI64Eq  = 0x51
+	opI64Ne  = 0x52
+	opI64LtS = 0x53
+	opI64LtU = 0x54
+	opI64GtS = 0x55
+	opI64GtU = 0x56
+	opI64LeS = 0x57
+	opI64LeU = 0x58
+	opI64GeS = 0x59
+	opI64GeU = 0x5a
+
+	opI32Clz    = 0x67
+	opI32Ctz    = 0x68
+	opI32Popcnt = 0x69
+	opI32Add    = 0x6a
+	opI32Sub    = 0x6b
+	opI32Mul    = 0x6c
+	opI32DivS   = 0x6d
+	opI32DivU   = 0x6e
+	opI32RemS   = 0x6f
+	opI32RemU   = 0x70
+	opI32And    = 0x71
+	opI32Or     = 0x72
+	opI32Xor    = 0x73
+	opI32Shl    = 0x74
+	opI32ShrS   = 0x75
+	opI32ShrU   = 0x76
+	opI32Rotl   = 0x77
+	opI32Rotr   = 0x78
+	opI64Clz    = 0x79
+	opI64Ctz    = 0x7a
+	opI64Popcnt = 0x7b
+	opI64Add    = 0x7c
+	opI64Sub    = 0x7d
+	opI64Mul    = 0x7e
+	opI64DivS   = 0x7f
+	opI64DivU   = 0x80
+	opI64RemS   = 0x81
+	opI64RemU   = 0x82
+	opI64And    = 0x83
+	opI64Or     = 0x84
+	opI64Xor    = 0x85
+	opI64Shl    = 0x86
+	opI64ShrS   = 0x87
+	opI64ShrU   = 0x88
+	opI64Rotl   = 0x89
+	opI64Rotr   = 0x8a
+
+	opI32WrapI64    = 0xa7
+	opI64ExtendI32S = 0xac
+	opI64ExtendI32U = 0xad
+	opI32Extend8S   = 0xc0
+	opI32Extend16S  = 0xc1
+	opI64Extend8S   = 0xc2
+	opI64Extend16S  = 0xc3
+	opI64Extend32S  = 0xc4
+
+	opPrefixMisc   = 0xfc
+	miscMemoryCopy = 10
+	miscMemoryFill = 11
+	// memory.copy and memory.fill are decoded to opcodes of their own.
+	opMemoryCopy = 0xf0
+	opMemoryFill = 0xf1
+)
+
+const (
+	blockTypeEmpty = 0x40
+	// maxLocals bounds the locals of a function.
+	maxLocals = 50000
+	// maxBlockDepth bounds the nesting of the blocks of a function.
+	maxBlockDepth = 1024
+)
+
+// instr is a decoded instruction.
+type instr struct {
+	op byte
+	// imm is the immediate of the instruction: a constant, an index, or the
+	// offset of a memory access.
+	imm uint64
+	// end and els are, for block, loop and if, the positions of the matching
+	// end and else. els is zero when an if has no else.
+	end, els int
+	// params and results are the arities of the type of a block, loop or if.
+	params, results int
+	// labels are the labels of br_table, the default last.
+	labels []uint32
+}
+
+// decodeBody decodes the instructions of a function, matching the ends and
+// elses of its blocks.
+func (m *Module) decodeBody(r *reader) ([]instr, error) {
+	var body []instr
+	var open []int
+	for {
+		op, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		in := instr{op: op}
+
+		switch {
+		case op == opBlock || op == opLoop || op == opIf:
+			if len(open) >= maxBlockDepth {
+				return nil, fmt.Errorf("blocks nested too deep")
+			}
+			if in.params, in.results, err = m.blockType(r); err != nil {
+				return nil, err
+			}
+			open = append(open, len(body))
+		case op == opElse:
+			if len(open) == 0 || body[open[len(open)-1]].op != opIf || body[open[len(open)-1]].els != 0 {
+				return nil, fmt.Errorf("else outside of if")
+			}
+			body[open[len(open)-1]].els = len(body)
+		case op == opEnd:
+			if len(open) == 0 {
+				// the end of the function
+				if !r.done() {
+					return nil, fmt.Errorf("trailing bytes after the end of the function")
+				}
+				return append(body, in), nil
+			}
+			body[open[len(open)-1]].end = len(body)
+			open = open[:len(open)-1]
+		case op == opBr || op == opBrIf:
+			label, err := r.u32()
+			if err != nil {
+				return nil, err
+			}
+			if label > uint32(len(open)) {
+				return nil, fmt.Errorf("unknown label %d", label)
+			}
+			in.imm = uint64(label)
+		case op == opBrTable:
+			n, err := r.u32()
+			if err != nil {
+				return nil, err
+			}
+			if uint64(n) >= uint64(len(r.buf)-r.pos) {
+				return nil, fmt.Errorf("unexpected end of module")
+			}
+			for i := uint32(0); i <= n; i++ {
+				label, err := r.u32()
+				if err != nil {
+					return nil, err
+				}
+				if label > uint32(len(open)) {
+					return nil, fmt.Errorf("unknown label %d", label)
+				}
+				in.labels = append(in.labels, label)
+			}
+		case op == opCall:
+			idx, err := r.u32()
+			if err != nil {
+				return nil, err
+			}
+			if idx >= m.declared {
+				return nil, fmt.Errorf("unknown function %d", idx)
+			}
+			in.imm = uint64(idx)
+		case op == opCallIndirect:
+			idx, err := r.u32()
+			if err != nil {
+				return nil, err
+			}
+			if idx >= uint32(len(m.Types)) {
+				return nil, fmt.Errorf("unknown type %d", idx)
+			}
+			table, err := r.byte()
+			if err != nil {
+				return nil, err
+			}
+			if table != 0 || m.Table == nil {
+				return nil, fmt.Errorf("unknown table %d", table)
+			}
+			in.imm = uint64(idx)
+		case op == opSelectTyped:
+			// The types of select are not checked, the values are untyped.
+			if _, err := r.valueTypes(); err != nil {
+				return nil, err
+			}
+			in.op = opSelect
+		case op >= opLocalGet && op <= opLocalTee:
+			idx, err := r.u32()
+			if err != nil {
+				return nil, err
+			}
+			in.imm = uint64(idx)
+		case op == opGlobalGet || op == opGlobalSet:
+			idx, err := r.u32()
+			if err != nil {
+				return nil, err
+			}
+			if idx >= uint32(len(m.globals)) {
+				return nil, fmt.Errorf("unknown global %d", idx)
+			}
+			if op == opGlobalSet && !m.globals[idx].mutable {
+				return nil, fmt.Errorf("global %d is immutable", idx)
+			}
+			in.imm = uint64(idx)
+		case isLoad(op) || isStore(op):
+			if m.Memory == nil {
+				return nil, fmt.Errorf("memory access without memory")
+			}
+			if _, err := r.u32(); err != nil { // alignment hint
+				return nil, err
+			}
+			offset, err := r.u32()
+			if err != nil {
+				return nil, err
+			}
+			in.imm = uint64(offset)
+		case op == opMemorySize || op == opMemoryGrow:
+			if m.Memory == nil {
+				return nil, fmt.Errorf("memory access without memory")
+			}
+			if _, err := r.byte(); err != nil {
+				return nil, err
+			}
+		case op == opI32Const:
+			c, err := r.s32()
+			if err != nil {
+				return nil, err
+			}
+			in.imm = uint64(uint32(c))
+		case op == opI64Const:
+			c, err := r.s64()
+			if err != nil {
+				return nil, err
+			}
+			in.imm = uint64(c)
+		case op == opPrefixMisc:
+			sub, err := r.u32()
+			if err != nil {
+				return nil, err
+			}
+			if m.Memory == nil {
+				return nil, fmt.Errorf("memory access without memory")
+			}
+			switch sub {
+			case miscMemoryCopy:
+				if _, err := r.bytes(2); err != nil {
+					return nil, err
+				}
+				in.op = opMemoryCopy
+			case miscMemoryFill:
+				if _, err := r.byte(); err != nil {
+					return nil, err
+				}
+				in.op = opMemoryFill
+			default:
+				return nil, fmt.Errorf("unsupported instruction 0xfc %d", sub)
+			}
+		case isSimple(op):
+		default:
+			return nil, fmt.Errorf("unsupported instruction 0x%x", op)
+		}
+		body = append(body, in)
+	}
+}
+
+// blockType returns the arities of the type of a block.
+func (m *Module) blockType(r *reader) (int, int, error) {
+	if r.done() {
+		return 0, 0, fmt.Errorf("unexpected end of module")
+	}
+	switch b := r.buf[r.pos]; {
+	case b == blockTypeEmpty:
+		r.pos++
+		return 0, 0, nil
+	case ValueType(b) == I32 || ValueType(b) == I64:
+		r.pos++
+		return 0, 1, nil
+	}
+	idx, err := r.sleb(33)
+	if err != nil {
+		return 0, 0, err
+	}
+	if idx < 0 || idx >= int64(len(m.Types)) {
+		return 0, 0, fmt.Errorf("unsupported block type %d", idx)
+	}
+	ft := m.Types[idx]
+	return len(ft.Params), len(ft.Results), nil
+}
+
+func isLoad(op byte) bool {
+	return op == opI32Load || op == opI64Load || (op >= opI32Load8S && op <= opI64Load32U)
+}
+
+func isStore(op byte) bool {
+	return op == opI32Store || op == opI64Store || (op >= opI32Store8 && op <= opI64Store32)
+}
+
+// isSimple is true of the supported instructions without immediates.
+func isSimple(op byte) bool {
+	switch {
+	case op == opUnreachable, op == opNop, op == opReturn, op == opDrop, op == opSelect:
+		return true
+	case op >= opI32Eqz && op <= opI64GeU:
+		return true
+	case op >= opI32Clz && op <= opI64Rotr:
+		return true
+	case op == opI32WrapI64, op == opI64ExtendI32S, op == opI64ExtendI32U:
+		return true
+	case op >= opI32Extend8S && op <= opI64Extend32S:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,779 @@
+package wasm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"runtime"
+)
+
+// PageSize is the size of a page of linear memory.
+const PageSize = 65536
+
+// InstructionBatch is the count of instructions charged to the meter of an
+// instance at once.
+const InstructionBatch = 1000
+
+const (
+	// maxPages bounds the linear memory of an instance to 16MiB.
+	maxPages = 256
+	// maxStack bounds the count of values on the operand stack.
+	maxStack = 1 << 16
+	// maxCallDepth bounds the depth of nested calls.
+	maxCallDepth = 256
+)
+
+// Trap is the error of an instance whose execution failed.
+type Trap struct {
+	Reason string
+}
+
+func (t *Trap) Error() string {
+	return "wasm trap: " + t.Reason
+}
+
+func trap(format string, args ...interface{}) {
+	panic(&Trap{Reason: fmt.Sprintf(format, args...)})
+}
+
+// InterpreterError is the error of an execution that failed because of a bug
+// of the interpreter rather than of the code it runs.
+type InterpreterError struct {
+	Err error
+}
+
+func (e *InterpreterError) Error() string {
+	return "wasm interpreter failed: " + e.Err.Error()
+}
+
+// hostError carries the error of a host function or of the meter out of
+// the execution.
+type hostError struct {
+	err error
+}
+
+// HostFunc is a function the host provides to the instances of modules.
+type HostFunc struct {
+	Type FuncType
+	// Call runs the function with the arguments of its params and returns
+	// the values of its results. An error aborts the execution of the
+	// instance and is returned as it is.
+	Call func(inst *Instance, args []uint64) ([]uint64, error)
+}
+
+// Imports are the host functions modules may import, by module and name.
+type Imports map[string]map[string]HostFunc
+
+// Meter charges the execution of an instance. An error aborts the execution
+// and is returned as it is.
+type Meter interface {
+	// ChargeInstructions is called before each batch of instructions is run,
+	// with the size of the batch.
+	ChargeInstructions(count uint64) error
+	// ChargePages is called before pages are added to the memory.
+	ChargePages(count uint32) error
+	// ChargeMemoryBytes is called before the bulk memory instructions copy
+	// or fill count bytes.
+	ChargeMemoryBytes(count uint32) error
+}
+
+// Instance is an instantiated module, with its memory and globals.
+type Instance struct {
+	module   *Module
+	host     []HostFunc
+	meter    Meter
+	memory   []byte
+	maxPages uint32
+	globals  []uint64
+	table    []int64
+
+	stack []uint64
+	depth int
+	// batch counts the instructions left in the batch last charged.
+	batch int
+}
+
+// Instantiate resolves the imports of a module and instantiates it. Its
+// memory and table are initialized with its segments and its start function
+// is run. The meter, if not nil, is charged the execution.
+func Instantiate(module *Module, imports Imports, meter Meter) (inst *Instance, err error) {
+	inst = &Instance{module: module, meter: meter}
+	for _, imp := range module.Imports {
+		fn, ok := imports[imp.Module][imp.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown import %s.%s", imp.Module, imp.Name)
+		}
+		if !fn.Type.Equal(module.Types[imp.Type]) {
+			return nil, fmt.Errorf("import %s.%s has the wrong type", imp.Module, imp.Name)
+		}
+		inst.host = append(inst.host, fn)
+	}
+
+	defer func() {
+		if err != nil {
+			inst = nil
+		}
+	}()
+	defer inst.recoverError(&err)
+
+	if module.Memory != nil {
+		inst.maxPages = maxPages
+		if module.Memory.HasMax && module.Memory.Max < maxPages {
+			inst.maxPages = module.Memory.Max
+		}
+		if module.Memory.Min > inst.maxPages {
+			return nil, fmt.Errorf("memory too large")
+		}
+		inst.chargePages(module.Memory.Min)
+		inst.memory = make([]byte, int(module.Memory.Min)*PageSize)
+	}
+	for _, seg := range module.data {
+		if uint64(seg.offset)+uint64(len(seg.data)) > uint64(len(inst.memory)) {
+			return nil, fmt.Errorf("data segment out of memory bounds")
+		}
+		copy(inst.memory[seg.offset:], seg.data)
+	}
+
+	if module.Table != nil {
+		if module.Table.Min > maxStack {
+			return nil, fmt.Errorf("table too large")
+		}
+		inst.table = make([]int64, module.Table.Min)
+		for i := range inst.table {
+			inst.table[i] = -1
+		}
+	}
+	for _, seg := range module.elements {
+		if uint64(seg.offset)+uint64(len(seg.funcs)) > uint64(len(inst.table)) {
+			return nil, fmt.Errorf("element segment out of table bounds")
+		}
+		for i, idx := range seg.funcs {
+			if idx >= module.funcCount() {
+				return nil, fmt.Errorf("unknown function %d in element segment", idx)
+			}
+			inst.table[int(seg.offset)+i] = int64(idx)
+		}
+	}
+
+	for _, g := range module.globals {
+		inst.globals = append(inst.globals, g.init)
+	}
+
+	if module.start != nil {
+		ft, ok := module.FuncType(*module.start)
+		if !ok || len(ft.Params) != 0 || len(ft.Results) != 0 {
+			return nil, fmt.Errorf("invalid start function")
+		}
+		inst.call(*module.start)
+	}
+	return inst, nil
+}
+
+// Invoke calls an exported function with the given arguments and returns
+// its results. The arguments and results are the bits of their values,
+// those of i32 values being in the low half.
+func (inst *Instance) Invoke(name string, args ...uint64) (results []uint64, err error) {
+	idx, ok := inst.module.Exports[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown export %s", name)
+	}
+	ft, ok := inst.module.FuncType(idx)
+	if !ok {
+		return nil, fmt.Errorf("export %s is not a function", name)
+	}
+	if len(args) != len(ft.Params) {
+		return nil, fmt.Errorf("export %s takes %d arguments, got %d", name, len(ft.Params), len(args))
+	}
+
+	defer inst.recoverError(&err)
+
+	inst.stack = inst.stack[:0]
+	for i, arg := range args {
+		inst.push(normalize(ft.Params[i], arg))
+	}
+	inst.call(idx)
+	results = make([]uint64, len(ft.Results))
+	copy(results, inst.stack)
+	return results, nil
+}
+
+// recoverError turns the traps and host errors raised by the execution into
+// the error it returns. Go runtime errors are returned as interpreter errors,
+// as they are not caused by the code run.
+func (inst *Instance) recoverError(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	switch e := r.(type) {
+	case *Trap:
+		*err = e
+	case hostError:
+		*err = e.err
+	case runtime.Error:
+		*err = &InterpreterError{Err: e}
+	default:
+		panic(r)
+	}
+	inst.stack = inst.stack[:0]
+	inst.depth = 0
+}
+
+// Pages returns the size of the memory in pages.
+func (inst *Instance) Pages() uint32 {
+	return uint32(len(inst.memory) / PageSize)
+}
+
+// Read returns a copy of size bytes of memory at ptr.
+func (inst *Instance) Read(ptr, size uint32) ([]byte, error) {
+	if uint64(ptr)+uint64(size) > uint64(len(inst.memory)) {
+		return nil, &Trap{Reason: "out of bounds memory access"}
+	}
+	out := make([]byte, size)
+	copy(out, inst.memory[ptr:])
+	return out, nil
+}
+
+// Write copies data to memory at ptr.
+func (inst *Instance) Write(ptr uint32, data []byte) error {
+	if uint64(ptr)+uint64(len(data)) > uint64(len(inst.memory)) {
+		return &Trap{Reason: "out of bounds memory access"}
+	}
+	copy(inst.memory[ptr:], data)
+	return nil
+}
+
+func normalize(t ValueType, v uint64) uint64 {
+	if t == I32 {
+		return uint64(uint32(v))
+	}
+	return v
+}
+
+func (inst *Instance) push(v uint64) {
+	if len(inst.stack) >= maxStack {
+		trap("stack overflow")
+	}
+	inst.stack = append(inst.stack, v)
+}
+
+func (inst *Instance) pop() uint64 {
+	if len(inst.stack) == 0 {
+		trap("stack underflow")
+	}
+	v := inst.stack[len(inst.stack)-1]
+	inst.stack = inst.stack[:len(inst.stack)-1]
+	return v
+}
+
+func (inst *Instance) pop32() uint32 {
+	return uint32(inst.pop())
+}
+
+func (inst *Instance) chargePages(count uint32) {
+	if inst.meter == nil || count == 0 {
+		return
+	}
+	if err := inst.meter.ChargePages(count); err != nil {
+		panic(hostError{err})
+	}
+}
+
+func (inst *Instance) chargeMemoryBytes(count uint32) {
+	if inst.meter == nil || count == 0 {
+		return
+	}
+	if err := inst.meter.ChargeMemoryBytes(count); err != nil {
+		panic(hostError{err})
+	}
+}
+
+func (inst *Instance) step() {
+	if inst.batch > 0 {
+		inst.batch--
+		return
+	}
+	if inst.meter != nil {
+		if err := inst.meter.ChargeInstructions(InstructionBatch); err != nil {
+			panic(hostError{err})
+		}
+	}
+	inst.batch = InstructionBatch - 1
+}
+
+// call calls the function with the given index, its arguments on the stack.
+func (inst *Instance) call(idx uint32) {
+	ft, _ := inst.module.FuncType(idx)
+	if len(inst.stack) < len(ft.Params) {
+		trap("stack underflow")
+	}
+	args := inst.stack[len(inst.stack)-len(ft.Params):]
+
+	if idx < uint32(len(inst.host)) {
+		params := make([]uint64, len(args))
+		copy(params, args)
+		inst.stack = inst.stack[:len(inst.stack)-len(args)]
+		results, err := inst.host[idx].Call(inst, params)
+		if err != nil {
+			panic(hostError{err})
+		}
+		if len(results) != len(ft.Results) {
+			trap("host function returned %d results, expected %d", len(results), len(ft.Results))
+		}
+		for i, v := range results {
+			inst.push(normalize(ft.Results[i], v))
+		}
+		return
+	}
+
+	if inst.depth >= maxCallDepth {
+		trap("call stack exhausted")
+	}
+	inst.depth++
+	fn := &inst.module.Functions[idx-uint32(len(inst.host))]
+	locals := make([]uint64, len(args)+len(fn.Locals))
+	copy(locals, args)
+	inst.stack = inst.stack[:len(inst.stack)-len(args)]
+	base := len(inst.stack)
+
+	inst.run(fn.body, locals, base, len(ft.Results))
+
+	if len(inst.stack) < base+len(ft.Results) {
+		trap("stack underflow")
+	}
+	copy(inst.stack[base:], inst.stack[len(inst.stack)-len(ft.Results):])
+	inst.stack = inst.stack[:base+len(ft.Results)]
+	inst.depth--
+}
+
+// label is the target of the branches out of a block.
+type label struct {
+	// height is the height of the stack below the params of the block.
+	height int
+	// arity is the count of values a branch to the label carries.
+	arity int
+	// loop is true of the labels of loops, whose branches continue at start.
+	loop       bool
+	start, end int
+}
+
+// run runs the body of a function.
+func (inst *Instance) run(body []instr, locals []uint64, base, results int) {
+	labels := []label{{height: base, arity: results, end: len(body) - 1}}
+
+	// branch continues after the block of the label at the given depth,
+	// carrying its values.
+	branch := func(depth int) int {
+		l := labels[len(labels)-1-depth]
+		if len(inst.stack)-l.arity < l.height {
+			trap("stack underflow")
+		}
+		copy(inst.stack[l.height:], inst.stack[len(inst.stack)-l.arity:])
+		inst.stack = inst.stack[:l.height+l.arity]
+		if l.loop {
+			labels = labels[:len(labels)-depth]
+			return l.start + 1
+		}
+		labels = labels[:len(labels)-1-depth]
+		return l.end + 1
+	}
+	enter := func(in *instr, pc int) {
+		height := len(inst.stack) - in.params
+		if height < base {
+			trap("stack underflow")
+		}
+		l := label{height: height, arity: in.results, start: pc, end: in.end}
+		if in.op == opLoop {
+			l.loop = true
+			l.arity = in.params
+		}
+		labels = append(labels, l)
+	}
+
+	for pc := 0; pc < len(body); {
+		inst.step()
+		in := &body[pc]
+		pc++
+
+		switch in.op {
+		case opUnreachable:
+			trap("unreachable")
+		case opNop:
+		case opBlock, opLoop:
+			enter(in, pc-1)
+		case opIf:
+			cond := inst.pop32()
+			enter(in, pc-1)
+			if cond == 0 {
+				if in.els != 0 {
+					pc = in.els + 1
+				} else {
+					labels = labels[:len(labels)-1]
+					pc = in.end + 1
+				}
+			}
+		case opElse:
+			// the end of the then branch, continue after the end of the if
+			pc = labels[len(labels)-1].end + 1
+			labels = labels[:len(labels)-1]
+		case opEnd:
+			labels = labels[:len(labels)-1]
+		case opBr:
+			pc = branch(int(in.imm))
+		case opBrIf:
+			if inst.pop32() != 0 {
+				pc = branch(int(in.imm))
+			}
+		case opBrTable:
+			i := inst.pop32()
+			if i >= uint32(len(in.labels)-1) {
+				i = uint32(len(in.labels) - 1)
+			}
+			pc = branch(int(in.labels[i]))
+		case opReturn:
+			pc = branch(len(labels) - 1)
+		case opCall:
+			inst.call(uint32(in.imm))
+		case opCallIndirect:
+			i := inst.pop32()
+			if i >= uint32(len(inst.table)) || inst.table[i] < 0 {
+				trap("undefined element")
+			}
+			idx := uint32(inst.table[i])
+			ft, _ := inst.module.FuncType(idx)
+			if !ft.Equal(inst.module.Types[in.imm]) {
+				trap("indirect call type mismatch")
+			}
+			inst.call(idx)
+		case opDrop:
+			inst.pop()
+		case opSelect:
+			cond := inst.pop32()
+			b, a := inst.pop(), inst.pop()
+			if cond != 0 {
+				inst.push(a)
+			} else {
+				inst.push(b)
+			}
+		case opLocalGet:
+			inst.push(locals[inst.local(locals, in.imm)])
+		case opLocalSet:
+			i := inst.local(locals, in.imm)
+			locals[i] = inst.pop()
+		case opLocalTee:
+			i := inst.local(locals, in.imm)
+			locals[i] = inst.pop()
+			inst.push(locals[i])
+		case opGlobalGet:
+			inst.push(inst.globals[in.imm])
+		case opGlobalSet:
+			inst.globals[in.imm] = normalize(inst.module.globals[in.imm].typ, inst.pop())
+
+		case opMemorySize:
+			inst.push(uint64(inst.Pages()))
+		case opMemoryGrow:
+			n := inst.pop32()
+			old := inst.Pages()
+			if uint64(old)+uint64(n) > uint64(inst.maxPages) {
+				inst.push(uint64(uint32(0xffffffff)))
+				break
+			}
+			inst.chargePages(n)
+			inst.memory = append(inst.memory, make([]byte, int(n)*PageSize)...)
+			inst.push(uint64(old))
+		case opMemoryCopy:
+			n, src, dst := inst.pop32(), inst.pop32(), inst.pop32()
+			inst.bounds(src, n)
+			inst.bounds(dst, n)
+			inst.chargeMemoryBytes(n)
+			copy(inst.memory[dst:dst+n], inst.memory[src:src+n])
+		case opMemoryFill:
+			n, val, dst := inst.pop32(), inst.pop32(), inst.pop32()
+			inst.bounds(dst, n)
+			inst.chargeMemoryBytes(n)
+			for i := dst; i < dst+n; i++ {
+				inst.memory[i] = byte(val)
+			}
+
+		case opI32Const, opI64Const:
+			inst.push(in.imm)
+
+		default:
+			switch {
+			case isLoad(in.op):
+				inst.load(in)
+			case isStore(in.op):
+				inst.store(in)
+			default:
+				inst.numeric(in.op)
+			}
+		}
+	}
+}
+
+func (inst *Instance) local(locals []uint64, idx uint64) int {
+	if idx >= uint64(len(locals)) {
+		trap("unknown local %d", idx)
+	}
+	return int(idx)
+}
+
+// bounds traps unless size bytes at addr are in memory.
+func (inst *Instance) bounds(addr, size uint32) {
+	if uint64(addr)+uint64(size) > uint64(len(inst.memory)) {
+		trap("out of bounds memory access")
+	}
+}
+
+// address returns the address of an access of size bytes.
+func (inst *Instance) address(in *instr, size uint64) uint64 {
+	addr := uint64(inst.pop32()) + in.imm
+	if addr+size > uint64(len(inst.memory)) {
+		trap("out of bounds memory access")
+	}
+	return addr
+}
+
+func (inst *Instance) load(in *instr) {
+	var v uint64
+	switch in.op {
+	case opI32Load:
+		v = uint64(binary.LittleEndian.Uint32(inst.memory[inst.address(in, 4):]))
+	case opI64Load:
+		v = binary.LittleEndian.Uint64(inst.memory[inst.address(in, 8):])
+	case opI32Load8S:
+		v = uint64(uint32(int32(int8(inst.memory[inst.address(in, 1)]))))
+	case opI32Load8U, opI64Load8U:
+		v = uint64(inst.memory[inst.address(in, 1)])
+	case opI32Load16S:
+		v = uint64(uint32(int32(int16(binary.LittleEndian.Uint16(inst.memory[inst.address(in, 2):])))))
+	case opI32Load16U, opI64Load16U:
+		v = uint64(binary.LittleEndian.Uint16(inst.memory[inst.address(in, 2):]))
+	case opI64Load8S:
+		v = uint64(int64(int8(inst.memory[inst.address(in, 1)])))
+	case opI64Load16S:
+		v = uint64(int64(int16(binary.LittleEndian.Uint16(inst.memory[inst.address(in, 2):]))))
+	case opI64Load32S:
+		v = uint64(int64(int32(binary.LittleEndian.Uint32(inst.memory[inst.address(in, 4):]))))
+	case opI64Load32U:
+		v = uint64(binary.LittleEndian.Uint32(inst.memory[inst.address(in, 4):]))
+	}
+	inst.push(v)
+}
+
+func (inst *Instance) store(in *instr) {
+	v := inst.pop()
+	switch in.op {
+	case opI32Store, opI64Store32:
+		binary.LittleEndian.PutUint32(inst.memory[inst.address(in, 4):], uint32(v))
+	case opI64Store:
+		binary.LittleEndian.PutUint64(inst.memory[inst.address(in, 8):], v)
+	case opI32Store8, opI64Store8:
+		inst.memory[inst.address(in, 1)] = byte(v)
+	case opI32Store16, opI64Store16:
+		binary.LittleEndian.PutUint16(inst.memory[inst.address(in, 2):], uint16(v))
+	}
+}
+
+func boolValue(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// numeric runs the instructions on integers.
+func (inst *Instance) numeric(op byte) {
+	switch op {
+	case opI32Eqz:
+		inst.push(boolValue(inst.pop32() == 0))
+	case opI64Eqz:
+		inst.push(boolValue(inst.pop() == 0))
+	case opI32Clz:
+		inst.push(uint64(bits.LeadingZeros32(inst.pop32())))
+	case opI32Ctz:
+		inst.push(uint64(bits.TrailingZeros32(inst.pop32())))
+	case opI32Popcnt:
+		inst.push(uint64(bits.OnesCount32(inst.pop32())))
+	case opI64Clz:
+		inst.push(uint64(bits.LeadingZeros64(inst.pop())))
+	case opI64Ctz:
+		inst.push(uint64(bits.TrailingZeros64(inst.pop())))
+	case opI64Popcnt:
+		inst.push(uint64(bits.OnesCount64(inst.pop())))
+	case opI32WrapI64:
+		inst.push(uint64(inst.pop32()))
+	case opI64ExtendI32S:
+		inst.push(uint64(int64(int32(inst.pop32()))))
+	case opI64ExtendI32U:
+		inst.push(uint64(inst.pop32()))
+	case opI32Extend8S:
+		inst.push(uint64(uint32(int32(int8(inst.pop())))))
+	case opI32Extend16S:
+		inst.push(uint64(uint32(int32(int16(inst.pop())))))
+	case opI64Extend8S:
+		inst.push(uint64(int64(int8(inst.pop()))))
+	case opI64Extend16S:
+		inst.push(uint64(int64(int16(inst.pop()))))
+	case opI64Extend32S:
+		inst.push(uint64(int64(int32(inst.pop()))))
+	default:
+		b := inst.pop()
+		a := inst.pop()
+		if op >= opI32Eq && op <= opI32GeU || op >= opI32Add && op <= opI32Rotr {
+			inst.push(uint64(binary32(op, uint32(a), uint32(b))))
+		} else {
+			inst.push(binary64(op, a, b))
+		}
+	}
+}
+
+func binary32(op byte, a, b uint32) uint32 {
+	switch op {
+	case opI32Eq:
+		return uint32(boolValue(a == b))
+	case opI32Ne:
+		return uint32(boolValue(a != b))
+	case opI32LtS:
+		return uint32(boolValue(int32(a) < int32(b)))
+	case opI32LtU:
+		return uint32(boolValue(a < b))
+	case opI32GtS:
+		return uint32(boolValue(int32(a) > int32(b)))
+	case opI32GtU:
+		return uint32(boolValue(a > b))
+	case opI32LeS:
+		return uint32(boolValue(int32(a) <= int32(b)))
+	case opI32LeU:
+		return uint32(boolValue(a <= b))
+	case opI32GeS:
+		return uint32(boolValue(int32(a) >= int32(b)))
+	case opI32GeU:
+		return uint32(boolValue(a >= b))
+	case opI32Add:
+		return a + b
+	case opI32Sub:
+		return a - b
+	case opI32Mul:
+		return a * b
+	case opI32DivS:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		if int32(a) == -1<<31 && int32(b) == -1 {
+			trap("integer overflow")
+		}
+		return uint32(int32(a) / int32(b))
+	case opI32DivU:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		return a / b
+	case opI32RemS:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		if int32(b) == -1 {
+			return 0
+		}
+		return uint32(int32(a) % int32(b))
+	case opI32RemU:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		return a % b
+	case opI32And:
+		return a & b
+	case opI32Or:
+		return a | b
+	case opI32Xor:
+		return a ^ b
+	case opI32Shl:
+		return a << (b & 31)
+	case opI32ShrS:
+		return uint32(int32(a) >> (b & 31))
+	case opI32ShrU:
+		return a >> (b & 31)
+	case opI32Rotl:
+		return bits.RotateLeft32(a, int(b&31))
+	case opI32Rotr:
+		return bits.RotateLeft32(a, -int(b&31))
+	}
+	trap("unsupported instruction 0x%x", op)
+	return 0
+}
+
+func binary64(op byte, a, b uint64) uint64 {
+	switch op {
+	case opI64Eq:
+		return boolValue(a == b)
+	case opI64Ne:
+		return boolValue(a != b)
+	case opI64LtS:
+		return boolValue(int64(a) < int64(b))
+	case opI64LtU:
+		return boolValue(a < b)
+	case opI64GtS:
+		return boolValue(int64(a) > int64(b))
+	case opI64GtU:
+		return boolValue(a > b)
+	case opI64LeS:
+		return boolValue(int64(a) <= int64(b))
+	case opI64LeU:
+		return boolValue(a <= b)
+	case opI64GeS:
+		return boolValue(int64(a) >= int64(b))
+	case opI64GeU:
+		return boolValue(a >= b)
+	case opI64Add:
+		return a + b
+	case opI64Sub:
+		return a - b
+	case opI64Mul:
+		return a * b
+	case opI64DivS:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		if int64(a) == -1<<63 && int64(b) == -1 {
+			trap("integer overflow")
+		}
+		return uint64(int64(a) / int64(b))
+	case opI64DivU:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		return a / b
+	case opI64RemS:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		if int64(b) == -1 {
+			return 0
+		}
+		return uint64(int64(a) % int64(b))
+	case opI64RemU:
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		return a % b
+	case opI64And:
+		return a & b
+	case opI64Or:
+		return a | b
+	case opI64Xor:
+		return a ^ b
+	case opI64Shl:
+		return a << (b & 63)
+	case opI64ShrS:
+		return uint64(int64(a) >> (b & 63))
+	case opI64ShrU:
+		return a >> (b & 63)
+	case opI64Rotl:
+		return bits.RotateLeft64(a, int(b&63))
+	case opI64Rotr:
+		return bits.RotateLeft64(a, -int(b&63))
+	}
+	trap("unsupported instruction 0x%x", op)
+	return 0
+}
@@ -0,0 +1,714 @@
+// Package wasm decodes and runs WebAssembly modules for the actors deployed
+// by users.
+//
+// Only the deterministic part of WebAssembly is supported: modules using
+// floating point values or instructions are rejected. Modules may import
+// functions but no memory, table or global.
+package wasm
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+)
+
+// ValueType is the type of a WebAssembly value.
+type ValueType byte
+
+const (
+	// I32 is the type of 32 bit integers.
+	I32 = ValueType(0x7f)
+	// I64 is the type of 64 bit integers.
+	I64 = ValueType(0x7e)
+)
+
+// String returns the name of the type in the text format.
+func (t ValueType) String() string {
+	switch t {
+	case I32:
+		return "i32"
+	case I64:
+		return "i64"
+	default:
+		return fmt.Sprintf("<unknown type 0x%x>", byte(t))
+	}
+}
+
+// FuncType is the signature of a function.
+type FuncType struct {
+	Params  []ValueType
+	Results []ValueType
+}
+
+// Equal is true when both signatures have the same params and results.
+func (ft FuncType) Equal(other FuncType) bool {
+	return bytes.Equal(valueTypeBytes(ft.Params), valueTypeBytes(other.Params)) &&
+		bytes.Equal(valueTypeBytes(ft.Results), valueTypeBytes(other.Results))
+}
+
+func valueTypeBytes(types []ValueType) []byte {
+	out := make([]byte, len(types))
+	for i, t := range types {
+		out[i] = byte(t)
+	}
+	return out
+}
+
+// Import is a function the module imports from its host.
+type Import struct {
+	Module string
+	Name   string
+	Type   uint32
+}
+
+// Function is a function defined by the module.
+type Function struct {
+	Type   uint32
+	Locals []ValueType
+	body   []instr
+}
+
+// Limits bound the size of a memory or a table.
+type Limits struct {
+	Min    uint32
+	Max    uint32
+	HasMax bool
+}
+
+type global struct {
+	typ     ValueType
+	mutable bool
+	init    uint64
+}
+
+type segment struct {
+	offset uint32
+	data   []byte
+	funcs  []uint32
+}
+
+// Module is a decoded WebAssembly module.
+type Module struct {
+	Types     []FuncType
+	Imports   []Import
+	Functions []Function
+	// Exports maps the names of the exported functions to their indexes,
+	// imported functions first.
+	Exports map[string]uint32
+	Memory  *Limits
+	Table   *Limits
+
+	globals  []global
+	elements []segment
+	data     []segment
+	start    *uint32
+	// declared counts the functions, those whose code is being decoded
+	// included.
+	declared uint32
+}
+
+// FuncType returns the type of the function with the given index, imported
+// functions first.
+func (m *Module) FuncType(idx uint32) (FuncType, bool) {
+	if idx < uint32(len(m.Imports)) {
+		return m.Types[m.Imports[idx].Type], true
+	}
+	idx -= uint32(len(m.Imports))
+	if idx >= uint32(len(m.Functions)) {
+		return FuncType{}, false
+	}
+	return m.Types[m.Functions[idx].Type], true
+}
+
+func (m *Module) funcCount() uint32 {
+	return uint32(len(m.Imports) + len(m.Functions))
+}
+
+const (
+	magic   = "\x00asm"
+	version = "\x01\x00\x00\x00"
+)
+
+const (
+	sectionCustom = iota
+	sectionType
+	sectionImport
+	sectionFunction
+	sectionTable
+	sectionMemory
+	sectionGlobal
+	sectionExport
+	sectionStart
+	sectionElement
+	sectionCode
+	sectionData
+	sectionDataCount
+)
+
+// Decode decodes a module in the WebAssembly binary format.
+func Decode(code []byte) (*Module, error) {
+	if len(code) < 8 || string(code[:4]) != magic || string(code[4:8]) != version {
+		return nil, fmt.Errorf("not a WebAssembly module")
+	}
+	m := &Module{Exports: make(map[string]uint32)}
+	r := &reader{buf: code, pos: 8}
+
+	var funcTypes []uint32
+	last := 0
+	for !r.done() {
+		id, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		size, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+		content, err := r.bytes(size)
+		if err != nil {
+			return nil, err
+		}
+		if id != sectionCustom {
+			if int(id) <= last && id != sectionDataCount {
+				return nil, fmt.Errorf("section %d out of order", id)
+			}
+			last = int(id)
+		}
+
+		sr := &reader{buf: content}
+		switch id {
+		case sectionCustom, sectionDataCount:
+			continue
+		case sectionType:
+			err = m.decodeTypes(sr)
+		case sectionImport:
+			err = m.decodeImports(sr)
+		case sectionFunction:
+			funcTypes, err = m.decodeFunctions(sr)
+		case sectionTable:
+			err = m.decodeTable(sr)
+		case sectionMemory:
+			err = m.decodeMemory(sr)
+		case sectionGlobal:
+			err = m.decodeGlobals(sr)
+		case sectionExport:
+			err = m.decodeExports(sr)
+		case sectionStart:
+			err = m.decodeStart(sr)
+		case sectionElement:
+			err = m.decodeElements(sr)
+		case sectionCode:
+			err = m.decodeCode(sr, funcTypes)
+			funcTypes = nil
+		case sectionData:
+			err = m.decodeData(sr)
+		default:
+			err = fmt.Errorf("unknown section %d", id)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !sr.done() {
+			return nil, fmt.Errorf("section %d has trailing bytes", id)
+		}
+	}
+	if len(funcTypes) > 0 {
+		return nil, fmt.Errorf("functions declared without code")
+	}
+	for name, idx := range m.Exports {
+		if idx >= m.funcCount() {
+			return nil, fmt.Errorf("export %s: unknown function %d", name, idx)
+		}
+	}
+	if m.start != nil && *m.start >= m.funcCount() {
+		return nil, fmt.Errorf("unknown start function %d", *m.start)
+	}
+	return m, nil
+}
+
+func (m *Module) decodeTypes(r *reader) error {
+	n, err := r.u32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		form, err := r.byte()
+		if err != nil {
+			return err
+		}
+		if form != 0x60 {
+			return fmt.Errorf("invalid function type form 0x%x", form)
+		}
+		var ft FuncType
+		if ft.Params, err = r.valueTypes(); err != nil {
+			return err
+		}
+		if ft.Results, err = r.valueTypes(); err != nil {
+			return err
+		}
+		m.Types = append(m.Types, ft)
+	}
+	return nil
+}
+
+func (m *Module) decodeImports(r *reader) error {
+	n, err := r.u32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		var imp Import
+		if imp.Module, err = r.name(); err != nil {
+			return err
+		}
+		if imp.Name, err = r.name(); err != nil {
+			return err
+		}
+		kind, err := r.byte()
+		if err != nil {
+			return err
+		}
+		if kind != 0x00 {
+			return fmt.Errorf("import %s.%s: only functions may be imported", imp.Module, imp.Name)
+		}
+		if imp.Type, err = r.u32(); err != nil {
+			return err
+		}
+		if imp.Type >= uint32(len(m.Types)) {
+			return fmt.Errorf("import %s.%s: unknown type %d", imp.Module, imp.Name, imp.Type)
+		}
+		m.Imports = append(m.Imports, imp)
+	}
+	return nil
+}
+
+func (m *Module) decodeFunctions(r *reader) ([]uint32, error) {
+	n, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+	types := make([]uint32, n)
+	for i := range types {
+		if types[i], err = r.u32(); err != nil {
+			return nil, err
+		}
+		if types[i] >= uint32(len(m.Types)) {
+			return nil, fmt.Errorf("function %d: unknown type %d", i, types[i])
+		}
+	}
+	return types, nil
+}
+
+func (m *Module) decodeTable(r *reader) error {
+	n, err := r.u32()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return nil
+	}
+	if n > 1 {
+		return fmt.Errorf("at most one table is supported")
+	}
+	elemType, err := r.byte()
+	if err != nil {
+		return err
+	}
+	if elemType != 0x70 {
+		return fmt.Errorf("only tables of functions are supported")
+	}
+	m.Table, err = r.limits()
+	return err
+}
+
+func (m *Module) decodeMemory(r *reader) error {
+	n, err := r.u32()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return nil
+	}
+	if n > 1 {
+		return fmt.Errorf("at most one memory is supported")
+	}
+	m.Memory, err = r.limits()
+	if err != nil {
+		return err
+	}
+	if m.Memory.Min > maxPages || (m.Memory.HasMax && m.Memory.Max < m.Memory.Min) {
+		return fmt.Errorf("invalid memory limits")
+	}
+	return nil
+}
+
+func (m *Module) decodeGlobals(r *reader) error {
+	n, err := r.u32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		typ, err := r.valueType()
+		if err != nil {
+			return err
+		}
+		mut, err := r.byte()
+		if err != nil {
+			return err
+		}
+		if mut > 1 {
+			return fmt.Errorf("invalid global mutability %d", mut)
+		}
+		init, err := m.constExpr(r)
+		if err != nil {
+			return err
+		}
+		m.globals = append(m.globals, global{typ: typ, mutable: mut == 1, init: init})
+	}
+	return nil
+}
+
+func (m *Module) decodeExports(r *reader) error {
+	n, err := r.u32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		name, err := r.name()
+		if err != nil {
+			return err
+		}
+		kind, err := r.byte()
+		if err != nil {
+			return err
+		}
+		idx, err := r.u32()
+		if err != nil {
+			return err
+		}
+		// Only functions are exported to the host, the other exports are
+		// dropped.
+		if kind != 0x00 {
+			continue
+		}
+		if _, ok := m.Exports[name]; ok {
+			return fmt.Errorf("duplicate export %s", name)
+		}
+		m.Exports[name] = idx
+	}
+	return nil
+}
+
+func (m *Module) decodeStart(r *reader) error {
+	idx, err := r.u32()
+	if err != nil {
+		return err
+	}
+	m.start = &idx
+	return nil
+}
+
+func (m *Module) decodeElements(r *reader) error {
+	n, err := r.u32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		flags, err := r.u32()
+		if err != nil {
+			return err
+		}
+		if flags != 0 {
+			return fmt.Errorf("element segment %d: only active segments of function indexes are supported", i)
+		}
+		offset, err := m.constExpr(r)
+		if err != nil {
+			return err
+		}
+		count, err := r.u32()
+		if err != nil {
+			return err
+		}
+		seg := segment{offset: uint32(offset)}
+		for j := uint32(0); j < count; j++ {
+			idx, err := r.u32()
+			if err != nil {
+				return err
+			}
+			seg.funcs = append(seg.funcs, idx)
+		}
+		m.elements = append(m.elements, seg)
+	}
+	return nil
+}
+
+func (m *Module) decodeCode(r *reader, funcTypes []uint32) error {
+	n, err := r.u32()
+	if err != nil {
+		return err
+	}
+	if n != uint32(len(funcTypes)) {
+		return fmt.Errorf("%d functions declared but %d defined", len(funcTypes), n)
+	}
+	m.declared = uint32(len(m.Imports) + len(funcTypes))
+	for i := uint32(0); i < n; i++ {
+		size, err := r.u32()
+		if err != nil {
+			return err
+		}
+		code, err := r.bytes(size)
+		if err != nil {
+			return err
+		}
+		fr := &reader{buf: code}
+
+		fn := Function{Type: funcTypes[i]}
+		groups, err := fr.u32()
+		if err != nil {
+			return err
+		}
+		for j := uint32(0); j < groups; j++ {
+			count, err := fr.u32()
+			if err != nil {
+				return err
+			}
+			typ, err := fr.valueType()
+			if err != nil {
+				return err
+			}
+			if uint64(len(fn.Locals))+uint64(count) > maxLocals {
+				return fmt.Errorf("function %d: too many locals", i)
+			}
+			for k := uint32(0); k < count; k++ {
+				fn.Locals = append(fn.Locals, typ)
+			}
+		}
+		if fn.body, err = m.decodeBody(fr); err != nil {
+			return fmt.Errorf("function %d: %s", i, err)
+		}
+		m.Functions = append(m.Functions, fn)
+	}
+	return nil
+}
+
+func (m *Module) decodeData(r *reader) error {
+	n, err := r.u32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		flags, err := r.u32()
+		if err != nil {
+			return err
+		}
+		if flags != 0 {
+			return fmt.Errorf("data segment %d: only active segments are supported", i)
+		}
+		offset, err := m.constExpr(r)
+		if err != nil {
+			return err
+		}
+		size, err := r.u32()
+		if err != nil {
+			return err
+		}
+		data, err := r.bytes(size)
+		if err != nil {
+			return err
+		}
+		m.data = append(m.data, segment{offset: uint32(offset), data: data})
+	}
+	return nil
+}
+
+// constExpr evaluates an initializer: a constant or the value of a global
+// defined before.
+func (m *Module) constExpr(r *reader) (uint64, error) {
+	op, err := r.byte()
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	switch op {
+	case opI32Const:
+		c, err := r.s32()
+		if err != nil {
+			return 0, err
+		}
+		v = uint64(uint32(c))
+	case opI64Const:
+		c, err := r.s64()
+		if err != nil {
+			return 0, err
+		}
+		v = uint64(c)
+	case opGlobalGet:
+		idx, err := r.u32()
+		if err != nil {
+			return 0, err
+		}
+		if idx >= uint32(len(m.globals)) {
+			return 0, fmt.Errorf("unknown global %d", idx)
+		}
+		v = m.globals[idx].init
+	default:
+		return 0, fmt.Errorf("unsupported initializer opcode 0x%x", op)
+	}
+	end, err := r.byte()
+	if err != nil {
+		return 0, err
+	}
+	if end != opEnd {
+		return 0, fmt.Errorf("initializer not terminated")
+	}
+	return v, nil
+}
+
+// reader reads the values of the binary format.
+type reader struct {
+	buf []byte
+	pos int
+}
+
+func (r *reader) done() bool {
+	return r.pos >= len(r.buf)
+}
+
+func (r *reader) byte() (byte, error) {
+	if r.done() {
+		return 0, fmt.Errorf("unexpected end of module")
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *reader) bytes(n uint32) ([]byte, error) {
+	if uint64(n) > uint64(len(r.buf)-r.pos) {
+		return nil, fmt.Errorf("unexpected end of module")
+	}
+	b := r.buf[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+func (r *reader) name() (string, error) {
+	n, err := r.u32()
+	if err != nil {
+		return "", err
+	}
+	b, err := r.bytes(n)
+	return string(b), err
+}
+
+func (r *reader) valueType() (ValueType, error) {
+	b, err := r.byte()
+	if err != nil {
+		return 0, err
+	}
+	switch t := ValueType(b); t {
+	case I32, I64:
+		return t, nil
+	default:
+		return 0, fmt.Errorf("unsupported value type 0x%x", b)
+	}
+}
+
+func (r *reader) valueTypes() ([]ValueType, error) {
+	n, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+	if uint64(n) > uint64(len(r.buf)-r.pos) {
+		return nil, fmt.Errorf("unexpected end of module")
+	}
+	types := make([]ValueType, n)
+	for i := range types {
+		if types[i], err = r.valueType(); err != nil {
+			return nil, err
+		}
+	}
+	return types, nil
+}
+
+func (r *reader) limits() (*Limits, error) {
+	flag, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	if flag > 1 {
+		return nil, fmt.Errorf("invalid limits flag %d", flag)
+	}
+	l := &Limits{HasMax: flag == 1}
+	if l.Min, err = r.u32(); err != nil {
+		return nil, err
+	}
+	if l.HasMax {
+		if l.Max, err = r.u32(); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// u32 reads an unsigned LEB128 integer of at most 32 bits.
+func (r *reader) u32() (uint32, error) {
+	v, err := r.uleb(32)
+	return uint32(v), err
+}
+
+func (r *reader) uleb(bits uint) (uint64, error) {
+	var v uint64
+	for shift := uint(0); ; shift += 7 {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		if shift >= bits || (bits-shift < 7 && uint64(b&0x7f)>>(bits-shift) != 0) {
+			return 0, fmt.Errorf("integer too large")
+		}
+		v |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return v, nil
+		}
+	}
+}
+
+// s32 reads a signed LEB128 integer of at most 32 bits.
+func (r *reader) s32() (int32, error) {
+	v, err := r.sleb(32)
+	if err != nil {
+		return 0, err
+	}
+	if v < math.MinInt32 || v > math.MaxInt32 {
+		return 0, fmt.Errorf("integer too large")
+	}
+	return int32(v), nil
+}
+
+// s64 reads a signed LEB128 integer of at most 64 bits.
+func (r *reader) s64() (int64, error) {
+	return r.sleb(64)
+}
+
+func (r *reader) sleb(bits uint) (int64, error) {
+	var v int64
+	var shift uint
+	for {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		if shift >= bits {
+			return 0, fmt.Errorf("integer too large")
+		}
+		v |= int64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			if shift < 64 && b&0x40 != 0 {
+				v |= -1 << shift
+			}
+			return v, nil
+		}
+	}
+}
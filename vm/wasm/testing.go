@@ -0,0 +1,170 @@
+package wasm
+
+// TestImport is a function imported by a TestModule.
+type TestImport struct {
+	Module string
+	Name   string
+	Type   FuncType
+}
+
+// TestFunc is a function defined by a TestModule. Body holds its
+// instructions, the final end included.
+type TestFunc struct {
+	Type   FuncType
+	Locals []ValueType
+	Body   []byte
+	// Export is the name of the function exported, if not empty.
+	Export string
+}
+
+// TestModule describes a module for tests to assemble. Each function has a
+// type of its own, those of the imports first: the type of the function with
+// index i is the type with index i.
+type TestModule struct {
+	Imports []TestImport
+	Funcs   []TestFunc
+	// Pages is the size of the memory. The module has no memory when it is
+	// zero.
+	Pages uint32
+	// Data is copied into the memory at address zero.
+	Data []byte
+	// Table lists the functions of the table, which the module has when it
+	// is not empty.
+	Table []uint32
+	// Start is the index of the start function, if any.
+	Start *uint32
+}
+
+// Assemble encodes the module in the WebAssembly binary format.
+func (tm TestModule) Assemble() []byte {
+	out := []byte(magic + version)
+
+	var types [][]byte
+	for _, imp := range tm.Imports {
+		types = append(types, encodeFuncType(imp.Type))
+	}
+	for _, fn := range tm.Funcs {
+		types = append(types, encodeFuncType(fn.Type))
+	}
+	out = appendSection(out, sectionType, encodeVec(types))
+
+	if len(tm.Imports) > 0 {
+		var imports [][]byte
+		for i, imp := range tm.Imports {
+			var b []byte
+			b = appendName(b, imp.Module)
+			b = appendName(b, imp.Name)
+			b = append(b, 0x00)
+			b = appendUleb(b, uint64(i))
+			imports = append(imports, b)
+		}
+		out = appendSection(out, sectionImport, encodeVec(imports))
+	}
+
+	var funcs, exports, codes [][]byte
+	for i, fn := range tm.Funcs {
+		idx := uint64(len(tm.Imports) + i)
+		funcs = append(funcs, appendUleb(nil, idx))
+		if fn.Export != "" {
+			b := appendName(nil, fn.Export)
+			b = append(b, 0x00)
+			exports = append(exports, appendUleb(b, idx))
+		}
+		b := appendUleb(nil, uint64(len(fn.Locals)))
+		for _, l := range fn.Locals {
+			b = append(b, 1, byte(l))
+		}
+		b = append(b, fn.Body...)
+		codes = append(codes, append(appendUleb(nil, uint64(len(b))), b...))
+	}
+	out = appendSection(out, sectionFunction, encodeVec(funcs))
+
+	if len(tm.Table) > 0 {
+		b := []byte{0x70, 0x00}
+		b = appendUleb(b, uint64(len(tm.Table)))
+		out = appendSection(out, sectionTable, encodeVec([][]byte{b}))
+	}
+	if tm.Pages > 0 {
+		b := appendUleb([]byte{0x00}, uint64(tm.Pages))
+		out = appendSection(out, sectionMemory, encodeVec([][]byte{b}))
+	}
+	out = appendSection(out, sectionExport, encodeVec(exports))
+	if tm.Start != nil {
+		out = appendSection(out, sectionStart, appendUleb(nil, uint64(*tm.Start)))
+	}
+	if len(tm.Table) > 0 {
+		b := []byte{0x00, opI32Const, 0x00, opEnd}
+		b = appendUleb(b, uint64(len(tm.Table)))
+		for _, idx := range tm.Table {
+			b = appendUleb(b, uint64(idx))
+		}
+		out = appendSection(out, sectionElement, encodeVec([][]byte{b}))
+	}
+	out = appendSection(out, sectionCode, encodeVec(codes))
+	if len(tm.Data) > 0 {
+		b := []byte{0x00, opI32Const, 0x00, opEnd}
+		b = appendUleb(b, uint64(len(tm.Data)))
+		b = append(b, tm.Data...)
+		out = appendSection(out, sectionData, encodeVec([][]byte{b}))
+	}
+	return out
+}
+
+func encodeFuncType(ft FuncType) []byte {
+	b := []byte{0x60}
+	b = appendUleb(b, uint64(len(ft.Params)))
+	b = append(b, valueTypeBytes(ft.Params)...)
+	b = appendUleb(b, uint64(len(ft.Results)))
+	return append(b, valueTypeBytes(ft.Results)...)
+}
+
+func encodeVec(items [][]byte) []byte {
+	b := appendUleb(nil, uint64(len(items)))
+	for _, item := range items {
+		b = append(b, item...)
+	}
+	return b
+}
+
+func appendSection(b []byte, id byte, content []byte) []byte {
+	b = append(b, id)
+	b = appendUleb(b, uint64(len(content)))
+	return append(b, content...)
+}
+
+func appendName(b []byte, name string) []byte {
+	b = appendUleb(b, uint64(len(name)))
+	return append(b, name...)
+}
+
+func appendUleb(b []byte, v uint64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v == 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+// TestConst returns the bytes of an i32.const instruction.
+func TestConst(v int32) []byte {
+	return appendSleb([]byte{opI32Const}, int64(v))
+}
+
+// TestConst64 returns the bytes of an i64.const instruction.
+func TestConst64(v int64) []byte {
+	return appendSleb([]byte{opI64Const}, v)
+}
+
+func appendSleb(b []byte, v int64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && c&0x40 == 0) || (v == -1 && c&0x40 != 0) {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
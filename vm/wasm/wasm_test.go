@@ -0,0 +1,393 @@
+package wasm_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/filecoin-project/go-filecoin/vm/wasm"
+)
+
+var (
+	i32ToI32 = FuncType{Params: []ValueType{I32}, Results: []ValueType{I32}}
+	i64ToI64 = FuncType{Params: []ValueType{I64}, Results: []ValueType{I64}}
+	toI32    = FuncType{Results: []ValueType{I32}}
+	toI64    = FuncType{Results: []ValueType{I64}}
+)
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+func instantiate(t *testing.T, tm TestModule, imports Imports, meter Meter) *Instance {
+	m, err := Decode(tm.Assemble())
+	require.NoError(t, err)
+	inst, err := Instantiate(m, imports, meter)
+	require.NoError(t, err)
+	return inst
+}
+
+func invoke1(t *testing.T, inst *Instance, name string, args ...uint64) uint64 {
+	results, err := inst.Invoke(name, args...)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	return results[0]
+}
+
+func TestDecode(t *testing.T) {
+	t.Run("decodes the functions and exports", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		m, err := Decode(TestModule{
+			Imports: []TestImport{{Module: "env", Name: "f", Type: toI32}},
+			Funcs:   []TestFunc{{Type: i32ToI32, Body: []byte{0x20, 0, 0x0b}, Export: "id"}},
+			Pages:   1,
+		}.Assemble())
+		require.NoError(err)
+		assert.Len(m.Imports, 1)
+		assert.Len(m.Functions, 1)
+		assert.Equal(uint32(1), m.Exports["id"])
+		ft, ok := m.FuncType(1)
+		assert.True(ok)
+		assert.True(ft.Equal(i32ToI32))
+		assert.Equal(uint32(1), m.Memory.Min)
+	})
+
+	t.Run("rejects invalid modules", func(t *testing.T) {
+		assert := assert.New(t)
+
+		_, err := Decode([]byte("not wasm"))
+		assert.Error(err)
+
+		valid := TestModule{Funcs: []TestFunc{{Type: toI32, Body: []byte{0x41, 1, 0x0b}}}}.Assemble()
+		_, err = Decode(valid[:len(valid)-1])
+		assert.Error(err)
+
+		// floating point values are not deterministic
+		_, err = Decode(TestModule{Funcs: []TestFunc{{Type: FuncType{Params: []ValueType{0x7d}}, Body: []byte{0x0b}}}}.Assemble())
+		assert.Error(err)
+		_, err = Decode(TestModule{Funcs: []TestFunc{{Type: FuncType{}, Body: []byte{0x43, 0, 0, 0, 0, 0x1a, 0x0b}}}}.Assemble())
+		assert.Error(err)
+
+		// unknown function and label, memory access without memory
+		_, err = Decode(TestModule{Funcs: []TestFunc{{Type: FuncType{}, Body: []byte{0x10, 5, 0x0b}}}}.Assemble())
+		assert.Error(err)
+		_, err = Decode(TestModule{Funcs: []TestFunc{{Type: FuncType{}, Body: []byte{0x0c, 1, 0x0b}}}}.Assemble())
+		assert.Error(err)
+		_, err = Decode(TestModule{Funcs: []TestFunc{{Type: toI32, Body: []byte{0x41, 0, 0x28, 2, 0, 0x0b}}}}.Assemble())
+		assert.Error(err)
+
+		// unbalanced blocks
+		_, err = Decode(TestModule{Funcs: []TestFunc{{Type: FuncType{}, Body: []byte{0x02, 0x40, 0x0b}}}}.Assemble())
+		assert.Error(err)
+	})
+}
+
+func TestInvoke(t *testing.T) {
+	t.Parallel()
+
+	inst := instantiate(t, TestModule{Funcs: []TestFunc{
+		{
+			Type:   FuncType{Params: []ValueType{I32, I32}, Results: []ValueType{I32}},
+			Body:   []byte{0x20, 0, 0x20, 1, 0x6a, 0x0b},
+			Export: "add",
+		},
+		{
+			// recursive factorial with if and else
+			Type: i64ToI64,
+			Body: []byte{
+				0x20, 0, 0x50, 0x04, 0x7e,
+				0x42, 1,
+				0x05,
+				0x20, 0, 0x20, 0, 0x42, 1, 0x7d, 0x10, 1, 0x7e,
+				0x0b, 0x0b,
+			},
+			Export: "fac",
+		},
+		{
+			// sums 1 to n in a loop
+			Type:   i32ToI32,
+			Locals: []ValueType{I32},
+			Body: []byte{
+				0x02, 0x40, 0x03, 0x40,
+				0x20, 0, 0x45, 0x0d, 1,
+				0x20, 1, 0x20, 0, 0x6a, 0x21, 1,
+				0x20, 0, 0x41, 1, 0x6b, 0x21, 0,
+				0x0c, 0,
+				0x0b, 0x0b,
+				0x20, 1, 0x0b,
+			},
+			Export: "sum",
+		},
+		{
+			Type: i32ToI32,
+			Body: []byte{
+				0x02, 0x40, 0x02, 0x40, 0x02, 0x40,
+				0x20, 0, 0x0e, 2, 0, 1, 2,
+				0x0b, 0x41, 10, 0x0f,
+				0x0b, 0x41, 20, 0x0f,
+				0x0b, 0x41, 30, 0x0b,
+			},
+			Export: "switch",
+		},
+		{
+			// a branch out of a block carries its result and drops the rest
+			Type:   toI32,
+			Body:   []byte{0x02, 0x7f, 0x41, 7, 0x41, 8, 0x0c, 0, 0x0b, 0x0b},
+			Export: "branch",
+		},
+		{
+			Type:   toI32,
+			Body:   concat(TestConst(-1), []byte{0x41, 3, 0x6d, 0x0b}),
+			Export: "div",
+		},
+		{
+			Type:   toI64,
+			Body:   concat(TestConst64(-1), []byte{0x42, 60, 0x88, 0x0b}),
+			Export: "shift",
+		},
+	}}, nil, nil)
+
+	t.Run("calls exported functions", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal(uint64(5), invoke1(t, inst, "add", 2, 3))
+		assert.Equal(uint64(1), invoke1(t, inst, "add", 0xffffffff, 2))
+		assert.Equal(uint64(3628800), invoke1(t, inst, "fac", 10))
+		assert.Equal(uint64(5050), invoke1(t, inst, "sum", 100))
+		assert.Equal(uint64(10), invoke1(t, inst, "switch", 0))
+		assert.Equal(uint64(20), invoke1(t, inst, "switch", 1))
+		assert.Equal(uint64(30), invoke1(t, inst, "switch", 7))
+		assert.Equal(uint64(8), invoke1(t, inst, "branch"))
+		assert.Equal(uint64(0), invoke1(t, inst, "div"))
+		assert.Equal(uint64(15), invoke1(t, inst, "shift"))
+	})
+
+	t.Run("checks the export and its arguments", func(t *testing.T) {
+		assert := assert.New(t)
+
+		_, err := inst.Invoke("missing")
+		assert.Error(err)
+		_, err = inst.Invoke("add", 1)
+		assert.Error(err)
+	})
+}
+
+func TestMemory(t *testing.T) {
+	t.Parallel()
+
+	inst := instantiate(t, TestModule{
+		Pages: 1,
+		Data:  []byte("hello"),
+		Funcs: []TestFunc{
+			{Type: i32ToI32, Body: []byte{0x20, 0, 0x2d, 0, 0, 0x0b}, Export: "byte"},
+			{
+				Type:   toI64,
+				Body:   concat([]byte{0x41, 8}, TestConst64(-2), []byte{0x37, 3, 0, 0x41, 8, 0x29, 3, 0, 0x0b}),
+				Export: "roundtrip",
+			},
+			{Type: i32ToI32, Body: []byte{0x20, 0, 0x40, 0, 0x0b}, Export: "grow"},
+			{Type: toI32, Body: []byte{0x3f, 0, 0x0b}, Export: "size"},
+			{Type: i32ToI32, Body: []byte{0x20, 0, 0x28, 2, 0, 0x0b}, Export: "load"},
+		},
+	}, nil, nil)
+
+	assert := assert.New(t)
+
+	assert.Equal(uint64('o'), invoke1(t, inst, "byte", 4))
+	assert.Equal(uint64(0xfffffffffffffffe), invoke1(t, inst, "roundtrip"))
+
+	assert.Equal(uint64(1), invoke1(t, inst, "grow", 2))
+	assert.Equal(uint64(3), invoke1(t, inst, "size"))
+	assert.Equal(uint64(0xffffffff), invoke1(t, inst, "grow", 1000))
+	assert.Equal(uint32(3), inst.Pages())
+
+	_, err := inst.Invoke("load", 3*PageSize-2)
+	assert.IsType(&Trap{}, err)
+
+	require.NoError(t, inst.Write(100, []byte("abc")))
+	data, err := inst.Read(100, 3)
+	require.NoError(t, err)
+	assert.Equal([]byte("abc"), data)
+	_, err = inst.Read(3*PageSize-1, 2)
+	assert.Error(err)
+}
+
+func TestTraps(t *testing.T) {
+	t.Parallel()
+
+	inst := instantiate(t, TestModule{
+		Funcs: []TestFunc{
+			{Type: FuncType{}, Body: []byte{0x00, 0x0b}, Export: "unreachable"},
+			{Type: toI32, Body: []byte{0x41, 1, 0x41, 0, 0x6e, 0x0b}, Export: "divzero"},
+			{Type: FuncType{}, Body: []byte{0x10, 2, 0x0b}, Export: "recurse"},
+			{Type: toI32, Body: []byte{0x41, 0, 0x11, 3, 0, 0x0b}, Export: "indirect"},
+			{Type: toI32, Body: []byte{0x41, 1, 0x11, 3, 0, 0x0b}, Export: "undefined"},
+		},
+		Table: []uint32{0},
+	}, nil, nil)
+
+	for _, name := range []string{"unreachable", "divzero", "recurse", "indirect", "undefined"} {
+		_, err := inst.Invoke(name)
+		assert.IsType(t, &Trap{}, err, name)
+	}
+
+	// the instance can still be used after a trap
+	_, err := inst.Invoke("unreachable")
+	assert.IsType(t, &Trap{}, err)
+}
+
+func TestHostFunctions(t *testing.T) {
+	t.Parallel()
+
+	failure := errors.New("host failure")
+	imports := Imports{"env": {
+		"double": {Type: i32ToI32, Call: func(inst *Instance, args []uint64) ([]uint64, error) {
+			if args[0] == 0 {
+				return nil, failure
+			}
+			return []uint64{args[0] * 2}, nil
+		}},
+	}}
+	tm := TestModule{
+		Imports: []TestImport{{Module: "env", Name: "double", Type: i32ToI32}},
+		Funcs:   []TestFunc{{Type: i32ToI32, Body: []byte{0x20, 0, 0x10, 0, 0x41, 1, 0x6a, 0x0b}, Export: "run"}},
+	}
+
+	t.Run("calls the imports", func(t *testing.T) {
+		assert := assert.New(t)
+
+		inst := instantiate(t, tm, imports, nil)
+		assert.Equal(uint64(43), invoke1(t, inst, "run", 21))
+
+		_, err := inst.Invoke("run", 0)
+		assert.Equal(failure, err)
+	})
+
+	t.Run("fails on missing or mistyped imports", func(t *testing.T) {
+		assert := assert.New(t)
+
+		m, err := Decode(tm.Assemble())
+		require.NoError(t, err)
+		_, err = Instantiate(m, nil, nil)
+		assert.Error(err)
+
+		_, err = Instantiate(m, Imports{"env": {"double": {Type: toI32}}}, nil)
+		assert.Error(err)
+	})
+
+	t.Run("returns runtime errors as interpreter errors", func(t *testing.T) {
+		assert := assert.New(t)
+
+		broken := Imports{"env": {
+			"double": {Type: i32ToI32, Call: func(inst *Instance, args []uint64) ([]uint64, error) {
+				var results []uint64
+				return []uint64{results[args[0]]}, nil
+			}},
+		}}
+		inst := instantiate(t, tm, broken, nil)
+		_, err := inst.Invoke("run", 1)
+		assert.IsType(&InterpreterError{}, err)
+	})
+}
+
+type testMeter struct {
+	instructions uint64
+	pages        uint32
+	bytes        uint32
+	limit        uint64
+}
+
+var errOutOfGas = errors.New("out of gas")
+
+func (tm *testMeter) ChargeInstructions(count uint64) error {
+	tm.instructions += count
+	if tm.instructions > tm.limit {
+		return errOutOfGas
+	}
+	return nil
+}
+
+func (tm *testMeter) ChargePages(count uint32) error {
+	tm.pages += count
+	return nil
+}
+
+func (tm *testMeter) ChargeMemoryBytes(count uint32) error {
+	tm.bytes += count
+	return nil
+}
+
+func TestMeter(t *testing.T) {
+	t.Parallel()
+
+	tm := TestModule{
+		Pages: 2,
+		Funcs: []TestFunc{{
+			Type:   i32ToI32,
+			Locals: []ValueType{I32},
+			Body: []byte{
+				0x02, 0x40, 0x03, 0x40,
+				0x20, 0, 0x45, 0x0d, 1,
+				0x20, 0, 0x41, 1, 0x6b, 0x21, 0,
+				0x0c, 0,
+				0x0b, 0x0b,
+				0x20, 1, 0x0b,
+			},
+			Export: "loop",
+		}},
+	}
+
+	t.Run("charges the instructions and pages", func(t *testing.T) {
+		assert := assert.New(t)
+
+		meter := &testMeter{limit: 1000000}
+		inst := instantiate(t, tm, nil, meter)
+		assert.Equal(uint32(2), meter.pages)
+
+		invoke1(t, inst, "loop", 1000)
+		// 8 instructions per iteration
+		assert.True(meter.instructions >= 8000)
+		assert.True(meter.instructions <= 10000)
+		assert.Equal(uint64(0), meter.instructions%InstructionBatch)
+	})
+
+	t.Run("aborts when the meter fails", func(t *testing.T) {
+		assert := assert.New(t)
+
+		meter := &testMeter{limit: 5000}
+		inst := instantiate(t, tm, nil, meter)
+		_, err := inst.Invoke("loop", 1000000)
+		assert.Equal(errOutOfGas, err)
+	})
+
+	t.Run("charges the bytes of bulk memory instructions", func(t *testing.T) {
+		assert := assert.New(t)
+
+		bulk := TestModule{
+			Pages: 1,
+			Funcs: []TestFunc{{
+				Type: toI32,
+				Body: []byte{
+					// memory.fill(0, 7, 3000)
+					0x41, 0, 0x41, 7, 0x41, 0xb8, 0x17, 0xfc, 0x0b, 0,
+					// memory.copy(100, 0, 50)
+					0x41, 0xe4, 0, 0x41, 0, 0x41, 50, 0xfc, 0x0a, 0, 0,
+					0x41, 0, 0x0b,
+				},
+				Export: "bulk",
+			}},
+		}
+		meter := &testMeter{limit: 1000000}
+		inst := instantiate(t, bulk, nil, meter)
+		invoke1(t, inst, "bulk")
+		assert.Equal(uint32(3050), meter.bytes)
+	})
+}